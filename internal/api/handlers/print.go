@@ -88,8 +88,9 @@ func (ph *PrintHandler) readOutputFile(outputPath string) ([]byte, error) {
 
 // PrintRequest represents a print request
 type PrintRequest struct {
-	Content     string                  `json:"content" binding:"required"`
+	Content     string                  `json:"content"`
 	ContentType domain.ContentType      `json:"content_type"`
+	Parts       []domain.DocumentPart   `json:"parts"` // Documents merged into one PDF, in place of Content
 	Options     domain.PrintOptions     `json:"options"`
 	Metadata    domain.DocumentMetadata `json:"metadata"`
 }
@@ -107,9 +108,9 @@ func (ph *PrintHandler) Print(c *gin.Context) {
 	}
 
 	// Validate required fields
-	if req.Content == "" {
+	if req.Content == "" && len(req.Parts) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Content is required",
+			"error": "Content or parts are required",
 		})
 		return
 	}
@@ -124,6 +125,7 @@ func (ph *PrintHandler) Print(c *gin.Context) {
 		ID:          utils.GenerateID(),
 		Content:     req.Content,
 		ContentType: req.ContentType,
+		Parts:       req.Parts,
 		Metadata:    req.Metadata,
 		Options:     req.Options,
 		CreatedAt:   time.Now(),
@@ -9,6 +9,7 @@ type Document struct {
 	ID          string           `json:"id"`
 	Content     string           `json:"content"`
 	ContentType ContentType      `json:"content_type"`
+	Parts       []DocumentPart   `json:"parts,omitempty"` // Documents merged into one PDF in place of Content
 	Metadata    DocumentMetadata `json:"metadata"`
 	Options     PrintOptions     `json:"options"`
 	CreatedAt   time.Time        `json:"created_at"`
@@ -22,8 +23,19 @@ const (
 	ContentTypeHTML     ContentType = "html"
 	ContentTypeMarkdown ContentType = "markdown"
 	ContentTypeText     ContentType = "text"
+	ContentTypePDF      ContentType = "pdf"   // PDF file as a data URI, for document parts
+	ContentTypeImage    ContentType = "image" // Image file as a data URI, for document parts
 )
 
+// DocumentPart is one document of a compound job. The parts are concatenated
+// in order into one PDF with continuous page numbering.
+type DocumentPart struct {
+	Content     string       `json:"content"`         // HTML, or a data URI holding a PDF or an image
+	ContentType ContentType  `json:"content_type"`    // html, pdf or image; html when empty
+	Page        *PageOptions `json:"page,omitempty"`  // Page options of the part, the job's when nil
+	Title       string       `json:"title,omitempty"` // Label of the part's entry in the combined outline, none when empty
+}
+
 // DocumentMetadata contains metadata about the document
 type DocumentMetadata struct {
 	Title       string            `json:"title"`
@@ -35,19 +47,54 @@ type DocumentMetadata struct {
 	CustomProps map[string]string `json:"custom_props"`
 }
 
+// WithDefaults returns the metadata with empty fields taken from fallback.
+// Custom properties are merged, keeping the values already set.
+func (m DocumentMetadata) WithDefaults(fallback DocumentMetadata) DocumentMetadata {
+	if m.Title == "" {
+		m.Title = fallback.Title
+	}
+	if m.Author == "" {
+		m.Author = fallback.Author
+	}
+	if m.Subject == "" {
+		m.Subject = fallback.Subject
+	}
+	if len(m.Keywords) == 0 {
+		m.Keywords = fallback.Keywords
+	}
+	if m.Creator == "" {
+		m.Creator = fallback.Creator
+	}
+	if m.Producer == "" {
+		m.Producer = fallback.Producer
+	}
+	if len(fallback.CustomProps) > 0 {
+		props := make(map[string]string, len(m.CustomProps)+len(fallback.CustomProps))
+		for key, value := range fallback.CustomProps {
+			props[key] = value
+		}
+		for key, value := range m.CustomProps {
+			props[key] = value
+		}
+		m.CustomProps = props
+	}
+	return m
+}
+
 // PrintJob represents a print job in the system
 type PrintJob struct {
-	ID          string      `json:"id"`
-	Document    Document    `json:"document"`
-	Status      JobStatus   `json:"status"`
-	Progress    float64     `json:"progress"`
-	Error       string      `json:"error,omitempty"`
-	OutputPath  string      `json:"output_path,omitempty"`
-	CreatedAt   time.Time   `json:"created_at"`
-	StartedAt   *time.Time  `json:"started_at,omitempty"`
-	CompletedAt *time.Time  `json:"completed_at,omitempty"`
-	RetryCount  int         `json:"retry_count"`
-	Priority    JobPriority `json:"priority"`
+	ID          string         `json:"id"`
+	Document    Document       `json:"document"`
+	Status      JobStatus      `json:"status"`
+	Progress    float64        `json:"progress"`
+	Error       string         `json:"error,omitempty"`
+	OutputPath  string         `json:"output_path,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	StartedAt   *time.Time     `json:"started_at,omitempty"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+	RetryCount  int            `json:"retry_count"`
+	Priority    JobPriority    `json:"priority"`
+	Signature   *SignatureInfo `json:"signature,omitempty"` // Digital signature of the output
 }
 
 // JobStatus represents the status of a print job
@@ -72,10 +119,22 @@ const (
 
 // RenderResult represents the result of a document rendering operation
 type RenderResult struct {
-	OutputPath string        `json:"output_path"`
-	OutputSize int64         `json:"output_size"`
-	PageCount  int           `json:"page_count"`
-	RenderTime time.Duration `json:"render_time"`
-	CacheHit   bool          `json:"cache_hit"`
-	Warnings   []string      `json:"warnings,omitempty"`
+	OutputPath string         `json:"output_path"`
+	OutputSize int64          `json:"output_size"`
+	PageCount  int            `json:"page_count"`
+	RenderTime time.Duration  `json:"render_time"`
+	CacheHit   bool           `json:"cache_hit"`
+	Warnings   []string       `json:"warnings,omitempty"`
+	Signature  *SignatureInfo `json:"signature,omitempty"` // Set when the output was signed
+}
+
+// SignatureInfo describes the digital signature applied to an output
+type SignatureInfo struct {
+	Signer   string    `json:"signer"` // Subject of the signing certificate
+	Issuer   string    `json:"issuer"` // Issuer of the signing certificate
+	Serial   string    `json:"serial"` // Serial number of the signing certificate, in hexadecimal
+	SignedAt time.Time `json:"signed_at"`
+	Field    string    `json:"field"` // Name of the signature field
+	Visible  bool      `json:"visible"`
+	Profile  string    `json:"profile"` // Signature profile, e.g. "PAdES-B-B"
 }
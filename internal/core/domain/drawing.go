@@ -0,0 +1,133 @@
+package domain
+
+import "math"
+
+// Drawing is vector artwork from an inline svg element or an SVG image, as
+// shapes in the user space of its view box
+type Drawing struct {
+	Width   float64 // Intrinsic width in CSS pixels, 0 when the artwork sets none
+	Height  float64 // Intrinsic height in CSS pixels, 0 when the artwork sets none
+	ViewBox *Box    // Area of user space fitted into the box the drawing is drawn in, nil for none
+	Align   string  // preserveAspectRatio alignment such as xMidYMid, or none to stretch
+	Slice   bool    // Scale the view box to cover the box rather than fit inside it
+	Title   string  // Text of the artwork's title element, describing it
+	Shapes  []Shape // Shapes in painting order
+}
+
+// Shape is a filled and stroked path, or a line of text, of a drawing
+type Shape struct {
+	Path          []PathSegment // Outline in the shape's user space
+	Text          *DrawingText  // Text drawn instead of a path, nil for paths
+	Transform     Matrix        // Shape user space to drawing user space
+	Fill          Paint         // Paint inside the outline
+	Stroke        Paint         // Paint along the outline
+	FillRule      string        // nonzero or evenodd
+	StrokeWidth   float64       // Stroke width in user units
+	LineCap       string        // butt, round or square
+	LineJoin      string        // miter, round or bevel
+	MiterLimit    float64       // Longest miter join, in stroke widths
+	Dash          []float64     // Dash lengths in user units, nil for solid strokes
+	DashOffset    float64       // Distance into the dash pattern the stroke starts at
+	FillOpacity   float64       // Fill opacity, including the opacity of the shape and its groups
+	StrokeOpacity float64       // Stroke opacity, including the opacity of the shape and its groups
+}
+
+// PathSegment is one command of an outline, in absolute coordinates. Lines
+// use Points[0]; cubic curves use two control points and the end point.
+type PathSegment struct {
+	Op     byte     // M (move), L (line), C (cubic curve) or Z (close)
+	Points [3]Point // Points of the command
+}
+
+// Point is a position in user space
+type Point struct {
+	X float64
+	Y float64
+}
+
+// DrawingText is a line of text placed at a point of a drawing
+type DrawingText struct {
+	X       float64   // Anchor point in user units
+	Y       float64   // Baseline in user units
+	Content string    // Text with white space collapsed
+	Font    FontStyle // Font, with its size in user units
+	Anchor  string    // start, middle or end
+}
+
+// Paint is what a shape is filled or stroked with; the zero Paint is none
+type Paint struct {
+	Color    *Color    // Solid color
+	Gradient *Gradient // Gradient, when not a solid color
+}
+
+// IsNone reports whether nothing is painted
+func (p Paint) IsNone() bool {
+	return p.Color == nil && p.Gradient == nil
+}
+
+// Gradient is a linear or radial color gradient. Colors are padded beyond
+// the first and last stops.
+type Gradient struct {
+	Radial    bool           // Radial rather than linear
+	X1, Y1    float64        // Start of a linear gradient's axis
+	X2, Y2    float64        // End of a linear gradient's axis
+	CX, CY    float64        // Center of a radial gradient's end circle
+	R         float64        // Radius of a radial gradient's end circle
+	FX, FY    float64        // Focal point a radial gradient starts at
+	Stops     []GradientStop // Colors along the gradient, by increasing offset
+	Transform Matrix         // Gradient space to the user space of the shape it paints
+}
+
+// GradientStop is a color at an offset along a gradient
+type GradientStop struct {
+	Offset  float64 // Position from 0 to 1
+	Color   Color   // Stop color
+	Opacity float64 // Stop opacity from 0 to 1
+}
+
+// Matrix is a 2D affine transformation [a b c d e f], mapping (x, y) to
+// (ax + cy + e, bx + dy + f) like the SVG and PDF matrices
+type Matrix [6]float64
+
+// Identity is the transformation that changes nothing
+var Identity = Matrix{1, 0, 0, 1, 0, 0}
+
+// Multiply returns the transformation that applies n, then m
+func (m Matrix) Multiply(n Matrix) Matrix {
+	return Matrix{
+		m[0]*n[0] + m[2]*n[1],
+		m[1]*n[0] + m[3]*n[1],
+		m[0]*n[2] + m[2]*n[3],
+		m[1]*n[2] + m[3]*n[3],
+		m[0]*n[4] + m[2]*n[5] + m[4],
+		m[1]*n[4] + m[3]*n[5] + m[5],
+	}
+}
+
+// Apply transforms a point
+func (m Matrix) Apply(p Point) Point {
+	return Point{X: m[0]*p.X + m[2]*p.Y + m[4], Y: m[1]*p.X + m[3]*p.Y + m[5]}
+}
+
+// Invert returns the inverse transformation; ok is false when m flattens
+// the plane and has none
+func (m Matrix) Invert() (inverse Matrix, ok bool) {
+	det := m[0]*m[3] - m[1]*m[2]
+	if det == 0 {
+		return Identity, false
+	}
+	return Matrix{
+		m[3] / det,
+		-m[1] / det,
+		-m[2] / det,
+		m[0] / det,
+		(m[2]*m[5] - m[3]*m[4]) / det,
+		(m[1]*m[4] - m[0]*m[5]) / det,
+	}, true
+}
+
+// Scale returns the factor lengths are scaled by, the geometric mean of the
+// scaling along both axes
+func (m Matrix) Scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
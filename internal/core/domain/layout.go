@@ -1,5 +1,7 @@
 package domain
 
+import "image"
+
 // PageSize represents page dimensions
 type PageSize struct {
 	Width  float64 `json:"width"`  // in mm
@@ -48,6 +50,16 @@ const (
 	TextAlignCenter  TextAlign = "center"
 	TextAlignRight   TextAlign = "right"
 	TextAlignJustify TextAlign = "justify"
+	TextAlignStart   TextAlign = "start"
+	TextAlignEnd     TextAlign = "end"
+)
+
+// TextDirection represents the CSS direction property
+type TextDirection string
+
+const (
+	DirectionLTR TextDirection = "ltr"
+	DirectionRTL TextDirection = "rtl"
 )
 
 // VerticalAlign represents vertical alignment
@@ -85,13 +97,68 @@ const (
 
 // LayoutNode represents a node in the layout tree
 type LayoutNode struct {
-	ID       string        `json:"id"`
-	Type     string        `json:"type"`
-	Box      Box           `json:"box"`
-	Style    ComputedStyle `json:"style"`
-	Children []*LayoutNode `json:"children"`
-	Parent   *LayoutNode   `json:"-"`
-	Content  string        `json:"content,omitempty"`
+	ID         string            `json:"id"`
+	Type       string            `json:"type"`
+	Tag        string            `json:"tag,omitempty"`        // Lower-cased element name
+	Attributes map[string]string `json:"attributes,omitempty"` // Element attributes
+	Box        Box               `json:"box"`
+	Style      ComputedStyle     `json:"style"`
+	Children   []*LayoutNode     `json:"children"`
+	Parent     *LayoutNode       `json:"-"`
+	Content    string            `json:"content,omitempty"`
+	Image      *Image            `json:"-"` // Loaded image of an img element, nil when it has none
+	Barcode    *Barcode          `json:"-"` // Encoded symbol of a barcode element
+	Drawing    *Drawing          `json:"-"` // Vector artwork of an svg element
+	Leader     *Leader           `json:"-"` // Page number ending the last line of a text, nil for none
+	References []*PageReference  `json:"-"` // Page numbers of generated content in the text, in order, until they are filled in
+}
+
+// Leader ends the last line of a text with the number of the page an element
+// starts on, aligned to the right and joined to the text by a repeated fill,
+// as in a table of contents entry
+type Leader struct {
+	Target string  `json:"target"` // id of the element whose page is shown
+	Fill   string  `json:"fill"`   // Repeated between the text and the page number, such as "."
+	Width  float64 `json:"width"`  // Room kept right of the text box for the page number, in CSS pixels
+	Page   int     `json:"page"`   // Page the target starts on, 0 until the layout is paginated or when it is missing
+}
+
+// PageReference is a page number in generated content, such as the result of
+// target-counter(), which is only known once the layout is paginated. The
+// text holds a placeholder for it until then.
+type PageReference struct {
+	Target string // id of the element whose page is shown, empty for the page of the text itself
+	Total  bool   // Shows the number of pages instead
+	Style  string // Counter style the number is written in, such as decimal or lower-roman
+}
+
+// Image is an image loaded for the document. Elements showing the same
+// content share one Image.
+type Image struct {
+	Key     string      // Hash of the encoded data, identifying the content
+	Data    []byte      // Encoded image as loaded
+	Format  string      // Decoded format: jpeg, png, gif or svg
+	Width   int         // Intrinsic width in pixels
+	Height  int         // Intrinsic height in pixels
+	Decoded image.Image // Decoded pixels, nil for SVG images
+	Drawing *Drawing    // Vector artwork of an SVG image, nil for raster images
+}
+
+// Barcode is a machine-readable code as a grid of dark and light modules.
+// The grid includes the quiet zone the symbology requires around the code.
+type Barcode struct {
+	Type         string  // Symbology: code128, ean13, qr, datamatrix or pdf417
+	Value        string  // Encoded data, including any computed check digit
+	Columns      int     // Width of the grid in modules
+	Rows         int     // Height of the grid in modules; 1 for linear codes
+	Dark         []bool  // Dark modules, row by row
+	ModuleWidth  float64 // Intrinsic width of a module in CSS pixels
+	ModuleHeight float64 // Intrinsic height of a module in CSS pixels
+}
+
+// IsDark reports whether the module at a column and row is dark
+func (b *Barcode) IsDark(column, row int) bool {
+	return b.Dark[row*b.Columns+column]
 }
 
 // ComputedStyle represents computed CSS styles
@@ -108,8 +175,36 @@ type ComputedStyle struct {
 	Text       TextStyle   `json:"text"`
 	Color      Color       `json:"color"`
 	ZIndex     int         `json:"z_index"`
+	PageBreak  PageBreak   `json:"page_break"`
+	Content    string      `json:"content"`  // content property of a ::before or ::after pseudo-element
+	Counters   Counters    `json:"counters"` // Counters the element changes
 }
 
+// Counters represents the counter-reset, counter-set and counter-increment
+// properties, as lists of counter names each optionally followed by an integer
+type Counters struct {
+	Reset     string `json:"reset"`
+	Set       string `json:"set"`
+	Increment string `json:"increment"`
+}
+
+// PageBreak represents the CSS page-break-* / break-* properties of an element
+type PageBreak struct {
+	Before BreakType `json:"before"`
+	After  BreakType `json:"after"`
+	Inside BreakType `json:"inside"`
+}
+
+// BreakType represents a page break behaviour
+type BreakType string
+
+const (
+	BreakAuto   BreakType = "auto"
+	BreakAlways BreakType = "always"
+	BreakPage   BreakType = "page"
+	BreakAvoid  BreakType = "avoid"
+)
+
 // BorderStyle represents border styling
 type BorderStyle struct {
 	Width float64    `json:"width"`
@@ -130,10 +225,12 @@ const (
 
 // Background represents background styling
 type Background struct {
-	Color  Color  `json:"color"`
-	Image  string `json:"image"`
-	Repeat string `json:"repeat"`
-	Size   string `json:"size"`
+	Color    Color  `json:"color"`
+	Image    string `json:"image"`    // Address of the background image
+	Repeat   string `json:"repeat"`   // repeat, repeat-x, repeat-y or no-repeat
+	Size     string `json:"size"`     // auto, cover, contain or one or two lengths
+	Position string `json:"position"` // One or two keywords, lengths or percentages
+	Loaded   *Image `json:"-"`        // Image loaded from Image, nil when it was not loaded
 }
 
 // FontStyle represents font styling
@@ -146,12 +243,13 @@ type FontStyle struct {
 
 // TextStyle represents text styling
 type TextStyle struct {
-	Align       TextAlign `json:"align"`
-	Decoration  string    `json:"decoration"`
-	Transform   string    `json:"transform"`
-	LineHeight  float64   `json:"line_height"`
-	LetterSpace float64   `json:"letter_spacing"`
-	WordSpace   float64   `json:"word_spacing"`
+	Align       TextAlign     `json:"align"`
+	Direction   TextDirection `json:"direction"`
+	Decoration  string        `json:"decoration"`
+	Transform   string        `json:"transform"`
+	LineHeight  float64       `json:"line_height"`
+	LetterSpace float64       `json:"letter_spacing"`
+	WordSpace   float64       `json:"word_spacing"`
 }
 
 // Color represents a color value
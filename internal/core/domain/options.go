@@ -1,6 +1,9 @@
 package domain
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // PrintOptions represents options for printing a document
 type PrintOptions struct {
@@ -12,25 +15,30 @@ type PrintOptions struct {
 	Security    SecurityOptions    `json:"security"`
 }
 
-// PageOptions represents page-specific options
+// PageOptions represents page-specific options. The text of Header and
+// Footer may use counter(page), counter(pages), string(title) and
+// string(date), as the content of @page margin boxes can.
 type PageOptions struct {
 	Size        PageSize    `json:"size"`
 	Orientation Orientation `json:"orientation"`
 	Margins     Margins     `json:"margins"`
 	Scale       float64     `json:"scale"`
 	Background  bool        `json:"background"`
+	Header      string      `json:"header,omitempty"` // HTML drawn in the top margin of every page, replacing @page top margin boxes
+	Footer      string      `json:"footer,omitempty"` // HTML drawn in the bottom margin of every page, replacing @page bottom margin boxes
 }
 
 // LayoutOptions represents layout-specific options
 type LayoutOptions struct {
-	WaitForFonts   bool          `json:"wait_for_fonts"`
-	WaitForImages  bool          `json:"wait_for_images"`
-	WaitTimeout    time.Duration `json:"wait_timeout"`
-	ViewportWidth  int           `json:"viewport_width"`
-	ViewportHeight int           `json:"viewport_height"`
-	DPI            int           `json:"dpi"`
-	PrintMediaType bool          `json:"print_media_type"`
-	EmulateMedia   string        `json:"emulate_media"`
+	WaitForFonts    bool          `json:"wait_for_fonts"`
+	WaitForImages   bool          `json:"wait_for_images"`
+	WaitTimeout     time.Duration `json:"wait_timeout"`
+	ViewportWidth   int           `json:"viewport_width"`
+	ViewportHeight  int           `json:"viewport_height"`
+	DPI             int           `json:"dpi"`
+	PrintMediaType  bool          `json:"print_media_type"`
+	EmulateMedia    string        `json:"emulate_media"`
+	TableOfContents bool          `json:"table_of_contents,omitempty"` // Insert a table of contents at the start of documents without a toc element
 }
 
 // RenderOptions represents rendering-specific options
@@ -42,6 +50,8 @@ type RenderOptions struct {
 	OptimizeImages  bool             `json:"optimize_images"`
 	GenerateOutline bool             `json:"generate_outline"`
 	Accessibility   bool             `json:"accessibility"`
+	PDFA            PDFAConformance  `json:"pdfa"`
+	FlattenForms    bool             `json:"flatten_forms"` // Draw form controls as static content instead of fillable fields
 }
 
 // OutputOptions represents output-specific options
@@ -51,6 +61,9 @@ type OutputOptions struct {
 	Destination string       `json:"destination"`
 	Metadata    bool         `json:"metadata"`
 	Watermark   *Watermark   `json:"watermark,omitempty"`
+	Encryption  *Encryption  `json:"encryption,omitempty"`  // Password protection of PDF output
+	Signature   *Signature   `json:"signature,omitempty"`   // Digital signature of PDF output with the configured certificate
+	PageNumber  int          `json:"page_number,omitempty"` // 1-based page to export for raster formats; 0 exports all pages
 }
 
 // PerformanceOptions represents performance-specific options
@@ -93,6 +106,16 @@ const (
 	ColorProfilesRGB ColorProfile = "srgb"
 )
 
+// PDFAConformance represents PDF/A archival conformance levels
+type PDFAConformance string
+
+const (
+	PDFANone PDFAConformance = ""
+	PDFA1B   PDFAConformance = "pdfa-1b"
+	PDFA2B   PDFAConformance = "pdfa-2b"
+	PDFA3B   PDFAConformance = "pdfa-3b"
+)
+
 // CompressionLevel represents compression levels
 type CompressionLevel string
 
@@ -122,6 +145,52 @@ type Watermark struct {
 	Scale    float64 `json:"scale"`
 }
 
+// Visible reports whether the watermark draws anything; a nil watermark does not
+func (w *Watermark) Visible() bool {
+	return w != nil && (w.Text != "" || w.Image != "")
+}
+
+// Encryption represents password protection of PDF output
+type Encryption struct {
+	UserPassword  string              `json:"user_password"`  // Required to open the document; empty opens without one
+	OwnerPassword string              `json:"owner_password"` // Grants full access; a random one is used when empty
+	Algorithm     EncryptionAlgorithm `json:"algorithm"`
+	Permissions   Permissions         `json:"permissions"` // Granted to readers without the owner password
+}
+
+// MarshalJSON leaves the passwords out so stored and reported jobs do not expose them
+func (e Encryption) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Algorithm   EncryptionAlgorithm `json:"algorithm"`
+		Permissions Permissions         `json:"permissions"`
+	}{e.Algorithm, e.Permissions})
+}
+
+// Signature represents a digital signature requested for PDF output
+type Signature struct {
+	Field       string `json:"field,omitempty"`        // data-signature-field of the element showing the signature; the first such element when empty
+	Invisible   bool   `json:"invisible,omitempty"`    // Sign without a visible widget
+	Reason      string `json:"reason,omitempty"`       // Why the document is signed
+	Location    string `json:"location,omitempty"`     // Where the document is signed
+	ContactInfo string `json:"contact_info,omitempty"` // How to reach the signer
+}
+
+// EncryptionAlgorithm represents PDF encryption algorithms
+type EncryptionAlgorithm string
+
+const (
+	EncryptionAES128 EncryptionAlgorithm = "aes-128"
+	EncryptionAES256 EncryptionAlgorithm = "aes-256"
+)
+
+// Permissions represents what readers of an encrypted PDF may do
+type Permissions struct {
+	Print    bool `json:"print"`
+	Copy     bool `json:"copy"`
+	Modify   bool `json:"modify"`
+	Annotate bool `json:"annotate"`
+}
+
 // ResourceLimits represents resource usage limits
 type ResourceLimits struct {
 	MaxCPU    float64       `json:"max_cpu"`
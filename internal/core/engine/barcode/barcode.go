@@ -0,0 +1,143 @@
+package barcode
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/datamatrix"
+	"github.com/boombuler/barcode/ean"
+	"github.com/boombuler/barcode/pdf417"
+	"github.com/boombuler/barcode/qr"
+)
+
+// Default error correction levels
+const (
+	defaultQRLevel     = "M" // Recovers 15% of the symbol
+	defaultPDF417Level = "2" // Six error correction codewords
+)
+
+// symbology describes how a barcode type is encoded and sized
+type symbology struct {
+	encode       func(value, level string) (barcode.Barcode, error)
+	levels       bool    // Accepts an error correction level
+	quietColumns int     // Light modules required left and right of the code
+	quietRows    int     // Light rows required above and below the code
+	rasterRows   int     // Rows the encoder draws for each row of modules
+	moduleWidth  float64 // Intrinsic module width in CSS pixels
+	moduleHeight float64 // Intrinsic module height in CSS pixels
+}
+
+// symbologies are the supported barcode types. Linear codes are one row of
+// bars; a PDF417 row is three modules tall.
+var symbologies = map[string]symbology{
+	"code128": {
+		encode:       func(value, _ string) (barcode.Barcode, error) { return code128.Encode(value) },
+		quietColumns: 10, rasterRows: 1, moduleWidth: 1.5, moduleHeight: 64,
+	},
+	"ean13": {
+		encode:       encodeEAN13,
+		quietColumns: 11, rasterRows: 1, moduleWidth: 1.5, moduleHeight: 64,
+	},
+	"qr": {
+		encode: encodeQR, levels: true,
+		quietColumns: 4, quietRows: 4, rasterRows: 1, moduleWidth: 2, moduleHeight: 2,
+	},
+	"datamatrix": {
+		encode:       func(value, _ string) (barcode.Barcode, error) { return datamatrix.Encode(value) },
+		quietColumns: 1, quietRows: 1, rasterRows: 1, moduleWidth: 2, moduleHeight: 2,
+	},
+	"pdf417": {
+		encode: encodePDF417, levels: true,
+		quietColumns: 2, quietRows: 1, rasterRows: 2, moduleWidth: 1.5, moduleHeight: 4.5,
+	},
+}
+
+// Encode encodes a value as a barcode of the given type. level is the error
+// correction level of QR codes (L, M, Q or H) and PDF417 (0 to 8); empty
+// selects the default. The other types have fixed error correction.
+func Encode(kind, value, level string) (*domain.Barcode, error) {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	sym, ok := symbologies[kind]
+	if !ok {
+		return nil, fmt.Errorf("unsupported barcode type %q", kind)
+	}
+	if value == "" {
+		return nil, fmt.Errorf("%s barcode has no value", kind)
+	}
+	level = strings.TrimSpace(level)
+	if level != "" && !sym.levels {
+		return nil, fmt.Errorf("%s barcodes have no error correction level", kind)
+	}
+
+	code, err := sym.encode(value, level)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode %s barcode: %w", kind, err)
+	}
+
+	// Copy the modules into a grid surrounded by the quiet zone
+	bounds := code.Bounds()
+	rows := bounds.Dy() / sym.rasterRows
+	result := &domain.Barcode{
+		Type:         kind,
+		Value:        code.Content(),
+		Columns:      bounds.Dx() + 2*sym.quietColumns,
+		Rows:         rows + 2*sym.quietRows,
+		ModuleWidth:  sym.moduleWidth,
+		ModuleHeight: sym.moduleHeight,
+	}
+	result.Dark = make([]bool, result.Columns*result.Rows)
+	for row := 0; row < rows; row++ {
+		for column := 0; column < bounds.Dx(); column++ {
+			c := color.GrayModel.Convert(code.At(bounds.Min.X+column, bounds.Min.Y+row*sym.rasterRows)).(color.Gray)
+			if c.Y < 128 {
+				result.Dark[(row+sym.quietRows)*result.Columns+column+sym.quietColumns] = true
+			}
+		}
+	}
+	return result, nil
+}
+
+// encodeEAN13 encodes 12 digits, adding the check digit, or 13 digits with
+// a check digit that must match
+func encodeEAN13(value, _ string) (barcode.Barcode, error) {
+	if len(value) != 12 && len(value) != 13 {
+		return nil, fmt.Errorf("EAN-13 needs 12 or 13 digits, got %d characters", len(value))
+	}
+	for _, ch := range value {
+		if ch < '0' || ch > '9' {
+			return nil, fmt.Errorf("EAN-13 takes digits only, got %q", ch)
+		}
+	}
+	return ean.Encode(value)
+}
+
+// encodeQR encodes a QR code in the smallest mode that holds the value
+func encodeQR(value, level string) (barcode.Barcode, error) {
+	levels := map[string]qr.ErrorCorrectionLevel{"L": qr.L, "M": qr.M, "Q": qr.Q, "H": qr.H}
+	if level == "" {
+		level = defaultQRLevel
+	}
+	ecl, ok := levels[strings.ToUpper(level)]
+	if !ok {
+		return nil, fmt.Errorf("QR error correction level must be L, M, Q or H, got %q", level)
+	}
+	return qr.Encode(value, ecl, qr.Auto)
+}
+
+// encodePDF417 encodes a PDF417 symbol at a security level from 0 to 8
+func encodePDF417(value, level string) (barcode.Barcode, error) {
+	if level == "" {
+		level = defaultPDF417Level
+	}
+	security, err := strconv.Atoi(level)
+	if err != nil || security < 0 || security > 8 {
+		return nil, fmt.Errorf("PDF417 error correction level must be 0 to 8, got %q", level)
+	}
+	return pdf417.Encode(value, byte(security))
+}
@@ -0,0 +1,160 @@
+package barcode
+
+import (
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+// dark reports whether the module at a column and row is dark
+func dark(code *domain.Barcode, column, row int) bool {
+	return code.Dark[row*code.Columns+column]
+}
+
+// row returns a row of modules as 1 for dark and 0 for light
+func row(code *domain.Barcode, r, from, to int) string {
+	var b strings.Builder
+	for column := from; column < to; column++ {
+		if dark(code, column, r) {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	return b.String()
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name          string
+		kind, value   string
+		level         string
+		wantValue     string
+		columns, rows int
+		check         func(t *testing.T, code *domain.Barcode)
+	}{
+		{"Code 128", "code128", "ABC-123", "", "ABC-123", 0, 1, func(t *testing.T, code *domain.Barcode) {
+			// Start code B, then the stop pattern with its final bar
+			if got := row(code, 0, 10, 21); got != "11010010000" {
+				t.Errorf("start pattern = %s, want 11010010000", got)
+			}
+			if got := row(code, 0, code.Columns-23, code.Columns-10); got != "1100011101011" {
+				t.Errorf("stop pattern = %s, want 1100011101011", got)
+			}
+		}},
+		{"EAN-13 check digit added", "ean13", "590123412345", "", "5901234123457", 95 + 22, 1, func(t *testing.T, code *domain.Barcode) {
+			// Start, centre and end guards
+			if got := row(code, 0, 11, 14); got != "101" {
+				t.Errorf("start guard = %s, want 101", got)
+			}
+			if got := row(code, 0, 11+45, 11+50); got != "01010" {
+				t.Errorf("centre guard = %s, want 01010", got)
+			}
+			if got := row(code, 0, 11+92, 11+95); got != "101" {
+				t.Errorf("end guard = %s, want 101", got)
+			}
+		}},
+		{"EAN-13 with check digit", "ean13", "5901234123457", "", "5901234123457", 95 + 22, 1, nil},
+		{"QR code", "qr", "https://example.com", "", "https://example.com", 25 + 8, 25 + 8, func(t *testing.T, code *domain.Barcode) {
+			// Finder pattern in the top-left corner, inside the quiet zone
+			for r, want := range []string{"1111111", "1000001", "1011101", "1011101", "1011101", "1000001", "1111111"} {
+				if got := row(code, 4+r, 4, 11); got != want {
+					t.Errorf("finder pattern row %d = %s, want %s", r, got, want)
+				}
+			}
+		}},
+		{"QR code level H", "qr", "https://example.com", "H", "https://example.com", 29 + 8, 29 + 8, nil},
+		{"DataMatrix", "datamatrix", "Hello", "", "Hello", 12 + 2, 12 + 2, func(t *testing.T, code *domain.Barcode) {
+			// Solid finder along the left and bottom edges, alternating timing
+			// pattern along the top
+			inner := code.Columns - 2
+			if got := row(code, code.Rows-2, 1, 1+inner); got != strings.Repeat("1", inner) {
+				t.Errorf("bottom edge = %s, want solid", got)
+			}
+			if got := row(code, 1, 1, 1+inner); got != strings.Repeat("10", inner/2) {
+				t.Errorf("top edge = %s, want alternating", got)
+			}
+			for r := 1; r < code.Rows-1; r++ {
+				if !dark(code, 1, r) {
+					t.Errorf("left edge row %d is light, want solid", r)
+				}
+			}
+		}},
+		{"PDF417", "pdf417", "PDF417 example", "", "PDF417 example", 0, 0, func(t *testing.T, code *domain.Barcode) {
+			// Every row starts with the start pattern and ends with the stop pattern
+			for r := code.Rows - 2; r >= 1; r-- {
+				if got := row(code, r, 2, 19); got != "11111111010101000" {
+					t.Errorf("row %d start pattern = %s, want 11111111010101000", r, got)
+				}
+				if got := row(code, r, code.Columns-20, code.Columns-2); got != "111111101000101001" {
+					t.Errorf("row %d stop pattern = %s, want 111111101000101001", r, got)
+				}
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Encode(tt.kind, tt.value, tt.level)
+			if err != nil {
+				t.Fatalf("Encode(%q, %q) error = %v", tt.kind, tt.value, err)
+			}
+			if code.Type != tt.kind || code.Value != tt.wantValue {
+				t.Errorf("Encode(%q, %q) = %s %q, want %s %q", tt.kind, tt.value, code.Type, code.Value, tt.kind, tt.wantValue)
+			}
+			if (tt.columns != 0 && code.Columns != tt.columns) || (tt.rows != 0 && code.Rows != tt.rows) {
+				t.Errorf("Encode(%q, %q) is %dx%d modules, want %dx%d", tt.kind, tt.value, code.Columns, code.Rows, tt.columns, tt.rows)
+			}
+			if len(code.Dark) != code.Columns*code.Rows {
+				t.Fatalf("Encode(%q, %q) has %d modules, want %d", tt.kind, tt.value, len(code.Dark), code.Columns*code.Rows)
+			}
+			if tt.check != nil {
+				tt.check(t, code)
+			}
+		})
+	}
+}
+
+func TestEncodeQuietZone(t *testing.T) {
+	for kind, sym := range symbologies {
+		value := "123456789012"
+		code, err := Encode(kind, value, "")
+		if err != nil {
+			t.Fatalf("Encode(%q, %q) error = %v", kind, value, err)
+		}
+		for r := 0; r < code.Rows; r++ {
+			for column := 0; column < code.Columns; column++ {
+				inside := column >= sym.quietColumns && column < code.Columns-sym.quietColumns &&
+					r >= sym.quietRows && r < code.Rows-sym.quietRows
+				if !inside && dark(code, column, r) {
+					t.Errorf("%s module %d,%d in the quiet zone is dark", kind, column, r)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	tests := []struct {
+		name               string
+		kind, value, level string
+	}{
+		{"unsupported type", "upc", "123456789012", ""},
+		{"no type", "", "123", ""},
+		{"no value", "code128", "", ""},
+		{"Code 128 outside Latin-1", "code128", "→", ""},
+		{"EAN-13 letters", "ean13", "59012341234A", ""},
+		{"EAN-13 length", "ean13", "12345", ""},
+		{"EAN-13 check digit", "ean13", "5901234123458", ""},
+		{"QR level", "qr", "hello", "X"},
+		{"PDF417 level", "pdf417", "hello", "9"},
+		{"level of a linear code", "code128", "hello", "H"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, err := Encode(tt.kind, tt.value, tt.level); err == nil {
+				t.Errorf("Encode(%q, %q, %q) = %s %q, want an error", tt.kind, tt.value, tt.level, code.Type, code.Value)
+			}
+		})
+	}
+}
@@ -28,6 +28,12 @@ func (p *Parser) Parse(content string) (*Stylesheet, error) {
 	// Remove comments
 	content = p.removeComments(content)
 
+	// @page rules nest margin boxes, which the rule pattern cannot match
+	content, pageRules, err := p.extractPageRules(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse @page rules: %w", err)
+	}
+
 	// Parse rules
 	rules, err := p.parseRules(content)
 	if err != nil {
@@ -35,10 +41,105 @@ func (p *Parser) Parse(content string) (*Stylesheet, error) {
 	}
 
 	return &Stylesheet{
-		Rules: rules,
+		Rules:     rules,
+		PageRules: pageRules,
 	}, nil
 }
 
+// pageRulePattern matches the start of an @page rule
+var pageRulePattern = regexp.MustCompile(`(?i)@page\b`)
+
+// marginBoxPattern matches the start of a margin box inside an @page rule
+var marginBoxPattern = regexp.MustCompile(`@([a-zA-Z-]+)\s*\{`)
+
+// extractPageRules parses the @page rules of content and returns the
+// content without them
+func (p *Parser) extractPageRules(content string) (string, []*PageRule, error) {
+	var rules []*PageRule
+	var rest strings.Builder
+	for {
+		loc := pageRulePattern.FindStringIndex(content)
+		if loc == nil {
+			break
+		}
+		open := strings.IndexByte(content[loc[1]:], '{')
+		if open < 0 {
+			break
+		}
+		open += loc[1]
+		end := matchingBrace(content, open)
+
+		rule, err := p.parsePageRule(content[loc[1]:open], content[open+1:end])
+		if err != nil {
+			return "", nil, err
+		}
+		rules = append(rules, rule)
+		rest.WriteString(content[:loc[0]])
+		content = content[min(end+1, len(content)):]
+	}
+	rest.WriteString(content)
+	return rest.String(), rules, nil
+}
+
+// parsePageRule parses the selector and body of an @page rule
+func (p *Parser) parsePageRule(selectorText, body string) (*PageRule, error) {
+	rule := &PageRule{Selector: strings.TrimSpace(selectorText)}
+
+	// Margin boxes are taken out; what remains are the page's own declarations
+	var declarationsText strings.Builder
+	for {
+		loc := marginBoxPattern.FindStringSubmatchIndex(body)
+		if loc == nil {
+			break
+		}
+		end := matchingBrace(body, loc[1]-1)
+		declarations, err := p.parseDeclarations(body[loc[1]:end])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse @%s declarations: %w", body[loc[2]:loc[3]], err)
+		}
+		rule.MarginBoxes = append(rule.MarginBoxes, &MarginBox{
+			Name:         strings.ToLower(body[loc[2]:loc[3]]),
+			Declarations: declarations,
+		})
+		declarationsText.WriteString(body[:loc[0]])
+		body = body[min(end+1, len(body)):]
+	}
+	declarationsText.WriteString(body)
+
+	declarations, err := p.parseDeclarations(declarationsText.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse @page declarations: %w", err)
+	}
+	rule.Declarations = declarations
+	return rule, nil
+}
+
+// matchingBrace returns the index of the brace closing the one at open, or
+// the length of content when it is never closed. Braces in strings are skipped.
+func matchingBrace(content string, open int) int {
+	depth, quote := 0, byte(0)
+	for i := open; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(content)
+}
+
 // parseRules parses CSS rules from content
 func (p *Parser) parseRules(content string) ([]*Rule, error) {
 	var rules []*Rule
@@ -108,6 +209,10 @@ func (p *Parser) parseSelectors(selectorText string) ([]*Selector, error) {
 	return selectors, nil
 }
 
+// pseudoElementPattern matches a ::before or ::after pseudo-element ending a
+// selector, also in the single colon syntax of CSS 2
+var pseudoElementPattern = regexp.MustCompile(`(?i)::?(before|after)$`)
+
 // parseSelector parses a single CSS selector
 func (p *Parser) parseSelector(selectorText string) (*Selector, error) {
 	selector := &Selector{
@@ -115,8 +220,17 @@ func (p *Parser) parseSelector(selectorText string) (*Selector, error) {
 		Specificity: p.calculateSpecificity(selectorText),
 	}
 
+	// The pseudo-element selects generated content of the elements the rest matches
+	compound := selectorText
+	if match := pseudoElementPattern.FindStringSubmatchIndex(selectorText); match != nil {
+		selector.PseudoElement = strings.ToLower(selectorText[match[2]:match[3]])
+		if compound = strings.TrimSpace(selectorText[:match[0]]); compound == "" || strings.HasSuffix(selectorText[:match[0]], " ") {
+			compound = strings.TrimSpace(compound + " *")
+		}
+	}
+
 	// Parse selector components
-	components, err := p.parseSelectorComponents(selectorText)
+	components, err := p.parseSelectorComponents(compound)
 	if err != nil {
 		return nil, err
 	}
@@ -167,8 +281,8 @@ func (p *Parser) parseSelectorComponents(selectorText string) ([]*SelectorCompon
 func (p *Parser) parseDeclarations(declarationsText string) ([]*Declaration, error) {
 	var declarations []*Declaration
 
-	// Split by semicolons
-	declarationParts := strings.Split(declarationsText, ";")
+	// Split by semicolons outside of functions and strings
+	declarationParts := SplitOutside(declarationsText, ';')
 
 	for _, part := range declarationParts {
 		part = strings.TrimSpace(part)
@@ -262,7 +376,21 @@ func (p *Parser) removeComments(content string) string {
 
 // Stylesheet represents a CSS stylesheet
 type Stylesheet struct {
-	Rules []*Rule `json:"rules"`
+	Rules     []*Rule     `json:"rules"`
+	PageRules []*PageRule `json:"page_rules,omitempty"` // @page rules, in style sheet order
+}
+
+// PageRule represents an @page rule
+type PageRule struct {
+	Selector     string         `json:"selector"`     // Page selector such as :first, empty for every page
+	Declarations []*Declaration `json:"declarations"` // Properties of the page itself
+	MarginBoxes  []*MarginBox   `json:"margin_boxes"` // Margin boxes such as @top-center
+}
+
+// MarginBox represents a margin box rule nested in an @page rule
+type MarginBox struct {
+	Name         string         `json:"name"` // Margin box name without the @, such as top-center
+	Declarations []*Declaration `json:"declarations"`
 }
 
 // Rule represents a CSS rule
@@ -273,9 +401,10 @@ type Rule struct {
 
 // Selector represents a CSS selector
 type Selector struct {
-	Text        string               `json:"text"`
-	Specificity int                  `json:"specificity"`
-	Components  []*SelectorComponent `json:"components"`
+	Text          string               `json:"text"`
+	Specificity   int                  `json:"specificity"`
+	Components    []*SelectorComponent `json:"components"`
+	PseudoElement string               `json:"pseudo_element,omitempty"` // before or after, empty when the selector matches elements
 }
 
 // SelectorComponent represents a component of a CSS selector
@@ -326,6 +455,63 @@ func (r *Rule) AddDeclaration(property, value string, important bool) {
 	})
 }
 
+// SplitOutside splits a CSS value at every sep that is not inside
+// parentheses or quotes, such as the semicolon of a url(data:...) value
+func SplitOutside(value string, sep rune) []string {
+	var parts []string
+	depth, quote, start := 0, rune(0), 0
+	for i, r := range value {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case r == sep && depth == 0:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// urlPattern matches a url() function and its optionally quoted argument
+var urlPattern = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^"')\s]*))\s*\)`)
+
+// ParseURL returns the address of a url() value
+func ParseURL(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	matches := urlPattern.FindStringSubmatchIndex(value)
+	if matches == nil || matches[0] != 0 || matches[1] != len(value) {
+		return "", false
+	}
+	return urlArgument(value, matches), true
+}
+
+// FindURLs returns the addresses of every url() in a value
+func FindURLs(value string) []string {
+	var urls []string
+	for _, matches := range urlPattern.FindAllStringSubmatchIndex(value, -1) {
+		urls = append(urls, urlArgument(value, matches))
+	}
+	return urls
+}
+
+// urlArgument returns the address matched by urlPattern, whichever way it was quoted
+func urlArgument(value string, matches []int) string {
+	for group := 1; group <= 3; group++ {
+		if start := matches[2*group]; start >= 0 {
+			return value[start:matches[2*group+1]]
+		}
+	}
+	return ""
+}
+
 // ParseValue parses a CSS value into appropriate type
 func ParseValue(value string) interface{} {
 	value = strings.TrimSpace(value)
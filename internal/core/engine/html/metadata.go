@@ -0,0 +1,47 @@
+package html
+
+import (
+	"strings"
+
+	"print-service/internal/core/domain"
+)
+
+// ExtractMetadata reads the document properties declared in the head of an
+// HTML document: the title element and the author, description and keywords
+// meta tags
+func ExtractMetadata(root *DOMNode) domain.DocumentMetadata {
+	var metadata domain.DocumentMetadata
+	if root == nil {
+		return metadata
+	}
+
+	if titles := root.GetElementsByTagName("title"); len(titles) > 0 {
+		metadata.Title = collapseSpace(titles[0].TextContent())
+	}
+
+	for _, meta := range root.GetElementsByTagName("meta") {
+		content := collapseSpace(meta.Attributes["content"])
+		if content == "" {
+			continue
+		}
+		switch strings.ToLower(meta.Attributes["name"]) {
+		case "author":
+			metadata.Author = content
+		case "description":
+			metadata.Subject = content
+		case "keywords":
+			for _, keyword := range strings.Split(content, ",") {
+				if keyword = strings.TrimSpace(keyword); keyword != "" {
+					metadata.Keywords = append(metadata.Keywords, keyword)
+				}
+			}
+		}
+	}
+
+	return metadata
+}
+
+// collapseSpace trims text and collapses runs of white space to single spaces
+func collapseSpace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
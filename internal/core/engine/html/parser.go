@@ -67,6 +67,9 @@ func (p *Parser) ParseFragment(content string, context *html.Node) ([]*DOMNode,
 	return domNodes, nil
 }
 
+// emptyCustomElements are the elements of the service that have no content
+var emptyCustomElements = map[string]bool{"barcode": true, "toc": true}
+
 // convertNode converts an html.Node to our DOMNode structure
 func (p *Parser) convertNode(node *html.Node) *DOMNode {
 	domNode := &DOMNode{
@@ -86,6 +89,16 @@ func (p *Parser) convertNode(node *html.Node) *DOMNode {
 		childNode := p.convertNode(child)
 		childNode.Parent = domNode
 		domNode.Children = append(domNode.Children, childNode)
+
+		// HTML has no self-closing custom elements, so content after
+		// <barcode/> or <toc/> is parsed into it. It belongs after the element.
+		if childNode.Type == ElementNode && emptyCustomElements[strings.ToLower(childNode.Data)] {
+			for _, content := range childNode.Children {
+				content.Parent = domNode
+				domNode.Children = append(domNode.Children, content)
+			}
+			childNode.Children = nil
+		}
 	}
 
 	return domNode
@@ -180,6 +193,18 @@ func (n *DOMNode) GetElementByID(id string) *DOMNode {
 	return result
 }
 
+// TextContent returns the concatenated text of the node and its descendants
+func (n *DOMNode) TextContent() string {
+	var builder strings.Builder
+	n.walkElements(func(node *DOMNode) bool {
+		if node.Type == TextNode {
+			builder.WriteString(node.Data)
+		}
+		return true
+	})
+	return builder.String()
+}
+
 // walkElements walks through all descendant elements
 func (n *DOMNode) walkElements(fn func(*DOMNode) bool) {
 	if !fn(n) {
@@ -240,6 +265,13 @@ func (n *DOMNode) Render(w io.Writer) error {
 		// Closing tag
 		fmt.Fprintf(w, "</%s>", n.Data)
 		return nil
+	case DocumentNode:
+		for _, child := range n.Children {
+			if err := child.Render(w); err != nil {
+				return err
+			}
+		}
+		return nil
 	case CommentNode:
 		fmt.Fprintf(w, "<!-- %s -->", n.Data)
 		return nil
@@ -78,11 +78,11 @@ func (s *Sanitizer) sanitizeNode(node *DOMNode, options domain.SecurityOptions)
 			Attributes: make(map[string]string),
 		}
 
-		// Sanitize attributes
+		// Sanitize attributes. Boolean attributes have no value and are kept.
 		for key, value := range node.Attributes {
 			if s.isAttributeAllowed(node.Data, key) {
 				sanitizedValue, err := s.sanitizeAttributeValue(key, value, options)
-				if err == nil && sanitizedValue != "" {
+				if err == nil && (sanitizedValue != "" || value == "") {
 					sanitizedNode.Attributes[strings.ToLower(key)] = sanitizedValue
 				}
 			}
@@ -177,7 +177,7 @@ func (s *Sanitizer) sanitizeURL(urlStr string, options domain.SecurityOptions) (
 
 	// Check domain restrictions
 	if parsedURL.Host != "" {
-		if err := s.urlValidator.ValidateDomain(parsedURL.Host, options); err != nil {
+		if err := s.urlValidator.ValidateDomain(parsedURL.Hostname(), options); err != nil {
 			return "", err
 		}
 	}
@@ -185,20 +185,19 @@ func (s *Sanitizer) sanitizeURL(urlStr string, options domain.SecurityOptions) (
 	return urlStr, nil
 }
 
-// sanitizeStyle sanitizes CSS style attributes
-func (s *Sanitizer) sanitizeStyle(style string) string {
-	// Remove potentially dangerous CSS
-	dangerous := []string{
-		"expression", "javascript:", "vbscript:", "data:",
-		"@import", "behavior", "-moz-binding",
-	}
+// dangerousStylePattern finds CSS that can run script or load arbitrary
+// content. data: URIs are matched with their media type so images can stay.
+var dangerousStylePattern = regexp.MustCompile(`(?i)expression|javascript:|vbscript:|data:(?:image/)?|@import|behavior|-moz-binding`)
 
-	style = strings.ToLower(style)
-	for _, danger := range dangerous {
-		style = strings.ReplaceAll(style, danger, "")
-	}
-
-	return style
+// sanitizeStyle sanitizes CSS style attributes. Case is kept, as the
+// base64 payload of a data:image/ background is case-sensitive.
+func (s *Sanitizer) sanitizeStyle(style string) string {
+	return dangerousStylePattern.ReplaceAllStringFunc(style, func(match string) string {
+		if strings.EqualFold(match, "data:image/") {
+			return match
+		}
+		return ""
+	})
 }
 
 // sanitizeIdentifier sanitizes class and ID attributes
@@ -242,7 +241,7 @@ func getDefaultAllowedTags() map[string]bool {
 
 		// Sections
 		"header": true, "nav": true, "main": true, "section": true,
-		"article": true, "aside": true, "footer": true,
+		"article": true, "aside": true, "footer": true, "toc": true,
 		"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
 
 		// Grouping content
@@ -258,18 +257,46 @@ func getDefaultAllowedTags() map[string]bool {
 		"span": true, "br": true, "wbr": true,
 
 		// Embedded content
-		"img": true, "picture": true, "source": true,
+		"img": true, "picture": true, "source": true, "barcode": true,
+
+		// SVG artwork
+		"svg": true, "g": true, "defs": true, "symbol": true, "use": true,
+		"path": true, "rect": true, "circle": true, "ellipse": true, "line": true,
+		"polyline": true, "polygon": true, "text": true, "tspan": true,
+		"lineargradient": true, "radialgradient": true, "stop": true,
 
 		// Tabular data
 		"table": true, "caption": true, "colgroup": true, "col": true,
 		"tbody": true, "thead": true, "tfoot": true, "tr": true,
 		"td": true, "th": true,
+
+		// Forms
+		"form": true, "fieldset": true, "legend": true, "label": true,
+		"input": true, "select": true, "option": true, "textarea": true,
 	}
 }
 
+// svgTags are the SVG elements whose geometry and presentation attributes are kept
+var svgTags = []string{
+	"svg", "g", "defs", "symbol", "use", "path", "rect", "circle", "ellipse", "line",
+	"polyline", "polygon", "text", "tspan", "lineargradient", "radialgradient", "stop",
+}
+
+// svgAttributes are the geometry and presentation attributes of SVG elements
+var svgAttributes = []string{
+	"viewbox", "preserveaspectratio", "width", "height", "x", "y", "dx", "dy",
+	"x1", "y1", "x2", "y2", "cx", "cy", "r", "rx", "ry", "fx", "fy", "d", "points",
+	"transform", "href", "offset", "gradientunits", "gradienttransform",
+	"fill", "fill-opacity", "fill-rule", "stroke", "stroke-width", "stroke-opacity",
+	"stroke-linecap", "stroke-linejoin", "stroke-miterlimit", "stroke-dasharray",
+	"stroke-dashoffset", "opacity", "color", "display", "visibility",
+	"stop-color", "stop-opacity", "font-family", "font-size", "font-weight",
+	"font-style", "text-anchor", "role", "aria-label", "aria-hidden",
+}
+
 // getDefaultAllowedAttributes returns the default set of allowed attributes
 func getDefaultAllowedAttributes() map[string]map[string]bool {
-	return map[string]map[string]bool{
+	attributes := map[string]map[string]bool{
 		"*": {
 			"class": true, "id": true, "style": true, "title": true,
 			"lang": true, "dir": true, "data-*": true,
@@ -277,10 +304,20 @@ func getDefaultAllowedAttributes() map[string]map[string]bool {
 		"a": {
 			"href": true, "target": true, "rel": true,
 		},
+		"meta": {
+			"name": true, "content": true, "charset": true,
+		},
 		"img": {
 			"src": true, "alt": true, "width": true, "height": true,
 			"loading": true, "decoding": true,
 		},
+		"barcode": {
+			"type": true, "value": true, "ecc": true, "text": true,
+			"alt": true, "width": true, "height": true,
+		},
+		"toc": {
+			"depth": true,
+		},
 		"table": {
 			"border": true, "cellpadding": true, "cellspacing": true,
 		},
@@ -296,7 +333,36 @@ func getDefaultAllowedAttributes() map[string]map[string]bool {
 		"li": {
 			"value": true,
 		},
+		"label": {
+			"for": true,
+		},
+		"input": {
+			"type": true, "name": true, "value": true, "checked": true,
+			"placeholder": true, "maxlength": true, "size": true,
+			"readonly": true, "disabled": true, "required": true,
+		},
+		"select": {
+			"name": true, "multiple": true, "size": true,
+			"disabled": true, "required": true,
+		},
+		"option": {
+			"value": true, "label": true, "selected": true, "disabled": true,
+		},
+		"textarea": {
+			"name": true, "rows": true, "cols": true, "placeholder": true, "maxlength": true,
+			"readonly": true, "disabled": true, "required": true,
+		},
 	}
+
+	for _, tag := range svgTags {
+		if attributes[tag] == nil {
+			attributes[tag] = make(map[string]bool)
+		}
+		for _, attr := range svgAttributes {
+			attributes[tag][attr] = true
+		}
+	}
+	return attributes
 }
 
 // URLValidator validates URLs against security policies
@@ -307,13 +373,14 @@ func NewURLValidator() *URLValidator {
 	return &URLValidator{}
 }
 
-// ValidateDomain validates a domain against security options
+// ValidateDomain validates a host name against security options. A listed
+// domain covers the host of that name and its subdomains.
 func (v *URLValidator) ValidateDomain(domain string, options domain.SecurityOptions) error {
-	domain = strings.ToLower(domain)
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
 
 	// Check blocked domains
 	for _, blocked := range options.BlockedDomains {
-		if strings.Contains(domain, strings.ToLower(blocked)) {
+		if domainMatches(domain, blocked) {
 			return fmt.Errorf("domain %s is blocked", domain)
 		}
 	}
@@ -322,7 +389,7 @@ func (v *URLValidator) ValidateDomain(domain string, options domain.SecurityOpti
 	if len(options.AllowedDomains) > 0 {
 		allowed := false
 		for _, allowedDomain := range options.AllowedDomains {
-			if strings.Contains(domain, strings.ToLower(allowedDomain)) {
+			if domainMatches(domain, allowedDomain) {
 				allowed = true
 				break
 			}
@@ -335,6 +402,17 @@ func (v *URLValidator) ValidateDomain(domain string, options domain.SecurityOpti
 	return nil
 }
 
+// domainMatches reports whether a lower-case host is a listed domain or one
+// of its subdomains. A leading "." or "*." on the listed domain is ignored.
+func domainMatches(host, listed string) bool {
+	listed = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(listed)), ".")
+	listed = strings.TrimPrefix(strings.TrimPrefix(listed, "*"), ".")
+	if listed == "" {
+		return false
+	}
+	return host == listed || strings.HasSuffix(host, "."+listed)
+}
+
 // parseHTMLForSanitization parses HTML for sanitization without validation to avoid circular dependency
 func (s *Sanitizer) parseHTMLForSanitization(content string) (*DOMNode, error) {
 	// Use golang.org/x/net/html to parse HTML directly without validation
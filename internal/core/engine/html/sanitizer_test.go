@@ -0,0 +1,51 @@
+package html
+
+import (
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+func TestValidateDomain(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		allowed []string
+		blocked []string
+		wantErr bool
+	}{
+		{"no lists", "example.com", nil, nil, false},
+		{"allowed host", "example.com", []string{"example.com"}, nil, false},
+		{"allowed subdomain", "cdn.example.com", []string{"example.com"}, nil, false},
+		{"allowed wildcard", "cdn.example.com", []string{"*.example.com"}, nil, false},
+		{"case and trailing dot", "CDN.Example.COM.", []string{"example.com"}, nil, false},
+		{"allowed name as prefix", "example.com.attacker.net", []string{"example.com"}, nil, true},
+		{"allowed name as suffix", "notexample.com", []string{"example.com"}, nil, true},
+		{"allowed name inside", "myexample.com.net", []string{"example.com"}, nil, true},
+		{"empty allowed entry", "example.com", []string{""}, nil, true},
+		{"blocked host", "evil.net", nil, []string{"evil.net"}, true},
+		{"blocked subdomain", "cdn.evil.net", nil, []string{"evil.net"}, true},
+		{"blocked name as prefix", "evil.net.example.com", []string{"example.com"}, []string{"evil.net"}, false},
+		{"blocked subdomain of allowed", "ads.example.com", []string{"example.com"}, []string{"ads.example.com"}, true},
+	}
+	validator := NewURLValidator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := domain.SecurityOptions{AllowedDomains: tt.allowed, BlockedDomains: tt.blocked}
+			err := validator.ValidateDomain(tt.host, options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateDomain(%q) error = %v, wantErr %v", tt.host, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSanitizeURLIgnoresPort(t *testing.T) {
+	options := domain.SecurityOptions{AllowedDomains: []string{"example.com"}}
+	if _, err := NewSanitizer().sanitizeURL("https://example.com:8443/logo.png", options); err != nil {
+		t.Errorf("sanitizeURL() error = %v, want the port ignored", err)
+	}
+	if _, err := NewSanitizer().sanitizeURL("https://example.com.attacker.net/logo.png", options); err == nil {
+		t.Error("sanitizeURL() accepted a host that only starts with an allowed domain")
+	}
+}
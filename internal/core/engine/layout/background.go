@@ -0,0 +1,90 @@
+package layout
+
+import (
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/css"
+)
+
+// backgroundRepeats are the values of background-repeat
+var backgroundRepeats = map[string]bool{
+	"repeat": true, "repeat-x": true, "repeat-y": true, "no-repeat": true,
+}
+
+// backgroundPositions are the keywords of background-position
+var backgroundPositions = map[string]bool{
+	"left": true, "center": true, "right": true, "top": true, "bottom": true,
+}
+
+// backgroundSizes are the keywords of background-size
+var backgroundSizes = map[string]bool{"auto": true, "cover": true, "contain": true}
+
+// parseBackground parses the background shorthand, such as
+// "#fff url(paper.png) no-repeat center / cover". Properties the value
+// leaves out are reset to their initial values.
+func parseBackground(value string) domain.Background {
+	var bg domain.Background
+	var position, size []string
+	inSize := false
+
+	for _, token := range backgroundTokens(value) {
+		lower := strings.ToLower(token)
+		switch {
+		case token == "/":
+			inSize = true
+		case lower == "none":
+			bg.Image = ""
+		case backgroundRepeats[lower]:
+			bg.Repeat = lower
+		case inSize && (backgroundSizes[lower] || isLength(lower)):
+			size = append(size, lower)
+		case backgroundPositions[lower] || isLength(lower):
+			position = append(position, lower)
+		default:
+			if url, ok := css.ParseURL(token); ok {
+				bg.Image = url
+			} else if c := parseColorValue(token); c != nil {
+				bg.Color = *c
+			}
+		}
+	}
+
+	bg.Position = strings.Join(position, " ")
+	bg.Size = strings.Join(size, " ")
+	return bg
+}
+
+// parseBackgroundImage parses background-image, returning "" for none
+func parseBackgroundImage(value string) string {
+	url, _ := css.ParseURL(value)
+	return url
+}
+
+// backgroundTokens splits a background value into its words, keeping
+// functions whole and the slash before the size a token of its own
+func backgroundTokens(value string) []string {
+	value = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(value)
+	var tokens []string
+	for _, word := range css.SplitOutside(value, ' ') {
+		for i, part := range css.SplitOutside(word, '/') {
+			if i > 0 {
+				tokens = append(tokens, "/")
+			}
+			if part != "" {
+				tokens = append(tokens, part)
+			}
+		}
+	}
+	return tokens
+}
+
+// isLength reports whether a value is a CSS length or percentage
+func isLength(value string) bool {
+	if number, ok := strings.CutSuffix(value, "%"); ok {
+		_, err := strconv.ParseFloat(number, 64)
+		return err == nil
+	}
+	return value == "0" || parseSize(value) != 0
+}
@@ -0,0 +1,83 @@
+package layout
+
+import (
+	"fmt"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/barcode"
+)
+
+// IsBarcode reports whether a node is a barcode element, drawn as the symbol
+// encoding its value attribute
+func IsBarcode(node *domain.LayoutNode) bool {
+	return node != nil && node.Tag == "barcode"
+}
+
+// encodeBarcode encodes the symbol of a barcode element from its type, value
+// and ecc attributes
+func encodeBarcode(node *domain.LayoutNode) (*domain.Barcode, error) {
+	attributes := node.Attributes
+	code, err := barcode.Encode(attributes["type"], attributes["value"], attributes["ecc"])
+	if err != nil {
+		return nil, fmt.Errorf("barcode %q not drawn: %w", attributes["value"], err)
+	}
+	return code, nil
+}
+
+// barcodeCaption returns the human-readable line printed below a barcode
+// with a text attribute: the attribute's value, or else the encoded value,
+// or the value attribute when it could not be encoded. It returns nil for
+// barcodes without one.
+func barcodeCaption(node *domain.LayoutNode) *domain.LayoutNode {
+	text, ok := node.Attributes["text"]
+	if !ok {
+		return nil
+	}
+	if text == "" {
+		text = node.Attributes["value"]
+		if node.Barcode != nil {
+			text = node.Barcode.Value
+		}
+	}
+
+	style := getDefaultComputedStyle()
+	style.Font = node.Style.Font
+	style.Text = node.Style.Text
+	style.Text.Align = domain.TextAlignCenter
+	style.Color = node.Style.Color
+	return &domain.LayoutNode{
+		ID:      node.ID + "_caption",
+		Type:    "text",
+		Style:   *style,
+		Content: text,
+		Parent:  node,
+	}
+}
+
+// layoutBarcodeCaption places the human-readable line of a barcode below
+// its symbol, growing the barcode by the height of the line
+func (e *Engine) layoutBarcodeCaption(node *domain.LayoutNode, ctx *LayoutContext) error {
+	symbol := ContentBox(node)
+	for _, caption := range node.Children {
+		if err := e.calculateLayout(caption, ctx); err != nil {
+			return fmt.Errorf("barcode caption layout failed: %w", err)
+		}
+		caption.Box.X = symbol.X
+		caption.Box.Y = symbol.Y + symbol.Height
+		node.Box.Height += caption.Box.Height
+	}
+	return nil
+}
+
+// SymbolBox returns the part of a barcode's content box its symbol is drawn
+// in, above the human-readable line
+func SymbolBox(node *domain.LayoutNode) domain.Box {
+	box := ContentBox(node)
+	for _, caption := range node.Children {
+		box.Height -= caption.Box.Height
+	}
+	if box.Height < 0 {
+		box.Height = 0
+	}
+	return box
+}
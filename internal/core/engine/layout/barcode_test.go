@@ -0,0 +1,93 @@
+package layout
+
+import (
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+func TestBarcodeLayout(t *testing.T) {
+	tests := []struct {
+		name  string
+		kind  string
+		value string
+	}{
+		{"Code 128", "code128", "ABC-123"},
+		{"EAN-13", "ean13", "5901234123457"},
+		{"QR code", "qr", "https://example.com"},
+		{"DataMatrix", "datamatrix", "Hello"},
+		{"PDF417", "pdf417", "PDF417 example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, warnings := layoutHTML(t, `<barcode type="`+tt.kind+`" value="`+tt.value+`" text=""></barcode>`)
+			node := findTag(root, "barcode")
+			if node == nil || node.Barcode == nil {
+				t.Fatalf("barcode not encoded, warnings %v", warnings)
+			}
+			if len(warnings) != 0 {
+				t.Errorf("CalculateLayout() warnings = %v, want none", warnings)
+			}
+
+			// The symbol is drawn at its intrinsic size above the caption
+			symbol := SymbolBox(node)
+			if want := float64(node.Barcode.Columns) * node.Barcode.ModuleWidth; !near(symbol.Width, want) {
+				t.Errorf("symbol width = %v, want %v", symbol.Width, want)
+			}
+			if want := float64(node.Barcode.Rows) * node.Barcode.ModuleHeight; !near(symbol.Height, want) {
+				t.Errorf("symbol height = %v, want %v", symbol.Height, want)
+			}
+			if len(node.Children) != 1 || node.Children[0].Content != tt.value {
+				t.Fatalf("caption = %v, want %q", node.Children, tt.value)
+			}
+			if caption := node.Children[0].Box; !near(caption.Y, symbol.Y+symbol.Height) || caption.Height <= 0 {
+				t.Errorf("caption box = %+v, want a line below the symbol ending at %v", caption, symbol.Y+symbol.Height)
+			}
+		})
+	}
+}
+
+func TestBarcodeLayoutInvalidValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		barcode string
+		caption string
+	}{
+		{"letters in EAN-13", `<barcode type="ean13" value="12345ABC" style="width: 200px; height: 80px"></barcode>`, ""},
+		{"unsupported type", `<barcode type="upc" value="123456789012" style="width: 200px; height: 80px"></barcode>`, ""},
+		{"no value", `<barcode type="qr" style="width: 200px; height: 80px"></barcode>`, ""},
+		{"caption of the value", `<barcode type="ean13" value="12345ABC" text="" style="width: 200px; height: 80px"></barcode>`, "12345ABC"},
+		{"caption text", `<barcode type="ean13" value="12345ABC" text="Order 12345" style="width: 200px; height: 80px"></barcode>`, "Order 12345"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, warnings := layoutHTML(t, `<p>Before</p>`+tt.barcode+`<p>After</p>`)
+			node := findTag(root, "barcode")
+			if node == nil {
+				t.Fatal("barcode element not laid out")
+			}
+			if node.Barcode != nil {
+				t.Errorf("Barcode = %q, want none", node.Barcode.Value)
+			}
+			if len(warnings) != 1 || !strings.Contains(warnings[0], "barcode") {
+				t.Errorf("CalculateLayout() warnings = %v, want one about the barcode", warnings)
+			}
+
+			// The box keeps its size so the rest of the page is unchanged
+			if box := ContentBox(node); box.Width != 200 || box.Height < 80 {
+				t.Errorf("content box = %+v, want 200x80 or more", box)
+			}
+			var caption string
+			if len(node.Children) > 0 {
+				caption = node.Children[0].Content
+			}
+			if caption != tt.caption {
+				t.Errorf("caption = %q, want %q", caption, tt.caption)
+			}
+			if findNode(root, func(n *domain.LayoutNode) bool { return n.Content == "After" }) == nil {
+				t.Error("content after the barcode is missing")
+			}
+		})
+	}
+}
@@ -0,0 +1,797 @@
+package layout
+
+import (
+	"slices"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"print-service/internal/core/domain"
+
+	"golang.org/x/text/unicode/bidi"
+)
+
+// ShapeLine prepares a laid out line for drawing from left to right.
+//
+// Arabic letters are replaced by their contextual forms and the line is
+// reordered following the Unicode Bidirectional Algorithm with the paragraph
+// direction of the element, mirroring brackets inside right-to-left runs.
+// Directional formatting characters are not drawn. Lines without
+// right-to-left text in a left-to-right paragraph are returned unchanged.
+func (te *TextEngine) ShapeLine(line string, direction domain.TextDirection) string {
+	rtl := direction == domain.DirectionRTL
+	if line == "" || (!rtl && !hasRightToLeft(line)) {
+		return line
+	}
+
+	return reorderLine(shapeArabic(line), rtl)
+}
+
+// TextRun is a directional run of a line: characters drawn at one embedding level
+type TextRun struct {
+	Text string // Characters in logical order, brackets mirrored in right-to-left runs
+	RTL  bool   // Drawn from right to left
+}
+
+// VisualRuns splits a laid out line into its directional runs in the order
+// they are drawn, for renderers that shape text with the font. The text of
+// each run stays in logical order; directional formatting characters are
+// left out as in ShapeLine.
+func (te *TextEngine) VisualRuns(line string, direction domain.TextDirection) []TextRun {
+	rtl := direction == domain.DirectionRTL
+	if line == "" {
+		return nil
+	}
+	if !rtl && !hasRightToLeft(line) {
+		return []TextRun{{Text: line}}
+	}
+
+	runes := []rune(line)
+	base := 0
+	if rtl {
+		base = 1
+	}
+	levels := resolveLevels(runes, base)
+
+	var runs []TextRun
+	var current []rune
+	level, last := -1, -1
+	flush := func() {
+		if len(current) > 0 {
+			if level%2 == 1 {
+				slices.Reverse(current)
+			}
+			runs = append(runs, TextRun{Text: string(current), RTL: level%2 == 1})
+			current = nil
+		}
+	}
+
+	// A run continues while the level stays the same and the characters
+	// follow each other in its direction
+	for _, i := range visualOrder(levels) {
+		r := runes[i]
+		if unicode.Is(unicode.Bidi_Control, r) {
+			continue
+		}
+		odd := levels[i]%2 == 1
+		if levels[i] != level || (odd && i > last) || (!odd && i < last) {
+			flush()
+			level = levels[i]
+		}
+		last = i
+
+		if odd {
+			if mirrored, _ := utf8.DecodeRuneInString(bidi.ReverseString(string(r))); mirrored != utf8.RuneError {
+				r = mirrored
+			}
+		}
+		current = append(current, r)
+	}
+	flush()
+
+	return runs
+}
+
+// ShapeRun replaces the Arabic letters of a run by their contextual forms and
+// returns it in drawing order, for faces shaped without OpenType tables
+func (te *TextEngine) ShapeRun(run TextRun) string {
+	shaped := []rune(shapeArabic(run.Text))
+	if run.RTL {
+		slices.Reverse(shaped)
+	}
+	return string(shaped)
+}
+
+// DetectDirection returns the direction of the first strong character of
+// text, as used for dir="auto", defaulting to left-to-right
+func (te *TextEngine) DetectDirection(text string) domain.TextDirection {
+	for _, r := range text {
+		props, _ := bidi.LookupRune(r)
+		switch props.Class() {
+		case bidi.L:
+			return domain.DirectionLTR
+		case bidi.R, bidi.AL:
+			return domain.DirectionRTL
+		}
+	}
+	return domain.DirectionLTR
+}
+
+// ResolveAlign maps logical text alignment to a physical one for the text direction
+func (te *TextEngine) ResolveAlign(text domain.TextStyle) domain.TextAlign {
+	rtl := text.Direction == domain.DirectionRTL
+	switch text.Align {
+	case domain.TextAlignCenter, domain.TextAlignRight:
+		return text.Align
+	case domain.TextAlignLeft:
+		return domain.TextAlignLeft
+	case domain.TextAlignEnd:
+		if rtl {
+			return domain.TextAlignLeft
+		}
+		return domain.TextAlignRight
+	default:
+		// start, justify and unknown values align to the start edge
+		if rtl {
+			return domain.TextAlignRight
+		}
+		return domain.TextAlignLeft
+	}
+}
+
+// hasRightToLeft reports whether text contains characters that are reordered
+// inside a left-to-right paragraph
+func hasRightToLeft(text string) bool {
+	for _, r := range text {
+		props, _ := bidi.LookupRune(r)
+		switch props.Class() {
+		case bidi.R, bidi.AL, bidi.AN, bidi.RLE, bidi.RLO, bidi.RLI:
+			return true
+		}
+	}
+	return false
+}
+
+// reorderLine converts a line from logical to visual order.
+//
+// Embedding levels are resolved following the Unicode Bidirectional
+// Algorithm for the given paragraph direction, then the line is reordered
+// (L2) and brackets inside right-to-left runs are mirrored (L4). Characters
+// removed by rule X9 and the other directional formatting characters are
+// left out.
+func reorderLine(line string, rtl bool) string {
+	runes := []rune(line)
+	base := 0
+	if rtl {
+		base = 1
+	}
+
+	levels := resolveLevels(runes, base)
+	reordered := make([]rune, 0, len(runes))
+	for _, i := range visualOrder(levels) {
+		r := runes[i]
+		if unicode.Is(unicode.Bidi_Control, r) {
+			continue
+		}
+		// Mirrored glyphs stand in for brackets drawn right to left
+		if levels[i]%2 == 1 {
+			if mirrored, _ := utf8.DecodeRuneInString(bidi.ReverseString(string(r))); mirrored != utf8.RuneError {
+				r = mirrored
+			}
+		}
+		reordered = append(reordered, r)
+	}
+
+	return string(reordered)
+}
+
+// resolveLevels returns the embedding level of each character of a line, or
+// -1 for the characters removed by rule X9
+func resolveLevels(runes []rune, base int) []int {
+	initial := make([]bidi.Class, len(runes))
+	for i, r := range runes {
+		props, _ := bidi.LookupRune(r)
+		initial[i] = props.Class()
+	}
+
+	matching := matchIsolates(initial)
+	classes, levels := resolveExplicitLevels(initial, matching, base)
+	for _, seq := range isolatingRunSequences(initial, levels, matching, base) {
+		seq.resolve(runes, initial, classes, levels)
+	}
+	resetWhitespaceLevels(initial, levels, base)
+
+	return levels
+}
+
+// maxExplicitLevel is the deepest embedding level allowed by rule BD2
+const maxExplicitLevel = 125
+
+// directionalStatus is an entry of the directional status stack of rules X1-X8
+type directionalStatus struct {
+	level    int
+	override bidi.Class // L or R inside an override, ON otherwise
+	isolate  bool
+}
+
+// isIsolateInitiator reports whether a class starts an isolate (BD8)
+func isIsolateInitiator(class bidi.Class) bool {
+	return class == bidi.LRI || class == bidi.RLI || class == bidi.FSI
+}
+
+// isRemovedByX9 reports whether a class is ignored after explicit levels are resolved
+func isRemovedByX9(class bidi.Class) bool {
+	switch class {
+	case bidi.LRE, bidi.RLE, bidi.LRO, bidi.RLO, bidi.PDF, bidi.BN:
+		return true
+	}
+	return false
+}
+
+// matchIsolates pairs isolate initiators with their matching PDI (BD9). Each
+// of the pair holds the position of the other; unmatched characters hold -1.
+func matchIsolates(classes []bidi.Class) []int {
+	matching := make([]int, len(classes))
+	var open []int
+	for i, class := range classes {
+		matching[i] = -1
+		switch {
+		case isIsolateInitiator(class):
+			open = append(open, i)
+		case class == bidi.PDI && len(open) > 0:
+			start := open[len(open)-1]
+			open = open[:len(open)-1]
+			matching[start], matching[i] = i, start
+		case class == bidi.B:
+			open = open[:0]
+		}
+	}
+	return matching
+}
+
+// firstStrong returns L or R for the first strong character between start
+// and end, skipping isolates, or ON when there is none (P2, P3)
+func firstStrong(classes []bidi.Class, matching []int, start, end int) bidi.Class {
+	for i := start; i < end; i++ {
+		switch class := classes[i]; {
+		case class == bidi.L:
+			return bidi.L
+		case class == bidi.R || class == bidi.AL:
+			return bidi.R
+		case isIsolateInitiator(class):
+			if matching[i] < 0 {
+				return bidi.ON
+			}
+			i = matching[i]
+		}
+	}
+	return bidi.ON
+}
+
+// nextLevel returns the least odd or even level greater than level
+func nextLevel(level int, rtl bool) int {
+	if rtl {
+		return (level + 1) | 1
+	}
+	return (level + 2) &^ 1
+}
+
+// resolveExplicitLevels applies the explicit embedding, override and isolate
+// rules X1-X8, returning the class of each character after overrides and its
+// level. Characters removed by rule X9 get level -1.
+func resolveExplicitLevels(initial []bidi.Class, matching []int, base int) ([]bidi.Class, []int) {
+	classes := append([]bidi.Class(nil), initial...)
+	levels := make([]int, len(initial))
+
+	stack := []directionalStatus{{level: base, override: bidi.ON}}
+	overflowIsolates, overflowEmbeddings, validIsolates := 0, 0, 0
+	for i, class := range initial {
+		top := stack[len(stack)-1]
+		switch class {
+		case bidi.RLE, bidi.LRE, bidi.RLO, bidi.LRO:
+			// X2-X5: embeddings and overrides beyond the maximum depth are ignored
+			levels[i] = -1
+			level := nextLevel(top.level, class == bidi.RLE || class == bidi.RLO)
+			if level <= maxExplicitLevel && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				override := bidi.ON
+				switch class {
+				case bidi.RLO:
+					override = bidi.R
+				case bidi.LRO:
+					override = bidi.L
+				}
+				stack = append(stack, directionalStatus{level: level, override: override})
+			} else if overflowIsolates == 0 {
+				overflowEmbeddings++
+			}
+
+		case bidi.RLI, bidi.LRI, bidi.FSI:
+			// X5a-X5c: the initiator itself belongs to the enclosing text
+			levels[i] = top.level
+			if top.override != bidi.ON {
+				classes[i] = top.override
+			}
+			rtl := class == bidi.RLI
+			if class == bidi.FSI {
+				end := matching[i]
+				if end < 0 {
+					end = len(initial)
+				}
+				rtl = firstStrong(initial, matching, i+1, end) == bidi.R
+			}
+			level := nextLevel(top.level, rtl)
+			if level <= maxExplicitLevel && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				validIsolates++
+				stack = append(stack, directionalStatus{level: level, override: bidi.ON, isolate: true})
+			} else {
+				overflowIsolates++
+			}
+
+		case bidi.PDI:
+			// X6a: close the isolate and every embedding opened inside it
+			if overflowIsolates > 0 {
+				overflowIsolates--
+			} else if validIsolates > 0 {
+				overflowEmbeddings = 0
+				for !stack[len(stack)-1].isolate {
+					stack = stack[:len(stack)-1]
+				}
+				stack = stack[:len(stack)-1]
+				validIsolates--
+			}
+			top = stack[len(stack)-1]
+			levels[i] = top.level
+			if top.override != bidi.ON {
+				classes[i] = top.override
+			}
+
+		case bidi.PDF:
+			// X7: a PDF never closes an isolate
+			levels[i] = -1
+			if overflowIsolates > 0 {
+				break
+			}
+			if overflowEmbeddings > 0 {
+				overflowEmbeddings--
+			} else if !top.isolate && len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+
+		case bidi.BN:
+			levels[i] = -1
+
+		case bidi.B:
+			// X8: a paragraph separator ends every embedding
+			levels[i] = base
+			stack = stack[:1]
+			overflowIsolates, overflowEmbeddings, validIsolates = 0, 0, 0
+
+		default:
+			// X6
+			levels[i] = top.level
+			if top.override != bidi.ON {
+				classes[i] = top.override
+			}
+		}
+	}
+
+	return classes, levels
+}
+
+// isolatingRunSequence is a sequence of level runs resolved as a unit, with
+// the text of isolates left out (BD13)
+type isolatingRunSequence struct {
+	indexes  []int // Positions of the characters in the line
+	level    int
+	sos, eos bidi.Class // Direction at the start and end of the sequence
+}
+
+// isolatingRunSequences splits the characters that remain after rule X9 into
+// isolating run sequences and determines their sos and eos (X10)
+func isolatingRunSequences(initial []bidi.Class, levels []int, matching []int, base int) []*isolatingRunSequence {
+	// Level runs are maximal sequences of characters at the same level (BD7)
+	var runs [][]int
+	for i, level := range levels {
+		if level < 0 {
+			continue
+		}
+		if n := len(runs); n > 0 && levels[runs[n-1][0]] == level {
+			runs[n-1] = append(runs[n-1], i)
+			continue
+		}
+		runs = append(runs, []int{i})
+	}
+
+	// A run ending with an isolate initiator continues with the run starting with its PDI
+	runStarting := make(map[int]int, len(runs))
+	for n, run := range runs {
+		runStarting[run[0]] = n
+	}
+	joined := make([]bool, len(runs))
+
+	// direction returns the direction of the higher of two levels
+	direction := func(a, b int) bidi.Class {
+		if max(a, b)%2 == 1 {
+			return bidi.R
+		}
+		return bidi.L
+	}
+
+	var sequences []*isolatingRunSequence
+	for n, run := range runs {
+		if joined[n] {
+			continue
+		}
+		indexes := append([]int(nil), run...)
+		for {
+			last := indexes[len(indexes)-1]
+			if !isIsolateInitiator(initial[last]) || matching[last] < 0 {
+				break
+			}
+			next, ok := runStarting[matching[last]]
+			if !ok {
+				break
+			}
+			joined[next] = true
+			indexes = append(indexes, runs[next]...)
+		}
+
+		level := levels[indexes[0]]
+		before, after := base, base
+		for i := indexes[0] - 1; i >= 0; i-- {
+			if levels[i] >= 0 {
+				before = levels[i]
+				break
+			}
+		}
+		if last := indexes[len(indexes)-1]; !isIsolateInitiator(initial[last]) {
+			for i := last + 1; i < len(levels); i++ {
+				if levels[i] >= 0 {
+					after = levels[i]
+					break
+				}
+			}
+		}
+		sequences = append(sequences, &isolatingRunSequence{
+			indexes: indexes,
+			level:   level,
+			sos:     direction(level, before),
+			eos:     direction(level, after),
+		})
+	}
+
+	return sequences
+}
+
+// resolve applies the weak, neutral and implicit rules to the characters of
+// the sequence, updating their levels
+func (s *isolatingRunSequence) resolve(runes []rune, initial, classes []bidi.Class, levels []int) {
+	seqRunes := make([]rune, len(s.indexes))
+	seqInitial := make([]bidi.Class, len(s.indexes))
+	seqClasses := make([]bidi.Class, len(s.indexes))
+	for k, i := range s.indexes {
+		seqRunes[k], seqInitial[k], seqClasses[k] = runes[i], initial[i], classes[i]
+	}
+
+	embedding := bidi.L
+	if s.level%2 == 1 {
+		embedding = bidi.R
+	}
+	resolveWeakTypes(seqClasses, s.sos)
+	resolveBracketPairs(seqRunes, seqInitial, seqClasses, s.sos, embedding)
+	resolveNeutralTypes(seqClasses, s.sos, s.eos, embedding)
+
+	// Implicit levels (I1, I2)
+	for k, i := range s.indexes {
+		switch class := seqClasses[k]; {
+		case s.level%2 == 0 && class == bidi.R:
+			levels[i] = s.level + 1
+		case s.level%2 == 0 && (class == bidi.AN || class == bidi.EN):
+			levels[i] = s.level + 2
+		case s.level%2 == 1 && (class == bidi.L || class == bidi.AN || class == bidi.EN):
+			levels[i] = s.level + 1
+		}
+	}
+}
+
+// resolveWeakTypes applies the weak type rules W1-W7 to the classes of an
+// isolating run sequence
+func resolveWeakTypes(classes []bidi.Class, sos bidi.Class) {
+	// W1: non-spacing marks take the type of the preceding character
+	for i, class := range classes {
+		if class != bidi.NSM {
+			continue
+		}
+		switch {
+		case i == 0:
+			classes[i] = sos
+		case isIsolateInitiator(classes[i-1]) || classes[i-1] == bidi.PDI:
+			classes[i] = bidi.ON
+		default:
+			classes[i] = classes[i-1]
+		}
+	}
+
+	// W2, W3: European numbers after Arabic letters are Arabic numbers; AL becomes R
+	lastStrong := sos
+	for i, class := range classes {
+		switch class {
+		case bidi.L, bidi.R, bidi.AL:
+			lastStrong = class
+		case bidi.EN:
+			if lastStrong == bidi.AL {
+				classes[i] = bidi.AN
+			}
+		}
+	}
+	for i, class := range classes {
+		if class == bidi.AL {
+			classes[i] = bidi.R
+		}
+	}
+
+	// W4: a single separator between two numbers of the same type joins them
+	for i := 1; i+1 < len(classes); i++ {
+		before, after := classes[i-1], classes[i+1]
+		switch {
+		case classes[i] == bidi.ES && before == bidi.EN && after == bidi.EN:
+			classes[i] = bidi.EN
+		case classes[i] == bidi.CS && before == after && (before == bidi.EN || before == bidi.AN):
+			classes[i] = before
+		}
+	}
+
+	// W5: terminators next to European numbers belong to the number
+	for i := 0; i < len(classes); {
+		if classes[i] != bidi.ET {
+			i++
+			continue
+		}
+		end := i
+		for end < len(classes) && classes[end] == bidi.ET {
+			end++
+		}
+		if (i > 0 && classes[i-1] == bidi.EN) || (end < len(classes) && classes[end] == bidi.EN) {
+			for j := i; j < end; j++ {
+				classes[j] = bidi.EN
+			}
+		}
+		i = end
+	}
+
+	// W6, W7: remaining separators are neutral; numbers after L text are L
+	lastStrong = sos
+	for i, class := range classes {
+		switch class {
+		case bidi.ES, bidi.ET, bidi.CS:
+			classes[i] = bidi.ON
+		case bidi.L, bidi.R:
+			lastStrong = class
+		case bidi.EN:
+			if lastStrong == bidi.L {
+				classes[i] = bidi.L
+			}
+		}
+	}
+}
+
+// maxBracketDepth bounds the bracket pairing stack as in rule BD16
+const maxBracketDepth = 63
+
+// canonicalBracket maps brackets to their canonical equivalents so that
+// either form pairs with the other
+func canonicalBracket(r rune) rune {
+	switch r {
+	case 0x2329:
+		return 0x3008
+	case 0x232A:
+		return 0x3009
+	}
+	return r
+}
+
+// resolveBracketPairs gives matching brackets the direction of the text they
+// enclose, preferring the embedding direction and otherwise following the
+// text before the opening bracket (N0)
+func resolveBracketPairs(runes []rune, initial, classes []bidi.Class, sos, embedding bidi.Class) {
+	opposite := bidi.R
+	if embedding == bidi.R {
+		opposite = bidi.L
+	}
+
+	// Pair brackets in logical order (BD16), giving up on deeper nesting
+	type pair struct{ open, close int }
+	var pairs, stack []pair
+pairing:
+	for i, r := range runes {
+		if classes[i] != bidi.ON {
+			continue
+		}
+		props, _ := bidi.LookupRune(r)
+		switch {
+		case props.IsOpeningBracket():
+			if len(stack) == maxBracketDepth {
+				break pairing
+			}
+			stack = append(stack, pair{open: i})
+		case props.IsBracket():
+			closing := canonicalBracket(r)
+			for j := len(stack) - 1; j >= 0; j-- {
+				opening := canonicalBracket(runes[stack[j].open])
+				if mirrored, _ := utf8.DecodeRuneInString(bidi.ReverseString(string(opening))); canonicalBracket(mirrored) == closing {
+					pairs = append(pairs, pair{open: stack[j].open, close: i})
+					stack = stack[:j]
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].open < pairs[j].open })
+
+	strong := func(class bidi.Class) bidi.Class {
+		switch class {
+		case bidi.L:
+			return bidi.L
+		case bidi.R, bidi.EN, bidi.AN:
+			return bidi.R
+		}
+		return bidi.ON
+	}
+
+	for _, p := range pairs {
+		foundOpposite := false
+		resolved := bidi.ON
+		for i := p.open + 1; i < p.close; i++ {
+			switch strong(classes[i]) {
+			case embedding:
+				resolved = embedding
+			case opposite:
+				foundOpposite = true
+			}
+			if resolved == embedding {
+				break
+			}
+		}
+
+		if resolved != embedding && foundOpposite {
+			// The text before the opening bracket decides between the two directions
+			context := sos
+			for i := p.open - 1; i >= 0; i-- {
+				if class := strong(classes[i]); class != bidi.ON {
+					context = class
+					break
+				}
+			}
+			resolved = embedding
+			if context == opposite {
+				resolved = opposite
+			}
+		}
+
+		if resolved == bidi.ON {
+			continue
+		}
+		// Marks following a bracket take its new direction too
+		for _, i := range []int{p.open, p.close} {
+			classes[i] = resolved
+			for j := i + 1; j < len(classes) && initial[j] == bidi.NSM; j++ {
+				classes[j] = resolved
+			}
+		}
+	}
+}
+
+// resolveNeutralTypes gives runs of neutral characters the direction of the
+// text around them when both sides agree, and the embedding direction
+// otherwise (N1, N2). Numbers count as right-to-left text.
+func resolveNeutralTypes(classes []bidi.Class, sos, eos, embedding bidi.Class) {
+	strong := func(class bidi.Class) (bidi.Class, bool) {
+		switch class {
+		case bidi.L:
+			return bidi.L, true
+		case bidi.R, bidi.EN, bidi.AN:
+			return bidi.R, true
+		}
+		return 0, false
+	}
+
+	for i := 0; i < len(classes); {
+		if _, ok := strong(classes[i]); ok {
+			i++
+			continue
+		}
+		end := i
+		for end < len(classes) {
+			if _, ok := strong(classes[end]); ok {
+				break
+			}
+			end++
+		}
+
+		before, after := sos, eos
+		if i > 0 {
+			before, _ = strong(classes[i-1])
+		}
+		if end < len(classes) {
+			after, _ = strong(classes[end])
+		}
+		resolved := embedding
+		if before == after {
+			resolved = before
+		}
+		for j := i; j < end; j++ {
+			classes[j] = resolved
+		}
+		i = end
+	}
+}
+
+// resetWhitespaceLevels draws separators, and whitespace and isolate
+// formatting characters before them or at the end of the line, at the
+// paragraph level (L1)
+func resetWhitespaceLevels(initial []bidi.Class, levels []int, base int) {
+	trailing := true
+	for i := len(initial) - 1; i >= 0; i-- {
+		switch class := initial[i]; {
+		case class == bidi.S || class == bidi.B:
+			levels[i] = base
+			trailing = true
+		case class == bidi.WS || isIsolateInitiator(class) || class == bidi.PDI:
+			if trailing {
+				levels[i] = base
+			}
+		case isRemovedByX9(class):
+			// Removed characters neither end nor break the sequence
+		default:
+			trailing = false
+		}
+	}
+}
+
+// visualOrder returns the positions of the characters with a level in the
+// order they are drawn (L2)
+func visualOrder(levels []int) []int {
+	var order, orderLevels []int
+	for i, level := range levels {
+		if level >= 0 {
+			order = append(order, i)
+			orderLevels = append(orderLevels, level)
+		}
+	}
+	reverseLevels(order, orderLevels)
+	return order
+}
+
+// reverseLevels reverses, from the highest level down to the lowest odd
+// level, every maximal sequence of positions at that level or higher. The
+// levels are reordered along with the positions.
+func reverseLevels(order []int, levels []int) {
+	highest, lowestOdd := 0, -1
+	for _, level := range levels {
+		highest = max(highest, level)
+		if level%2 == 1 && (lowestOdd < 0 || level < lowestOdd) {
+			lowestOdd = level
+		}
+	}
+	if lowestOdd < 0 {
+		return
+	}
+
+	for level := highest; level >= lowestOdd; level-- {
+		for start := 0; start < len(levels); {
+			if levels[start] < level {
+				start++
+				continue
+			}
+			end := start
+			for end < len(levels) && levels[end] >= level {
+				end++
+			}
+			for i, j := start, end-1; i < j; i, j = i+1, j-1 {
+				order[i], order[j] = order[j], order[i]
+				levels[i], levels[j] = levels[j], levels[i]
+			}
+			start = end
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package layout
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+func TestResolveLevelsConformance(t *testing.T) {
+	file, err := os.Open("testdata/bidi_character_test.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ";")
+		if len(fields) != 5 {
+			t.Fatalf("line %d: %d fields, want 5", line, len(fields))
+		}
+
+		var runes []rune
+		for _, code := range strings.Fields(fields[0]) {
+			r, err := strconv.ParseInt(code, 16, 32)
+			if err != nil {
+				t.Fatalf("line %d: %v", line, err)
+			}
+			runes = append(runes, rune(r))
+		}
+		base, _ := strconv.Atoi(fields[1])
+
+		levels := resolveLevels(runes, base)
+		if want := strings.Fields(fields[3]); !levelsMatch(levels, want) {
+			t.Errorf("line %d: levels of %s = %v, want %v", line, fields[0], levels, want)
+			continue
+		}
+		order := strings.Trim(fmt.Sprint(visualOrder(levels)), "[]")
+		if want := strings.Join(strings.Fields(fields[4]), " "); order != want {
+			t.Errorf("line %d: visual order of %s = %s, want %s", line, fields[0], order, want)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// levelsMatch compares resolved levels with the expected ones. Expected
+// levels of a single direction are only compared by parity, as ICU reports
+// the paragraph level for every character of unidirectional text; the
+// visual order is the same either way.
+func levelsMatch(levels []int, want []string) bool {
+	if len(levels) != len(want) {
+		return false
+	}
+	parities := map[int]bool{}
+	for _, level := range want {
+		if level != "x" {
+			n, _ := strconv.Atoi(level)
+			parities[n%2] = true
+		}
+	}
+	for i, level := range levels {
+		switch {
+		case want[i] == "x" || level < 0:
+			if want[i] != "x" || level >= 0 {
+				return false
+			}
+		case len(parities) == 1:
+			if !parities[level%2] {
+				return false
+			}
+		case want[i] != strconv.Itoa(level):
+			return false
+		}
+	}
+	return true
+}
+
+func TestReorderLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		rtl  bool
+		want string
+	}{
+		{"left-to-right", "abc def", false, "abc def"},
+		{"hebrew word", "abc אבג def", false, "abc גבא def"},
+		{"right-to-left paragraph", "אבג abc", true, "abc גבא"},
+		{"numbers keep their order", "אבג 123", true, "123 גבא"},
+		{"mirrored brackets", "אב (גד)", true, "(דג) בא"},
+		{"trailing whitespace", "abc אב  ", false, "abc בא  "},
+		{"embedding", "a\u202bb c\u202c d", false, "ab c d"},
+		{"override", "a\u202eb c\u202c d", false, "ac b d"},
+		{"first strong isolate", "a \u2068ב c\u2069 d", false, "a c ב d"},
+		{"marks are not drawn", "a\u200fb", false, "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reorderLine(tt.line, tt.rtl); got != tt.want {
+				t.Errorf("reorderLine(%q, %v) = %q, want %q", tt.line, tt.rtl, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShapeLine(t *testing.T) {
+	te := &TextEngine{}
+	tests := []struct {
+		name      string
+		line      string
+		direction domain.TextDirection
+		want      string
+	}{
+		{"latin unchanged", "Total: 42", domain.DirectionLTR, "Total: 42"},
+		{"arabic word", "سلام", domain.DirectionRTL, "\ufee1\ufefc\ufeb3"},
+		{"arabic in latin", "Name: بب", domain.DirectionLTR, "Name: \ufe90\ufe91"},
+		{"latin in arabic", "بب ABC", domain.DirectionRTL, "ABC \ufe90\ufe91"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := te.ShapeLine(tt.line, tt.direction); got != tt.want {
+				t.Errorf("ShapeLine(%q) = %+q, want %+q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVisualRuns(t *testing.T) {
+	te := &TextEngine{}
+	tests := []struct {
+		name      string
+		line      string
+		direction domain.TextDirection
+		want      []TextRun
+	}{
+		{"latin", "Total: 42", domain.DirectionLTR, []TextRun{{Text: "Total: 42"}}},
+		{"arabic word", "سلام", domain.DirectionRTL, []TextRun{{Text: "سلام", RTL: true}}},
+		{"arabic in latin", "Name: بب!", domain.DirectionLTR, []TextRun{{Text: "Name: "}, {Text: "بب", RTL: true}, {Text: "!"}}},
+		{"latin in arabic", "بب ABC", domain.DirectionRTL, []TextRun{{Text: "ABC"}, {Text: "بب ", RTL: true}}},
+		{"mirrored brackets", "(بب)", domain.DirectionRTL, []TextRun{{Text: ")بب(", RTL: true}}},
+		{"controls dropped", "\u202bبب\u202c", domain.DirectionLTR, []TextRun{{Text: "بب", RTL: true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := te.VisualRuns(tt.line, tt.direction); !slices.Equal(got, tt.want) {
+				t.Errorf("VisualRuns(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectDirection(t *testing.T) {
+	te := &TextEngine{}
+	tests := []struct {
+		text string
+		want domain.TextDirection
+	}{
+		{"hello", domain.DirectionLTR},
+		{"שלום world", domain.DirectionRTL},
+		{"123 مرحبا", domain.DirectionRTL},
+		{"123 ...", domain.DirectionLTR},
+	}
+	for _, tt := range tests {
+		if got := te.DetectDirection(tt.text); got != tt.want {
+			t.Errorf("DetectDirection(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
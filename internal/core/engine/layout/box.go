@@ -1,6 +1,7 @@
 package layout
 
 import (
+	"math"
 	"strconv"
 
 	"print-service/internal/core/domain"
@@ -29,11 +30,9 @@ func (bc *BoxCalculator) Calculate(node *domain.LayoutNode, ctx *LayoutContext)
 	// Calculate border box
 	borderBox := bc.calculateBorderBox(paddingBox, node.Style.Border)
 
-	// Calculate margin box
-	marginBox := bc.calculateMarginBox(borderBox, node.Style.Margin)
-
-	// Set the final box
-	node.Box = marginBox
+	// The node box is the border box; margins are applied by the flow engine
+	// when it positions the node inside its parent.
+	node.Box = domain.Box{Width: borderBox.Width, Height: borderBox.Height}
 
 	return nil
 }
@@ -42,13 +41,24 @@ func (bc *BoxCalculator) Calculate(node *domain.LayoutNode, ctx *LayoutContext)
 func (bc *BoxCalculator) calculateContentBox(node *domain.LayoutNode, ctx *LayoutContext) domain.Box {
 	box := domain.Box{}
 
+	// Auto widths fill the containing block minus our own box edges
+	available := ctx.Viewport.Width
+	if node.Parent != nil {
+		available = ContentWidth(node.Parent)
+	}
+	available -= bc.horizontalEdges(node.Style)
+
+	// Images and barcodes are as large as their image or symbol unless styled otherwise
+	if IsReplaced(node) {
+		box.Width, box.Height = bc.replacedSize(node, available, ctx)
+		return box
+	}
+
 	// Calculate width
 	if node.Style.Width == "auto" {
-		// Auto width - use available space
-		if node.Parent != nil {
-			box.Width = node.Parent.Box.Width
-		} else {
-			box.Width = ctx.Viewport.Width
+		box.Width = available
+		if box.Width < 0 {
+			box.Width = 0
 		}
 	} else {
 		box.Width = bc.parseLength(node.Style.Width, ctx.Viewport.Width)
@@ -65,6 +75,48 @@ func (bc *BoxCalculator) calculateContentBox(node *domain.LayoutNode, ctx *Layou
 	return box
 }
 
+// horizontalEdges returns the combined horizontal margin, border and padding of a style
+func (bc *BoxCalculator) horizontalEdges(style domain.ComputedStyle) float64 {
+	return style.Margin.Left + style.Margin.Right +
+		style.Padding.Left + style.Padding.Right +
+		2*style.Border.Width
+}
+
+// ContentWidth returns the width of a node's content box
+func ContentWidth(node *domain.LayoutNode) float64 {
+	width := node.Box.Width - node.Style.Padding.Left - node.Style.Padding.Right - 2*node.Style.Border.Width
+	if width < 0 {
+		return 0
+	}
+	return width
+}
+
+// ContentBox returns the position and size of a node's content box
+func ContentBox(node *domain.LayoutNode) domain.Box {
+	inset := node.Style.Border.Width
+	box := domain.Box{
+		X:      node.Box.X + inset + node.Style.Padding.Left,
+		Y:      node.Box.Y + inset + node.Style.Padding.Top,
+		Width:  ContentWidth(node),
+		Height: node.Box.Height - node.Style.Padding.Top - node.Style.Padding.Bottom - 2*inset,
+	}
+	if box.Height < 0 {
+		box.Height = 0
+	}
+	return box
+}
+
+// PaddingBox returns the position and size of a node's padding box
+func PaddingBox(node *domain.LayoutNode) domain.Box {
+	inset := node.Style.Border.Width
+	return domain.Box{
+		X:      node.Box.X + inset,
+		Y:      node.Box.Y + inset,
+		Width:  math.Max(0, node.Box.Width-2*inset),
+		Height: math.Max(0, node.Box.Height-2*inset),
+	}
+}
+
 // calculatePaddingBox calculates the padding box
 func (bc *BoxCalculator) calculatePaddingBox(contentBox domain.Box, padding domain.Margins) domain.Box {
 	return domain.Box{
@@ -86,16 +138,6 @@ func (bc *BoxCalculator) calculateBorderBox(paddingBox domain.Box, border domain
 	}
 }
 
-// calculateMarginBox calculates the margin box
-func (bc *BoxCalculator) calculateMarginBox(borderBox domain.Box, margin domain.Margins) domain.Box {
-	return domain.Box{
-		X:      borderBox.X - margin.Left,
-		Y:      borderBox.Y - margin.Top,
-		Width:  borderBox.Width + margin.Left + margin.Right,
-		Height: borderBox.Height + margin.Top + margin.Bottom,
-	}
-}
-
 // calculateAutoHeight calculates automatic height based on content
 func (bc *BoxCalculator) calculateAutoHeight(node *domain.LayoutNode, ctx *LayoutContext) float64 {
 	if node.Content != "" {
@@ -105,6 +147,11 @@ func (bc *BoxCalculator) calculateAutoHeight(node *domain.LayoutNode, ctx *Layou
 		return float64(lines) * lineHeight
 	}
 
+	// Form controls are as tall as their rows of text
+	if rows := formControlRows(node); rows > 0 {
+		return float64(rows) * node.Style.Text.LineHeight * node.Style.Font.Size
+	}
+
 	// Block element - sum of children heights
 	totalHeight := 0.0
 	for _, child := range node.Children {
@@ -0,0 +1,173 @@
+package layout
+
+import (
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/html"
+)
+
+// counterScopes tracks the CSS counters in scope while the layout tree is
+// built in document order
+type counterScopes struct {
+	counters map[string][]counterInstance // Nested instances of each counter, innermost last
+}
+
+// counterInstance is a counter created by counter-reset. It is in scope for
+// the element that created it, its following siblings and their descendants.
+type counterInstance struct {
+	owner *html.DOMNode // Parent of the element that created the counter
+	value int
+}
+
+// counterChange is a counter and the value a counter property gives it
+type counterChange struct {
+	name  string
+	value int
+}
+
+// newCounterScopes creates counter scopes with no counters
+func newCounterScopes() *counterScopes {
+	return &counterScopes{counters: make(map[string][]counterInstance)}
+}
+
+// apply changes the counters as the properties of an element or
+// pseudo-element require, resetting before setting before incrementing.
+// owner is the parent of the element, or the element of a pseudo-element.
+func (c *counterScopes) apply(owner *html.DOMNode, counters domain.Counters) {
+	for _, change := range parseCounterChanges(counters.Reset, 0) {
+		c.reset(owner, change.name, change.value)
+	}
+	for _, change := range parseCounterChanges(counters.Set, 0) {
+		if !c.exists(change.name) {
+			c.reset(owner, change.name, 0)
+		}
+		c.top(change.name).value = change.value
+	}
+	for _, change := range parseCounterChanges(counters.Increment, 1) {
+		if !c.exists(change.name) {
+			c.reset(owner, change.name, 0)
+		}
+		c.top(change.name).value += change.value
+	}
+}
+
+// reset creates a counter, or resets the one a preceding sibling created
+func (c *counterScopes) reset(owner *html.DOMNode, name string, value int) {
+	instances := c.counters[name]
+	if n := len(instances); n > 0 && instances[n-1].owner == owner {
+		instances[n-1].value = value
+		return
+	}
+	c.counters[name] = append(instances, counterInstance{owner: owner, value: value})
+}
+
+// leave ends the scope of the counters the children of an element created
+func (c *counterScopes) leave(element *html.DOMNode) {
+	for name, instances := range c.counters {
+		for len(instances) > 0 && instances[len(instances)-1].owner == element {
+			instances = instances[:len(instances)-1]
+		}
+		c.counters[name] = instances
+	}
+}
+
+// exists reports whether a counter is in scope
+func (c *counterScopes) exists(name string) bool {
+	return len(c.counters[name]) > 0
+}
+
+// top returns the innermost instance of a counter in scope
+func (c *counterScopes) top(name string) *counterInstance {
+	instances := c.counters[name]
+	return &instances[len(instances)-1]
+}
+
+// value returns the innermost value of a counter, 0 when it is not in scope
+func (c *counterScopes) value(name string) int {
+	if !c.exists(name) {
+		return 0
+	}
+	return c.top(name).value
+}
+
+// values returns the values of every instance of a counter in scope,
+// outermost first, or a single 0 when it is not in scope
+func (c *counterScopes) values(name string) []int {
+	if !c.exists(name) {
+		return []int{0}
+	}
+	values := make([]int, len(c.counters[name]))
+	for i, instance := range c.counters[name] {
+		values[i] = instance.value
+	}
+	return values
+}
+
+// parseCounterChanges parses a counter property: counter names, each
+// optionally followed by an integer, or none
+func parseCounterChanges(value string, defaultValue int) []counterChange {
+	var changes []counterChange
+	for _, field := range strings.Fields(value) {
+		if n, err := strconv.Atoi(field); err == nil {
+			if len(changes) > 0 {
+				changes[len(changes)-1].value = n
+			}
+			continue
+		}
+		if strings.EqualFold(field, "none") {
+			continue
+		}
+		changes = append(changes, counterChange{name: field, value: defaultValue})
+	}
+	return changes
+}
+
+// romanNumerals are the symbols of roman numbers with their values, largest first
+var romanNumerals = []struct {
+	value  int
+	symbol string
+}{
+	{1000, "m"}, {900, "cm"}, {500, "d"}, {400, "cd"}, {100, "c"}, {90, "xc"},
+	{50, "l"}, {40, "xl"}, {10, "x"}, {9, "ix"}, {5, "v"}, {4, "iv"}, {1, "i"},
+}
+
+// formatCounter writes a counter value in a CSS counter style: decimal,
+// decimal-leading-zero, lower-roman, upper-roman, lower-alpha, upper-alpha
+// or none. Values a style cannot write fall back to decimal.
+func formatCounter(value int, style string) string {
+	switch style = strings.ToLower(strings.TrimSpace(style)); style {
+	case "none":
+		return ""
+	case "decimal-leading-zero":
+		if value >= 0 && value < 10 {
+			return "0" + strconv.Itoa(value)
+		}
+	case "lower-roman", "upper-roman":
+		if value > 0 && value < 4000 {
+			var b strings.Builder
+			for _, numeral := range romanNumerals {
+				for ; value >= numeral.value; value -= numeral.value {
+					b.WriteString(numeral.symbol)
+				}
+			}
+			if style == "upper-roman" {
+				return strings.ToUpper(b.String())
+			}
+			return b.String()
+		}
+	case "lower-alpha", "lower-latin", "upper-alpha", "upper-latin":
+		if value > 0 {
+			var letters []byte
+			for ; value > 0; value = (value - 1) / 26 {
+				letters = append([]byte{byte('a' + (value-1)%26)}, letters...)
+			}
+			if strings.HasPrefix(style, "upper") {
+				return strings.ToUpper(string(letters))
+			}
+			return string(letters)
+		}
+	}
+	return strconv.Itoa(value)
+}
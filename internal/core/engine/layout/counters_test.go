@@ -0,0 +1,52 @@
+package layout
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFormatCounter(t *testing.T) {
+	tests := []struct {
+		value int
+		style string
+		want  string
+	}{
+		{7, "", "7"},
+		{7, "decimal", "7"},
+		{7, "decimal-leading-zero", "07"},
+		{12, "decimal-leading-zero", "12"},
+		{14, "lower-roman", "xiv"},
+		{1994, "upper-roman", "MCMXCIV"},
+		{0, "lower-roman", "0"},
+		{4000, "upper-roman", "4000"},
+		{1, "lower-alpha", "a"},
+		{28, "upper-alpha", "AB"},
+		{26, "lower-latin", "z"},
+		{-3, "lower-alpha", "-3"},
+		{5, "none", ""},
+		{5, "disc", "5"},
+	}
+	for _, tt := range tests {
+		if got := formatCounter(tt.value, tt.style); got != tt.want {
+			t.Errorf("formatCounter(%d, %q) = %q, want %q", tt.value, tt.style, got, tt.want)
+		}
+	}
+}
+
+func TestParseCounterChanges(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"section", "[{section 1}]"},
+		{"section 2 figure", "[{section 2} {figure 1}]"},
+		{"section -1", "[{section -1}]"},
+		{"none", "[]"},
+		{"", "[]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(parseCounterChanges(tt.value, 1)); got != tt.want {
+			t.Errorf("parseCounterChanges(%q, 1) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
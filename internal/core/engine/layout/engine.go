@@ -8,6 +8,7 @@ import (
 	"print-service/internal/core/domain"
 	"print-service/internal/core/engine/css"
 	"print-service/internal/core/engine/html"
+	"print-service/internal/core/engine/svg"
 )
 
 // Engine handles layout calculations for documents
@@ -28,10 +29,13 @@ func NewEngine() *Engine {
 	}
 }
 
-// CalculateLayout calculates the layout for a document
-func (e *Engine) CalculateLayout(domTree *html.DOMNode, stylesheet *css.Stylesheet, options domain.LayoutOptions) (*domain.LayoutNode, error) {
+// CalculateLayout calculates the layout for a document. Image elements are
+// sized by the images loaded for the document; images may be nil. The
+// warnings describe content that is laid out but not drawn, such as
+// barcodes whose value cannot be encoded.
+func (e *Engine) CalculateLayout(domTree *html.DOMNode, stylesheet *css.Stylesheet, options domain.LayoutOptions, images ImageSource) (*domain.LayoutNode, []string, error) {
 	if domTree == nil {
-		return nil, fmt.Errorf("DOM tree is nil")
+		return nil, nil, fmt.Errorf("DOM tree is nil")
 	}
 
 	// Create layout context
@@ -40,30 +44,42 @@ func (e *Engine) CalculateLayout(domTree *html.DOMNode, stylesheet *css.Styleshe
 			Width:  float64(options.ViewportWidth),
 			Height: float64(options.ViewportHeight),
 		},
-		DPI:     float64(options.DPI),
-		Options: options,
+		DPI:      float64(options.DPI),
+		Options:  options,
+		Images:   images,
+		Counters: newCounterScopes(),
 	}
 
 	// Build layout tree from DOM
-	layoutTree, err := e.buildLayoutTree(domTree, stylesheet, ctx)
+	layoutTree, err := e.buildLayoutTree(domTree, stylesheet, nil, ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build layout tree: %w", err)
+		return nil, nil, fmt.Errorf("failed to build layout tree: %w", err)
 	}
 
 	// Calculate layout
 	if err := e.calculateLayout(layoutTree, ctx); err != nil {
-		return nil, fmt.Errorf("failed to calculate layout: %w", err)
+		return nil, nil, fmt.Errorf("failed to calculate layout: %w", err)
 	}
 
-	return layoutTree, nil
+	return layoutTree, ctx.Warnings, nil
 }
 
 // buildLayoutTree builds a layout tree from DOM and CSS
-func (e *Engine) buildLayoutTree(domNode *html.DOMNode, stylesheet *css.Stylesheet, ctx *LayoutContext) (*domain.LayoutNode, error) {
+func (e *Engine) buildLayoutTree(domNode *html.DOMNode, stylesheet *css.Stylesheet, parentStyle *domain.ComputedStyle, ctx *LayoutContext) (*domain.LayoutNode, error) {
 	if domNode == nil {
 		return nil, nil
 	}
 
+	// Comments, doctypes and whitespace between blocks produce no boxes
+	switch domNode.Type {
+	case html.CommentNode, html.DoctypeNode, html.ErrorNode:
+		return nil, nil
+	case html.TextNode:
+		if strings.TrimSpace(domNode.Data) == "" {
+			return nil, nil
+		}
+	}
+
 	// Create layout node
 	layoutNode := &domain.LayoutNode{
 		ID:   fmt.Sprintf("node_%p", domNode),
@@ -71,25 +87,76 @@ func (e *Engine) buildLayoutTree(domNode *html.DOMNode, stylesheet *css.Styleshe
 	}
 
 	// Calculate computed styles
-	computedStyle, err := e.computeStyle(domNode, stylesheet, ctx)
+	computedStyle, err := e.computeStyle(domNode, stylesheet, parentStyle, ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to compute style: %w", err)
 	}
 	layoutNode.Style = *computedStyle
+	if bg := &layoutNode.Style.Background; bg.Image != "" && ctx.Images != nil {
+		bg.Loaded = ctx.Images.Image(bg.Image)
+	}
 
 	// Skip nodes with display: none
 	if computedStyle.Display == domain.DisplayNone {
 		return nil, nil
 	}
 
-	// Set content for text nodes
-	if domNode.Type == html.TextNode {
-		layoutNode.Content = domNode.Data
+	// Counters the element changes are in scope for its generated content,
+	// its children and its following siblings
+	if domNode.Type == html.ElementNode {
+		ctx.Counters.apply(domNode.Parent, computedStyle.Counters)
+		defer ctx.Counters.leave(domNode)
+	}
+
+	// Set content for text nodes; elements keep their name and attributes for the renderers
+	switch domNode.Type {
+	case html.TextNode:
+		layoutNode.Content = strings.Join(strings.Fields(domNode.Data), " ")
+		layoutNode.Leader = e.tocLeader(domNode, computedStyle.Font)
+		if domNode.Parent != nil && strings.ToLower(domNode.Parent.Data) == "textarea" {
+			// A textarea keeps its line breaks, except for one right after the start tag
+			layoutNode.Content = strings.TrimPrefix(strings.ReplaceAll(domNode.Data, "\r\n", "\n"), "\n")
+		}
+	case html.ElementNode:
+		layoutNode.Tag = strings.ToLower(domNode.Data)
+		layoutNode.Attributes = domNode.Attributes
+		if layoutNode.Tag == "img" && ctx.Images != nil {
+			layoutNode.Image = ctx.Images.Image(strings.TrimSpace(domNode.Attributes["src"]))
+		}
+	}
+
+	// Barcodes hold no content; their only child is the human-readable line.
+	// A value that cannot be encoded leaves an empty box.
+	if IsBarcode(layoutNode) {
+		if layoutNode.Barcode, err = encodeBarcode(layoutNode); err != nil {
+			ctx.Warnings = append(ctx.Warnings, err.Error())
+		}
+		if caption := barcodeCaption(layoutNode); caption != nil {
+			layoutNode.Children = []*domain.LayoutNode{caption}
+		}
+		return layoutNode, nil
+	}
+
+	// Inline SVG is drawn from its own elements, which produce no boxes
+	if layoutNode.Tag == "svg" {
+		layoutNode.Drawing = svg.Build(domNode, svg.Context{
+			Stylesheet: stylesheet,
+			Match:      MatchingDeclarations,
+			Color:      computedStyle.Color,
+			Font:       computedStyle.Font,
+		})
+		return layoutNode, nil
 	}
 
-	// Process children
+	// Process children, between the content of the ::before and ::after
+	// pseudo-elements, which sees the counters as the children change them
+	generates := domNode.Type == html.ElementNode && !IsFormControl(layoutNode) && !IsReplaced(layoutNode)
+	var before *domain.LayoutNode
+	if generates {
+		before = e.generatedContent(domNode, pseudoBefore, stylesheet, computedStyle, ctx)
+	}
 	for _, child := range domNode.Children {
-		childLayout, err := e.buildLayoutTree(child, stylesheet, ctx)
+		childLayout, err := e.buildLayoutTree(child, stylesheet, computedStyle, ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -98,22 +165,53 @@ func (e *Engine) buildLayoutTree(domNode *html.DOMNode, stylesheet *css.Styleshe
 			layoutNode.Children = append(layoutNode.Children, childLayout)
 		}
 	}
+	if generates {
+		attachGenerated(layoutNode, before, true)
+		attachGenerated(layoutNode, e.generatedContent(domNode, pseudoAfter, stylesheet, computedStyle, ctx), false)
+	}
 
 	return layoutNode, nil
 }
 
 // computeStyle computes the final styles for a DOM node
-func (e *Engine) computeStyle(domNode *html.DOMNode, stylesheet *css.Stylesheet, ctx *LayoutContext) (*domain.ComputedStyle, error) {
+func (e *Engine) computeStyle(domNode *html.DOMNode, stylesheet *css.Stylesheet, parentStyle *domain.ComputedStyle, ctx *LayoutContext) (*domain.ComputedStyle, error) {
 	// Start with default styles
 	style := getDefaultComputedStyle()
 
-	// Apply matching CSS rules
-	for _, rule := range stylesheet.Rules {
-		if e.selectorMatches(rule.Selectors, domNode) {
-			e.applyDeclarations(rule.Declarations, style)
+	// Inherit font, text and color properties from the parent
+	if parentStyle != nil {
+		style.Font = parentStyle.Font
+		style.Text = parentStyle.Text
+		style.Color = parentStyle.Color
+	}
+
+	// Text nodes only carry inherited properties
+	if domNode.Type == html.TextNode {
+		return style, nil
+	}
+
+	// Apply user agent defaults for the element
+	if domNode.Type == html.ElementNode {
+		if defaults, ok := userAgentStyles[strings.ToLower(domNode.Data)]; ok {
+			if err := e.applyInlineStyle(defaults, style); err != nil {
+				return nil, fmt.Errorf("failed to apply default style: %w", err)
+			}
+		}
+		if strings.ToLower(domNode.Data) == "input" {
+			if defaults, ok := inputTypeStyles[InputType(domNode.Attributes)]; ok {
+				if err := e.applyInlineStyle(defaults, style); err != nil {
+					return nil, fmt.Errorf("failed to apply default style: %w", err)
+				}
+			}
 		}
+
+		// The dir attribute is a presentational hint that author styles override
+		e.applyDirAttribute(domNode, style)
 	}
 
+	// Apply matching CSS rules
+	e.applyDeclarations(MatchingDeclarations(stylesheet, domNode), style)
+
 	// Apply inline styles
 	if inlineStyle, exists := domNode.GetAttribute("style"); exists {
 		if err := e.applyInlineStyle(inlineStyle, style); err != nil {
@@ -124,10 +222,29 @@ func (e *Engine) computeStyle(domNode *html.DOMNode, stylesheet *css.Stylesheet,
 	return style, nil
 }
 
-// selectorMatches checks if any selector matches the DOM node
-func (e *Engine) selectorMatches(selectors []*css.Selector, domNode *html.DOMNode) bool {
+// MatchingDeclarations returns the declarations of the rules of a style
+// sheet that match a DOM node, in style sheet order
+func MatchingDeclarations(stylesheet *css.Stylesheet, domNode *html.DOMNode) []*css.Declaration {
+	return matchingDeclarations(stylesheet, domNode, "")
+}
+
+// matchingDeclarations returns the declarations of the rules of a style
+// sheet that match a pseudo-element of a DOM node, or the node itself when
+// pseudo is empty, in style sheet order
+func matchingDeclarations(stylesheet *css.Stylesheet, domNode *html.DOMNode, pseudo string) []*css.Declaration {
+	var declarations []*css.Declaration
+	for _, rule := range stylesheet.Rules {
+		if selectorMatches(rule.Selectors, domNode, pseudo) {
+			declarations = append(declarations, rule.Declarations...)
+		}
+	}
+	return declarations
+}
+
+// selectorMatches checks if any selector matches the DOM node or its pseudo-element
+func selectorMatches(selectors []*css.Selector, domNode *html.DOMNode, pseudo string) bool {
 	for _, selector := range selectors {
-		if e.singleSelectorMatches(selector, domNode) {
+		if selector.PseudoElement == pseudo && singleSelectorMatches(selector, domNode) {
 			return true
 		}
 	}
@@ -135,7 +252,7 @@ func (e *Engine) selectorMatches(selectors []*css.Selector, domNode *html.DOMNod
 }
 
 // singleSelectorMatches checks if a single selector matches the DOM node
-func (e *Engine) singleSelectorMatches(selector *css.Selector, domNode *html.DOMNode) bool {
+func singleSelectorMatches(selector *css.Selector, domNode *html.DOMNode) bool {
 	// Simple matching - check the last component
 	if len(selector.Components) == 0 {
 		return false
@@ -185,10 +302,8 @@ func (e *Engine) applyDeclaration(decl *css.Declaration, style *domain.ComputedS
 	case "height":
 		style.Height = decl.Value
 	case "color":
-		if color := css.ParseValue(decl.Value); color != nil {
-			if c, ok := color.(*domain.Color); ok {
-				style.Color = *c
-			}
+		if c := parseColorValue(decl.Value); c != nil {
+			style.Color = *c
 		}
 	case "font-family":
 		style.Font.Family = decl.Value
@@ -200,12 +315,101 @@ func (e *Engine) applyDeclaration(decl *css.Declaration, style *domain.ComputedS
 		if weight := parseFontWeight(decl.Value); weight > 0 {
 			style.Font.Weight = weight
 		}
+	case "font-style":
+		style.Font.Style = strings.ToLower(decl.Value)
 	case "text-align":
 		style.Text.Align = domain.TextAlign(decl.Value)
+	case "direction":
+		switch dir := domain.TextDirection(strings.ToLower(decl.Value)); dir {
+		case domain.DirectionLTR, domain.DirectionRTL:
+			style.Text.Direction = dir
+		}
+	case "text-decoration":
+		style.Text.Decoration = decl.Value
 	case "line-height":
 		if height := parseSize(decl.Value); height > 0 {
 			style.Text.LineHeight = height
 		}
+	case "margin":
+		style.Margin = parseBoxShorthand(decl.Value)
+	case "margin-top":
+		style.Margin.Top = parseSize(decl.Value)
+	case "margin-right":
+		style.Margin.Right = parseSize(decl.Value)
+	case "margin-bottom":
+		style.Margin.Bottom = parseSize(decl.Value)
+	case "margin-left":
+		style.Margin.Left = parseSize(decl.Value)
+	case "padding":
+		style.Padding = parseBoxShorthand(decl.Value)
+	case "padding-top":
+		style.Padding.Top = parseSize(decl.Value)
+	case "padding-right":
+		style.Padding.Right = parseSize(decl.Value)
+	case "padding-bottom":
+		style.Padding.Bottom = parseSize(decl.Value)
+	case "padding-left":
+		style.Padding.Left = parseSize(decl.Value)
+	case "border":
+		style.Border = parseBorder(decl.Value)
+	case "border-width":
+		style.Border.Width = parseSize(decl.Value)
+	case "border-style":
+		style.Border.Style = domain.BorderType(decl.Value)
+	case "border-color":
+		if c := parseColorValue(decl.Value); c != nil {
+			style.Border.Color = *c
+		}
+	case "page-break-before", "break-before":
+		style.PageBreak.Before = domain.BreakType(strings.ToLower(decl.Value))
+	case "page-break-after", "break-after":
+		style.PageBreak.After = domain.BreakType(strings.ToLower(decl.Value))
+	case "page-break-inside", "break-inside":
+		style.PageBreak.Inside = domain.BreakType(strings.ToLower(decl.Value))
+	case "background":
+		style.Background = parseBackground(decl.Value)
+	case "background-color":
+		if c := parseColorValue(decl.Value); c != nil {
+			style.Background.Color = *c
+		}
+	case "background-image":
+		style.Background.Image = parseBackgroundImage(decl.Value)
+	case "background-repeat":
+		style.Background.Repeat = strings.ToLower(strings.TrimSpace(decl.Value))
+	case "background-size":
+		style.Background.Size = strings.ToLower(strings.TrimSpace(decl.Value))
+	case "background-position":
+		style.Background.Position = strings.ToLower(strings.TrimSpace(decl.Value))
+	case "content":
+		style.Content = strings.TrimSpace(decl.Value)
+	case "counter-reset":
+		style.Counters.Reset = decl.Value
+	case "counter-set":
+		style.Counters.Set = decl.Value
+	case "counter-increment":
+		style.Counters.Increment = decl.Value
+	}
+}
+
+// applyDirAttribute sets the text direction from an element's dir attribute.
+// dir="auto" and bdi elements without dir take the direction of the first
+// strong character of their text.
+func (e *Engine) applyDirAttribute(domNode *html.DOMNode, style *domain.ComputedStyle) {
+	dir, ok := domNode.GetAttribute("dir")
+	if !ok {
+		if strings.ToLower(domNode.Data) != "bdi" {
+			return
+		}
+		dir = "auto"
+	}
+
+	switch strings.ToLower(strings.TrimSpace(dir)) {
+	case "ltr":
+		style.Text.Direction = domain.DirectionLTR
+	case "rtl":
+		style.Text.Direction = domain.DirectionRTL
+	case "auto":
+		style.Text.Direction = e.textEngine.DetectDirection(textContent(domNode))
 	}
 }
 
@@ -238,6 +442,21 @@ func (e *Engine) calculateLayout(layoutNode *domain.LayoutNode, ctx *LayoutConte
 		return fmt.Errorf("box calculation failed: %w", err)
 	}
 
+	// Form controls are sized by their own rows and images by their image;
+	// neither lays out content of its own. Barcodes are sized by their
+	// symbol, with the human-readable line below it.
+	if IsBarcode(layoutNode) {
+		return e.layoutBarcodeCaption(layoutNode, ctx)
+	}
+	if IsFormControl(layoutNode) || IsReplaced(layoutNode) {
+		return nil
+	}
+
+	// A leader keeps room for its page number right of the text
+	if layoutNode.Leader != nil {
+		layoutNode.Box.Width = max(layoutNode.Box.Width-layoutNode.Leader.Width, 0)
+	}
+
 	// Handle text layout
 	if layoutNode.Content != "" {
 		if err := e.textEngine.Layout(layoutNode, ctx); err != nil {
@@ -265,6 +484,9 @@ type LayoutContext struct {
 	Viewport domain.Box
 	DPI      float64
 	Options  domain.LayoutOptions
+	Images   ImageSource    // Images loaded for the document, nil when there are none
+	Counters *counterScopes // CSS counters in scope while the layout tree is built
+	Warnings []string       // Content laid out but not drawn
 }
 
 // Helper functions
@@ -282,13 +504,78 @@ func getDefaultComputedStyle() *domain.ComputedStyle {
 			Style:  "normal",
 		},
 		Text: domain.TextStyle{
-			Align:      domain.TextAlignLeft,
+			Align:      domain.TextAlignStart,
+			Direction:  domain.DirectionLTR,
 			LineHeight: 1.2,
 		},
 		Color: domain.Color{R: 0, G: 0, B: 0, A: 255},
 	}
 }
 
+// userAgentStyles holds the default declarations applied to elements before author styles
+var userAgentStyles = map[string]string{
+	"head":       "display: none",
+	"title":      "display: none",
+	"style":      "display: none",
+	"script":     "display: none",
+	"meta":       "display: none",
+	"link":       "display: none",
+	"template":   "display: none",
+	"noscript":   "display: none",
+	"h1":         "font-size: 32px; font-weight: bold; margin: 21px 0",
+	"h2":         "font-size: 24px; font-weight: bold; margin: 20px 0",
+	"h3":         "font-size: 19px; font-weight: bold; margin: 18px 0",
+	"h4":         "font-size: 16px; font-weight: bold; margin: 21px 0",
+	"h5":         "font-size: 13px; font-weight: bold; margin: 22px 0",
+	"h6":         "font-size: 11px; font-weight: bold; margin: 25px 0",
+	"p":          "margin: 16px 0",
+	"blockquote": "margin: 16px 40px",
+	"ul":         "margin: 16px 0; padding-left: 40px",
+	"ol":         "margin: 16px 0; padding-left: 40px",
+	"b":          "font-weight: bold",
+	"strong":     "font-weight: bold",
+	"th":         "font-weight: bold",
+	"i":          "font-style: italic",
+	"em":         "font-style: italic",
+	"cite":       "font-style: italic",
+	"u":          "text-decoration: underline",
+	"code":       "font-family: monospace",
+	"pre":        "font-family: monospace; margin: 13px 0",
+	"kbd":        "font-family: monospace",
+	"samp":       "font-family: monospace",
+	"fieldset":   "margin: 0 2px; padding: 6px 12px 10px; border: 2px solid #c0c0c0",
+	"legend":     "padding: 0 2px",
+	"input":      "font-family: sans-serif; font-size: 13px; border: 1px solid #767676; padding: 1px 2px; margin: 2px 0",
+	"select":     "font-family: sans-serif; font-size: 13px; border: 1px solid #767676; padding: 1px 2px; margin: 2px 0",
+	"textarea":   "font-family: monospace; font-size: 13px; border: 1px solid #767676; padding: 2px; margin: 2px 0",
+}
+
+// inputTypeStyles holds the default declarations of input types, applied after
+// those of the input element
+var inputTypeStyles = map[string]string{
+	"hidden":   "display: none",
+	"submit":   "display: none",
+	"reset":    "display: none",
+	"button":   "display: none",
+	"image":    "display: none",
+	"file":     "display: none",
+	"checkbox": "width: 13px; height: 13px; padding: 0; margin: 3px 3px 3px 4px",
+	"radio":    "width: 13px; height: 13px; padding: 0; margin: 3px 3px 0 5px",
+}
+
+// textContent concatenates the text below a DOM node in document order
+func textContent(domNode *html.DOMNode) string {
+	if domNode.Type == html.TextNode {
+		return domNode.Data
+	}
+
+	var b strings.Builder
+	for _, child := range domNode.Children {
+		b.WriteString(textContent(child))
+	}
+	return b.String()
+}
+
 func splitClasses(class string) []string {
 	var classes []string
 	for _, c := range strings.Fields(class) {
@@ -299,11 +586,35 @@ func splitClasses(class string) []string {
 	return classes
 }
 
+// ParseLength converts a CSS length to CSS pixels, returning 0 for values
+// that are not lengths
+func ParseLength(value string) float64 {
+	return parseSize(value)
+}
+
 func parseSize(value string) float64 {
-	// Simple size parsing - just handle px for now
-	if strings.HasSuffix(value, "px") {
-		if size, err := strconv.ParseFloat(value[:len(value)-2], 64); err == nil {
-			return size
+	value = strings.TrimSpace(strings.ToLower(value))
+
+	// Absolute units converted to CSS pixels (96 per inch)
+	units := []struct {
+		suffix string
+		factor float64
+	}{
+		{"px", 1},
+		{"pt", 96.0 / 72.0},
+		{"pc", 16},
+		{"in", 96},
+		{"cm", 96 / 2.54},
+		{"mm", 96 / 25.4},
+		{"rem", 16},
+		{"em", 16},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			if size, err := strconv.ParseFloat(strings.TrimSuffix(value, unit.suffix), 64); err == nil {
+				return size * unit.factor
+			}
+			return 0
 		}
 	}
 	if size, err := strconv.ParseFloat(value, 64); err == nil {
@@ -312,6 +623,66 @@ func parseSize(value string) float64 {
 	return 0
 }
 
+// parseBoxShorthand parses a one to four value margin or padding shorthand
+func parseBoxShorthand(value string) domain.Margins {
+	parts := strings.Fields(value)
+	sizes := make([]float64, len(parts))
+	for i, part := range parts {
+		sizes[i] = parseSize(part)
+	}
+
+	switch len(sizes) {
+	case 1:
+		return domain.Margins{Top: sizes[0], Right: sizes[0], Bottom: sizes[0], Left: sizes[0]}
+	case 2:
+		return domain.Margins{Top: sizes[0], Right: sizes[1], Bottom: sizes[0], Left: sizes[1]}
+	case 3:
+		return domain.Margins{Top: sizes[0], Right: sizes[1], Bottom: sizes[2], Left: sizes[1]}
+	case 4:
+		return domain.Margins{Top: sizes[0], Right: sizes[1], Bottom: sizes[2], Left: sizes[3]}
+	default:
+		return domain.Margins{}
+	}
+}
+
+// parseBorder parses a border shorthand such as "1px solid #000"
+func parseBorder(value string) domain.BorderStyle {
+	border := domain.BorderStyle{
+		Width: 3,
+		Style: domain.BorderNone,
+		Color: domain.Color{R: 0, G: 0, B: 0, A: 255},
+	}
+
+	for _, part := range strings.Fields(value) {
+		switch domain.BorderType(part) {
+		case domain.BorderSolid, domain.BorderDashed, domain.BorderDotted, domain.BorderDouble, domain.BorderNone:
+			border.Style = domain.BorderType(part)
+			continue
+		}
+		if c := parseColorValue(part); c != nil {
+			border.Color = *c
+			continue
+		}
+		if width := parseSize(part); width > 0 {
+			border.Width = width
+		}
+	}
+
+	if border.Style == domain.BorderNone {
+		border.Width = 0
+	}
+
+	return border
+}
+
+// parseColorValue parses a CSS color, returning nil when the value is not a color
+func parseColorValue(value string) *domain.Color {
+	if c, ok := css.ParseValue(value).(*domain.Color); ok {
+		return c
+	}
+	return nil
+}
+
 func parseFontWeight(value string) int {
 	switch value {
 	case "normal":
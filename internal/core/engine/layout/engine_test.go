@@ -0,0 +1,69 @@
+package layout
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/css"
+	"print-service/internal/core/engine/html"
+)
+
+// stylePattern matches the style elements of a document, whose content the
+// sanitized DOM escapes
+var stylePattern = regexp.MustCompile(`(?is)<style[^>]*>(.*?)</style>`)
+
+// layoutHTML lays out a document at the default viewport, with its style
+// elements as the style sheet
+func layoutHTML(t *testing.T, content string) (*domain.LayoutNode, []string) {
+	t.Helper()
+	options := domain.DefaultPrintOptions()
+	dom, err := html.NewParser(html.NewSanitizer(), html.NewValidator(false)).Parse(content, options.Security)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	var styles strings.Builder
+	for _, match := range stylePattern.FindAllStringSubmatch(content, -1) {
+		styles.WriteString(match[1])
+	}
+	stylesheet, err := css.NewParser(false).Parse(styles.String())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	root, warnings, err := NewEngine().CalculateLayout(dom, stylesheet, options.Layout, nil)
+	if err != nil {
+		t.Fatalf("CalculateLayout() error = %v", err)
+	}
+	return root, warnings
+}
+
+// findNode returns the first node of the layout tree for which match is true
+func findNode(node *domain.LayoutNode, match func(*domain.LayoutNode) bool) *domain.LayoutNode {
+	if node == nil || match(node) {
+		return node
+	}
+	for _, child := range node.Children {
+		if found := findNode(child, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findTag returns the first element of the layout tree with a tag
+func findTag(node *domain.LayoutNode, tag string) *domain.LayoutNode {
+	return findNode(node, func(n *domain.LayoutNode) bool { return n.Tag == tag })
+}
+
+// near reports whether two lengths are equal but for rounding
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestCalculateLayoutNilTree(t *testing.T) {
+	if _, _, err := NewEngine().CalculateLayout(nil, &css.Stylesheet{}, domain.DefaultPrintOptions().Layout, nil); err == nil {
+		t.Error("CalculateLayout(nil) succeeded, want an error")
+	}
+}
@@ -34,26 +34,46 @@ func (fe *FlowEngine) Calculate(node *domain.LayoutNode, ctx *LayoutContext) err
 
 // calculateBlockFlow calculates block-level element flow
 func (fe *FlowEngine) calculateBlockFlow(node *domain.LayoutNode, ctx *LayoutContext) error {
-	currentY := node.Box.Y + node.Style.Padding.Top
+	contentX := node.Box.X + node.Style.Border.Width + node.Style.Padding.Left
+	contentTop := node.Box.Y + node.Style.Border.Width + node.Style.Padding.Top
+	currentY := contentTop
 
 	for _, child := range node.Children {
-		// Position child at current Y
-		child.Box.X = node.Box.X + node.Style.Padding.Left + child.Style.Margin.Left
-		child.Box.Y = currentY + child.Style.Margin.Top
+		// Position child at current Y, carrying its already laid out subtree along
+		fe.moveTo(child, contentX+child.Style.Margin.Left, currentY+child.Style.Margin.Top)
 
 		// Move Y position down by child's total height
 		currentY += child.Box.Height + child.Style.Margin.Top + child.Style.Margin.Bottom
 	}
 
 	// Update parent height if needed
-	totalContentHeight := currentY - (node.Box.Y + node.Style.Padding.Top)
-	if node.Style.Height == "auto" {
-		node.Box.Height = totalContentHeight + node.Style.Padding.Top + node.Style.Padding.Bottom
+	totalContentHeight := currentY - contentTop
+	if node.Style.Height == "auto" && node.Content == "" {
+		node.Box.Height = totalContentHeight + node.Style.Padding.Top + node.Style.Padding.Bottom + 2*node.Style.Border.Width
 	}
 
 	return nil
 }
 
+// moveTo positions a node at the given coordinates and shifts its descendants by the same offset
+func (fe *FlowEngine) moveTo(node *domain.LayoutNode, x, y float64) {
+	dx := x - node.Box.X
+	dy := y - node.Box.Y
+	if dx == 0 && dy == 0 {
+		return
+	}
+	shiftNode(node, dx, dy)
+}
+
+// shiftNode recursively offsets a node and all of its descendants
+func shiftNode(node *domain.LayoutNode, dx, dy float64) {
+	node.Box.X += dx
+	node.Box.Y += dy
+	for _, child := range node.Children {
+		shiftNode(child, dx, dy)
+	}
+}
+
 // calculateInlineFlow calculates inline element flow
 func (fe *FlowEngine) calculateInlineFlow(node *domain.LayoutNode, ctx *LayoutContext) error {
 	// Inline elements flow horizontally
@@ -66,14 +86,12 @@ func (fe *FlowEngine) calculateInlineFlow(node *domain.LayoutNode, ctx *LayoutCo
 
 		if child.Box.Width <= availableWidth {
 			// Child fits on current line
-			child.Box.X = currentX
-			child.Box.Y = node.Box.Y + node.Style.Padding.Top
+			fe.moveTo(child, currentX, node.Box.Y+node.Style.Padding.Top)
 			currentX += child.Box.Width
 		} else {
 			// Child doesn't fit, wrap to next line
 			currentX = node.Box.X + node.Style.Padding.Left
-			child.Box.X = currentX
-			child.Box.Y = node.Box.Y + node.Style.Padding.Top + lineHeight
+			fe.moveTo(child, currentX, node.Box.Y+node.Style.Padding.Top+lineHeight)
 			currentX += child.Box.Width
 		}
 	}
@@ -100,8 +118,7 @@ func (fe *FlowEngine) calculateFlexFlow(node *domain.LayoutNode, ctx *LayoutCont
 	currentX := node.Box.X + node.Style.Padding.Left
 
 	for _, child := range node.Children {
-		child.Box.X = currentX
-		child.Box.Y = node.Box.Y + node.Style.Padding.Top
+		fe.moveTo(child, currentX, node.Box.Y+node.Style.Padding.Top)
 		child.Box.Width = childWidth
 		currentX += childWidth
 	}
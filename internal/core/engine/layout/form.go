@@ -0,0 +1,100 @@
+package layout
+
+import (
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+)
+
+// buttonInputTypes are input types that do not hold a value a reader can
+// fill in, so they do not become fields. Buttons are not printed at all.
+var buttonInputTypes = map[string]bool{
+	"hidden": true, "submit": true, "reset": true, "button": true,
+	"image": true, "file": true, "color": true, "range": true,
+}
+
+// Default sizes of form controls
+const (
+	defaultTextareaRows   = 2 // Rows of a textarea without a rows attribute
+	defaultListSelectRows = 4 // Rows of a multiple select without a size attribute
+)
+
+// InputType returns the lower-cased type of an input element. Missing and
+// unknown types are text, as in browsers.
+func InputType(attributes map[string]string) string {
+	switch t := strings.ToLower(strings.TrimSpace(attributes["type"])); t {
+	case "checkbox", "radio",
+		"email", "tel", "url", "number", "search", "password", "date", "time", "datetime-local", "month", "week":
+		return t
+	default:
+		if buttonInputTypes[t] {
+			return t
+		}
+		return "text"
+	}
+}
+
+// IsFormControl reports whether a node is a form control that becomes a
+// fillable field: a text-like input, checkbox, radio button, select or
+// textarea. The content of these elements is their value, not laid out text.
+func IsFormControl(node *domain.LayoutNode) bool {
+	if node == nil {
+		return false
+	}
+	switch node.Tag {
+	case "select", "textarea":
+		return true
+	case "input":
+		return !buttonInputTypes[InputType(node.Attributes)]
+	}
+	return false
+}
+
+// IsListSelect reports whether a select shows several options at once
+// instead of a drop-down list
+func IsListSelect(node *domain.LayoutNode) bool {
+	_, multiple := node.Attributes["multiple"]
+	return multiple || intAttribute(node.Attributes, "size", 1) > 1
+}
+
+// formControlRows returns the number of text lines a form control is tall,
+// or 0 for controls sized by their style alone
+func formControlRows(node *domain.LayoutNode) int {
+	switch node.Tag {
+	case "textarea":
+		return intAttribute(node.Attributes, "rows", defaultTextareaRows)
+	case "select":
+		if !IsListSelect(node) {
+			return 1
+		}
+		return intAttribute(node.Attributes, "size", defaultListSelectRows)
+	case "input":
+		switch InputType(node.Attributes) {
+		case "checkbox", "radio":
+			return 0
+		}
+		return 1
+	}
+	return 0
+}
+
+// intAttribute parses a positive integer attribute, returning fallback when
+// it is missing or invalid
+func intAttribute(attributes map[string]string, name string, fallback int) int {
+	if value, err := strconv.Atoi(strings.TrimSpace(attributes[name])); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// InFormControl reports whether a node is part of the content of a form
+// control, which is drawn as the control's value rather than as text
+func InFormControl(node *domain.LayoutNode) bool {
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		if IsFormControl(parent) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,252 @@
+package layout
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/css"
+	"print-service/internal/core/engine/html"
+)
+
+// Pseudo-elements whose content property generates text
+const (
+	pseudoBefore = "before"
+	pseudoAfter  = "after"
+)
+
+// pageReferenceMarker holds the place of a page number in generated text
+// until the layout is paginated. Its three characters keep room for numbers
+// up to 999 when lines are broken.
+const pageReferenceMarker = "\uE000\uE000\uE000"
+
+// unknownPage is written for page references whose target does not exist
+const unknownPage = "?"
+
+// generatedContent lays out the text a ::before or ::after pseudo-element of
+// an element generates, applying the counter changes it declares first. It
+// returns nil when the pseudo-element has no content.
+//
+// The content property combines strings with attr(), counter(), counters()
+// and target-counter(). counter(page), counter(pages) and
+// target-counter(..., page) are page numbers, filled in once the layout is
+// paginated.
+func (e *Engine) generatedContent(domNode *html.DOMNode, pseudo string, stylesheet *css.Stylesheet, elementStyle *domain.ComputedStyle, ctx *LayoutContext) *domain.LayoutNode {
+	declarations := matchingDeclarations(stylesheet, domNode, pseudo)
+	if len(declarations) == 0 {
+		return nil
+	}
+
+	// Pseudo-elements inherit from their element
+	style := getDefaultComputedStyle()
+	style.Font = elementStyle.Font
+	style.Text = elementStyle.Text
+	style.Color = elementStyle.Color
+	e.applyDeclarations(declarations, style)
+	if style.Display == domain.DisplayNone {
+		return nil
+	}
+	ctx.Counters.apply(domNode, style.Counters)
+
+	text, references, ok := evaluateContent(style.Content, domNode, ctx.Counters)
+	if !ok {
+		return nil
+	}
+	return &domain.LayoutNode{
+		ID:         fmt.Sprintf("node_%p_%s", domNode, pseudo),
+		Type:       "text",
+		Style:      *style,
+		Content:    text,
+		References: references,
+	}
+}
+
+// attachGenerated adds the text of a pseudo-element to its element, joining
+// the text it precedes or follows when there is one, as the layout gives
+// every node a line of its own. Otherwise it becomes the first or last child.
+func attachGenerated(element, generated *domain.LayoutNode, first bool) {
+	if generated == nil {
+		return
+	}
+
+	children := element.Children
+	if first {
+		if len(children) > 0 && children[0].Type == "text" && children[0].Content != "" {
+			text := children[0]
+			text.Content = joinGenerated(generated.Content, text.Content)
+			text.References = append(generated.References, text.References...)
+			return
+		}
+		generated.Parent = element
+		element.Children = append([]*domain.LayoutNode{generated}, children...)
+		return
+	}
+
+	if last := len(children) - 1; last >= 0 && children[last].Type == "text" && children[last].Content != "" {
+		text := children[last]
+		text.Content = joinGenerated(text.Content, generated.Content)
+		text.References = append(text.References, generated.References...)
+		return
+	}
+	generated.Parent = element
+	element.Children = append(children, generated)
+}
+
+// joinGenerated joins two pieces of text, collapsing the white space between them
+func joinGenerated(first, second string) string {
+	return strings.Join(strings.Fields(first+second), " ")
+}
+
+// evaluateContent converts the content property of a pseudo-element into
+// text, with a placeholder for each page reference. ok is false for none,
+// normal and values that generate nothing.
+func evaluateContent(value string, domNode *html.DOMNode, counters *counterScopes) (text string, references []*domain.PageReference, ok bool) {
+	var b strings.Builder
+	for _, token := range contentTokens(value) {
+		name, args, isFunction := contentFunction(token)
+		if !isFunction {
+			switch {
+			case strings.HasPrefix(token, `"`) || strings.HasPrefix(token, `'`):
+				b.WriteString(cssUnescape.Replace(token[1 : len(token)-1]))
+			case strings.EqualFold(token, "none"), strings.EqualFold(token, "normal"):
+				return "", nil, false
+			}
+			continue // Quotes and other keywords generate nothing
+		}
+
+		style := ""
+		switch name {
+		case "attr":
+			if len(args) > 0 {
+				b.WriteString(domNode.Attributes[strings.ToLower(args[0])])
+			}
+		case "counter":
+			if len(args) == 0 {
+				continue
+			}
+			if len(args) > 1 {
+				style = args[1]
+			}
+			switch strings.ToLower(args[0]) {
+			case "page":
+				references = append(references, &domain.PageReference{Style: style})
+				b.WriteString(pageReferenceMarker)
+			case "pages":
+				references = append(references, &domain.PageReference{Total: true, Style: style})
+				b.WriteString(pageReferenceMarker)
+			default:
+				b.WriteString(formatCounter(counters.value(args[0]), style))
+			}
+		case "counters":
+			if len(args) < 2 {
+				continue
+			}
+			if len(args) > 2 {
+				style = args[2]
+			}
+			values := counters.values(args[0])
+			parts := make([]string, len(values))
+			for i, value := range values {
+				parts[i] = formatCounter(value, style)
+			}
+			b.WriteString(strings.Join(parts, contentString(args[1])))
+		case "target-counter":
+			// Only the page a target starts on is known; other counters are not tracked per element
+			if len(args) < 2 || !strings.EqualFold(args[1], "page") {
+				continue
+			}
+			if len(args) > 2 {
+				style = args[2]
+			}
+			references = append(references, &domain.PageReference{Target: contentTarget(args[0], domNode), Style: style})
+			b.WriteString(pageReferenceMarker)
+		}
+	}
+
+	if b.Len() == 0 {
+		return "", nil, false
+	}
+	return b.String(), references, true
+}
+
+// contentTokens splits a content value into its strings, functions and keywords
+func contentTokens(value string) []string {
+	value = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(value)
+	var tokens []string
+	for _, token := range css.SplitOutside(value, ' ') {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// contentFunction splits a function token of a content value into its
+// lower-cased name and its arguments
+func contentFunction(token string) (name string, args []string, ok bool) {
+	open := strings.IndexByte(token, '(')
+	if open <= 0 || !strings.HasSuffix(token, ")") || strings.ContainsAny(token[:open], `"'`) {
+		return "", nil, false
+	}
+	for _, arg := range css.SplitOutside(token[open+1:len(token)-1], ',') {
+		args = append(args, strings.TrimSpace(arg))
+	}
+	return strings.ToLower(token[:open]), args, true
+}
+
+// contentString returns the text of a quoted string argument
+func contentString(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return cssUnescape.Replace(value[1 : len(value)-1])
+	}
+	return value
+}
+
+// contentTarget returns the id a target-counter() refers to, given as
+// attr(), url() or a string holding a fragment URL such as "#terms"
+func contentTarget(value string, domNode *html.DOMNode) string {
+	target := contentString(value)
+	if name, args, ok := contentFunction(value); ok && name == "attr" && len(args) > 0 {
+		target = domNode.Attributes[strings.ToLower(args[0])]
+	} else if address, ok := css.ParseURL(value); ok {
+		target = address
+	}
+
+	fragment := strings.TrimSpace(target)
+	if i := strings.IndexByte(fragment, '#'); i >= 0 {
+		fragment = fragment[i+1:]
+	}
+	if unescaped, err := url.PathUnescape(fragment); err == nil {
+		fragment = unescaped
+	}
+	return fragment
+}
+
+// fillPageReferences replaces the placeholders of a node's page references
+// by their numbers, as given by number. Numbers of 0 or less are unknown.
+func fillPageReferences(node *domain.LayoutNode, number func(reference *domain.PageReference) int) {
+	if len(node.References) == 0 {
+		return
+	}
+
+	var b strings.Builder
+	rest := node.Content
+	for _, reference := range node.References {
+		i := strings.Index(rest, pageReferenceMarker)
+		if i < 0 {
+			break
+		}
+		b.WriteString(rest[:i])
+		if page := number(reference); page > 0 {
+			b.WriteString(formatCounter(page, reference.Style))
+		} else {
+			b.WriteString(unknownPage)
+		}
+		rest = rest[i+len(pageReferenceMarker):]
+	}
+	b.WriteString(rest)
+
+	node.Content = b.String()
+	node.References = nil
+}
@@ -0,0 +1,175 @@
+package layout
+
+import (
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/html"
+)
+
+// paginateHTML lays out and paginates a document in pages of a height
+func paginateHTML(t *testing.T, content string, pageHeight float64) *domain.LayoutNode {
+	t.Helper()
+	root, _ := layoutHTML(t, content)
+	if _, err := NewPageBreaker().CalculatePageBreaks(root, pageHeight); err != nil {
+		t.Fatalf("CalculatePageBreaks() error = %v", err)
+	}
+	return root
+}
+
+// texts returns the text of the layout tree in document order
+func texts(node *domain.LayoutNode) []string {
+	var result []string
+	if node.Content != "" {
+		result = append(result, node.Content)
+	}
+	for _, child := range node.Children {
+		result = append(result, texts(child)...)
+	}
+	return result
+}
+
+func TestEvaluateContent(t *testing.T) {
+	counters := newCounterScopes()
+	counters.reset(nil, "chapter", 3)
+	counters.reset(nil, "section", 1)
+	counters.reset(&html.DOMNode{}, "section", 4)
+	element := &html.DOMNode{Type: html.ElementNode, Data: "a", Attributes: map[string]string{"href": "#terms", "title": "Terms"}}
+
+	tests := []struct {
+		name       string
+		value      string
+		want       string
+		references []domain.PageReference
+	}{
+		{"string", `"Note: "`, "Note: ", nil},
+		{"escapes", `"\"quoted\""`, `"quoted"`, nil},
+		{"attr", `attr(title) ": "`, "Terms: ", nil},
+		{"counter", `"Chapter " counter(chapter) "."`, "Chapter 3.", nil},
+		{"counter style", `counter(chapter, upper-roman)`, "III", nil},
+		{"unknown counter", `counter(figure)`, "0", nil},
+		{"counters", `counters(section, ".")`, "1.4", nil},
+		{"counters style", `counters(section, "-", lower-alpha)`, "a-d", nil},
+		{"page", `"Page " counter(page)`, "Page " + pageReferenceMarker, []domain.PageReference{{}}},
+		{"pages", `counter(pages, lower-roman)`, pageReferenceMarker, []domain.PageReference{{Total: true, Style: "lower-roman"}}},
+		{"target-counter attr", `target-counter(attr(href), page)`, pageReferenceMarker, []domain.PageReference{{Target: "terms"}}},
+		{"target-counter url", `target-counter(url(#terms), page, upper-roman)`, pageReferenceMarker, []domain.PageReference{{Target: "terms", Style: "upper-roman"}}},
+		{"target-counter string", `target-counter("#terms", page)`, pageReferenceMarker, []domain.PageReference{{Target: "terms"}}},
+		{"target-counter of another counter", `"x" target-counter(attr(href), chapter)`, "x", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, references, ok := evaluateContent(tt.value, element, counters)
+			if !ok || text != tt.want {
+				t.Errorf("evaluateContent(%s) = %q, %v, want %q", tt.value, text, ok, tt.want)
+			}
+			if len(references) != len(tt.references) {
+				t.Fatalf("evaluateContent(%s) has %d references, want %d", tt.value, len(references), len(tt.references))
+			}
+			for i, reference := range references {
+				if *reference != tt.references[i] {
+					t.Errorf("reference %d = %+v, want %+v", i, *reference, tt.references[i])
+				}
+			}
+		})
+	}
+
+	for _, value := range []string{"none", "normal", `""`, "open-quote"} {
+		if text, _, ok := evaluateContent(value, element, counters); ok {
+			t.Errorf("evaluateContent(%s) = %q, want nothing", value, text)
+		}
+	}
+}
+
+func TestContentTarget(t *testing.T) {
+	element := &html.DOMNode{Type: html.ElementNode, Data: "a", Attributes: map[string]string{"href": "chapter.html#part%202"}}
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"attr(href)", "part 2"},
+		{`"#terms"`, "terms"},
+		{"url(#terms)", "terms"},
+		{`url("#terms")`, "terms"},
+		{`"terms"`, "terms"},
+	}
+	for _, tt := range tests {
+		if got := contentTarget(tt.value, element); got != tt.want {
+			t.Errorf("contentTarget(%s) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestGeneratedCounters(t *testing.T) {
+	root, _ := layoutHTML(t, `<style>
+		body { counter-reset: chapter }
+		h1 { counter-increment: chapter; counter-reset: section }
+		h1::before { content: "Chapter " counter(chapter) ": " }
+		h2 { counter-increment: section }
+		h2::before { content: counter(chapter) "." counter(section) " " }
+		li::before { content: counters(item, ".") " " }
+		ol { counter-reset: item }
+		li { counter-increment: item }
+		</style>
+		<h1>Start</h1><h2>Scope</h2><h2>Terms</h2>
+		<h1>Use</h1><h2>Setup</h2>
+		<ol><li>One</li><li>Two<ol><li>Nested</li></ol></li></ol>`)
+	want := []string{"Chapter 1: Start", "1.1 Scope", "1.2 Terms", "Chapter 2: Use", "2.1 Setup", "1 One", "2 Two", "2.1 Nested"}
+	if got := texts(root); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+}
+
+func TestTargetCounterResolution(t *testing.T) {
+	root := paginateHTML(t, `<style>
+		a::after { content: " (page " target-counter(attr(href), page) ")" }
+		section { break-before: page }
+		</style>
+		<p><a href="#terms">Terms</a></p>
+		<p><a href="#missing">Missing</a></p>
+		<section><p>Body</p></section>
+		<section id="terms"><p>Terms and conditions</p></section>
+		<section><p><a href="#terms">Back</a></p></section>`, 500)
+	want := []string{"Terms (page 3)", "Missing (page ?)", "Body", "Terms and conditions", "Back (page 3)"}
+	if got := texts(root); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+}
+
+func TestPageCounterResolution(t *testing.T) {
+	root, _ := layoutHTML(t, `<style>
+		p::after { content: " " counter(page) "/" counter(pages, upper-roman) }
+		p { break-after: page }
+		</style>
+		<p>One</p><p>Two</p><p>Three</p>`)
+	pb := NewPageBreaker()
+	if _, err := pb.CalculateNumberedPageBreaks(root, 500, PageNumbering{Offset: 2, Total: 9}); err != nil {
+		t.Fatalf("CalculateNumberedPageBreaks() error = %v", err)
+	}
+	want := []string{"One 3/IX", "Two 4/IX", "Three 5/IX"}
+	if got := texts(root); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+}
+
+func TestFillPageReferences(t *testing.T) {
+	node := &domain.LayoutNode{
+		Content: "See " + pageReferenceMarker + " of " + pageReferenceMarker + " and " + pageReferenceMarker,
+		References: []*domain.PageReference{
+			{Target: "a", Style: "lower-roman"}, {Total: true}, {Target: "missing"},
+		},
+	}
+	fillPageReferences(node, func(reference *domain.PageReference) int {
+		switch {
+		case reference.Total:
+			return 12
+		case reference.Target == "a":
+			return 4
+		}
+		return 0
+	})
+	if want := "See iv of 12 and ?"; node.Content != want || node.References != nil {
+		t.Errorf("fillPageReferences() = %q with %d references, want %q", node.Content, len(node.References), want)
+	}
+}
@@ -0,0 +1,68 @@
+package layout
+
+import (
+	"strings"
+
+	"print-service/internal/core/domain"
+)
+
+// ImageSource looks up the images loaded for a document by their source
+type ImageSource interface {
+	Image(src string) *domain.Image
+}
+
+// IsReplaced reports whether a node is an image, svg or barcode element,
+// sized by its image, artwork or symbol rather than by its content
+func IsReplaced(node *domain.LayoutNode) bool {
+	return node != nil && (node.Tag == "img" || node.Tag == "svg" || IsBarcode(node))
+}
+
+// replacedSize returns the content size of an image, svg or barcode element
+// in CSS pixels. Missing dimensions come from the width and height attributes,
+// then from the image, artwork or symbol, keeping its aspect ratio. Images
+// wider than their containing block are scaled down to fit, as pages cannot
+// scroll.
+func (bc *BoxCalculator) replacedSize(node *domain.LayoutNode, available float64, ctx *LayoutContext) (float64, float64) {
+	width := bc.replacedLength(node.Style.Width, node.Attributes["width"], ctx.Viewport.Width)
+	height := bc.replacedLength(node.Style.Height, node.Attributes["height"], ctx.Viewport.Height)
+
+	var intrinsicWidth, intrinsicHeight float64
+	if img := node.Image; img != nil && img.Width > 0 && img.Height > 0 {
+		intrinsicWidth, intrinsicHeight = float64(img.Width), float64(img.Height)
+	}
+	if drawing := node.Drawing; drawing != nil {
+		intrinsicWidth, intrinsicHeight = drawing.Width, drawing.Height
+	}
+	if code := node.Barcode; code != nil {
+		intrinsicWidth = float64(code.Columns) * code.ModuleWidth
+		intrinsicHeight = float64(code.Rows) * code.ModuleHeight
+	}
+	switch {
+	case width > 0 && height > 0:
+	case width > 0 && intrinsicWidth > 0:
+		height = width * intrinsicHeight / intrinsicWidth
+	case height > 0 && intrinsicHeight > 0:
+		width = height * intrinsicWidth / intrinsicHeight
+	case width <= 0 && height <= 0:
+		width, height = intrinsicWidth, intrinsicHeight
+	}
+
+	if node.Style.Width == "auto" && width > available && available > 0 {
+		height *= available / width
+		width = available
+	}
+	return width, height
+}
+
+// replacedLength resolves one dimension of an image element from its style,
+// falling back to the HTML attribute. It returns 0 when neither sets it.
+func (bc *BoxCalculator) replacedLength(style, attribute string, containerSize float64) float64 {
+	if style != "auto" && style != "" {
+		return bc.parseLength(style, containerSize)
+	}
+	attribute = strings.TrimSuffix(strings.TrimSpace(attribute), "px")
+	if attribute == "" {
+		return 0
+	}
+	return bc.parseLength(attribute, containerSize)
+}
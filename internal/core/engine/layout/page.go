@@ -1,144 +1,186 @@
 package layout
 
 import (
+	"math"
+	"strings"
+
 	"print-service/internal/core/domain"
 )
 
 // PageBreaker handles page breaking logic for print layouts
-type PageBreaker struct{}
+type PageBreaker struct {
+	textEngine *TextEngine
+}
 
 // NewPageBreaker creates a new page breaker
 func NewPageBreaker() *PageBreaker {
-	return &PageBreaker{}
+	return &PageBreaker{
+		textEngine: NewTextEngine(),
+	}
 }
 
-// CalculatePageBreaks calculates where page breaks should occur
-func (pb *PageBreaker) CalculatePageBreaks(node *domain.LayoutNode, pageHeight float64) ([]*PageBreak, error) {
-	var pageBreaks []*PageBreak
-	currentPage := &PageBreak{
-		PageNumber: 1,
-		StartY:     0,
-		EndY:       pageHeight,
-		Nodes:      make([]*domain.LayoutNode, 0),
+// paginationState tracks progress while content is pushed onto later pages
+type paginationState struct {
+	pageHeight float64
+	offset     float64 // Accumulated downward shift applied to content not yet visited
+}
+
+// PageNumbering numbers the pages of a document that is part of a larger
+// one, such as a part of a compound job. The zero value numbers a document
+// on its own.
+type PageNumbering struct {
+	Offset int // Pages before the document
+	Total  int // Pages of the larger document, 0 when the document stands alone
+}
+
+// Page returns the number of a page given its 1-based position in the
+// document, or 0 for an unknown page
+func (n PageNumbering) Page(page int) int {
+	if page <= 0 {
+		return 0
 	}
+	return n.Offset + page
+}
 
-	err := pb.processNode(node, currentPage, pageHeight, &pageBreaks)
-	if err != nil {
-		return nil, err
+// Pages returns the page count of the larger document, given the page
+// count of the document itself
+func (n PageNumbering) Pages(count int) int {
+	if n.Total > 0 {
+		return n.Total
 	}
+	return n.Offset + count
+}
 
-	// Add the last page if it has content
-	if len(currentPage.Nodes) > 0 {
-		pageBreaks = append(pageBreaks, currentPage)
+// CalculatePageBreaks calculates where page breaks should occur.
+//
+// The layout tree is modified in place: content that would straddle a page
+// boundary is moved to the top of the next page, text nodes are split between
+// lines, and ancestors grow to contain the shifted content. The returned pages
+// list, in document order, every node whose box intersects each page.
+func (pb *PageBreaker) CalculatePageBreaks(node *domain.LayoutNode, pageHeight float64) ([]*PageBreak, error) {
+	return pb.CalculateNumberedPageBreaks(node, pageHeight, PageNumbering{})
+}
+
+// CalculateNumberedPageBreaks calculates page breaks as CalculatePageBreaks
+// does, numbering the pages of generated content and leaders as numbering
+// places them in a larger document. Page breaks keep their own numbers.
+func (pb *PageBreaker) CalculateNumberedPageBreaks(node *domain.LayoutNode, pageHeight float64, numbering PageNumbering) ([]*PageBreak, error) {
+	if pageHeight <= 0 {
+		return nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "page height must be positive", domain.ErrPageBreakFailed).
+			WithDetail("page_height", pageHeight)
+	}
+
+	if node != nil {
+		state := &paginationState{pageHeight: pageHeight}
+		pb.processNode(node, state)
 	}
 
+	pageBreaks := pb.assignPages(node, pageHeight)
+	pb.resolvePageNumbers(node, pageBreaks, numbering)
 	return pageBreaks, nil
 }
 
-// processNode processes a node for page breaking
-func (pb *PageBreaker) processNode(node *domain.LayoutNode, currentPage *PageBreak, pageHeight float64, pageBreaks *[]*PageBreak) error {
-	if node == nil {
-		return nil
-	}
+// processNode shifts a node by the pending offset and resolves any break it requires
+func (pb *PageBreaker) processNode(node *domain.LayoutNode, state *paginationState) {
+	node.Box.Y += state.offset
 
-	// Check if node fits on current page
-	nodeBottom := node.Box.Y + node.Box.Height
-
-	if nodeBottom > currentPage.EndY {
-		// Node doesn't fit, need to break
-		if pb.canBreakBefore(node) {
-			// Start a new page
-			*pageBreaks = append(*pageBreaks, currentPage)
-			currentPage = &PageBreak{
-				PageNumber: len(*pageBreaks) + 1,
-				StartY:     currentPage.EndY,
-				EndY:       currentPage.EndY + pageHeight,
-				Nodes:      make([]*domain.LayoutNode, 0),
-			}
+	// Forced break before the node, unless it already starts a page
+	if pb.ShouldBreakBefore(node) && !pb.atPageStart(node.Box.Y, state.pageHeight) {
+		pb.pushToNextPage(node, state)
+	}
 
-			// Adjust node position for new page
-			node.Box.Y = currentPage.StartY + (node.Box.Y - currentPage.StartY)
-		} else {
-			// Try to break within the node
-			if err := pb.breakWithinNode(node, currentPage, pageHeight, pageBreaks); err != nil {
-				return err
-			}
+	if pb.crossesBoundary(node, state.pageHeight) {
+		switch {
+		case node.Content != "":
+			pb.breakTextNode(node, state)
+		case (len(node.Children) == 0 || pb.AvoidBreakInside(node) || IsBarcode(node)) && node.Box.Height <= state.pageHeight:
+			// Barcodes move whole, with their human-readable line
+			pb.pushToNextPage(node, state)
 		}
 	}
 
-	// Add node to current page
-	currentPage.Nodes = append(currentPage.Nodes, node)
+	// Children move with everything pushed so far; growth inside them grows this node
+	offsetBeforeChildren := state.offset
+	for i := 0; i < len(node.Children); i++ {
+		pb.processNode(node.Children[i], state)
+	}
+	node.Box.Height += state.offset - offsetBeforeChildren
 
-	// Process children
-	for _, child := range node.Children {
-		if err := pb.processNode(child, currentPage, pageHeight, pageBreaks); err != nil {
-			return err
+	// Forced break after the node pushes the following content to a new page
+	if pb.ShouldBreakAfter(node) {
+		bottom := node.Box.Y + node.Box.Height
+		if !pb.atPageStart(bottom, state.pageHeight) {
+			state.offset += pb.nextPageStart(bottom, state.pageHeight) - bottom
 		}
 	}
-
-	return nil
 }
 
-// canBreakBefore checks if a page break can occur before this node
-func (pb *PageBreaker) canBreakBefore(node *domain.LayoutNode) bool {
-	// Don't break before inline elements
-	if node.Style.Display == domain.DisplayInline {
-		return false
-	}
-
-	// Don't break in the middle of a line of text
-	if node.Content != "" && node.Parent != nil {
-		return false
-	}
+// crossesBoundary reports whether a node's box runs past the end of the page it starts on
+func (pb *PageBreaker) crossesBoundary(node *domain.LayoutNode, pageHeight float64) bool {
+	return node.Box.Y+node.Box.Height > pb.nextPageStart(node.Box.Y, pageHeight)+pageEpsilon
+}
 
-	// Allow breaks before block elements
-	return node.Style.Display == domain.DisplayBlock
+// pushToNextPage moves a node to the top of the following page
+func (pb *PageBreaker) pushToNextPage(node *domain.LayoutNode, state *paginationState) {
+	delta := pb.nextPageStart(node.Box.Y, state.pageHeight) - node.Box.Y
+	node.Box.Y += delta
+	state.offset += delta
 }
 
-// breakWithinNode attempts to break content within a node
-func (pb *PageBreaker) breakWithinNode(node *domain.LayoutNode, currentPage *PageBreak, pageHeight float64, pageBreaks *[]*PageBreak) error {
-	if node.Content != "" {
-		// Break text content
-		return pb.breakTextNode(node, currentPage, pageHeight, pageBreaks)
-	}
+// nextPageStart returns the Y coordinate where the page after y begins
+func (pb *PageBreaker) nextPageStart(y, pageHeight float64) float64 {
+	return (math.Floor((y+pageEpsilon)/pageHeight) + 1) * pageHeight
+}
 
-	// For other nodes, try to break between children
-	return pb.breakBetweenChildren(node, currentPage, pageHeight, pageBreaks)
+// atPageStart reports whether y lies on a page boundary
+func (pb *PageBreaker) atPageStart(y, pageHeight float64) bool {
+	page := math.Round(y / pageHeight)
+	return math.Abs(y-page*pageHeight) < pageEpsilon
 }
 
+// pageEpsilon absorbs floating point noise when comparing against page boundaries
+const pageEpsilon = 0.01
+
 // breakTextNode breaks a text node across pages
-func (pb *PageBreaker) breakTextNode(node *domain.LayoutNode, currentPage *PageBreak, pageHeight float64, pageBreaks *[]*PageBreak) error {
+func (pb *PageBreaker) breakTextNode(node *domain.LayoutNode, state *paginationState) {
 	// Calculate how much text fits on current page
-	availableHeight := currentPage.EndY - node.Box.Y
-	lineHeight := node.Style.Font.Size * node.Style.Text.LineHeight
+	boundary := pb.nextPageStart(node.Box.Y, state.pageHeight)
+	availableHeight := boundary - node.Box.Y
+	lineHeight := pb.textEngine.CalculateLineHeight(node.Style.Font, node.Style.Text.LineHeight)
 
-	if lineHeight <= 0 {
-		lineHeight = node.Style.Font.Size * 1.2
-	}
-
-	linesOnCurrentPage := int(availableHeight / lineHeight)
+	linesOnCurrentPage := int((availableHeight + pageEpsilon) / lineHeight)
 	if linesOnCurrentPage < 1 {
-		linesOnCurrentPage = 1
+		// Not even one line fits, so the whole node moves
+		pb.pushToNextPage(node, state)
+		return
 	}
 
 	// Split text content
-	textEngine := NewTextEngine()
-	lines := textEngine.SplitTextIntoLines(node.Content, node.Style.Font, node.Box.Width)
-
+	lines := pb.textEngine.SplitTextIntoLines(node.Content, node.Style.Font, node.Box.Width)
 	if len(lines) <= linesOnCurrentPage {
 		// All text fits on current page
-		return nil
+		return
 	}
 
-	// Split the node
+	// Update current node with first part
 	firstPartLines := lines[:linesOnCurrentPage]
 	remainingLines := lines[linesOnCurrentPage:]
-
-	// Update current node with first part
 	node.Content = joinLines(firstPartLines)
 	node.Box.Height = float64(len(firstPartLines)) * lineHeight
 
-	// Create new node for remaining content
+	// Page references follow their placeholders
+	var remainingReferences []*domain.PageReference
+	if len(node.References) > 0 {
+		split := min(strings.Count(node.Content, pageReferenceMarker), len(node.References))
+		remainingReferences = node.References[split:]
+		node.References = node.References[:split]
+	}
+
+	// Everything after the split moves down by the unused space at the bottom of the page
+	state.offset += boundary - (node.Box.Y + node.Box.Height)
+
+	// Create new node for remaining content. Its Y is expressed before the pending
+	// offset, which is added when the node is visited as the next sibling.
 	remainingNode := &domain.LayoutNode{
 		ID:      node.ID + "_continued",
 		Type:    node.Type,
@@ -146,59 +188,129 @@ func (pb *PageBreaker) breakTextNode(node *domain.LayoutNode, currentPage *PageB
 		Style:   node.Style,
 		Box: domain.Box{
 			X:      node.Box.X,
-			Y:      currentPage.EndY,
+			Y:      boundary - state.offset,
 			Width:  node.Box.Width,
 			Height: float64(len(remainingLines)) * lineHeight,
 		},
-		Parent: node.Parent,
+		Parent:     node.Parent,
+		Leader:     node.Leader, // The leader ends the last line
+		References: remainingReferences,
 	}
+	node.Leader = nil
 
-	// Add remaining node to parent
+	// Insert the remainder directly after the node so it keeps its reading order
 	if node.Parent != nil {
-		node.Parent.Children = append(node.Parent.Children, remainingNode)
+		siblings := node.Parent.Children
+		for i, sibling := range siblings {
+			if sibling == node {
+				siblings = append(siblings[:i+1], append([]*domain.LayoutNode{remainingNode}, siblings[i+1:]...)...)
+				break
+			}
+		}
+		node.Parent.Children = siblings
 	}
-
-	return nil
 }
 
-// breakBetweenChildren breaks between child nodes
-func (pb *PageBreaker) breakBetweenChildren(node *domain.LayoutNode, currentPage *PageBreak, pageHeight float64, pageBreaks *[]*PageBreak) error {
-	// Find the best break point between children
-	for i, child := range node.Children {
-		childBottom := child.Box.Y + child.Box.Height
-		if childBottom > currentPage.EndY {
-			// Break before this child
-			if i > 0 {
-				// Move this child and subsequent children to next page
-				*pageBreaks = append(*pageBreaks, currentPage)
-				newPage := &PageBreak{
-					PageNumber: len(*pageBreaks) + 1,
-					StartY:     currentPage.EndY,
-					EndY:       currentPage.EndY + pageHeight,
-					Nodes:      make([]*domain.LayoutNode, 0),
-				}
-
-				// Adjust positions of moved children
-				yOffset := newPage.StartY - child.Box.Y
-				for j := i; j < len(node.Children); j++ {
-					pb.adjustNodePosition(node.Children[j], 0, yOffset)
-				}
+// assignPages groups nodes by the pages their boxes intersect
+func (pb *PageBreaker) assignPages(root *domain.LayoutNode, pageHeight float64) []*PageBreak {
+	pageCount := 1
+	if root != nil {
+		bottom := pb.contentBottom(root)
+		if pages := int(math.Ceil((bottom - pageEpsilon) / pageHeight)); pages > pageCount {
+			pageCount = pages
+		}
+	}
+
+	pageBreaks := make([]*PageBreak, pageCount)
+	for i := range pageBreaks {
+		pageBreaks[i] = &PageBreak{
+			PageNumber: i + 1,
+			StartY:     float64(i) * pageHeight,
+			EndY:       float64(i+1) * pageHeight,
+			Nodes:      make([]*domain.LayoutNode, 0),
+		}
+	}
+
+	var walk func(node *domain.LayoutNode)
+	walk = func(node *domain.LayoutNode) {
+		first := int(math.Floor((node.Box.Y + pageEpsilon) / pageHeight))
+		last := int(math.Ceil((node.Box.Y+node.Box.Height-pageEpsilon)/pageHeight)) - 1
+		if last < first {
+			last = first
+		}
+		for i := first; i <= last; i++ {
+			if i >= 0 && i < len(pageBreaks) {
+				pageBreaks[i].Nodes = append(pageBreaks[i].Nodes, node)
 			}
-			break
 		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	if root != nil {
+		walk(root)
 	}
 
-	return nil
+	return pageBreaks
 }
 
-// adjustNodePosition recursively adjusts node positions
-func (pb *PageBreaker) adjustNodePosition(node *domain.LayoutNode, xOffset, yOffset float64) {
-	node.Box.X += xOffset
-	node.Box.Y += yOffset
+// resolvePageNumbers fills in the page numbers of leaders and of generated
+// content from the pages their targets start on. Page numbers take the room
+// the layout kept for them, so filling them in moves no content.
+func (pb *PageBreaker) resolvePageNumbers(root *domain.LayoutNode, pageBreaks []*PageBreak, numbering PageNumbering) {
+	if root == nil {
+		return
+	}
 
+	// The first element with an id is the target
+	targets := make(map[string]*domain.LayoutNode)
+	var referring []*domain.LayoutNode
+	var walk func(node *domain.LayoutNode)
+	walk = func(node *domain.LayoutNode) {
+		if id := node.Attributes["id"]; id != "" && targets[id] == nil {
+			targets[id] = node
+		}
+		if node.Leader != nil || len(node.References) > 0 {
+			referring = append(referring, node)
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	targetPage := func(id string) int {
+		if target, ok := targets[id]; ok {
+			return numbering.Page(pb.GetPageForY(pageBreaks, target.Box.Y))
+		}
+		return 0
+	}
+	for _, node := range referring {
+		if node.Leader != nil {
+			node.Leader.Page = targetPage(node.Leader.Target)
+		}
+		fillPageReferences(node, func(reference *domain.PageReference) int {
+			switch {
+			case reference.Total:
+				return numbering.Pages(pb.GetPageCount(pageBreaks))
+			case reference.Target != "":
+				return targetPage(reference.Target)
+			default:
+				return numbering.Page(pb.GetPageForY(pageBreaks, node.Box.Y))
+			}
+		})
+	}
+}
+
+// contentBottom returns the lowest edge of any box in the tree
+func (pb *PageBreaker) contentBottom(node *domain.LayoutNode) float64 {
+	bottom := node.Box.Y + node.Box.Height
 	for _, child := range node.Children {
-		pb.adjustNodePosition(child, xOffset, yOffset)
+		if childBottom := pb.contentBottom(child); childBottom > bottom {
+			bottom = childBottom
+		}
 	}
+	return bottom
 }
 
 // joinLines joins text lines back into a single string
@@ -239,6 +351,16 @@ func (pb *PageBreaker) GetNodesForPage(pageBreaks []*PageBreak, pageNumber int)
 	return nil
 }
 
+// GetPageForY returns the page number containing a layout Y coordinate
+func (pb *PageBreaker) GetPageForY(pageBreaks []*PageBreak, y float64) int {
+	for _, pageBreak := range pageBreaks {
+		if y < pageBreak.EndY-pageEpsilon {
+			return pageBreak.PageNumber
+		}
+	}
+	return pb.GetPageCount(pageBreaks)
+}
+
 // CalculatePageMargins calculates margins for a page
 func (pb *PageBreaker) CalculatePageMargins(pageOptions domain.PageOptions) domain.Margins {
 	return pageOptions.Margins
@@ -246,21 +368,20 @@ func (pb *PageBreaker) CalculatePageMargins(pageOptions domain.PageOptions) doma
 
 // ShouldBreakBefore checks if a page break should occur before an element
 func (pb *PageBreaker) ShouldBreakBefore(node *domain.LayoutNode) bool {
-	// Check for CSS page-break-before property (simplified)
-	// In a real implementation, this would check computed styles
-	return false
+	return isForcedBreak(node.Style.PageBreak.Before)
 }
 
 // ShouldBreakAfter checks if a page break should occur after an element
 func (pb *PageBreaker) ShouldBreakAfter(node *domain.LayoutNode) bool {
-	// Check for CSS page-break-after property (simplified)
-	// In a real implementation, this would check computed styles
-	return false
+	return isForcedBreak(node.Style.PageBreak.After)
 }
 
 // AvoidBreakInside checks if breaks should be avoided inside an element
 func (pb *PageBreaker) AvoidBreakInside(node *domain.LayoutNode) bool {
-	// Check for CSS page-break-inside property (simplified)
-	// In a real implementation, this would check computed styles
-	return false
+	return node.Style.PageBreak.Inside == domain.BreakAvoid
+}
+
+// isForcedBreak reports whether a break value forces a new page
+func isForcedBreak(value domain.BreakType) bool {
+	return value == domain.BreakAlways || value == domain.BreakPage
 }
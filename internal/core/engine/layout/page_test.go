@@ -0,0 +1,307 @@
+package layout
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+// block returns a box of a height holding children stacked from its top
+func block(height float64, children ...*domain.LayoutNode) *domain.LayoutNode {
+	node := &domain.LayoutNode{Type: "block", Style: *getDefaultComputedStyle(), Box: domain.Box{Width: 200, Height: height}}
+	y := 0.0
+	for _, child := range children {
+		child.Parent = node
+		shiftBoxes(child, y)
+		y += child.Box.Height
+	}
+	node.Children = children
+	return node
+}
+
+// shiftBoxes moves a node and its descendants down
+func shiftBoxes(node *domain.LayoutNode, dy float64) {
+	node.Box.Y += dy
+	for _, child := range node.Children {
+		shiftBoxes(child, dy)
+	}
+}
+
+// textLineHeight is the line height of the text nodes of the tests
+const textLineHeight = 20
+
+// textBlock returns a text node of words laid out in lines of textLineHeight
+func textBlock(content string) *domain.LayoutNode {
+	style := getDefaultComputedStyle()
+	style.Text.LineHeight = textLineHeight
+	lines := NewTextEngine().SplitTextIntoLines(content, style.Font, 200)
+	return &domain.LayoutNode{Type: "text", Style: *style, Content: content, Box: domain.Box{Width: 200, Height: float64(len(lines)) * textLineHeight}}
+}
+
+// words returns n numbered words
+func words(n int) string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = fmt.Sprintf("word%d", i+1)
+	}
+	return strings.Join(list, " ")
+}
+
+func TestCalculatePageBreaksInvalidHeight(t *testing.T) {
+	for _, height := range []float64{0, -100} {
+		if _, err := NewPageBreaker().CalculatePageBreaks(block(10), height); err == nil {
+			t.Errorf("CalculatePageBreaks() at page height %v succeeded, want an error", height)
+		}
+	}
+}
+
+func TestCalculatePageBreaksEmpty(t *testing.T) {
+	pages, err := NewPageBreaker().CalculatePageBreaks(nil, 100)
+	if err != nil {
+		t.Fatalf("CalculatePageBreaks(nil) error = %v", err)
+	}
+	if len(pages) != 1 || len(pages[0].Nodes) != 0 {
+		t.Errorf("CalculatePageBreaks(nil) = %d pages, want one empty page", len(pages))
+	}
+}
+
+func TestCalculatePageBreaksMovesBlocks(t *testing.T) {
+	tests := []struct {
+		name   string
+		build  func() (*domain.LayoutNode, []*domain.LayoutNode)
+		wantY  []float64 // Y of the children of the root after pagination
+		pages  int
+		height float64 // Height of the root after pagination
+	}{
+		{"content that fits", func() (*domain.LayoutNode, []*domain.LayoutNode) {
+			a, b := block(40), block(40)
+			return block(80, a, b), []*domain.LayoutNode{a, b}
+		}, []float64{0, 40}, 1, 80},
+		{"box straddling the boundary", func() (*domain.LayoutNode, []*domain.LayoutNode) {
+			a, b, c := block(60), block(60), block(20)
+			return block(140, a, b, c), []*domain.LayoutNode{a, b, c}
+		}, []float64{0, 100, 160}, 2, 180},
+		{"break after", func() (*domain.LayoutNode, []*domain.LayoutNode) {
+			a, b := block(30), block(30)
+			a.Style.PageBreak.After = domain.BreakPage
+			return block(60, a, b), []*domain.LayoutNode{a, b}
+		}, []float64{0, 100}, 2, 130},
+		{"break before", func() (*domain.LayoutNode, []*domain.LayoutNode) {
+			a, b := block(30), block(30)
+			b.Style.PageBreak.Before = domain.BreakAlways
+			return block(60, a, b), []*domain.LayoutNode{a, b}
+		}, []float64{0, 100}, 2, 130},
+		{"break before the first box", func() (*domain.LayoutNode, []*domain.LayoutNode) {
+			a := block(30)
+			a.Style.PageBreak.Before = domain.BreakPage
+			return block(30, a), []*domain.LayoutNode{a}
+		}, []float64{0}, 1, 30},
+		{"break after a box ending the page", func() (*domain.LayoutNode, []*domain.LayoutNode) {
+			a, b := block(100), block(30)
+			a.Style.PageBreak.After = domain.BreakPage
+			return block(130, a, b), []*domain.LayoutNode{a, b}
+		}, []float64{0, 100}, 2, 130},
+		{"box taller than a page stays", func() (*domain.LayoutNode, []*domain.LayoutNode) {
+			a, b := block(50), block(150)
+			return block(200, a, b), []*domain.LayoutNode{a, b}
+		}, []float64{0, 50}, 2, 200},
+		{"break-inside avoid moves the container", func() (*domain.LayoutNode, []*domain.LayoutNode) {
+			a, b := block(70), block(60, block(30), block(30))
+			b.Style.PageBreak.Inside = domain.BreakAvoid
+			return block(130, a, b), []*domain.LayoutNode{a, b}
+		}, []float64{0, 100}, 2, 160},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, children := tt.build()
+			pages, err := NewPageBreaker().CalculatePageBreaks(root, 100)
+			if err != nil {
+				t.Fatalf("CalculatePageBreaks() error = %v", err)
+			}
+			var got []float64
+			for _, child := range children {
+				got = append(got, child.Box.Y)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantY) {
+				t.Errorf("children at Y %v, want %v", got, tt.wantY)
+			}
+			if len(pages) != tt.pages {
+				t.Errorf("CalculatePageBreaks() = %d pages, want %d", len(pages), tt.pages)
+			}
+			if !near(root.Box.Height, tt.height) {
+				t.Errorf("root height = %v, want %v", root.Box.Height, tt.height)
+			}
+		})
+	}
+}
+
+func TestCalculatePageBreaksMovesDescendants(t *testing.T) {
+	inner := block(20)
+	container := block(60, block(40), inner)
+	container.Style.PageBreak.Inside = domain.BreakAvoid
+	root := block(130, block(70), container)
+	if _, err := NewPageBreaker().CalculatePageBreaks(root, 100); err != nil {
+		t.Fatal(err)
+	}
+	if container.Box.Y != 100 || inner.Box.Y != 140 {
+		t.Errorf("container at %v and its child at %v, want 100 and 140", container.Box.Y, inner.Box.Y)
+	}
+}
+
+func TestCalculatePageBreaksSplitsText(t *testing.T) {
+	text := textBlock(words(20))
+	lines := len(NewTextEngine().SplitTextIntoLines(text.Content, text.Style.Font, text.Box.Width))
+	if lines <= 3 || lines > 8 {
+		t.Fatalf("text has %d lines, want four to eight", lines)
+	}
+	after := block(10)
+	root := block(0, block(40), text, after)
+	root.Box.Height = 50 + text.Box.Height
+	original := text.Content
+
+	pages, err := NewPageBreaker().CalculatePageBreaks(root, 100)
+	if err != nil {
+		t.Fatalf("CalculatePageBreaks() error = %v", err)
+	}
+
+	// Three lines fit below the first block; the rest continue on the next page
+	if len(root.Children) != 4 {
+		t.Fatalf("root has %d children, want the text split in two", len(root.Children))
+	}
+	rest := root.Children[2]
+	if root.Children[1] != text || root.Children[3] != after {
+		t.Fatal("the continuation is not inserted after the text")
+	}
+	if text.Box.Height != 3*textLineHeight || rest.Box.Y != 100 || rest.Box.Height != float64(lines-3)*textLineHeight {
+		t.Errorf("split into %v at %v and %v at %v, want %d lines then %d lines at 100",
+			text.Box.Height, text.Box.Y, rest.Box.Height, rest.Box.Y, 3, lines-3)
+	}
+	if got := text.Content + " " + rest.Content; got != original {
+		t.Errorf("split text = %q, want %q", got, original)
+	}
+	if rest.Parent != root || rest.ID != text.ID+"_continued" {
+		t.Errorf("continuation = %q with parent %p, want %q in the root", rest.ID, rest.Parent, text.ID+"_continued")
+	}
+	if want := rest.Box.Y + rest.Box.Height; after.Box.Y != want {
+		t.Errorf("following block at %v, want %v", after.Box.Y, want)
+	}
+	if len(pages) != 2 {
+		t.Errorf("CalculatePageBreaks() = %d pages, want 2", len(pages))
+	}
+}
+
+func TestCalculatePageBreaksSplitsLongText(t *testing.T) {
+	text := textBlock(words(200))
+	root := block(text.Box.Height, text)
+	if _, err := NewPageBreaker().CalculatePageBreaks(root, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every page holds five lines, each continuation starting a page
+	var content []string
+	for i, child := range root.Children {
+		if want := float64(i) * 100; child.Box.Y != want {
+			t.Errorf("part %d at %v, want %v", i, child.Box.Y, want)
+		}
+		if child.Box.Height > 100 {
+			t.Errorf("part %d is %v high, taller than a page", i, child.Box.Height)
+		}
+		content = append(content, child.Content)
+	}
+	if got := strings.Join(content, " "); got != words(200) {
+		t.Errorf("split text = %q, want the original words", got)
+	}
+}
+
+func TestCalculatePageBreaksMovesTextWithoutRoom(t *testing.T) {
+	text := textBlock(words(5))
+	root := block(0, block(90), text)
+	root.Box.Height = 90 + text.Box.Height
+	if _, err := NewPageBreaker().CalculatePageBreaks(root, 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Children) != 2 || text.Box.Y != 100 || text.Content != words(5) {
+		t.Errorf("text at %v as %q in %d children, want it whole at 100", text.Box.Y, text.Content, len(root.Children))
+	}
+}
+
+func TestCalculatePageBreaksAssignsNodes(t *testing.T) {
+	a, b, c := block(80), block(150), block(10)
+	root := block(240, a, b, c)
+	pages, err := NewPageBreaker().CalculatePageBreaks(root, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]*domain.LayoutNode{{root, a, b}, {root, b}, {root, b, c}}
+	if len(pages) != len(want) {
+		t.Fatalf("CalculatePageBreaks() = %d pages, want %d", len(pages), len(want))
+	}
+	for i, page := range pages {
+		if page.PageNumber != i+1 || page.StartY != float64(i)*100 || page.EndY != float64(i+1)*100 {
+			t.Errorf("page %d = %d from %v to %v", i+1, page.PageNumber, page.StartY, page.EndY)
+		}
+		if fmt.Sprint(page.Nodes) != fmt.Sprint(want[i]) {
+			t.Errorf("page %d has %d nodes, want %d", i+1, len(page.Nodes), len(want[i]))
+		}
+	}
+}
+
+func TestGetPageForY(t *testing.T) {
+	pb := NewPageBreaker()
+	pages, _ := pb.CalculatePageBreaks(block(250), 100)
+	tests := []struct {
+		y    float64
+		want int
+	}{
+		{0, 1}, {99, 1}, {100, 2}, {199.999, 3}, {250, 3}, {1000, 3},
+	}
+	for _, tt := range tests {
+		if got := pb.GetPageForY(pages, tt.y); got != tt.want {
+			t.Errorf("GetPageForY(%v) = %d, want %d", tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestPageNumbering(t *testing.T) {
+	tests := []struct {
+		numbering        PageNumbering
+		page, count      int
+		wantPage, wantOf int
+	}{
+		{PageNumbering{}, 2, 3, 2, 3},
+		{PageNumbering{}, 0, 3, 0, 3},
+		{PageNumbering{Offset: 4}, 2, 3, 6, 7},
+		{PageNumbering{Offset: 4, Total: 10}, 1, 3, 5, 10},
+	}
+	for _, tt := range tests {
+		if got := tt.numbering.Page(tt.page); got != tt.wantPage {
+			t.Errorf("%+v.Page(%d) = %d, want %d", tt.numbering, tt.page, got, tt.wantPage)
+		}
+		if got := tt.numbering.Pages(tt.count); got != tt.wantOf {
+			t.Errorf("%+v.Pages(%d) = %d, want %d", tt.numbering, tt.count, got, tt.wantOf)
+		}
+	}
+}
+
+func TestPaginateDocument(t *testing.T) {
+	root, _ := layoutHTML(t, `<style>h1 { break-before: page }</style><p>Introduction</p><h1>One</h1><p>First</p><h1>Two</h1><p>Second</p>`)
+	pb := NewPageBreaker()
+	pages, err := pb.CalculatePageBreaks(root, 500)
+	if err != nil {
+		t.Fatalf("CalculatePageBreaks() error = %v", err)
+	}
+	if len(pages) != 3 {
+		t.Fatalf("CalculatePageBreaks() = %d pages, want 3", len(pages))
+	}
+	for page, text := range map[int]string{1: "Introduction", 2: "First", 3: "Second"} {
+		node := findNode(root, func(n *domain.LayoutNode) bool { return n.Content == text })
+		if node == nil {
+			t.Fatalf("%q not laid out", text)
+		}
+		if got := pb.GetPageForY(pages, node.Box.Y); got != page {
+			t.Errorf("%q is on page %d, want %d", text, got, page)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package layout
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/css"
+	"print-service/internal/core/engine/html"
+)
+
+// MarginEdge is the page margin running content is drawn in
+type MarginEdge string
+
+const (
+	MarginTop    MarginEdge = "top"
+	MarginBottom MarginEdge = "bottom"
+)
+
+// Classes of the elements of running content that are replaced by a value
+// on every page, named as in browser header and footer templates
+const (
+	PlaceholderPage  = "pageNumber" // Number of the page
+	PlaceholderPages = "totalPages" // Number of pages in the document
+	PlaceholderTitle = "title"      // Title of the document
+	PlaceholderDate  = "date"       // Date the document is printed
+)
+
+// RunningTemplate is content repeated in a margin of every page
+type RunningTemplate struct {
+	Edge       MarginEdge      // Margin the content is drawn in
+	Content    *html.DOMNode   // Content, with placeholder elements for the values of each page
+	Stylesheet *css.Stylesheet // Rules styling the content, nil for none
+	Images     ImageSource     // Images loaded for the content, nil when there are none
+}
+
+// RunningContent lays out the headers and footers of a document for each
+// page. It is not safe for concurrent use.
+type RunningContent struct {
+	engine    *Engine
+	templates []RunningTemplate
+	options   domain.LayoutOptions
+	title     string
+	date      string
+	warnings  []string // Warnings of the layouts so far, without repeats
+}
+
+// MarginBox is running content laid out for one page. Boxes are placed from
+// the top-left corner of the content width of the margin.
+type MarginBox struct {
+	Edge   MarginEdge           // Margin the content is drawn in
+	Nodes  []*domain.LayoutNode // Boxes in painting order, starting with the root
+	Height float64              // Height of the content in CSS pixels
+}
+
+// NewRunningContent prepares templates to be laid out at the width of the
+// layout viewport. It returns nil when there are no templates.
+func (e *Engine) NewRunningContent(templates []RunningTemplate, options domain.LayoutOptions, title, date string) *RunningContent {
+	if len(templates) == 0 {
+		return nil
+	}
+	return &RunningContent{engine: e, templates: templates, options: options, title: title, date: date}
+}
+
+// Layout lays out the running content of a page, with its placeholders
+// filled in. A nil RunningContent has none.
+func (rc *RunningContent) Layout(page, pages int) ([]MarginBox, error) {
+	if rc == nil {
+		return nil, nil
+	}
+	values := map[string]string{
+		PlaceholderPage:  strconv.Itoa(page),
+		PlaceholderPages: strconv.Itoa(pages),
+		PlaceholderTitle: rc.title,
+		PlaceholderDate:  rc.date,
+	}
+
+	boxes := make([]MarginBox, 0, len(rc.templates))
+	for _, template := range rc.templates {
+		stylesheet := template.Stylesheet
+		if stylesheet == nil {
+			stylesheet = &css.Stylesheet{}
+		}
+		root, warnings, err := rc.engine.CalculateLayout(fillPlaceholders(template.Content, nil, values), stylesheet, rc.options, template.Images)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lay out %s margin: %w", template.Edge, err)
+		}
+		for _, warning := range warnings {
+			if warning = fmt.Sprintf("%s margin: %s", template.Edge, warning); !slices.Contains(rc.warnings, warning) {
+				rc.warnings = append(rc.warnings, warning)
+			}
+		}
+
+		// Generated content can only refer to the page itself
+		box := MarginBox{Edge: template.Edge}
+		var collect func(node *domain.LayoutNode)
+		collect = func(node *domain.LayoutNode) {
+			fillPageReferences(node, func(reference *domain.PageReference) int {
+				switch {
+				case reference.Total:
+					return pages
+				case reference.Target != "":
+					return 0
+				default:
+					return page
+				}
+			})
+			box.Nodes = append(box.Nodes, node)
+			box.Height = max(box.Height, node.Box.Y+node.Box.Height)
+			for _, child := range node.Children {
+				collect(child)
+			}
+		}
+		collect(root)
+		boxes = append(boxes, box)
+	}
+	return boxes, nil
+}
+
+// Warnings returns the warnings of the pages laid out so far, each once
+func (rc *RunningContent) Warnings() []string {
+	if rc == nil {
+		return nil
+	}
+	return rc.warnings
+}
+
+// fillPlaceholders copies a template, replacing its placeholder elements by
+// their values. The values join the text around them, as the layout gives
+// every node a line of its own.
+func fillPlaceholders(node, parent *html.DOMNode, values map[string]string) *html.DOMNode {
+	filled := &html.DOMNode{Type: node.Type, Data: node.Data, Namespace: node.Namespace, Attributes: node.Attributes, Parent: parent}
+	for _, child := range node.Children {
+		next := &html.DOMNode{Type: html.TextNode, Parent: filled}
+		if value, ok := placeholderValue(child, values); ok {
+			next.Data = value
+		} else {
+			next = fillPlaceholders(child, filled, values)
+		}
+
+		if last := len(filled.Children) - 1; last >= 0 && next.Type == html.TextNode && filled.Children[last].Type == html.TextNode {
+			filled.Children[last].Data += next.Data
+			continue
+		}
+		filled.Children = append(filled.Children, next)
+	}
+	return filled
+}
+
+// placeholderValue returns the value an element stands for
+func placeholderValue(node *html.DOMNode, values map[string]string) (string, bool) {
+	if node.Type != html.ElementNode {
+		return "", false
+	}
+	for _, class := range splitClasses(node.Attributes["class"]) {
+		if value, ok := values[class]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// templateFunctionPattern matches the functions in the text of a header or footer template
+var templateFunctionPattern = regexp.MustCompile(`(?i)(counter|string)\(\s*([a-z-]+)\s*(?:,[^)]*)?\)`)
+
+// ExpandTemplateFunctions replaces counter(page), counter(pages),
+// string(title) and string(date) in the text of a header or footer template
+// with placeholder elements, as in the content of margin boxes. It returns
+// an error for any other function, which has no value in running content.
+func ExpandTemplateFunctions(node *html.DOMNode) error {
+	if node.Type == html.ElementNode && (node.Data == "style" || node.Data == "script") {
+		return nil
+	}
+	children := make([]*html.DOMNode, 0, len(node.Children))
+	for _, child := range node.Children {
+		if child.Type != html.TextNode {
+			if err := ExpandTemplateFunctions(child); err != nil {
+				return err
+			}
+			children = append(children, child)
+			continue
+		}
+
+		text := child.Data
+		for _, match := range templateFunctionPattern.FindAllStringSubmatchIndex(child.Data, -1) {
+			function := child.Data[match[0]:match[1]]
+			class, ok := marginContentValues[strings.ToLower(child.Data[match[2]:match[3]]+"("+child.Data[match[4]:match[5]]+")")]
+			if !ok {
+				return domain.NewPrintError(domain.ErrCodeInvalidInput, "header or footer function has no value", domain.ErrInvalidDocument).
+					WithDetail("function", function).
+					WithDetail("supported", "counter(page), counter(pages), string(title), string(date)")
+			}
+			before, after, _ := strings.Cut(text, function)
+			if before != "" {
+				children = append(children, &html.DOMNode{Type: html.TextNode, Data: before, Parent: node})
+			}
+			children = append(children, &html.DOMNode{Type: html.ElementNode, Data: "span", Attributes: map[string]string{"class": class}, Parent: node})
+			text = after
+		}
+		if text != "" {
+			children = append(children, &html.DOMNode{Type: html.TextNode, Data: text, Parent: node})
+		}
+	}
+	node.Children = children
+	return nil
+}
+
+// marginBoxAlignments are the margin boxes drawn, with the alignment of their text
+var marginBoxAlignments = map[string]struct {
+	Edge  MarginEdge
+	Align string
+}{
+	"top-left":      {MarginTop, "left"},
+	"top-center":    {MarginTop, "center"},
+	"top-right":     {MarginTop, "right"},
+	"bottom-left":   {MarginBottom, "left"},
+	"bottom-center": {MarginBottom, "center"},
+	"bottom-right":  {MarginBottom, "right"},
+}
+
+// MarginBoxTemplates converts the margin boxes of the @page rules that apply
+// to every page into running content. Their content property may combine
+// strings with counter(page), counter(pages), string(title) and string(date);
+// their other declarations style the box.
+func MarginBoxTemplates(stylesheet *css.Stylesheet) []RunningTemplate {
+	if stylesheet == nil {
+		return nil
+	}
+
+	// Later rules override the declarations of earlier ones for the same box
+	declarations := make(map[string][]*css.Declaration)
+	var names []string
+	for _, rule := range stylesheet.PageRules {
+		if rule.Selector != "" {
+			continue // Only rules for every page apply
+		}
+		for _, box := range rule.MarginBoxes {
+			if _, ok := marginBoxAlignments[box.Name]; !ok {
+				continue
+			}
+			if _, seen := declarations[box.Name]; !seen {
+				names = append(names, box.Name)
+			}
+			declarations[box.Name] = append(declarations[box.Name], box.Declarations...)
+		}
+	}
+
+	var templates []RunningTemplate
+	for _, name := range names {
+		placement := marginBoxAlignments[name]
+		style := []string{"text-align: " + placement.Align}
+		var content []*html.DOMNode
+		for _, decl := range declarations[name] {
+			if strings.EqualFold(decl.Property, "content") {
+				content = parseMarginContent(decl.Value)
+				continue
+			}
+			style = append(style, decl.Property+": "+decl.Value)
+		}
+		if len(content) == 0 {
+			continue
+		}
+
+		box := &html.DOMNode{Type: html.ElementNode, Data: "div", Attributes: map[string]string{"style": strings.Join(style, "; ")}}
+		for _, child := range content {
+			child.Parent = box
+		}
+		box.Children = content
+		templates = append(templates, RunningTemplate{Edge: placement.Edge, Content: box})
+	}
+	return templates
+}
+
+// marginContentPattern matches the strings and functions of a margin box's content
+var marginContentPattern = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"|'((?:[^'\\]|\\.)*)'|(?i)(counter|string)\(\s*([a-z-]+)\s*(?:,[^)]*)?\)`)
+
+// marginContentValues are the placeholders the functions of a margin box's content stand for
+var marginContentValues = map[string]string{
+	"counter(page)":  PlaceholderPage,
+	"counter(pages)": PlaceholderPages,
+	"string(title)":  PlaceholderTitle,
+	"string(date)":   PlaceholderDate,
+}
+
+// parseMarginContent converts the content property of a margin box into
+// text and placeholder elements. It returns nil for none or normal.
+func parseMarginContent(value string) []*html.DOMNode {
+	var nodes []*html.DOMNode
+	for _, match := range marginContentPattern.FindAllStringSubmatch(value, -1) {
+		switch {
+		case match[3] != "":
+			class, ok := marginContentValues[strings.ToLower(match[3]+"("+match[4]+")")]
+			if !ok {
+				continue
+			}
+			nodes = append(nodes, &html.DOMNode{Type: html.ElementNode, Data: "span", Attributes: map[string]string{"class": class}})
+		default:
+			text := match[1] + match[2]
+			nodes = append(nodes, &html.DOMNode{Type: html.TextNode, Data: cssUnescape.Replace(text)})
+		}
+	}
+	return nodes
+}
+
+// cssUnescape removes the backslashes of escaped quotes and backslashes in CSS strings
+var cssUnescape = strings.NewReplacer(`\"`, `"`, `\'`, `'`, `\\`, `\`)
@@ -0,0 +1,86 @@
+package layout
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/html"
+)
+
+// parseTemplate parses a header or footer template
+func parseTemplate(t *testing.T, content string) *html.DOMNode {
+	t.Helper()
+	dom, err := html.NewParser(html.NewSanitizer(), html.NewValidator(false)).Parse(content, domain.DefaultPrintOptions().Security)
+	if err != nil {
+		t.Fatalf("Parse(%q) error = %v", content, err)
+	}
+	return dom
+}
+
+func TestExpandTemplateFunctions(t *testing.T) {
+	values := map[string]string{PlaceholderPage: "2", PlaceholderPages: "3", PlaceholderTitle: "Report", PlaceholderDate: "2026-10-16"}
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"page of pages", "Page counter(page) of counter(pages)", "Page 2 of 3"},
+		{"title and date", "<p>string(title), string(date)</p>", "Report, 2026-10-16"},
+		{"inside elements", "<b>counter(page)</b>/<i>counter(pages)</i>", "2/3"},
+		{"case and spaces", "COUNTER( page )", "2"},
+		{"counter style", "counter(page, decimal)", "2"},
+		{"placeholder classes", `<span class="pageNumber"></span> of <span class="totalPages"></span>`, "2 of 3"},
+		{"plain text", "Confidential", "Confidential"},
+		{"style is not text", "<style>p::after { content: counter(section) }</style><p>counter(page)</p>", "p::after { content: counter(section) }2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dom := parseTemplate(t, tt.template)
+			if err := ExpandTemplateFunctions(dom); err != nil {
+				t.Fatalf("ExpandTemplateFunctions(%q) error = %v", tt.template, err)
+			}
+			if got := fillPlaceholders(dom, nil, values).TextContent(); got != tt.want {
+				t.Errorf("ExpandTemplateFunctions(%q) filled = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandTemplateFunctionsUnknown(t *testing.T) {
+	for _, template := range []string{"Chapter counter(chapter)", "<p>string(author)</p>"} {
+		if err := ExpandTemplateFunctions(parseTemplate(t, template)); err == nil {
+			t.Errorf("ExpandTemplateFunctions(%q) succeeded, want an error", template)
+		}
+	}
+}
+
+func TestRunningContentLayout(t *testing.T) {
+	footer := parseTemplate(t, "Page counter(page) of counter(pages)")
+	if err := ExpandTemplateFunctions(footer); err != nil {
+		t.Fatal(err)
+	}
+	rc := NewEngine().NewRunningContent([]RunningTemplate{{Edge: MarginBottom, Content: footer}}, domain.DefaultPrintOptions().Layout, "Report", "2026-10-16")
+	for page := 1; page <= 3; page++ {
+		boxes, err := rc.Layout(page, 3)
+		if err != nil {
+			t.Fatalf("Layout(%d, 3) error = %v", page, err)
+		}
+		if len(boxes) != 1 || boxes[0].Edge != MarginBottom || boxes[0].Height <= 0 {
+			t.Fatalf("Layout(%d, 3) = %+v, want one bottom margin box", page, boxes)
+		}
+		var text []string
+		for _, node := range boxes[0].Nodes {
+			if node.Content != "" {
+				text = append(text, node.Content)
+			}
+		}
+		if got, want := strings.Join(text, ""), "Page "+strconv.Itoa(page)+" of 3"; got != want {
+			t.Errorf("Layout(%d, 3) text = %q, want %q", page, got, want)
+		}
+	}
+	if warnings := rc.Warnings(); len(warnings) != 0 {
+		t.Errorf("Warnings() = %v, want none", warnings)
+	}
+}
@@ -0,0 +1,198 @@
+package layout
+
+import "unicode"
+
+// arabicForms lists the isolated, final, initial and medial presentation
+// forms of Arabic letters. Letters without initial and medial forms only join
+// to the preceding letter.
+var arabicForms = map[rune][4]rune{
+	0x0621: {0xFE80, 0, 0, 0},                // HAMZA
+	0x0622: {0xFE81, 0xFE82, 0, 0},           // ALEF WITH MADDA ABOVE
+	0x0623: {0xFE83, 0xFE84, 0, 0},           // ALEF WITH HAMZA ABOVE
+	0x0624: {0xFE85, 0xFE86, 0, 0},           // WAW WITH HAMZA ABOVE
+	0x0625: {0xFE87, 0xFE88, 0, 0},           // ALEF WITH HAMZA BELOW
+	0x0626: {0xFE89, 0xFE8A, 0xFE8B, 0xFE8C}, // YEH WITH HAMZA ABOVE
+	0x0627: {0xFE8D, 0xFE8E, 0, 0},           // ALEF
+	0x0628: {0xFE8F, 0xFE90, 0xFE91, 0xFE92}, // BEH
+	0x0629: {0xFE93, 0xFE94, 0, 0},           // TEH MARBUTA
+	0x062A: {0xFE95, 0xFE96, 0xFE97, 0xFE98}, // TEH
+	0x062B: {0xFE99, 0xFE9A, 0xFE9B, 0xFE9C}, // THEH
+	0x062C: {0xFE9D, 0xFE9E, 0xFE9F, 0xFEA0}, // JEEM
+	0x062D: {0xFEA1, 0xFEA2, 0xFEA3, 0xFEA4}, // HAH
+	0x062E: {0xFEA5, 0xFEA6, 0xFEA7, 0xFEA8}, // KHAH
+	0x062F: {0xFEA9, 0xFEAA, 0, 0},           // DAL
+	0x0630: {0xFEAB, 0xFEAC, 0, 0},           // THAL
+	0x0631: {0xFEAD, 0xFEAE, 0, 0},           // REH
+	0x0632: {0xFEAF, 0xFEB0, 0, 0},           // ZAIN
+	0x0633: {0xFEB1, 0xFEB2, 0xFEB3, 0xFEB4}, // SEEN
+	0x0634: {0xFEB5, 0xFEB6, 0xFEB7, 0xFEB8}, // SHEEN
+	0x0635: {0xFEB9, 0xFEBA, 0xFEBB, 0xFEBC}, // SAD
+	0x0636: {0xFEBD, 0xFEBE, 0xFEBF, 0xFEC0}, // DAD
+	0x0637: {0xFEC1, 0xFEC2, 0xFEC3, 0xFEC4}, // TAH
+	0x0638: {0xFEC5, 0xFEC6, 0xFEC7, 0xFEC8}, // ZAH
+	0x0639: {0xFEC9, 0xFECA, 0xFECB, 0xFECC}, // AIN
+	0x063A: {0xFECD, 0xFECE, 0xFECF, 0xFED0}, // GHAIN
+	0x0641: {0xFED1, 0xFED2, 0xFED3, 0xFED4}, // FEH
+	0x0642: {0xFED5, 0xFED6, 0xFED7, 0xFED8}, // QAF
+	0x0643: {0xFED9, 0xFEDA, 0xFEDB, 0xFEDC}, // KAF
+	0x0644: {0xFEDD, 0xFEDE, 0xFEDF, 0xFEE0}, // LAM
+	0x0645: {0xFEE1, 0xFEE2, 0xFEE3, 0xFEE4}, // MEEM
+	0x0646: {0xFEE5, 0xFEE6, 0xFEE7, 0xFEE8}, // NOON
+	0x0647: {0xFEE9, 0xFEEA, 0xFEEB, 0xFEEC}, // HEH
+	0x0648: {0xFEED, 0xFEEE, 0, 0},           // WAW
+	0x0649: {0xFEEF, 0xFEF0, 0xFBE8, 0xFBE9}, // ALEF MAKSURA
+	0x064A: {0xFEF1, 0xFEF2, 0xFEF3, 0xFEF4}, // YEH
+	0x0671: {0xFB50, 0xFB51, 0, 0},           // ALEF WASLA
+	0x0679: {0xFB66, 0xFB67, 0xFB68, 0xFB69}, // TTEH
+	0x067E: {0xFB56, 0xFB57, 0xFB58, 0xFB59}, // PEH
+	0x0686: {0xFB7A, 0xFB7B, 0xFB7C, 0xFB7D}, // TCHEH
+	0x0688: {0xFB88, 0xFB89, 0, 0},           // DDAL
+	0x0691: {0xFB8C, 0xFB8D, 0, 0},           // RREH
+	0x0698: {0xFB8A, 0xFB8B, 0, 0},           // JEH
+	0x06A9: {0xFB8E, 0xFB8F, 0xFB90, 0xFB91}, // KEHEH
+	0x06AF: {0xFB92, 0xFB93, 0xFB94, 0xFB95}, // GAF
+	0x06BE: {0xFBAA, 0xFBAB, 0xFBAC, 0xFBAD}, // HEH DOACHASHMEE
+	0x06C1: {0xFBA6, 0xFBA7, 0xFBA8, 0xFBA9}, // HEH GOAL
+	0x06CC: {0xFBFC, 0xFBFD, 0xFBFE, 0xFBFF}, // FARSI YEH
+	0x06D2: {0xFBAE, 0xFBAF, 0, 0},           // YEH BARREE
+}
+
+// lamAlefForms lists the isolated and final forms of the mandatory lam-alef ligatures by alef
+var lamAlefForms = map[rune][2]rune{
+	0x0622: {0xFEF5, 0xFEF6},
+	0x0623: {0xFEF7, 0xFEF8},
+	0x0625: {0xFEF9, 0xFEFA},
+	0x0627: {0xFEFB, 0xFEFC},
+}
+
+const (
+	arabicLam     = 0x0644
+	arabicTatweel = 0x0640
+	zeroWidthJoin = 0x200D
+)
+
+// joinsBefore reports whether a character connects to the character preceding it
+func joinsBefore(r rune) bool {
+	if r == arabicTatweel || r == zeroWidthJoin {
+		return true
+	}
+	_, ok := arabicForms[r]
+	return ok && r != 0x0621
+}
+
+// joinsAfter reports whether a character connects to the character following it
+func joinsAfter(r rune) bool {
+	if r == arabicTatweel || r == zeroWidthJoin {
+		return true
+	}
+	forms, ok := arabicForms[r]
+	return ok && forms[JoiningInitial-JoiningIsolated] != 0
+}
+
+// isTransparent reports whether a character is skipped when joining, such as harakat
+func isTransparent(r rune) bool {
+	return unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r)
+}
+
+// JoiningForm is the contextual form an Arabic letter takes from its neighbours
+type JoiningForm int
+
+// Joining forms, in the order of the presentation form slots of arabicForms
+const (
+	JoiningNone     JoiningForm = iota // Not a joining letter
+	JoiningIsolated                    // Joins neither neighbour
+	JoiningFinal                       // Joins the preceding letter only
+	JoiningInitial                     // Joins the following letter only
+	JoiningMedial                      // Joins both neighbours
+)
+
+// JoiningForms returns the form of each character of a run in logical
+// order, for renderers that select Arabic glyphs through the font's own
+// isol, fina, init and medi features
+func JoiningForms(text []rune) []JoiningForm {
+	forms := make([]JoiningForm, len(text))
+	for i, r := range text {
+		if _, ok := arabicForms[r]; !ok {
+			continue
+		}
+
+		before := joinsAfter(neighbour(text, i, -1)) && joinsBefore(r)
+		after := joinsAfter(r) && joinsBefore(neighbour(text, i, 1))
+		switch {
+		case before && after:
+			forms[i] = JoiningMedial
+		case before:
+			forms[i] = JoiningFinal
+		case after:
+			forms[i] = JoiningInitial
+		default:
+			forms[i] = JoiningIsolated
+		}
+	}
+	return forms
+}
+
+// neighbour finds the closest non-transparent character in a direction
+func neighbour(text []rune, i, step int) rune {
+	for j := i + step; j >= 0 && j < len(text); j += step {
+		if !isTransparent(text[j]) {
+			return text[j]
+		}
+	}
+	return 0
+}
+
+// shapeArabic replaces Arabic letters with the presentation form selected by
+// their neighbours and forms the mandatory lam-alef ligatures. Text is
+// processed in logical order; other characters pass through unchanged.
+//
+// Shaping relies on the Arabic Presentation Forms blocks rather than the
+// font's OpenType tables, so fonts must carry glyphs for those code points.
+// It is used for faces without those tables; see JoiningForms for the rest.
+func shapeArabic(text string) string {
+	runes := []rune(text)
+	if !containsArabicLetter(runes) {
+		return text
+	}
+
+	forms := JoiningForms(runes)
+	shaped := make([]rune, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if forms[i] == JoiningNone {
+			shaped = append(shaped, r)
+			continue
+		}
+
+		// Lam followed directly by alef is drawn as a single ligature
+		if r == arabicLam && i+1 < len(runes) {
+			if ligature, ok := lamAlefForms[runes[i+1]]; ok {
+				if forms[i] == JoiningFinal || forms[i] == JoiningMedial {
+					shaped = append(shaped, ligature[1])
+				} else {
+					shaped = append(shaped, ligature[0])
+				}
+				i++
+				continue
+			}
+		}
+
+		if form := arabicForms[r][forms[i]-JoiningIsolated]; form != 0 {
+			shaped = append(shaped, form)
+		} else {
+			shaped = append(shaped, r)
+		}
+	}
+
+	return string(shaped)
+}
+
+// containsArabicLetter reports whether any character has contextual forms
+func containsArabicLetter(runes []rune) bool {
+	for _, r := range runes {
+		if _, ok := arabicForms[r]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package layout
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestShapeArabic(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"latin unchanged", "abc", "abc"},
+		{"isolated letter", "ب", "\ufe8f"},
+		{"two letters", "بب", "\ufe91\ufe90"},
+		{"medial form", "ببب", "\ufe91\ufe92\ufe90"},
+		{"right-joining letter", "اب", "\ufe8d\ufe8f"},
+		{"joins to alef", "با", "\ufe91\ufe8e"},
+		{"non-joining hamza", "بء", "\ufe8f\ufe80"},
+		{"lam-alef ligature", "لا", "\ufefb"},
+		{"joined lam-alef ligature", "بلا", "\ufe91\ufefc"},
+		{"harakat are transparent", "ب\u064eب", "\ufe91\u064e\ufe90"},
+		{"tatweel joins", "بـ", "\ufe91ـ"},
+		{"zero width joiner", "ب\u200d", "\ufe91\u200d"},
+		{"words shape separately", "بب بب", "\ufe91\ufe90 \ufe91\ufe90"},
+		{"persian letters", "پی", "\ufb58\ufbfd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shapeArabic(tt.text); got != tt.want {
+				t.Errorf("shapeArabic(%q) = %+q, want %+q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoiningForms(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []JoiningForm
+	}{
+		{"latin", "ab", []JoiningForm{JoiningNone, JoiningNone}},
+		{"isolated letter", "ب", []JoiningForm{JoiningIsolated}},
+		{"three letters", "ببب", []JoiningForm{JoiningInitial, JoiningMedial, JoiningFinal}},
+		{"right-joining letter", "با", []JoiningForm{JoiningInitial, JoiningFinal}},
+		{"after right-joining letter", "اب", []JoiningForm{JoiningIsolated, JoiningIsolated}},
+		{"harakat are transparent", "ب\u064eب", []JoiningForm{JoiningInitial, JoiningNone, JoiningFinal}},
+		{"zero width joiner", "ب\u200d", []JoiningForm{JoiningInitial, JoiningNone}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := JoiningForms([]rune(tt.text)); !slices.Equal(got, tt.want) {
+				t.Errorf("JoiningForms(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
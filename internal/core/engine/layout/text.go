@@ -2,6 +2,7 @@ package layout
 
 import (
 	"strings"
+	"unicode"
 
 	"print-service/internal/core/domain"
 )
@@ -69,7 +70,7 @@ func (te *TextEngine) calculateTextMetrics(text string, font domain.FontStyle, c
 	// Calculate maximum line width
 	maxWidth := 0.0
 	for _, line := range lines {
-		lineWidth := float64(len(line)) * avgCharWidth
+		lineWidth := textUnits(line) * avgCharWidth
 		if lineWidth > maxWidth {
 			maxWidth = lineWidth
 		}
@@ -108,6 +109,23 @@ func (te *TextEngine) estimateCharWidth(font domain.FontStyle) float64 {
 	return baseWidth * weightMultiplier * familyMultiplier
 }
 
+// wideCharUnits is the width of a full-width CJK character in average character widths
+const wideCharUnits = 1.0 / 0.6
+
+// textUnits measures text in average character widths, counting characters
+// rather than bytes so multi-byte scripts are not overestimated
+func textUnits(text string) float64 {
+	units := 0.0
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			units += wideCharUnits
+		} else {
+			units++
+		}
+	}
+	return units
+}
+
 // wrapWords wraps words to fit within the specified constraints
 func (te *TextEngine) wrapWords(words []string, charsPerLine int, avgCharWidth, containerWidth float64) []string {
 	if len(words) == 0 {
@@ -126,7 +144,7 @@ func (te *TextEngine) wrapWords(words []string, charsPerLine int, avgCharWidth,
 		testLine += word
 
 		// Estimate line width
-		lineWidth := float64(len(testLine)) * avgCharWidth
+		lineWidth := textUnits(testLine) * avgCharWidth
 
 		if lineWidth <= containerWidth || currentLine == "" {
 			// Word fits on current line or it's the first word
@@ -155,7 +173,7 @@ func (te *TextEngine) CalculateTextPosition(node *domain.LayoutNode) (x, y float
 	y = node.Box.Y + node.Style.Padding.Top
 
 	// Adjust for text alignment
-	switch node.Style.Text.Align {
+	switch te.ResolveAlign(node.Style.Text) {
 	case domain.TextAlignCenter:
 		// Center horizontally
 		contentWidth := node.Box.Width - node.Style.Padding.Left - node.Style.Padding.Right
@@ -177,7 +195,13 @@ func (te *TextEngine) CalculateTextPosition(node *domain.LayoutNode) (x, y float
 // estimateTextWidth estimates the total width of text
 func (te *TextEngine) estimateTextWidth(text string, font domain.FontStyle) float64 {
 	avgCharWidth := te.estimateCharWidth(font)
-	return float64(len(text)) * avgCharWidth
+	return textUnits(text) * avgCharWidth
+}
+
+// EstimateTextWidth estimates the width of text in CSS pixels, as the layout
+// does when breaking lines
+func (te *TextEngine) EstimateTextWidth(text string, font domain.FontStyle) float64 {
+	return te.estimateTextWidth(text, font)
 }
 
 // SplitTextIntoLines splits text into lines that fit within the given width
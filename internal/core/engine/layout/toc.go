@@ -0,0 +1,219 @@
+package layout
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/html"
+)
+
+// Names and attributes of the table of contents
+const (
+	tocElement         = "toc"             // Placeholder replaced by the table of contents
+	tocDepthAttribute  = "depth"           // Lowest heading rank listed, 1 to 6
+	tocTargetAttribute = "data-toc-target" // id of the heading an entry ends with the page number of
+	tocLabelAttribute  = "data-toc-label"  // Replaces the heading text in its entry
+	noTOCAttribute     = "data-no-toc"     // Leaves a heading out of the table of contents
+)
+
+// defaultTOCDepth lists h1 to h3 when the toc element has no depth
+const defaultTOCDepth = 3
+
+// tocIndent indents the entries of each level below the top one, in CSS pixels
+const tocIndent = 24
+
+// tocLeaderFill is repeated between an entry and its page number
+const tocLeaderFill = "."
+
+// tocHeadingRanks maps heading elements to their rank
+var tocHeadingRanks = map[string]int{"h1": 1, "h2": 2, "h3": 3, "h4": 4, "h5": 5, "h6": 6}
+
+// InsertTableOfContents replaces every toc element of a document with a
+// table of contents of its headings. When the document has none and always
+// is set, one is inserted at the start of the body.
+//
+// Each entry is a link to its heading followed by the heading's page number,
+// which is filled in once the layout is paginated. Headings without an id are
+// given one. Headings with data-no-toc are left out and data-toc-label
+// replaces the heading text. Entries carry the classes toc-entry and
+// toc-level-N for styling.
+func InsertTableOfContents(document *html.DOMNode, always bool) {
+	if document == nil {
+		return
+	}
+
+	placeholders := document.GetElementsByTagName(tocElement)
+	if len(placeholders) == 0 {
+		if !always {
+			return
+		}
+		placeholder := &html.DOMNode{Type: html.ElementNode, Data: tocElement, Attributes: map[string]string{}}
+		insertFirst(tocContainer(document), placeholder)
+		placeholders = append(placeholders, placeholder)
+	}
+
+	headings := tocHeadings(document)
+	for _, placeholder := range placeholders {
+		replaceNode(placeholder, buildTableOfContents(placeholder, headings))
+	}
+}
+
+// tocHeading is a heading listed in the table of contents
+type tocHeading struct {
+	id    string
+	rank  int
+	label string
+}
+
+// tocHeadings collects the headings of a document in document order, giving
+// those without an id a unique one
+func tocHeadings(document *html.DOMNode) []tocHeading {
+	ids := make(map[string]bool)
+	var collectIDs func(node *html.DOMNode)
+	collectIDs = func(node *html.DOMNode) {
+		if id := node.Attributes["id"]; id != "" {
+			ids[id] = true
+		}
+		for _, child := range node.Children {
+			collectIDs(child)
+		}
+	}
+	collectIDs(document)
+
+	var headings []tocHeading
+	var walk func(node *html.DOMNode)
+	walk = func(node *html.DOMNode) {
+		if node.Type != html.ElementNode && node.Type != html.DocumentNode {
+			return
+		}
+		name := strings.ToLower(node.Data)
+		switch name {
+		case tocElement, "head", "template":
+			return
+		}
+
+		if rank, ok := tocHeadingRanks[name]; ok {
+			if _, skip := node.Attributes[noTOCAttribute]; skip {
+				return
+			}
+			label, ok := node.Attributes[tocLabelAttribute]
+			if !ok {
+				label = node.TextContent()
+			}
+			if label = strings.Join(strings.Fields(label), " "); label == "" {
+				return
+			}
+
+			id := node.Attributes["id"]
+			for n := len(headings) + 1; id == ""; n++ {
+				if candidate := fmt.Sprintf("toc-%d", n); !ids[candidate] {
+					id = candidate
+					ids[id] = true
+					node.SetAttribute("id", id)
+				}
+			}
+			headings = append(headings, tocHeading{id: id, rank: rank, label: label})
+			return // Headings do not nest
+		}
+
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(document)
+
+	return headings
+}
+
+// buildTableOfContents creates the table of contents a toc element stands
+// for. Levels follow the heading ranks, with skipped ranks collapsed as in
+// the document outline.
+func buildTableOfContents(placeholder *html.DOMNode, headings []tocHeading) *html.DOMNode {
+	depth := defaultTOCDepth
+	if value, err := strconv.Atoi(strings.TrimSpace(placeholder.Attributes[tocDepthAttribute])); err == nil && value >= 1 && value <= 6 {
+		depth = value
+	}
+
+	attributes := map[string]string{"class": strings.TrimSpace("toc " + placeholder.Attributes["class"])}
+	for _, name := range []string{"id", "style", "lang", "dir"} {
+		if value, ok := placeholder.Attributes[name]; ok {
+			attributes[name] = value
+		}
+	}
+	nav := &html.DOMNode{Type: html.ElementNode, Data: "nav", Attributes: attributes}
+
+	var ranks []int // Ranks of the open ancestors of the next entry
+	for _, heading := range headings {
+		if heading.rank > depth {
+			continue
+		}
+		for len(ranks) > 0 && ranks[len(ranks)-1] >= heading.rank {
+			ranks = ranks[:len(ranks)-1]
+		}
+		level := len(ranks)
+		ranks = append(ranks, heading.rank)
+
+		entry := &html.DOMNode{
+			Type: html.ElementNode,
+			Data: "a",
+			Attributes: map[string]string{
+				"class":            fmt.Sprintf("toc-entry toc-level-%d", level+1),
+				"href":             "#" + heading.id,
+				tocTargetAttribute: heading.id,
+				"style":            fmt.Sprintf("padding-left: %dpx", level*tocIndent),
+			},
+			Parent: nav,
+		}
+		entry.Children = []*html.DOMNode{{Type: html.TextNode, Data: heading.label, Parent: entry}}
+		nav.Children = append(nav.Children, entry)
+	}
+	return nav
+}
+
+// tocContainer returns the element a table of contents is inserted into
+// when the document has no toc element: the body, or the document itself
+func tocContainer(document *html.DOMNode) *html.DOMNode {
+	if bodies := document.GetElementsByTagName("body"); len(bodies) > 0 {
+		return bodies[0]
+	}
+	return document
+}
+
+// insertFirst makes a node the first child of a parent
+func insertFirst(parent, node *html.DOMNode) {
+	node.Parent = parent
+	parent.Children = append([]*html.DOMNode{node}, parent.Children...)
+}
+
+// replaceNode puts a node in the place of another
+func replaceNode(old, node *html.DOMNode) {
+	if old.Parent == nil {
+		return
+	}
+	node.Parent = old.Parent
+	for i, child := range old.Parent.Children {
+		if child == old {
+			old.Parent.Children[i] = node
+			return
+		}
+	}
+}
+
+// tocLeader returns the page number leader ending the text of a table of
+// contents entry, or nil for other text. Room is kept for four digits.
+func (e *Engine) tocLeader(domNode *html.DOMNode, font domain.FontStyle) *domain.Leader {
+	if domNode.Type != html.TextNode || domNode.Parent == nil {
+		return nil
+	}
+	target := domNode.Parent.Attributes[tocTargetAttribute]
+	if target == "" {
+		return nil
+	}
+	return &domain.Leader{
+		Target: target,
+		Fill:   tocLeaderFill,
+		Width:  e.textEngine.estimateTextWidth(" 0000", font),
+	}
+}
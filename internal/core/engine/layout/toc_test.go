@@ -0,0 +1,150 @@
+package layout
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/css"
+	"print-service/internal/core/engine/html"
+)
+
+// tocEntries describes the entries of the tables of contents of a document
+// as level, target and label
+func tocEntries(document *html.DOMNode) []string {
+	var entries []string
+	for _, entry := range document.GetElementsByClassName("toc-entry") {
+		level := strings.TrimPrefix(strings.Fields(entry.Attributes["class"])[1], "toc-level-")
+		entries = append(entries, fmt.Sprintf("%s %s %s", level, entry.Attributes["href"], entry.TextContent()))
+	}
+	return entries
+}
+
+func TestInsertTableOfContents(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		always   bool
+		want     []string
+		wantTOCs int
+	}{
+		{"levels", `<toc></toc><h1 id="a">A</h1><h2 id="b">B</h2><h3 id="c">C</h3><h2 id="d">D</h2><h1 id="e">E</h1>`, false,
+			[]string{"1 #a A", "2 #b B", "3 #c C", "2 #d D", "1 #e E"}, 1},
+		{"skipped ranks collapse", `<toc></toc><h1 id="a">A</h1><h3 id="b">B</h3><h2 id="c">C</h2>`, false,
+			[]string{"1 #a A", "2 #b B", "2 #c C"}, 1},
+		{"default depth", `<toc></toc><h1 id="a">A</h1><h4 id="b">B</h4>`, false,
+			[]string{"1 #a A"}, 1},
+		{"depth attribute", `<toc depth="1"></toc><h1 id="a">A</h1><h2 id="b">B</h2>`, false,
+			[]string{"1 #a A"}, 1},
+		{"excluded and relabelled", `<toc></toc><h1 id="a" data-no-toc>A</h1><h1 id="b" data-toc-label="Short">A long heading</h1>`, false,
+			[]string{"1 #b Short"}, 1},
+		{"white space and empty headings", `<toc></toc><h1 id="a">  Two
+			words </h1><h1></h1>`, false,
+			[]string{"1 #a Two words"}, 1},
+		{"ids assigned", `<toc></toc><p id="toc-1"></p><h1>A</h1><h2>B</h2>`, false,
+			[]string{"1 #toc-2 A", "2 #toc-3 B"}, 1},
+		{"no toc element", `<h1 id="a">A</h1>`, false, nil, 0},
+		{"inserted when always", `<p>Intro</p><h1 id="a">A</h1>`, true, []string{"1 #a A"}, 1},
+		{"every toc element", `<toc></toc><h1 id="a">A</h1><toc depth="1"></toc>`, false,
+			[]string{"1 #a A", "1 #a A"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document := parseTemplate(t, tt.content)
+			InsertTableOfContents(document, tt.always)
+			if got := tocEntries(document); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+			if got := len(document.GetElementsByTagName("nav")); got != tt.wantTOCs {
+				t.Errorf("%d tables of contents, want %d", got, tt.wantTOCs)
+			}
+			if len(document.GetElementsByTagName(tocElement)) != 0 {
+				t.Error("toc element left in the document")
+			}
+			for _, entry := range document.GetElementsByClassName("toc-entry") {
+				target := strings.TrimPrefix(entry.Attributes["href"], "#")
+				if document.GetElementByID(target) == nil || entry.Attributes[tocTargetAttribute] != target {
+					t.Errorf("entry %q links to %q, which has no heading", entry.TextContent(), target)
+				}
+			}
+		})
+	}
+}
+
+func TestInsertTableOfContentsAtStart(t *testing.T) {
+	document := parseTemplate(t, `<p>Intro</p><h1>A</h1>`)
+	InsertTableOfContents(document, true)
+	body := document.GetElementsByTagName("body")[0]
+	if len(body.Children) == 0 || body.Children[0].Data != "nav" || body.Children[0].Parent != body {
+		t.Errorf("first element of the body = %v, want the table of contents", body.Children[0])
+	}
+}
+
+// tocLeaders lays out and paginates a document with its table of contents
+// and returns the page number of each entry
+func tocLeaders(t *testing.T, content string, numbering PageNumbering) map[string]int {
+	t.Helper()
+	document := parseTemplate(t, content)
+	InsertTableOfContents(document, false)
+	root, _, err := NewEngine().CalculateLayout(document, &css.Stylesheet{}, domain.DefaultPrintOptions().Layout, nil)
+	if err != nil {
+		t.Fatalf("CalculateLayout() error = %v", err)
+	}
+	if _, err := NewPageBreaker().CalculateNumberedPageBreaks(root, 300, numbering); err != nil {
+		t.Fatalf("CalculateNumberedPageBreaks() error = %v", err)
+	}
+
+	pages := make(map[string]int)
+	var walk func(node *domain.LayoutNode, text string) string
+	walk = func(node *domain.LayoutNode, text string) string {
+		if node.Content != "" {
+			text = strings.TrimSpace(text + " " + node.Content)
+		}
+		if node.Leader != nil {
+			if node.Leader.Fill != tocLeaderFill || node.Leader.Width <= 0 {
+				t.Errorf("leader of %q = %+v, want dots with room for the number", text, node.Leader)
+			}
+			pages[text] = node.Leader.Page
+			text = ""
+		}
+		for _, child := range node.Children {
+			text = walk(child, text)
+		}
+		return text
+	}
+	walk(root, "")
+	return pages
+}
+
+func TestTableOfContentsPageNumbers(t *testing.T) {
+	const chapters = `<toc></toc>
+		<h1 id="one" style="break-before: page">One</h1><p>Text</p>
+		<h2 id="two">Two</h2>
+		<h1 id="three" style="break-before: page">Three</h1>
+		<p style="height: 400px">Tall</p>
+		<h2 id="four">Four</h2>`
+	tests := []struct {
+		name      string
+		numbering PageNumbering
+		want      map[string]int
+	}{
+		{"standalone", PageNumbering{}, map[string]int{"One": 2, "Two": 2, "Three": 3, "Four": 4}},
+		{"part of a larger document", PageNumbering{Offset: 10, Total: 20}, map[string]int{"One": 12, "Two": 12, "Three": 13, "Four": 14}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tocLeaders(t, chapters, tt.numbering); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("entry pages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableOfContentsLongEntry(t *testing.T) {
+	label := words(30)
+	got := tocLeaders(t, `<toc></toc><h1 id="a" style="break-before: page">`+label+`</h1>`, PageNumbering{})
+	if len(got) != 1 || got[label] != 2 {
+		t.Errorf("entry pages = %v, want the whole label on page 2", got)
+	}
+}
@@ -0,0 +1,178 @@
+package render
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/layout"
+)
+
+// maxBackgroundTiles limits the copies of a repeated background image drawn
+// for one element, so a tiny pattern cannot blow up the output
+const maxBackgroundTiles = 10000
+
+// backgroundPlacement is where the copies of a background image are drawn,
+// in CSS pixels
+type backgroundPlacement struct {
+	Area    domain.Box // Padding box the image is positioned in and clipped to
+	Tile    domain.Box // One copy of the image, positioned by background-position
+	RepeatX bool       // Copies repeat horizontally
+	RepeatY bool       // Copies repeat vertically
+}
+
+// resolveBackground places the background image of an element in its
+// padding box. ok is false when there is nothing to draw.
+func resolveBackground(bg domain.Background, area domain.Box) (placement backgroundPlacement, ok bool) {
+	img := bg.Loaded
+	if img == nil || img.Width <= 0 || img.Height <= 0 || area.Width <= 0 || area.Height <= 0 {
+		return placement, false
+	}
+
+	w, h := backgroundSize(bg.Size, float64(img.Width), float64(img.Height), area)
+	if w <= 0 || h <= 0 {
+		return placement, false
+	}
+	x, y := backgroundPosition(bg.Position, w, h, area)
+
+	placement = backgroundPlacement{
+		Area: area,
+		Tile: domain.Box{X: x, Y: y, Width: w, Height: h},
+	}
+	switch bg.Repeat {
+	case "no-repeat":
+	case "repeat-x":
+		placement.RepeatX = true
+	case "repeat-y":
+		placement.RepeatY = true
+	default:
+		placement.RepeatX, placement.RepeatY = true, true
+	}
+	return placement, true
+}
+
+// Tiles returns the copies of the image that overlap the area
+func (p backgroundPlacement) Tiles() []domain.Box {
+	xs := tileOffsets(p.Tile.X, p.Tile.Width, p.Area.X, p.Area.Width, p.RepeatX)
+	ys := tileOffsets(p.Tile.Y, p.Tile.Height, p.Area.Y, p.Area.Height, p.RepeatY)
+
+	var tiles []domain.Box
+	for _, y := range ys {
+		for _, x := range xs {
+			if len(tiles) == maxBackgroundTiles {
+				return tiles
+			}
+			tiles = append(tiles, domain.Box{X: x, Y: y, Width: p.Tile.Width, Height: p.Tile.Height})
+		}
+	}
+	return tiles
+}
+
+// tileOffsets returns the starts of the copies along one axis that overlap
+// the area from start to start+length
+func tileOffsets(pos, size, start, length float64, repeat bool) []float64 {
+	if !repeat {
+		if pos+size <= start || pos >= start+length {
+			return nil
+		}
+		return []float64{pos}
+	}
+	var offsets []float64
+	for offset := pos - math.Ceil((pos-start)/size)*size; offset < start+length && len(offsets) < maxBackgroundTiles; offset += size {
+		offsets = append(offsets, offset)
+	}
+	return offsets
+}
+
+// backgroundSize resolves background-size to the size of one copy of the image
+func backgroundSize(value string, iw, ih float64, area domain.Box) (float64, float64) {
+	switch value {
+	case "cover":
+		scale := math.Max(area.Width/iw, area.Height/ih)
+		return iw * scale, ih * scale
+	case "contain":
+		scale := math.Min(area.Width/iw, area.Height/ih)
+		return iw * scale, ih * scale
+	}
+
+	parts := strings.Fields(value)
+	w, h := -1.0, -1.0 // auto
+	if len(parts) > 0 {
+		w = backgroundLength(parts[0], area.Width)
+	}
+	if len(parts) > 1 {
+		h = backgroundLength(parts[1], area.Height)
+	}
+
+	// A missing dimension keeps the aspect ratio of the image
+	switch {
+	case w < 0 && h < 0:
+		return iw, ih
+	case w < 0:
+		return h * iw / ih, h
+	case h < 0:
+		return w, w * ih / iw
+	}
+	return w, h
+}
+
+// backgroundPosition resolves background-position to the top-left corner of
+// the copy of the image it positions
+func backgroundPosition(value string, w, h float64, area domain.Box) (float64, float64) {
+	parts := strings.Fields(value)
+
+	// Keywords may come in either order; a single keyword centers the other axis
+	horizontal, vertical := "0%", "0%"
+	switch len(parts) {
+	case 0:
+	case 1:
+		horizontal, vertical = parts[0], "center"
+		if parts[0] == "top" || parts[0] == "bottom" {
+			horizontal, vertical = "center", parts[0]
+		}
+	default:
+		horizontal, vertical = parts[0], parts[1]
+		if horizontal == "top" || horizontal == "bottom" || vertical == "left" || vertical == "right" {
+			horizontal, vertical = vertical, horizontal
+		}
+	}
+
+	return area.X + backgroundOffset(horizontal, area.Width-w),
+		area.Y + backgroundOffset(vertical, area.Height-h)
+}
+
+// backgroundOffset resolves one background-position value against the space
+// left between the image and the area
+func backgroundOffset(value string, space float64) float64 {
+	switch value {
+	case "left", "top":
+		return 0
+	case "center":
+		return space / 2
+	case "right", "bottom":
+		return space
+	}
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		return space * parsePercent(percent)
+	}
+	return layout.ParseLength(value)
+}
+
+// backgroundLength resolves a background-size length against the area,
+// returning -1 for auto
+func backgroundLength(value string, size float64) float64 {
+	if value == "auto" {
+		return -1
+	}
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		return size * parsePercent(percent)
+	}
+	return layout.ParseLength(value)
+}
+
+// parsePercent converts the number of a percentage to a fraction
+func parsePercent(number string) float64 {
+	percent, _ := strconv.ParseFloat(number, 64)
+	return percent / 100
+}
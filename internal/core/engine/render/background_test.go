@@ -0,0 +1,128 @@
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+func TestBackgroundSize(t *testing.T) {
+	area := domain.Box{Width: 200, Height: 100}
+	tests := []struct {
+		value string
+		w, h  float64
+	}{
+		{"", 40, 20},
+		{"auto", 40, 20},
+		{"cover", 200, 100},
+		{"contain", 200, 100},
+		{"80px", 80, 40},
+		{"auto 50px", 100, 50},
+		{"50% 25%", 100, 25},
+	}
+	for _, tt := range tests {
+		if w, h := backgroundSize(tt.value, 40, 20, area); !near(w, tt.w) || !near(h, tt.h) {
+			t.Errorf("backgroundSize(%q) = %gx%g, want %gx%g", tt.value, w, h, tt.w, tt.h)
+		}
+	}
+
+	// cover fills the area and contain fits inside it
+	if w, h := backgroundSize("cover", 10, 10, area); w != 200 || h != 200 {
+		t.Errorf("backgroundSize(cover) of a square = %gx%g, want 200x200", w, h)
+	}
+	if w, h := backgroundSize("contain", 10, 10, area); w != 100 || h != 100 {
+		t.Errorf("backgroundSize(contain) of a square = %gx%g, want 100x100", w, h)
+	}
+}
+
+func TestBackgroundPosition(t *testing.T) {
+	area := domain.Box{X: 10, Y: 20, Width: 200, Height: 100}
+	tests := []struct {
+		value string
+		x, y  float64
+	}{
+		{"", 10, 20},
+		{"center", 90, 60},
+		{"top", 90, 20},
+		{"right", 170, 60},
+		{"bottom left", 10, 100},
+		{"left bottom", 10, 100},
+		{"100% 50%", 170, 60},
+		{"15px 5px", 25, 25},
+	}
+	for _, tt := range tests {
+		if x, y := backgroundPosition(tt.value, 40, 20, area); !near(x, tt.x) || !near(y, tt.y) {
+			t.Errorf("backgroundPosition(%q) = (%g, %g), want (%g, %g)", tt.value, x, y, tt.x, tt.y)
+		}
+	}
+}
+
+func TestBackgroundTiles(t *testing.T) {
+	tile := &domain.Image{Width: 30, Height: 20}
+	area := domain.Box{Width: 100, Height: 50}
+	tests := []struct {
+		repeat   string
+		position string
+		tiles    int
+		first    domain.Box
+	}{
+		{"repeat", "", 4 * 3, domain.Box{X: 0, Y: 0, Width: 30, Height: 20}},
+		{"repeat", "center", 5 * 3, domain.Box{X: -25, Y: -5, Width: 30, Height: 20}},
+		{"repeat-x", "", 4, domain.Box{X: 0, Y: 0, Width: 30, Height: 20}},
+		{"repeat-y", "right", 3, domain.Box{X: 70, Y: -5, Width: 30, Height: 20}},
+		{"no-repeat", "bottom right", 1, domain.Box{X: 70, Y: 30, Width: 30, Height: 20}},
+	}
+	for _, tt := range tests {
+		placement, ok := resolveBackground(domain.Background{Loaded: tile, Repeat: tt.repeat, Position: tt.position}, area)
+		if !ok {
+			t.Fatalf("resolveBackground(%s %s) has nothing to draw", tt.repeat, tt.position)
+		}
+		tiles := placement.Tiles()
+		if len(tiles) != tt.tiles || tiles[0] != tt.first {
+			t.Errorf("%s %s: %d tiles from %+v, want %d from %+v", tt.repeat, tt.position, len(tiles), tiles[0], tt.tiles, tt.first)
+		}
+	}
+
+	if _, ok := resolveBackground(domain.Background{Repeat: "repeat"}, area); ok {
+		t.Error("resolveBackground() without an image has something to draw")
+	}
+	placement, _ := resolveBackground(domain.Background{Loaded: &domain.Image{Width: 1, Height: 1}, Size: "0.01px"}, domain.Box{Width: 1000, Height: 1000})
+	if n := len(placement.Tiles()); n != maxBackgroundTiles {
+		t.Errorf("%d tiles of a tiny pattern, want the limit of %d", n, maxBackgroundTiles)
+	}
+}
+
+func TestImageRendererBackgroundImage(t *testing.T) {
+	// A 2x2 pattern with one red pixel, tiled across a box
+	pattern := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	for i := range pattern.Pix {
+		pattern.Pix[i] = 255
+	}
+	pattern.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	png.Encode(&buf, pattern)
+	uri := "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	options := domain.DefaultPrintOptions()
+	options.Output.Format = domain.FormatPNG
+	content := `<div style="width: 200px; height: 100px; background-image: url('` + uri + `'); background-size: 20px 20px"></div>`
+	img, err := png.Decode(bytes.NewReader(renderTestImage(t, content, options).Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A quarter of every tile is red; the scaled pattern blends into the
+	// white around it, so at least that much of the box is tinted and
+	// nothing outside it is
+	tinted := countPixels(img, func(c color.NRGBA) bool { return c.R > 200 && c.G < 240 && c.G == c.B })
+	box := ImageRenderContext{DPI: float64(options.Layout.DPI), Scale: 1}
+	area := int(box.Length(200) * box.Length(100))
+	if tinted < area/4 || tinted > area*11/10 {
+		t.Errorf("%d tinted pixels, want between a quarter and all of the %d in the box", tinted, area)
+	}
+}
@@ -0,0 +1,280 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// resolveColorProfile maps a requested color profile to a PDF output color
+// space, keeping the renderer default when none is requested
+func resolveColorProfile(requested domain.ColorProfile, fallback ColorProfile) (ColorProfile, error) {
+	switch requested {
+	case "":
+		return fallback, nil
+	case domain.ColorProfileRGB, domain.ColorProfilesRGB:
+		return ColorProfileRGB, nil
+	case domain.ColorProfileCMYK:
+		return ColorProfileCMYK, nil
+	case domain.ColorProfileGray:
+		return ColorProfileGray, nil
+	}
+	return "", domain.NewPrintError(domain.ErrCodeInvalidInput, "unsupported color profile", domain.ErrUnsupportedFormat).
+		WithDetail("color_profile", requested)
+}
+
+// colorConverter maps colors to the operators and image samples of the
+// output color space
+type colorConverter struct {
+	profile   ColorProfile
+	transform *iccTransform // RGB to CMYK through the output profile, nil for the device formula
+}
+
+// newColorConverter creates a converter for a color space. CMYK colors are
+// converted through outputProfile when it is a CMYK profile with a usable table.
+func newColorConverter(profile ColorProfile, outputProfile []byte) *colorConverter {
+	c := &colorConverter{profile: profile}
+	if profile == ColorProfileCMYK && iccColorSpace(outputProfile) == iccSpaceCMYK {
+		c.transform = newICCTransform(outputProfile)
+	}
+	return c
+}
+
+// convert returns the components of an 8-bit RGB color in the output space
+func (c *colorConverter) convert(r, g, b uint8) []float64 {
+	switch c.profile {
+	case ColorProfileGray:
+		// Rec. 601 luma, which keeps the contrast of text on colored backgrounds
+		return []float64{(0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 255}
+	case ColorProfileCMYK:
+		if r == g && g == b {
+			// Neutral colors are printed with black ink alone
+			return []float64{0, 0, 0, 1 - float64(r)/255}
+		}
+		if c.transform != nil {
+			return c.transform.Convert(r, g, b)
+		}
+		return deviceCMYK(r, g, b)
+	default:
+		return []float64{float64(r) / 255, float64(g) / 255, float64(b) / 255}
+	}
+}
+
+// deviceCMYK converts RGB to CMYK with full black generation
+func deviceCMYK(r, g, b uint8) []float64 {
+	rf, gf, bf := float64(r)/255, float64(g)/255, float64(b)/255
+	k := 1 - math.Max(rf, math.Max(gf, bf))
+	if k == 1 {
+		return []float64{0, 0, 0, 1}
+	}
+	return []float64{(1 - rf - k) / (1 - k), (1 - gf - k) / (1 - k), (1 - bf - k) / (1 - k), k}
+}
+
+// operator returns the content stream operator that selects a color for
+// filling, or for stroking when stroke is set
+func (c *colorConverter) operator(col domain.Color, stroke bool) string {
+	values := c.convert(col.R, col.G, col.B)
+	parts := make([]string, 0, len(values)+1)
+	for _, v := range values {
+		parts = append(parts, strconv.FormatFloat(math.Max(0, math.Min(1, v)), 'f', 3, 64))
+	}
+
+	op := map[ColorProfile]string{ColorProfileGray: "g", ColorProfileCMYK: "k"}[c.profile]
+	if op == "" {
+		op = "rg"
+	}
+	if stroke {
+		op = strings.ToUpper(op)
+	}
+	return strings.Join(append(parts, op), " ")
+}
+
+// deviceSpace returns the PDF device color space of the output
+func (c *colorConverter) deviceSpace() string {
+	switch c.profile {
+	case ColorProfileGray:
+		return "/DeviceGray"
+	case ColorProfileCMYK:
+		return "/DeviceCMYK"
+	default:
+		return "/DeviceRGB"
+	}
+}
+
+// SetFill selects the color used to fill shapes and text
+func (ctx RenderContext) SetFill(col domain.Color) {
+	ctx.PDF.RawWriteStr(ctx.Colors.operator(col, false))
+}
+
+// SetStroke selects the color used to stroke lines
+func (ctx RenderContext) SetStroke(col domain.Color) {
+	ctx.PDF.RawWriteStr(ctx.Colors.operator(col, true))
+}
+
+// setBlendingSpace makes the transparency groups of pages blend in the output
+// color space instead of the DeviceRGB gofpdf always declares
+func setBlendingSpace(update *pdfUpdate, colors *colorConverter) error {
+	if colors.profile == ColorProfileRGB {
+		return nil
+	}
+
+	pages, err := update.Pages()
+	if err != nil {
+		return err
+	}
+	for _, page := range pages {
+		body, err := update.Object(page)
+		if err != nil {
+			return err
+		}
+		if dictValue(body, "/Group") == "" {
+			continue
+		}
+		group := "<</Type /Group /S /Transparency /CS " + colors.deviceSpace() + ">>"
+		if err := update.SetEntries(page, map[string]string{"/Group": group}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pdfImageSet holds images drawn in a non-RGB output color space. gofpdf
+// embeds images only as given, so converted images are written afterwards.
+type pdfImageSet struct {
+	colors *colorConverter
+	ids    []string
+	images map[string]image.Image
+}
+
+// newPDFImageSet creates an empty image set converting to the output color space
+func newPDFImageSet(colors *colorConverter) *pdfImageSet {
+	return &pdfImageSet{colors: colors, images: make(map[string]image.Image)}
+}
+
+// Has reports whether an image was registered with the set
+func (s *pdfImageSet) Has(id string) bool {
+	_, ok := s.images[id]
+	return ok
+}
+
+// Register adds a decoded image to the set
+func (s *pdfImageSet) Register(id string, img image.Image) {
+	if !s.Has(id) {
+		s.ids = append(s.ids, id)
+	}
+	s.images[id] = img
+}
+
+// resourceName returns the XObject name of a registered image
+func (s *pdfImageSet) resourceName(id string) string {
+	for i, registered := range s.ids {
+		if registered == id {
+			return fmt.Sprintf("ImC%d", i+1)
+		}
+	}
+	return ""
+}
+
+// Draw places a registered image with its top-left corner at (x, y), in mm
+func (s *pdfImageSet) Draw(pdf *gofpdf.Fpdf, id string, x, y, w, h float64) {
+	k := pdf.GetConversionRatio()
+	_, pageHeight := pdf.GetPageSize()
+	pdf.RawWriteStr(fmt.Sprintf("q %.5f 0 0 %.5f %.5f %.5f cm /%s Do Q",
+		w*k, h*k, x*k, (pageHeight-(y+h))*k, s.resourceName(id)))
+}
+
+// resourcesPattern finds the shared resource dictionary of a gofpdf page
+var resourcesPattern = regexp.MustCompile(`^\s*(\d+) 0 R\s*$`)
+
+// Write adds the converted images to a rendered PDF and to the resources of its pages
+func (s *pdfImageSet) Write(update *pdfUpdate) error {
+	if len(s.ids) == 0 {
+		return nil
+	}
+
+	resources, body, err := sharedResources(update)
+	if err != nil || resources == 0 {
+		return err
+	}
+
+	entries := strings.TrimSuffix(strings.TrimSpace(dictValue(body, "/XObject")), ">>")
+	if entries == "" {
+		entries = "<<"
+	}
+	for _, id := range s.ids {
+		entries += fmt.Sprintf(" /%s %d 0 R", s.resourceName(id), s.writeImage(update, s.images[id]))
+	}
+	return update.SetEntries(resources, map[string]string{"/XObject": entries + ">>"})
+}
+
+// sharedResources returns the object number and body of the resource
+// dictionary gofpdf shares between all pages, or 0 for a document without pages
+func sharedResources(update *pdfUpdate) (int, string, error) {
+	pages, err := update.Pages()
+	if err != nil || len(pages) == 0 {
+		return 0, "", err
+	}
+	page, err := update.Object(pages[0])
+	if err != nil {
+		return 0, "", err
+	}
+
+	ref := resourcesPattern.FindStringSubmatch(dictValue(page, "/Resources"))
+	if ref == nil {
+		return 0, "", fmt.Errorf("page resources are not an indirect dictionary")
+	}
+	resources, _ := strconv.Atoi(ref[1])
+	body, err := update.Object(resources)
+	if err != nil {
+		return 0, "", err
+	}
+	return resources, body, nil
+}
+
+// writeImage adds an image XObject with samples in the output color space,
+// and a soft mask when the image is not opaque
+func (s *pdfImageSet) writeImage(update *pdfUpdate, img image.Image) int {
+	bounds := img.Bounds()
+	components := colorComponents(s.colors.profile)
+	samples := make([]byte, 0, bounds.Dx()*bounds.Dy()*components)
+	alpha := make([]byte, 0, bounds.Dx()*bounds.Dy())
+	opaque := true
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			for _, v := range s.colors.convert(c.R, c.G, c.B) {
+				samples = append(samples, byte(math.Round(math.Max(0, math.Min(1, v))*255)))
+			}
+			alpha = append(alpha, c.A)
+			opaque = opaque && c.A == 0xff
+		}
+	}
+
+	size := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /BitsPerComponent 8", bounds.Dx(), bounds.Dy())
+	entries := size + " /ColorSpace " + s.colors.deviceSpace()
+	if !opaque {
+		mask := update.AddCompressedStream(size+" /ColorSpace /DeviceGray", alpha)
+		entries += fmt.Sprintf(" /SMask %d 0 R", mask)
+	}
+	return update.AddCompressedStream(entries, samples)
+}
+
+// colorComponents returns the number of components of an output color space
+func colorComponents(profile ColorProfile) int {
+	switch profile {
+	case ColorProfileGray:
+		return 1
+	case ColorProfileCMYK:
+		return 4
+	default:
+		return 3
+	}
+}
@@ -0,0 +1,98 @@
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+func TestResolveColorProfile(t *testing.T) {
+	tests := []struct {
+		requested domain.ColorProfile
+		want      ColorProfile
+	}{
+		{"", ColorProfileCMYK},
+		{domain.ColorProfileRGB, ColorProfileRGB},
+		{domain.ColorProfilesRGB, ColorProfileRGB},
+		{domain.ColorProfileCMYK, ColorProfileCMYK},
+		{domain.ColorProfileGray, ColorProfileGray},
+	}
+	for _, tt := range tests {
+		if got, err := resolveColorProfile(tt.requested, ColorProfileCMYK); err != nil || got != tt.want {
+			t.Errorf("resolveColorProfile(%q) = %q, %v; want %q", tt.requested, got, err, tt.want)
+		}
+	}
+	if _, err := resolveColorProfile("lab", ColorProfileRGB); !errors.Is(err, domain.ErrUnsupportedFormat) {
+		t.Errorf("resolveColorProfile(lab) error = %v, want %v", err, domain.ErrUnsupportedFormat)
+	}
+}
+
+func TestColorConverterOperator(t *testing.T) {
+	red := domain.Color{R: 255, A: 255}
+	grey := domain.Color{R: 128, G: 128, B: 128, A: 255}
+	tests := []struct {
+		profile ColorProfile
+		col     domain.Color
+		stroke  bool
+		want    string
+	}{
+		{ColorProfileRGB, red, false, "1.000 0.000 0.000 rg"},
+		{ColorProfileRGB, red, true, "1.000 0.000 0.000 RG"},
+		{ColorProfileCMYK, red, false, "0.000 1.000 1.000 0.000 k"},
+		{ColorProfileCMYK, domain.Color{R: 0, G: 64, B: 128, A: 255}, true, "1.000 0.500 0.000 0.498 K"},
+		{ColorProfileCMYK, grey, false, "0.000 0.000 0.000 0.498 k"},
+		{ColorProfileGray, red, false, "0.299 g"},
+		{ColorProfileGray, grey, true, "0.502 G"},
+	}
+	for _, tt := range tests {
+		if got := newColorConverter(tt.profile, nil).operator(tt.col, tt.stroke); got != tt.want {
+			t.Errorf("%s operator(%v, stroke=%v) = %q, want %q", tt.profile, tt.col, tt.stroke, got, tt.want)
+		}
+	}
+}
+
+func TestPDFRendererColorProfile(t *testing.T) {
+	var buf bytes.Buffer
+	swatch := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range swatch.Pix {
+		swatch.Pix[i] = 255
+	}
+	swatch.Set(0, 0, color.RGBA{R: 255, A: 255})
+	png.Encode(&buf, swatch)
+	content := `<p style="color: #ff0000">Red</p><img src="data:image/png;base64,` + base64.StdEncoding.EncodeToString(buf.Bytes()) + `">`
+
+	tests := []struct {
+		profile domain.ColorProfile
+		text    string // Operator selecting the text color
+		space   string // Color space of the image
+	}{
+		{domain.ColorProfileRGB, "1.000 0.000 0.000 rg", "/DeviceRGB"},
+		{domain.ColorProfileCMYK, "0.000 1.000 1.000 0.000 k", "/DeviceCMYK"},
+		{domain.ColorProfileGray, "0.299 g", "/DeviceGray"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.profile), func(t *testing.T) {
+			options := domain.DefaultPrintOptions()
+			options.Render.ColorProfile = tt.profile
+			output := renderTestPDF(t, content, options, PDFRenderOptions{})
+			file, pages := testPages(t, output.Data)
+			page := testPageContent(t, file, pages[0])
+			if !strings.Contains(page, tt.text) {
+				t.Errorf("page does not select the text color with %q", tt.text)
+			}
+			if tt.profile != domain.ColorProfileRGB && strings.Contains(page, " rg\n") {
+				t.Errorf("%s page still selects RGB colors", tt.profile)
+			}
+			if !strings.Contains(string(output.Data), "/ColorSpace "+tt.space) {
+				t.Errorf("image is not in %s", tt.space)
+			}
+		})
+	}
+}
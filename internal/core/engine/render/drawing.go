@@ -0,0 +1,453 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/layout"
+	"print-service/internal/core/engine/svg"
+
+	"github.com/fogleman/gg"
+)
+
+// drawingOf returns the vector artwork of an svg element or SVG image, or nil
+func drawingOf(node *domain.LayoutNode) *domain.Drawing {
+	if node.Drawing != nil {
+		return node.Drawing
+	}
+	if node.Image != nil {
+		return node.Image.Drawing
+	}
+	return nil
+}
+
+// drawingNumber formats a coordinate of artwork with up to four decimals
+func drawingNumber(v float64) string {
+	return trimmedNumber(v, 4)
+}
+
+// drawingMatrix formats a transformation as the operands of a PDF cm operator
+// or the arguments of an SVG matrix(). Its factors get more decimals than
+// coordinates as they multiply them.
+func drawingMatrix(m domain.Matrix) string {
+	parts := make([]string, len(m))
+	for i, v := range m {
+		parts[i] = trimmedNumber(v, 6)
+	}
+	return strings.Join(parts, " ")
+}
+
+// trimmedNumber formats a number with up to the given decimals, without
+// trailing zeros
+func trimmedNumber(v float64, precision int) string {
+	s := strconv.FormatFloat(v, 'f', precision, 64)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// intersectBoxes returns the overlap of two boxes
+func intersectBoxes(a, b domain.Box) domain.Box {
+	x, y := math.Max(a.X, b.X), math.Max(a.Y, b.Y)
+	return domain.Box{
+		X:      x,
+		Y:      y,
+		Width:  math.Min(a.X+a.Width, b.X+b.Width) - x,
+		Height: math.Min(a.Y+a.Height, b.Y+b.Height) - y,
+	}
+}
+
+// canvasMatrix maps layout coordinates in CSS pixels to device pixels
+func (ctx ImageRenderContext) canvasMatrix() domain.Matrix {
+	s := ctx.Length(1)
+	return domain.Matrix{s, 0, 0, s, ctx.OriginX, ctx.OriginY}
+}
+
+// renderDrawing draws the artwork of an svg element or SVG image inside its
+// content box
+func (r *ImageRenderer) renderDrawing(node *domain.LayoutNode, ctx ImageRenderContext) {
+	drawing := drawingOf(node)
+	box := layout.ContentBox(node)
+	if drawing == nil || box.Width <= 0 || box.Height <= 0 {
+		return
+	}
+	r.drawArtwork(drawing, box, box, ctx)
+}
+
+// renderBackgroundDrawing draws the copies of an element's SVG background
+// image that fall inside its padding box
+func (r *ImageRenderer) renderBackgroundDrawing(elem *domain.LayoutNode, ctx ImageRenderContext) {
+	placement, ok := resolveBackground(elem.Style.Background, layout.PaddingBox(elem))
+	if !ok || elem.Style.Background.Loaded.Drawing == nil {
+		return
+	}
+	for _, tile := range placement.Tiles() {
+		clip := intersectBoxes(tile, placement.Area)
+		if clip.Width > 0 && clip.Height > 0 {
+			r.drawArtwork(elem.Style.Background.Loaded.Drawing, tile, clip, ctx)
+		}
+	}
+}
+
+// drawArtwork draws artwork fitted into a box, cut to the clip box. The
+// artwork is drawn on a layer the size of the clip box, as clipping the
+// canvas itself would lose the page clip. Points are transformed here, so
+// the layer matrix stays the identity for paths.
+func (r *ImageRenderer) drawArtwork(drawing *domain.Drawing, box, clip domain.Box, ctx ImageRenderContext) {
+	x, y, w, h := ctx.ToCanvas(clip)
+	area := image.Rect(int(math.Floor(x)), int(math.Floor(y)), int(math.Ceil(x+w)), int(math.Ceil(y+h))).
+		Intersect(image.Rect(0, 0, ctx.Width, ctx.Height))
+	if area.Empty() {
+		return
+	}
+
+	layer := ctx
+	layer.Canvas = gg.NewContext(area.Dx(), area.Dy())
+	layer.Width, layer.Height = area.Dx(), area.Dy()
+	layer.OriginX -= float64(area.Min.X)
+	layer.OriginY -= float64(area.Min.Y)
+	layer.Canvas.DrawRectangle(x-float64(area.Min.X), y-float64(area.Min.Y), w, h)
+	layer.Canvas.Clip()
+
+	device := layer.canvasMatrix().Multiply(svg.Fit(drawing, box))
+	for _, shape := range drawing.Shapes {
+		m := device.Multiply(shape.Transform)
+		if shape.Text != nil {
+			r.drawShapeText(shape, m, layer)
+		} else {
+			drawCanvasPath(shape, m, layer)
+		}
+	}
+	ctx.Canvas.DrawImage(layer.Canvas.Image(), area.Min.X, area.Min.Y)
+}
+
+// drawCanvasPath fills, then strokes, the path of a shape transformed by m
+// into device pixels. gg has no miter joins, so they are drawn round.
+func drawCanvasPath(shape domain.Shape, m domain.Matrix, ctx ImageRenderContext) {
+	canvas := ctx.Canvas
+	tracePath := func() {
+		canvas.ClearPath()
+		for _, segment := range shape.Path {
+			p := m.Apply(segment.Points[0])
+			switch segment.Op {
+			case 'M':
+				canvas.MoveTo(p.X, p.Y)
+			case 'L':
+				canvas.LineTo(p.X, p.Y)
+			case 'C':
+				p2, p3 := m.Apply(segment.Points[1]), m.Apply(segment.Points[2])
+				canvas.CubicTo(p.X, p.Y, p2.X, p2.Y, p3.X, p3.Y)
+			case 'Z':
+				canvas.ClosePath()
+			}
+		}
+	}
+
+	if pattern := canvasPaint(shape.Fill, shape.FillOpacity, m); pattern != nil {
+		canvas.SetFillRule(gg.FillRuleWinding)
+		if shape.FillRule == "evenodd" {
+			canvas.SetFillRule(gg.FillRuleEvenOdd)
+		}
+		canvas.SetFillStyle(pattern)
+		tracePath()
+		canvas.Fill()
+	}
+
+	scale := m.Scale()
+	if pattern := canvasPaint(shape.Stroke, shape.StrokeOpacity, m); pattern != nil && shape.StrokeWidth > 0 && scale > 0 {
+		switch shape.LineCap {
+		case "round":
+			canvas.SetLineCap(gg.LineCapRound)
+		case "square":
+			canvas.SetLineCap(gg.LineCapSquare)
+		default:
+			canvas.SetLineCap(gg.LineCapButt)
+		}
+		canvas.SetLineJoin(gg.LineJoinRound)
+		if shape.LineJoin == "bevel" {
+			canvas.SetLineJoin(gg.LineJoinBevel)
+		}
+		dashes := make([]float64, len(shape.Dash))
+		for i, dash := range shape.Dash {
+			dashes[i] = dash * scale
+		}
+		canvas.SetDash(dashes...)
+		canvas.SetDashOffset(shape.DashOffset * scale)
+		canvas.SetLineWidth(shape.StrokeWidth * scale)
+		canvas.SetStrokeStyle(pattern)
+		tracePath()
+		canvas.Stroke()
+	}
+}
+
+// drawShapeText draws the text of a shape transformed by m into device
+// pixels. Glyphs are rasterized at their size on the canvas, then placed by
+// the canvas matrix; text painted with a gradient takes its middle color.
+func (r *ImageRenderer) drawShapeText(shape domain.Shape, m domain.Matrix, ctx ImageRenderContext) {
+	text := shape.Text
+	scale := m.Scale()
+	if text.Font.Size <= 0 || scale <= 0 {
+		return
+	}
+	var c color.NRGBA
+	switch {
+	case shape.Fill.Color != nil:
+		c = canvasColor(*shape.Fill.Color, 1, shape.FillOpacity)
+	case shape.Fill.Gradient != nil:
+		stops := shape.Fill.Gradient.Stops
+		stop := stops[len(stops)/2]
+		c = canvasColor(stop.Color, stop.Opacity, shape.FillOpacity)
+	}
+	if c.A == 0 {
+		return
+	}
+
+	canvas := ctx.Canvas
+	size := text.Font.Size * scale * pointsPerInch / ctx.DPI
+	runs := r.shapeLine(text.Content, r.textEngine.DetectDirection(text.Content), r.faceChain(text.Font, size, ctx), ctx)
+	width := r.runsWidth(runs, ctx)
+	x := 0.0
+	switch text.Anchor {
+	case "middle":
+		x = -width / 2
+	case "end":
+		x = -width
+	}
+
+	canvas.Push()
+	defer canvas.Pop()
+	if !transformCanvas(canvas, m.Multiply(domain.Matrix{1 / scale, 0, 0, 1 / scale, text.X, text.Y})) {
+		return
+	}
+	canvas.SetColor(c)
+	r.drawRuns(runs, x, 0, ctx)
+}
+
+// transformCanvas sets the canvas matrix to m, which gg only builds from a
+// translation, rotation, shear and scale. It returns false when m is singular.
+func transformCanvas(canvas *gg.Context, m domain.Matrix) bool {
+	angle := math.Atan2(m[1], m[0])
+	sx := math.Hypot(m[0], m[1])
+	sin, cos := math.Sincos(angle)
+	shear := m[2]*cos + m[3]*sin
+	sy := m[3]*cos - m[2]*sin
+	if sx == 0 || sy == 0 {
+		return false
+	}
+	canvas.Identity()
+	canvas.Translate(m[4], m[5])
+	canvas.Rotate(angle)
+	canvas.Shear(shear/sy, 0)
+	canvas.Scale(sx, sy)
+	return true
+}
+
+// canvasPaint returns the pattern a paint is drawn with on a canvas whose
+// user space m maps to device pixels, or nil when nothing is painted
+func canvasPaint(paint domain.Paint, opacity float64, m domain.Matrix) gg.Pattern {
+	switch {
+	case paint.Color != nil:
+		if c := canvasColor(*paint.Color, 1, opacity); c.A > 0 {
+			return gg.NewSolidPattern(c)
+		}
+	case paint.Gradient != nil && opacity > 0:
+		if inverse, ok := m.Multiply(paint.Gradient.Transform).Invert(); ok {
+			return &canvasGradient{gradient: paint.Gradient, inverse: inverse, opacity: opacity}
+		}
+	}
+	return nil
+}
+
+// canvasColor returns a color with its alpha reduced by two opacities
+func canvasColor(c domain.Color, stopOpacity, opacity float64) color.NRGBA {
+	return color.NRGBA{R: c.R, G: c.G, B: c.B, A: uint8(math.Round(float64(c.A) * stopOpacity * opacity))}
+}
+
+// canvasGradient is a gradient pattern evaluated at device pixels
+type canvasGradient struct {
+	gradient *domain.Gradient
+	inverse  domain.Matrix // Device pixels to gradient space
+	opacity  float64
+}
+
+// ColorAt returns the color of the gradient at the center of a pixel
+func (g *canvasGradient) ColorAt(x, y int) color.Color {
+	p := g.inverse.Apply(domain.Point{X: float64(x) + 0.5, Y: float64(y) + 0.5})
+	return g.colorAt(g.position(p))
+}
+
+// position returns the offset along the gradient of a point in gradient space
+func (g *canvasGradient) position(p domain.Point) float64 {
+	gr := g.gradient
+	if !gr.Radial {
+		dx, dy := gr.X2-gr.X1, gr.Y2-gr.Y1
+		return ((p.X-gr.X1)*dx + (p.Y-gr.Y1)*dy) / (dx*dx + dy*dy)
+	}
+
+	// The circle through p among those growing from the focal point to the
+	// end circle; the focal point is kept inside the end circle
+	fx, fy := gr.FX, gr.FY
+	if d := math.Hypot(fx-gr.CX, fy-gr.CY); d > gr.R*0.99 {
+		fx = gr.CX + (fx-gr.CX)*gr.R*0.99/d
+		fy = gr.CY + (fy-gr.CY)*gr.R*0.99/d
+	}
+	dx, dy := p.X-fx, p.Y-fy
+	ex, ey := gr.CX-fx, gr.CY-fy
+	a := ex*ex + ey*ey - gr.R*gr.R
+	de := dx*ex + dy*ey
+	return (de - math.Sqrt(de*de-a*(dx*dx+dy*dy))) / a
+}
+
+// colorAt interpolates the stops of the gradient at an offset, padding
+// beyond the first and last stops
+func (g *canvasGradient) colorAt(t float64) color.Color {
+	stops := g.gradient.Stops
+	if t <= stops[0].Offset {
+		return canvasColor(stops[0].Color, stops[0].Opacity, g.opacity)
+	}
+	for i := 1; i < len(stops); i++ {
+		if t > stops[i].Offset {
+			continue
+		}
+		from, to := stops[i-1], stops[i]
+		f := 0.0
+		if to.Offset > from.Offset {
+			f = (t - from.Offset) / (to.Offset - from.Offset)
+		}
+		mix := func(a, b float64) float64 { return a + (b-a)*f }
+		return color.NRGBA{
+			R: uint8(math.Round(mix(float64(from.Color.R), float64(to.Color.R)))),
+			G: uint8(math.Round(mix(float64(from.Color.G), float64(to.Color.G)))),
+			B: uint8(math.Round(mix(float64(from.Color.B), float64(to.Color.B)))),
+			A: uint8(math.Round(mix(float64(from.Color.A)*from.Opacity, float64(to.Color.A)*to.Opacity) * g.opacity)),
+		}
+	}
+	last := stops[len(stops)-1]
+	return canvasColor(last.Color, last.Opacity, g.opacity)
+}
+
+// renderDrawing writes the artwork of an svg element or SVG image as a
+// nested svg element filling the content box, which also clips it
+func (r *SVGRenderer) renderDrawing(node *domain.LayoutNode, ctx SVGRenderContext) {
+	drawing := drawingOf(node)
+	box := layout.ContentBox(node)
+	if drawing == nil || box.Width <= 0 || box.Height <= 0 {
+		return
+	}
+
+	// Without a view box, user units are CSS pixels from the box corner
+	view, aspect := domain.Box{Width: box.Width, Height: box.Height}, "none"
+	if drawing.ViewBox != nil {
+		view, aspect = *drawing.ViewBox, drawing.Align
+		if drawing.Slice && aspect != "none" {
+			aspect += " slice"
+		}
+	}
+	x, y, w, h := ctx.ToSVG(box)
+	b := ctx.Builder
+	fmt.Fprintf(b, `<svg x="%s" y="%s" width="%s" height="%s" viewBox="%s %s %s %s" preserveAspectRatio="%s" overflow="hidden">`+"\n",
+		ctx.Num(x), ctx.Num(y), ctx.Num(w), ctx.Num(h),
+		drawingNumber(view.X), drawingNumber(view.Y), drawingNumber(view.Width), drawingNumber(view.Height), aspect)
+
+	gradients := 0
+	paint := func(attr string, p domain.Paint, opacity float64) string {
+		switch {
+		case p.Color != nil:
+			return fmt.Sprintf(` %s="%s"`, attr, svgColor(*p.Color)) + svgOpacity(attr+"-opacity", domain.Color{A: uint8(math.Round(float64(p.Color.A) * opacity))})
+		case p.Gradient != nil:
+			gradients++
+			id := fmt.Sprintf("%s-paint%d", node.ID, gradients)
+			writeSVGGradient(b, id, p.Gradient)
+			return fmt.Sprintf(` %s="url(#%s)"`, attr, id) + svgOpacity(attr+"-opacity", domain.Color{A: uint8(math.Round(255 * opacity))})
+		}
+		return fmt.Sprintf(` %s="none"`, attr)
+	}
+
+	for _, shape := range drawing.Shapes {
+		transform := ""
+		if shape.Transform != domain.Identity {
+			transform = fmt.Sprintf(` transform="matrix(%s)"`, drawingMatrix(shape.Transform))
+		}
+
+		if text := shape.Text; text != nil {
+			anchor := ""
+			if text.Anchor == "middle" || text.Anchor == "end" {
+				anchor = fmt.Sprintf(` text-anchor="%s"`, text.Anchor)
+			}
+			fill := paint("fill", shape.Fill, shape.FillOpacity)
+			fmt.Fprintf(b, `<text x="%s" y="%s"%s font-family="%s" font-size="%s" font-weight="%d" font-style="%s"%s%s>%s</text>`+"\n",
+				drawingNumber(text.X), drawingNumber(text.Y), transform, escapeSVG(text.Font.Family), drawingNumber(text.Font.Size),
+				text.Font.Weight, escapeSVG(text.Font.Style), anchor, fill, escapeSVG(text.Content))
+			continue
+		}
+
+		var d strings.Builder
+		for _, segment := range shape.Path {
+			switch segment.Op {
+			case 'M', 'L':
+				fmt.Fprintf(&d, "%c%s %s", segment.Op, drawingNumber(segment.Points[0].X), drawingNumber(segment.Points[0].Y))
+			case 'C':
+				d.WriteByte('C')
+				for i, p := range segment.Points {
+					if i > 0 {
+						d.WriteByte(' ')
+					}
+					fmt.Fprintf(&d, "%s %s", drawingNumber(p.X), drawingNumber(p.Y))
+				}
+			case 'Z':
+				d.WriteByte('Z')
+			}
+		}
+		attrs := paint("fill", shape.Fill, shape.FillOpacity)
+		if shape.FillRule == "evenodd" {
+			attrs += ` fill-rule="evenodd"`
+		}
+		if !shape.Stroke.IsNone() && shape.StrokeWidth > 0 {
+			attrs += paint("stroke", shape.Stroke, shape.StrokeOpacity)
+			attrs += fmt.Sprintf(` stroke-width="%s" stroke-linecap="%s" stroke-linejoin="%s" stroke-miterlimit="%s"`,
+				drawingNumber(shape.StrokeWidth), shape.LineCap, shape.LineJoin, drawingNumber(shape.MiterLimit))
+			if len(shape.Dash) > 0 {
+				dashes := make([]string, len(shape.Dash))
+				for i, dash := range shape.Dash {
+					dashes[i] = drawingNumber(dash)
+				}
+				attrs += fmt.Sprintf(` stroke-dasharray="%s" stroke-dashoffset="%s"`, strings.Join(dashes, " "), drawingNumber(shape.DashOffset))
+			}
+		}
+		fmt.Fprintf(b, `<path d="%s"%s%s/>`+"\n", d.String(), transform, attrs)
+	}
+	b.WriteString("</svg>\n")
+}
+
+// writeSVGGradient writes a gradient in the user space of the shape it paints
+func writeSVGGradient(b *strings.Builder, id string, g *domain.Gradient) {
+	if g.Radial {
+		fmt.Fprintf(b, `<radialGradient id="%s" gradientUnits="userSpaceOnUse" cx="%s" cy="%s" r="%s" fx="%s" fy="%s"`,
+			id, drawingNumber(g.CX), drawingNumber(g.CY), drawingNumber(g.R), drawingNumber(g.FX), drawingNumber(g.FY))
+	} else {
+		fmt.Fprintf(b, `<linearGradient id="%s" gradientUnits="userSpaceOnUse" x1="%s" y1="%s" x2="%s" y2="%s"`,
+			id, drawingNumber(g.X1), drawingNumber(g.Y1), drawingNumber(g.X2), drawingNumber(g.Y2))
+	}
+	fmt.Fprintf(b, ` gradientTransform="matrix(%s)">`, drawingMatrix(g.Transform))
+	for _, stop := range g.Stops {
+		opacity := ""
+		if stop.Opacity < 1 || stop.Color.A < 255 {
+			opacity = fmt.Sprintf(` stop-opacity="%.3f"`, stop.Opacity*float64(stop.Color.A)/255)
+		}
+		fmt.Fprintf(b, `<stop offset="%s" stop-color="%s"%s/>`, drawingNumber(stop.Offset), svgColor(stop.Color), opacity)
+	}
+	if g.Radial {
+		b.WriteString("</radialGradient>\n")
+	} else {
+		b.WriteString("</linearGradient>\n")
+	}
+}
@@ -0,0 +1,335 @@
+package render
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strconv"
+
+	"print-service/internal/core/domain"
+)
+
+// passwordPadding pads passwords of the revision 4 security handler to 32 bytes
+var passwordPadding = []byte{
+	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+// Permission bits of the standard security handler
+const (
+	permissionPrint         = 1 << 2
+	permissionModify        = 1 << 3
+	permissionCopy          = 1 << 4
+	permissionAnnotate      = 1 << 5
+	permissionFillForms     = 1 << 8
+	permissionAccessibility = 1 << 9
+	permissionAssemble      = 1 << 10
+	permissionPrintHigh     = 1 << 11
+	permissionReserved      = ^0xF3F // Bits 7, 8 and 13-32 must be set
+)
+
+// pdfEncryption encrypts strings and streams with the standard security
+// handler: AES-128 as revision 4, or AES-256 as revision 6
+type pdfEncryption struct {
+	key    []byte // File encryption key
+	aes256 bool
+	dict   string // Encryption dictionary
+}
+
+// permissionFlags returns the P value granting the requested permissions.
+// Text extraction for accessibility is always allowed.
+func permissionFlags(perms domain.Permissions) int32 {
+	flags := permissionReserved | permissionAccessibility
+	if perms.Print {
+		flags |= permissionPrint | permissionPrintHigh
+	}
+	if perms.Modify {
+		flags |= permissionModify | permissionAssemble
+	}
+	if perms.Copy {
+		flags |= permissionCopy
+	}
+	if perms.Annotate {
+		flags |= permissionAnnotate | permissionFillForms
+	}
+	return int32(flags)
+}
+
+// newPDFEncryption derives the keys and encryption dictionary for a
+// document with the given file identifier
+func newPDFEncryption(opts domain.Encryption, id []byte) (*pdfEncryption, error) {
+	owner := opts.OwnerPassword
+	if owner == "" {
+		// Without an owner password nobody can lift the restrictions
+		random := make([]byte, 16)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		owner = hex.EncodeToString(random)
+	}
+	permissions := permissionFlags(opts.Permissions)
+
+	switch opts.Algorithm {
+	case domain.EncryptionAES128:
+		return newAES128Encryption(opts.UserPassword, owner, permissions, id), nil
+	case domain.EncryptionAES256, "":
+		return newAES256Encryption(opts.UserPassword, owner, permissions)
+	}
+	return nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "unsupported encryption algorithm", domain.ErrUnsupportedFormat).
+		WithDetail("algorithm", opts.Algorithm)
+}
+
+// newAES128Encryption derives the revision 4 keys, which depend on the file identifier
+func newAES128Encryption(user, owner string, permissions int32, id []byte) *pdfEncryption {
+	// Owner entry: the padded user password encrypted with a key from the owner password
+	digest := md5.Sum(padPassword(owner))
+	for i := 0; i < 50; i++ {
+		digest = md5.Sum(digest[:])
+	}
+	o := rc4Rounds(digest[:], padPassword(user))
+
+	// File key from the user password, the owner entry, the permissions and the identifier
+	h := md5.New()
+	h.Write(padPassword(user))
+	h.Write(o)
+	_ = binary.Write(h, binary.LittleEndian, permissions)
+	h.Write(id)
+	key := h.Sum(nil)
+	for i := 0; i < 50; i++ {
+		sum := md5.Sum(key)
+		key = sum[:]
+	}
+
+	// User entry: a digest of the identifier, so readers can check the password
+	h = md5.New()
+	h.Write(passwordPadding)
+	h.Write(id)
+	u := append(rc4Rounds(key, h.Sum(nil)), make([]byte, 16)...)
+
+	return &pdfEncryption{
+		key: key,
+		dict: fmt.Sprintf("<</Filter /Standard /V 4 /R 4 /Length 128 "+
+			"/CF <</StdCF <</AuthEvent /DocOpen /CFM /AESV2 /Length 16>>>> /StmF /StdCF /StrF /StdCF "+
+			"/O <%x> /U <%x> /P %d /EncryptMetadata true>>", o, u, permissions),
+	}
+}
+
+// newAES256Encryption creates a random file key and the revision 6 entries
+// that recover it from either password
+func newAES256Encryption(user, owner string, permissions int32) (*pdfEncryption, error) {
+	random := make([]byte, aes256RandomSize)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return aes256Encryption(user, owner, permissions, random), nil
+}
+
+// aes256RandomSize is the random data of revision 6 encryption: the file
+// key, four 8-byte salts and 4 bytes completing the permissions block
+const aes256RandomSize = 32 + 32 + 4
+
+// aes256Encryption derives the revision 6 entries from random data of aes256RandomSize bytes
+func aes256Encryption(user, owner string, permissions int32, random []byte) *pdfEncryption {
+	key, salts, tail := random[:32], random[32:64], random[64:68]
+	userPassword, ownerPassword := truncatePassword(user), truncatePassword(owner)
+
+	// Validation and key salts for the user, then for the owner entry over the user entry
+	u := append(hashPassword(userPassword, salts[0:8], nil), salts[0:16]...)
+	ue := aesEncryptBlocks(hashPassword(userPassword, salts[8:16], nil), key)
+	o := append(hashPassword(ownerPassword, salts[16:24], u), salts[16:32]...)
+	oe := aesEncryptBlocks(hashPassword(ownerPassword, salts[24:32], u), key)
+
+	// Permissions, encrypted so they cannot be altered without the key
+	perms := make([]byte, 16)
+	binary.LittleEndian.PutUint32(perms, uint32(permissions))
+	copy(perms[4:], []byte{0xFF, 0xFF, 0xFF, 0xFF, 'T', 'a', 'd', 'b'})
+	copy(perms[12:], tail)
+	block, _ := aes.NewCipher(key)
+	block.Encrypt(perms, perms)
+
+	return &pdfEncryption{
+		key:    key,
+		aes256: true,
+		dict: fmt.Sprintf("<</Filter /Standard /V 5 /R 6 /Length 256 "+
+			"/CF <</StdCF <</AuthEvent /DocOpen /CFM /AESV3 /Length 32>>>> /StmF /StdCF /StrF /StdCF "+
+			"/O <%x> /U <%x> /OE <%x> /UE <%x> /Perms <%x> /P %d /EncryptMetadata true>>", o, u, oe, ue, perms, permissions),
+	}
+}
+
+// padPassword pads or truncates a revision 4 password to 32 bytes
+func padPassword(password string) []byte {
+	return append([]byte(password), passwordPadding...)[:32]
+}
+
+// truncatePassword limits a revision 6 password to the 127 bytes readers use
+func truncatePassword(password string) []byte {
+	if len(password) > 127 {
+		password = password[:127]
+	}
+	return []byte(password)
+}
+
+// rc4Rounds encrypts data with the key, then 19 more times with the key
+// XORed with the round number
+func rc4Rounds(key, data []byte) []byte {
+	out := append([]byte(nil), data...)
+	round := make([]byte, len(key))
+	for i := 0; i < 20; i++ {
+		for j := range key {
+			round[j] = key[j] ^ byte(i)
+		}
+		c, _ := rc4.NewCipher(round)
+		c.XORKeyStream(out, out)
+	}
+	return out
+}
+
+// hashPassword is the revision 6 password hash: SHA-256 of the input,
+// strengthened by rounds of AES and SHA-2 chosen by the data
+func hashPassword(password, salt, userKey []byte) []byte {
+	h := sha256.New()
+	h.Write(password)
+	h.Write(salt)
+	h.Write(userKey)
+	k := h.Sum(nil)
+
+	for round := 0; ; {
+		var seq bytes.Buffer
+		for i := 0; i < 64; i++ {
+			seq.Write(password)
+			seq.Write(k)
+			seq.Write(userKey)
+		}
+		block, _ := aes.NewCipher(k[:16])
+		e := seq.Bytes()
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, e)
+
+		sum := 0
+		for _, b := range e[:16] {
+			sum += int(b)
+		}
+		var next hash.Hash
+		switch sum % 3 {
+		case 0:
+			next = sha256.New()
+		case 1:
+			next = sha512.New384()
+		default:
+			next = sha512.New()
+		}
+		next.Write(e)
+		k = next.Sum(nil)
+
+		round++
+		if round >= 64 && int(e[len(e)-1]) <= round-32 {
+			break
+		}
+	}
+	return k[:32]
+}
+
+// aesEncryptBlocks encrypts whole blocks with AES-256 in CBC mode and a zero IV
+func aesEncryptBlocks(key, data []byte) []byte {
+	block, _ := aes.NewCipher(key)
+	out := make([]byte, len(data))
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(out, data)
+	return out
+}
+
+// objectKey returns the key for the strings and streams of an object
+func (e *pdfEncryption) objectKey(num int) []byte {
+	if e.aes256 {
+		return e.key
+	}
+	h := md5.New()
+	h.Write(e.key)
+	h.Write([]byte{byte(num), byte(num >> 8), byte(num >> 16), 0, 0})
+	h.Write([]byte("sAlT"))
+	return h.Sum(nil)
+}
+
+// encrypt encrypts data for an object with AES in CBC mode, a random IV
+// written before the ciphertext and PKCS#5 padding
+func (e *pdfEncryption) encrypt(num int, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(e.objectKey(num))
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	out := make([]byte, aes.BlockSize+len(data)+padding)
+	if _, err := rand.Read(out[:aes.BlockSize]); err != nil {
+		return nil, err
+	}
+	copy(out[aes.BlockSize:], data)
+	for i := len(out) - padding; i < len(out); i++ {
+		out[i] = byte(padding)
+	}
+	cipher.NewCBCEncrypter(block, out[:aes.BlockSize]).CryptBlocks(out[aes.BlockSize:], out[aes.BlockSize:])
+	return out, nil
+}
+
+// encryptObject encrypts the strings and stream data of an object body
+func (e *pdfEncryption) encryptObject(num int, body string) (string, error) {
+	encrypt := func(data []byte) ([]byte, error) { return e.encrypt(num, data) }
+
+	dict, data, err := splitStream(body)
+	if err != nil {
+		return "", fmt.Errorf("PDF object %d: %w", num, err)
+	}
+	if dict == "" {
+		// The value of a signature is written after encryption and stays in clear
+		if dictValue(body, "/Type") == "/Sig" {
+			contents := dictValue(body, "/Contents")
+			if body, err = mapStrings(setDictValue(body, "/Contents", "null"), encrypt); err != nil {
+				return "", err
+			}
+			return setDictValue(body, "/Contents", contents), nil
+		}
+		return mapStrings(body, encrypt)
+	}
+
+	if dict, err = mapStrings(dict, encrypt); err != nil {
+		return "", err
+	}
+	if data, err = e.encrypt(num, data); err != nil {
+		return "", err
+	}
+	dict = setDictValue(dict, "/Length", strconv.Itoa(len(data)))
+	return fmt.Sprintf("%s\nstream\n%s\nendstream", dict, data), nil
+}
+
+// writeEncrypted rewrites a document with its strings and streams encrypted
+func writeEncrypted(update *pdfUpdate, opts domain.Encryption, data []byte) ([]byte, error) {
+	id := md5.Sum(data)
+	enc, err := newPDFEncryption(opts, id[:])
+	if err != nil {
+		return nil, err
+	}
+
+	// Readers that predate revision 6 are told which extension it needs
+	if enc.aes256 {
+		if err := addExtension(update, "/ADBE", "1.7", 8); err != nil {
+			return nil, err
+		}
+	}
+
+	dict := update.Add(enc.dict)
+	update.SetTrailer("/Encrypt", fmt.Sprintf("%d 0 R", dict))
+	update.SetFileID(id[:])
+
+	return update.Rewrite(func(num int, body string) (string, error) {
+		if num == dict {
+			return body, nil // The encryption dictionary itself stays readable
+		}
+		return enc.encryptObject(num, body)
+	})
+}
@@ -0,0 +1,247 @@
+package render
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+// Expected entries were computed independently of this package, from the
+// algorithms of ISO 32000-2 section 7.6.4
+const (
+	knownPermissions = -1340 // Printing allowed
+	knownR4Key       = "481675df0f0acdb6db06753febde0be1"
+	knownR4O         = "0ba3835f88f90388e74e54584125ce142be0de24c6b0d37746e075b891756671"
+	knownR4U         = "d8db3412fc85f16675d89ef62365479c00000000000000000000000000000000"
+	knownR4Object7   = "ec2d2aa0e4da272051f410b390394cd3"
+	knownR6O         = "641957c838a6af724badd497b43e3b232414ff58c797fd80cb5b3aa706837b6a303132333435363738393a3b3c3d3e3f"
+	knownR6U         = "0883bdd9f6387104b4382dc453dea14d56ec345fc7e06b5dc5e22d4cdb744d7f202122232425262728292a2b2c2d2e2f"
+	knownR6OE        = "e324f0d67ebebc2337de7cce144767b118f16fd0e9f5f64a7a6b5cf657a41a41"
+	knownR6UE        = "0aced4b8d236ce53b71feba657b9267d9a27e4ccc510f93c30e3a198b59a9b25"
+	knownR6Perms     = "eaeff1c76bddc78467a798abe5ad203e"
+)
+
+// sequence returns the bytes 0, 1, 2 ... n-1
+func sequence(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	return data
+}
+
+// encryptionEntry returns a hexadecimal string entry of an encryption dictionary
+func encryptionEntry(t *testing.T, dict, key string) string {
+	t.Helper()
+	value := dictValue(dict, key)
+	if len(value) < 2 || value[0] != '<' {
+		t.Fatalf("encryption dictionary has no string %s: %s", key, dict)
+	}
+	return value[1 : len(value)-1]
+}
+
+func TestPermissionFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		perms domain.Permissions
+		want  int32
+	}{
+		{"none", domain.Permissions{}, -3392},
+		{"print", domain.Permissions{Print: true}, knownPermissions},
+		{"all", domain.Permissions{Print: true, Modify: true, Copy: true, Annotate: true}, -4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := permissionFlags(tt.perms); got != tt.want {
+				t.Errorf("permissionFlags() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAES128EncryptionKnownAnswer(t *testing.T) {
+	enc := newAES128Encryption("user", "owner", knownPermissions, sequence(16))
+	if got := hex.EncodeToString(enc.key); got != knownR4Key {
+		t.Errorf("file key = %s, want %s", got, knownR4Key)
+	}
+	if got := encryptionEntry(t, enc.dict, "/O"); got != knownR4O {
+		t.Errorf("/O = %s, want %s", got, knownR4O)
+	}
+	if got := encryptionEntry(t, enc.dict, "/U"); got != knownR4U {
+		t.Errorf("/U = %s, want %s", got, knownR4U)
+	}
+	if got := dictValue(enc.dict, "/P"); got != strconv.Itoa(knownPermissions) {
+		t.Errorf("/P = %s, want %d", got, knownPermissions)
+	}
+	if got := hex.EncodeToString(enc.objectKey(7)); got != knownR4Object7 {
+		t.Errorf("key of object 7 = %s, want %s", got, knownR4Object7)
+	}
+}
+
+func TestAES256EncryptionKnownAnswer(t *testing.T) {
+	enc := aes256Encryption("user", "owner", knownPermissions, sequence(aes256RandomSize))
+	if got := hex.EncodeToString(enc.key); got != hex.EncodeToString(sequence(32)) {
+		t.Errorf("file key = %s, want the first 32 random bytes", got)
+	}
+	for _, entry := range []struct{ key, want string }{
+		{"/O", knownR6O},
+		{"/U", knownR6U},
+		{"/OE", knownR6OE},
+		{"/UE", knownR6UE},
+		{"/Perms", knownR6Perms},
+	} {
+		if got := encryptionEntry(t, enc.dict, entry.key); got != entry.want {
+			t.Errorf("%s = %s, want %s", entry.key, got, entry.want)
+		}
+	}
+	// Every object shares the file key
+	if !bytes.Equal(enc.objectKey(7), enc.key) {
+		t.Error("objectKey() differs from the file key")
+	}
+}
+
+// encryptedTestObjects are a one-page document with a string and a stream to encrypt
+var encryptedTestObjects = []string{
+	"<</Type /Catalog /Pages 2 0 R>>",
+	"<</Type /Pages /Kids [3 0 R] /Count 1>>",
+	"<</Type /Page /Parent 2 0 R /Contents 4 0 R>>",
+	fmt.Sprintf("<</Length %d>>\nstream\n%s\nendstream", len(testPDFContent), testPDFContent),
+	"<</Title (Secret \\(title\\))>>",
+}
+
+// fileIDPattern matches the first part of a trailer's file identifier
+var fileIDPattern = regexp.MustCompile(`/ID\s*\[\s*<([0-9a-fA-F]+)>`)
+
+// userFileKey recovers the file key of an encrypted file from its user
+// password, checking the password against the /U entry
+func userFileKey(t *testing.T, trailer, dict, password string) []byte {
+	t.Helper()
+	u, _ := hex.DecodeString(encryptionEntry(t, dict, "/U"))
+
+	if dictValue(dict, "/R") == "6" {
+		if !bytes.Equal(hashPassword([]byte(password), u[32:40], nil), u[:32]) {
+			t.Fatal("user password does not match /U")
+		}
+		ue, _ := hex.DecodeString(encryptionEntry(t, dict, "/UE"))
+		block, _ := aes.NewCipher(hashPassword([]byte(password), u[40:48], nil))
+		key := make([]byte, 32)
+		cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(key, ue)
+
+		// The permissions block must decrypt to the /P value
+		perms, _ := hex.DecodeString(encryptionEntry(t, dict, "/Perms"))
+		block, _ = aes.NewCipher(key)
+		block.Decrypt(perms, perms)
+		p, _ := strconv.Atoi(dictValue(dict, "/P"))
+		if string(perms[9:12]) != "adb" || int32(binary.LittleEndian.Uint32(perms)) != int32(p) {
+			t.Errorf("/Perms decrypts to %x, want /P %d", perms, p)
+		}
+		return key
+	}
+
+	match := fileIDPattern.FindStringSubmatch(trailer)
+	if match == nil {
+		t.Fatalf("trailer has no file identifier: %s", trailer)
+	}
+	id, _ := hex.DecodeString(match[1])
+	o, _ := hex.DecodeString(encryptionEntry(t, dict, "/O"))
+	p, _ := strconv.Atoi(dictValue(dict, "/P"))
+	h := md5.New()
+	h.Write(padPassword(password))
+	h.Write(o)
+	binary.Write(h, binary.LittleEndian, int32(p))
+	h.Write(id)
+	key := h.Sum(nil)
+	for i := 0; i < 50; i++ {
+		sum := md5.Sum(key)
+		key = sum[:]
+	}
+
+	h = md5.New()
+	h.Write(passwordPadding)
+	h.Write(id)
+	if !bytes.Equal(rc4Rounds(key, h.Sum(nil)), u[:16]) {
+		t.Fatal("user password does not match /U")
+	}
+	return key
+}
+
+// decryptTestData decrypts AES data with its IV in front and PKCS#5 padding
+func decryptTestData(t *testing.T, key, data []byte) []byte {
+	t.Helper()
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		t.Fatalf("encrypted data has %d bytes", len(data))
+	}
+	block, _ := aes.NewCipher(key)
+	out := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(out, data[aes.BlockSize:])
+	padding := int(out[len(out)-1])
+	if padding < 1 || padding > aes.BlockSize {
+		t.Fatalf("invalid padding %d", padding)
+	}
+	return out[:len(out)-padding]
+}
+
+func TestWriteEncryptedRoundTrip(t *testing.T) {
+	for _, algorithm := range []domain.EncryptionAlgorithm{domain.EncryptionAES128, domain.EncryptionAES256} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			data := testPDF{objects: encryptedTestObjects}.classic("")
+			update, err := newPDFUpdate(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			options := domain.Encryption{UserPassword: "user", OwnerPassword: "owner", Algorithm: algorithm, Permissions: domain.Permissions{Print: true}}
+			encrypted, err := writeEncrypted(update, options, data)
+			if err != nil {
+				t.Fatalf("writeEncrypted() error = %v", err)
+			}
+			if bytes.Contains(encrypted, []byte(testPDFContent)) || bytes.Contains(encrypted, []byte("Secret")) {
+				t.Fatal("encrypted file holds content in clear text")
+			}
+
+			file, err := newPDFUpdate(encrypted)
+			if err != nil {
+				t.Fatalf("encrypted file is unreadable: %v", err)
+			}
+			dictNum, ok := referenceTo(dictValue("<<"+file.trailer+">>", "/Encrypt"))
+			if !ok {
+				t.Fatalf("trailer has no /Encrypt reference: %s", file.trailer)
+			}
+			dict, err := file.Object(dictNum)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key := userFileKey(t, file.trailer, dict, "user")
+			objectKey := (&pdfEncryption{key: key, aes256: algorithm == domain.EncryptionAES256}).objectKey
+
+			stream, err := file.Object(4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, raw, err := splitStream(stream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := decryptTestData(t, objectKey(4), raw); string(got) != testPDFContent {
+				t.Errorf("stream decrypts to %q, want %q", got, testPDFContent)
+			}
+
+			info, err := file.Object(5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			title := decodeHexString(encryptionEntry(t, info, "/Title"))
+			if got := decryptTestData(t, objectKey(5), title); string(got) != "Secret (title)" {
+				t.Errorf("string decrypts to %q, want %q", got, "Secret (title)")
+			}
+		})
+	}
+}
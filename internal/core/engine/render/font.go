@@ -0,0 +1,537 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"print-service/internal/core/domain"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+)
+
+// FontManager manages font resources and font loading for PDF rendering.
+//
+// Faces are registered from TrueType/OpenType files and looked up by CSS
+// family, weight and style. A FontManager is safe for concurrent use once
+// loaded and is shared by the renderers of a print service.
+type FontManager struct {
+	mu        sync.RWMutex
+	fonts     map[string]FontInfo       // Map of face ID to font information
+	families  map[string][]string       // Lower-cased family name to face IDs
+	fallbacks []string                  // Families tried after the requested ones
+	builtin   []FontInfo                // Bundled Unicode faces used as the last fallback
+	parsed    map[string]*truetype.Font // Parsed faces for raster output
+	outlines  map[string]*sfnt.Font     // Parsed faces for glyph coverage lookups
+	shapers   map[string]*otFont        // Layout tables of faces, nil for faces without them
+}
+
+// FontInfo represents detailed information about a font resource
+type FontInfo struct {
+	ID     string // Unique face identifier, also used as the PDF font name
+	Family string // Font family name (e.g., "Arial", "Times")
+	Style  string // Font style (e.g., "B", "I", "BI")
+	Weight int    // CSS weight class (100-900)
+	Italic bool   // Italic or oblique face
+	Path   string // Path to font file (for custom fonts)
+	Data   []byte // Font file contents
+}
+
+// Font file signatures
+const (
+	sfntVersionTrueType = 0x00010000
+	sfntVersionApple    = 0x74727565 // "true"
+	sfntVersionCFF      = 0x4F54544F // "OTTO"
+)
+
+// NewFontManager creates a new font manager with initialized font registry
+func NewFontManager() *FontManager {
+	fm := &FontManager{
+		fonts:    make(map[string]FontInfo),
+		families: make(map[string][]string),
+		parsed:   make(map[string]*truetype.Font),
+		outlines: make(map[string]*sfnt.Font),
+		shapers:  make(map[string]*otFont),
+	}
+
+	// The Go fonts cover Latin, Greek and Cyrillic (WGL4) and are always available
+	for _, data := range [][]byte{
+		goregular.TTF, gobold.TTF, goitalic.TTF, gobolditalic.TTF,
+		gomono.TTF, gomonobold.TTF, gomonoitalic.TTF, gomonobolditalic.TTF,
+	} {
+		if info, err := parseFontInfo("", data); err == nil {
+			fm.builtin = append(fm.builtin, info)
+		}
+	}
+
+	return fm
+}
+
+// LoadDirectory registers every .ttf and .otf file below dir.
+//
+// Files that cannot be registered are skipped; their errors are joined into
+// the returned error while the remaining faces stay available.
+func (fm *FontManager) LoadDirectory(dir string) error {
+	var errs []error
+	walkErr := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".ttf", ".otf":
+		default:
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if _, err := fm.Register(path, data); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return fmt.Errorf("failed to read fonts directory: %w", walkErr)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Register adds a font face from the contents of a font file
+func (fm *FontManager) Register(path string, data []byte) (FontInfo, error) {
+	info, err := parseFontInfo(path, data)
+	if err != nil {
+		return FontInfo{}, err
+	}
+
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if _, exists := fm.fonts[info.ID]; exists {
+		return fm.fonts[info.ID], nil // First file wins for duplicate faces
+	}
+	fm.fonts[info.ID] = info
+	key := strings.ToLower(info.Family)
+	fm.families[key] = append(fm.families[key], info.ID)
+
+	return info, nil
+}
+
+// parseFontInfo reads the family, weight and style of a font file
+func parseFontInfo(path string, data []byte) (FontInfo, error) {
+	if len(data) < 4 {
+		return FontInfo{}, domain.NewPrintError(domain.ErrCodeInvalidInput, "font file too short", domain.ErrFontNotFound)
+	}
+
+	// The PDF writer embeds glyf outlines only; CFF-flavoured OpenType is rejected up front
+	switch binary.BigEndian.Uint32(data) {
+	case sfntVersionTrueType, sfntVersionApple:
+	case sfntVersionCFF:
+		return FontInfo{}, domain.NewPrintError(domain.ErrCodeInvalidInput, "OpenType fonts with CFF outlines are not supported", domain.ErrFontNotFound)
+	default:
+		return FontInfo{}, domain.NewPrintError(domain.ErrCodeInvalidInput, "unrecognised font format", domain.ErrFontNotFound)
+	}
+
+	parsed, err := sfnt.Parse(data)
+	if err != nil {
+		return FontInfo{}, domain.NewPrintError(domain.ErrCodeInvalidInput, "invalid font file", domain.ErrFontNotFound).
+			WithDetail("error", err.Error())
+	}
+
+	family := fontName(parsed, sfnt.NameIDTypographicFamily, sfnt.NameIDFamily)
+	if family == "" {
+		return FontInfo{}, domain.NewPrintError(domain.ErrCodeInvalidInput, "font has no family name", domain.ErrFontNotFound)
+	}
+	subfamily := fontName(parsed, sfnt.NameIDTypographicSubfamily, sfnt.NameIDSubfamily)
+
+	// Prefer the OS/2 classification and fall back to the subfamily name
+	weight, italic, ok := readOS2(data)
+	if !ok {
+		weight, italic = parseSubfamily(subfamily)
+	}
+
+	cssStyle := "normal"
+	if italic {
+		cssStyle = "italic"
+	}
+
+	info := FontInfo{
+		Family: family,
+		Style:  fontStyleCode(weight, cssStyle),
+		Weight: weight,
+		Italic: italic,
+		Path:   path,
+		Data:   data,
+	}
+	info.ID = faceID(info)
+
+	return info, nil
+}
+
+// SetFallbacks sets the families tried when none of the requested families is registered
+func (fm *FontManager) SetFallbacks(families []string) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fm.fallbacks = fm.fallbacks[:0]
+	for _, family := range families {
+		if family = strings.TrimSpace(family); family != "" {
+			fm.fallbacks = append(fm.fallbacks, family)
+		}
+	}
+}
+
+// Families returns the registered family names in sorted order
+func (fm *FontManager) Families() []string {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	names := make([]string, 0, len(fm.families))
+	for _, ids := range fm.families {
+		names = append(names, fm.fonts[ids[0]].Family)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve finds the registered face for a CSS font-family list.
+//
+// Named families are tried in order, followed by the configured fallbacks.
+// Generic families are left to the renderer's built-in fonts, except that a
+// monospace request stops the search so code never falls back to a
+// proportional face. The second result is false when nothing matches.
+func (fm *FontManager) Resolve(familyList string, weight int, style string) (FontInfo, bool) {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	if len(fm.fonts) == 0 {
+		return FontInfo{}, false
+	}
+
+	italic := isItalicStyle(style)
+	candidates := parseFamilyList(familyList)
+	for _, family := range candidates {
+		if ids, ok := fm.families[family]; ok {
+			return fm.matchFace(ids, weight, italic), true
+		}
+		if family == "monospace" {
+			return FontInfo{}, false
+		}
+	}
+
+	for _, family := range fm.fallbacks {
+		if ids, ok := fm.families[strings.ToLower(family)]; ok {
+			return fm.matchFace(ids, weight, italic), true
+		}
+	}
+
+	return FontInfo{}, false
+}
+
+// Fallbacks returns the faces tried, in order, for characters the selected font lacks.
+//
+// The configured fallback families come first and the bundled Go fonts last;
+// each contributes its face closest to the requested weight and style.
+func (fm *FontManager) Fallbacks(weight int, style string, monospace bool) []FontInfo {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	italic := isItalicStyle(style)
+	var faces []FontInfo
+	for _, family := range fm.fallbacks {
+		if ids, ok := fm.families[strings.ToLower(family)]; ok {
+			faces = append(faces, fm.matchFace(ids, weight, italic))
+		}
+	}
+
+	// Bundled faces, preferring the monospaced family for monospace text
+	builtinFamily := "go"
+	if monospace {
+		builtinFamily = "go mono"
+	}
+	var builtin []FontInfo
+	for _, info := range fm.builtin {
+		if strings.ToLower(info.Family) == builtinFamily {
+			builtin = append(builtin, info)
+		}
+	}
+	if len(builtin) > 0 {
+		faces = append(faces, closestFace(builtin, weight, italic))
+	}
+
+	return faces
+}
+
+// HasGlyph reports whether a face maps a character to a glyph
+func (fm *FontManager) HasGlyph(info FontInfo, r rune) bool {
+	fm.mu.RLock()
+	outline, ok := fm.outlines[info.ID]
+	fm.mu.RUnlock()
+
+	if !ok {
+		var err error
+		if outline, err = sfnt.Parse(info.Data); err != nil {
+			return false
+		}
+		fm.mu.Lock()
+		fm.outlines[info.ID] = outline
+		fm.mu.Unlock()
+	}
+
+	index, err := outline.GlyphIndex(nil, r)
+	return err == nil && index != 0
+}
+
+// TrueType returns a parsed face for raster rendering, caching the result
+func (fm *FontManager) TrueType(info FontInfo) (*truetype.Font, error) {
+	fm.mu.RLock()
+	parsed, ok := fm.parsed[info.ID]
+	fm.mu.RUnlock()
+	if ok {
+		return parsed, nil
+	}
+
+	parsed, err := truetype.Parse(info.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font %s: %w", info.ID, err)
+	}
+
+	fm.mu.Lock()
+	fm.parsed[info.ID] = parsed
+	fm.mu.Unlock()
+
+	return parsed, nil
+}
+
+// shaper returns the layout tables used to shape text with a face, caching
+// the result. It returns nil for faces without GSUB or GPOS tables, whose
+// text is drawn character by character.
+func (fm *FontManager) shaper(info FontInfo) *otFont {
+	fm.mu.RLock()
+	shaper, ok := fm.shapers[info.ID]
+	fm.mu.RUnlock()
+	if ok {
+		return shaper
+	}
+
+	shaper = parseOTFont(info.Data)
+	fm.mu.Lock()
+	fm.shapers[info.ID] = shaper
+	fm.mu.Unlock()
+
+	return shaper
+}
+
+// matchFace picks the face of a family closest to the requested weight and style
+// following the CSS font matching order
+func (fm *FontManager) matchFace(ids []string, weight int, italic bool) FontInfo {
+	faces := make([]FontInfo, len(ids))
+	for i, id := range ids {
+		faces[i] = fm.fonts[id]
+	}
+	return closestFace(faces, weight, italic)
+}
+
+// closestFace returns the face closest to a weight and style; faces must not be empty
+func closestFace(faces []FontInfo, weight int, italic bool) FontInfo {
+	if weight <= 0 {
+		weight = 400
+	}
+
+	best := faces[0]
+	bestScore := -1
+	for _, face := range faces {
+		score := weightPenalty(weight, face.Weight)
+		if face.Italic != italic {
+			score += 10000 // Style mismatches rank behind any weight match
+		}
+		if bestScore < 0 || score < bestScore {
+			best, bestScore = face, score
+		}
+	}
+
+	return best
+}
+
+// weightPenalty ranks how far a face weight is from the desired weight.
+// Lower is better; the ordering follows the CSS Fonts font-weight rules.
+func weightPenalty(want, have int) int {
+	if have == want {
+		return 0
+	}
+
+	switch {
+	case want >= 400 && want <= 500:
+		// Heavier faces up to 500 first, then lighter, then heavier
+		if have > want && have <= 500 {
+			return have - want
+		}
+		if have < want {
+			return 1000 + want - have
+		}
+		return 2000 + have - want
+	case want < 400:
+		// Lighter faces first, then heavier
+		if have < want {
+			return want - have
+		}
+		return 1000 + have - want
+	default:
+		// Heavier faces first, then lighter
+		if have > want {
+			return have - want
+		}
+		return 1000 + want - have
+	}
+}
+
+// parseFamilyList splits a CSS font-family value into lower-cased family names
+func parseFamilyList(value string) []string {
+	var families []string
+	for _, part := range strings.Split(value, ",") {
+		name := strings.ToLower(strings.Trim(strings.TrimSpace(part), `"'`))
+		if name != "" {
+			families = append(families, name)
+		}
+	}
+	return families
+}
+
+// isItalicStyle reports whether a CSS font-style selects an italic face
+func isItalicStyle(style string) bool {
+	style = strings.ToLower(style)
+	return style == "italic" || style == "oblique"
+}
+
+// faceID builds a stable identifier for a face from its family, weight and style
+func faceID(info FontInfo) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(info.Family) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	fmt.Fprintf(&b, "-%d", info.Weight)
+	if info.Italic {
+		b.WriteString("-italic")
+	}
+	return b.String()
+}
+
+// fontName returns the first non-empty name table entry among ids
+func fontName(f *sfnt.Font, ids ...sfnt.NameID) string {
+	var buf sfnt.Buffer
+	for _, id := range ids {
+		if name, err := f.Name(&buf, id); err == nil && strings.TrimSpace(name) != "" {
+			return strings.TrimSpace(name)
+		}
+	}
+	return ""
+}
+
+// readOS2 reads the weight class and italic flag from a font's OS/2 table
+func readOS2(data []byte) (weight int, italic bool, ok bool) {
+	if len(data) < 12 {
+		return 0, false, false
+	}
+
+	numTables := int(binary.BigEndian.Uint16(data[4:6]))
+	for i := 0; i < numTables; i++ {
+		record := 12 + i*16
+		if record+16 > len(data) {
+			return 0, false, false
+		}
+		if !bytes.Equal(data[record:record+4], []byte("OS/2")) {
+			continue
+		}
+
+		offset := int(binary.BigEndian.Uint32(data[record+8 : record+12]))
+		if offset+64 > len(data) {
+			return 0, false, false
+		}
+		table := data[offset:]
+		weight = int(binary.BigEndian.Uint16(table[4:6]))
+		selection := binary.BigEndian.Uint16(table[62:64])
+		italic = selection&0x0001 != 0 || selection&0x0200 != 0 // ITALIC or OBLIQUE
+		if weight < 1 || weight > 1000 {
+			return 0, false, false
+		}
+		return weight, italic, true
+	}
+
+	return 0, false, false
+}
+
+// parseSubfamily derives weight and style from a subfamily name such as "Semibold Italic"
+func parseSubfamily(subfamily string) (weight int, italic bool) {
+	name := strings.ToLower(strings.ReplaceAll(subfamily, " ", ""))
+	italic = strings.Contains(name, "italic") || strings.Contains(name, "oblique")
+
+	weight = 400
+	for _, w := range []struct {
+		keyword string
+		weight  int
+	}{
+		{"thin", 100}, {"hairline", 100},
+		{"extralight", 200}, {"ultralight", 200},
+		{"semibold", 600}, {"demibold", 600},
+		{"extrabold", 800}, {"ultrabold", 800},
+		{"black", 900}, {"heavy", 900},
+		{"light", 300}, {"medium", 500}, {"bold", 700},
+	} {
+		if strings.Contains(name, w.keyword) {
+			return w.weight, italic
+		}
+	}
+
+	return weight, italic
+}
+
+// maxReportedGlyphs bounds how many missing characters a warning lists
+const maxReportedGlyphs = 20
+
+// missingGlyphWarnings describes characters that no available font could draw
+func missingGlyphWarnings(missing map[rune]bool) []string {
+	if len(missing) == 0 {
+		return nil
+	}
+
+	runes := make([]rune, 0, len(missing))
+	for r := range missing {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+
+	listed := make([]string, 0, maxReportedGlyphs)
+	for _, r := range runes[:min(len(runes), maxReportedGlyphs)] {
+		listed = append(listed, fmt.Sprintf("U+%04X", r))
+	}
+	if len(runes) > maxReportedGlyphs {
+		listed = append(listed, fmt.Sprintf("and %d more", len(runes)-maxReportedGlyphs))
+	}
+
+	return []string{fmt.Sprintf("no available font has glyphs for %d character(s): %s",
+		len(runes), strings.Join(listed, ", "))}
+}
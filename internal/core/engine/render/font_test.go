@@ -0,0 +1,139 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+
+	"print-service/internal/core/domain"
+)
+
+// testFonts returns a font manager with the regular, bold and italic Go faces
+// registered as the family "Go" and the monospaced face as "Go Mono"
+func testFonts(t *testing.T) *FontManager {
+	t.Helper()
+	fm := NewFontManager()
+	for name, data := range map[string][]byte{
+		"Go-Regular.ttf": goregular.TTF, "Go-Bold.ttf": gobold.TTF,
+		"Go-Italic.ttf": goitalic.TTF, "Go-Mono.ttf": gomono.TTF,
+	} {
+		if _, err := fm.Register(name, data); err != nil {
+			t.Fatalf("Register(%q) error = %v", name, err)
+		}
+	}
+	return fm
+}
+
+func TestFontManagerRegister(t *testing.T) {
+	fm := NewFontManager()
+	// Go Bold declares the weight class 600 in its OS/2 table
+	info, err := fm.Register("Go-Bold.ttf", gobold.TTF)
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if info.Family != "Go" || info.Weight != 600 || info.Italic || info.ID != "go-600" {
+		t.Errorf("Register() = %s %d italic=%v (%s), want Go 600 upright (go-600)", info.Family, info.Weight, info.Italic, info.ID)
+	}
+
+	// The first file registered for a face wins
+	if again, err := fm.Register("copy/Go-Bold.ttf", gobold.TTF); err != nil || again.Path != "Go-Bold.ttf" {
+		t.Errorf("Register() of a duplicate = %q, %v; want the first file", again.Path, err)
+	}
+	if _, err := fm.Register("broken.ttf", []byte("not a font")); err == nil {
+		t.Error("Register() of an invalid file succeeded, want an error")
+	}
+	if got := fm.Families(); len(got) != 1 || got[0] != "Go" {
+		t.Errorf("Families() = %q, want [Go]", got)
+	}
+}
+
+func TestFontManagerResolve(t *testing.T) {
+	fm := testFonts(t)
+	tests := []struct {
+		family string
+		weight int
+		style  string
+		want   string
+	}{
+		{"Go", 400, "normal", "go-400"},
+		{"'Unknown Sans', \"go\", serif", 400, "", "go-400"},
+		{"Go", 700, "", "go-600"},
+		{"Go", 600, "", "go-600"},
+		{"Go", 900, "", "go-600"},
+		{"Go", 300, "", "go-400"},
+		{"Go", 400, "italic", "go-400-italic"},
+		{"Go", 700, "oblique", "go-400-italic"},
+		{"Go Mono, Go", 400, "", "gomono-400"},
+		{"serif", 400, "", ""},
+		{"monospace, Go", 400, "", ""},
+	}
+	for _, tt := range tests {
+		info, ok := fm.Resolve(tt.family, tt.weight, tt.style)
+		if got := map[bool]string{true: info.ID}[ok]; got != tt.want {
+			t.Errorf("Resolve(%q, %d, %q) = %q, want %q", tt.family, tt.weight, tt.style, got, tt.want)
+		}
+	}
+
+	// Fallback families are tried after the requested ones
+	fm.SetFallbacks([]string{"Missing", " Go "})
+	if info, ok := fm.Resolve("serif", 700, ""); !ok || info.ID != "go-600" {
+		t.Errorf("Resolve() with fallbacks = %q, %v; want go-600", info.ID, ok)
+	}
+}
+
+func TestFontManagerFallbacks(t *testing.T) {
+	fm := testFonts(t)
+	fm.SetFallbacks([]string{"Go"})
+	var ids []string
+	for _, face := range fm.Fallbacks(700, "", true) {
+		ids = append(ids, face.ID)
+	}
+	if got := strings.Join(ids, " "); got != "go-600 gomono-600" {
+		t.Errorf("Fallbacks() = %s, want the configured family then the bundled monospaced face", got)
+	}
+	if face := fm.Fallbacks(400, "", false)[1]; !fm.HasGlyph(face, 'Ж') || fm.HasGlyph(face, '漢') {
+		t.Errorf("HasGlyph() of %s disagrees with its Cyrillic-only coverage", face.ID)
+	}
+}
+
+func TestMissingGlyphWarnings(t *testing.T) {
+	if got := missingGlyphWarnings(nil); got != nil {
+		t.Errorf("missingGlyphWarnings(nil) = %q, want none", got)
+	}
+	got := missingGlyphWarnings(map[rune]bool{'漢': true, '字': true})
+	if len(got) != 1 || got[0] != "no available font has glyphs for 2 character(s): U+5B57, U+6F22" {
+		t.Errorf("missingGlyphWarnings() = %q", got)
+	}
+
+	many := make(map[rune]bool)
+	for r := rune(0x4E00); r < 0x4E00+25; r++ {
+		many[r] = true
+	}
+	if got := missingGlyphWarnings(many); !strings.HasSuffix(got[0], ", and 5 more") {
+		t.Errorf("missingGlyphWarnings() of 25 characters = %q, want the first 20 listed", got)
+	}
+}
+
+func TestPDFRendererEmbedsFonts(t *testing.T) {
+	output := renderTestPDF(t, `<p style="font-family: Go; font-weight: bold">Embedded</p>`,
+		domain.DefaultPrintOptions(), PDFRenderOptions{EmbedFonts: true, Fonts: testFonts(t)})
+	file, pages := testPages(t, output.Data)
+	if len(pages) != 1 {
+		t.Fatalf("Render() = %d pages, want 1", len(pages))
+	}
+
+	pdf := string(output.Data)
+	if !strings.Contains(pdf, "/FontFile2") {
+		t.Error("registered font is not embedded")
+	}
+	if !strings.Contains(pdf, "go-600") {
+		t.Error("embedded font is not the bold face")
+	}
+	if content := testPageContent(t, file, pages[0]); strings.Contains(content, "(Embedded) Tj") {
+		t.Error("text is drawn with a core font, want glyph IDs of the embedded face")
+	}
+}
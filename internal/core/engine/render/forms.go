@@ -0,0 +1,682 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/layout"
+)
+
+// Kinds of form fields
+const (
+	fieldText     = "text"
+	fieldCheckbox = "checkbox"
+	fieldRadio    = "radio"
+	fieldChoice   = "choice"
+)
+
+// Field flags of interactive form fields
+const (
+	fieldFlagReadOnly    = 1 << 0
+	fieldFlagRequired    = 1 << 1
+	fieldFlagMultiline   = 1 << 12
+	fieldFlagPassword    = 1 << 13
+	fieldFlagNoToggleOff = 1 << 14
+	fieldFlagRadio       = 1 << 15
+	fieldFlagCombo       = 1 << 17
+	fieldFlagMultiSelect = 1 << 21
+)
+
+// formWidgetFlags marks field widgets as printable
+const formWidgetFlags = 4
+
+// checkboxOnState is the on state of a check box without a value
+const checkboxOnState = "Yes"
+
+// listHighlight is the background of the selected options of a list box
+var listHighlight = domain.Color{R: 153, G: 193, B: 218, A: 255}
+
+// appearanceFonts maps core font families and weights to the standard fonts
+// and resource names used in field appearances
+var appearanceFonts = map[string][2]string{
+	"Arial":    {"Helv", "Helvetica"},
+	"ArialB":   {"HeBo", "Helvetica-Bold"},
+	"Times":    {"TiRo", "Times-Roman"},
+	"TimesB":   {"TiBo", "Times-Bold"},
+	"Courier":  {"Cour", "Courier"},
+	"CourierB": {"CoBo", "Courier-Bold"},
+}
+
+// pdfFieldOption is an option of a select
+type pdfFieldOption struct {
+	value    string // Export value
+	label    string // Text shown
+	selected bool
+}
+
+// pdfFieldLine is a line of text shown in a field, with its baseline start
+// in points from the bottom-left corner of the widget
+type pdfFieldLine struct {
+	text string
+	x, y float64
+}
+
+// pdfField is a form control and the widget it becomes
+type pdfField struct {
+	node     *domain.LayoutNode
+	kind     string
+	name     string // Partial field name; radio buttons carry the name of their group
+	tooltip  string
+	value    string // Text of a text field, or on state of a check box or radio button
+	checked  bool
+	options  []pdfFieldOption
+	flags    int
+	maxLen   int
+	page     int        // 1-based page of the widget, 0 until drawn
+	rect     [4]float64 // Widget rectangle in points
+	size     float64    // Font size in points
+	border   float64    // Border width in points
+	leading  float64    // Line height in points
+	inset    float64    // Distance of the text from the top and left edges in points
+	lines    []pdfFieldLine
+	obj      int // Widget object number, assigned when written
+	radioObj int // Radio group object number, for radio buttons
+}
+
+// pdfForms collects the form controls of a document and writes them as
+// interactive AcroForm fields, unless they are flattened into page content
+type pdfForms struct {
+	fields  []*pdfField
+	nodes   map[*domain.LayoutNode]*pdfField
+	flatten bool
+}
+
+// newPDFForms collects the form controls of a layout tree
+func newPDFForms(root *domain.LayoutNode, flatten bool) *pdfForms {
+	f := &pdfForms{nodes: make(map[*domain.LayoutNode]*pdfField), flatten: flatten}
+	if root != nil {
+		labels := make(map[string]string)
+		collectLabels(root, labels)
+		f.collect(root, "", labels, make(map[string]bool), make(map[string]string))
+	}
+	return f
+}
+
+// collectLabels records the text of label elements by the id they are for
+func collectLabels(node *domain.LayoutNode, labels map[string]string) {
+	if node.Tag == "label" && node.Attributes["for"] != "" {
+		labels[node.Attributes["for"]] = nodeText(node)
+	}
+	for _, child := range node.Children {
+		collectLabels(child, labels)
+	}
+}
+
+// nodeText joins the text below a node, leaving out the content of form controls
+func nodeText(node *domain.LayoutNode) string {
+	if node.Type == "text" {
+		return node.Content
+	}
+	if layout.IsFormControl(node) {
+		return ""
+	}
+	var parts []string
+	for _, child := range node.Children {
+		if text := nodeText(child); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// collect adds the form controls at a node and below it. label is the text
+// of the label element the node is in.
+func (f *pdfForms) collect(node *domain.LayoutNode, label string, labels map[string]string, names map[string]bool, groups map[string]string) {
+	if !layout.IsFormControl(node) {
+		if node.Tag == "label" {
+			label = nodeText(node)
+		}
+		for _, child := range node.Children {
+			f.collect(child, label, labels, names, groups)
+		}
+		return
+	}
+
+	attrs := node.Attributes
+	field := &pdfField{node: node, kind: fieldText}
+	switch node.Tag {
+	case "textarea":
+		field.value = strings.TrimRight(controlText(node), "\n")
+		field.flags |= fieldFlagMultiline
+	case "select":
+		field.kind = fieldChoice
+		field.options = selectOptions(node)
+		if !layout.IsListSelect(node) {
+			field.flags |= fieldFlagCombo
+		} else if _, ok := attrs["multiple"]; ok {
+			field.flags |= fieldFlagMultiSelect
+		}
+	default:
+		switch inputType := layout.InputType(attrs); inputType {
+		case "checkbox", "radio":
+			field.kind = inputType
+			field.value = attrs["value"]
+			_, field.checked = attrs["checked"]
+			if field.value == "" {
+				field.value = checkboxOnState
+			}
+		case "password":
+			field.flags |= fieldFlagPassword // The value is never written
+		default:
+			field.value = attrs["value"]
+		}
+	}
+	if field.kind == fieldText {
+		field.maxLen = intAttribute(attrs, "maxlength")
+	}
+	if _, ok := attrs["readonly"]; ok {
+		field.flags |= fieldFlagReadOnly
+	}
+	if _, ok := attrs["disabled"]; ok {
+		field.flags |= fieldFlagReadOnly
+	}
+	if _, ok := attrs["required"]; ok {
+		field.flags |= fieldFlagRequired
+	}
+
+	// The tooltip is what a screen reader announces for the field
+	for _, tooltip := range []string{attrs["title"], labels[attrs["id"]], label, attrs["placeholder"], attrs["name"]} {
+		if tooltip = strings.TrimSpace(tooltip); tooltip != "" {
+			field.tooltip = tooltip
+			break
+		}
+	}
+
+	field.name = f.fieldName(field, names, groups)
+	f.fields = append(f.fields, field)
+	f.nodes[node] = field
+}
+
+// fieldName returns a unique partial name for a field. Radio buttons with
+// the same name share the name of their group.
+func (f *pdfForms) fieldName(field *pdfField, names map[string]bool, groups map[string]string) string {
+	// Periods separate the parts of fully qualified field names
+	name := strings.ReplaceAll(strings.TrimSpace(field.node.Attributes["name"]), ".", "_")
+	if group, ok := groups[name]; ok && field.kind == fieldRadio && name != "" {
+		return group
+	}
+
+	base := name
+	if base == "" {
+		base = fmt.Sprintf("Field%d", len(f.fields)+1)
+	}
+	unique := base
+	for i := 2; names[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", base, i)
+	}
+	names[unique] = true
+	if field.kind == fieldRadio && name != "" {
+		groups[name] = unique
+	}
+	return unique
+}
+
+// controlText joins the text content of a form control
+func controlText(node *domain.LayoutNode) string {
+	var b strings.Builder
+	for _, child := range node.Children {
+		if child.Type == "text" {
+			b.WriteString(child.Content)
+		} else {
+			b.WriteString(controlText(child))
+		}
+	}
+	return b.String()
+}
+
+// selectOptions returns the options of a select. A drop-down list without a
+// selected option shows its first one, as in browsers.
+func selectOptions(node *domain.LayoutNode) []pdfFieldOption {
+	var options []pdfFieldOption
+	var walk func(node *domain.LayoutNode)
+	walk = func(node *domain.LayoutNode) {
+		for _, child := range node.Children {
+			if child.Tag != "option" {
+				walk(child)
+				continue
+			}
+			label := strings.Join(strings.Fields(controlText(child)), " ")
+			if attr, ok := child.Attributes["label"]; ok {
+				label = attr
+			}
+			value, ok := child.Attributes["value"]
+			if !ok {
+				value = label
+			}
+			_, selected := child.Attributes["selected"]
+			options = append(options, pdfFieldOption{value: value, label: label, selected: selected})
+		}
+	}
+	walk(node)
+
+	if layout.IsListSelect(node) || len(options) == 0 {
+		return options
+	}
+	selected := 0
+	for i, option := range options {
+		if option.selected {
+			selected = i // The last selected option wins
+		}
+		options[i].selected = false
+	}
+	options[selected].selected = true
+	return options
+}
+
+// intAttribute parses a positive integer attribute, or returns 0
+func intAttribute(attributes map[string]string, name string) int {
+	var value int
+	if _, err := fmt.Sscanf(strings.TrimSpace(attributes[name]), "%d", &value); err != nil || value < 0 {
+		return 0
+	}
+	return value
+}
+
+// Field returns the field of a form control, or nil for other nodes
+func (f *pdfForms) Field(node *domain.LayoutNode) *pdfField {
+	if f == nil {
+		return nil
+	}
+	return f.nodes[node]
+}
+
+// renderField places the widget of a form control on the page it starts on.
+// Flattened fields are drawn there as their widget would show them, with the
+// document fonts.
+func (r *PDFRenderer) renderField(field *pdfField, ctx RenderContext) {
+	if field.page != 0 {
+		return
+	}
+	x, y, w, h := ctx.ToPage(field.node.Box)
+	k := ctx.PDF.GetConversionRatio()
+	field.page = ctx.CurrentPage
+	field.rect = [4]float64{x * k, (ctx.PageHeight - y - h) * k, (x + w) * k, (ctx.PageHeight - y) * k}
+
+	style := field.node.Style
+	field.size = PixelsToPoints(style.Font.Size) * ctx.Scale
+	field.border = PixelsToPoints(style.Border.Width) * ctx.Scale
+	field.leading = PixelsToPoints(style.Font.Size*style.Text.LineHeight) * ctx.Scale
+	field.inset = PixelsToPoints(style.Border.Width+style.Padding.Left) * ctx.Scale
+	field.lines = r.fieldLines(field)
+	if !ctx.Forms.flatten {
+		return
+	}
+
+	ctx.Tags.BeginArtifact(ctx.PDF)
+	ctx.PDF.RawWriteStr(fmt.Sprintf("q 1 0 0 1 %.2f %.2f cm %s Q", field.rect[0], field.rect[1], field.decoration(field.checked, ctx.Colors)))
+	ctx.Tags.End(ctx.PDF)
+	if len(field.lines) == 0 {
+		return
+	}
+
+	ctx.Tags.BeginText(field.node, ctx)
+	defer ctx.Tags.End(ctx.PDF)
+	clip := field.border / k
+	ctx.PDF.ClipRect(x+clip, y+clip, w-2*clip, h-2*clip, false)
+	defer ctx.PDF.ClipEnd()
+	ctx.SetFill(style.Color)
+	chain := r.fontChain(style.Font, ctx)
+	for _, line := range field.lines {
+		runs := r.shapeLine(line.text, style.Text.Direction, chain, ctx)
+		r.drawRuns(runs, (field.rect[0]+line.x)/k, ctx.PageHeight-(field.rect[1]+line.y)/k, field.size, ctx)
+	}
+}
+
+// fieldLines lays out the text a field shows: its value, the selected
+// option of a drop-down list or every option of a list box
+func (r *PDFRenderer) fieldLines(field *pdfField) []pdfFieldLine {
+	var texts []string
+	switch field.kind {
+	case fieldCheckbox, fieldRadio:
+		return nil
+	case fieldChoice:
+		for _, option := range field.options {
+			if option.selected || field.flags&fieldFlagCombo == 0 {
+				texts = append(texts, option.label)
+			}
+		}
+	default:
+		if field.flags&fieldFlagMultiline == 0 {
+			texts = []string{field.value}
+			break
+		}
+		width := layout.ContentWidth(field.node)
+		for _, paragraph := range strings.Split(field.value, "\n") {
+			texts = append(texts, r.textEngine.SplitTextIntoLines(paragraph, field.node.Style.Font, width)...)
+		}
+	}
+
+	height := field.rect[3] - field.rect[1]
+	var lines []pdfFieldLine
+	for i, text := range texts {
+		if text == "" {
+			continue
+		}
+		y := height - field.inset - float64(i)*field.leading - baselineOffset(field.size, field.leading)
+		if len(texts) == 1 && field.flags&fieldFlagMultiline == 0 {
+			y = height - baselineOffset(field.size, height) // Single lines are centered vertically
+		}
+		lines = append(lines, pdfFieldLine{text: text, x: field.inset, y: y})
+	}
+	return lines
+}
+
+// decoration returns the content stream operators drawing the background,
+// border and state of a field in a box of its size
+func (f *pdfField) decoration(on bool, colors *colorConverter) string {
+	w, h := f.rect[2]-f.rect[0], f.rect[3]-f.rect[1]
+	style := f.node.Style
+	shape := func(inset float64) string {
+		if f.kind == fieldRadio {
+			return circlePath(w/2, h/2, math.Min(w, h)/2-inset)
+		}
+		return fmt.Sprintf("%.2f %.2f %.2f %.2f re", inset, inset, w-2*inset, h-2*inset)
+	}
+
+	var ops []string
+	if style.Background.Color.A != 0 {
+		ops = append(ops, colors.operator(style.Background.Color, false), shape(0), "f")
+	}
+	if f.kind == fieldChoice && f.flags&fieldFlagCombo == 0 {
+		ops = append(ops, colors.operator(listHighlight, false))
+		for i, option := range f.options {
+			if option.selected {
+				ops = append(ops, fmt.Sprintf("%.2f %.2f %.2f %.2f re f", f.border, h-f.inset-float64(i+1)*f.leading, w-2*f.border, f.leading))
+			}
+		}
+	}
+	if f.border > 0 && style.Border.Style != domain.BorderNone {
+		ops = append(ops, colors.operator(style.Border.Color, true), fmt.Sprintf("%.2f w", f.border), shape(f.border/2), "S")
+	}
+	if on {
+		ops = append(ops, colors.operator(style.Color, f.kind == fieldCheckbox))
+		size := math.Min(w, h)
+		if f.kind == fieldRadio {
+			ops = append(ops, circlePath(w/2, h/2, size/4), "f")
+		} else {
+			ops = append(ops, fmt.Sprintf("1 J 1 j %.2f w %.2f %.2f m %.2f %.2f l %.2f %.2f l S",
+				size/8, w/2-size*0.3, h/2, w/2-size*0.1, h/2-size*0.22, w/2+size*0.3, h/2+size*0.25))
+		}
+	}
+	return strings.Join(ops, " ")
+}
+
+// circlePath returns a closed path approximating a circle with four Bézier curves
+func circlePath(cx, cy, radius float64) string {
+	c := radius * 0.5523
+	return fmt.Sprintf("%.2f %.2f m %.2f %.2f %.2f %.2f %.2f %.2f c %.2f %.2f %.2f %.2f %.2f %.2f c "+
+		"%.2f %.2f %.2f %.2f %.2f %.2f c %.2f %.2f %.2f %.2f %.2f %.2f c h",
+		cx+radius, cy,
+		cx+radius, cy+c, cx+c, cy+radius, cx, cy+radius,
+		cx-c, cy+radius, cx-radius, cy+c, cx-radius, cy,
+		cx-radius, cy-c, cx-c, cy-radius, cx, cy-radius,
+		cx+c, cy-radius, cx+radius, cy-c, cx+radius, cy)
+}
+
+// appearanceFont returns the resource name and standard font that show the
+// text of a field in the closest core font
+func (r *PDFRenderer) appearanceFont(font domain.FontStyle) (string, string) {
+	key := r.mapFontFamily(font.Family)
+	if font.Weight >= 700 {
+		key += "B"
+	}
+	entry := appearanceFonts[key]
+	return entry[0], entry[1]
+}
+
+// appearanceText encodes text for a standard font with WinAnsiEncoding as a
+// literal string, replacing characters it lacks
+func appearanceText(text string) string {
+	encoded := encodeRun(pdfFace{}, []rune(text))
+	return "(" + strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`, "\r", `\r`).Replace(encoded) + ")"
+}
+
+// choiceEntries returns the options and selection of a choice field. Options
+// whose export value differs from their text are written as pairs.
+func choiceEntries(options []pdfFieldOption, multiple bool) string {
+	var opts, values, indices []string
+	for i, option := range options {
+		if option.value == option.label {
+			opts = append(opts, pdfString(option.label))
+		} else {
+			opts = append(opts, fmt.Sprintf("[%s %s]", pdfString(option.value), pdfString(option.label)))
+		}
+		if option.selected {
+			values = append(values, pdfString(option.value))
+			indices = append(indices, strconv.Itoa(i))
+		}
+	}
+
+	entries := fmt.Sprintf(" /Opt [%s]", strings.Join(opts, " "))
+	switch {
+	case len(values) == 0:
+	case multiple:
+		value := "[" + strings.Join(values, " ") + "]"
+		entries += fmt.Sprintf(" /V %s /DV %s /I [%s]", value, value, strings.Join(indices, " "))
+	default:
+		entries += fmt.Sprintf(" /V %s /DV %s /I [%s]", values[0], values[0], indices[0])
+	}
+	return entries
+}
+
+// fieldColorArray returns a color as the component array of an appearance
+// characteristics entry
+func fieldColorArray(col domain.Color, colors *colorConverter) string {
+	values := colors.convert(col.R, col.G, col.B)
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%.3f", math.Max(0, math.Min(1, v)))
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// Write adds the fields, their widgets and appearance streams, and the
+// interactive form listing them. Flattened forms write nothing.
+func (f *pdfForms) Write(update *pdfUpdate, r *PDFRenderer, colors *colorConverter) error {
+	if f.flatten || len(f.fields) == 0 {
+		return nil
+	}
+	pages, err := update.Pages()
+	if err != nil {
+		return err
+	}
+
+	form, err := acroForm(update)
+	if err != nil {
+		return err
+	}
+	fonts := make(map[string]int) // Standard font objects by resource name
+	addFont := func(name, base string) int {
+		if fonts[name] == 0 {
+			fonts[name] = update.Add(fmt.Sprintf("<</Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding>>", base))
+		}
+		return fonts[name]
+	}
+
+	// Radio buttons are the widgets of a field per group
+	type radioGroup struct {
+		obj     int
+		tooltip string
+		value   string // State of the checked button
+		kids    []string
+		states  map[string]bool
+	}
+	groups := make(map[string]*radioGroup)
+	var groupOrder []string
+
+	for _, field := range f.fields {
+		if field.page == 0 {
+			continue // Never drawn
+		}
+		page := pages[field.page-1]
+		style := field.node.Style
+		w, h := field.rect[2]-field.rect[0], field.rect[3]-field.rect[1]
+		bbox := fmt.Sprintf("/Type /XObject /Subtype /Form /BBox [0 0 %.2f %.2f]", w, h)
+
+		// Appearance characteristics let readers redraw the widget alike
+		var mk []string
+		if style.Border.Width > 0 && style.Border.Style != domain.BorderNone {
+			mk = append(mk, "/BC "+fieldColorArray(style.Border.Color, colors))
+		}
+		if style.Background.Color.A != 0 {
+			mk = append(mk, "/BG "+fieldColorArray(style.Background.Color, colors))
+		}
+
+		entries := fmt.Sprintf("/Type /Annot /Subtype /Widget /F %d /P %d 0 R /Rect [%.2f %.2f %.2f %.2f]",
+			formWidgetFlags, page, field.rect[0], field.rect[1], field.rect[2], field.rect[3])
+		field.obj = update.Reserve()
+
+		switch field.kind {
+		case fieldCheckbox, fieldRadio:
+			state := field.value
+			if field.kind == fieldRadio {
+				group := groups[field.name]
+				if group == nil {
+					group = &radioGroup{obj: update.Reserve(), tooltip: field.tooltip, value: "Off", states: make(map[string]bool)}
+					groups[field.name] = group
+					groupOrder = append(groupOrder, field.name)
+					if err := update.AppendToArray(form, "/Fields", fmt.Sprintf("%d 0 R", group.obj)); err != nil {
+						return err
+					}
+				}
+				field.radioObj = group.obj
+				for base, i := state, 2; group.states[state] || state == "Off"; i++ {
+					state = fmt.Sprintf("%s%d", base, i) // Buttons of a group need distinct states
+				}
+				group.states[state] = true
+				group.kids = append(group.kids, fmt.Sprintf("%d 0 R", field.obj))
+				if field.checked {
+					group.value = state // The last checked button wins
+				}
+			}
+
+			current := "/Off"
+			if field.checked {
+				current = pdfName(state)
+			}
+			on := update.AddStream(bbox, []byte(field.decoration(true, colors)))
+			off := update.AddStream(bbox, []byte(field.decoration(false, colors)))
+			caption := map[string]string{fieldCheckbox: "4", fieldRadio: "l"}[field.kind]
+			mk = append(mk, "/CA "+pdfString(caption))
+			entries += fmt.Sprintf(" /AS %s /AP <</N <<%s %d 0 R /Off %d 0 R>>>> /MK <<%s>>", current, pdfName(state), on, off, strings.Join(mk, " "))
+
+			if field.kind == fieldRadio {
+				entries += fmt.Sprintf(" /Parent %d 0 R", field.radioObj)
+			} else {
+				entries += fmt.Sprintf(" /FT /Btn /T %s /V %s /DV %s /Ff %d", pdfString(field.name), current, current, field.flags)
+				if field.tooltip != "" {
+					entries += " /TU " + pdfString(field.tooltip)
+				}
+			}
+
+		default:
+			name, base := r.appearanceFont(style.Font)
+			font := addFont(name, base)
+			da := fmt.Sprintf("/%s %.2f Tf %s", name, field.size, colors.operator(style.Color, false))
+
+			var text strings.Builder
+			fmt.Fprintf(&text, "%s /Tx BMC q %.2f %.2f %.2f %.2f re W n BT %s",
+				field.decoration(false, colors), field.border, field.border, w-2*field.border, h-2*field.border, da)
+			for _, line := range field.lines {
+				fmt.Fprintf(&text, " 1 0 0 1 %.2f %.2f Tm %s Tj", line.x, line.y, appearanceText(line.text))
+			}
+			text.WriteString(" ET Q EMC")
+			appearance := update.AddStream(fmt.Sprintf("%s /Resources <</Font <</%s %d 0 R>>>>", bbox, name, font), []byte(text.String()))
+
+			entries += fmt.Sprintf(" /T %s /DA %s /Ff %d /AP <</N %d 0 R>>", pdfString(field.name), pdfString(da), field.flags, appearance)
+			if field.tooltip != "" {
+				entries += " /TU " + pdfString(field.tooltip)
+			}
+			if len(mk) > 0 {
+				entries += " /MK <<" + strings.Join(mk, " ") + ">>"
+			}
+			if field.kind == fieldChoice {
+				entries += " /FT /Ch" + choiceEntries(field.options, field.flags&fieldFlagMultiSelect != 0)
+			} else {
+				entries += " /FT /Tx"
+				if field.value != "" && field.flags&fieldFlagPassword == 0 {
+					entries += fmt.Sprintf(" /V %s /DV %s", pdfString(field.value), pdfString(field.value))
+				}
+				if field.maxLen > 0 {
+					entries += fmt.Sprintf(" /MaxLen %d", field.maxLen)
+				}
+			}
+		}
+
+		update.Set(field.obj, "<<"+entries+">>")
+		if err := update.AppendToArray(page, "/Annots", fmt.Sprintf("%d 0 R", field.obj)); err != nil {
+			return err
+		}
+		if field.kind != fieldRadio {
+			if err := update.AppendToArray(form, "/Fields", fmt.Sprintf("%d 0 R", field.obj)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range groupOrder {
+		group := groups[name]
+		entries := fmt.Sprintf("/FT /Btn /T %s /Ff %d /V %s /DV %s /Kids [%s]", pdfString(name), fieldFlagRadio|fieldFlagNoToggleOff,
+			pdfName(group.value), pdfName(group.value), strings.Join(group.kids, " "))
+		if group.tooltip != "" {
+			entries += " /TU " + pdfString(group.tooltip)
+		}
+		update.Set(group.obj, "<<"+entries+">>")
+	}
+
+	// Readers lay out typed text with the default resources of the form
+	addFont("Helv", "Helvetica")
+	resources := make([]string, 0, len(fonts))
+	for name, obj := range fonts {
+		resources = append(resources, fmt.Sprintf("/%s %d 0 R", name, obj))
+	}
+	sort.Strings(resources)
+	return update.SetEntries(form, map[string]string{
+		"/DR": fmt.Sprintf("<</Font <<%s>>>>", strings.Join(resources, " ")),
+		"/DA": pdfString("/Helv 0 Tf 0 g"),
+	})
+}
+
+// acroForm returns the interactive form dictionary of a document, adding an
+// empty one to the catalog when there is none yet
+func acroForm(update *pdfUpdate) (int, error) {
+	catalog, err := update.Object(update.Root())
+	if err != nil {
+		return 0, err
+	}
+	var form int
+	if _, err := fmt.Sscanf(dictValue(catalog, "/AcroForm"), "%d 0 R", &form); err == nil {
+		return form, nil
+	}
+	form = update.Add("<</Fields []>>")
+	return form, update.SetEntries(update.Root(), map[string]string{"/AcroForm": fmt.Sprintf("%d 0 R", form)})
+}
+
+// Warnings describes form fields that could not be written as requested.
+// archival is set when PDF/A output flattened the form on its own.
+func (f *pdfForms) Warnings(archival, tagged bool) []string {
+	if len(f.fields) == 0 {
+		return nil
+	}
+	var warnings []string
+	if archival {
+		warnings = append(warnings, fmt.Sprintf("PDF/A does not allow the standard fonts of form field appearances: %d form field(s) were flattened", len(f.fields)))
+	} else if tagged && !f.flatten {
+		warnings = append(warnings, "form field appearances use standard fonts that are not embedded")
+	}
+	return warnings
+}
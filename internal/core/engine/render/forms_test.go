@@ -0,0 +1,96 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+// formDocument has a control of every kind
+const formDocument = `<form>` +
+	`<p><label for="full-name">Full name</label> <input id="full-name" name="name" value="Ada" maxlength="40" required></p>` +
+	`<p><input type="password" name="pin" value="1234" title="PIN"></p>` +
+	`<p><label><input type="checkbox" name="terms" checked> I agree</label></p>` +
+	`<p><input type="radio" name="plan" value="basic"> <input type="radio" name="plan" value="pro" checked></p>` +
+	`<p><select name="country"><option>UK</option><option value="fr" selected>France</option></select></p>` +
+	`<p><textarea name="notes" readonly>Call first</textarea> <input name="name" placeholder="Other name"></p>` +
+	`</form>`
+
+func TestPDFFormsCollect(t *testing.T) {
+	forms := newPDFForms(layoutTestHTML(t, formDocument, domain.DefaultPrintOptions()), false)
+
+	var got []string
+	for _, field := range forms.fields {
+		got = append(got, fmt.Sprintf("%s %s %q %q checked=%v flags=%d", field.kind, field.name, field.value, field.tooltip, field.checked, field.flags))
+	}
+	want := []string{
+		fmt.Sprintf(`text name "Ada" "Full name" checked=false flags=%d`, fieldFlagRequired),
+		fmt.Sprintf(`text pin "" "PIN" checked=false flags=%d`, fieldFlagPassword),
+		`checkbox terms "Yes" "I agree" checked=true flags=0`,
+		`radio plan "basic" "plan" checked=false flags=0`,
+		`radio plan "pro" "plan" checked=true flags=0`,
+		fmt.Sprintf(`choice country "" "country" checked=false flags=%d`, fieldFlagCombo),
+		fmt.Sprintf(`text notes "Call first" "notes" checked=false flags=%d`, fieldFlagMultiline|fieldFlagReadOnly),
+		`text name_2 "" "Other name" checked=false flags=0`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("fields =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if forms.fields[0].maxLen != 40 {
+		t.Errorf("maxLen = %d, want 40", forms.fields[0].maxLen)
+	}
+}
+
+func TestPDFRendererForms(t *testing.T) {
+	output := renderTestPDF(t, formDocument, domain.DefaultPrintOptions(), PDFRenderOptions{})
+	pdf := string(output.Data)
+	for _, want := range []string{
+		"/AcroForm",
+		"/T (name) /DA",
+		"/FT /Tx /V (Ada) /DV (Ada) /MaxLen 40",
+		"/FT /Btn /T (terms) /V /Yes",
+		"/FT /Btn /T (plan) /Ff 49152 /V /pro",
+		"/FT /Ch",
+	} {
+		if !strings.Contains(pdf, want) {
+			t.Errorf("PDF has no %s", want)
+		}
+	}
+	if strings.Contains(pdf, "1234") {
+		t.Error("password value is written")
+	}
+	if len(output.Warnings) != 0 {
+		t.Errorf("warnings = %q, want none", output.Warnings)
+	}
+
+	// Every widget is an annotation of the page it is drawn on
+	file, pages := testPages(t, output.Data)
+	if widgets := annotations(t, file, pages[0]); len(widgets) != 8 {
+		t.Errorf("page has %d widgets, want 8", len(widgets))
+	}
+}
+
+func TestPDFRendererFlattenForms(t *testing.T) {
+	options := domain.DefaultPrintOptions()
+	options.Render.FlattenForms = true
+	output := renderTestPDF(t, formDocument, options, PDFRenderOptions{})
+	if strings.Contains(string(output.Data), "/AcroForm") {
+		t.Error("flattened form is written as fields")
+	}
+	file, pages := testPages(t, output.Data)
+	text := strings.Join(shownText(testPageContent(t, file, pages[0])), "|")
+	for _, want := range []string{"Ada", "France", "Call first"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("page text %q does not show the field value %q", text, want)
+		}
+	}
+
+	// PDF/A flattens forms as its fonts cannot be embedded in fields
+	output = renderTestPDF(t, formDocument, archivalOptions(domain.PDFA2B), PDFRenderOptions{})
+	want := "PDF/A does not allow the standard fonts of form field appearances: 8 form field(s) were flattened"
+	if got := strings.Join(output.Warnings, "|"); got != want {
+		t.Errorf("PDF/A warnings = %q, want %q", got, want)
+	}
+}
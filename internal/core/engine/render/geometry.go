@@ -0,0 +1,86 @@
+package render
+
+import (
+	"print-service/internal/core/domain"
+)
+
+// CSS reference units: layout boxes are measured in CSS pixels (96 per inch)
+const (
+	pixelsPerInch = 96.0
+	pointsPerInch = 72.0
+	mmPerInch     = 25.4
+)
+
+// PixelsToMM converts CSS pixels to millimetres
+func PixelsToMM(px float64) float64 {
+	return px * mmPerInch / pixelsPerInch
+}
+
+// MMToPixels converts millimetres to CSS pixels
+func MMToPixels(mm float64) float64 {
+	return mm * pixelsPerInch / mmPerInch
+}
+
+// PixelsToPoints converts CSS pixels to PDF points
+func PixelsToPoints(px float64) float64 {
+	return px * pointsPerInch / pixelsPerInch
+}
+
+// PageGeometry describes the physical page a layout is rendered onto
+type PageGeometry struct {
+	Width   float64        // Page width in mm, after orientation
+	Height  float64        // Page height in mm, after orientation
+	Margins domain.Margins // Page margins in mm
+	Scale   float64        // Content scaling factor
+}
+
+// ContentWidth returns the printable width inside the margins in mm
+func (g PageGeometry) ContentWidth() float64 {
+	return g.Width - g.Margins.Left - g.Margins.Right
+}
+
+// ContentHeight returns the printable height inside the margins in mm
+func (g PageGeometry) ContentHeight() float64 {
+	return g.Height - g.Margins.Top - g.Margins.Bottom
+}
+
+// ContentWidthPixels returns the printable width in CSS pixels before scaling
+func (g PageGeometry) ContentWidthPixels() float64 {
+	return MMToPixels(g.ContentWidth()) / g.Scale
+}
+
+// ContentHeightPixels returns the printable height in CSS pixels before scaling
+func (g PageGeometry) ContentHeightPixels() float64 {
+	return MMToPixels(g.ContentHeight()) / g.Scale
+}
+
+// ResolvePageGeometry applies defaults and orientation to page options
+func ResolvePageGeometry(opts domain.PageOptions) PageGeometry {
+	size := opts.Size
+	if size.Width <= 0 || size.Height <= 0 {
+		size = domain.A4
+	}
+
+	width, height := size.Width, size.Height
+	if opts.Orientation == domain.OrientationLandscape {
+		width, height = height, width
+	}
+
+	scale := opts.Scale
+	if scale <= 0 {
+		scale = 1.0
+	}
+
+	return PageGeometry{
+		Width:   width,
+		Height:  height,
+		Margins: opts.Margins,
+		Scale:   scale,
+	}
+}
+
+// baselineOffset returns the distance from the top of a line box to the text baseline
+func baselineOffset(fontSize, lineHeight float64) float64 {
+	// Half-leading above the glyphs plus an ascent of roughly 80% of the em box
+	return (lineHeight-fontSize)/2 + fontSize*0.8
+}
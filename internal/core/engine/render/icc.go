@@ -0,0 +1,387 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+)
+
+// ICC profile header fields
+const (
+	iccHeaderSize      = 128
+	iccColorSpaceStart = 16
+	iccSignatureStart  = 36
+	iccTagCountStart   = 128
+	iccTagEntrySize    = 12
+)
+
+// ICC color space signatures
+const (
+	iccSpaceRGB  = "RGB "
+	iccSpaceCMYK = "CMYK"
+	iccSpaceGray = "GRAY"
+)
+
+// sRGBIdentifier names the sRGB output condition in the ICC registry
+const sRGBIdentifier = "sRGB IEC61966-2.1"
+
+// iccD50 is the white point of the profile connection space
+var iccD50 = [3]float64{0.9642, 1.0, 0.8249}
+
+// sRGBColorants are the D50-adapted XYZ values of the sRGB red, green and blue primaries
+var sRGBColorants = [3][3]float64{
+	{0.4361, 0.2225, 0.0139},
+	{0.3851, 0.7169, 0.0971},
+	{0.1431, 0.0606, 0.7141},
+}
+
+// iccColorSpace returns the data color space signature of an ICC profile,
+// or "" when data is not a profile
+func iccColorSpace(profile []byte) string {
+	if len(profile) < iccHeaderSize || string(profile[iccSignatureStart:iccSignatureStart+4]) != "acsp" {
+		return ""
+	}
+	return string(profile[iccColorSpaceStart : iccColorSpaceStart+4])
+}
+
+// iccComponents returns the number of color components of an ICC profile
+func iccComponents(profile []byte) int {
+	switch iccColorSpace(profile) {
+	case iccSpaceGray:
+		return 1
+	case iccSpaceCMYK:
+		return 4
+	default:
+		return 3
+	}
+}
+
+// iccTag returns the data of a tag of an ICC profile, or nil when absent
+func iccTag(profile []byte, signature string) []byte {
+	if iccColorSpace(profile) == "" || len(profile) < iccTagCountStart+4 {
+		return nil
+	}
+
+	count := int(binary.BigEndian.Uint32(profile[iccTagCountStart:]))
+	for i := 0; i < count; i++ {
+		entry := iccTagCountStart + 4 + i*iccTagEntrySize
+		if entry+iccTagEntrySize > len(profile) {
+			break
+		}
+		if string(profile[entry:entry+4]) != signature {
+			continue
+		}
+		offset := int(binary.BigEndian.Uint32(profile[entry+4:]))
+		size := int(binary.BigEndian.Uint32(profile[entry+8:]))
+		if offset+size > len(profile) || size < 12 {
+			return nil
+		}
+		return profile[offset : offset+size]
+	}
+	return nil
+}
+
+// iccDescription reads the profile description tag of an ICC profile
+func iccDescription(profile []byte) string {
+	tag := iccTag(profile, "desc")
+	if tag == nil {
+		return ""
+	}
+
+	switch string(tag[:4]) {
+	case "desc":
+		// ICC v2 textDescriptionType: ASCII count then a NUL-terminated string
+		length := int(binary.BigEndian.Uint32(tag[8:]))
+		if 12+length > len(tag) {
+			return ""
+		}
+		return strings.TrimRight(string(tag[12:12+length]), "\x00")
+	case "mluc":
+		// ICC v4 multiLocalizedUnicodeType: the first record, in UTF-16BE
+		if len(tag) < 28 {
+			return ""
+		}
+		length := int(binary.BigEndian.Uint32(tag[20:]))
+		start := int(binary.BigEndian.Uint32(tag[24:]))
+		if start+length > len(tag) {
+			return ""
+		}
+		runes := make([]rune, 0, length/2)
+		for j := start; j+1 < start+length; j += 2 {
+			runes = append(runes, rune(binary.BigEndian.Uint16(tag[j:])))
+		}
+		return string(runes)
+	}
+	return ""
+}
+
+// sRGBProfile builds an ICC v2 display profile for sRGB IEC61966-2.1, used
+// as the default PDF/A output intent
+func sRGBProfile() []byte {
+	tags := []struct {
+		signature string
+		data      []byte
+	}{
+		{"desc", iccTextDescription(sRGBIdentifier)},
+		{"cprt", iccText("No copyright, use freely")},
+		{"wtpt", iccXYZ(iccD50)},
+		{"rXYZ", iccXYZ(sRGBColorants[0])},
+		{"gXYZ", iccXYZ(sRGBColorants[1])},
+		{"bXYZ", iccXYZ(sRGBColorants[2])},
+		{"rTRC", sRGBCurve()},
+		{"gTRC", nil}, // Shares the red curve
+		{"bTRC", nil},
+	}
+
+	// Tag data follows the header and tag table, 4-byte aligned
+	offset := iccTagCountStart + 4 + len(tags)*iccTagEntrySize
+	var table, data bytes.Buffer
+	_ = binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	var shared [2]uint32
+	for _, tag := range tags {
+		if tag.data == nil {
+			table.WriteString(tag.signature)
+			_ = binary.Write(&table, binary.BigEndian, shared)
+			continue
+		}
+		for data.Len()%4 != 0 {
+			data.WriteByte(0)
+		}
+		shared = [2]uint32{uint32(offset + data.Len()), uint32(len(tag.data))}
+		table.WriteString(tag.signature)
+		_ = binary.Write(&table, binary.BigEndian, shared)
+		data.Write(tag.data)
+	}
+
+	size := offset + data.Len()
+	header := make([]byte, iccHeaderSize)
+	binary.BigEndian.PutUint32(header[0:], uint32(size))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000) // Version 2.1
+	copy(header[12:], "mntr")
+	copy(header[iccColorSpaceStart:], iccSpaceRGB)
+	copy(header[20:], "XYZ ")
+	binary.BigEndian.PutUint16(header[24:], 2000) // Creation date: 2000-01-01
+	binary.BigEndian.PutUint16(header[26:], 1)
+	binary.BigEndian.PutUint16(header[28:], 1)
+	copy(header[iccSignatureStart:], "acsp")
+	copy(header[68:], iccXYZ(iccD50)[8:]) // PCS illuminant D50
+
+	profile := append(header, table.Bytes()...)
+	return append(profile, data.Bytes()...)
+}
+
+// sRGBCurve samples the sRGB transfer function as an ICC curveType
+func sRGBCurve() []byte {
+	const samples = 1024
+	var buf bytes.Buffer
+	buf.WriteString("curv")
+	_ = binary.Write(&buf, binary.BigEndian, [2]uint32{0, samples})
+	for i := 0; i < samples; i++ {
+		v := sRGBLinear(float64(i) / (samples - 1))
+		_ = binary.Write(&buf, binary.BigEndian, uint16(math.Round(v*65535)))
+	}
+	return buf.Bytes()
+}
+
+// sRGBLinear applies the sRGB transfer function to an encoded value in [0, 1]
+func sRGBLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// iccXYZ encodes an XYZType tag
+func iccXYZ(v [3]float64) []byte {
+	buf := []byte("XYZ \x00\x00\x00\x00")
+	for _, c := range v {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(int32(math.Round(c*65536))))
+	}
+	return buf
+}
+
+// iccText encodes a textType tag
+func iccText(text string) []byte {
+	return append([]byte("text\x00\x00\x00\x00"), text+"\x00"...)
+}
+
+// iccTextDescription encodes an ICC v2 textDescriptionType tag with only the ASCII description
+func iccTextDescription(text string) []byte {
+	buf := []byte("desc\x00\x00\x00\x00")
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(text)+1))
+	buf = append(buf, text+"\x00"...)
+	buf = append(buf, make([]byte, 4+4+2+1+67)...) // Empty Unicode and ScriptCode descriptions
+	return buf
+}
+
+// iccLUT is a lut8Type or lut16Type transform: per-channel input curves, a
+// multidimensional color table and per-channel output curves, all normalized
+// to [0, 1]
+type iccLUT struct {
+	inputs    int
+	outputs   int
+	grid      int
+	matrix    [9]float64 // Applied to XYZ input before the curves
+	curvesIn  [][]float64
+	table     []float64
+	curvesOut [][]float64
+	lut8      bool // 8-bit table, which encodes CIELAB differently
+}
+
+// parseICCLUT reads a lut8Type ("mft1") or lut16Type ("mft2") tag
+func parseICCLUT(tag []byte) *iccLUT {
+	if len(tag) < 52 {
+		return nil
+	}
+	lut := &iccLUT{inputs: int(tag[8]), outputs: int(tag[9]), grid: int(tag[10])}
+	if lut.inputs == 0 || lut.outputs == 0 || lut.grid < 2 {
+		return nil
+	}
+	for i := range lut.matrix {
+		lut.matrix[i] = float64(int32(binary.BigEndian.Uint32(tag[12+i*4:]))) / 65536
+	}
+
+	// Entry counts: lut8 tables always have 256 curve entries of one byte
+	width, inEntries, outEntries, start := 2, 0, 0, 52
+	switch string(tag[:4]) {
+	case "mft1":
+		lut.lut8, width, inEntries, outEntries, start = true, 1, 256, 256, 48
+	case "mft2":
+		inEntries = int(binary.BigEndian.Uint16(tag[48:]))
+		outEntries = int(binary.BigEndian.Uint16(tag[50:]))
+	default:
+		return nil
+	}
+
+	cells := lut.outputs
+	for i := 0; i < lut.inputs; i++ {
+		cells *= lut.grid
+	}
+	if start+(lut.inputs*inEntries+cells+lut.outputs*outEntries)*width > len(tag) {
+		return nil
+	}
+
+	read := func(count int) []float64 {
+		values := make([]float64, count)
+		for i := range values {
+			if width == 1 {
+				values[i] = float64(tag[start]) / 255
+			} else {
+				values[i] = float64(binary.BigEndian.Uint16(tag[start:])) / 65535
+			}
+			start += width
+		}
+		return values
+	}
+	for i := 0; i < lut.inputs; i++ {
+		lut.curvesIn = append(lut.curvesIn, read(inEntries))
+	}
+	lut.table = read(cells)
+	for i := 0; i < lut.outputs; i++ {
+		lut.curvesOut = append(lut.curvesOut, read(outEntries))
+	}
+	return lut
+}
+
+// Eval transforms normalized input values through the curves and table
+func (l *iccLUT) Eval(in []float64) []float64 {
+	// Locate the input in the grid, interpolating between neighbouring cells
+	cell := make([]int, l.inputs)
+	frac := make([]float64, l.inputs)
+	for i := 0; i < l.inputs; i++ {
+		v := iccCurve(l.curvesIn[i], in[i]) * float64(l.grid-1)
+		cell[i] = min(int(v), l.grid-2)
+		frac[i] = v - float64(cell[i])
+	}
+
+	out := make([]float64, l.outputs)
+	for corner := 0; corner < 1<<l.inputs; corner++ {
+		weight, index := 1.0, 0
+		for i := 0; i < l.inputs; i++ {
+			offset := corner >> (l.inputs - 1 - i) & 1
+			if offset == 1 {
+				weight *= frac[i]
+			} else {
+				weight *= 1 - frac[i]
+			}
+			index = index*l.grid + cell[i] + offset
+		}
+		if weight == 0 {
+			continue
+		}
+		for o := range out {
+			out[o] += weight * l.table[index*l.outputs+o]
+		}
+	}
+
+	for o := range out {
+		out[o] = iccCurve(l.curvesOut[o], out[o])
+	}
+	return out
+}
+
+// iccCurve looks up a value in a sampled curve, interpolating between samples
+func iccCurve(curve []float64, v float64) float64 {
+	if len(curve) < 2 {
+		return v
+	}
+	v = math.Max(0, math.Min(1, v)) * float64(len(curve)-1)
+	i := min(int(v), len(curve)-2)
+	return curve[i] + (curve[i+1]-curve[i])*(v-float64(i))
+}
+
+// iccTransform converts sRGB colors to the color space of an output profile
+// through its perceptual PCS-to-device table
+type iccTransform struct {
+	lut *iccLUT
+	lab bool // Profile connection space is CIELAB rather than XYZ
+}
+
+// newICCTransform prepares the conversion to an output profile, or returns
+// nil when the profile has no 8 or 16-bit perceptual table
+func newICCTransform(profile []byte) *iccTransform {
+	lut := parseICCLUT(iccTag(profile, "B2A0"))
+	if lut == nil || lut.inputs != 3 || lut.outputs != iccComponents(profile) {
+		return nil
+	}
+	return &iccTransform{lut: lut, lab: string(profile[20:24]) == "Lab "}
+}
+
+// Convert returns the device components of an 8-bit sRGB color
+func (t *iccTransform) Convert(r, g, b uint8) []float64 {
+	// sRGB to D50 XYZ through the same colorants as the embedded sRGB profile
+	linear := [3]float64{sRGBLinear(float64(r) / 255), sRGBLinear(float64(g) / 255), sRGBLinear(float64(b) / 255)}
+	var xyz [3]float64
+	for primary, c := range sRGBColorants {
+		for i := range xyz {
+			xyz[i] += c[i] * linear[primary]
+		}
+	}
+
+	if !t.lab {
+		// XYZ is encoded as u1Fixed15 and goes through the table's matrix first
+		in := make([]float64, 3)
+		for i := range in {
+			m := t.lut.matrix[i*3 : i*3+3]
+			in[i] = (m[0]*xyz[0] + m[1]*xyz[1] + m[2]*xyz[2]) * 32768 / 65535
+		}
+		return t.lut.Eval(in)
+	}
+
+	// CIELAB relative to the D50 white point
+	f := func(v float64) float64 {
+		if v > 216.0/24389 {
+			return math.Cbrt(v)
+		}
+		return v*24389/27/116 + 16.0/116
+	}
+	fx, fy, fz := f(xyz[0]/iccD50[0]), f(xyz[1]/iccD50[1]), f(xyz[2]/iccD50[2])
+	l, a, bb := 116*fy-16, 500*(fx-fy), 200*(fy-fz)
+
+	// Legacy encodings: lut16 maps L* 100 to 0xFF00 and a*, b* in 1/256 steps
+	if t.lut.lut8 {
+		return t.lut.Eval([]float64{l / 100, (a + 128) / 255, (bb + 128) / 255})
+	}
+	return t.lut.Eval([]float64{l / 100 * 0xFF00 / 0xFFFF, (a + 128) * 256 / 0xFFFF, (bb + 128) * 256 / 0xFFFF})
+}
@@ -3,27 +3,50 @@ package render
 import (
 	"bytes"
 	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
 	"image/jpeg"
 	"image/png"
+	"math"
+	"slices"
+	"strings"
 
 	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/layout"
 
 	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
 )
 
 // ImageRenderer handles image generation
 type ImageRenderer struct {
 	fontManager *FontManager
+	textEngine  *layout.TextEngine
+	pageBreaker *layout.PageBreaker
+	faces       map[string]*truetype.Font // Built-in faces keyed by family and style code
 	options     ImageRenderOptions
 }
 
 // ImageRenderOptions configures image rendering
 type ImageRenderOptions struct {
-	Antialias     bool
-	Interpolation InterpolationType
-	ColorSpace    ColorSpace
-	Quality       int
-	Optimization  bool
+	Antialias      bool
+	Interpolation  InterpolationType
+	ColorSpace     ColorSpace
+	Quality        int
+	Optimization   bool
+	Fonts          *FontManager // Registry of fonts available to text rendering
+	MaxImagePixels int64        // Largest width × height of a watermark image or page canvas, 0 for the default
 }
 
 // InterpolationType represents image interpolation types
@@ -50,89 +73,264 @@ type ImageRenderContext struct {
 	Canvas     *gg.Context
 	Width      int
 	Height     int
+	OriginX    float64 // Left edge of the content area in device pixels
+	OriginY    float64 // Top edge of the content area in device pixels
 	DPI        float64
 	Scale      float64
 	Background domain.Color
+	Missing    map[rune]bool // Characters no available font could draw
+}
+
+// ToCanvas converts a layout box in CSS pixels to device pixels on the canvas
+func (ctx ImageRenderContext) ToCanvas(box domain.Box) (x, y, w, h float64) {
+	return ctx.OriginX + ctx.Length(box.X),
+		ctx.OriginY + ctx.Length(box.Y),
+		ctx.Length(box.Width),
+		ctx.Length(box.Height)
+}
+
+// Length converts a length in CSS pixels to device pixels
+func (ctx ImageRenderContext) Length(px float64) float64 {
+	return px * ctx.Scale * ctx.DPI / pixelsPerInch
 }
 
 // NewImageRenderer creates a new image renderer
 func NewImageRenderer(opts ImageRenderOptions) *ImageRenderer {
+	fontManager := opts.Fonts
+	if fontManager == nil {
+		fontManager = NewFontManager()
+	}
 	return &ImageRenderer{
-		fontManager: NewFontManager(),
+		fontManager: fontManager,
+		textEngine:  layout.NewTextEngine(),
+		pageBreaker: layout.NewPageBreaker(),
+		faces:       loadBuiltinFaces(),
 		options:     opts,
 	}
 }
 
-// Render renders a layout to image
-func (r *ImageRenderer) Render(layout *domain.LayoutNode, options domain.PrintOptions) ([]byte, error) {
+// Render renders a layout to image.
+//
+// A single page is returned as one encoded image. Documents with several pages
+// are returned as a ZIP archive of page images unless Output.PageNumber selects
+// one of them.
+func (r *ImageRenderer) Render(layout *domain.LayoutNode, running *layout.RunningContent, options domain.PrintOptions) (*RenderOutput, error) {
+	space, err := r.colorSpace(options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each page is encoded as soon as it is drawn so only one canvas is held at a time
+	archive := newPageArchive(imageExtension(options.Output.Format))
+	warnings, err := r.RenderPages(layout, running, options, func(canvas *gg.Context) error {
+		data, err := r.export(canvas, options, space)
+		if err != nil {
+			return err
+		}
+		return archive.Add(data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if space == ColorSpaceCMYK {
+		warnings = append(warnings, "PNG and JPEG have no CMYK form: the image is written in RGB")
+	}
+
+	output, err := archive.Output()
+	if err != nil {
+		return nil, err
+	}
+	output.Warnings = warnings
+	return output, nil
+}
+
+// RenderPages paginates a layout and draws the pages selected by
+// Output.PageNumber, handing each canvas to emit before the next page is
+// drawn. The returned warnings describe non-fatal problems such as missing
+// glyphs.
+func (r *ImageRenderer) RenderPages(layout *domain.LayoutNode, running *layout.RunningContent, options domain.PrintOptions, emit func(canvas *gg.Context) error) ([]string, error) {
+	page := ResolvePageGeometry(options.Page)
+
+	dpi := float64(options.Layout.DPI)
+	if dpi <= 0 {
+		dpi = pixelsPerInch
+	}
+
 	// Calculate image dimensions
-	width := int(options.Page.Size.Width * options.Page.Scale * float64(options.Layout.DPI) / 25.4) // Convert mm to pixels
-	height := int(options.Page.Size.Height * options.Page.Scale * float64(options.Layout.DPI) / 25.4)
+	width := int(page.Width * dpi / mmPerInch) // Convert mm to pixels
+	height := int(page.Height * dpi / mmPerInch)
+	if width <= 0 || height <= 0 {
+		return nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "invalid image dimensions", domain.ErrInvalidDimensions).
+			WithDetail("width", width).
+			WithDetail("height", height)
+	}
 
-	// Create canvas
-	canvas := gg.NewContext(width, height)
+	// The canvas holds every pixel of a page, so its size is bounded like a decoded image's
+	maxPixels := r.options.MaxImagePixels
+	if maxPixels <= 0 {
+		maxPixels = defaultMaxPixels
+	}
+	if float64(width)*float64(height) > float64(maxPixels) {
+		return nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "image dimensions exceed the pixel limit", domain.ErrInvalidDimensions).
+			WithDetail("width", width).
+			WithDetail("height", height).
+			WithDetail("dpi", options.Layout.DPI).
+			WithDetail("max_pixels", maxPixels)
+	}
 
-	// Set background
-	if options.Page.Background {
-		canvas.SetRGB(1, 1, 1) // White background
-		canvas.Clear()
+	// Split the layout into pages of the printable height
+	pageBreaks, err := r.pageBreaker.CalculatePageBreaks(layout, page.ContentHeightPixels())
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate page breaks: %w", err)
+	}
+	margins, err := layoutMargins(running, len(pageBreaks), standalone)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create render context
-	ctx := ImageRenderContext{
-		Canvas:     canvas,
-		Width:      width,
-		Height:     height,
-		DPI:        float64(options.Layout.DPI),
-		Scale:      options.Page.Scale,
-		Background: domain.Color{R: 255, G: 255, B: 255, A: 255},
+	// Decode the watermark image once and fade it to the requested opacity
+	watermark := options.Output.Watermark
+	var watermarkImage image.Image
+	if watermark.Visible() && watermark.Image != "" {
+		_, decoded, err := loadWatermarkImage(watermark, r.options.MaxImagePixels)
+		if err != nil {
+			return nil, err
+		}
+		watermarkImage = fadeImage(decoded, resolveWatermark(watermark, page).Opacity)
 	}
 
-	// Enable antialiasing if configured
-	if r.options.Antialias {
-		canvas.SetLineCapRound()
-		canvas.SetLineJoinRound()
+	selected, err := selectPages(len(pageBreaks), options.Output.PageNumber)
+	if err != nil {
+		return nil, err
 	}
 
-	// Render the layout tree
-	if err := r.renderLayoutNode(layout, ctx); err != nil {
-		return nil, fmt.Errorf("failed to render layout: %w", err)
+	missing := make(map[rune]bool)
+	for _, i := range selected {
+		pageBreak := pageBreaks[i]
+		// Create canvas
+		canvas := gg.NewContext(width, height)
+
+		// Set background; JPEG has no alpha channel so it always gets paper white
+		if options.Page.Background || options.Output.Format == domain.FormatJPEG {
+			canvas.SetRGB(1, 1, 1) // White background
+			canvas.Clear()
+		}
+
+		// Enable antialiasing if configured
+		if r.options.Antialias {
+			canvas.SetLineCapRound()
+			canvas.SetLineJoinRound()
+		}
+
+		// Create render context that maps this page's slice of the layout onto the canvas
+		mmToDevice := dpi / mmPerInch
+		ctx := ImageRenderContext{
+			Canvas:     canvas,
+			Width:      width,
+			Height:     height,
+			OriginX:    page.Margins.Left * mmToDevice,
+			OriginY:    page.Margins.Top*mmToDevice - pageBreak.StartY*page.Scale*dpi/pixelsPerInch,
+			DPI:        dpi,
+			Scale:      page.Scale,
+			Background: domain.Color{R: 255, G: 255, B: 255, A: 255},
+			Missing:    missing,
+		}
+
+		// Keep content that spans several pages inside the printable area
+		canvas.DrawRectangle(page.Margins.Left*mmToDevice, page.Margins.Top*mmToDevice,
+			page.ContentWidth()*mmToDevice, page.ContentHeight()*mmToDevice)
+		canvas.Clip()
+
+		for _, node := range pageBreak.Nodes {
+			if err := r.renderLayoutNode(node, ctx); err != nil {
+				return nil, fmt.Errorf("failed to render page %d: %w", pageBreak.PageNumber, err)
+			}
+		}
+		canvas.ResetClip()
+
+		// Headers and footers are drawn in the margins around the content
+		if err := r.renderMargins(margins[i], page, ctx); err != nil {
+			return nil, fmt.Errorf("failed to render headers and footers of page %d: %w", pageBreak.PageNumber, err)
+		}
+
+		// Watermarks are stamped over the content and may extend into the margins
+		if watermark.Visible() {
+			r.renderWatermark(watermark, watermarkImage, page, ctx)
+		}
+
+		if err := emit(canvas); err != nil {
+			return nil, err
+		}
+	}
+
+	return missingGlyphWarnings(missing), nil
+}
+
+// export encodes a page canvas in the requested raster format
+func (r *ImageRenderer) export(canvas *gg.Context, options domain.PrintOptions, space ColorSpace) ([]byte, error) {
+	img := canvas.Image()
+	if space == ColorSpaceGray {
+		img = grayscaleImage(img)
 	}
 
 	// Export based on output format
 	switch options.Output.Format {
-	case domain.FormatPNG:
-		return r.ExportPNG(canvas)
 	case domain.FormatJPEG:
-		return r.ExportJPEG(canvas, r.options.Quality)
+		quality := r.options.Quality
+		if options.Render.Quality != "" {
+			quality = JPEGQuality(options.Render.Quality)
+		}
+		return encodeJPEG(img, quality)
 	default:
-		return r.ExportPNG(canvas)
+		return encodePNG(img)
+	}
+}
+
+// colorSpace returns the color space requested for the output. Color spaces
+// share their names with the PDF color profiles.
+func (r *ImageRenderer) colorSpace(options domain.PrintOptions) (ColorSpace, error) {
+	profile, err := resolveColorProfile(options.Render.ColorProfile, ColorProfile(r.options.ColorSpace))
+	return ColorSpace(profile), err
+}
+
+// grayscaleImage converts a page to 8-bit gray with the same luma weights as PDF output
+func grayscaleImage(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	gray := image.NewGray(bounds)
+	colors := newColorConverter(ColorProfileGray, nil)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			gray.Pix[gray.PixOffset(x, y)] = uint8(math.Round(colors.convert(c.R, c.G, c.B)[0] * 255))
+		}
 	}
+	return gray
 }
 
-// renderLayoutNode renders a layout node and its children
+// renderLayoutNode renders a single layout node; its children are listed on the page separately
 func (r *ImageRenderer) renderLayoutNode(node *domain.LayoutNode, ctx ImageRenderContext) error {
-	if node == nil {
+	// The options and text of form controls are field values, not page text
+	if node == nil || layout.InFormControl(node) {
 		return nil
 	}
 
 	// Render based on node type
 	switch node.Type {
 	case "text":
-		if err := r.RenderText(node.Content, node.Style, ctx); err != nil {
+		if err := r.RenderText(node, ctx); err != nil {
 			return err
 		}
 	case "element":
 		if err := r.RenderElement(node, ctx); err != nil {
 			return err
 		}
-	}
-
-	// Render children
-	for _, child := range node.Children {
-		if err := r.renderLayoutNode(child, ctx); err != nil {
-			return err
+		if node.Image != nil {
+			if err := r.RenderImage(node.Image, layout.ContentBox(node), ctx); err != nil {
+				return err
+			}
 		}
+		r.renderDrawing(node, ctx)
+		r.renderBarcode(node, ctx)
 	}
 
 	return nil
@@ -140,10 +338,12 @@ func (r *ImageRenderer) renderLayoutNode(node *domain.LayoutNode, ctx ImageRende
 
 // RenderElement renders a layout element
 func (r *ImageRenderer) RenderElement(elem *domain.LayoutNode, ctx ImageRenderContext) error {
-	// Render background
+	// Render background, with its image over the color
 	if err := r.RenderBackground(elem.Style.Background, elem.Box, ctx); err != nil {
 		return err
 	}
+	r.renderBackgroundImage(elem, ctx)
+	r.renderBackgroundDrawing(elem, ctx)
 
 	// Render border
 	if err := r.renderBorder(elem.Style.Border, elem.Box, ctx); err != nil {
@@ -153,18 +353,15 @@ func (r *ImageRenderer) RenderElement(elem *domain.LayoutNode, ctx ImageRenderCo
 	return nil
 }
 
-// RenderText renders text content
-func (r *ImageRenderer) RenderText(content string, style domain.ComputedStyle, ctx ImageRenderContext) error {
-	if content == "" {
+// RenderText renders a text node line by line inside its layout box
+func (r *ImageRenderer) RenderText(node *domain.LayoutNode, ctx ImageRenderContext) error {
+	if node.Content == "" {
 		return nil
 	}
+	style := node.Style
 
-	// Set font (simplified - would need proper font loading)
-	fontSize := style.Font.Size * ctx.Scale
-	if err := ctx.Canvas.LoadFontFace("", fontSize); err != nil {
-		// Fallback to default font
-		ctx.Canvas.SetFontFace(nil)
-	}
+	// Pick the faces used for this node; characters the first lacks fall back along the chain
+	chain := r.faceChain(style.Font, PixelsToPoints(style.Font.Size)*ctx.Scale, ctx)
 
 	// Set text color
 	red := float64(style.Color.R) / 255.0
@@ -173,16 +370,342 @@ func (r *ImageRenderer) RenderText(content string, style domain.ComputedStyle, c
 	alpha := float64(style.Color.A) / 255.0
 	ctx.Canvas.SetRGBA(red, green, blue, alpha)
 
-	// Calculate position (simplified)
-	x := 10.0 * ctx.Scale // Default margin
-	y := 20.0 * ctx.Scale // Default margin
+	// Break the text exactly as the layout engine did so lines match the box height
+	lines := r.textEngine.SplitTextIntoLines(node.Content, style.Font, node.Box.Width)
+	lineHeight := r.textEngine.CalculateLineHeight(style.Font, style.Text.LineHeight)
+	boxX, boxY, boxWidth, _ := ctx.ToCanvas(node.Box)
+
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+
+		// Shape and reorder the line, then align it using the real glyph metrics
+		runs := r.shapeLine(line, style.Text.Direction, chain, ctx)
+		x := boxX
+		lineWidth := r.runsWidth(runs, ctx)
+		switch r.textEngine.ResolveAlign(style.Text) {
+		case domain.TextAlignCenter:
+			x += (boxWidth - lineWidth) / 2
+		case domain.TextAlignRight:
+			x += boxWidth - lineWidth
+		}
+
+		// Draw text on the baseline of its line box
+		y := boxY + ctx.Length(float64(i)*lineHeight+baselineOffset(style.Font.Size, lineHeight))
+		r.drawRuns(runs, x, y, ctx)
 
-	// Draw text
-	ctx.Canvas.DrawString(content, x, y)
+		if strings.Contains(style.Text.Decoration, "underline") {
+			thickness := ctx.Length(style.Font.Size / 20)
+			ctx.Canvas.SetLineWidth(thickness)
+			ctx.Canvas.DrawLine(x, y+2*thickness, x+lineWidth, y+2*thickness)
+			ctx.Canvas.Stroke()
+		}
+
+		if i == len(lines)-1 && node.Leader != nil {
+			r.renderLeader(node, chain, x+lineWidth, boxX+boxWidth+ctx.Length(node.Leader.Width), y, ctx)
+		}
+	}
 
 	return nil
 }
 
+// imageFace is a face sized for the canvas together with the outlines used for coverage checks
+type imageFace struct {
+	face   font.Face
+	ttf    *truetype.Font
+	shaper *otFont // Layout tables of the face, nil when it has none
+	ppem   float64 // Size of the em in device pixels
+}
+
+// imageTextRun is a piece of a line drawn with a single face
+type imageTextRun struct {
+	face   imageFace
+	text   string
+	shaped *shapedRun // Glyphs shaped with the face's layout tables, drawn instead of text
+}
+
+// faceChain returns the faces, sized in points, tried in order for the characters of a computed font
+func (r *ImageRenderer) faceChain(style domain.FontStyle, size float64, ctx ImageRenderContext) []imageFace {
+	options := &truetype.Options{
+		Size:    size,
+		DPI:     ctx.DPI,
+		Hinting: font.HintingFull,
+	}
+
+	ppem := size * ctx.DPI / pointsPerInch
+	ttf, shaper := r.fontOutline(style)
+	chain := []imageFace{{face: truetype.NewFace(ttf, options), ttf: ttf, shaper: shaper, ppem: ppem}}
+	monospace := isMonospaceFamily(style.Family)
+	for _, info := range r.fontManager.Fallbacks(style.Weight, style.Style, monospace) {
+		if ttf, err := r.fontManager.TrueType(info); err == nil {
+			chain = append(chain, imageFace{face: truetype.NewFace(ttf, options), ttf: ttf, shaper: r.fontManager.shaper(info), ppem: ppem})
+		}
+	}
+	return chain
+}
+
+// fontOutline selects the registered or built-in face for a computed font,
+// with the layout tables of a registered face
+func (r *ImageRenderer) fontOutline(style domain.FontStyle) (*truetype.Font, *otFont) {
+	if info, ok := r.fontManager.Resolve(style.Family, style.Weight, style.Style); ok {
+		if ttf, err := r.fontManager.TrueType(info); err == nil {
+			return ttf, r.fontManager.shaper(info)
+		}
+	}
+
+	family := "sans"
+	if isMonospaceFamily(style.Family) {
+		family = "mono"
+	}
+
+	code := fontStyleCode(style.Weight, style.Style)
+	ttf, ok := r.faces[family+code]
+	if !ok {
+		ttf = r.faces["sans"]
+	}
+	return ttf, nil
+}
+
+// shapeLine reorders a line for display and breaks it into runs drawn with
+// the same face. Text in the scripts a face has layout tables for is shaped
+// with them; other text is shaped character by character.
+func (r *ImageRenderer) shapeLine(line string, direction domain.TextDirection, chain []imageFace, ctx ImageRenderContext) []imageTextRun {
+	shaping := false
+	for _, face := range chain {
+		shaping = shaping || face.shaper != nil
+	}
+	if !shaping {
+		return r.splitRuns(r.textEngine.ShapeLine(line, direction), chain, ctx)
+	}
+
+	var runs []imageTextRun
+	for _, visual := range r.textEngine.VisualRuns(line, direction) {
+		pieces := splitPieces([]rune(visual.Text), len(chain),
+			func(face int, ch rune) bool { return chain[face].ttf.Index(ch) != 0 },
+			func(face int) bool { return chain[face].shaper != nil }, ctx.Missing)
+
+		// Pieces are in logical order, so right-to-left runs are laid out from their last piece
+		if visual.RTL {
+			slices.Reverse(pieces)
+		}
+		for _, piece := range pieces {
+			if piece.script == nil {
+				runs = append(runs, r.splitRuns(r.textEngine.ShapeRun(layout.TextRun{Text: string(piece.text), RTL: visual.RTL}), chain, ctx)...)
+				continue
+			}
+			face := chain[piece.face]
+			shaped := face.shaper.shape(piece.text, piece.script, visual.RTL)
+			runs = append(runs, imageTextRun{face: face, shaped: &shaped})
+		}
+	}
+	return runs
+}
+
+// splitRuns breaks a line into runs drawn with the same face, recording
+// characters that no face in the chain covers
+func (r *ImageRenderer) splitRuns(line string, chain []imageFace, ctx ImageRenderContext) []imageTextRun {
+	var runs []imageTextRun
+	var pending []rune
+	current := -1
+
+	flush := func() {
+		if len(pending) > 0 {
+			runs = append(runs, imageTextRun{face: chain[current], text: string(pending)})
+			pending = nil
+		}
+	}
+
+	for _, ch := range line {
+		// Stay in the current face while it covers the text so runs are not split needlessly
+		index := -1
+		if current >= 0 && chain[current].ttf.Index(ch) != 0 {
+			index = current
+		} else {
+			for i, face := range chain {
+				if face.ttf.Index(ch) != 0 {
+					index = i
+					break
+				}
+			}
+		}
+		if index < 0 {
+			ctx.Missing[ch] = true
+			index = max(current, 0)
+		}
+
+		if index != current {
+			flush()
+			current = index
+		}
+		pending = append(pending, ch)
+	}
+	flush()
+
+	return runs
+}
+
+// runsWidth measures a line of runs in device pixels
+func (r *ImageRenderer) runsWidth(runs []imageTextRun, ctx ImageRenderContext) float64 {
+	width := 0.0
+	for _, run := range runs {
+		width += runWidth(run, ctx)
+	}
+	return width
+}
+
+// runWidth measures a run in device pixels
+func runWidth(run imageTextRun, ctx ImageRenderContext) float64 {
+	if run.shaped != nil {
+		return float64(run.shaped.advance) / float64(run.shaped.unitsPerEm) * run.face.ppem
+	}
+	ctx.Canvas.SetFontFace(run.face.face)
+	w, _ := ctx.Canvas.MeasureString(run.text)
+	return w
+}
+
+// drawRuns draws a line of runs starting at the baseline point (x, y)
+func (r *ImageRenderer) drawRuns(runs []imageTextRun, x, y float64, ctx ImageRenderContext) {
+	for _, run := range runs {
+		if run.shaped != nil {
+			drawShaped(run, x, y, ctx)
+		} else {
+			ctx.Canvas.SetFontFace(run.face.face)
+			ctx.Canvas.DrawString(run.text, x, y)
+		}
+		x += runWidth(run, ctx)
+	}
+}
+
+// drawShaped fills the outlines of the glyphs of a shaped run, unhinted so
+// glyphs moved by shaping keep their positions
+func drawShaped(run imageTextRun, x, y float64, ctx ImageRenderContext) {
+	canvas := ctx.Canvas
+	unit := run.face.ppem / float64(run.shaped.unitsPerEm)
+	var buf truetype.GlyphBuf
+	for _, g := range run.shaped.glyphs {
+		if err := buf.Load(run.face.ttf, fixed.Int26_6(run.face.ppem*64), truetype.Index(g.id), font.HintingNone); err != nil {
+			continue
+		}
+
+		// Outline points are in 26.6 pixels with Y growing upwards
+		originX, originY := x+float64(g.x)*unit, y-float64(g.y)*unit
+		point := func(p truetype.Point) (float64, float64) {
+			return originX + float64(p.X)/64, originY - float64(p.Y)/64
+		}
+		start := 0
+		for _, end := range buf.Ends {
+			traceContour(canvas, buf.Points[start:end], point)
+			start = end
+		}
+	}
+	canvas.Fill()
+}
+
+// traceContour adds a closed TrueType contour to the canvas path. Between
+// two off-curve points lies an implied on-curve point halfway.
+func traceContour(canvas *gg.Context, points []truetype.Point, point func(truetype.Point) (float64, float64)) {
+	if len(points) == 0 {
+		return
+	}
+	onCurve := func(p truetype.Point) bool { return p.Flags&0x01 != 0 }
+	midpoint := func(a, b truetype.Point) truetype.Point {
+		return truetype.Point{X: (a.X + b.X) / 2, Y: (a.Y + b.Y) / 2, Flags: 1}
+	}
+
+	// Start from an on-curve point, implied if need be
+	first := points[0]
+	rest := points[1:]
+	if !onCurve(first) {
+		last := points[len(points)-1]
+		if onCurve(last) {
+			first, rest = last, points[:len(points)-1]
+		} else {
+			first, rest = midpoint(last, first), points
+		}
+	}
+	canvas.MoveTo(point(first))
+
+	var control *truetype.Point
+	for _, p := range rest {
+		switch {
+		case onCurve(p) && control == nil:
+			canvas.LineTo(point(p))
+		case onCurve(p):
+			cx, cy := point(*control)
+			px, py := point(p)
+			canvas.QuadraticTo(cx, cy, px, py)
+			control = nil
+		case control != nil:
+			mid := midpoint(*control, p)
+			cx, cy := point(*control)
+			mx, my := point(mid)
+			canvas.QuadraticTo(cx, cy, mx, my)
+			control = &p
+		default:
+			control = &p
+		}
+	}
+	if control != nil {
+		cx, cy := point(*control)
+		fx, fy := point(first)
+		canvas.QuadraticTo(cx, cy, fx, fy)
+	}
+	canvas.ClosePath()
+}
+
+// isMonospaceFamily reports whether a CSS font-family list asks for a monospaced face
+func isMonospaceFamily(family string) bool {
+	lowerFamily := strings.ToLower(family)
+	return strings.Contains(lowerFamily, "monospace") || strings.Contains(lowerFamily, "courier")
+}
+
+// renderWatermark stamps a translucent, optionally rotated watermark on the canvas
+func (r *ImageRenderer) renderWatermark(wm *domain.Watermark, img image.Image, page PageGeometry, ctx ImageRenderContext) {
+	canvas := ctx.Canvas
+	placement := resolveWatermark(wm, page)
+	mmToDevice := ctx.DPI / mmPerInch
+	x, y := placement.X*mmToDevice, placement.Y*mmToDevice
+
+	canvas.Push()
+	defer canvas.Pop()
+
+	// Canvas Y grows downwards, so a counter-clockwise angle is a negative rotation
+	if placement.Angle != 0 {
+		canvas.RotateAbout(gg.Radians(-placement.Angle), x, y)
+	}
+
+	if img != nil {
+		bounds := img.Bounds()
+		w, h := PixelsToMM(float64(bounds.Dx()))*placement.Scale*mmToDevice, PixelsToMM(float64(bounds.Dy()))*placement.Scale*mmToDevice
+		canvas.Push()
+		canvas.Translate(x-placement.AnchorX*w, y-placement.AnchorY*h)
+		canvas.Scale(w/float64(bounds.Dx()), h/float64(bounds.Dy()))
+		canvas.DrawImage(img, 0, 0)
+		canvas.Pop()
+	}
+
+	if wm.Text != "" {
+		chain := r.faceChain(domain.FontStyle{Family: watermarkFontFamily, Weight: 700}, placement.FontSize, ctx)
+		runs := r.shapeLine(wm.Text, r.textEngine.DetectDirection(wm.Text), chain, ctx)
+		level := float64(watermarkTextColorLevel) / 255
+		canvas.SetRGBA(level, level, level, placement.Opacity)
+
+		w := r.runsWidth(runs, ctx)
+		h := placement.FontSize * ctx.DPI / pointsPerInch
+		r.drawRuns(runs, x-placement.AnchorX*w, watermarkBaseline(y, h, placement.AnchorY), ctx)
+	}
+}
+
+// fadeImage returns a copy of an image with its alpha multiplied by opacity
+func fadeImage(img image.Image, opacity float64) image.Image {
+	bounds := img.Bounds()
+	faded := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	mask := image.NewUniform(color.Alpha{A: uint8(opacity * 255)})
+	draw.DrawMask(faded, faded.Bounds(), img, bounds.Min, mask, image.Point{}, draw.Over)
+	return faded
+}
+
 // RenderBackground renders background styling
 func (r *ImageRenderer) RenderBackground(bg domain.Background, bounds domain.Box, ctx ImageRenderContext) error {
 	if bg.Color.A == 0 {
@@ -197,17 +720,47 @@ func (r *ImageRenderer) RenderBackground(bg domain.Background, bounds domain.Box
 	ctx.Canvas.SetRGBA(red, green, blue, alpha)
 
 	// Draw rectangle
-	x := bounds.X * ctx.Scale
-	y := bounds.Y * ctx.Scale
-	width := bounds.Width * ctx.Scale
-	height := bounds.Height * ctx.Scale
-
+	x, y, width, height := ctx.ToCanvas(bounds)
 	ctx.Canvas.DrawRectangle(x, y, width, height)
 	ctx.Canvas.Fill()
 
 	return nil
 }
 
+// renderBackgroundImage draws the copies of an element's background image
+// that fall inside its padding box. The image is scaled once and each copy
+// is cut to the box, leaving the page clip in place.
+func (r *ImageRenderer) renderBackgroundImage(elem *domain.LayoutNode, ctx ImageRenderContext) {
+	placement, ok := resolveBackground(elem.Style.Background, layout.PaddingBox(elem))
+	if !ok || elem.Style.Background.Loaded.Decoded == nil {
+		return
+	}
+	_, _, tw, th := ctx.ToCanvas(placement.Tile)
+	size := image.Pt(int(math.Round(tw)), int(math.Round(th)))
+	if size.X <= 0 || size.Y <= 0 {
+		return
+	}
+	tile, ok := resampleImage(elem.Style.Background.Loaded.Decoded, size.X, size.Y).(interface {
+		SubImage(image.Rectangle) image.Image
+	})
+	if !ok {
+		return
+	}
+
+	ax, ay, aw, ah := ctx.ToCanvas(placement.Area)
+	area := image.Rect(int(math.Round(ax)), int(math.Round(ay)), int(math.Round(ax+aw)), int(math.Round(ay+ah)))
+	for _, tileBox := range placement.Tiles() {
+		x, y, _, _ := ctx.ToCanvas(tileBox)
+		origin := image.Pt(int(math.Round(x)), int(math.Round(y)))
+		visible := image.Rectangle{Min: origin, Max: origin.Add(size)}.Intersect(area)
+		if visible.Empty() {
+			continue
+		}
+		// The cut keeps its coordinates inside the tile, so it is drawn at the tile origin
+		ctx.Canvas.DrawImage(tile.SubImage(visible.Sub(origin)), origin.X, origin.Y)
+	}
+}
+
 // renderBorder renders border styling
 func (r *ImageRenderer) renderBorder(border domain.BorderStyle, bounds domain.Box, ctx ImageRenderContext) error {
 	if border.Width <= 0 {
@@ -215,7 +768,8 @@ func (r *ImageRenderer) renderBorder(border domain.BorderStyle, bounds domain.Bo
 	}
 
 	// Set line width
-	ctx.Canvas.SetLineWidth(border.Width * ctx.Scale)
+	lineWidth := ctx.Length(border.Width)
+	ctx.Canvas.SetLineWidth(lineWidth)
 
 	// Set border color
 	red := float64(border.Color.R) / 255.0
@@ -224,62 +778,35 @@ func (r *ImageRenderer) renderBorder(border domain.BorderStyle, bounds domain.Bo
 	alpha := float64(border.Color.A) / 255.0
 	ctx.Canvas.SetRGBA(red, green, blue, alpha)
 
-	// Calculate bounds
-	x := bounds.X * ctx.Scale
-	y := bounds.Y * ctx.Scale
-	width := bounds.Width * ctx.Scale
-	height := bounds.Height * ctx.Scale
+	// Stroke along the middle of the border edge so the outer edge matches the box
+	x, y, width, height := ctx.ToCanvas(bounds)
+	x, y, width, height = x+lineWidth/2, y+lineWidth/2, width-lineWidth, height-lineWidth
 
 	// Draw border based on style
 	switch border.Style {
-	case domain.BorderSolid:
-		ctx.Canvas.DrawRectangle(x, y, width, height)
-		ctx.Canvas.Stroke()
+	case domain.BorderSolid, domain.BorderDouble:
+		ctx.Canvas.SetDash()
 	case domain.BorderDashed:
-		r.drawDashedRectangle(ctx.Canvas, x, y, width, height, []float64{10, 5})
+		ctx.Canvas.SetDash(3*lineWidth, 3*lineWidth)
 	case domain.BorderDotted:
-		r.drawDashedRectangle(ctx.Canvas, x, y, width, height, []float64{2, 3})
+		ctx.Canvas.SetDash(lineWidth, lineWidth)
+	default:
+		return nil
 	}
+	ctx.Canvas.DrawRectangle(x, y, width, height)
+	ctx.Canvas.Stroke()
+	ctx.Canvas.SetDash() // Reset to solid
 
 	return nil
 }
 
-// drawDashedRectangle draws a dashed rectangle
-func (r *ImageRenderer) drawDashedRectangle(canvas *gg.Context, x, y, width, height float64, pattern []float64) {
-	// Top edge
-	r.drawDashedLine(canvas, x, y, x+width, y, pattern)
-	// Right edge
-	r.drawDashedLine(canvas, x+width, y, x+width, y+height, pattern)
-	// Bottom edge
-	r.drawDashedLine(canvas, x+width, y+height, x, y+height, pattern)
-	// Left edge
-	r.drawDashedLine(canvas, x, y+height, x, y, pattern)
-}
-
-// drawDashedLine draws a dashed line
-func (r *ImageRenderer) drawDashedLine(canvas *gg.Context, x1, y1, x2, y2 float64, pattern []float64) {
-	if len(pattern) == 0 {
-		canvas.DrawLine(x1, y1, x2, y2)
-		canvas.Stroke()
-		return
-	}
-
-	// Simplified dashed line implementation
-	totalLength := ((x2-x1)*(x2-x1) + (y2-y1)*(y2-y1))
-	if totalLength <= 0 {
-		return
-	}
-
-	// For simplicity, just draw a regular line
-	// In a full implementation, this would properly handle dash patterns
-	canvas.DrawLine(x1, y1, x2, y2)
-	canvas.Stroke()
-}
-
 // ExportPNG exports the canvas as PNG
 func (r *ImageRenderer) ExportPNG(canvas *gg.Context) ([]byte, error) {
-	img := canvas.Image()
+	return encodePNG(canvas.Image())
+}
 
+// encodePNG encodes an image as PNG
+func encodePNG(img image.Image) ([]byte, error) {
 	var buf bytes.Buffer
 	if err := png.Encode(&buf, img); err != nil {
 		return nil, fmt.Errorf("failed to encode PNG: %w", err)
@@ -290,8 +817,11 @@ func (r *ImageRenderer) ExportPNG(canvas *gg.Context) ([]byte, error) {
 
 // ExportJPEG exports the canvas as JPEG
 func (r *ImageRenderer) ExportJPEG(canvas *gg.Context, quality int) ([]byte, error) {
-	img := canvas.Image()
+	return encodeJPEG(canvas.Image(), quality)
+}
 
+// encodeJPEG encodes an image as JPEG
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
 	var buf bytes.Buffer
 	options := &jpeg.Options{Quality: quality}
 	if err := jpeg.Encode(&buf, img, options); err != nil {
@@ -301,9 +831,20 @@ func (r *ImageRenderer) ExportJPEG(canvas *gg.Context, quality int) ([]byte, err
 	return buf.Bytes(), nil
 }
 
-// RenderImage renders an image element
-func (r *ImageRenderer) RenderImage(img *ImageContent, bounds domain.Box, ctx ImageRenderContext) error {
-	// Simplified image rendering - would need proper image loading and scaling
+// RenderImage draws an image scaled to fill a layout box
+func (r *ImageRenderer) RenderImage(img *domain.Image, bounds domain.Box, ctx ImageRenderContext) error {
+	x, y, w, h := ctx.ToCanvas(bounds)
+	if img.Decoded == nil || w <= 0 || h <= 0 {
+		return nil
+	}
+
+	canvas := ctx.Canvas
+	canvas.Push()
+	defer canvas.Pop()
+	size := img.Decoded.Bounds()
+	canvas.Translate(x, y)
+	canvas.Scale(w/float64(size.Dx()), h/float64(size.Dy()))
+	canvas.DrawImage(img.Decoded, 0, 0)
 	return nil
 }
 
@@ -314,3 +855,47 @@ type ImageContent struct {
 	Width  int
 	Height int
 }
+
+// JPEGQuality maps a render quality level to a JPEG encoder quality
+func JPEGQuality(quality domain.RenderQuality) int {
+	switch quality {
+	case domain.QualityDraft:
+		return 60
+	case domain.QualityHigh:
+		return 90
+	case domain.QualityPrint:
+		return 95
+	default:
+		return 80
+	}
+}
+
+// imageExtension returns the file extension for a raster output format
+func imageExtension(format domain.OutputFormat) string {
+	if format == domain.FormatJPEG {
+		return "jpg"
+	}
+	return "png"
+}
+
+// loadBuiltinFaces parses the bundled Go fonts used for raster text
+func loadBuiltinFaces() map[string]*truetype.Font {
+	sources := map[string][]byte{
+		"sans":   goregular.TTF,
+		"sansB":  gobold.TTF,
+		"sansI":  goitalic.TTF,
+		"sansBI": gobolditalic.TTF,
+		"mono":   gomono.TTF,
+		"monoB":  gomonobold.TTF,
+		"monoI":  gomonoitalic.TTF,
+		"monoBI": gomonobolditalic.TTF,
+	}
+
+	faces := make(map[string]*truetype.Font, len(sources))
+	for key, data := range sources {
+		if parsed, err := truetype.Parse(data); err == nil {
+			faces[key] = parsed
+		}
+	}
+	return faces
+}
@@ -0,0 +1,140 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+// redBox is a document with a red box and nothing else
+const redBox = `<div style="width: 100px; height: 50px; background-color: #ff0000"></div>`
+
+// renderTestImage renders a document as an image with the options of the print service
+func renderTestImage(t *testing.T, content string, options domain.PrintOptions) *RenderOutput {
+	t.Helper()
+	renderer := NewImageRenderer(ImageRenderOptions{Antialias: true, ColorSpace: ColorSpaceRGB, Quality: JPEGQuality(domain.QualityNormal)})
+	output, err := renderer.Render(layoutTestHTML(t, content, options), nil, options)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	return output
+}
+
+// countPixels counts the pixels of an image for which match is true
+func countPixels(img image.Image, match func(c color.NRGBA) bool) int {
+	n := 0
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if match(color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestImageRendererPNG(t *testing.T) {
+	options := domain.DefaultPrintOptions()
+	options.Output.Format = domain.FormatPNG
+	output := renderTestImage(t, redBox, options)
+	if output.Extension != "png" || output.PageCount != 1 {
+		t.Fatalf("Render() = %d pages of %s, want one PNG", output.PageCount, output.Extension)
+	}
+	img, err := png.Decode(bytes.NewReader(output.Data))
+	if err != nil {
+		t.Fatalf("output is not a PNG: %v", err)
+	}
+
+	// The page has the proportions of A4, with the box drawn inside the margins
+	bounds := img.Bounds()
+	if ratio := float64(bounds.Dy()) / float64(bounds.Dx()); ratio < 1.41 || ratio > 1.42 {
+		t.Errorf("page is %dx%d, want the proportions of A4", bounds.Dx(), bounds.Dy())
+	}
+	if c := color.NRGBAModel.Convert(img.At(0, 0)).(color.NRGBA); c != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("page corner = %v, want white", c)
+	}
+	red := countPixels(img, func(c color.NRGBA) bool { return c.R > 200 && c.G < 50 && c.B < 50 })
+	box := ImageRenderContext{DPI: float64(options.Layout.DPI), Scale: 1}
+	if want := int(box.Length(100) * box.Length(50)); red < want*9/10 || red > want*11/10 {
+		t.Errorf("%d red pixels, want about %d", red, want)
+	}
+}
+
+func TestImageRendererJPEG(t *testing.T) {
+	options := domain.DefaultPrintOptions()
+	options.Output.Format = domain.FormatJPEG
+	output := renderTestImage(t, redBox, options)
+	if output.Extension != "jpg" {
+		t.Errorf("Extension = %q, want jpg", output.Extension)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(output.Data)); err != nil {
+		t.Errorf("output is not a JPEG: %v", err)
+	}
+}
+
+func TestImageRendererColorSpaces(t *testing.T) {
+	options := domain.DefaultPrintOptions()
+	options.Output.Format = domain.FormatPNG
+	options.Render.ColorProfile = domain.ColorProfileGray
+	output := renderTestImage(t, redBox, options)
+	img, err := png.Decode(bytes.NewReader(output.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := img.(*image.Gray); !ok {
+		t.Errorf("grayscale output decodes as %T, want *image.Gray", img)
+	}
+
+	options.Render.ColorProfile = domain.ColorProfileCMYK
+	if output := renderTestImage(t, redBox, options); len(output.Warnings) != 1 {
+		t.Errorf("CMYK output warnings = %q, want one about RGB output", output.Warnings)
+	}
+}
+
+func TestJPEGQuality(t *testing.T) {
+	tests := map[domain.RenderQuality]int{
+		domain.QualityDraft:  60,
+		domain.QualityNormal: 80,
+		domain.QualityHigh:   90,
+		domain.QualityPrint:  95,
+		"":                   80,
+	}
+	for quality, want := range tests {
+		if got := JPEGQuality(quality); got != want {
+			t.Errorf("JPEGQuality(%q) = %d, want %d", quality, got, want)
+		}
+	}
+}
+
+func TestImageRendererPixelLimit(t *testing.T) {
+	options := domain.DefaultPrintOptions()
+	options.Output.Format = domain.FormatPNG
+	root := layoutTestHTML(t, redBox, options)
+
+	tests := []struct {
+		name      string
+		dpi       int
+		maxPixels int64
+	}{
+		{"DPI over the default limit", 100000, 0},
+		{"DPI that overflows the canvas size", math.MaxInt32, 0},
+		{"configured limit", 96, 500 * 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options.Layout.DPI = tt.dpi
+			renderer := NewImageRenderer(ImageRenderOptions{ColorSpace: ColorSpaceRGB, MaxImagePixels: tt.maxPixels})
+			if _, err := renderer.Render(root, nil, options); !errors.Is(err, domain.ErrInvalidDimensions) {
+				t.Errorf("Render() error = %v, want %v", err, domain.ErrInvalidDimensions)
+			}
+		})
+	}
+}
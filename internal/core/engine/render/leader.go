@@ -0,0 +1,103 @@
+package render
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+)
+
+// leaderGap separates a leader's fill from the text and the page number, in ems
+const leaderGap = 0.3
+
+// leaderNumber returns the page number a leader ends with, false while its
+// target is unknown
+func leaderNumber(leader *domain.Leader) (string, bool) {
+	if leader == nil || leader.Page <= 0 {
+		return "", false
+	}
+	return strconv.Itoa(leader.Page), true
+}
+
+// leaderFill repeats a leader's fill as often as it fits in a width, given
+// the width of one repetition
+func leaderFill(leader *domain.Leader, width, fillWidth float64) string {
+	if leader.Fill == "" || fillWidth <= 0 || width < fillWidth {
+		return ""
+	}
+	return strings.Repeat(leader.Fill, int(width/fillWidth))
+}
+
+// renderLeader ends the last line of a text with its page number, aligned to
+// the right, and the fill joining the two. lineEnd and right are in mm and y is
+// the baseline; top and height give the line box for the link area.
+func (r *PDFRenderer) renderLeader(node *domain.LayoutNode, chain []pdfFace, fontSize, lineEnd, right, top, y, height float64, ctx RenderContext) {
+	number, ok := leaderNumber(node.Leader)
+	if !ok {
+		return
+	}
+	gap := ctx.Length(node.Style.Font.Size * leaderGap)
+
+	runs := r.splitRuns(number, chain, ctx)
+	numberX := right - r.runsWidth(runs, fontSize, ctx)
+	r.drawRuns(runs, numberX, y, fontSize, ctx)
+
+	fillRuns := r.splitRuns(node.Leader.Fill, chain, ctx)
+	if fill := leaderFill(node.Leader, numberX-gap-(lineEnd+gap), r.runsWidth(fillRuns, fontSize, ctx)); fill != "" {
+		runs = r.splitRuns(fill, chain, ctx)
+		r.drawRuns(runs, numberX-gap-r.runsWidth(runs, fontSize, ctx), y, fontSize, ctx)
+	}
+
+	// The fill and number belong to the link of the entry
+	ctx.Links.AddArea(node, ctx, lineEnd, top, right-lineEnd, height)
+}
+
+// renderLeader ends the last line of a text with its page number, aligned to
+// the right, and the fill joining the two. lineEnd, right and the baseline y are
+// in device pixels.
+func (r *ImageRenderer) renderLeader(node *domain.LayoutNode, chain []imageFace, lineEnd, right, y float64, ctx ImageRenderContext) {
+	number, ok := leaderNumber(node.Leader)
+	if !ok {
+		return
+	}
+	gap := ctx.Length(node.Style.Font.Size * leaderGap)
+
+	runs := r.splitRuns(number, chain, ctx)
+	numberX := right - r.runsWidth(runs, ctx)
+	r.drawRuns(runs, numberX, y, ctx)
+
+	fillRuns := r.splitRuns(node.Leader.Fill, chain, ctx)
+	if fill := leaderFill(node.Leader, numberX-gap-(lineEnd+gap), r.runsWidth(fillRuns, ctx)); fill != "" {
+		runs = r.splitRuns(fill, chain, ctx)
+		r.drawRuns(runs, numberX-gap-r.runsWidth(runs, ctx), y, ctx)
+	}
+}
+
+// renderLeader ends the last line of a text with its page number, aligned to
+// the right, and the fill joining the two. Without the viewer's glyph metrics the
+// widths of the line and fill are estimated. lineEnd, right and the baseline
+// y are in SVG user units.
+func (r *SVGRenderer) renderLeader(node *domain.LayoutNode, lineEnd, right, y float64, ctx SVGRenderContext) {
+	number, ok := leaderNumber(node.Leader)
+	if !ok {
+		return
+	}
+	style := node.Style
+	attrs := fmt.Sprintf(`font-family="%s" font-size="%s" font-weight="%d" font-style="%s" fill="%s"%s text-anchor="end"`,
+		escapeSVG(style.Font.Family),
+		ctx.Num(ctx.Length(style.Font.Size)),
+		style.Font.Weight,
+		escapeSVG(style.Font.Style),
+		svgColor(style.Color),
+		svgOpacity("fill-opacity", style.Color))
+	gap := ctx.Length(style.Font.Size * leaderGap)
+
+	numberX := right - ctx.Length(r.textEngine.EstimateTextWidth(number, style.Font))
+	fmt.Fprintf(ctx.Builder, `<text x="%s" y="%s" %s>%s</text>`+"\n", ctx.Num(right), ctx.Num(y), attrs, number)
+
+	fillWidth := ctx.Length(r.textEngine.EstimateTextWidth(node.Leader.Fill, style.Font))
+	if fill := leaderFill(node.Leader, numberX-gap-(lineEnd+gap), fillWidth); fill != "" {
+		fmt.Fprintf(ctx.Builder, `<text x="%s" y="%s" %s>%s</text>`+"\n", ctx.Num(numberX-gap), ctx.Num(y), attrs, escapeSVG(fill))
+	}
+}
@@ -0,0 +1,44 @@
+package render
+
+import (
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+func TestLeaderNumber(t *testing.T) {
+	tests := []struct {
+		leader *domain.Leader
+		want   string
+		ok     bool
+	}{
+		{nil, "", false},
+		{&domain.Leader{Target: "a"}, "", false},
+		{&domain.Leader{Target: "a", Page: 12}, "12", true},
+	}
+	for _, tt := range tests {
+		if got, ok := leaderNumber(tt.leader); got != tt.want || ok != tt.ok {
+			t.Errorf("leaderNumber(%+v) = %q, %v, want %q, %v", tt.leader, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLeaderFill(t *testing.T) {
+	tests := []struct {
+		fill             string
+		width, fillWidth float64
+		want             string
+	}{
+		{".", 10, 3, "..."},
+		{".", 2, 3, ""},
+		{". ", 12, 4, ". . . "},
+		{"", 10, 3, ""},
+		{".", 10, 0, ""},
+		{".", -5, 3, ""},
+	}
+	for _, tt := range tests {
+		if got := leaderFill(&domain.Leader{Fill: tt.fill}, tt.width, tt.fillWidth); got != tt.want {
+			t.Errorf("leaderFill(%q, %v, %v) = %q, want %q", tt.fill, tt.width, tt.fillWidth, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package render
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"print-service/internal/core/domain"
+)
+
+// linkSchemes are the URL schemes written as URI actions
+var linkSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+// linkAnnotationFlags marks link annotations as printable, as PDF/A requires
+const linkAnnotationFlags = 4
+
+// pdfLink is a hyperlink and the areas its text was drawn in
+type pdfLink struct {
+	uri    string // External target
+	target string // id of the element an internal link jumps to
+	text   string // Link text, the description of its annotations
+	areas  []pdfLinkArea
+}
+
+// pdfLinkArea is a clickable line of link text
+type pdfLinkArea struct {
+	page int        // 1-based page
+	rect [4]float64 // Lower-left and upper-right corners in points
+	obj  int        // Annotation object number, assigned when written
+}
+
+// pdfLinkDest is the position of an element internal links jump to
+type pdfLinkDest struct {
+	page int     // 1-based page, 0 until the element is drawn
+	y    float64 // Top of the element in points from the bottom of the page
+}
+
+// pdfLinks records the links of a document and their targets while it is
+// drawn, and writes them as link annotations
+type pdfLinks struct {
+	links   []*pdfLink
+	anchors map[*domain.LayoutNode]*pdfLink // Link elements
+	texts   map[*domain.LayoutNode]*pdfLink // Link of each text node inside a link
+	targets map[*domain.LayoutNode]string   // Elements with an id
+	dests   map[string]*pdfLinkDest         // Destinations by id
+	missing []string                        // Internal targets that do not exist
+}
+
+// linkTarget classifies an href as an external URI or the id of an internal
+// target. ok is false for links that are not written, such as relative URLs.
+func linkTarget(href string) (uri, target string, ok bool) {
+	if strings.HasPrefix(href, "#") {
+		target, err := url.PathUnescape(href[1:])
+		return "", target, err == nil && target != ""
+	}
+	parsed, err := url.Parse(strings.TrimSpace(href))
+	if err != nil || !linkSchemes[strings.ToLower(parsed.Scheme)] {
+		return "", "", false
+	}
+	return asciiURI(parsed.String()), "", true
+}
+
+// asciiURI percent-encodes the bytes of a URI that PDF URI strings cannot hold
+func asciiURI(uri string) string {
+	var b strings.Builder
+	for i := 0; i < len(uri); i++ {
+		if c := uri[i]; c <= ' ' || c >= 0x7f {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// newPDFLinks collects the links and link targets of a layout tree
+func newPDFLinks(root *domain.LayoutNode) *pdfLinks {
+	l := &pdfLinks{
+		anchors: make(map[*domain.LayoutNode]*pdfLink),
+		texts:   make(map[*domain.LayoutNode]*pdfLink),
+		targets: make(map[*domain.LayoutNode]string),
+		dests:   make(map[string]*pdfLinkDest),
+	}
+	if root != nil {
+		l.collect(root, nil)
+	}
+	return l
+}
+
+// collect records the links and targets at a node and below it
+func (l *pdfLinks) collect(node *domain.LayoutNode, link *pdfLink) {
+	if node.Type == "text" {
+		if link != nil && node.Content != "" {
+			l.texts[node] = link
+			link.text = strings.TrimSpace(link.text + " " + node.Content)
+		}
+		return
+	}
+
+	// The first element with an id is the target
+	if id := node.Attributes["id"]; id != "" && l.dests[id] == nil {
+		l.targets[node] = id
+		l.dests[id] = &pdfLinkDest{}
+	}
+	if node.Tag == "a" && link == nil {
+		if uri, target, ok := linkTarget(node.Attributes["href"]); ok {
+			link = &pdfLink{uri: uri, target: target}
+			l.links = append(l.links, link)
+			l.anchors[node] = link
+		}
+	}
+
+	for _, child := range node.Children {
+		l.collect(child, link)
+	}
+}
+
+// PlaceTarget records the position of an element links can jump to, on the
+// first page it is drawn on
+func (l *pdfLinks) PlaceTarget(node *domain.LayoutNode, ctx RenderContext) {
+	if l == nil {
+		return
+	}
+	id, ok := l.targets[node]
+	if !ok || l.dests[id].page != 0 {
+		return
+	}
+	_, y, _, _ := ctx.ToPage(node.Box)
+	l.dests[id].page = ctx.CurrentPage
+	l.dests[id].y = (ctx.PageHeight - y) * ctx.PDF.GetConversionRatio()
+}
+
+// AddArea makes a line of text clickable when it belongs to a link. The
+// area is given in mm from the top-left corner of the page.
+func (l *pdfLinks) AddArea(node *domain.LayoutNode, ctx RenderContext, x, y, w, h float64) {
+	if l == nil {
+		return
+	}
+	link, ok := l.texts[node]
+	if !ok || w <= 0 {
+		return
+	}
+	k := ctx.PDF.GetConversionRatio()
+	link.areas = append(link.areas, pdfLinkArea{
+		page: ctx.CurrentPage,
+		rect: [4]float64{x * k, (ctx.PageHeight - y - h) * k, (x + w) * k, (ctx.PageHeight - y) * k},
+	})
+}
+
+// Write adds a link annotation for every clickable area to its page
+func (l *pdfLinks) Write(update *pdfUpdate) error {
+	pages, err := update.Pages()
+	if err != nil {
+		return err
+	}
+
+	for _, link := range l.links {
+		if len(link.areas) == 0 {
+			continue
+		}
+		action := fmt.Sprintf("/A <</S /URI /URI %s>>", pdfString(link.uri))
+		if link.target != "" {
+			dest := l.dests[link.target]
+			if dest == nil || dest.page == 0 {
+				l.missing = append(l.missing, link.target)
+				continue
+			}
+			action = fmt.Sprintf("/Dest [%d 0 R /XYZ null %.2f null]", pages[dest.page-1], dest.y)
+		}
+
+		for i := range link.areas {
+			area := &link.areas[i]
+			page := pages[area.page-1]
+			area.obj = update.Add(fmt.Sprintf("<</Type /Annot /Subtype /Link /Rect [%.2f %.2f %.2f %.2f] /Border [0 0 0] /F %d /P %d 0 R /Contents %s %s>>",
+				area.rect[0], area.rect[1], area.rect[2], area.rect[3], linkAnnotationFlags, page, pdfString(link.text), action))
+			if err := update.AppendToArray(page, "/Annots", fmt.Sprintf("%d 0 R", area.obj)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Warnings describes links that could not be written
+func (l *pdfLinks) Warnings() []string {
+	var warnings []string
+	for _, target := range l.missing {
+		warnings = append(warnings, fmt.Sprintf("link target #%s not found", target))
+	}
+	return warnings
+}
@@ -0,0 +1,82 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+func TestLinkTarget(t *testing.T) {
+	tests := []struct {
+		href        string
+		uri, target string
+		ok          bool
+	}{
+		{"https://example.com/a?b=c", "https://example.com/a?b=c", "", true},
+		{"HTTP://example.com", "http://example.com", "", true},
+		{"mailto:sales@example.com", "mailto:sales@example.com", "", true},
+		{"https://example.com/café", "https://example.com/caf%C3%A9", "", true},
+		{"#results", "", "results", true},
+		{"#caf%C3%A9", "", "café", true},
+		{"#", "", "", false},
+		{"javascript:alert(1)", "", "", false},
+		{"file:///etc/passwd", "", "", false},
+		{"report.html", "", "", false},
+	}
+	for _, tt := range tests {
+		uri, target, ok := linkTarget(tt.href)
+		if uri != tt.uri || target != tt.target || ok != tt.ok {
+			t.Errorf("linkTarget(%q) = %q, %q, %v; want %q, %q, %v", tt.href, uri, target, ok, tt.uri, tt.target, tt.ok)
+		}
+	}
+}
+
+// annotations returns the bodies of the annotations listed on a page
+func annotations(t *testing.T, file *pdfFile, page pdfPage) []string {
+	t.Helper()
+	var bodies []string
+	list := strings.Trim(dictValue(page.dict, "/Annots"), "[]")
+	for _, ref := range strings.SplitAfter(list, " R") {
+		num, ok := referenceTo(strings.TrimSpace(ref))
+		if !ok {
+			continue
+		}
+		body, err := file.Object(num)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, body)
+	}
+	return bodies
+}
+
+func TestPDFRendererLinks(t *testing.T) {
+	output := renderTestPDF(t, `<p><a href="https://example.com/docs">Read the docs</a> and <a href="#results">see results</a>.</p>`+
+		`<p><a href="#missing">Broken</a> <a href="notes.html">Relative</a></p>`+
+		`<h2 id="results" style="break-before: page">Results</h2>`,
+		domain.DefaultPrintOptions(), PDFRenderOptions{})
+	if got := strings.Join(output.Warnings, "|"); got != "link target #missing not found" {
+		t.Errorf("warnings = %q, want the missing target reported", got)
+	}
+
+	file, pages := testPages(t, output.Data)
+	if len(pages) != 2 {
+		t.Fatalf("Render() = %d pages, want 2", len(pages))
+	}
+	links := annotations(t, file, pages[0])
+	if len(links) != 2 {
+		t.Fatalf("page 1 has %d annotations, want the external and internal links:\n%s", len(links), strings.Join(links, "\n"))
+	}
+	if !strings.Contains(links[0], "/Subtype /Link") || !strings.Contains(links[0], "/A <</S /URI /URI (https://example.com/docs)>>") ||
+		!strings.Contains(links[0], "/Contents (Read the docs)") {
+		t.Errorf("external link = %s", links[0])
+	}
+	if dest := fmt.Sprintf("/Dest [%d 0 R /XYZ null", pages[1].num); !strings.Contains(links[1], dest) {
+		t.Errorf("internal link = %s, want a destination on page 2", links[1])
+	}
+	if got := annotations(t, file, pages[1]); len(got) != 0 {
+		t.Errorf("page 2 has annotations %q, want none", got)
+	}
+}
@@ -0,0 +1,587 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"print-service/internal/core/domain"
+)
+
+// MergePart is a PDF merged into a larger document
+type MergePart struct {
+	Data  []byte // PDF file, rendered or uploaded
+	Title string // Label of an outline entry leading to the part, none when empty
+}
+
+// MergePDFs concatenates the pages of PDF files into one document. The
+// outline of each part is kept, below an entry for the part when it has a
+// title, as are its links, named destinations and form fields. Document
+// properties are written from metadata as Render writes them, and the
+// result is encrypted when the options ask for it.
+func MergePDFs(parts []MergePart, metadata domain.DocumentMetadata, options domain.PrintOptions) (*RenderOutput, error) {
+	if len(parts) == 0 {
+		return nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "no documents to merge", domain.ErrInvalidDocument)
+	}
+
+	w := &pdfWriter{}
+	catalog, tree := w.Reserve(), w.Reserve()
+	merged := &pdfMerge{writer: w, tree: tree, dests: make(map[string]string), names: make(map[string]string)}
+	version := "1.7"
+	for i, part := range parts {
+		file, err := readPDF(part.Data)
+		if err != nil {
+			return nil, fmt.Errorf("part %d: %w", i+1, err)
+		}
+		if err := merged.add(file, part.Title); err != nil {
+			return nil, fmt.Errorf("part %d: %w", i+1, err)
+		}
+		version = max(version, file.version)
+	}
+
+	// Page tree
+	kids := make([]string, len(merged.pages))
+	for i, page := range merged.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", page)
+	}
+	w.Set(tree, fmt.Sprintf("<</Type /Pages /Kids [%s] /Count %d>>", strings.Join(kids, " "), len(kids)))
+
+	// Catalog
+	entries := []string{"/Type /Catalog", fmt.Sprintf("/Pages %d 0 R", tree)}
+	if len(merged.outline) > 0 {
+		entries = append(entries, fmt.Sprintf("/Outlines %d 0 R", writeOutline(w, merged.outline)), "/PageMode /UseOutlines")
+	}
+	if len(merged.dests) > 0 {
+		entries = append(entries, "/Dests "+dictOf(merged.dests))
+	}
+	if len(merged.names) > 0 {
+		entries = append(entries, "/Names <</Dests "+nameTree(merged.names)+">>")
+	}
+	if len(merged.fields) > 0 {
+		form := merged.form
+		if form == "" {
+			form = "<<>>"
+		}
+		entries = append(entries, "/AcroForm "+setDictValue(form, "/Fields", "["+strings.Join(merged.fields, " ")+"]"))
+	}
+	w.Set(catalog, "<<"+strings.Join(entries, " ")+">>")
+
+	// Document properties are only taken from the request when metadata output is enabled
+	if !options.Output.Metadata {
+		metadata = domain.DocumentMetadata{}
+	}
+	info := newDocumentInfo(metadata, time.Now().Round(time.Second))
+	infoDict := w.Add(documentInfoDict(info))
+
+	data := w.Bytes(version, fmt.Sprintf("/Root %d 0 R /Info %d 0 R", catalog, infoDict))
+	output := &RenderOutput{PageCount: len(merged.pages), Extension: "pdf", Warnings: merged.warnings}
+	encryption := options.Output.Encryption
+	if !options.Output.Metadata && encryption == nil {
+		output.Data = data
+		return output, nil
+	}
+
+	update, err := newPDFUpdate(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read merged PDF: %w", err)
+	}
+	if options.Output.Metadata {
+		if err := attachXMP(update, xmpMetadata{documentInfo: info}); err != nil {
+			return nil, fmt.Errorf("failed to write XMP metadata: %w", err)
+		}
+	}
+	data = update.Bytes()
+	if encryption != nil {
+		if data, err = writeEncrypted(update, *encryption, data); err != nil {
+			return nil, fmt.Errorf("failed to encrypt PDF: %w", err)
+		}
+	}
+	output.Data = data
+	return output, nil
+}
+
+// pdfMerge collects the pages and document-level entries of merged files
+type pdfMerge struct {
+	writer   *pdfWriter
+	tree     int               // Page tree object of the merged document
+	pages    []int             // Page objects in order
+	outline  []pdfOutlineItem  // Top-level outline items
+	dests    map[string]string // Destinations by name, from /Dests dictionaries
+	names    map[string]string // Destinations by string, from /Dests name trees
+	fields   []string          // References to the top-level form fields
+	form     string            // Interactive form dictionary of the first part with one
+	warnings []string          // Parts of the files that were dropped
+}
+
+// pdfOutlineItem is an entry of a merged outline
+type pdfOutlineItem struct {
+	title    string // Title as a PDF string
+	dest     string // Explicit destination array, "" for none
+	open     bool   // Shows the children of the entry
+	children []pdfOutlineItem
+}
+
+// pageTreeKeys are page entries that refer to structures of the original
+// file that are not merged
+var pageTreeKeys = []string{"/Parent", "/StructParents", "/B", "/Tabs"}
+
+// add copies the pages of a file into the merged document, with every object
+// they use, and collects its outline, destinations and form fields
+func (m *pdfMerge) add(file *pdfFile, title string) error {
+	pages, err := file.Pages()
+	if err != nil {
+		return err
+	}
+
+	// Pages are numbered first so the destinations of other objects find them
+	numbers := make(map[int]int)
+	var pending []int
+	renumber := func(num int) int {
+		if n, ok := numbers[num]; ok {
+			return n
+		}
+		if !file.Has(num) {
+			return 0
+		}
+		n := m.writer.Reserve()
+		numbers[num] = n
+		pending = append(pending, num)
+		return n
+	}
+	first := len(m.pages)
+	for _, page := range pages {
+		n := m.writer.Reserve()
+		numbers[page.num] = n
+		m.pages = append(m.pages, n)
+	}
+	for i, page := range pages {
+		dict := page.dict
+		for _, key := range pageTreeKeys {
+			dict = deleteDictValue(dict, key)
+		}
+		dict = setDictValue(renumberReferences(dict, renumber), "/Parent", fmt.Sprintf("%d 0 R", m.tree))
+		m.writer.Set(m.pages[first+i], dict)
+	}
+
+	catalog, err := file.Object(file.Root())
+	if err != nil {
+		return err
+	}
+
+	// Named destinations are kept so links and outline entries using them
+	// still work. Names already used by an earlier part keep its destination.
+	dest := func(value string) string {
+		return m.destination(file, value, numbers)
+	}
+	named := &pdfNamedDests{dests: make(map[string]string), names: make(map[string]string)}
+	if dests, err := file.Resolve(dictValue(catalog, "/Dests")); err == nil && dests != "" {
+		collectDests(dests, dest, named.dests)
+	}
+	if names, err := file.Resolve(dictValue(catalog, "/Names")); err == nil && names != "" {
+		if tree, err := file.Resolve(dictValue(names, "/Dests")); err == nil && tree != "" {
+			collectNameTree(file, tree, dest, named.names, make(map[int]bool))
+		}
+	}
+	for name, value := range named.dests {
+		if _, taken := m.dests[name]; !taken {
+			m.dests[name] = value
+		}
+	}
+	for name, value := range named.names {
+		if _, taken := m.names[name]; !taken {
+			m.names[name] = value
+		}
+	}
+
+	// Form fields are merged into one interactive form
+	if form, err := file.Resolve(dictValue(catalog, "/AcroForm")); err == nil && form != "" {
+		fields, _ := file.Resolve(dictValue(form, "/Fields"))
+		for _, field := range references(fields) {
+			if n := renumber(field); n > 0 {
+				m.fields = append(m.fields, fmt.Sprintf("%d 0 R", n))
+			}
+		}
+		if m.form == "" {
+			m.form = deleteDictValue(renumberReferences(form, renumber), "/Fields")
+		}
+	}
+
+	// The outline of the part, below an entry for it when it has a title
+	items := readOutline(file, catalog, named, dest)
+	firstPage := fmt.Sprintf("[%d 0 R /Fit]", m.pages[first])
+	if title != "" {
+		items = []pdfOutlineItem{{title: pdfString(title), dest: firstPage, open: true, children: items}}
+	}
+	m.outline = append(m.outline, items...)
+
+	// Everything the pages use is copied, with references renumbered
+	for len(pending) > 0 {
+		num := pending[0]
+		pending = pending[1:]
+		body, err := file.Object(num)
+		if err != nil {
+			m.warnings = append(m.warnings, fmt.Sprintf("dropped unreadable object: %v", err))
+			body = "null"
+		}
+		m.writer.Set(numbers[num], renumberReferences(body, renumber))
+	}
+	return nil
+}
+
+// destination converts a destination of a file into an explicit destination
+// of the merged document. It returns "" when it is not on a merged page.
+func (m *pdfMerge) destination(file *pdfFile, value string, numbers map[int]int) string {
+	value, err := file.Resolve(value)
+	if err != nil {
+		return ""
+	}
+	if strings.HasPrefix(value, "<<") {
+		if value, err = file.Resolve(dictValue(value, "/D")); err != nil {
+			return ""
+		}
+	}
+	if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") || len(value) < 2 {
+		return ""
+	}
+
+	items := strings.TrimSpace(value[1 : len(value)-1])
+	match := anyReferencePattern.FindStringSubmatchIndex(items)
+	if match == nil || match[0] != 0 {
+		return ""
+	}
+	page, _ := strconv.Atoi(items[match[2]:match[3]])
+	n, ok := numbers[page]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("[%d 0 R %s]", n, strings.TrimSpace(items[match[1]:]))
+}
+
+// pdfNamedDests are the named destinations of a merged file, converted to
+// explicit destinations of the merged document
+type pdfNamedDests struct {
+	dests map[string]string // Destinations by name, from the /Dests dictionary
+	names map[string]string // Destinations by string, from the /Dests name tree
+}
+
+// collectDests adds the destinations of a /Dests dictionary
+func collectDests(dests string, dest func(string) string, into map[string]string) {
+	for i := strings.Index(dests, "<<") + 2; i < len(dests); {
+		for i < len(dests) && isPDFSpace(dests[i]) {
+			i++
+		}
+		if i >= len(dests) || dests[i] != '/' {
+			return
+		}
+		nameEnd := i + 1
+		for isNameChar(dests, nameEnd) {
+			nameEnd++
+		}
+		end := valueEnd(dests, nameEnd)
+		if value := dest(dests[nameEnd:end]); value != "" {
+			into[dests[i:nameEnd]] = value
+		}
+		i = end
+	}
+}
+
+// collectNameTree adds the destinations of a name tree node and its kids
+func collectNameTree(file *pdfFile, node string, dest func(string) string, into map[string]string, visited map[int]bool) {
+	if kids, err := file.Resolve(dictValue(node, "/Kids")); err == nil {
+		for _, kid := range references(kids) {
+			if visited[kid] {
+				continue
+			}
+			visited[kid] = true
+			if child, err := file.Object(kid); err == nil {
+				collectNameTree(file, child, dest, into, visited)
+			}
+		}
+	}
+
+	names, err := file.Resolve(dictValue(node, "/Names"))
+	if err != nil || !strings.HasPrefix(names, "[") {
+		return
+	}
+	for i := 1; i < len(names)-1; {
+		for i < len(names) && isPDFSpace(names[i]) {
+			i++
+		}
+		if i >= len(names)-1 {
+			return
+		}
+		keyEnd := valueEnd(names, i)
+		valueStop := valueEnd(names, keyEnd)
+		if valueStop <= i {
+			return // Not a key and value
+		}
+		key := string(pdfStringBytes(names[i:keyEnd]))
+		if _, taken := into[key]; !taken {
+			if value := dest(names[keyEnd:valueStop]); value != "" {
+				into[key] = value
+			}
+		}
+		i = valueStop
+	}
+}
+
+// readOutline reads the outline of a file, resolving the destination of
+// each entry. Entries without a destination on a merged page keep none.
+func readOutline(file *pdfFile, catalog string, named *pdfNamedDests, dest func(string) string) []pdfOutlineItem {
+	root, err := file.Resolve(dictValue(catalog, "/Outlines"))
+	if err != nil || root == "" {
+		return nil
+	}
+
+	visited := make(map[int]bool)
+	var read func(first string, depth int) []pdfOutlineItem
+	read = func(first string, depth int) []pdfOutlineItem {
+		if depth > maxPDFNesting {
+			return nil
+		}
+		var items []pdfOutlineItem
+		for num, ok := referenceTo(first); ok && !visited[num]; num, ok = referenceTo(first) {
+			visited[num] = true
+			entry, err := file.Object(num)
+			if err != nil {
+				break
+			}
+			first = dictValue(entry, "/Next")
+
+			title, err := file.Resolve(dictValue(entry, "/Title"))
+			if err != nil || title == "" {
+				title = "()"
+			}
+			item := pdfOutlineItem{title: title, open: dictInt(entry, "/Count") > 0}
+			target := dictValue(entry, "/Dest")
+			if target == "" {
+				if action, err := file.Resolve(dictValue(entry, "/A")); err == nil && dictValue(action, "/S") == "/GoTo" {
+					target = dictValue(action, "/D")
+				}
+			}
+			item.dest = named.destination(file, target, dest)
+			item.children = read(dictValue(entry, "/First"), depth+1)
+			items = append(items, item)
+		}
+		return items
+	}
+	return read(dictValue(root, "/First"), 0)
+}
+
+// destination converts an explicit or named destination of a file
+func (n *pdfNamedDests) destination(file *pdfFile, target string, dest func(string) string) string {
+	target, err := file.Resolve(target)
+	if err != nil || target == "" {
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(target, "/"):
+		return n.dests[target]
+	case strings.HasPrefix(target, "("), strings.HasPrefix(target, "<") && !strings.HasPrefix(target, "<<"):
+		return n.names[string(pdfStringBytes(target))]
+	}
+	return dest(target)
+}
+
+// writeOutline writes the outline dictionary and its items, returning the
+// dictionary's object number
+func writeOutline(w *pdfWriter, items []pdfOutlineItem) int {
+	root := w.Reserve()
+	first, last, visible := writeOutlineItems(w, root, items)
+	w.Set(root, fmt.Sprintf("<</Type /Outlines /First %d 0 R /Last %d 0 R /Count %d>>", first, last, visible))
+	return root
+}
+
+// writeOutlineItems writes sibling outline items below a parent. It returns
+// the first and last item and the number of items shown when the parent is open.
+func writeOutlineItems(w *pdfWriter, parent int, items []pdfOutlineItem) (first, last, visible int) {
+	nums := make([]int, len(items))
+	for i := range items {
+		nums[i] = w.Reserve()
+	}
+	for i, item := range items {
+		visible++
+		entries := []string{"/Title " + item.title, fmt.Sprintf("/Parent %d 0 R", parent)}
+		if i > 0 {
+			entries = append(entries, fmt.Sprintf("/Prev %d 0 R", nums[i-1]))
+		}
+		if i+1 < len(items) {
+			entries = append(entries, fmt.Sprintf("/Next %d 0 R", nums[i+1]))
+		}
+		if item.dest != "" {
+			entries = append(entries, "/Dest "+item.dest)
+		}
+		if len(item.children) > 0 {
+			childFirst, childLast, childVisible := writeOutlineItems(w, nums[i], item.children)
+			count := -childVisible // Closed items count their hidden descendants negatively
+			if item.open {
+				count = childVisible
+				visible += childVisible
+			}
+			entries = append(entries, fmt.Sprintf("/First %d 0 R /Last %d 0 R /Count %d", childFirst, childLast, count))
+		}
+		w.Set(nums[i], "<<"+strings.Join(entries, " ")+">>")
+	}
+	return nums[0], nums[len(nums)-1], visible
+}
+
+// documentInfoDict writes the document information dictionary
+func documentInfoDict(info documentInfo) string {
+	entries := []string{
+		"/Title " + pdfString(info.Title),
+		"/Author " + pdfString(info.Author),
+		"/Creator " + pdfString(info.Creator),
+		"/Producer " + pdfString(info.Producer),
+	}
+	if info.Subject != "" {
+		entries = append(entries, "/Subject "+pdfString(info.Subject))
+	}
+	if len(info.Keywords) > 0 {
+		entries = append(entries, "/Keywords "+pdfString(infoKeywords(info.Keywords)))
+	}
+	if !info.Created.IsZero() {
+		date := pdfString(pdfDate(info.Created))
+		entries = append(entries, "/CreationDate "+date, "/ModDate "+date)
+	}
+	for _, key := range sortedKeys(info.Custom) {
+		entries = append(entries, pdfName(key)+" "+pdfString(info.Custom[key]))
+	}
+	return "<<" + strings.Join(entries, " ") + ">>"
+}
+
+// dictOf writes a dictionary of names and values, sorted by name
+func dictOf(entries map[string]string) string {
+	var buf strings.Builder
+	buf.WriteString("<<")
+	for _, key := range sortedKeys(entries) {
+		fmt.Fprintf(&buf, "%s %s ", key, entries[key])
+	}
+	return strings.TrimSpace(buf.String()) + ">>"
+}
+
+// nameTree writes a name tree with a single node, its keys sorted as the
+// tree requires
+func nameTree(entries map[string]string) string {
+	var buf strings.Builder
+	buf.WriteString("<</Names [")
+	for i, key := range sortedKeys(entries) {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		fmt.Fprintf(&buf, "<%x> %s", key, entries[key])
+	}
+	buf.WriteString("]>>")
+	return buf.String()
+}
+
+// pdfStringBytes decodes a literal or hexadecimal string token
+func pdfStringBytes(token string) []byte {
+	token = strings.TrimSpace(token)
+	switch {
+	case strings.HasPrefix(token, "(") && strings.HasSuffix(token, ")"):
+		return unescapePDFString(token[1 : len(token)-1])
+	case strings.HasPrefix(token, "<") && strings.HasSuffix(token, ">"):
+		return decodeHexString(token[1 : len(token)-1])
+	}
+	return []byte(token)
+}
+
+// numberReferencePattern matches the start of an indirect reference of any generation
+var numberReferencePattern = regexp.MustCompile(`^(\d+)\s+\d+\s+R`)
+
+// renumberReferences rewrites the indirect references of an object body
+// outside its strings and stream data with the numbers renumber gives them.
+// References renumber returns 0 for become null.
+func renumberReferences(body string, renumber func(num int) int) string {
+	var buf strings.Builder
+	for i := 0; i < len(body); {
+		c := body[i]
+		switch {
+		case strings.HasPrefix(body[i:], "stream") && (i == 0 || isPDFSpace(body[i-1]) || body[i-1] == '>'):
+			buf.WriteString(body[i:]) // Stream data is not scanned
+			return buf.String()
+		case strings.HasPrefix(body[i:], "<<"), strings.HasPrefix(body[i:], ">>"):
+			buf.WriteString(body[i : i+2])
+			i += 2
+		case c == '(' || c == '<':
+			end := skipHexString(body, i)
+			if c == '(' {
+				end = skipPDFString(body, i)
+			}
+			end = min(end+1, len(body))
+			buf.WriteString(body[i:end])
+			i = end
+		case c == '/':
+			end := i + 1
+			for isNameChar(body, end) {
+				end++
+			}
+			buf.WriteString(body[i:end])
+			i = end
+		case c >= '0' && c <= '9' && (i == 0 || !isNameChar(body, i-1)):
+			if match := numberReferencePattern.FindStringSubmatchIndex(body[i:]); match != nil && !isNameChar(body, i+match[1]) {
+				num, _ := strconv.Atoi(body[i+match[2] : i+match[3]])
+				if n := renumber(num); n > 0 {
+					fmt.Fprintf(&buf, "%d 0 R", n)
+				} else {
+					buf.WriteString("null")
+				}
+				i += match[1]
+				continue
+			}
+			end := i
+			for isNameChar(body, end) {
+				end++
+			}
+			buf.WriteString(body[i:end])
+			i = end
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+	}
+	return buf.String()
+}
+
+// pdfWriter writes a new PDF file object by object
+type pdfWriter struct {
+	objects []string // Object bodies; object n is at index n-1
+}
+
+// Reserve allocates an object number whose body is set later
+func (w *pdfWriter) Reserve() int {
+	return w.Add("null")
+}
+
+// Add appends an object and returns its number
+func (w *pdfWriter) Add(body string) int {
+	w.objects = append(w.objects, body)
+	return len(w.objects)
+}
+
+// Set writes the body of an object
+func (w *pdfWriter) Set(num int, body string) {
+	w.objects[num-1] = body
+}
+
+// Bytes writes the file with a cross-reference table and the given trailer entries
+func (w *pdfWriter) Bytes(version, trailer string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-" + version + "\n%\xE2\xE3\xCF\xD3\n")
+	offsets := make([]int, len(w.objects))
+	for i, body := range w.objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(w.objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<</Size %d %s>>\nstartxref\n%d\n%%%%EOF\n", len(w.objects)+1, trailer, xref)
+	return buf.Bytes()
+}
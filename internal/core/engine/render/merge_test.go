@@ -0,0 +1,158 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+// testOutlineItem is an outline entry read back from a merged file
+type testOutlineItem struct {
+	title string
+	page  int // Index of the page the entry leads to, -1 for none
+}
+
+// readTestOutline reads the outline of a file depth first, with the page each entry leads to
+func readTestOutline(t *testing.T, file *pdfFile) []testOutlineItem {
+	t.Helper()
+	pages, err := file.Pages()
+	if err != nil {
+		t.Fatalf("Pages() error = %v", err)
+	}
+	index := make(map[int]int)
+	for i, page := range pages {
+		index[page.num] = i
+	}
+
+	catalog, _ := file.Object(file.Root())
+	root, err := file.Resolve(dictValue(catalog, "/Outlines"))
+	if err != nil {
+		t.Fatalf("outline root: %v", err)
+	}
+	var items []testOutlineItem
+	var read func(first string)
+	read = func(first string) {
+		for num, ok := referenceTo(first); ok; num, ok = referenceTo(first) {
+			entry, err := file.Object(num)
+			if err != nil {
+				t.Fatalf("outline entry: %v", err)
+			}
+			item := testOutlineItem{title: dictValue(entry, "/Title"), page: -1}
+			if refs := references(dictValue(entry, "/Dest")); len(refs) > 0 {
+				if page, ok := index[refs[0]]; ok {
+					item.page = page
+				}
+			}
+			items = append(items, item)
+			read(dictValue(entry, "/First"))
+			first = dictValue(entry, "/Next")
+		}
+	}
+	read(dictValue(root, "/First"))
+	return items
+}
+
+func TestMergePDFs(t *testing.T) {
+	parts := []MergePart{
+		{Data: testPDF{objects: testPDFObjects}.classic(""), Title: "Terms"},
+		{Data: testPDF{objects: testPDFObjects, compressed: allCompressed}.xrefStream()},
+	}
+	output, err := MergePDFs(parts, domain.DocumentMetadata{}, domain.PrintOptions{})
+	if err != nil {
+		t.Fatalf("MergePDFs() error = %v", err)
+	}
+	if output.PageCount != 4 {
+		t.Errorf("PageCount = %d, want 4", output.PageCount)
+	}
+
+	file, err := readPDF(output.Data)
+	if err != nil {
+		t.Fatalf("merged file is unreadable: %v", err)
+	}
+	pages, err := file.Pages()
+	if err != nil || len(pages) != 4 {
+		t.Fatalf("Pages() = %d pages, %v, want 4", len(pages), err)
+	}
+	for i, page := range pages {
+		content, err := file.Resolve(dictValue(page.dict, "/Contents"))
+		if err != nil {
+			t.Fatalf("page %d content: %v", i+1, err)
+		}
+		if _, data, _ := splitStream(content); string(data) != testPDFContent {
+			t.Errorf("page %d content = %q, want %q", i+1, data, testPDFContent)
+		}
+	}
+
+	// Each part's entries lead to its own pages, though both name their destination /Intro
+	want := []testOutlineItem{{"(Terms)", 0}, {"(Intro)", 1}, {"(Intro)", 3}}
+	if got := readTestOutline(t, file); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("outline = %v, want %v", got, want)
+	}
+
+	// The earlier part keeps a name both parts use
+	catalog, _ := file.Object(file.Root())
+	dests := dictValue(catalog, "/Dests")
+	if refs := references(dictValue(dests, "/Intro")); len(refs) != 1 || refs[0] != pages[1].num {
+		t.Errorf("/Dests /Intro = %q, want the second page", dictValue(dests, "/Intro"))
+	}
+}
+
+func TestMergePDFsEncrypts(t *testing.T) {
+	options := domain.PrintOptions{}
+	options.Output.Encryption = &domain.Encryption{UserPassword: "user", OwnerPassword: "owner", Algorithm: domain.EncryptionAES256}
+	output, err := MergePDFs([]MergePart{{Data: testPDF{objects: testPDFObjects}.classic("")}}, domain.DocumentMetadata{}, options)
+	if err != nil {
+		t.Fatalf("MergePDFs() error = %v", err)
+	}
+	if !bytes.Contains(output.Data, []byte("/Encrypt")) {
+		t.Error("merged file has no /Encrypt dictionary")
+	}
+	if bytes.Contains(output.Data, []byte(testPDFContent)) {
+		t.Error("merged file holds the content stream in clear text")
+	}
+}
+
+func TestMergePDFsRejectsUnreadableParts(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []MergePart
+	}{
+		{"no parts", nil},
+		{"not a PDF", []MergePart{{Data: []byte("<html></html>")}}},
+		{"encrypted", []MergePart{{Data: testPDF{objects: testPDFObjects}.classic(" /Encrypt 8 0 R")}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := MergePDFs(tt.parts, domain.DocumentMetadata{}, domain.PrintOptions{}); err == nil {
+				t.Error("MergePDFs() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestRenumberReferences(t *testing.T) {
+	renumber := func(num int) int {
+		return map[int]int{1: 11, 2: 12}[num]
+	}
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"dictionary", "<</A 1 0 R /B [2 0 R 3 0 R]>>", "<</A 11 0 R /B [12 0 R null]>>"},
+		{"nested", "<</A <</B 1 0 R>>>>", "<</A <</B 11 0 R>>>>"},
+		{"numbers", "[1 0 2 1 0 R]", "[1 0 2 11 0 R]"},
+		{"strings", "<</A (1 0 R) /B <31> /C 2 0 R>>", "<</A (1 0 R) /B <31> /C 12 0 R>>"},
+		{"names", "<</F1 1 0 R /Im2 2 0 R>>", "<</F1 11 0 R /Im2 12 0 R>>"},
+		{"stream data", "<</Length 5 /A 1 0 R>>\nstream\n1 0 R\nendstream", "<</Length 5 /A 11 0 R>>\nstream\n1 0 R\nendstream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renumberReferences(tt.body, renumber); got != tt.want {
+				t.Errorf("renumberReferences(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,1002 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"sync"
+)
+
+// otData is a table or subtable of an OpenType font read in place. Fonts are
+// uploaded by users, so every read is bounds checked: a malformed table
+// reads as zeros, which makes lookups not match instead of failing.
+type otData []byte
+
+// u16 reads an unsigned 16-bit value
+func (d otData) u16(off int) int {
+	if off < 0 || off+2 > len(d) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(d[off:]))
+}
+
+// i16 reads a signed 16-bit value
+func (d otData) i16(off int) int {
+	return int(int16(d.u16(off)))
+}
+
+// u32 reads an unsigned 32-bit value
+func (d otData) u32(off int) int {
+	if off < 0 || off+4 > len(d) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(d[off:]))
+}
+
+// tag reads a four-character tag
+func (d otData) tag(off int) string {
+	if off < 0 || off+4 > len(d) {
+		return ""
+	}
+	return string(d[off : off+4])
+}
+
+// at returns the subtable at an offset, or nil for a null or invalid offset
+func (d otData) at(off int) otData {
+	if off <= 0 || off >= len(d) {
+		return nil
+	}
+	return d[off:]
+}
+
+// coverage returns the index of a glyph in a coverage table, or -1
+func (d otData) coverage(glyph uint16) int {
+	g := int(glyph)
+	switch d.u16(0) {
+	case 1:
+		count := d.u16(2)
+		i := sort.Search(count, func(i int) bool { return d.u16(4+2*i) >= g })
+		if i < count && d.u16(4+2*i) == g {
+			return i
+		}
+	case 2:
+		count := d.u16(2)
+		i := sort.Search(count, func(i int) bool { return d.u16(4+6*i+2) >= g })
+		if i < count && d.u16(4+6*i) <= g {
+			return d.u16(4+6*i+4) + g - d.u16(4+6*i)
+		}
+	}
+	return -1
+}
+
+// class returns the class of a glyph in a class definition table, 0 when it has none
+func (d otData) class(glyph uint16) int {
+	g := int(glyph)
+	switch d.u16(0) {
+	case 1:
+		start, count := d.u16(2), d.u16(4)
+		if g >= start && g < start+count {
+			return d.u16(6 + 2*(g-start))
+		}
+	case 2:
+		count := d.u16(2)
+		i := sort.Search(count, func(i int) bool { return d.u16(4+6*i+2) >= g })
+		if i < count && d.u16(4+6*i) <= g {
+			return d.u16(4 + 6*i + 4)
+		}
+	}
+	return 0
+}
+
+// anchor reads the coordinates of an anchor table in font units
+func (d otData) anchor() (x, y int) {
+	return d.i16(2), d.i16(4)
+}
+
+// GDEF glyph classes
+const (
+	glyphClassBase      = 1
+	glyphClassLigature  = 2
+	glyphClassMark      = 3
+	glyphClassComponent = 4
+)
+
+// Lookup flags
+const (
+	lookupRightToLeft         = 0x0001
+	lookupIgnoreBaseGlyphs    = 0x0002
+	lookupIgnoreLigatures     = 0x0004
+	lookupIgnoreMarks         = 0x0008
+	lookupUseMarkFilteringSet = 0x0010
+	lookupMarkAttachmentType  = 0xFF00
+)
+
+// Lookup types that apply the subtables of another lookup type
+const (
+	gsubExtension = 7
+	gposExtension = 9
+)
+
+// otFont holds the tables of a face used to shape text
+type otFont struct {
+	unitsPerEm int
+	numGlyphs  int
+	advances   []int // Horizontal advance of each glyph in font units
+	cmap       map[rune]uint16
+	glyphClass otData // GDEF glyph class definitions
+	markClass  otData // GDEF mark attachment classes
+	markSets   otData // GDEF mark glyph sets
+	gsub       otData
+	gpos       otData
+
+	mu    sync.Mutex
+	plans map[*otScript]*otPlan // Lookups applied to each script, built on first use
+}
+
+// fontTables returns the tables of a TrueType file by tag
+func fontTables(data []byte) map[string]otData {
+	d := otData(data)
+	tables := make(map[string]otData)
+	for i := 0; i < d.u16(4); i++ {
+		record := 12 + 16*i
+		offset, length := d.u32(record+8), d.u32(record+12)
+		if offset <= 0 || length <= 0 || offset+length > len(data) {
+			continue
+		}
+		tables[d.tag(record)] = d[offset : offset+length]
+	}
+	return tables
+}
+
+// parseOTFont reads the tables used for shaping. It returns nil when the
+// face has neither glyph substitutions nor positioning.
+func parseOTFont(data []byte) *otFont {
+	tables := fontTables(data)
+	if tables["GSUB"] == nil && tables["GPOS"] == nil {
+		return nil
+	}
+
+	f := &otFont{
+		unitsPerEm: tables["head"].u16(18),
+		numGlyphs:  tables["maxp"].u16(4),
+		gsub:       tables["GSUB"],
+		gpos:       tables["GPOS"],
+		cmap:       parseCmap(tables["cmap"]),
+	}
+	if f.unitsPerEm == 0 {
+		f.unitsPerEm = 1000
+	}
+
+	// Glyphs after the last long metric share its advance
+	metrics := tables["hhea"].u16(34)
+	hmtx := tables["hmtx"]
+	f.advances = make([]int, f.numGlyphs)
+	last := 0
+	for g := range f.advances {
+		if g < metrics {
+			last = hmtx.u16(4 * g)
+		}
+		f.advances[g] = last
+	}
+
+	if gdef := tables["GDEF"]; gdef != nil {
+		f.glyphClass = gdef.at(gdef.u16(4))
+		f.markClass = gdef.at(gdef.u16(10))
+		if gdef.u16(2) >= 2 {
+			f.markSets = gdef.at(gdef.u16(12))
+		}
+	}
+	return f
+}
+
+// parseCmap reads the Unicode mappings of a cmap table, preferring the full
+// repertoire (format 12) over the Basic Multilingual Plane (format 4)
+func parseCmap(cmap otData) map[rune]uint16 {
+	var bmp, full otData
+	for i := 0; i < cmap.u16(2); i++ {
+		record := 4 + 8*i
+		platform, encoding := cmap.u16(record), cmap.u16(record+2)
+		sub := cmap.at(cmap.u32(record + 4))
+		unicode := platform == 0 || (platform == 3 && (encoding == 1 || encoding == 10))
+		switch {
+		case !unicode:
+		case sub.u16(0) == 4:
+			bmp = sub
+		case sub.u16(0) == 12:
+			full = sub
+		}
+	}
+
+	mapping := make(map[rune]uint16)
+	switch {
+	case full != nil:
+		for i := 0; i < full.u32(12) && 16+12*i+12 <= len(full); i++ {
+			group := 16 + 12*i
+			start, end, glyph := full.u32(group), full.u32(group+4), full.u32(group+8)
+			for c := start; c <= end && c-start < 0x10000 && c <= 0x10FFFF; c++ {
+				mapping[rune(c)] = uint16(glyph + c - start)
+			}
+		}
+	case bmp != nil:
+		segments := bmp.u16(6) / 2
+		ends, starts, deltas, ranges := 14, 16+2*segments, 16+4*segments, 16+6*segments
+		for s := 0; s < segments; s++ {
+			start, end := bmp.u16(starts+2*s), bmp.u16(ends+2*s)
+			delta, rangeOffset := bmp.u16(deltas+2*s), bmp.u16(ranges+2*s)
+			for c := start; c <= end && c != 0xFFFF; c++ {
+				glyph := 0
+				if rangeOffset == 0 {
+					glyph = (c + delta) & 0xFFFF
+				} else if glyph = bmp.u16(ranges + 2*s + rangeOffset + 2*(c-start)); glyph != 0 {
+					glyph = (glyph + delta) & 0xFFFF
+				}
+				if glyph != 0 {
+					mapping[rune(c)] = uint16(glyph)
+				}
+			}
+		}
+	}
+	return mapping
+}
+
+// glyphClassOf returns the GDEF class of a glyph, 0 when the font has none
+func (f *otFont) glyphClassOf(glyph uint16) int {
+	return f.glyphClass.class(glyph)
+}
+
+// advance returns the advance of a glyph in font units
+func (f *otFont) advance(glyph uint16) int {
+	if int(glyph) < len(f.advances) {
+		return f.advances[glyph]
+	}
+	return 0
+}
+
+// otFeature is a feature applied by a shaping stage, to the glyphs whose
+// mask has its bit set
+type otFeature struct {
+	tag  string
+	mask uint32
+}
+
+// otLookup is a lookup selected for a stage, with the mask of the features that enable it
+type otLookup struct {
+	index int
+	mask  uint32
+}
+
+// langSys returns the default language system of the first of some scripts
+// the table has, or nil when it has none of them
+func langSys(table otData, scripts ...string) otData {
+	list := table.at(table.u16(4))
+	for _, script := range scripts {
+		for i := 0; i < list.u16(0); i++ {
+			if list.tag(2+6*i) == script {
+				entry := list.at(list.u16(2 + 6*i + 4))
+				return entry.at(entry.u16(0))
+			}
+		}
+	}
+	return nil
+}
+
+// lookups returns the lookups a language system enables for some features,
+// in lookup list order
+func lookups(table, lang otData, features []otFeature) []otLookup {
+	if lang == nil {
+		return nil
+	}
+	list := table.at(table.u16(6))
+	masks := make(map[int]uint32)
+	for i := 0; i < lang.u16(4); i++ {
+		index := lang.u16(6 + 2*i)
+		tag := list.tag(2 + 6*index)
+		for _, feature := range features {
+			if feature.tag != tag {
+				continue
+			}
+			record := list.at(list.u16(2 + 6*index + 4))
+			for j := 0; j < record.u16(2); j++ {
+				masks[record.u16(4+2*j)] |= feature.mask
+			}
+		}
+	}
+
+	selected := make([]otLookup, 0, len(masks))
+	for index, mask := range masks {
+		selected = append(selected, otLookup{index: index, mask: mask})
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].index < selected[j].index })
+	return selected
+}
+
+// otGlyph is a glyph of a run being shaped
+type otGlyph struct {
+	id       uint16
+	cluster  int    // Index of the first character the glyph stands for
+	mask     uint32 // Features that apply to the glyph
+	ligID    int    // Ligature formed by the glyph or, for marks, skipped by it
+	ligComp  int    // Ligature component a mark follows, 1 based
+	ligComps int    // Components of a ligature glyph
+	advance  int    // Horizontal advance in font units
+	x, y     int    // Offset from the pen position, or from the base of an attached mark
+	attach   int    // Position of the glyph a mark is attached to, plus one
+	role     int    // Role of the glyph in an Indic syllable
+}
+
+// otMaxNesting bounds the lookups a contextual lookup may call in turn
+const otMaxNesting = 8
+
+// otApplier applies the lookups of a GSUB or GPOS table to a run of glyphs
+type otApplier struct {
+	font   *otFont
+	table  otData
+	gpos   bool
+	rtl    bool
+	glyphs []otGlyph
+	ops    int // Subtables left to try before giving up on a malformed font
+	ligIDs int
+}
+
+// newOTApplier creates an applier for a run with a budget proportional to its length
+func newOTApplier(font *otFont, table otData, gpos, rtl bool, glyphs []otGlyph) *otApplier {
+	return &otApplier{font: font, table: table, gpos: gpos, rtl: rtl, glyphs: glyphs, ops: max(16384, 64*len(glyphs))}
+}
+
+// lookup returns a lookup table by index
+func (a *otApplier) lookup(index int) otData {
+	list := a.table.at(a.table.u16(8))
+	if index >= list.u16(0) {
+		return nil
+	}
+	return list.at(list.u16(2 + 2*index))
+}
+
+// subtables returns the subtables of a lookup with their types, resolving extensions
+func (a *otApplier) subtables(lookup otData) ([]otData, []int) {
+	kind := lookup.u16(0)
+	count := lookup.u16(4)
+	subs := make([]otData, 0, count)
+	kinds := make([]int, 0, count)
+	for i := 0; i < count; i++ {
+		sub := lookup.at(lookup.u16(6 + 2*i))
+		subKind := kind
+		if (!a.gpos && kind == gsubExtension) || (a.gpos && kind == gposExtension) {
+			subKind = sub.u16(2)
+			sub = sub.at(sub.u32(4))
+		}
+		subs = append(subs, sub)
+		kinds = append(kinds, subKind)
+	}
+	return subs, kinds
+}
+
+// skips reports whether a lookup with flags ignores a glyph
+func (a *otApplier) skips(glyph uint16, flag int, lookup otData) bool {
+	class := a.font.glyphClassOf(glyph)
+	switch {
+	case class == glyphClassBase && flag&lookupIgnoreBaseGlyphs != 0,
+		class == glyphClassLigature && flag&lookupIgnoreLigatures != 0,
+		class == glyphClassMark && flag&lookupIgnoreMarks != 0:
+		return true
+	case class != glyphClassMark:
+		return false
+	case flag&lookupUseMarkFilteringSet != 0:
+		set := lookup.u16(6 + 2*lookup.u16(4))
+		sets := a.font.markSets
+		return sets.at(sets.u32(4+4*set)).coverage(glyph) < 0
+	case flag&lookupMarkAttachmentType != 0:
+		return a.font.markClass.class(glyph) != flag>>8
+	}
+	return false
+}
+
+// next returns the position of the first glyph after i that a lookup does not skip, or -1
+func (a *otApplier) next(i, flag int, lookup otData) int {
+	for j := i + 1; j < len(a.glyphs); j++ {
+		if !a.skips(a.glyphs[j].id, flag, lookup) {
+			return j
+		}
+	}
+	return -1
+}
+
+// prev returns the position of the first glyph before i that a lookup does not skip, or -1
+func (a *otApplier) prev(i, flag int, lookup otData) int {
+	for j := i - 1; j >= 0; j-- {
+		if !a.skips(a.glyphs[j].id, flag, lookup) {
+			return j
+		}
+	}
+	return -1
+}
+
+// apply applies lookups in order to the glyphs whose mask they match
+func (a *otApplier) apply(selected []otLookup) []otGlyph {
+	for _, l := range selected {
+		lookup := a.lookup(l.index)
+		if lookup == nil {
+			continue
+		}
+		flag := lookup.u16(2)
+
+		// Reverse chaining substitutions run from the end of the text
+		if !a.gpos && lookup.u16(0) == 8 {
+			for i := len(a.glyphs) - 1; i >= 0; i-- {
+				if a.glyphs[i].mask&l.mask != 0 && !a.skips(a.glyphs[i].id, flag, lookup) {
+					a.applyAt(lookup, i, 0)
+				}
+			}
+			continue
+		}
+
+		for i := 0; i < len(a.glyphs); {
+			if a.glyphs[i].mask&l.mask == 0 || a.skips(a.glyphs[i].id, flag, lookup) {
+				i++
+				continue
+			}
+			if next, ok := a.applyAt(lookup, i, 0); ok {
+				i = max(next, i+1)
+			} else {
+				i++
+			}
+		}
+	}
+	return a.glyphs
+}
+
+// applyAt applies the first subtable of a lookup that matches at position i
+// and returns the position to continue from
+func (a *otApplier) applyAt(lookup otData, i, depth int) (int, bool) {
+	flag := lookup.u16(2)
+	subs, kinds := a.subtables(lookup)
+	for k, sub := range subs {
+		if a.ops--; a.ops < 0 {
+			return 0, false
+		}
+		var next int
+		var ok bool
+		if a.gpos {
+			next, ok = a.position(kinds[k], sub, i, flag, lookup, depth)
+		} else {
+			next, ok = a.substitute(kinds[k], sub, i, flag, lookup, depth)
+		}
+		if ok {
+			return next, true
+		}
+	}
+	return 0, false
+}
+
+// substitute applies a GSUB subtable at position i
+func (a *otApplier) substitute(kind int, sub otData, i, flag int, lookup otData, depth int) (int, bool) {
+	glyph := a.glyphs[i].id
+	switch kind {
+	case 1: // Single
+		index := sub.at(sub.u16(2)).coverage(glyph)
+		if index < 0 {
+			return 0, false
+		}
+		switch sub.u16(0) {
+		case 1:
+			a.glyphs[i].id = uint16(int(glyph) + sub.i16(4))
+		case 2:
+			if index >= sub.u16(4) {
+				return 0, false
+			}
+			a.glyphs[i].id = uint16(sub.u16(6 + 2*index))
+		default:
+			return 0, false
+		}
+		return i + 1, true
+
+	case 2: // Multiple
+		index := sub.at(sub.u16(2)).coverage(glyph)
+		if index < 0 || index >= sub.u16(4) {
+			return 0, false
+		}
+		sequence := sub.at(sub.u16(6 + 2*index))
+		count := sequence.u16(0)
+		if count == 0 {
+			return 0, false
+		}
+		replacement := make([]otGlyph, count)
+		for j := range replacement {
+			replacement[j] = a.glyphs[i]
+			replacement[j].id = uint16(sequence.u16(2 + 2*j))
+		}
+		a.glyphs = append(a.glyphs[:i], append(replacement, a.glyphs[i+1:]...)...)
+		return i + count, true
+
+	case 4: // Ligature
+		index := sub.at(sub.u16(2)).coverage(glyph)
+		if index < 0 || index >= sub.u16(4) {
+			return 0, false
+		}
+		set := sub.at(sub.u16(6 + 2*index))
+		for l := 0; l < set.u16(0); l++ {
+			ligature := set.at(set.u16(2 + 2*l))
+			components := ligature.u16(2)
+			if components == 0 {
+				continue
+			}
+			positions := []int{i}
+			for c := 1; c < components; c++ {
+				j := a.next(positions[len(positions)-1], flag, lookup)
+				if j < 0 || a.glyphs[j].id != uint16(ligature.u16(4+2*(c-1))) {
+					positions = nil
+					break
+				}
+				positions = append(positions, j)
+			}
+			if positions == nil {
+				continue
+			}
+			a.ligate(positions, uint16(ligature.u16(0)))
+			return i + 1, true
+		}
+		return 0, false
+
+	case 5, 6: // Contextual and chained contextual
+		return a.context(kind == 6, sub, i, flag, lookup, depth)
+
+	case 8: // Reverse chaining single
+		index := sub.at(sub.u16(2)).coverage(glyph)
+		if index < 0 {
+			return 0, false
+		}
+		backtrack := sub.u16(4)
+		lookahead := sub.u16(6 + 2*backtrack)
+		substitutes := 8 + 2*backtrack + 2*lookahead
+		if index >= sub.u16(substitutes) {
+			return 0, false
+		}
+		j := i
+		for b := 0; b < backtrack; b++ {
+			if j = a.prev(j, flag, lookup); j < 0 || sub.at(sub.u16(6+2*b)).coverage(a.glyphs[j].id) < 0 {
+				return 0, false
+			}
+		}
+		j = i
+		for l := 0; l < lookahead; l++ {
+			if j = a.next(j, flag, lookup); j < 0 || sub.at(sub.u16(8+2*backtrack+2*l)).coverage(a.glyphs[j].id) < 0 {
+				return 0, false
+			}
+		}
+		a.glyphs[i].id = uint16(sub.u16(substitutes + 2 + 2*index))
+		return i + 1, true
+	}
+	return 0, false
+}
+
+// ligate replaces the glyphs at positions with a ligature. Marks skipped
+// between the components stay after the ligature and remember which
+// component they followed.
+func (a *otApplier) ligate(positions []int, ligature uint16) {
+	first, last := positions[0], positions[len(positions)-1]
+	a.ligIDs++
+	id := a.ligIDs
+
+	cluster := a.glyphs[first].cluster
+	for j := first; j <= last; j++ {
+		cluster = min(cluster, a.glyphs[j].cluster)
+	}
+	component := 0
+	kept := a.glyphs[:first+1]
+	for j := first + 1; j <= last; j++ {
+		if component+1 < len(positions) && j == positions[component+1] {
+			component++
+			continue
+		}
+		mark := a.glyphs[j]
+		mark.ligID, mark.ligComp, mark.cluster = id, component+1, cluster
+		kept = append(kept, mark)
+	}
+	kept[first].id = ligature
+	kept[first].cluster = cluster
+	kept[first].ligID = id
+	kept[first].ligComps = len(positions)
+	a.glyphs = append(kept, a.glyphs[last+1:]...)
+
+	// Marks that follow the last component belong to it
+	for j := len(kept); j < len(a.glyphs) && a.font.glyphClassOf(a.glyphs[j].id) == glyphClassMark; j++ {
+		a.glyphs[j].ligID, a.glyphs[j].ligComp = id, len(positions)
+	}
+}
+
+// context applies a contextual (chained when chain is set) subtable at
+// position i: when the glyphs around it match, the lookups of the matching
+// rule are applied to the input sequence
+func (a *otApplier) context(chain bool, sub otData, i, flag int, lookup otData, depth int) (int, bool) {
+	glyph := a.glyphs[i].id
+	switch sub.u16(0) {
+	case 1, 2:
+		index := sub.at(sub.u16(2)).coverage(glyph)
+		if index < 0 {
+			return 0, false
+		}
+
+		// Format 1 rules list glyphs, format 2 rules list classes of the
+		// glyphs and are grouped by the class of the first one
+		var defs [3]otData
+		setCount, key := 4, index
+		if sub.u16(0) == 2 {
+			if chain {
+				defs = [3]otData{sub.at(sub.u16(4)), sub.at(sub.u16(6)), sub.at(sub.u16(8))}
+				setCount = 10
+			} else {
+				def := sub.at(sub.u16(4))
+				defs = [3]otData{def, def, def}
+				setCount = 6
+			}
+			key = defs[1].class(glyph)
+		}
+		if key >= sub.u16(setCount) {
+			return 0, false
+		}
+		matcher := func(seq int, values []int) func(uint16, int) bool {
+			if sub.u16(0) == 2 {
+				return func(g uint16, k int) bool { return defs[seq].class(g) == values[k] }
+			}
+			return func(g uint16, k int) bool { return int(g) == values[k] }
+		}
+
+		set := sub.at(sub.u16(setCount + 2 + 2*key))
+		for r := 0; r < set.u16(0); r++ {
+			rule := set.at(set.u16(2 + 2*r))
+			var backtrack, input, lookahead []int
+			var records otData
+			var count int
+			if chain {
+				backtrack = readValues(rule, 2, rule.u16(0))
+				off := 2 + 2*len(backtrack)
+				count = rule.u16(off)
+				input = append([]int{0}, readValues(rule, off+2, count-1)...)
+				off += 2 + 2*max(count-1, 0)
+				lookahead = readValues(rule, off+2, rule.u16(off))
+				off += 2 + 2*len(lookahead)
+				records = lookupRecords(rule, rule.u16(off), off+2)
+			} else {
+				count = rule.u16(0)
+				input = append([]int{0}, readValues(rule, 4, count-1)...)
+				records = lookupRecords(rule, rule.u16(2), 4+2*max(count-1, 0))
+			}
+			if count == 0 {
+				continue
+			}
+			if next, ok := a.matchRule(i, len(backtrack), len(input), len(lookahead),
+				matcher(0, backtrack), matcher(1, input), matcher(2, lookahead), records, flag, lookup, depth); ok {
+				return next, true
+			}
+		}
+		return 0, false
+
+	case 3:
+		var backtrack, input, lookahead []otData
+		var records otData
+		if chain {
+			off := 2
+			for _, seq := range []*[]otData{&backtrack, &input, &lookahead} {
+				count := sub.u16(off)
+				for k := 0; k < count; k++ {
+					*seq = append(*seq, sub.at(sub.u16(off+2+2*k)))
+				}
+				off += 2 + 2*count
+			}
+			records = lookupRecords(sub, sub.u16(off), off+2)
+		} else {
+			count := sub.u16(2)
+			for k := 0; k < count; k++ {
+				input = append(input, sub.at(sub.u16(6+2*k)))
+			}
+			records = lookupRecords(sub, sub.u16(4), 6+2*count)
+		}
+		if len(input) == 0 || input[0].coverage(glyph) < 0 {
+			return 0, false
+		}
+		covered := func(tables []otData) func(uint16, int) bool {
+			return func(g uint16, k int) bool { return tables[k].coverage(g) >= 0 }
+		}
+		return a.matchRule(i, len(backtrack), len(input), len(lookahead),
+			covered(backtrack), covered(input), covered(lookahead), records, flag, lookup, depth)
+	}
+	return 0, false
+}
+
+// readValues reads count 16-bit values at off
+func readValues(d otData, off, count int) []int {
+	values := make([]int, 0, max(count, 0))
+	for k := 0; k < count; k++ {
+		values = append(values, d.u16(off+2*k))
+	}
+	return values
+}
+
+// lookupRecords returns count sequence lookup records stored at off
+func lookupRecords(d otData, count, off int) otData {
+	if off > len(d) {
+		return nil
+	}
+	return d[off:min(len(d), off+4*count)]
+}
+
+// matchRule matches the backtrack, input and lookahead sequences of a
+// contextual rule around position i, where the first input glyph has already
+// matched, and applies the rule's lookups to the input
+func (a *otApplier) matchRule(i, backtrack, input, lookahead int, matchBacktrack, matchInput, matchLookahead func(uint16, int) bool,
+	records otData, flag int, lookup otData, depth int) (int, bool) {
+	positions := []int{i}
+	for k := 1; k < input; k++ {
+		j := a.next(positions[k-1], flag, lookup)
+		if j < 0 || !matchInput(a.glyphs[j].id, k) {
+			return 0, false
+		}
+		positions = append(positions, j)
+	}
+	j := i
+	for k := 0; k < backtrack; k++ {
+		if j = a.prev(j, flag, lookup); j < 0 || !matchBacktrack(a.glyphs[j].id, k) {
+			return 0, false
+		}
+	}
+	j = positions[len(positions)-1]
+	for k := 0; k < lookahead; k++ {
+		if j = a.next(j, flag, lookup); j < 0 || !matchLookahead(a.glyphs[j].id, k) {
+			return 0, false
+		}
+	}
+
+	end := positions[len(positions)-1] + 1
+	if depth >= otMaxNesting {
+		return end, true
+	}
+	for r := 0; r+4 <= len(records); r += 4 {
+		sequence, index := records.u16(r), records.u16(r+2)
+		nested := a.lookup(index)
+		if sequence >= len(positions) || nested == nil {
+			continue
+		}
+		at := positions[sequence]
+		if at >= len(a.glyphs) || a.skips(a.glyphs[at].id, nested.u16(2), nested) {
+			continue
+		}
+		before := len(a.glyphs)
+		a.applyAt(nested, at, depth+1)
+
+		// Glyphs added or removed by the nested lookup shift the rest of the input
+		if delta := len(a.glyphs) - before; delta != 0 {
+			for k := range positions {
+				if positions[k] > at {
+					positions[k] += delta
+				}
+			}
+			end += delta
+		}
+	}
+	return max(end, i+1), true
+}
+
+// valueRecord is a positioning adjustment in font units
+type valueRecord struct {
+	x, y, advance int
+}
+
+// readValueRecord reads a value record of a format at off and returns it with its size
+func readValueRecord(d otData, off, format int) (valueRecord, int) {
+	var v valueRecord
+	size := 0
+	for bit := 0; bit < 8; bit++ {
+		if format&(1<<bit) == 0 {
+			continue
+		}
+		value := d.i16(off + size)
+		switch bit {
+		case 0:
+			v.x = value
+		case 1:
+			v.y = value
+		case 2:
+			v.advance = value
+		}
+		size += 2
+	}
+	return v, size
+}
+
+// adjust applies a value record to the glyph at position i
+func (a *otApplier) adjust(i int, v valueRecord) {
+	a.glyphs[i].x += v.x
+	a.glyphs[i].y += v.y
+	a.glyphs[i].advance += v.advance
+}
+
+// position applies a GPOS subtable at position i
+func (a *otApplier) position(kind int, sub otData, i, flag int, lookup otData, depth int) (int, bool) {
+	glyph := a.glyphs[i].id
+	switch kind {
+	case 1: // Single adjustment
+		index := sub.at(sub.u16(2)).coverage(glyph)
+		if index < 0 {
+			return 0, false
+		}
+		format := sub.u16(4)
+		switch sub.u16(0) {
+		case 1:
+			v, _ := readValueRecord(sub, 6, format)
+			a.adjust(i, v)
+		case 2:
+			_, size := readValueRecord(sub, 0, format)
+			v, _ := readValueRecord(sub, 8+index*size, format)
+			a.adjust(i, v)
+		default:
+			return 0, false
+		}
+		return i + 1, true
+
+	case 2: // Pair adjustment
+		index := sub.at(sub.u16(2)).coverage(glyph)
+		j := a.next(i, flag, lookup)
+		if index < 0 || j < 0 {
+			return 0, false
+		}
+		format1, format2 := sub.u16(4), sub.u16(6)
+		_, size1 := readValueRecord(sub, 0, format1)
+		_, size2 := readValueRecord(sub, 0, format2)
+		second := a.glyphs[j].id
+		record := -1
+		var base otData
+		switch sub.u16(0) {
+		case 1:
+			if index >= sub.u16(8) {
+				return 0, false
+			}
+			base = sub.at(sub.u16(10 + 2*index))
+			size := 2 + size1 + size2
+			count := base.u16(0)
+			k := sort.Search(count, func(k int) bool { return base.u16(2+k*size) >= int(second) })
+			if k < count && base.u16(2+k*size) == int(second) {
+				record = 2 + k*size + 2
+			}
+		case 2:
+			class1, class2 := sub.at(sub.u16(8)).class(glyph), sub.at(sub.u16(10)).class(second)
+			if class1 >= sub.u16(12) || class2 >= sub.u16(14) {
+				return 0, false
+			}
+			base = sub
+			record = 16 + (class1*sub.u16(14)+class2)*(size1+size2)
+		}
+		if record < 0 {
+			return 0, false
+		}
+		v1, _ := readValueRecord(base, record, format1)
+		v2, _ := readValueRecord(base, record+size1, format2)
+		a.adjust(i, v1)
+		a.adjust(j, v2)
+		if format2 != 0 {
+			return j + 1, true
+		}
+		return j, true
+
+	case 4, 5, 6: // Mark to base, mark to ligature and mark to mark
+		markIndex := sub.at(sub.u16(2)).coverage(glyph)
+		if markIndex < 0 {
+			return 0, false
+		}
+
+		// Marks attach to the closest preceding base or ligature, or for
+		// mark to mark to the preceding mark itself
+		var j int
+		if kind == 6 {
+			j = a.prev(i, flag, lookup)
+			if j < 0 || a.font.glyphClassOf(a.glyphs[j].id) != glyphClassMark {
+				return 0, false
+			}
+		} else {
+			for j = i - 1; j >= 0 && a.font.glyphClassOf(a.glyphs[j].id) == glyphClassMark; j-- {
+			}
+			if j < 0 {
+				return 0, false
+			}
+		}
+		baseIndex := sub.at(sub.u16(4)).coverage(a.glyphs[j].id)
+		if baseIndex < 0 {
+			return 0, false
+		}
+
+		classes := sub.u16(6)
+		marks := sub.at(sub.u16(8))
+		class := marks.u16(2 + 4*markIndex)
+		markAnchor := marks.at(marks.u16(2 + 4*markIndex + 2))
+		if class >= classes || markAnchor == nil {
+			return 0, false
+		}
+
+		bases := sub.at(sub.u16(10))
+		var baseAnchor otData
+		if kind == 5 {
+			attach := bases.at(bases.u16(2 + 2*baseIndex))
+			components := attach.u16(0)
+			if components == 0 {
+				return 0, false
+			}
+			component := components
+			if g := a.glyphs[i]; g.ligID == a.glyphs[j].ligID && g.ligComp > 0 {
+				component = min(g.ligComp, components)
+			}
+			baseAnchor = attach.at(attach.u16(2 + 2*((component-1)*classes+class)))
+		} else {
+			baseAnchor = bases.at(bases.u16(2 + 2*(baseIndex*classes+class)))
+		}
+		if baseAnchor == nil {
+			return 0, false
+		}
+
+		bx, by := baseAnchor.anchor()
+		mx, my := markAnchor.anchor()
+		a.glyphs[i].x = bx - mx
+		a.glyphs[i].y = by - my
+		a.glyphs[i].attach = j + 1
+		return i + 1, true
+
+	case 7, 8: // Contextual and chained contextual
+		return a.context(kind == 8, sub, i, flag, lookup, depth)
+	}
+	return 0, false
+}
+
+// fontFileTables lists the tables kept in embedded subsets, in tag order
+var fontFileTables = []string{"OS/2", "cmap", "cvt ", "fpgm", "glyf", "head", "hhea", "hmtx", "loca", "maxp", "post", "prep"}
+
+// assembleFont writes a TrueType file from its tables
+func assembleFont(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= len(tags) {
+		entrySelector++
+	}
+	var buf bytes.Buffer
+	header := []uint16{uint16(len(tags)), uint16(16 << entrySelector), uint16(entrySelector), uint16(16*len(tags) - 16<<entrySelector)}
+	_ = binary.Write(&buf, binary.BigEndian, uint32(sfntVersionTrueType))
+	_ = binary.Write(&buf, binary.BigEndian, header)
+
+	offset := 12 + 16*len(tags)
+	var body bytes.Buffer
+	headOffset := -1
+	for _, tag := range tags {
+		data := tables[tag]
+		if tag == "head" && len(data) >= 12 {
+			data = append([]byte(nil), data...)
+			binary.BigEndian.PutUint32(data[8:], 0) // Recomputed below
+			headOffset = offset + body.Len()
+		}
+		buf.WriteString(tag)
+		_ = binary.Write(&buf, binary.BigEndian, []uint32{tableChecksum(data), uint32(offset + body.Len()), uint32(len(data))})
+		body.Write(data)
+		for body.Len()%4 != 0 {
+			body.WriteByte(0)
+		}
+	}
+	buf.Write(body.Bytes())
+
+	font := buf.Bytes()
+	if headOffset >= 0 {
+		binary.BigEndian.PutUint32(font[headOffset+8:], 0xB1B0AFBA-tableChecksum(font))
+	}
+	return font
+}
+
+// tableChecksum sums the big-endian 32-bit words of a table
+func tableChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
@@ -0,0 +1,108 @@
+package render
+
+import (
+	"strings"
+	"unicode/utf16"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/layout"
+)
+
+// Heading attributes that control the outline
+const (
+	bookmarkLabelAttribute = "data-bookmark-label"
+	noBookmarkAttribute    = "data-no-bookmark"
+)
+
+// headingRanks maps heading elements to their rank
+var headingRanks = map[string]int{"h1": 1, "h2": 2, "h3": 3, "h4": 4, "h5": 5, "h6": 6}
+
+// OutlineEntry is a document outline bookmark pointing at a heading
+type OutlineEntry struct {
+	Label string  // Bookmark text
+	Level int     // Nesting depth, 0 for top-level entries
+	Page  int     // 1-based page the heading starts on
+	Y     float64 // Top of the heading in layout space, in CSS pixels
+}
+
+// CollectOutline builds the outline entries for the h1-h6 elements of a
+// paginated layout tree, in document order.
+//
+// Headings with data-no-bookmark are left out and data-bookmark-label
+// replaces the heading text. Levels follow the heading ranks, with skipped
+// ranks collapsed so an h3 directly below an h1 nests one level deep.
+func CollectOutline(root *domain.LayoutNode, pageBreaks []*layout.PageBreak, pageBreaker *layout.PageBreaker) []OutlineEntry {
+	var entries []OutlineEntry
+	var ranks []int // Ranks of the open ancestors of the next entry
+
+	var walk func(node *domain.LayoutNode)
+	walk = func(node *domain.LayoutNode) {
+		if rank, ok := headingRanks[node.Tag]; ok {
+			if _, skip := node.Attributes[noBookmarkAttribute]; !skip {
+				label, ok := node.Attributes[bookmarkLabelAttribute]
+				if !ok {
+					label = layoutText(node)
+				}
+				if label = strings.Join(strings.Fields(label), " "); label != "" {
+					for len(ranks) > 0 && ranks[len(ranks)-1] >= rank {
+						ranks = ranks[:len(ranks)-1]
+					}
+					entries = append(entries, OutlineEntry{
+						Label: label,
+						Level: len(ranks),
+						Page:  pageBreaker.GetPageForY(pageBreaks, node.Box.Y),
+						Y:     node.Box.Y,
+					})
+					ranks = append(ranks, rank)
+				}
+			}
+			return // Headings do not nest
+		}
+
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	if root != nil {
+		walk(root)
+	}
+
+	return entries
+}
+
+// layoutText concatenates the text content below a layout node
+func layoutText(node *domain.LayoutNode) string {
+	if node.Content != "" {
+		return node.Content
+	}
+
+	parts := make([]string, 0, len(node.Children))
+	for _, child := range node.Children {
+		if text := layoutText(child); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// pdfTextString encodes text for a PDF text string that gofpdf writes
+// verbatim: ASCII stays as-is and anything else becomes UTF-16BE with a
+// byte order mark
+func pdfTextString(text string) string {
+	ascii := true
+	for i := 0; i < len(text); i++ {
+		if text[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return text
+	}
+
+	encoded := []byte{0xFE, 0xFF}
+	for _, unit := range utf16.Encode([]rune(text)) {
+		encoded = append(encoded, byte(unit>>8), byte(unit))
+	}
+	return string(encoded)
+}
@@ -0,0 +1,73 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/layout"
+)
+
+// outlineDocument has headings of skipped ranks over two pages
+const outlineDocument = `<h1>Introduction</h1><h3>Scope</h3><h2 data-bookmark-label="Background">Some history</h2>` +
+	`<h2 data-no-bookmark>Aside</h2><h1 style="break-before: page">Results <em>so far</em></h1><h2>Café</h2>`
+
+func TestCollectOutline(t *testing.T) {
+	options := domain.DefaultPrintOptions()
+	root := layoutTestHTML(t, outlineDocument, options)
+	breaker := layout.NewPageBreaker()
+	pageBreaks, err := breaker.CalculatePageBreaks(root, ResolvePageGeometry(options.Page).ContentHeightPixels())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, entry := range CollectOutline(root, pageBreaks, breaker) {
+		got = append(got, fmt.Sprintf("%d %s p%d", entry.Level, entry.Label, entry.Page))
+	}
+	want := []string{"0 Introduction p1", "1 Scope p1", "1 Background p1", "0 Results so far p2", "1 Café p2"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("CollectOutline() = %q, want %q", got, want)
+	}
+	if entries := CollectOutline(nil, nil, breaker); entries != nil {
+		t.Errorf("CollectOutline(nil) = %v, want none", entries)
+	}
+}
+
+func TestPDFTextString(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"Results", "Results"},
+		{"Café", "\xfe\xff\x00C\x00a\x00f\x00\xe9"},
+		{"𝄞", "\xfe\xff\xd8\x34\xdd\x1e"},
+	}
+	for _, tt := range tests {
+		if got := pdfTextString(tt.text); got != tt.want {
+			t.Errorf("pdfTextString(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPDFRendererOutline(t *testing.T) {
+	options := domain.DefaultPrintOptions()
+	output := renderTestPDF(t, outlineDocument, options, PDFRenderOptions{})
+	if strings.Contains(string(output.Data), "/Outlines") {
+		t.Error("outline written without GenerateOutline")
+	}
+
+	options.Render.GenerateOutline = true
+	pdf := string(renderTestPDF(t, outlineDocument, options, PDFRenderOptions{}).Data)
+	if !strings.Contains(pdf, "/Outlines") || !strings.Contains(pdf, "/PageMode /UseOutlines") {
+		t.Error("catalog does not open the outline")
+	}
+	for _, title := range []string{"(Introduction)", "(Scope)", "(Background)", "(Results so far)"} {
+		if !strings.Contains(pdf, "/Title "+title) {
+			t.Errorf("outline has no bookmark %s", title)
+		}
+	}
+	if strings.Contains(pdf, "/Title (Aside)") {
+		t.Error("heading with data-no-bookmark is in the outline")
+	}
+}
@@ -0,0 +1,92 @@
+package render
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+
+	"print-service/internal/core/domain"
+)
+
+// RenderOutput is the result of rendering a layout tree
+type RenderOutput struct {
+	Data      []byte                // Encoded document
+	PageCount int                   // Number of pages produced
+	Extension string                // File extension matching Data, e.g. "pdf", "png" or "zip"
+	Warnings  []string              // Non-fatal problems found while rendering
+	Signature *domain.SignatureInfo // Digital signature of the output, nil when unsigned
+}
+
+// selectPages returns the 0-based indexes of the pages to render for a
+// 1-based page number, or of every page for 0
+func selectPages(count, pageNumber int) ([]int, error) {
+	if pageNumber < 0 || pageNumber > count {
+		return nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "page number out of range", domain.ErrInvalidDocument).
+			WithDetail("page_number", pageNumber).
+			WithDetail("page_count", count)
+	}
+	if pageNumber > 0 {
+		return []int{pageNumber - 1}, nil
+	}
+	pages := make([]int, count)
+	for i := range pages {
+		pages[i] = i
+	}
+	return pages, nil
+}
+
+// pageArchive collects encoded pages as they are rendered. A single page is
+// returned as-is and several pages are written to a ZIP archive one at a
+// time, so only the archive is held in memory.
+type pageArchive struct {
+	extension string
+	count     int
+	first     []byte // The first page, until a second one starts the archive
+	buf       bytes.Buffer
+	archive   *zip.Writer
+}
+
+// newPageArchive creates an archive of pages with the given file extension
+func newPageArchive(extension string) *pageArchive {
+	return &pageArchive{extension: extension}
+}
+
+// Add appends the next encoded page
+func (a *pageArchive) Add(data []byte) error {
+	a.count++
+	switch a.count {
+	case 1:
+		a.first = data
+		return nil
+	case 2:
+		a.archive = zip.NewWriter(&a.buf)
+		if err := a.write(1, a.first); err != nil {
+			return err
+		}
+		a.first = nil
+	}
+	return a.write(a.count, data)
+}
+
+// write adds a page to the ZIP archive
+func (a *pageArchive) write(number int, data []byte) error {
+	entry, err := a.archive.Create(fmt.Sprintf("page-%03d.%s", number, a.extension))
+	if err != nil {
+		return fmt.Errorf("failed to add page %d to archive: %w", number, err)
+	}
+	if _, err := entry.Write(data); err != nil {
+		return fmt.Errorf("failed to write page %d to archive: %w", number, err)
+	}
+	return nil
+}
+
+// Output returns the single page, or the finished archive of several pages
+func (a *pageArchive) Output() (*RenderOutput, error) {
+	if a.archive == nil {
+		return &RenderOutput{Data: a.first, PageCount: a.count, Extension: a.extension}, nil
+	}
+	if err := a.archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize archive: %w", err)
+	}
+	return &RenderOutput{Data: a.buf.Bytes(), PageCount: a.count, Extension: "zip"}, nil
+}
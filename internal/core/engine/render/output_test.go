@@ -0,0 +1,67 @@
+package render
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestSelectPages(t *testing.T) {
+	tests := []struct {
+		count, pageNumber int
+		want              []int
+		wantErr           bool
+	}{
+		{3, 0, []int{0, 1, 2}, false},
+		{3, 2, []int{1}, false},
+		{3, 3, []int{2}, false},
+		{3, 4, nil, true},
+		{3, -1, nil, true},
+		{1, 0, []int{0}, false},
+	}
+	for _, tt := range tests {
+		got, err := selectPages(tt.count, tt.pageNumber)
+		if (err != nil) != tt.wantErr || fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("selectPages(%d, %d) = %v, %v, want %v", tt.count, tt.pageNumber, got, err, tt.want)
+		}
+	}
+}
+
+func TestPageArchive(t *testing.T) {
+	single := newPageArchive("png")
+	single.Add([]byte("page 1"))
+	output, err := single.Output()
+	if err != nil {
+		t.Fatalf("Output() error = %v", err)
+	}
+	if string(output.Data) != "page 1" || output.Extension != "png" || output.PageCount != 1 {
+		t.Errorf("Output() = %q .%s with %d pages, want the page itself", output.Data, output.Extension, output.PageCount)
+	}
+
+	several := newPageArchive("png")
+	for i := 1; i <= 3; i++ {
+		if err := several.Add([]byte(fmt.Sprintf("page %d", i))); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	output, err = several.Output()
+	if err != nil {
+		t.Fatalf("Output() error = %v", err)
+	}
+	if output.Extension != "zip" || output.PageCount != 3 {
+		t.Fatalf("Output() = .%s with %d pages, want a ZIP archive of 3", output.Extension, output.PageCount)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(output.Data), int64(len(output.Data)))
+	if err != nil {
+		t.Fatalf("invalid archive: %v", err)
+	}
+	for i, file := range archive.File {
+		reader, _ := file.Open()
+		data, _ := io.ReadAll(reader)
+		if name, want := file.Name, fmt.Sprintf("page-%03d.png", i+1); name != want || string(data) != fmt.Sprintf("page %d", i+1) {
+			t.Errorf("entry %d = %s %q, want %s", i, name, data, want)
+		}
+	}
+}
@@ -1,18 +1,26 @@
 package render
 
 import (
+	"bytes"
 	"fmt"
+	"image"
+	"math"
+	"slices"
 	"strings"
+	"time"
 
 	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/layout"
 
 	"github.com/jung-kurt/gofpdf"
+	"golang.org/x/text/encoding/charmap"
 )
 
 // PDFRenderer handles PDF generation with advanced rendering capabilities
 type PDFRenderer struct {
 	fontManager *FontManager
-	imageCache  *ImageCache
+	textEngine  *layout.TextEngine
+	pageBreaker *layout.PageBreaker
 	options     PDFRenderOptions
 }
 
@@ -24,8 +32,14 @@ type PDFRenderOptions struct {
 	ColorProfile   ColorProfile // Color profile for output
 	OutputIntent   OutputIntent // PDF output intent
 	PDFVersion     string       // PDF version (e.g., "1.4", "1.7")
+	Fonts          *FontManager // Registry of fonts available for embedding
+	Signer         *Signer      // Certificate and key for signed output, nil when signing is not configured
+	MaxImagePixels int64        // Largest width × height of a watermark image, 0 for the default
 }
 
+// pdfProducer names the software that writes the PDF in the document properties
+const pdfProducer = "Print Service PDF Renderer"
+
 // ColorProfile represents color profiles for PDF output
 type ColorProfile string
 
@@ -42,81 +56,402 @@ type OutputIntent struct {
 	Condition    string // Human-readable condition
 	Info         string // Additional information
 	RegistryName string // Registry name
+	Profile      []byte // ICC profile embedded as the destination output profile
 }
 
 // RenderContext provides rendering context for PDF generation
 type RenderContext struct {
-	PDF         *gofpdf.Fpdf // PDF document instance
-	CurrentPage int          // Current page number
-	PageWidth   float64      // Page width in mm
-	PageHeight  float64      // Page height in mm
-	DPI         float64      // Dots per inch
-	Scale       float64      // Scaling factor
+	PDF         *gofpdf.Fpdf    // PDF document instance
+	CurrentPage int             // Current page number
+	PageWidth   float64         // Page width in mm
+	PageHeight  float64         // Page height in mm
+	OriginX     float64         // Left edge of the content area in mm
+	OriginY     float64         // Top edge of the content area in mm
+	DPI         float64         // Dots per inch
+	Scale       float64         // Scaling factor
+	EmbedFonts  bool            // Use registered fonts, embedded as subsets
+	Embedded    map[string]bool // Registered faces already added to the document
+	Missing     map[rune]bool   // Characters no available font could draw
+	Font        *pdfFace        // Face currently selected on the document
+	Tags        *pdfTagger      // Structure being recorded, nil for untagged output
+	EmbedOnly   bool            // Never fall back to the unembedded core fonts
+	Opaque      bool            // Draw without transparency, as PDF/A-1 requires
+	Colors      *colorConverter // Output color space
+	Images      *pdfImageSet    // Images converted to the output color space
+	Links       *pdfLinks       // Links and link targets being recorded
+	Forms       *pdfForms       // Form fields being placed
+	Pictures    *pdfPictures    // Images of img elements, registered with the document
+	Patterns    *pdfPatternSet  // Gradients of artwork, written after the document
+	Glyphs      *pdfGlyphFonts  // Faces of shaped text, written after the document
+}
+
+// ToPage converts a layout box in CSS pixels to page coordinates in mm
+func (ctx RenderContext) ToPage(box domain.Box) (x, y, w, h float64) {
+	return ctx.OriginX + ctx.Length(box.X),
+		ctx.OriginY + ctx.Length(box.Y),
+		ctx.Length(box.Width),
+		ctx.Length(box.Height)
+}
+
+// Length converts a length in CSS pixels to mm
+func (ctx RenderContext) Length(px float64) float64 {
+	return PixelsToMM(px) * ctx.Scale
 }
 
 // NewPDFRenderer creates a new PDF renderer with specified options
 func NewPDFRenderer(opts PDFRenderOptions) *PDFRenderer {
+	fontManager := opts.Fonts
+	if fontManager == nil {
+		fontManager = NewFontManager()
+	}
 	return &PDFRenderer{
-		fontManager: NewFontManager(),
-		imageCache:  NewImageCache(),
+		fontManager: fontManager,
+		textEngine:  layout.NewTextEngine(),
+		pageBreaker: layout.NewPageBreaker(),
 		options:     opts,
 	}
 }
 
 // Render renders a layout tree to PDF format with high-quality output
-func (r *PDFRenderer) Render(layout *domain.LayoutNode, options domain.PrintOptions) ([]byte, error) {
+func (r *PDFRenderer) Render(layout *domain.LayoutNode, running *layout.RunningContent, options domain.PrintOptions, metadata domain.DocumentMetadata) (*RenderOutput, error) {
+	return r.RenderPart(layout, running, options, metadata, standalone)
+}
+
+// RenderPart renders a layout tree as Render does, numbering its pages as
+// numbering places them in a larger document
+func (r *PDFRenderer) RenderPart(layout *domain.LayoutNode, running *layout.RunningContent, options domain.PrintOptions, metadata domain.DocumentMetadata, numbering layout.PageNumbering) (*RenderOutput, error) {
+	page := ResolvePageGeometry(options.Page)
+	level, archival, err := resolvePDFA(options.Render.PDFA)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := resolveColorProfile(options.Render.ColorProfile, r.options.ColorProfile)
+	if err != nil {
+		return nil, err
+	}
+	encryption := options.Output.Encryption
+	if archival && encryption != nil {
+		return nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "PDF/A does not allow encryption", domain.ErrUnsupportedFormat).
+			WithDetail("pdfa", options.Render.PDFA)
+	}
+
+	// Split the layout into pages of the printable height
+	pageBreaks, err := r.pageBreaker.CalculateNumberedPageBreaks(layout, page.ContentHeightPixels(), numbering)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate page breaks: %w", err)
+	}
+	margins, err := layoutMargins(running, len(pageBreaks), numbering)
+	if err != nil {
+		return nil, err
+	}
+
+	// Signatures are placed in the field element while its page is drawn
+	var signature *pdfSignature
+	if request := options.Output.Signature; request != nil {
+		if r.options.Signer == nil {
+			return nil, domain.NewPrintError(domain.ErrCodeUnavailable, "PDF signing is not configured", domain.ErrRenderFailed)
+		}
+		signature, err = newPDFSignature(r.options.Signer, *request, layout, pageBreaks, r.pageBreaker, time.Now().Round(time.Second))
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Initialize PDF document with specified orientation and page size
-	pdf := gofpdf.New(
-		string(options.Page.Orientation), // Portrait or Landscape
-		"mm",                             // Unit of measurement
-		string(options.Page.Size.Name),   // Page size (A4, Letter, etc.)
-		"",                               // Font directory (empty for built-in)
-	)
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{
+		OrientationStr: "portrait",                                       // Geometry is already oriented
+		UnitStr:        "mm",                                             // Unit of measurement
+		Size:           gofpdf.SizeType{Wd: page.Width, Ht: page.Height}, // Page size in mm
+	})
+	pdf.SetCompression(r.options.Compression)
+	pdf.SetMargins(page.Margins.Left, page.Margins.Top, page.Margins.Right)
+	pdf.SetAutoPageBreak(false, page.Margins.Bottom)
+
+	// Configure PDF metadata for document properties. The request's own
+	// properties are only written when metadata output is enabled.
+	if !options.Output.Metadata {
+		metadata = domain.DocumentMetadata{}
+	}
+	info := newDocumentInfo(metadata, time.Now().Round(time.Second))
+	pdf.SetTitle(info.Title, true)
+	pdf.SetAuthor(info.Author, true)
+	if info.Subject != "" {
+		pdf.SetSubject(info.Subject, true)
+	}
+	if len(info.Keywords) > 0 {
+		pdf.SetKeywords(infoKeywords(info.Keywords), true)
+	}
+	pdf.SetCreator(info.Creator, true)
+	pdf.SetProducer(info.Producer, true)
+	pdf.SetCreationDate(info.Created)
+	pdf.SetModificationDate(info.Created)
+
+	// Form controls become fillable fields unless flattened. Field appearances
+	// use standard fonts, which PDF/A does not allow, so archival forms are flattened.
+	flatten := options.Render.FlattenForms || archival
+	forms := newPDFForms(layout, flatten)
+
+	// Accessible output records the document structure while drawing and
+	// embeds every font so text can be extracted reliably
+	var tags *pdfTagger
+	if options.Render.Accessibility {
+		tags = newPDFTagger(layout, flatten)
+	}
+
+	// Link areas and targets are recorded as their text and elements are drawn
+	links := newPDFLinks(layout)
+
+	// Colors are converted through the configured output profile where it matches
+	colors := newColorConverter(profile, r.options.OutputIntent.Profile)
+	images := newPDFImageSet(colors)
+	patterns := newPDFPatternSet(colors)
+	glyphs := newPDFGlyphFonts()
+
+	// Decode and register the watermark image once so every page shares it
+	watermark := options.Output.Watermark
+	var watermarkImage *ImageContent
+	var watermarkDecoded image.Image
+	if watermark.Visible() && watermark.Image != "" {
+		if watermarkImage, watermarkDecoded, err = loadWatermarkImage(watermark, r.options.MaxImagePixels); err != nil {
+			return nil, err
+		}
+		registerImage(pdf, images, watermarkImageResourceID, watermarkImage, watermarkDecoded)
+	}
 
-	// Configure PDF metadata for document properties
-	pdf.SetTitle("Generated Document", false)
-	pdf.SetAuthor("Print Service", false)
-	pdf.SetCreator("Pure Go Print Service", false)
+	// Archival output refuses what the level cannot represent up front
+	var intent OutputIntent
+	if archival {
+		intent = r.outputIntent()
+		if err := r.checkPDFA(level, intent, profile, watermarkDecoded); err != nil {
+			return nil, err
+		}
+	}
+	opaque := archival && !level.AllowsTransparency()
+
+	// Images are embedded once, at the resolution of their largest use
+	pictures := newPDFPictures(page.Scale, append([]*domain.LayoutNode{layout}, marginRoots(margins)...)...)
+	if err := pictures.Register(pdf, images, pdfPictureOptions{
+		Optimize:  r.options.OptimizeImages && options.Render.OptimizeImages,
+		TargetDPI: imageTargetDPI(options.Render.Quality),
+		Quality:   JPEGQuality(options.Render.Quality),
+		Opaque:    opaque,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to embed images: %w", err)
+	}
 
-	// Create rendering context with document parameters
-	ctx := RenderContext{
-		PDF:         pdf,                         // PDF document instance
-		CurrentPage: 1,                           // Start with page 1
-		PageWidth:   options.Page.Size.Width,     // Page width in mm
-		PageHeight:  options.Page.Size.Height,    // Page height in mm
-		DPI:         float64(options.Layout.DPI), // Resolution
-		Scale:       options.Page.Scale,          // Scaling factor
+	// Registered fonts are added to the document on first use and subset on output.
+	// Tagged and archival output must embed every font.
+	embedded := make(map[string]bool)
+	missing := make(map[rune]bool)
+	embedOnly := tags != nil || archival
+	embedFonts := r.options.EmbedFonts && options.Render.EmbedFonts || embedOnly
+	font := &pdfFace{}
+
+	// Bookmarks are added page by page as gofpdf attaches them to the current page
+	var outline []OutlineEntry
+	if options.Render.GenerateOutline {
+		outline = CollectOutline(layout, pageBreaks, r.pageBreaker)
 	}
 
-	// Add the first page to the document
-	pdf.AddPage()
+	for i, pageBreak := range pageBreaks {
+		pdf.AddPage()
+
+		// Create rendering context that maps this page's slice of the layout onto the sheet
+		ctx := RenderContext{
+			PDF:         pdf,                                                        // PDF document instance
+			CurrentPage: pageBreak.PageNumber,                                       // Page being drawn
+			PageWidth:   page.Width,                                                 // Page width in mm
+			PageHeight:  page.Height,                                                // Page height in mm
+			OriginX:     page.Margins.Left,                                          // Content starts inside the margins
+			OriginY:     page.Margins.Top - PixelsToMM(pageBreak.StartY)*page.Scale, // Page top in layout space
+			DPI:         float64(options.Layout.DPI),                                // Resolution
+			Scale:       page.Scale,                                                 // Scaling factor
+			EmbedFonts:  embedFonts,                                                 // Registered fonts allowed
+			Embedded:    embedded,                                                   // Faces added so far
+			Missing:     missing,                                                    // Uncovered characters
+			Font:        font,                                                       // Selected face
+			Tags:        tags,                                                       // Structure recorder
+			EmbedOnly:   embedOnly,                                                  // Core fonts not allowed
+			Opaque:      opaque,                                                     // Transparency not allowed
+			Colors:      colors,                                                     // Output color space
+			Images:      images,                                                     // Converted images
+			Links:       links,                                                      // Link recorder
+			Forms:       forms,                                                      // Form fields
+			Pictures:    pictures,                                                   // Embedded images
+			Patterns:    patterns,                                                   // Artwork gradients
+			Glyphs:      glyphs,                                                     // Shaped text faces
+		}
+		r.addBookmarks(outline, ctx)
 
-	// Render the complete layout tree recursively
-	if err := r.renderLayoutNode(layout, ctx); err != nil {
-		return nil, fmt.Errorf("failed to render layout: %w", err)
+		// Without transparency a watermark can only sit beneath the content
+		if watermark.Visible() && opaque {
+			tags.BeginArtifact(pdf)
+			r.renderWatermark(watermark, watermarkImage, page, ctx)
+			tags.End(pdf)
+		}
+
+		// Keep content that spans several pages inside the printable area
+		pdf.ClipRect(page.Margins.Left, page.Margins.Top, page.ContentWidth(), page.ContentHeight(), false)
+		for _, node := range pageBreak.Nodes {
+			if err := r.renderLayoutNode(node, ctx); err != nil {
+				return nil, fmt.Errorf("failed to render page %d: %w", pageBreak.PageNumber, err)
+			}
+		}
+		r.renderSignature(signature, ctx)
+		pdf.ClipEnd()
+
+		// Headers and footers are drawn in the margins around the content
+		if err := r.renderMargins(margins[i], page, ctx); err != nil {
+			return nil, fmt.Errorf("failed to render headers and footers of page %d: %w", pageBreak.PageNumber, err)
+		}
+
+		// Watermarks are stamped over the content and may extend into the margins
+		if watermark.Visible() && !opaque {
+			tags.BeginArtifact(pdf)
+			r.renderWatermark(watermark, watermarkImage, page, ctx)
+			tags.End(pdf)
+		}
 	}
 
 	// Generate final PDF as byte array
-	var buf strings.Builder
-	err := pdf.Output(&buf)
-	if err != nil {
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
 		return nil, fmt.Errorf("failed to generate PDF: %w", err)
 	}
+	warnings := missingGlyphWarnings(missing)
+	warnings = append(warnings, pictures.Warnings()...)
+
+	// The header carries the configured version, or the one the PDF/A part is based on
+	data := buf.Bytes()
+	version := r.options.PDFVersion
+	if archival {
+		version = level.Version
+	}
+	if encryption != nil && version < "1.7" {
+		version = "1.7" // AES needs PDF 1.6, and AES-256 is an extension of 1.7
+	}
+	if version != "" {
+		if data, err = setPDFHeader(data, version); err != nil {
+			return nil, fmt.Errorf("failed to write PDF header: %w", err)
+		}
+	}
+
+	// Entries gofpdf cannot write are appended as an incremental update
+	update, err := newPDFUpdate(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read generated PDF: %w", err)
+	}
+	if err := images.Write(update); err != nil {
+		return nil, fmt.Errorf("failed to write converted images: %w", err)
+	}
+	if err := patterns.Write(update); err != nil {
+		return nil, fmt.Errorf("failed to write gradients: %w", err)
+	}
+	if err := glyphs.Write(update); err != nil {
+		return nil, fmt.Errorf("failed to write shaped text fonts: %w", err)
+	}
+	if err := setBlendingSpace(update, colors); err != nil {
+		return nil, fmt.Errorf("failed to set page blending color space: %w", err)
+	}
+	if err := links.Write(update); err != nil {
+		return nil, fmt.Errorf("failed to write link annotations: %w", err)
+	}
+	warnings = append(warnings, links.Warnings()...)
+	if err := forms.Write(update, r, colors); err != nil {
+		return nil, fmt.Errorf("failed to write form fields: %w", err)
+	}
+	warnings = append(warnings, forms.Warnings(archival && !options.Render.FlattenForms, tags != nil)...)
+	meta := xmpMetadata{documentInfo: info}
+	if tags != nil {
+		tags.AddLinks(links)
+		tags.AddForms(forms)
+		if err := tags.Write(update); err != nil {
+			return nil, fmt.Errorf("failed to write PDF structure tree: %w", err)
+		}
+		meta.Lang, meta.PDFUAPart = tags.lang, 1
+		warnings = append(warnings, tags.Warnings()...)
+	}
+	if archival {
+		if err := writeArchival(update, level, intent, data); err != nil {
+			return nil, fmt.Errorf("failed to write PDF/A entries: %w", err)
+		}
+		meta.PDFAPart, meta.PDFAConformance = level.Part, level.Conformance
+		warnings = append(warnings, pdfaWarnings(level, watermark, missing)...)
+	}
+	if tags != nil || archival || options.Output.Metadata {
+		if err := attachXMP(update, meta); err != nil {
+			return nil, fmt.Errorf("failed to write XMP metadata: %w", err)
+		}
+	}
+
+	if signature != nil {
+		if err := signature.Write(update); err != nil {
+			return nil, fmt.Errorf("failed to write signature field: %w", err)
+		}
+	}
+
+	// Encryption rewrites the whole document so every object is covered
+	data = update.Bytes()
+	if encryption != nil {
+		if data, err = writeEncrypted(update, *encryption, data); err != nil {
+			return nil, fmt.Errorf("failed to encrypt PDF: %w", err)
+		}
+	}
+
+	// The signature covers the finished file, so it comes last
+	output := &RenderOutput{
+		PageCount: len(pageBreaks),
+		Extension: "pdf",
+		Warnings:  warnings,
+	}
+	if signature != nil {
+		if data, err = signature.Sign(data); err != nil {
+			return nil, fmt.Errorf("failed to sign PDF: %w", err)
+		}
+		output.Signature = signature.Info()
+	}
+	output.Data = data
+	return output, nil
+}
+
+// addBookmarks adds the outline entries for headings that start on the current page
+func (r *PDFRenderer) addBookmarks(outline []OutlineEntry, ctx RenderContext) {
+	for _, entry := range outline {
+		if entry.Page != ctx.CurrentPage {
+			continue
+		}
 
-	return []byte(buf.String()), nil
+		// gofpdf only converts labels to UTF-16 itself while a UTF-8 font is selected
+		label := entry.Label
+		if ctx.Font.info == nil {
+			label = pdfTextString(label)
+		}
+		_, y, _, _ := ctx.ToPage(domain.Box{Y: entry.Y})
+		ctx.PDF.Bookmark(label, entry.Level, y)
+	}
 }
 
-// renderLayoutNode renders a layout node and its children recursively
+// renderLayoutNode renders a single layout node; its children are listed on the page separately
 func (r *PDFRenderer) renderLayoutNode(node *domain.LayoutNode, ctx RenderContext) error {
 	if node == nil {
 		return nil
 	}
+	ctx.Links.PlaceTarget(node, ctx)
+
+	// Form controls draw their own content as a field
+	if layout.InFormControl(node) {
+		return nil
+	}
+	if field := ctx.Forms.Field(node); field != nil {
+		r.renderField(field, ctx)
+		return nil
+	}
 
 	// Render content based on node type
 	switch node.Type {
 	case "text":
 		// Render text content with styling
-		if err := r.RenderText(node.Content, node.Style, ctx); err != nil {
+		if err := r.RenderText(node, ctx); err != nil {
 			return fmt.Errorf("failed to render text: %w", err)
 		}
 	case "element":
@@ -124,13 +459,9 @@ func (r *PDFRenderer) renderLayoutNode(node *domain.LayoutNode, ctx RenderContex
 		if err := r.RenderElement(node, ctx); err != nil {
 			return fmt.Errorf("failed to render element: %w", err)
 		}
-	}
-
-	// Recursively render all child nodes
-	for _, child := range node.Children {
-		if err := r.renderLayoutNode(child, ctx); err != nil {
-			return fmt.Errorf("failed to render child node: %w", err)
-		}
+		ctx.Pictures.Draw(node, ctx)
+		r.renderDrawing(node, ctx)
+		r.renderBarcode(node, ctx)
 	}
 
 	return nil
@@ -138,10 +469,18 @@ func (r *PDFRenderer) renderLayoutNode(node *domain.LayoutNode, ctx RenderContex
 
 // RenderElement renders a layout element with background and border styling
 func (r *PDFRenderer) RenderElement(elem *domain.LayoutNode, ctx RenderContext) error {
-	// Render element background if present
+	// Backgrounds and borders are decoration, not content
+	if elem.Style.Background.Color.A != 0 || elem.Style.Background.Loaded != nil || elem.Style.Border.Width > 0 {
+		ctx.Tags.BeginArtifact(ctx.PDF)
+		defer ctx.Tags.End(ctx.PDF)
+	}
+
+	// Render element background if present, with its image over the color
 	if err := r.renderBackground(elem.Style.Background, elem.Box, ctx); err != nil {
 		return fmt.Errorf("failed to render background: %w", err)
 	}
+	ctx.Pictures.DrawBackground(elem, ctx)
+	r.renderBackgroundDrawing(elem, ctx)
 
 	// Render element border if present
 	if err := r.renderBorder(elem.Style.Border, elem.Box, ctx); err != nil {
@@ -151,50 +490,109 @@ func (r *PDFRenderer) RenderElement(elem *domain.LayoutNode, ctx RenderContext)
 	return nil
 }
 
-// RenderText renders text content with proper font styling and positioning
-func (r *PDFRenderer) RenderText(content string, style domain.ComputedStyle, ctx RenderContext) error {
-	if content == "" {
+// RenderText renders a text node line by line inside its layout box
+func (r *PDFRenderer) RenderText(node *domain.LayoutNode, ctx RenderContext) error {
+	if node.Content == "" {
 		return nil // Skip empty content
 	}
+	style := node.Style
 
-	// Configure font properties
-	fontFamily := r.mapFontFamily(style.Font.Family)                 // Map CSS font to PDF font
-	fontSize := style.Font.Size                                      // Font size in points
-	fontStyle := r.mapFontStyle(style.Font.Weight, style.Font.Style) // Bold/italic styling
+	// Pick the faces used for this node; characters the first lacks fall back along the chain
+	fontSize := PixelsToPoints(style.Font.Size) * ctx.Scale // Font size in points
+	chain := r.fontChain(style.Font, ctx)
+
+	// Configure text color in the output color space
+	ctx.SetFill(style.Color)
+
+	// Break the text exactly as the layout engine did so lines match the box height
+	lines := r.textEngine.SplitTextIntoLines(node.Content, style.Font, node.Box.Width)
+	lineHeight := r.textEngine.CalculateLineHeight(style.Font, style.Text.LineHeight)
+	boxX, boxY, boxWidth, _ := ctx.ToPage(node.Box)
+
+	ctx.Tags.BeginText(node, ctx)
+	defer ctx.Tags.End(ctx.PDF)
+
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
 
-	// Apply font settings to PDF context
-	ctx.PDF.SetFont(fontFamily, fontStyle, fontSize)
+		// Shape and reorder the line, then align it using the real glyph metrics
+		runs := r.shapeLine(line, style.Text.Direction, chain, ctx)
+		x := boxX
+		lineWidth := r.runsWidth(runs, fontSize, ctx)
+		switch r.textEngine.ResolveAlign(style.Text) {
+		case domain.TextAlignCenter:
+			x += (boxWidth - lineWidth) / 2
+		case domain.TextAlignRight:
+			x += boxWidth - lineWidth
+		}
 
-	// Configure text color from RGBA values
-	red := float64(style.Color.R) / 255.0   // Normalize red component
-	green := float64(style.Color.G) / 255.0 // Normalize green component
-	blue := float64(style.Color.B) / 255.0  // Normalize blue component
-	ctx.PDF.SetTextColor(int(red*255), int(green*255), int(blue*255))
+		// Place the baseline inside the line box
+		y := boxY + ctx.Length(float64(i)*lineHeight+baselineOffset(style.Font.Size, lineHeight))
+		r.drawRuns(runs, x, y, fontSize, ctx)
+		ctx.Links.AddArea(node, ctx, x, boxY+ctx.Length(float64(i)*lineHeight), lineWidth, ctx.Length(lineHeight))
 
-	// Calculate text position (simplified positioning)
-	x := 10.0 // Left margin in mm
-	y := 20.0 // Top margin in mm
+		if strings.Contains(style.Text.Decoration, "underline") {
+			ctx.SetStroke(style.Color)
+			ctx.PDF.SetLineWidth(fontSize / 20 * 25.4 / 72)
+			ctx.PDF.Line(x, y+fontSize*0.1*25.4/72, x+lineWidth, y+fontSize*0.1*25.4/72)
+		}
 
-	// Render text at calculated position
-	ctx.PDF.Text(x, y, content)
+		if i == len(lines)-1 && node.Leader != nil {
+			r.renderLeader(node, chain, fontSize, x+lineWidth, boxX+boxWidth+ctx.Length(node.Leader.Width),
+				boxY+ctx.Length(float64(i)*lineHeight), y, ctx.Length(lineHeight), ctx)
+		}
+	}
 
 	return nil
 }
 
+// renderWatermark stamps a translucent, optionally rotated watermark on the current page
+func (r *PDFRenderer) renderWatermark(wm *domain.Watermark, img *ImageContent, page PageGeometry, ctx RenderContext) {
+	pdf := ctx.PDF
+	placement := resolveWatermark(wm, page)
+
+	if !ctx.Opaque {
+		pdf.SetAlpha(placement.Opacity, "Normal")
+	}
+	pdf.TransformBegin()
+	if placement.Angle != 0 {
+		pdf.TransformRotate(placement.Angle, placement.X, placement.Y)
+	}
+
+	if img != nil {
+		w, h := watermarkImageSize(img, placement)
+		drawImage(watermarkImageResourceID, img, placement.X-placement.AnchorX*w, placement.Y-placement.AnchorY*h, w, h, ctx)
+	}
+
+	if wm.Text != "" {
+		chain := r.fontChain(domain.FontStyle{Family: watermarkFontFamily, Weight: 700}, ctx)
+		runs := r.shapeLine(wm.Text, r.textEngine.DetectDirection(wm.Text), chain, ctx)
+		ctx.SetFill(domain.Color{R: watermarkTextColorLevel, G: watermarkTextColorLevel, B: watermarkTextColorLevel, A: 255})
+		w := r.runsWidth(runs, placement.FontSize, ctx)
+		h := placement.FontSize * mmPerInch / pointsPerInch
+		r.drawRuns(runs, placement.X-placement.AnchorX*w, watermarkBaseline(placement.Y, h, placement.AnchorY), placement.FontSize, ctx)
+	}
+
+	pdf.TransformEnd()
+	if !ctx.Opaque {
+		pdf.SetAlpha(1, "Normal")
+	}
+}
+
 // renderBackground renders element background with color and transparency support
 func (r *PDFRenderer) renderBackground(bg domain.Background, bounds domain.Box, ctx RenderContext) error {
 	if bg.Color.A == 0 {
 		return nil // Skip transparent backgrounds
 	}
 
-	// Configure background fill color from RGBA values
-	red := float64(bg.Color.R) / 255.0   // Normalize red component
-	green := float64(bg.Color.G) / 255.0 // Normalize green component
-	blue := float64(bg.Color.B) / 255.0  // Normalize blue component
-	ctx.PDF.SetFillColor(int(red*255), int(green*255), int(blue*255))
+	// Configure background fill color in the output color space
+	ctx.SetFill(bg.Color)
 
 	// Draw filled rectangle for background
-	ctx.PDF.Rect(bounds.X, bounds.Y, bounds.Width, bounds.Height, "F")
+	x, y, w, h := ctx.ToPage(bounds)
+	ctx.PDF.Rect(x, y, w, h, "F")
 
 	return nil
 }
@@ -206,42 +604,273 @@ func (r *PDFRenderer) renderBorder(border domain.BorderStyle, bounds domain.Box,
 	}
 
 	// Configure border line width
-	ctx.PDF.SetLineWidth(border.Width)
+	lineWidth := ctx.Length(border.Width)
+	ctx.PDF.SetLineWidth(lineWidth)
 
-	// Configure border color from RGBA values
-	red := float64(border.Color.R) / 255.0   // Normalize red component
-	green := float64(border.Color.G) / 255.0 // Normalize green component
-	blue := float64(border.Color.B) / 255.0  // Normalize blue component
-	ctx.PDF.SetDrawColor(int(red*255), int(green*255), int(blue*255))
+	// Configure border color in the output color space
+	ctx.SetStroke(border.Color)
+
+	// Stroke along the middle of the border edge so the outer edge matches the box
+	x, y, w, h := ctx.ToPage(bounds)
+	x, y, w, h = x+lineWidth/2, y+lineWidth/2, w-lineWidth, h-lineWidth
 
 	// Render border based on specified style
 	switch border.Style {
-	case domain.BorderSolid:
+	case domain.BorderSolid, domain.BorderDouble:
 		// Draw solid border rectangle
-		ctx.PDF.Rect(bounds.X, bounds.Y, bounds.Width, bounds.Height, "D")
+		ctx.PDF.Rect(x, y, w, h, "D")
 	case domain.BorderDashed:
 		// Configure and draw dashed border
-		ctx.PDF.SetDashPattern([]float64{5, 3}, 0) // 5mm dash, 3mm gap
-		ctx.PDF.Rect(bounds.X, bounds.Y, bounds.Width, bounds.Height, "D")
+		ctx.PDF.SetDashPattern([]float64{3 * lineWidth, 3 * lineWidth}, 0)
+		ctx.PDF.Rect(x, y, w, h, "D")
 		ctx.PDF.SetDashPattern([]float64{}, 0) // Reset to solid
 	case domain.BorderDotted:
 		// Configure and draw dotted border
-		ctx.PDF.SetDashPattern([]float64{1, 2}, 0) // 1mm dot, 2mm gap
-		ctx.PDF.Rect(bounds.X, bounds.Y, bounds.Width, bounds.Height, "D")
+		ctx.PDF.SetDashPattern([]float64{lineWidth, lineWidth}, 0)
+		ctx.PDF.Rect(x, y, w, h, "D")
 		ctx.PDF.SetDashPattern([]float64{}, 0) // Reset to solid
 	}
 
 	return nil
 }
 
+// pdfFace is the font used for a run of text: a registered face embedded as a
+// UTF-8 subset, or a core font drawn with the cp1252 encoding
+type pdfFace struct {
+	info  *FontInfo // Registered face, nil for core fonts
+	core  string    // Core font family
+	style string    // Core font style code
+}
+
+// pdfTextRun is a piece of a line drawn with a single face
+type pdfTextRun struct {
+	face   pdfFace
+	text   string     // UTF-8 for registered faces, cp1252 for core fonts
+	shaped *shapedRun // Glyphs shaped with the face's layout tables, drawn instead of text
+}
+
+// fontChain returns the faces tried, in order, for the characters of a computed font
+func (r *PDFRenderer) fontChain(font domain.FontStyle, ctx RenderContext) []pdfFace {
+	var chain []pdfFace
+	if ctx.EmbedFonts {
+		if info, ok := r.fontManager.Resolve(font.Family, font.Weight, font.Style); ok {
+			chain = append(chain, pdfFace{info: &info})
+		}
+	}
+
+	// Without a registered face the text starts in the closest core font
+	core := r.mapFontFamily(font.Family)
+	if len(chain) == 0 && !ctx.EmbedOnly {
+		chain = append(chain, pdfFace{core: core, style: fontStyleCode(font.Weight, font.Style)})
+	}
+
+	// Embedded fallbacks supply the characters core fonts cannot encode
+	if ctx.EmbedFonts {
+		for _, info := range r.fontManager.Fallbacks(font.Weight, font.Style, core == "Courier") {
+			chain = append(chain, pdfFace{info: &info})
+		}
+	}
+
+	return chain
+}
+
+// covers reports whether a face can draw a character
+func (r *PDFRenderer) covers(face pdfFace, ch rune) bool {
+	if face.info != nil {
+		return r.fontManager.HasGlyph(*face.info, ch)
+	}
+	_, ok := charmap.Windows1252.EncodeRune(ch)
+	return ok
+}
+
+// shapeLine reorders a line for display and breaks it into runs drawn with
+// the same face. Text in the scripts a face has layout tables for is shaped
+// with them; other text is shaped character by character.
+func (r *PDFRenderer) shapeLine(line string, direction domain.TextDirection, chain []pdfFace, ctx RenderContext) []pdfTextRun {
+	shapers := make([]*otFont, len(chain))
+	shaping := false
+	for i, face := range chain {
+		if face.info != nil {
+			shapers[i] = r.fontManager.shaper(*face.info)
+			shaping = shaping || shapers[i] != nil
+		}
+	}
+	if !shaping {
+		return r.splitRuns(r.textEngine.ShapeLine(line, direction), chain, ctx)
+	}
+
+	var runs []pdfTextRun
+	for _, visual := range r.textEngine.VisualRuns(line, direction) {
+		pieces := splitPieces([]rune(visual.Text), len(chain),
+			func(face int, ch rune) bool { return r.covers(chain[face], ch) },
+			func(face int) bool { return shapers[face] != nil }, ctx.Missing)
+
+		// Pieces are in logical order, so right-to-left runs are laid out from their last piece
+		if visual.RTL {
+			slices.Reverse(pieces)
+		}
+		for _, piece := range pieces {
+			if piece.script == nil {
+				runs = append(runs, r.splitRuns(r.textEngine.ShapeRun(layout.TextRun{Text: string(piece.text), RTL: visual.RTL}), chain, ctx)...)
+				continue
+			}
+			shaped := shapers[piece.face].shape(piece.text, piece.script, visual.RTL)
+			runs = append(runs, pdfTextRun{face: chain[piece.face], shaped: &shaped})
+		}
+	}
+	return runs
+}
+
+// splitRuns breaks a line into runs drawn with the same face, recording
+// characters that no face in the chain covers
+func (r *PDFRenderer) splitRuns(line string, chain []pdfFace, ctx RenderContext) []pdfTextRun {
+	var runs []pdfTextRun
+	var pending []rune
+	current := -1
+
+	flush := func() {
+		if len(pending) > 0 {
+			runs = append(runs, pdfTextRun{face: chain[current], text: encodeRun(chain[current], pending)})
+			pending = nil
+		}
+	}
+
+	for _, ch := range line {
+		// Stay in the current face while it covers the text so runs are not split needlessly
+		index := -1
+		if current >= 0 && r.covers(chain[current], ch) {
+			index = current
+		} else {
+			for i, face := range chain {
+				if r.covers(face, ch) {
+					index = i
+					break
+				}
+			}
+		}
+		if index < 0 {
+			ctx.Missing[ch] = true
+			index = max(current, 0)
+		}
+
+		if index != current {
+			flush()
+			current = index
+		}
+		pending = append(pending, ch)
+	}
+	flush()
+
+	return runs
+}
+
+// encodeRun encodes characters for the face that draws them
+func encodeRun(face pdfFace, text []rune) string {
+	if face.info != nil {
+		return string(text)
+	}
+
+	encoded := make([]byte, len(text))
+	for i, ch := range text {
+		b, ok := charmap.Windows1252.EncodeRune(ch)
+		if !ok {
+			b = '?'
+		}
+		encoded[i] = b
+	}
+	return string(encoded)
+}
+
+// useFace selects a face on the document, adding registered faces on first use
+func (r *PDFRenderer) useFace(face pdfFace, size float64, ctx RenderContext) {
+	*ctx.Font = face
+	if face.info == nil {
+		ctx.PDF.SetFont(face.core, face.style, size)
+		return
+	}
+
+	if !ctx.Embedded[face.info.ID] {
+		ctx.PDF.AddUTF8FontFromBytes(face.info.ID, "", face.info.Data) // Subset on output
+		ctx.Embedded[face.info.ID] = true
+	}
+	ctx.PDF.SetFont(face.info.ID, "", size)
+}
+
+// runsWidth measures a line of runs in mm
+func (r *PDFRenderer) runsWidth(runs []pdfTextRun, size float64, ctx RenderContext) float64 {
+	width := 0.0
+	for _, run := range runs {
+		width += r.runWidth(run, size, ctx)
+	}
+	return width
+}
+
+// runWidth measures a run in mm
+func (r *PDFRenderer) runWidth(run pdfTextRun, size float64, ctx RenderContext) float64 {
+	if run.shaped != nil {
+		return float64(run.shaped.advance) / float64(run.shaped.unitsPerEm) * size * mmPerInch / pointsPerInch
+	}
+	r.useFace(run.face, size, ctx)
+	return ctx.PDF.GetStringWidth(run.text)
+}
+
+// drawRuns draws a line of runs starting at the baseline point (x, y)
+func (r *PDFRenderer) drawRuns(runs []pdfTextRun, x, y, size float64, ctx RenderContext) {
+	for _, run := range runs {
+		if run.shaped != nil {
+			r.drawShaped(run, x, y, size, ctx)
+		} else {
+			r.useFace(run.face, size, ctx)
+			ctx.PDF.Text(x, y, run.text)
+		}
+		x += r.runWidth(run, size, ctx)
+	}
+}
+
+// drawShaped draws a shaped run by glyph ID. Glyphs are shown in groups
+// from each point where shaping moved them off the pen position, and the
+// run is marked with the text it stands for so it can be extracted.
+func (r *PDFRenderer) drawShaped(run pdfTextRun, x, y, size float64, ctx RenderContext) {
+	font := r.fontManager.shaper(*run.face.info)
+	name := ctx.Glyphs.Use(*run.face.info, font, run.shaped)
+
+	// gofpdf measures from the top of the page in mm; text space is in points
+	k := ctx.PDF.GetConversionRatio()
+	_, pageHeight := ctx.PDF.GetPageSize()
+	unit := size / float64(run.shaped.unitsPerEm)
+	originX, originY := x*k, (pageHeight-y)*k
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "/Span <</ActualText %s>> BDC q BT /%s %.2f Tf", pdfString(run.shaped.text), name, size)
+	penX, penY := 0.0, 0.0
+	open := false
+	for _, g := range run.shaped.glyphs {
+		gx, gy := originX+float64(g.x)*unit, originY+float64(g.y)*unit
+		if !open || math.Abs(gx-penX) > 0.01 || math.Abs(gy-penY) > 0.01 {
+			if open {
+				buf.WriteString("> Tj")
+			}
+			fmt.Fprintf(&buf, " 1 0 0 1 %.3f %.3f Tm <", gx, gy)
+			open = true
+		}
+		fmt.Fprintf(&buf, "%04X", g.id)
+		penX, penY = gx+float64(font.advance(g.id))*unit, gy
+	}
+	if open {
+		buf.WriteString("> Tj")
+	}
+	buf.WriteString(" ET Q EMC")
+	ctx.PDF.RawWriteStr(buf.String())
+}
+
 // mapFontFamily maps CSS font family names to PDF-compatible font families
 func (r *PDFRenderer) mapFontFamily(family string) string {
 	family = strings.ToLower(family)
 	switch {
-	case strings.Contains(family, "serif"):
-		return "Times" // Times New Roman for serif fonts
 	case strings.Contains(family, "sans-serif"):
 		return "Arial" // Arial for sans-serif fonts
+	case strings.Contains(family, "serif"):
+		return "Times" // Times New Roman for serif fonts
 	case strings.Contains(family, "monospace"):
 		return "Courier" // Courier for monospace fonts
 	default:
@@ -249,8 +878,8 @@ func (r *PDFRenderer) mapFontFamily(family string) string {
 	}
 }
 
-// mapFontStyle maps CSS font weight and style to PDF font style codes
-func (r *PDFRenderer) mapFontStyle(weight int, style string) string {
+// fontStyleCode maps CSS font weight and style to PDF font style codes
+func fontStyleCode(weight int, style string) string {
 	bold := weight >= 700                        // Bold if weight >= 700
 	italic := strings.ToLower(style) == "italic" // Italic if style is italic
 
@@ -267,33 +896,29 @@ func (r *PDFRenderer) mapFontStyle(weight int, style string) string {
 	}
 }
 
-// FontManager manages font resources and font loading for PDF rendering
-type FontManager struct {
-	fonts map[string]FontInfo // Map of font name to font information
-}
-
-// FontInfo represents detailed information about a font resource
-type FontInfo struct {
-	Family string // Font family name (e.g., "Arial", "Times")
-	Style  string // Font style (e.g., "B", "I", "BI")
-	Path   string // Path to font file (for custom fonts)
-}
-
-// NewFontManager creates a new font manager with initialized font registry
-func NewFontManager() *FontManager {
-	return &FontManager{
-		fonts: make(map[string]FontInfo),
+// registerImage adds an image to the document once so every use shares it.
+// gofpdf embeds RGB images as given; other color spaces need converted samples.
+func registerImage(pdf *gofpdf.Fpdf, images *pdfImageSet, id string, content *ImageContent, decoded image.Image) {
+	if images.colors.profile != ColorProfileRGB {
+		images.Register(id, decoded)
+		return
 	}
+	pdf.RegisterImageOptionsReader(id, gofpdf.ImageOptions{ImageType: pdfImageType(content.Format)}, bytes.NewReader(content.Data))
 }
 
-// ImageCache manages caching of images for efficient PDF rendering
-type ImageCache struct {
-	cache map[string][]byte // Map of image URL/hash to image data
+// drawImage places a registered image with its top-left corner at (x, y), in mm
+func drawImage(id string, content *ImageContent, x, y, w, h float64, ctx RenderContext) {
+	if ctx.Images.Has(id) {
+		ctx.Images.Draw(ctx.PDF, id, x, y, w, h)
+		return
+	}
+	ctx.PDF.ImageOptions(id, x, y, w, h, false, gofpdf.ImageOptions{ImageType: pdfImageType(content.Format)}, 0, "")
 }
 
-// NewImageCache creates a new image cache with initialized storage
-func NewImageCache() *ImageCache {
-	return &ImageCache{
-		cache: make(map[string][]byte),
+// pdfImageType maps a decoded image format to the gofpdf image type
+func pdfImageType(format string) string {
+	if format == "jpeg" {
+		return "JPG"
 	}
+	return strings.ToUpper(format)
 }
@@ -0,0 +1,235 @@
+package render
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/css"
+	"print-service/internal/core/engine/html"
+	"print-service/internal/core/engine/layout"
+)
+
+// testStylePattern matches the style elements of a test document
+var testStylePattern = regexp.MustCompile(`(?is)<style[^>]*>(.*?)</style>`)
+
+// layoutTestHTML lays out a document as the print service does, with its
+// style elements as the style sheet and its images loaded
+func layoutTestHTML(t *testing.T, content string, options domain.PrintOptions) *domain.LayoutNode {
+	t.Helper()
+	dom, err := html.NewParser(html.NewSanitizer(), html.NewValidator(false)).Parse(content, options.Security)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	layout.InsertTableOfContents(dom, options.Layout.TableOfContents)
+	var styles strings.Builder
+	for _, match := range testStylePattern.FindAllStringSubmatch(content, -1) {
+		styles.WriteString(match[1])
+	}
+	stylesheet, err := css.NewParser(false).Parse(styles.String())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	images := LoadImages(context.Background(), dom, stylesheet, options, 0)
+	layoutOptions := options.Layout
+	layoutOptions.ViewportWidth = int(ResolvePageGeometry(options.Page).ContentWidthPixels())
+	root, _, err := layout.NewEngine().CalculateLayout(dom, stylesheet, layoutOptions, images)
+	if err != nil {
+		t.Fatalf("CalculateLayout() error = %v", err)
+	}
+	return root
+}
+
+// renderTestPDF renders a document as a PDF with the options of the print
+// service and opts
+func renderTestPDF(t *testing.T, content string, options domain.PrintOptions, opts PDFRenderOptions) *RenderOutput {
+	t.Helper()
+	if opts.ColorProfile == "" {
+		opts.ColorProfile = ColorProfileRGB
+	}
+	output, err := NewPDFRenderer(opts).Render(layoutTestHTML(t, content, options), nil, options, domain.DocumentMetadata{})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	return output
+}
+
+// testPages reads a rendered PDF and returns its pages
+func testPages(t *testing.T, data []byte) (*pdfFile, []pdfPage) {
+	t.Helper()
+	file, err := readPDF(data)
+	if err != nil {
+		t.Fatalf("rendered PDF cannot be read: %v", err)
+	}
+	pages, err := file.Pages()
+	if err != nil {
+		t.Fatalf("rendered PDF has no pages: %v", err)
+	}
+	return file, pages
+}
+
+// testStream returns the decoded data of a stream object
+func testStream(t *testing.T, file *pdfFile, num int) string {
+	t.Helper()
+	body, err := file.Object(num)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dict, raw, err := splitStream(body)
+	if err != nil || dict == "" {
+		t.Fatalf("object %d is not a stream: %v", num, err)
+	}
+	data, err := decodePDFStream(dict, raw)
+	if err != nil {
+		t.Fatalf("stream %d cannot be decoded: %v", num, err)
+	}
+	return string(data)
+}
+
+// testPageContent returns the content stream of a page
+func testPageContent(t *testing.T, file *pdfFile, page pdfPage) string {
+	t.Helper()
+	num, ok := referenceTo(dictValue(page.dict, "/Contents"))
+	if !ok {
+		t.Fatalf("page %d has no content stream", page.num)
+	}
+	return testStream(t, file, num)
+}
+
+// textPattern matches the literal strings shown by a content stream
+var textPattern = regexp.MustCompile(`\(((?:[^()\\]|\\.)*)\) Tj`)
+
+// shownText returns the literal strings a content stream shows, in order
+func shownText(content string) []string {
+	var text []string
+	for _, match := range textPattern.FindAllStringSubmatch(content, -1) {
+		text = append(text, string(unescapePDFString(match[1])))
+	}
+	return text
+}
+
+func TestPDFRendererDrawsLayout(t *testing.T) {
+	output := renderTestPDF(t, `<style>h1 { color: #ff0000 }</style><h1>Quarterly report</h1><p>Revenue grew.</p>`,
+		domain.DefaultPrintOptions(), PDFRenderOptions{})
+	if output.PageCount != 1 || output.Extension != "pdf" {
+		t.Fatalf("Render() = %d pages of %s, want one PDF page", output.PageCount, output.Extension)
+	}
+
+	file, pages := testPages(t, output.Data)
+	content := testPageContent(t, file, pages[0])
+	if got := strings.Join(shownText(content), "|"); got != "Quarterly report|Revenue grew." {
+		t.Errorf("page text = %q, want the heading then the paragraph", got)
+	}
+	heading := strings.Index(content, "(Quarterly report)")
+	if red := strings.LastIndex(content[:heading], "1.000 0.000 0.000 rg"); red < 0 {
+		t.Error("heading is not drawn in its color")
+	}
+	for _, stale := range []string{"INVOICE", "Invoice"} {
+		if strings.Contains(content, stale) {
+			t.Errorf("page shows %q, which is not in the document", stale)
+		}
+	}
+}
+
+func TestPDFRendererPageSize(t *testing.T) {
+	tests := []struct {
+		size        domain.PageSize
+		orientation domain.Orientation
+		want        string
+	}{
+		{domain.A4, domain.OrientationPortrait, "[0 0 595.28 841.89]"},
+		{domain.A4, domain.OrientationLandscape, "[0 0 841.89 595.28]"},
+		{domain.A5, domain.OrientationPortrait, "[0 0 419.53 595.28]"},
+	}
+	for _, tt := range tests {
+		options := domain.DefaultPrintOptions()
+		options.Page.Size, options.Page.Orientation = tt.size, tt.orientation
+		_, pages := testPages(t, renderTestPDF(t, "<p>Page</p>", options, PDFRenderOptions{}).Data)
+		if got := dictValue(pages[0].dict, "/MediaBox"); got != tt.want {
+			t.Errorf("%s %s /MediaBox = %s, want %s", tt.size.Name, tt.orientation, got, tt.want)
+		}
+	}
+}
+
+func TestPDFRendererPages(t *testing.T) {
+	output := renderTestPDF(t, `<p style="break-after: page">One</p><p style="break-after: page">Two</p><p>Three</p>`,
+		domain.DefaultPrintOptions(), PDFRenderOptions{})
+	file, pages := testPages(t, output.Data)
+	if output.PageCount != 3 || len(pages) != 3 {
+		t.Fatalf("Render() = %d pages in a file of %d, want 3", output.PageCount, len(pages))
+	}
+	for i, want := range []string{"One", "Two", "Three"} {
+		if got := strings.Join(shownText(testPageContent(t, file, pages[i])), "|"); got != want {
+			t.Errorf("page %d text = %q, want %q", i+1, got, want)
+		}
+	}
+}
+
+func TestPDFRendererSplitsText(t *testing.T) {
+	words := make([]string, 1500)
+	for i := range words {
+		words[i] = "word"
+	}
+	output := renderTestPDF(t, "<p>"+strings.Join(words, " ")+"</p>", domain.DefaultPrintOptions(), PDFRenderOptions{})
+	file, pages := testPages(t, output.Data)
+	if len(pages) < 2 {
+		t.Fatalf("Render() = %d pages, want the paragraph to continue on a second page", len(pages))
+	}
+
+	// Every word is drawn once, on one page or the other
+	total := 0
+	for i, page := range pages {
+		text := shownText(testPageContent(t, file, page))
+		if len(text) == 0 {
+			t.Errorf("page %d is empty", i+1)
+		}
+		for _, line := range text {
+			total += len(strings.Fields(line))
+		}
+	}
+	if total != len(words) {
+		t.Errorf("%d words drawn, want %d", total, len(words))
+	}
+}
+
+func TestPDFRendererUnicode(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		embedded bool   // Whether a bundled face is embedded for the text
+		warning  string // Missing glyph warning, if any
+	}{
+		{"Windows-1252 in a core font", "Café – 5 €", false, ""},
+		{"Cyrillic and Greek from the bundled fonts", "Привет, κόσμε", true, ""},
+		{"characters no font has", "Price 漢字", false, "no available font has glyphs for 2 character(s): U+5B57, U+6F22"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := renderTestPDF(t, "<p>"+tt.text+"</p>", domain.DefaultPrintOptions(), PDFRenderOptions{EmbedFonts: true, Fonts: NewFontManager()})
+			pdf := string(output.Data)
+			if embedded := strings.Contains(pdf, "/FontFile2"); embedded != tt.embedded {
+				t.Errorf("font embedded = %v, want %v", embedded, tt.embedded)
+			}
+			if tt.embedded && !strings.Contains(pdf, "/ToUnicode") {
+				t.Error("embedded font has no /ToUnicode map, so its text cannot be extracted")
+			}
+			if got := strings.Join(output.Warnings, "|"); got != tt.warning {
+				t.Errorf("warnings = %q, want %q", got, tt.warning)
+			}
+
+			// Text the core fonts draw is encoded in Windows-1252
+			if !tt.embedded && tt.warning == "" {
+				file, pages := testPages(t, output.Data)
+				shown, err := charmap.Windows1252.NewDecoder().String(strings.Join(shownText(testPageContent(t, file, pages[0])), ""))
+				if err != nil || shown != tt.text {
+					t.Errorf("page text = %q, want %q", shown, tt.text)
+				}
+			}
+		})
+	}
+}
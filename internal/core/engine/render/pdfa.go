@@ -0,0 +1,210 @@
+package render
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"regexp"
+	"strconv"
+
+	"print-service/internal/core/domain"
+)
+
+// pdfaLevel describes a PDF/A conformance level
+type pdfaLevel struct {
+	Part        int    // ISO 19005 part
+	Conformance string // Conformance letter recorded in XMP
+	Version     string // PDF version the part is based on
+}
+
+// pdfaLevels lists the supported PDF/A conformance levels
+var pdfaLevels = map[domain.PDFAConformance]pdfaLevel{
+	domain.PDFA1B: {Part: 1, Conformance: "B", Version: "1.4"},
+	domain.PDFA2B: {Part: 2, Conformance: "B", Version: "1.7"},
+	domain.PDFA3B: {Part: 3, Conformance: "B", Version: "1.7"},
+}
+
+// AllowsTransparency reports whether the level permits transparent drawing
+func (l pdfaLevel) AllowsTransparency() bool {
+	return l.Part >= 2
+}
+
+// resolvePDFA looks up the requested conformance level. The second result is
+// false when no PDF/A output was requested.
+func resolvePDFA(conformance domain.PDFAConformance) (pdfaLevel, bool, error) {
+	if conformance == domain.PDFANone {
+		return pdfaLevel{}, false, nil
+	}
+	level, ok := pdfaLevels[conformance]
+	if !ok {
+		return pdfaLevel{}, false, domain.NewPrintError(domain.ErrCodeInvalidInput, "unsupported PDF/A conformance level", domain.ErrUnsupportedFormat).
+			WithDetail("pdfa", conformance)
+	}
+	return level, true, nil
+}
+
+// NewOutputIntent describes an ICC profile as a PDF/A output intent, taking
+// the condition identifier from the profile description
+func NewOutputIntent(profile []byte) (OutputIntent, error) {
+	switch iccColorSpace(profile) {
+	case iccSpaceRGB, iccSpaceCMYK, iccSpaceGray:
+	default:
+		return OutputIntent{}, fmt.Errorf("not an RGB, CMYK or gray ICC profile")
+	}
+
+	description := iccDescription(profile)
+	if description == "" {
+		description = "Custom"
+	}
+	return OutputIntent{
+		Type:       "GTS_PDFA1",
+		Identifier: description,
+		Info:       description,
+		Profile:    profile,
+	}, nil
+}
+
+// defaultOutputIntent is the sRGB output intent used when none is configured
+func defaultOutputIntent() OutputIntent {
+	return OutputIntent{
+		Type:         "GTS_PDFA1",
+		Identifier:   sRGBIdentifier,
+		Info:         sRGBIdentifier,
+		RegistryName: "http://www.color.org",
+		Profile:      sRGBProfile(),
+	}
+}
+
+// outputIntent returns the configured output intent, or the sRGB default
+func (r *PDFRenderer) outputIntent() OutputIntent {
+	if len(r.options.OutputIntent.Profile) == 0 {
+		return defaultOutputIntent()
+	}
+	return r.options.OutputIntent
+}
+
+// outputIntentSpaces maps output color spaces to the ICC profile space their
+// device colors are interpreted in. DeviceGray is allowed with any intent.
+var outputIntentSpaces = map[ColorProfile]string{
+	ColorProfileRGB:  iccSpaceRGB,
+	ColorProfileCMYK: iccSpaceCMYK,
+}
+
+// checkPDFA refuses features that cannot be written under a PDF/A level
+func (r *PDFRenderer) checkPDFA(level pdfaLevel, intent OutputIntent, profile ColorProfile, watermarkImage image.Image) error {
+	// Device colors need a destination profile of the same color space
+	space := iccColorSpace(intent.Profile)
+	if want, ok := outputIntentSpaces[profile]; ok && space != want {
+		return domain.NewPrintError(domain.ErrCodeInvalidInput,
+			fmt.Sprintf("PDF/A output intent does not match the %s output colors", profile), domain.ErrRenderFailed).
+			WithDetail("output_intent", intent.Identifier).
+			WithDetail("color_space", space)
+	}
+
+	// Images with an alpha channel are written with a soft mask
+	if watermarkImage != nil && !level.AllowsTransparency() && hasAlphaChannel(watermarkImage) {
+		return domain.NewPrintError(domain.ErrCodeInvalidInput,
+			fmt.Sprintf("PDF/A-%d does not allow transparent watermark images", level.Part), domain.ErrRenderFailed)
+	}
+
+	return nil
+}
+
+// hasAlphaChannel reports whether a decoded image carries an alpha channel
+func hasAlphaChannel(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.NRGBAModel, color.NRGBA64Model, color.AlphaModel, color.Alpha16Model:
+		return true
+	}
+	return false
+}
+
+// pdfaWarnings describes content that was adapted to conform to a level
+func pdfaWarnings(level pdfaLevel, watermark *domain.Watermark, missing map[rune]bool) []string {
+	var warnings []string
+	if watermark.Visible() && !level.AllowsTransparency() {
+		warnings = append(warnings, fmt.Sprintf("PDF/A-%d does not allow transparency: the watermark is drawn opaque beneath the content", level.Part))
+	}
+	if len(missing) > 0 {
+		warnings = append(warnings, "characters without a glyph are drawn with .notdef, which PDF/A does not allow")
+	}
+	return warnings
+}
+
+// cidToGIDMapPattern finds the CIDToGIDMap stream of a CIDFont dictionary
+var cidToGIDMapPattern = regexp.MustCompile(`/CIDToGIDMap (\d+) 0 R`)
+
+// fontDescriptorPattern finds the font descriptor of a font dictionary
+var fontDescriptorPattern = regexp.MustCompile(`/FontDescriptor (\d+) 0 R`)
+
+// writeArchival adds the PDF/A output intent and file identifier to a
+// rendered PDF and removes entries the level forbids
+func writeArchival(update *pdfUpdate, level pdfaLevel, intent OutputIntent, data []byte) error {
+	profile := update.AddCompressedStream(fmt.Sprintf("/N %d", iccComponents(intent.Profile)), intent.Profile)
+
+	entries := fmt.Sprintf("/Type /OutputIntent /S /%s /OutputConditionIdentifier %s /Info %s /DestOutputProfile %d 0 R",
+		intent.Type, pdfString(intent.Identifier), pdfString(intent.Info), profile)
+	if intent.Condition != "" {
+		entries += " /OutputCondition " + pdfString(intent.Condition)
+	}
+	if intent.RegistryName != "" {
+		entries += " /RegistryName " + pdfString(intent.RegistryName)
+	}
+
+	catalog := map[string]string{"/OutputIntents": fmt.Sprintf("[<<%s>>]", entries)}
+	if level.Part == 1 {
+		// PDF/A-1 forbids embedded files, even an empty list of them
+		catalog["/Names"] = "<<>>"
+		if err := addCIDSets(update); err != nil {
+			return err
+		}
+	}
+	if err := update.SetEntries(update.Root(), catalog); err != nil {
+		return err
+	}
+
+	// The identifier starts out as a digest of the content
+	id := md5.Sum(data)
+	update.SetFileID(id[:])
+	return nil
+}
+
+// addCIDSets gives every embedded CIDFont subset the CIDSet stream PDF/A-1
+// requires, listing the CIDs its CIDToGIDMap maps to a glyph
+func addCIDSets(update *pdfUpdate) error {
+	for num := 1; num < update.size; num++ {
+		body, err := update.Object(num)
+		if err != nil || dictValue(body, "/Subtype") != "/CIDFontType2" {
+			continue
+		}
+		mapRef := cidToGIDMapPattern.FindStringSubmatch(body)
+		descriptorRef := fontDescriptorPattern.FindStringSubmatch(body)
+		if mapRef == nil || descriptorRef == nil {
+			continue
+		}
+
+		mapNum, _ := strconv.Atoi(mapRef[1])
+		gids, err := update.Stream(mapNum)
+		if err != nil {
+			return fmt.Errorf("failed to read CIDToGIDMap: %w", err)
+		}
+
+		// One bit per CID, most significant bit first; CID 0 is always present
+		set := make([]byte, (len(gids)/2+7)/8+1)
+		set[0] |= 0x80
+		for cid := 0; cid*2+1 < len(gids); cid++ {
+			if binary.BigEndian.Uint16(gids[cid*2:]) != 0 {
+				set[cid/8] |= 0x80 >> (cid % 8)
+			}
+		}
+
+		descriptor, _ := strconv.Atoi(descriptorRef[1])
+		cidSet := update.AddCompressedStream("", set)
+		if err := update.SetEntries(descriptor, map[string]string{"/CIDSet": fmt.Sprintf("%d 0 R", cidSet)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
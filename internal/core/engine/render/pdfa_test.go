@@ -0,0 +1,111 @@
+package render
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+func TestResolvePDFA(t *testing.T) {
+	tests := []struct {
+		conformance domain.PDFAConformance
+		part        int
+		archival    bool
+		wantErr     bool
+	}{
+		{domain.PDFANone, 0, false, false},
+		{domain.PDFA1B, 1, true, false},
+		{domain.PDFA2B, 2, true, false},
+		{domain.PDFA3B, 3, true, false},
+		{"pdfa-4", 0, false, true},
+	}
+	for _, tt := range tests {
+		level, archival, err := resolvePDFA(tt.conformance)
+		if (err != nil) != tt.wantErr || archival != tt.archival || level.Part != tt.part {
+			t.Errorf("resolvePDFA(%q) = part %d, %v, %v; want part %d, %v, error %v",
+				tt.conformance, level.Part, archival, err, tt.part, tt.archival, tt.wantErr)
+		}
+	}
+}
+
+// archivalOptions returns print options for PDF/A output at a level
+func archivalOptions(conformance domain.PDFAConformance) domain.PrintOptions {
+	options := domain.DefaultPrintOptions()
+	options.Render.PDFA = conformance
+	return options
+}
+
+func TestPDFRendererPDFA(t *testing.T) {
+	tests := []struct {
+		conformance domain.PDFAConformance
+		version     string
+		part        string
+	}{
+		{domain.PDFA1B, "%PDF-1.4", "<pdfaid:part>1</pdfaid:part>"},
+		{domain.PDFA2B, "%PDF-1.7", "<pdfaid:part>2</pdfaid:part>"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.conformance), func(t *testing.T) {
+			output := renderTestPDF(t, "<p>Archived</p>", archivalOptions(tt.conformance),
+				PDFRenderOptions{EmbedFonts: true, Fonts: NewFontManager()})
+			pdf := string(output.Data)
+			if !strings.HasPrefix(pdf, tt.version) {
+				t.Errorf("PDF starts with %q, want %s", pdf[:8], tt.version)
+			}
+			for _, want := range []string{
+				"/OutputIntents [<</Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB",
+				"/ID [<", tt.part, "<pdfaid:conformance>B</pdfaid:conformance>",
+			} {
+				if !strings.Contains(pdf, want) {
+					t.Errorf("PDF has no %s", want)
+				}
+			}
+			if len(output.Warnings) != 0 {
+				t.Errorf("warnings = %q, want none", output.Warnings)
+			}
+		})
+	}
+}
+
+func TestPDFRendererPDFARefuses(t *testing.T) {
+	cmyk := archivalOptions(domain.PDFA2B)
+	cmyk.Render.ColorProfile = domain.ColorProfileCMYK
+	encrypted := archivalOptions(domain.PDFA2B)
+	encrypted.Output.Encryption = &domain.Encryption{UserPassword: "secret"}
+	tests := []struct {
+		name    string
+		options domain.PrintOptions
+		want    error
+	}{
+		{"unsupported level", archivalOptions("pdfa-4"), domain.ErrUnsupportedFormat},
+		{"encryption", encrypted, domain.ErrUnsupportedFormat},
+		{"CMYK colors with an sRGB intent", cmyk, domain.ErrRenderFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPDFRenderer(PDFRenderOptions{ColorProfile: ColorProfileRGB}).Render(layoutTestHTML(t, "<p>Archived</p>", tt.options), nil, tt.options, domain.DocumentMetadata{})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Render() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPDFRendererPDFAWatermark(t *testing.T) {
+	options := archivalOptions(domain.PDFA1B)
+	options.Output.Watermark = &domain.Watermark{Text: "COPY"}
+	output := renderTestPDF(t, "<p>Archived</p>", options, PDFRenderOptions{})
+	want := "PDF/A-1 does not allow transparency: the watermark is drawn opaque beneath the content"
+	if strings.Join(output.Warnings, "|") != want {
+		t.Errorf("warnings = %q, want %q", output.Warnings, want)
+	}
+
+	// The opaque watermark is drawn first so the content covers it. PDF/A
+	// embeds every font, so text is shown as two-byte codes.
+	file, pages := testPages(t, output.Data)
+	if text := shownText(testPageContent(t, file, pages[0])); len(text) != 2 || strings.ReplaceAll(text[0], "\x00", "") != "COPY" {
+		t.Errorf("page text = %q, want the watermark beneath the content", text)
+	}
+}
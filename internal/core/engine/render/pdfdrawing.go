@@ -0,0 +1,308 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/layout"
+	"print-service/internal/core/engine/svg"
+)
+
+// drawingTextSize is the font size in points text of artwork is set in
+// before it is scaled to its size in user units, large enough that the
+// two decimals gofpdf writes keep glyphs accurate
+const drawingTextSize = 100
+
+// pageMatrix maps layout coordinates in CSS pixels to the default PDF
+// coordinates of the page, in points from its bottom-left corner
+func (ctx RenderContext) pageMatrix() domain.Matrix {
+	k := ctx.PDF.GetConversionRatio()
+	_, pageHeight := ctx.PDF.GetPageSize()
+	s := ctx.Length(1) * k
+	return domain.Matrix{s, 0, 0, -s, ctx.OriginX * k, (pageHeight - ctx.OriginY) * k}
+}
+
+// renderDrawing draws the artwork of an svg element or SVG image as vector
+// paths and text inside its content box
+func (r *PDFRenderer) renderDrawing(node *domain.LayoutNode, ctx RenderContext) {
+	drawing := drawingOf(node)
+	box := layout.ContentBox(node)
+	if drawing == nil || box.Width <= 0 || box.Height <= 0 {
+		return
+	}
+
+	ctx.Tags.BeginText(node, ctx)
+	defer ctx.Tags.End(ctx.PDF)
+	r.drawArtwork(drawing, box, box, ctx)
+}
+
+// renderBackgroundDrawing draws the copies of an element's SVG background
+// image that fall inside its padding box
+func (r *PDFRenderer) renderBackgroundDrawing(elem *domain.LayoutNode, ctx RenderContext) {
+	placement, ok := resolveBackground(elem.Style.Background, layout.PaddingBox(elem))
+	if !ok || elem.Style.Background.Loaded.Drawing == nil {
+		return
+	}
+	for _, tile := range placement.Tiles() {
+		clip := intersectBoxes(tile, placement.Area)
+		if clip.Width > 0 && clip.Height > 0 {
+			r.drawArtwork(elem.Style.Background.Loaded.Drawing, tile, clip, ctx)
+		}
+	}
+}
+
+// drawArtwork draws artwork fitted into a box, cut to the clip box
+func (r *PDFRenderer) drawArtwork(drawing *domain.Drawing, box, clip domain.Box, ctx RenderContext) {
+	x, y, w, h := ctx.ToPage(clip)
+	ctx.PDF.ClipRect(x, y, w, h, false)
+
+	page := ctx.pageMatrix().Multiply(svg.Fit(drawing, box))
+	text := false
+	for _, shape := range drawing.Shapes {
+		m := page.Multiply(shape.Transform)
+		if shape.Text != nil {
+			r.drawShapeText(shape, m, ctx)
+			text = true
+		} else {
+			drawShapePath(shape, m, ctx)
+		}
+	}
+	ctx.PDF.ClipEnd()
+
+	// Restoring the graphics state dropped the font gofpdf believes is selected
+	if text {
+		size, _ := ctx.PDF.GetFontSize()
+		ctx.PDF.SetFontSize(size)
+	}
+}
+
+// drawShapePath fills, then strokes, the path of a shape transformed by m
+// into page coordinates
+func drawShapePath(shape domain.Shape, m domain.Matrix, ctx RenderContext) {
+	var path strings.Builder
+	for _, segment := range shape.Path {
+		switch segment.Op {
+		case 'M', 'L':
+			p := segment.Points[0]
+			fmt.Fprintf(&path, "%s %s %c ", drawingNumber(p.X), drawingNumber(p.Y), segment.Op+'a'-'A')
+		case 'C':
+			for _, p := range segment.Points {
+				fmt.Fprintf(&path, "%s %s ", drawingNumber(p.X), drawingNumber(p.Y))
+			}
+			path.WriteString("c ")
+		case 'Z':
+			path.WriteString("h ")
+		}
+	}
+
+	if paint, ok := pdfPaint(shape.Fill, shape.FillOpacity, m, false, ctx); ok {
+		operator := "f"
+		if shape.FillRule == "evenodd" {
+			operator = "f*"
+		}
+		ctx.PDF.RawWriteStr("q " + drawingMatrix(m) + " cm")
+		setDrawingAlpha(paint.alpha, ctx)
+		ctx.PDF.RawWriteStr(paint.operator)
+		ctx.PDF.RawWriteStr(path.String() + operator + " Q")
+	}
+
+	if shape.StrokeWidth <= 0 {
+		return
+	}
+	if paint, ok := pdfPaint(shape.Stroke, shape.StrokeOpacity, m, true, ctx); ok {
+		ctx.PDF.RawWriteStr("q " + drawingMatrix(m) + " cm")
+		setDrawingAlpha(paint.alpha, ctx)
+		ctx.PDF.RawWriteStr(paint.operator)
+		ctx.PDF.RawWriteStr(pdfStrokeStyle(shape))
+		ctx.PDF.RawWriteStr(path.String() + "S Q")
+	}
+}
+
+// pdfStrokeStyle returns the operators that set the line width, caps, joins
+// and dashes of a shape
+func pdfStrokeStyle(shape domain.Shape) string {
+	caps := map[string]int{"butt": 0, "round": 1, "square": 2}
+	joins := map[string]int{"miter": 0, "round": 1, "bevel": 2}
+	style := fmt.Sprintf("%s w %d J %d j %s M", drawingNumber(shape.StrokeWidth),
+		caps[shape.LineCap], joins[shape.LineJoin], drawingNumber(math.Max(1, shape.MiterLimit)))
+
+	dashes := make([]string, len(shape.Dash))
+	for i, dash := range shape.Dash {
+		dashes[i] = drawingNumber(dash)
+	}
+	return style + fmt.Sprintf(" [%s] %s d", strings.Join(dashes, " "), drawingNumber(shape.DashOffset))
+}
+
+// drawShapeText draws the text of a shape transformed by m into page
+// coordinates, filled with its paint. Text is not stroked.
+func (r *PDFRenderer) drawShapeText(shape domain.Shape, m domain.Matrix, ctx RenderContext) {
+	text := shape.Text
+	paint, ok := pdfPaint(shape.Fill, shape.FillOpacity, m, false, ctx)
+	if !ok || text.Font.Size <= 0 {
+		return
+	}
+
+	chain := r.fontChain(text.Font, ctx)
+	runs := r.shapeLine(text.Content, r.textEngine.DetectDirection(text.Content), chain, ctx)
+	width := r.runsWidth(runs, drawingTextSize, ctx)
+	x := 0.0
+	switch text.Anchor {
+	case "middle":
+		x = -width / 2
+	case "end":
+		x = -width
+	}
+
+	// gofpdf places text in mm from the top of the page; the matrix maps
+	// that space onto the baseline, scaled to the font size in user units
+	k := ctx.PDF.GetConversionRatio()
+	_, pageHeight := ctx.PDF.GetPageSize()
+	unit := text.Font.Size * k / drawingTextSize
+	toText := domain.Matrix{1, 0, 0, 1, text.X, text.Y}.
+		Multiply(domain.Matrix{unit, 0, 0, unit, 0, 0}).
+		Multiply(domain.Matrix{1 / k, 0, 0, -1 / k, 0, pageHeight})
+
+	ctx.PDF.RawWriteStr("q " + drawingMatrix(m.Multiply(toText)) + " cm")
+	setDrawingAlpha(paint.alpha, ctx)
+	ctx.PDF.RawWriteStr(paint.operator)
+	r.drawRuns(runs, x, 0, drawingTextSize, ctx)
+	ctx.PDF.RawWriteStr("Q")
+}
+
+// pdfDrawingPaint is how a fill or stroke of artwork is selected
+type pdfDrawingPaint struct {
+	operator string  // Color or pattern operators
+	alpha    float64 // Constant opacity
+}
+
+// pdfPaint resolves the paint of a shape whose user space m maps to the
+// page; ok is false when nothing would be painted
+func pdfPaint(paint domain.Paint, opacity float64, m domain.Matrix, stroke bool, ctx RenderContext) (pdfDrawingPaint, bool) {
+	switch {
+	case paint.Color != nil:
+		opacity *= float64(paint.Color.A) / 255
+		if opacity <= 0 {
+			return pdfDrawingPaint{}, false
+		}
+		return pdfDrawingPaint{operator: ctx.Colors.operator(*paint.Color, stroke), alpha: opacity}, true
+	case paint.Gradient != nil && opacity > 0:
+		name := ctx.Patterns.Add(paint.Gradient, m.Multiply(paint.Gradient.Transform))
+		operator := "/Pattern cs /" + name + " scn"
+		if stroke {
+			operator = "/Pattern CS /" + name + " SCN"
+		}
+		return pdfDrawingPaint{operator: operator, alpha: opacity}, true
+	}
+	return pdfDrawingPaint{}, false
+}
+
+// setDrawingAlpha sets the opacity of the paint about to be used, unless
+// the output does not allow transparency
+func setDrawingAlpha(alpha float64, ctx RenderContext) {
+	if alpha < 1 && !ctx.Opaque {
+		ctx.PDF.SetAlpha(math.Max(0, alpha), "Normal")
+	}
+}
+
+// pdfPatternSet holds the gradients of artwork as shading patterns. gofpdf
+// cannot write patterns, so they are added to the resources afterwards.
+type pdfPatternSet struct {
+	colors   *colorConverter
+	bodies   []string       // Pattern dictionaries in order of their names
+	patterns map[string]int // Index of each pattern by its dictionary
+}
+
+// newPDFPatternSet creates an empty pattern set in the output color space
+func newPDFPatternSet(colors *colorConverter) *pdfPatternSet {
+	return &pdfPatternSet{colors: colors, patterns: make(map[string]int)}
+}
+
+// Add records a gradient whose space m maps to the default coordinates of
+// the page and returns its resource name. Stop opacities are not kept.
+func (s *pdfPatternSet) Add(g *domain.Gradient, m domain.Matrix) string {
+	var shading string
+	if g.Radial {
+		// The focal point must lie inside the end circle
+		fx, fy := g.FX, g.FY
+		if d := math.Hypot(fx-g.CX, fy-g.CY); d > g.R*0.99 {
+			fx = g.CX + (fx-g.CX)*g.R*0.99/d
+			fy = g.CY + (fy-g.CY)*g.R*0.99/d
+		}
+		shading = fmt.Sprintf("/ShadingType 3 /Coords [%s %s 0 %s %s %s]", drawingNumber(fx), drawingNumber(fy),
+			drawingNumber(g.CX), drawingNumber(g.CY), drawingNumber(g.R))
+	} else {
+		shading = fmt.Sprintf("/ShadingType 2 /Coords [%s %s %s %s]", drawingNumber(g.X1), drawingNumber(g.Y1),
+			drawingNumber(g.X2), drawingNumber(g.Y2))
+	}
+	body := fmt.Sprintf("<< /Type /Pattern /PatternType 2 /Shading << %s /ColorSpace %s /Function %s /Extend [true true] >> /Matrix [%s] >>",
+		shading, s.colors.deviceSpace(), s.function(g.Stops), drawingMatrix(m))
+
+	index, ok := s.patterns[body]
+	if !ok {
+		index = len(s.bodies)
+		s.patterns[body] = index
+		s.bodies = append(s.bodies, body)
+	}
+	return fmt.Sprintf("Pat%d", index+1)
+}
+
+// function returns a PDF function interpolating the colors of gradient
+// stops over 0 to 1, stitching one exponential function per pair of stops
+func (s *pdfPatternSet) function(stops []domain.GradientStop) string {
+	if stops[0].Offset > 0 {
+		stops = append([]domain.GradientStop{{Color: stops[0].Color}}, stops...)
+	}
+	if last := stops[len(stops)-1]; last.Offset < 1 {
+		stops = append(stops, domain.GradientStop{Offset: 1, Color: last.Color})
+	}
+
+	var functions, bounds, encode []string
+	for i := 1; i < len(stops); i++ {
+		if stops[i].Offset <= stops[i-1].Offset {
+			continue
+		}
+		functions = append(functions, fmt.Sprintf("<< /FunctionType 2 /Domain [0 1] /C0 [%s] /C1 [%s] /N 1 >>",
+			s.color(stops[i-1].Color), s.color(stops[i].Color)))
+		bounds = append(bounds, drawingNumber(stops[i].Offset))
+		encode = append(encode, "0 1")
+	}
+	if len(functions) == 1 {
+		return functions[0]
+	}
+	return fmt.Sprintf("<< /FunctionType 3 /Domain [0 1] /Functions [%s] /Bounds [%s] /Encode [%s] >>",
+		strings.Join(functions, " "), strings.Join(bounds[:len(bounds)-1], " "), strings.Join(encode, " "))
+}
+
+// color formats the components of a stop color in the output color space
+func (s *pdfPatternSet) color(c domain.Color) string {
+	values := s.colors.convert(c.R, c.G, c.B)
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.FormatFloat(math.Max(0, math.Min(1, v)), 'f', 3, 64)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Write adds the patterns to a rendered PDF and to the resources of its pages
+func (s *pdfPatternSet) Write(update *pdfUpdate) error {
+	if s == nil || len(s.bodies) == 0 {
+		return nil
+	}
+
+	resources, body, err := sharedResources(update)
+	if err != nil || resources == 0 {
+		return err
+	}
+
+	entries := strings.TrimSuffix(strings.TrimSpace(dictValue(body, "/Pattern")), ">>")
+	if entries == "" {
+		entries = "<<"
+	}
+	for i, pattern := range s.bodies {
+		entries += fmt.Sprintf(" /Pat%d %d 0 R", i+1, update.Add(pattern))
+	}
+	return update.SetEntries(resources, map[string]string{"/Pattern": entries + ">>"})
+}
@@ -0,0 +1,30 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+func TestPDFRendererDrawsSVG(t *testing.T) {
+	output := renderTestPDF(t, `<svg width="100" height="50" viewBox="0 0 10 5"><title>Bar</title>`+
+		`<rect width="10" height="5" fill="#ff0000"/><path d="M0 0 C 5 5 5 5 10 0" stroke="#0000ff" fill="none"/></svg>`,
+		domain.DefaultPrintOptions(), PDFRenderOptions{})
+	if strings.Contains(string(output.Data), "/Subtype /Image") {
+		t.Error("artwork is embedded as an image, want vector paths")
+	}
+
+	file, pages := testPages(t, output.Data)
+	content := testPageContent(t, file, pages[0])
+	for _, want := range []string{
+		"56.69 785.20 75.00 -37.50 re W n",      // Clipped to the 100x50px box
+		"q 7.5 0 0 -7.5 56.692913 785.19685 cm", // View box scaled into it
+		"1.000 0.000 0.000 rg\n0 0 m 10 0 l 10 5 l 0 5 l h f Q",
+		"0.000 0.000 1.000 RG\n1 w 0 J 0 j 4 M [] 0 d\n0 0 m 5 5 5 5 10 0 c S Q",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("page does not draw %q:\n%s", want, content)
+		}
+	}
+}
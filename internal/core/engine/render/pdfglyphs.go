@@ -0,0 +1,286 @@
+package render
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// pdfGlyphFonts holds the faces whose shaped text is drawn by glyph. gofpdf
+// only addresses glyphs by character, which cannot reach the ligatures and
+// contextual forms of shaped text, so these faces are written afterwards as
+// CID-keyed fonts indexed by glyph ID.
+type pdfGlyphFonts struct {
+	fonts []*pdfGlyphFont
+	index map[string]int // Position of each face by ID
+}
+
+// pdfGlyphFont is a face drawn by glyph ID and the glyphs used from it
+type pdfGlyphFont struct {
+	info FontInfo
+	font *otFont
+	text map[uint16]string // Characters each used glyph stood for when first drawn
+}
+
+// newPDFGlyphFonts creates an empty set of glyph fonts
+func newPDFGlyphFonts() *pdfGlyphFonts {
+	return &pdfGlyphFonts{index: make(map[string]int)}
+}
+
+// Use records the glyphs of a shaped run and returns the resource name of its face
+func (s *pdfGlyphFonts) Use(info FontInfo, font *otFont, run *shapedRun) string {
+	i, ok := s.index[info.ID]
+	if !ok {
+		i = len(s.fonts)
+		s.index[info.ID] = i
+		s.fonts = append(s.fonts, &pdfGlyphFont{info: info, font: font, text: make(map[uint16]string)})
+	}
+	used := s.fonts[i].text
+	for _, g := range run.glyphs {
+		if _, ok := used[g.id]; !ok {
+			used[g.id] = g.text
+		}
+	}
+	return fmt.Sprintf("GF%d", i+1)
+}
+
+// Write adds the glyph fonts to a rendered PDF and to the resources of its pages
+func (s *pdfGlyphFonts) Write(update *pdfUpdate) error {
+	if s == nil || len(s.fonts) == 0 {
+		return nil
+	}
+
+	resources, body, err := sharedResources(update)
+	if err != nil || resources == 0 {
+		return err
+	}
+
+	entries := strings.TrimSuffix(strings.TrimSpace(dictValue(body, "/Font")), ">>")
+	if entries == "" {
+		entries = "<<"
+	}
+	for i, f := range s.fonts {
+		num, err := f.write(update)
+		if err != nil {
+			return fmt.Errorf("failed to embed font %s: %w", f.info.ID, err)
+		}
+		entries += fmt.Sprintf(" /GF%d %d 0 R", i+1, num)
+	}
+	return update.SetEntries(resources, map[string]string{"/Font": entries + ">>"})
+}
+
+// write adds a Type0 font with the used glyphs of the face and returns its object number
+func (f *pdfGlyphFont) write(update *pdfUpdate) (int, error) {
+	glyphs := make([]uint16, 0, len(f.text)+1)
+	used := map[uint16]bool{0: true}
+	glyphs = append(glyphs, 0)
+	for id := range f.text {
+		if !used[id] {
+			used[id] = true
+			glyphs = append(glyphs, id)
+		}
+	}
+	sort.Slice(glyphs, func(i, j int) bool { return glyphs[i] < glyphs[j] })
+
+	subset, err := subsetFont(f.info.Data, used)
+	if err != nil {
+		return 0, err
+	}
+	tables := fontTables(f.info.Data)
+	name := pdfName(subsetTag(glyphs) + "+" + strings.NewReplacer(" ", "", "/", "").Replace(f.info.ID))
+
+	// Metrics are given in thousandths of the em
+	upem := float64(f.font.unitsPerEm)
+	scaled := func(v int) string { return strconv.FormatFloat(float64(v)*1000/upem, 'f', -1, 64) }
+	head, hhea, os2, post := tables["head"], tables["hhea"], tables["OS/2"], tables["post"]
+	capHeight := hhea.i16(4)
+	if os2.u16(0) >= 2 {
+		capHeight = os2.i16(88)
+	}
+	italicAngle := float64(int32(post.u32(4))) / 65536
+	flags := 4 // Symbolic
+	if f.info.Italic {
+		flags |= 64
+	}
+
+	fontFile := update.AddCompressedStream(fmt.Sprintf("/Length1 %d", len(subset)), subset)
+	cidSet := update.AddCompressedStream("", cidSetBits(glyphs))
+	descriptor := update.Add(fmt.Sprintf("<< /Type /FontDescriptor /FontName %s /Flags %d /FontBBox [%s %s %s %s] /ItalicAngle %s /Ascent %s /Descent %s /CapHeight %s /StemV 80 /FontFile2 %d 0 R /CIDSet %d 0 R >>",
+		name, flags, scaled(head.i16(36)), scaled(head.i16(38)), scaled(head.i16(40)), scaled(head.i16(42)),
+		strconv.FormatFloat(italicAngle, 'f', -1, 64), scaled(hhea.i16(4)), scaled(hhea.i16(6)), scaled(capHeight), fontFile, cidSet))
+
+	widths := make([]string, len(glyphs))
+	for i, id := range glyphs {
+		widths[i] = fmt.Sprintf("%d [%s]", id, scaled(f.font.advance(id)))
+	}
+	cidFont := update.Add(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont %s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /CIDToGIDMap /Identity /DW 0 /W [%s] >>",
+		name, descriptor, strings.Join(widths, " ")))
+
+	toUnicode := update.AddCompressedStream("", f.toUnicode(glyphs))
+	return update.Add(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont %s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		name, cidFont, toUnicode)), nil
+}
+
+// toUnicode writes a CMap mapping glyphs to the characters they stand for.
+// A glyph the face maps a character of its cluster to stands for that
+// character alone; ligatures and contextual forms stand for their cluster.
+func (f *pdfGlyphFont) toUnicode(glyphs []uint16) []byte {
+	nominal := make(map[uint16][]rune)
+	for r, id := range f.font.cmap {
+		nominal[id] = append(nominal[id], r)
+	}
+
+	var mappings []string
+	for _, id := range glyphs {
+		text := f.text[id]
+		for _, r := range nominal[id] {
+			if strings.ContainsRune(text, r) {
+				text = string(r)
+				break
+			}
+		}
+		if id == 0 || text == "" {
+			continue
+		}
+		var hex strings.Builder
+		for _, unit := range utf16.Encode([]rune(text)) {
+			fmt.Fprintf(&hex, "%04X", unit)
+		}
+		mappings = append(mappings, fmt.Sprintf("<%04X> <%s>", id, hex.String()))
+	}
+
+	var buf strings.Builder
+	buf.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for start := 0; start < len(mappings); start += 100 {
+		chunk := mappings[start:min(start+100, len(mappings))]
+		fmt.Fprintf(&buf, "%d beginbfchar\n%s\nendbfchar\n", len(chunk), strings.Join(chunk, "\n"))
+	}
+	buf.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return []byte(buf.String())
+}
+
+// subsetTag derives the six-letter tag of a font subset from its glyphs
+func subsetTag(glyphs []uint16) string {
+	h := fnv.New32a()
+	_ = binary.Write(h, binary.BigEndian, glyphs)
+	sum := h.Sum32()
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = byte('A' + sum%26)
+		sum /= 26
+	}
+	return string(tag)
+}
+
+// cidSetBits lists the CIDs of a subset, one bit per CID with the most
+// significant bit first
+func cidSetBits(glyphs []uint16) []byte {
+	set := make([]byte, int(glyphs[len(glyphs)-1])/8+1)
+	for _, id := range glyphs {
+		set[id/8] |= 0x80 >> (id % 8)
+	}
+	return set
+}
+
+// subsetFont empties the outlines of the glyphs of a TrueType file that are
+// not used, keeping glyph IDs so text can address glyphs directly. The
+// components of kept composite glyphs are kept too.
+func subsetFont(data []byte, used map[uint16]bool) ([]byte, error) {
+	tables := fontTables(data)
+	head, glyf, loca := tables["head"], tables["glyf"], tables["loca"]
+	numGlyphs := tables["maxp"].u16(4)
+	if len(head) < 54 || glyf == nil || loca == nil || numGlyphs == 0 {
+		return nil, fmt.Errorf("font has no TrueType outlines")
+	}
+
+	long := head.i16(50) == 1
+	outline := func(id int) []byte {
+		var start, end int
+		if long {
+			start, end = loca.u32(4*id), loca.u32(4*id+4)
+		} else {
+			start, end = 2*loca.u16(2*id), 2*loca.u16(2*id+2)
+		}
+		if start >= end || end > len(glyf) {
+			return nil
+		}
+		return glyf[start:end]
+	}
+
+	// Follow the components of composite glyphs
+	keep := make(map[int]bool)
+	pending := make([]int, 0, len(used))
+	for id := range used {
+		pending = append(pending, int(id))
+	}
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if id >= numGlyphs || keep[id] {
+			continue
+		}
+		keep[id] = true
+		glyph := otData(outline(id))
+		if glyph.i16(0) >= 0 {
+			continue
+		}
+		for off := 10; off+4 <= len(glyph); {
+			flags := glyph.u16(off)
+			pending = append(pending, glyph.u16(off+2))
+			off += 4
+			switch {
+			case flags&0x0001 != 0: // Word arguments
+				off += 4
+			default:
+				off += 2
+			}
+			switch {
+			case flags&0x0008 != 0: // Single scale
+				off += 2
+			case flags&0x0040 != 0: // X and Y scales
+				off += 4
+			case flags&0x0080 != 0: // Two by two matrix
+				off += 8
+			}
+			if flags&0x0020 == 0 { // No more components
+				break
+			}
+		}
+	}
+
+	var newGlyf []byte
+	newLoca := make([]byte, 4*(numGlyphs+1))
+	for id := 0; id < numGlyphs; id++ {
+		binary.BigEndian.PutUint32(newLoca[4*id:], uint32(len(newGlyf)))
+		if keep[id] {
+			newGlyf = append(newGlyf, outline(id)...)
+			for len(newGlyf)%4 != 0 {
+				newGlyf = append(newGlyf, 0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(newLoca[4*numGlyphs:], uint32(len(newGlyf)))
+
+	newHead := append([]byte(nil), head...)
+	binary.BigEndian.PutUint16(newHead[50:], 1) // Long offsets
+
+	// Glyph names are not needed to draw by glyph ID
+	post := make([]byte, 32)
+	copy(post, tables["post"])
+	binary.BigEndian.PutUint32(post, 0x00030000)
+
+	subset := map[string][]byte{"glyf": newGlyf, "loca": newLoca, "head": newHead, "post": post}
+	for _, tag := range fontFileTables {
+		if _, ok := subset[tag]; !ok && tables[tag] != nil {
+			subset[tag] = tables[tag]
+		}
+	}
+	return assembleFont(subset), nil
+}
@@ -0,0 +1,268 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/layout"
+
+	"github.com/jung-kurt/gofpdf"
+	"golang.org/x/image/draw"
+)
+
+// pdfImageIDPrefix starts the names images are registered under
+const pdfImageIDPrefix = "img-"
+
+// pdfPicture is an image of the document as it is embedded
+type pdfPicture struct {
+	id      string        // Name the image is registered under
+	content *ImageContent // Encoded image as embedded
+	decoded image.Image   // Pixels as embedded
+	width   float64       // Largest drawn width in inches
+	height  float64       // Largest drawn height in inches
+}
+
+// pdfPictures embeds the images of a document, each once however often it
+// is drawn
+type pdfPictures struct {
+	pictures    map[string]*pdfPicture // Pictures by image key
+	order       []*pdfPicture          // Pictures in document order
+	downsampled int                    // Images reduced to the target resolution
+	flattened   int                    // Transparent images drawn on white
+}
+
+// pdfPictureOptions controls how images are embedded
+type pdfPictureOptions struct {
+	Optimize  bool    // Downsample and recompress images
+	TargetDPI float64 // Resolution optimized images are reduced to
+	Quality   int     // JPEG quality of recompressed images
+	Opaque    bool    // Transparency is not allowed
+}
+
+// newPDFPictures collects the images of layout trees with the largest size
+// each is drawn at, so it can be embedded once at the resolution it needs
+func newPDFPictures(scale float64, roots ...*domain.LayoutNode) *pdfPictures {
+	p := &pdfPictures{pictures: make(map[string]*pdfPicture)}
+	for _, root := range roots {
+		if root != nil {
+			p.collect(root, scale)
+		}
+	}
+	return p
+}
+
+// collect records the raster images and background images at a node and
+// below it; SVG images are drawn as vectors instead
+func (p *pdfPictures) collect(node *domain.LayoutNode, scale float64) {
+	if node.Image != nil && node.Image.Decoded != nil {
+		p.add(node.Image, layout.ContentBox(node), scale)
+	}
+	if placement, ok := resolveBackground(node.Style.Background, layout.PaddingBox(node)); ok && node.Style.Background.Loaded.Decoded != nil {
+		p.add(node.Style.Background.Loaded, placement.Tile, scale)
+	}
+	for _, child := range node.Children {
+		p.collect(child, scale)
+	}
+}
+
+// add records an image drawn in a box given in CSS pixels
+func (p *pdfPictures) add(img *domain.Image, box domain.Box, scale float64) {
+	picture, ok := p.pictures[img.Key]
+	if !ok {
+		picture = &pdfPicture{
+			id:      pdfImageIDPrefix + img.Key[:16],
+			content: &ImageContent{Data: img.Data, Format: img.Format, Width: img.Width, Height: img.Height},
+			decoded: img.Decoded,
+		}
+		p.pictures[img.Key] = picture
+		p.order = append(p.order, picture)
+	}
+	picture.width = max(picture.width, box.Width*scale/pixelsPerInch)
+	picture.height = max(picture.height, box.Height*scale/pixelsPerInch)
+}
+
+// Register prepares every image and adds it to the document
+func (p *pdfPictures) Register(pdf *gofpdf.Fpdf, images *pdfImageSet, opts pdfPictureOptions) error {
+	for _, picture := range p.order {
+		if err := p.prepare(picture, opts); err != nil {
+			return fmt.Errorf("failed to prepare image: %w", err)
+		}
+		registerImage(pdf, images, picture.id, picture.content, picture.decoded)
+	}
+	return pdf.Error()
+}
+
+// prepare converts an image to an encoding gofpdf embeds, drawing transparent
+// images on white when transparency is not allowed and reducing images
+// finer than the target resolution when optimizing
+func (p *pdfPictures) prepare(picture *pdfPicture, opts pdfPictureOptions) error {
+	img := picture.decoded
+	reencode := !pdfEmbeddable(picture.content)
+
+	if opts.Opaque && isTransparent(img) {
+		img = flattenImage(img)
+		reencode = true
+		p.flattened++
+	}
+
+	if opts.Optimize && opts.TargetDPI > 0 && picture.width > 0 && picture.height > 0 {
+		bounds := img.Bounds()
+		width := int(picture.width*opts.TargetDPI + 0.5)
+		height := int(picture.height*opts.TargetDPI + 0.5)
+		if width > 0 && height > 0 && width < bounds.Dx() && height < bounds.Dy() {
+			img = resampleImage(img, width, height)
+			reencode = true
+			p.downsampled++
+		}
+	}
+
+	if !reencode {
+		return nil
+	}
+	content, err := encodePicture(img, picture.content.Format, opts.Quality)
+	if err != nil {
+		return err
+	}
+	picture.content, picture.decoded = content, img
+	return nil
+}
+
+// Draw places the image of a node in its content box
+func (p *pdfPictures) Draw(node *domain.LayoutNode, ctx RenderContext) {
+	if p == nil || node.Image == nil {
+		return
+	}
+	picture, ok := p.pictures[node.Image.Key]
+	if !ok {
+		return
+	}
+	x, y, w, h := ctx.ToPage(layout.ContentBox(node))
+	if w <= 0 || h <= 0 {
+		return
+	}
+
+	ctx.Tags.BeginText(node, ctx)
+	drawImage(picture.id, picture.content, x, y, w, h, ctx)
+	ctx.Tags.End(ctx.PDF)
+}
+
+// DrawBackground draws the copies of an element's background image that
+// fall inside its padding box
+func (p *pdfPictures) DrawBackground(node *domain.LayoutNode, ctx RenderContext) {
+	if p == nil || node.Style.Background.Loaded == nil {
+		return
+	}
+	picture, ok := p.pictures[node.Style.Background.Loaded.Key]
+	placement, placed := resolveBackground(node.Style.Background, layout.PaddingBox(node))
+	if !ok || !placed {
+		return
+	}
+
+	x, y, w, h := ctx.ToPage(placement.Area)
+	ctx.PDF.ClipRect(x, y, w, h, false)
+	for _, tile := range placement.Tiles() {
+		x, y, w, h := ctx.ToPage(tile)
+		drawImage(picture.id, picture.content, x, y, w, h, ctx)
+	}
+	ctx.PDF.ClipEnd()
+}
+
+// Warnings describes images that were changed to conform to the output
+func (p *pdfPictures) Warnings() []string {
+	var warnings []string
+	if p.flattened > 0 {
+		warnings = append(warnings, fmt.Sprintf("PDF/A-1 does not allow transparency: %d transparent image(s) were drawn on white", p.flattened))
+	}
+	return warnings
+}
+
+// pdfEmbeddable reports whether gofpdf can embed image data as it is. It
+// reads neither 16-bit nor interlaced PNG files.
+func pdfEmbeddable(content *ImageContent) bool {
+	if content.Format != "png" {
+		return true
+	}
+	const depth, interlace = 24, 28 // Offsets in the IHDR chunk after the signature
+	data := content.Data
+	return len(data) > interlace && data[depth] <= 8 && data[interlace] == 0
+}
+
+// isTransparent reports whether an image has pixels that are not opaque
+func isTransparent(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return !opaque.Opaque()
+	}
+	return hasAlphaChannel(img)
+}
+
+// flattenImage draws an image on a white background, removing its transparency
+func flattenImage(img image.Image) image.Image {
+	bounds := img.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, bounds.Min, draw.Over)
+	return flat
+}
+
+// resampleImage scales an image to the given size in pixels
+func resampleImage(img image.Image, width, height int) image.Image {
+	var scaled draw.Image
+	if isTransparent(img) {
+		scaled = image.NewNRGBA(image.Rect(0, 0, width, height))
+	} else {
+		scaled = image.NewRGBA(image.Rect(0, 0, width, height))
+	}
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return scaled
+}
+
+// encodePicture encodes image pixels for embedding. Photographs stay JPEG;
+// other images become 8-bit PNG so sharp edges and transparency survive.
+func encodePicture(img image.Image, format string, quality int) (*ImageContent, error) {
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, fmt.Errorf("failed to encode JPEG: %w", err)
+		}
+	} else {
+		format = "png"
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := encoder.Encode(&buf, to8Bit(img)); err != nil {
+			return nil, fmt.Errorf("failed to encode PNG: %w", err)
+		}
+	}
+	bounds := img.Bounds()
+	return &ImageContent{Data: buf.Bytes(), Format: format, Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
+
+// to8Bit converts images with 16-bit samples, which the PNG encoder would
+// keep, to 8-bit samples
+func to8Bit(img image.Image) image.Image {
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+	default:
+		return img
+	}
+	bounds := img.Bounds()
+	converted := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(converted, converted.Bounds(), img, bounds.Min, draw.Src)
+	return converted
+}
+
+// imageTargetDPI is the resolution optimized images are reduced to for a
+// render quality level
+func imageTargetDPI(quality domain.RenderQuality) float64 {
+	switch quality {
+	case domain.QualityDraft:
+		return 96
+	case domain.QualityHigh, domain.QualityPrint:
+		return 300
+	default:
+		return 150
+	}
+}
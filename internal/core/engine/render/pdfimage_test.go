@@ -0,0 +1,116 @@
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/jpeg"
+	"regexp"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+// imageURI wraps encoded image data in a data URI
+func imageURI(mime string, data []byte) string {
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// testJPEG encodes a blank colour image
+func testJPEG(width, height int) []byte {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)), nil)
+	return buf.Bytes()
+}
+
+// imageXObjects returns the dictionaries of the image XObjects in a PDF
+func imageXObjects(data []byte) []string {
+	return regexp.MustCompile(`<<[^>]*/Subtype /Image[^>]*>>`).FindAllString(string(data), -1)
+}
+
+func TestPDFRendererEmbedsRepeatedImageOnce(t *testing.T) {
+	logo := imageURI("image/png", testPNG(40, 20))
+	content := `<img src="` + logo + `"><p>Text</p><img src="` + logo + `"><img src="` + imageURI("image/png", testPNG(10, 10)) + `">`
+	output := renderTestPDF(t, content, domain.DefaultPrintOptions(), PDFRenderOptions{})
+
+	if n := len(imageXObjects(output.Data)); n != 2 {
+		t.Errorf("%d image XObjects for two distinct images, want 2", n)
+	}
+	file, pages := testPages(t, output.Data)
+	if n := strings.Count(testPageContent(t, file, pages[0]), " Do "); n != 3 {
+		t.Errorf("%d images drawn, want 3", n)
+	}
+}
+
+func TestPDFRendererImageSize(t *testing.T) {
+	picture := imageURI("image/png", testPNG(40, 20))
+	tests := []struct {
+		name string
+		img  string
+		want string
+	}{
+		{"intrinsic", `<img src="` + picture + `">`, "30.00000 0 0 15.00000"},
+		{"css width", `<img src="` + picture + `" style="width: 80px">`, "60.00000 0 0 30.00000"},
+		{"css height", `<img src="` + picture + `" style="height: 40px">`, "60.00000 0 0 30.00000"},
+		{"both", `<img src="` + picture + `" style="width: 20px; height: 40px">`, "15.00000 0 0 30.00000"},
+		{"attribute", `<img src="` + picture + `" width="120">`, "90.00000 0 0 45.00000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := renderTestPDF(t, tt.img, domain.DefaultPrintOptions(), PDFRenderOptions{})
+			file, pages := testPages(t, output.Data)
+			content := testPageContent(t, file, pages[0])
+			if !strings.Contains(content, "q "+tt.want+" ") {
+				t.Errorf("image not drawn at %s:\n%s", tt.want, content)
+			}
+		})
+	}
+}
+
+func TestPDFRendererOptimizeImages(t *testing.T) {
+	// Each source is 1000px wide but drawn 100px (about an inch) wide, so at
+	// the draft target of 96 DPI it is downsampled to the drawn size
+	tests := []struct {
+		name     string
+		src      string
+		optimize bool
+		width    string
+		filter   string
+	}{
+		{"png", imageURI("image/png", testPNG(1000, 500)), true, "/Width 100\n/Height 50", "/FlateDecode"},
+		{"jpeg", imageURI("image/jpeg", testJPEG(1000, 500)), true, "/Width 100\n/Height 50", "/DCTDecode"},
+		{"png unoptimized", imageURI("image/png", testPNG(1000, 500)), false, "/Width 1000\n/Height 500", "/FlateDecode"},
+		{"jpeg unoptimized", imageURI("image/jpeg", testJPEG(1000, 500)), false, "/Width 1000\n/Height 500", "/DCTDecode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := domain.DefaultPrintOptions()
+			options.Render.Quality = domain.QualityDraft
+			output := renderTestPDF(t, `<img src="`+tt.src+`" width="100">`, options, PDFRenderOptions{OptimizeImages: tt.optimize})
+
+			objects := imageXObjects(output.Data)
+			if len(objects) != 1 {
+				t.Fatalf("%d image XObjects, want 1", len(objects))
+			}
+			if !strings.Contains(objects[0], tt.width) {
+				t.Errorf("image embedded as %s, want %q", objects[0], tt.width)
+			}
+			if !strings.Contains(objects[0], "/Filter "+tt.filter) {
+				t.Errorf("image embedded as %s, want filter %s", objects[0], tt.filter)
+			}
+		})
+	}
+}
+
+func TestPDFRendererKeepsSmallImages(t *testing.T) {
+	// Optimizing never upsamples an image drawn larger than its pixels
+	options := domain.DefaultPrintOptions()
+	options.Render.Quality = domain.QualityDraft
+	output := renderTestPDF(t, `<img src="`+imageURI("image/png", testPNG(40, 20))+`" width="400">`, options, PDFRenderOptions{OptimizeImages: true})
+
+	objects := imageXObjects(output.Data)
+	if len(objects) != 1 || !strings.Contains(objects[0], "/Width 40\n/Height 20") {
+		t.Errorf("image embedded as %v, want its original 40x20 pixels", objects)
+	}
+}
@@ -0,0 +1,629 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pdfFile reads the objects of an existing PDF, such as an uploaded part of
+// a compound job. Unlike pdfUpdate it accepts what other writers produce:
+// cross-reference streams, object streams, incremental updates and indirect
+// stream lengths. Encrypted files are refused.
+type pdfFile struct {
+	text          string               // File content
+	version       string               // Version of the file header, such as "1.4"
+	entries       map[int]pdfXrefEntry // Location of every object in use
+	trailer       string               // Trailer dictionary of the latest revision
+	objectStreams map[int][]string     // Objects of the object streams read so far
+	resolving     map[int]bool         // Objects being read, to refuse cyclic stream lengths
+}
+
+// pdfXrefEntry locates an object in a file
+type pdfXrefEntry struct {
+	offset int // Byte offset of an object stored on its own
+	stream int // Object stream holding a compressed object, 0 for none
+	index  int // Position of a compressed object in its object stream
+}
+
+// pdfPage is a page of a file with the attributes it inherits from the page tree
+type pdfPage struct {
+	num  int    // Object number
+	dict string // Page dictionary, including inherited entries
+}
+
+var (
+	startxrefPattern    = regexp.MustCompile(`startxref\s+(\d+)`)
+	objectHeaderPattern = regexp.MustCompile(`^\s*\d+\s+\d+\s+obj`)
+	headerVersion       = regexp.MustCompile(`%PDF-(\d\.\d)`)
+)
+
+// minXrefEntrySize is the fewest bytes an entry of a cross-reference table takes
+const minXrefEntrySize = 6
+
+// maxDecodedStreamSize limits the data a cross-reference or object stream may
+// inflate to, as a small upload could otherwise claim gigabytes
+const maxDecodedStreamSize = 64 << 20
+
+// maxPDFNesting limits how deeply page trees, outlines and indirect stream
+// lengths may nest, as each level is read recursively
+const maxPDFNesting = 256
+
+// inheritedPageKeys are the page attributes a page takes from its ancestors
+var inheritedPageKeys = []string{"/Resources", "/MediaBox", "/CropBox", "/Rotate"}
+
+// CountPDFPages returns the number of pages of a PDF file
+func CountPDFPages(data []byte) (int, error) {
+	file, err := readPDF(data)
+	if err != nil {
+		return 0, err
+	}
+	pages, err := file.Pages()
+	if err != nil {
+		return 0, err
+	}
+	return len(pages), nil
+}
+
+// readPDF reads the cross-reference sections and trailer of a PDF
+func readPDF(data []byte) (*pdfFile, error) {
+	f := &pdfFile{
+		text:          string(data),
+		entries:       make(map[int]pdfXrefEntry),
+		objectStreams: make(map[int][]string),
+		resolving:     make(map[int]bool),
+	}
+	header := headerVersion.FindStringSubmatch(f.text[:min(len(f.text), 1024)])
+	if header == nil {
+		return nil, fmt.Errorf("PDF header not found")
+	}
+	f.version = header[1]
+
+	matches := startxrefPattern.FindAllStringSubmatch(f.text[max(0, len(f.text)-2048):], -1)
+	if matches == nil {
+		return nil, fmt.Errorf("startxref not found")
+	}
+	offset, _ := strconv.Atoi(matches[len(matches)-1][1])
+	if err := f.readXrefChain(offset); err != nil {
+		return nil, err
+	}
+
+	if dictValue(f.trailer, "/Encrypt") != "" {
+		return nil, fmt.Errorf("encrypted PDFs are not supported")
+	}
+	if f.Root() <= 0 {
+		return nil, fmt.Errorf("PDF trailer has no /Root")
+	}
+	return f, nil
+}
+
+// readXrefChain reads the cross-reference sections of every revision, latest
+// first, so the entries of later revisions win
+func (f *pdfFile) readXrefChain(offset int) error {
+	seen := make(map[int]bool)
+	for offset > 0 && !seen[offset] {
+		seen[offset] = true
+		if offset >= len(f.text) {
+			return fmt.Errorf("invalid cross-reference offset %d", offset)
+		}
+
+		var trailer string
+		var err error
+		if strings.HasPrefix(strings.TrimLeft(f.text[offset:], " \t\r\n"), "xref") {
+			trailer, err = f.readXrefTable(offset)
+			// Hybrid files list their compressed objects in a stream as well
+			if stream := dictInt(trailer, "/XRefStm"); err == nil && stream > 0 {
+				_, err = f.readXrefStream(stream)
+			}
+		} else {
+			trailer, err = f.readXrefStream(offset)
+		}
+		if err != nil {
+			return err
+		}
+
+		if f.trailer == "" {
+			f.trailer = trailer
+		}
+		offset = dictInt(trailer, "/Prev")
+	}
+	if f.trailer == "" {
+		return fmt.Errorf("cross-reference table not found")
+	}
+	return nil
+}
+
+// readXrefTable reads a classic cross-reference table and returns the
+// trailer dictionary that follows it
+func (f *pdfFile) readXrefTable(offset int) (string, error) {
+	pos := strings.Index(f.text[offset:], "xref") + offset + len("xref")
+	token := func() string {
+		for pos < len(f.text) && isPDFSpace(f.text[pos]) {
+			pos++
+		}
+		start := pos
+		for pos < len(f.text) && !isPDFSpace(f.text[pos]) {
+			pos++
+		}
+		return f.text[start:pos]
+	}
+
+	for {
+		first := token()
+		if first == "trailer" {
+			break
+		}
+		start, err1 := strconv.Atoi(first)
+		count, err2 := strconv.Atoi(token())
+		// An entry takes at least three one-character fields and their separators
+		if err1 != nil || err2 != nil || start < 0 || count < 0 || count > (len(f.text)-pos)/minXrefEntrySize {
+			return "", fmt.Errorf("malformed cross-reference table at offset %d", offset)
+		}
+		for i := 0; i < count; i++ {
+			location, _, kind := token(), token(), token()
+			if kind == "" {
+				return "", fmt.Errorf("cross-reference table at offset %d is truncated", offset)
+			}
+			if kind != "n" {
+				continue
+			}
+			if _, ok := f.entries[start+i]; !ok {
+				value, _ := strconv.Atoi(location)
+				f.entries[start+i] = pdfXrefEntry{offset: value}
+			}
+		}
+	}
+
+	end := valueEnd(f.text, pos)
+	trailer := strings.TrimSpace(f.text[pos:end])
+	if !strings.HasPrefix(trailer, "<<") {
+		return "", fmt.Errorf("PDF trailer not found")
+	}
+	return trailer, nil
+}
+
+// readXrefStream reads a cross-reference stream and returns its dictionary,
+// which serves as the trailer of its revision
+func (f *pdfFile) readXrefStream(offset int) (string, error) {
+	body, err := f.objectAt(offset)
+	if err != nil {
+		return "", err
+	}
+	dict, raw, err := splitStream(body)
+	if err != nil || dict == "" {
+		return "", fmt.Errorf("cross-reference stream not found at offset %d", offset)
+	}
+	data, err := decodePDFStream(dict, raw)
+	if err != nil {
+		return "", fmt.Errorf("cross-reference stream: %w", err)
+	}
+
+	widths := arrayInts(dictValue(dict, "/W"))
+	if len(widths) != 3 {
+		return "", fmt.Errorf("cross-reference stream has no valid /W")
+	}
+	for _, width := range widths {
+		// Wider fields would overflow an int
+		if width < 0 || width > 8 {
+			return "", fmt.Errorf("cross-reference stream has an invalid field width %d", width)
+		}
+	}
+	rowSize := widths[0] + widths[1] + widths[2]
+	if rowSize == 0 {
+		return "", fmt.Errorf("cross-reference stream has empty entries")
+	}
+	index := arrayInts(dictValue(dict, "/Index"))
+	if len(index) == 0 {
+		index = []int{0, dictInt(dict, "/Size")}
+	}
+	if len(index)%2 != 0 {
+		return "", fmt.Errorf("cross-reference stream has an invalid /Index")
+	}
+	rows := len(data) / rowSize
+	for i := 0; i < len(index); i += 2 {
+		if index[i] < 0 || index[i+1] < 0 || index[i+1] > rows {
+			return "", fmt.Errorf("cross-reference stream has an invalid /Index")
+		}
+		rows -= index[i+1]
+	}
+
+	field := func(row []byte, width int) int {
+		value := 0
+		for _, b := range row[:width] {
+			value = value<<8 | int(b)
+		}
+		return value
+	}
+	for i := 0; i < len(index); i += 2 {
+		for num := index[i]; num < index[i]+index[i+1]; num++ {
+			row := data[:rowSize]
+			data = data[rowSize:]
+
+			kind := 1 // The type defaults to an object stored on its own
+			if widths[0] > 0 {
+				kind = field(row, widths[0])
+			}
+			second := field(row[widths[0]:], widths[1])
+			third := field(row[widths[0]+widths[1]:], widths[2])
+			if _, ok := f.entries[num]; ok {
+				continue
+			}
+			switch kind {
+			case 1:
+				f.entries[num] = pdfXrefEntry{offset: second}
+			case 2:
+				f.entries[num] = pdfXrefEntry{stream: second, index: third}
+			}
+		}
+	}
+	return dict, nil
+}
+
+// Root returns the catalog object number
+func (f *pdfFile) Root() int {
+	return dictInt(f.trailer, "/Root")
+}
+
+// Has reports whether an object is in use
+func (f *pdfFile) Has(num int) bool {
+	_, ok := f.entries[num]
+	return ok
+}
+
+// Object returns the body of an object, between "obj" and "endobj". Streams
+// are returned with a direct /Length.
+func (f *pdfFile) Object(num int) (string, error) {
+	entry, ok := f.entries[num]
+	if !ok {
+		return "", fmt.Errorf("PDF object %d not found", num)
+	}
+	if entry.stream == 0 {
+		if f.resolving[num] {
+			return "", fmt.Errorf("PDF object %d refers to itself", num)
+		}
+		if len(f.resolving) >= maxPDFNesting {
+			return "", fmt.Errorf("PDF object %d is nested too deeply", num)
+		}
+		f.resolving[num] = true
+		defer delete(f.resolving, num)
+		return f.objectAt(entry.offset)
+	}
+
+	objects, err := f.objectStream(entry.stream)
+	if err != nil {
+		return "", err
+	}
+	if entry.index >= len(objects) {
+		return "", fmt.Errorf("PDF object %d not found in object stream %d", num, entry.stream)
+	}
+	return objects[entry.index], nil
+}
+
+// Resolve returns the object a value refers to, or the value itself when it
+// is not a reference
+func (f *pdfFile) Resolve(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if num, ok := referenceTo(value); ok {
+		return f.Object(num)
+	}
+	return value, nil
+}
+
+// objectAt reads the object whose header starts at an offset
+func (f *pdfFile) objectAt(offset int) (string, error) {
+	if offset <= 0 || offset >= len(f.text) {
+		return "", fmt.Errorf("invalid object offset %d", offset)
+	}
+	header := objectHeaderPattern.FindStringIndex(f.text[offset:min(len(f.text), offset+64)])
+	if header == nil {
+		return "", fmt.Errorf("no object at offset %d", offset)
+	}
+	pos := offset + header[1]
+	for pos < len(f.text) && isPDFSpace(f.text[pos]) {
+		pos++
+	}
+
+	if !strings.HasPrefix(f.text[pos:], "<<") {
+		end := strings.Index(f.text[pos:], "endobj")
+		if end < 0 {
+			return "", fmt.Errorf("PDF object at offset %d is malformed", offset)
+		}
+		return strings.TrimSpace(f.text[pos : pos+end]), nil
+	}
+
+	end := valueEnd(f.text, pos)
+	dict := f.text[pos:end]
+	rest := strings.TrimLeft(f.text[end:], " \t\r\n")
+	if !strings.HasPrefix(rest, "stream") {
+		return dict, nil
+	}
+
+	// Stream data starts after the end of line that follows the keyword
+	start := len(f.text) - len(rest) + len("stream")
+	if strings.HasPrefix(f.text[start:], "\r\n") {
+		start += 2
+	} else if start < len(f.text) && (f.text[start] == '\n' || f.text[start] == '\r') {
+		start++
+	}
+
+	length := -1
+	if value, err := f.Resolve(dictValue(dict, "/Length")); err == nil {
+		if n, err := strconv.Atoi(value); err == nil {
+			length = n
+		}
+	}
+	if length < 0 || length > len(f.text)-start || !strings.HasPrefix(strings.TrimLeft(f.text[start+length:], " \t\r\n"), "endstream") {
+		// A missing or wrong length is recovered from the end of the data
+		stop := strings.Index(f.text[start:], "endstream")
+		if stop < 0 {
+			return "", fmt.Errorf("PDF stream at offset %d is truncated", offset)
+		}
+		length = len(strings.TrimRight(f.text[start:start+stop], "\r\n"))
+	}
+
+	dict = setDictValue(dict, "/Length", strconv.Itoa(length))
+	return fmt.Sprintf("%s\nstream\n%s\nendstream", dict, f.text[start:start+length]), nil
+}
+
+// objectStream returns the objects of an object stream in order
+func (f *pdfFile) objectStream(num int) ([]string, error) {
+	if objects, ok := f.objectStreams[num]; ok {
+		return objects, nil
+	}
+	if entry := f.entries[num]; entry.stream != 0 {
+		return nil, fmt.Errorf("object stream %d is compressed", num)
+	}
+
+	body, err := f.Object(num)
+	if err != nil {
+		return nil, err
+	}
+	dict, raw, err := splitStream(body)
+	if err != nil || dict == "" {
+		return nil, fmt.Errorf("PDF object %d is not an object stream", num)
+	}
+	data, err := decodePDFStream(dict, raw)
+	if err != nil {
+		return nil, fmt.Errorf("object stream %d: %w", num, err)
+	}
+
+	count, first := dictInt(dict, "/N"), dictInt(dict, "/First")
+	if count < 0 || first < 0 || first > len(data) {
+		return nil, fmt.Errorf("object stream %d is malformed", num)
+	}
+	header := strings.Fields(string(data[:first]))
+	offsets := make([]int, 0, min(count, len(header)/2))
+	for i := 1; i < len(header) && len(offsets) < count; i += 2 {
+		offset, err := strconv.Atoi(header[i])
+		if err != nil || offset < 0 || offset > len(data)-first {
+			return nil, fmt.Errorf("object stream %d is malformed", num)
+		}
+		offsets = append(offsets, first+offset)
+	}
+
+	objects := make([]string, len(offsets))
+	for i, start := range offsets {
+		end := len(data)
+		if i+1 < len(offsets) {
+			end = offsets[i+1]
+		}
+		if start > end || end > len(data) {
+			return nil, fmt.Errorf("object stream %d is malformed", num)
+		}
+		objects[i] = strings.TrimSpace(string(data[start:end]))
+	}
+	f.objectStreams[num] = objects
+	return objects, nil
+}
+
+// Pages returns the pages of the file in order, with their inherited attributes
+func (f *pdfFile) Pages() ([]pdfPage, error) {
+	catalog, err := f.Object(f.Root())
+	if err != nil {
+		return nil, err
+	}
+	root, ok := referenceTo(dictValue(catalog, "/Pages"))
+	if !ok {
+		return nil, fmt.Errorf("PDF catalog has no page tree")
+	}
+
+	var pages []pdfPage
+	visited := make(map[int]bool)
+	var walk func(num, depth int, inherited map[string]string) error
+	walk = func(num, depth int, inherited map[string]string) error {
+		if visited[num] {
+			return fmt.Errorf("PDF page tree has a cycle at object %d", num)
+		}
+		if depth > maxPDFNesting {
+			return fmt.Errorf("PDF page tree is nested too deeply")
+		}
+		visited[num] = true
+		node, err := f.Object(num)
+		if err != nil {
+			return err
+		}
+
+		if dictValue(node, "/Type") == "/Page" || dictValue(node, "/Kids") == "" {
+			for _, key := range inheritedPageKeys {
+				if value, ok := inherited[key]; ok && dictValue(node, key) == "" {
+					node = setDictValue(node, key, value)
+				}
+			}
+			pages = append(pages, pdfPage{num: num, dict: node})
+			return nil
+		}
+
+		attributes := make(map[string]string, len(inheritedPageKeys))
+		for key, value := range inherited {
+			attributes[key] = value
+		}
+		for _, key := range inheritedPageKeys {
+			if value := dictValue(node, key); value != "" {
+				attributes[key] = value
+			}
+		}
+		kids, err := f.Resolve(dictValue(node, "/Kids"))
+		if err != nil {
+			return err
+		}
+		for _, kid := range references(kids) {
+			if err := walk(kid, depth+1, attributes); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root, 0, nil); err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("PDF has no pages")
+	}
+	return pages, nil
+}
+
+// decodePDFStream decodes stream data compressed with the Flate filter,
+// including the PNG predictors of cross-reference and object streams
+func decodePDFStream(dict string, raw []byte) ([]byte, error) {
+	filter := strings.Trim(dictValue(dict, "/Filter"), "[] \t\r\n")
+	switch filter {
+	case "":
+		return raw, nil
+	case "/FlateDecode", "/Fl":
+	default:
+		return nil, fmt.Errorf("unsupported filter %s", filter)
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, maxDecodedStreamSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDecodedStreamSize {
+		return nil, fmt.Errorf("stream data exceeds %d bytes", maxDecodedStreamSize)
+	}
+
+	params := strings.Trim(dictValue(dict, "/DecodeParms"), "[] \t\r\n")
+	if predictor := dictInt(params, "/Predictor"); predictor >= 10 {
+		columns := dictInt(params, "/Columns")
+		if columns <= 0 {
+			columns = 1
+		}
+		return unpredictPNG(data, columns)
+	}
+	return data, nil
+}
+
+// unpredictPNG reverses the PNG row filters of data with one byte per column
+func unpredictPNG(data []byte, columns int) ([]byte, error) {
+	rowSize := columns + 1
+	if len(data) == 0 {
+		return data, nil
+	}
+	if len(data)%rowSize != 0 {
+		return nil, fmt.Errorf("predicted data does not fill its rows")
+	}
+
+	out := make([]byte, 0, len(data)/rowSize*columns)
+	previous := make([]byte, columns)
+	for row := 0; row < len(data); row += rowSize {
+		filter, current := data[row], make([]byte, columns)
+		copy(current, data[row+1:row+rowSize])
+		for i := range current {
+			var left, upLeft byte
+			if i > 0 {
+				left, upLeft = current[i-1], previous[i-1]
+			}
+			up := previous[i]
+			switch filter {
+			case 1:
+				current[i] += left
+			case 2:
+				current[i] += up
+			case 3:
+				current[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				current[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, current...)
+		previous = current
+	}
+	return out, nil
+}
+
+// paeth returns the neighbouring byte the PNG Paeth predictor chooses
+func paeth(left, up, upLeft byte) byte {
+	p := int(left) + int(up) - int(upLeft)
+	pa, pb, pc := abs(p-int(left)), abs(p-int(up)), abs(p-int(upLeft))
+	switch {
+	case pa <= pb && pa <= pc:
+		return left
+	case pb <= pc:
+		return up
+	default:
+		return upLeft
+	}
+}
+
+// abs returns the absolute value of an integer
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// anyReferencePattern matches an indirect reference of any generation
+var anyReferencePattern = regexp.MustCompile(`(\d+)\s+(\d+)\s+R`)
+
+// referenceTo returns the object number a value refers to
+func referenceTo(value string) (int, bool) {
+	match := anyReferencePattern.FindStringSubmatchIndex(value)
+	if match == nil || strings.TrimSpace(value[:match[0]]) != "" || strings.TrimSpace(value[match[1]:]) != "" {
+		return 0, false
+	}
+	num, _ := strconv.Atoi(value[match[2]:match[3]])
+	return num, true
+}
+
+// references returns the object numbers an array refers to, in order
+func references(array string) []int {
+	var nums []int
+	for _, match := range anyReferencePattern.FindAllStringSubmatch(array, -1) {
+		num, _ := strconv.Atoi(match[1])
+		nums = append(nums, num)
+	}
+	return nums
+}
+
+// arrayInts reads the integers of a direct array
+func arrayInts(array string) []int {
+	var values []int
+	for _, field := range strings.Fields(strings.Trim(array, "[]")) {
+		value, err := strconv.Atoi(field)
+		if err != nil {
+			return nil
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// dictInt reads an integer, or the object number of a reference, from a dictionary
+func dictInt(dict, key string) int {
+	fields := strings.Fields(dictValue(dict, key))
+	if len(fields) == 0 {
+		return 0
+	}
+	n, _ := strconv.Atoi(fields[0])
+	return n
+}
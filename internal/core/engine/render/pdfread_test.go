@@ -0,0 +1,342 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+// testPDFContent is the content stream of the pages of testPDFObjects
+const testPDFContent = "q 1 0 0 1 0 0 cm Q"
+
+// testPDFObjects are objects 1 to 8 of a two-page file with an outline. The
+// second page sets its own media box; the content stream has an indirect length.
+var testPDFObjects = []string{
+	"<</Type /Catalog /Pages 2 0 R /Outlines 6 0 R /Dests <</Intro [4 0 R /Fit]>>>>",
+	"<</Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /MediaBox [0 0 200 100]>>",
+	"<</Type /Page /Parent 2 0 R /Contents 5 0 R>>",
+	"<</Type /Page /Parent 2 0 R /Contents 5 0 R /MediaBox [0 0 100 200]>>",
+	"<</Length 8 0 R>>\nstream\n" + testPDFContent + "\nendstream",
+	"<</Type /Outlines /First 7 0 R /Last 7 0 R /Count 1>>",
+	"<</Title (Intro) /Parent 6 0 R /Dest /Intro>>",
+	fmt.Sprint(len(testPDFContent)),
+}
+
+// testPDF builds PDF files from object bodies, numbered from 1
+type testPDF struct {
+	objects    []string
+	compressed map[int]bool // Objects written to an object stream
+	predictor  bool         // Whether the rows of cross-reference streams use the PNG Up predictor
+}
+
+// writeObjects writes the header and the objects not compressed, returning their offsets
+func (p testPDF) writeObjects(buf *bytes.Buffer, version string) map[int]int {
+	fmt.Fprintf(buf, "%%PDF-%s\n%%\xe2\xe3\xcf\xd3\n", version)
+	offsets := make(map[int]int)
+	for i, body := range p.objects {
+		if p.compressed[i+1] {
+			continue
+		}
+		offsets[i+1] = buf.Len()
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	return offsets
+}
+
+// classic builds a file with a cross-reference table
+func (p testPDF) classic(trailer string) []byte {
+	var buf bytes.Buffer
+	offsets := p.writeObjects(&buf, "1.4")
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(p.objects)+1)
+	for num := 1; num <= len(p.objects); num++ {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offsets[num])
+	}
+	fmt.Fprintf(&buf, "trailer\n<</Size %d /Root 1 0 R%s>>\nstartxref\n%d\n%%%%EOF\n", len(p.objects)+1, trailer, xref)
+	return buf.Bytes()
+}
+
+// xrefStream builds a file with a cross-reference stream, writing the
+// compressed objects to an object stream first
+func (p testPDF) xrefStream() []byte {
+	var buf bytes.Buffer
+	offsets := p.writeObjects(&buf, "1.5")
+	entries := p.writeObjectStream(&buf, offsets)
+	xref := p.writeXrefStream(&buf, entries, offsets)
+	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", xref)
+	return buf.Bytes()
+}
+
+// hybrid builds a file whose cross-reference table lists the objects stored
+// on their own and whose /XRefStm stream lists the compressed ones
+func (p testPDF) hybrid() []byte {
+	var buf bytes.Buffer
+	offsets := p.writeObjects(&buf, "1.5")
+	entries := p.writeObjectStream(&buf, offsets)
+	stream := p.writeXrefStream(&buf, entries, nil)
+
+	xref := buf.Len()
+	size := len(p.objects) + 3
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", size)
+	for num := 1; num < size; num++ {
+		if offset, ok := offsets[num]; ok {
+			fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+		} else {
+			buf.WriteString("0000000000 00000 f \n")
+		}
+	}
+	fmt.Fprintf(&buf, "trailer\n<</Size %d /Root 1 0 R /XRefStm %d>>\nstartxref\n%d\n%%%%EOF\n", size, stream, xref)
+	return buf.Bytes()
+}
+
+// writeObjectStream writes the compressed objects to object len(objects)+1
+// and returns their cross-reference entries
+func (p testPDF) writeObjectStream(buf *bytes.Buffer, offsets map[int]int) map[int][2]int {
+	entries := make(map[int][2]int)
+	if len(p.compressed) == 0 {
+		return entries
+	}
+	var header, body strings.Builder
+	for num := 1; num <= len(p.objects); num++ {
+		if !p.compressed[num] {
+			continue
+		}
+		fmt.Fprintf(&header, "%d %d ", num, body.Len())
+		body.WriteString(p.objects[num-1] + "\n")
+		entries[num] = [2]int{len(p.objects) + 1, len(entries)}
+	}
+	data := deflateTest(header.String() + body.String())
+	offsets[len(p.objects)+1] = buf.Len()
+	fmt.Fprintf(buf, "%d 0 obj\n<</Type /ObjStm /N %d /First %d /Filter /FlateDecode /Length %d>>\nstream\n%s\nendstream\nendobj\n",
+		len(p.objects)+1, len(entries), header.Len(), len(data), data)
+	return entries
+}
+
+// writeXrefStream writes a cross-reference stream as object len(objects)+2
+// and returns its offset
+func (p testPDF) writeXrefStream(buf *bytes.Buffer, compressed map[int][2]int, offsets map[int]int) int {
+	num := len(p.objects) + 2
+	offset := buf.Len()
+	var rows []byte
+	previous := make([]byte, 7)
+	for n := 0; n <= num; n++ {
+		row := make([]byte, 7)
+		switch entry, ok := compressed[n]; {
+		case ok:
+			row[0] = 2
+			row[4], row[6] = byte(entry[0]), byte(entry[1])
+		case n == num:
+			row[0] = 1
+			row[3], row[4] = byte(offset>>8), byte(offset)
+		case offsets[n] > 0:
+			row[0] = 1
+			row[3], row[4] = byte(offsets[n]>>8), byte(offsets[n])
+		}
+		if p.predictor {
+			rows = append(rows, 2)
+			for i := range row {
+				rows = append(rows, row[i]-previous[i])
+			}
+			previous = row
+		} else {
+			rows = append(rows, row...)
+		}
+	}
+
+	params := ""
+	if p.predictor {
+		params = " /DecodeParms <</Predictor 12 /Columns 7>>"
+	}
+	data := deflateTest(string(rows))
+	fmt.Fprintf(buf, "%d 0 obj\n<</Type /XRef /Size %d /W [1 4 2] /Root 1 0 R /Filter /FlateDecode%s /Length %d>>\nstream\n%s\nendstream\nendobj\n",
+		num, num+1, params, len(data), data)
+	return offset
+}
+
+// deflateTest compresses data with zlib
+func deflateTest(data string) string {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write([]byte(data))
+	w.Close()
+	return buf.String()
+}
+
+// rawXrefStreamPDF builds a file whose cross-reference stream has the given
+// entries and uncompressed data, to exercise malformed streams
+func rawXrefStreamPDF(entries string, data []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.5\n1 0 obj\n<</Type /Catalog /Pages 2 0 R>>\nendobj\n")
+	offset := buf.Len()
+	fmt.Fprintf(&buf, "2 0 obj\n<</Type /XRef /Root 1 0 R %s /Length %d>>\nstream\n", entries, len(data))
+	buf.Write(data)
+	fmt.Fprintf(&buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", offset)
+	return buf.Bytes()
+}
+
+// allCompressed compresses every object of testPDFObjects that is not a stream
+var allCompressed = map[int]bool{1: true, 2: true, 3: true, 4: true, 6: true, 7: true, 8: true}
+
+func TestReadPDF(t *testing.T) {
+	classic := testPDF{objects: testPDFObjects}.classic("")
+
+	// An incremental update renames the outline entry
+	var updated bytes.Buffer
+	updated.Write(classic)
+	revision := updated.Len()
+	updated.WriteString("7 0 obj\n<</Title (Updated) /Parent 6 0 R /Dest /Intro>>\nendobj\n")
+	xref := updated.Len()
+	fmt.Fprintf(&updated, "xref\n7 1\n%010d 00000 n \ntrailer\n<</Size 9 /Root 1 0 R /Prev %d>>\nstartxref\n%d\n%%%%EOF\n",
+		revision, bytes.LastIndex(classic, []byte("xref\n0 ")), xref)
+
+	tests := []struct {
+		name  string
+		data  []byte
+		title string
+	}{
+		{"cross-reference table", classic, "(Intro)"},
+		{"cross-reference stream", testPDF{objects: testPDFObjects}.xrefStream(), "(Intro)"},
+		{"PNG predictor", testPDF{objects: testPDFObjects, predictor: true}.xrefStream(), "(Intro)"},
+		{"object stream", testPDF{objects: testPDFObjects, compressed: allCompressed}.xrefStream(), "(Intro)"},
+		{"object stream with predictor", testPDF{objects: testPDFObjects, compressed: allCompressed, predictor: true}.xrefStream(), "(Intro)"},
+		{"hybrid", testPDF{objects: testPDFObjects, compressed: allCompressed}.hybrid(), "(Intro)"},
+		{"incremental update", updated.Bytes(), "(Updated)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := readPDF(tt.data)
+			if err != nil {
+				t.Fatalf("readPDF() error = %v", err)
+			}
+
+			pages, err := file.Pages()
+			if err != nil {
+				t.Fatalf("Pages() error = %v", err)
+			}
+			if len(pages) != 2 || pages[0].num != 3 || pages[1].num != 4 {
+				t.Fatalf("Pages() = %v, want objects 3 and 4", pages)
+			}
+			if got := dictValue(pages[0].dict, "/MediaBox"); got != "[0 0 200 100]" {
+				t.Errorf("first page /MediaBox = %q, want the inherited [0 0 200 100]", got)
+			}
+			if got := dictValue(pages[1].dict, "/MediaBox"); got != "[0 0 100 200]" {
+				t.Errorf("second page /MediaBox = %q, want its own [0 0 100 200]", got)
+			}
+
+			content, err := file.Object(5)
+			if err != nil {
+				t.Fatalf("Object(5) error = %v", err)
+			}
+			dict, data, err := splitStream(content)
+			if err != nil || string(data) != testPDFContent {
+				t.Errorf("content stream = %q, %v, want %q", data, err, testPDFContent)
+			}
+			if got := dictValue(dict, "/Length"); got != fmt.Sprint(len(testPDFContent)) {
+				t.Errorf("content stream /Length = %q, want a direct length", got)
+			}
+
+			entry, err := file.Object(7)
+			if err != nil {
+				t.Fatalf("Object(7) error = %v", err)
+			}
+			if got := dictValue(entry, "/Title"); got != tt.title {
+				t.Errorf("outline entry /Title = %q, want %q", got, tt.title)
+			}
+		})
+	}
+}
+
+func TestReadPDFRejects(t *testing.T) {
+	valid := testPDF{objects: testPDFObjects}.classic("")
+	table := bytes.LastIndex(valid, []byte("xref\n0 "))
+	withSection := func(section string) []byte {
+		data := append([]byte{}, valid[:table]...)
+		return append(data, fmt.Sprintf("xref\n%sstartxref\n%d\n%%%%EOF\n", section, table)...)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"no header", []byte("1 0 obj\n<<>>\nendobj\n")},
+		{"no startxref", valid[:table]},
+		{"encrypted", testPDF{objects: testPDFObjects}.classic(" /Encrypt 8 0 R")},
+		{"negative type width", rawXrefStreamPDF("/W [-1 1 1] /Size 1", []byte{1, 2, 3})},
+		{"negative offset width", rawXrefStreamPDF("/W [1 -2 1] /Size 1", []byte{1, 2, 3})},
+		{"two widths", rawXrefStreamPDF("/W [1 2] /Size 1", []byte{1, 2, 3})},
+		{"wide field", rawXrefStreamPDF("/W [1 9 1] /Size 1", make([]byte, 11))},
+		{"empty entries", rawXrefStreamPDF("/W [0 0 0] /Size 50000000000", nil)},
+		{"negative index", rawXrefStreamPDF("/W [1 1 1] /Index [-5 1]", []byte{1, 9, 0})},
+		{"negative index count", rawXrefStreamPDF("/W [1 1 1] /Index [0 -1]", []byte{1, 9, 0})},
+		{"index beyond data", rawXrefStreamPDF("/W [1 1 1] /Index [0 1 1 1000000]", []byte{1, 9, 0})},
+		{"odd index", rawXrefStreamPDF("/W [1 1 1] /Index [0 1 4]", []byte{1, 9, 0})},
+		{"huge subsection", withSection("0 50000000000\n0000000000 65535 f \ntrailer\n<</Root 1 0 R>>\n")},
+		{"largest subsection", withSection("0 9223372036854775807\n0000000000 65535 f \ntrailer\n<</Root 1 0 R>>\n")},
+		{"negative subsection", withSection("0 -3\ntrailer\n<</Root 1 0 R>>\n")},
+		{"truncated subsection", withSection("0 4\n0000000000 65535 f \n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := CountPDFPages(tt.data); err == nil {
+				t.Error("CountPDFPages() succeeded, want an error")
+			}
+		})
+	}
+
+}
+
+func TestObjectStreamRejects(t *testing.T) {
+	for _, entries := range []string{"/N -1 /First 8", "/N 1 /First -1", "/N 1 /First 99", "/N 1 /First 4", "/N 2 /First 8"} {
+		t.Run(entries, func(t *testing.T) {
+			text := fmt.Sprintf("%%PDF-1.5\n3 0 obj\n<</Type /ObjStm %s /Length 12>>\nstream\n2 x 2 -9 <<>>\nendstream\nendobj\n", entries)
+			file := &pdfFile{
+				text:          text,
+				entries:       map[int]pdfXrefEntry{3: {offset: strings.Index(text, "3 0 obj")}},
+				objectStreams: make(map[int][]string),
+				resolving:     make(map[int]bool),
+			}
+			if objects, err := file.objectStream(3); err == nil {
+				t.Errorf("objectStream() = %q, want an error", objects)
+			}
+		})
+	}
+}
+
+func TestUnpredictPNG(t *testing.T) {
+	// One row for each filter type: none, Sub, Up, Average and Paeth
+	data := []byte{0, 1, 2, 1, 1, 1, 2, 1, 1, 3, 2, 2, 4, 1, 1}
+	want := []byte{1, 2, 1, 2, 2, 3, 3, 5, 4, 6}
+	got, err := unpredictPNG(data, 2)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("unpredictPNG() = %v, %v, want %v", got, err, want)
+	}
+
+	if _, err := unpredictPNG(data[:4], 2); err == nil {
+		t.Error("unpredictPNG() of a partial row succeeded, want an error")
+	}
+}
+
+func FuzzReadPDF(f *testing.F) {
+	f.Add(testPDF{objects: testPDFObjects}.classic(""))
+	f.Add(testPDF{objects: testPDFObjects, predictor: true}.xrefStream())
+	f.Add(testPDF{objects: testPDFObjects, compressed: allCompressed}.xrefStream())
+	f.Add(testPDF{objects: testPDFObjects, compressed: allCompressed}.hybrid())
+	f.Add(rawXrefStreamPDF("/W [1 1 1] /Size 3", []byte{0, 0, 0, 1, 9, 0, 1, 50, 0}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if _, err := CountPDFPages(data); err != nil {
+			return
+		}
+		output, err := MergePDFs([]MergePart{{Data: data, Title: "Part"}}, domain.DocumentMetadata{}, domain.PrintOptions{})
+		if err != nil {
+			return
+		}
+		if _, err := CountPDFPages(output.Data); err != nil {
+			t.Errorf("merged file is unreadable: %v", err)
+		}
+	})
+}
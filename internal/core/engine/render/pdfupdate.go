@@ -0,0 +1,721 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pdfUpdate appends new and replaced objects to a finished PDF as an
+// incremental update. gofpdf has no hooks for catalog and page entries such
+// as the structure tree, so they are added after the document is written.
+type pdfUpdate struct {
+	original  []byte
+	offsets   map[int]int    // Byte offsets of the original objects
+	trailer   string         // Original trailer dictionary
+	startxref int            // Offset of the original cross-reference table
+	size      int            // Next free object number
+	root      int            // Catalog object number
+	objects   map[int]string // Objects written by the update, by number
+}
+
+var (
+	trailerPattern   = regexp.MustCompile(`(?s)trailer\s*<<(.*?)>>\s*startxref\s*(\d+)\s*%%EOF\s*$`)
+	xrefEntryPattern = regexp.MustCompile(`^(\d{10}) (\d{5}) ([nf])`)
+	referencePattern = regexp.MustCompile(`(\d+) 0 R`)
+)
+
+// newPDFUpdate reads the trailer and cross-reference table of a PDF
+func newPDFUpdate(data []byte) (*pdfUpdate, error) {
+	match := trailerPattern.FindSubmatch(data)
+	if match == nil {
+		return nil, fmt.Errorf("PDF trailer not found")
+	}
+
+	u := &pdfUpdate{
+		original: data,
+		offsets:  make(map[int]int),
+		trailer:  string(match[1]),
+		objects:  make(map[int]string),
+	}
+	u.startxref, _ = strconv.Atoi(string(match[2]))
+	u.size = trailerInt(u.trailer, "/Size")
+	u.root = trailerInt(u.trailer, "/Root")
+	if u.size <= 0 || u.root <= 0 {
+		return nil, fmt.Errorf("PDF trailer has no /Size or /Root")
+	}
+
+	if err := u.readXref(); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// readXref reads the offsets of a classic cross-reference table
+func (u *pdfUpdate) readXref() error {
+	if u.startxref <= 0 || u.startxref >= len(u.original) {
+		return fmt.Errorf("invalid startxref offset %d", u.startxref)
+	}
+
+	lines := strings.Split(string(u.original[u.startxref:]), "\n")
+	if len(lines) < 2 || strings.TrimSpace(lines[0]) != "xref" {
+		return fmt.Errorf("cross-reference table not found")
+	}
+
+	for i := 1; i < len(lines); {
+		header := strings.Fields(lines[i])
+		if len(header) != 2 {
+			break // Reached the trailer
+		}
+		first, err1 := strconv.Atoi(header[0])
+		count, err2 := strconv.Atoi(header[1])
+		if err1 != nil || err2 != nil {
+			break
+		}
+		for j := 0; j < count && i+1+j < len(lines); j++ {
+			entry := xrefEntryPattern.FindStringSubmatch(lines[i+1+j])
+			if entry != nil && entry[3] == "n" {
+				offset, _ := strconv.Atoi(entry[1])
+				u.offsets[first+j] = offset
+			}
+		}
+		i += 1 + count
+	}
+
+	return nil
+}
+
+// Object returns the body of an object, between "obj" and "endobj"
+func (u *pdfUpdate) Object(num int) (string, error) {
+	if body, ok := u.objects[num]; ok {
+		return body, nil
+	}
+
+	offset, ok := u.offsets[num]
+	if !ok || offset >= len(u.original) {
+		return "", fmt.Errorf("PDF object %d not found", num)
+	}
+	data := u.original[offset:]
+	start := bytes.Index(data, []byte("obj"))
+	end := bytes.Index(data, []byte("endobj"))
+	if start < 0 || end < start {
+		return "", fmt.Errorf("PDF object %d is malformed", num)
+	}
+	return strings.TrimSpace(string(data[start+3 : end])), nil
+}
+
+// Pages returns the page object numbers in page order
+func (u *pdfUpdate) Pages() ([]int, error) {
+	catalog, err := u.Object(u.root)
+	if err != nil {
+		return nil, err
+	}
+	pagesRef := referencePattern.FindStringSubmatch(dictValue(catalog, "/Pages"))
+	if pagesRef == nil {
+		return nil, fmt.Errorf("PDF catalog has no page tree")
+	}
+	num, _ := strconv.Atoi(pagesRef[1])
+	tree, err := u.Object(num)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []int
+	for _, ref := range referencePattern.FindAllStringSubmatch(dictValue(tree, "/Kids"), -1) {
+		page, _ := strconv.Atoi(ref[1])
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// Add appends a new object and returns its number
+func (u *pdfUpdate) Add(body string) int {
+	num := u.size
+	u.size++
+	u.objects[num] = body
+	return num
+}
+
+// AddStream appends a new stream object with the given dictionary entries
+func (u *pdfUpdate) AddStream(entries string, data []byte) int {
+	return u.Add(fmt.Sprintf("<<%s /Length %d>>\nstream\n%s\nendstream", entries, len(data), data))
+}
+
+// AddCompressedStream appends a new stream object with Flate-compressed data
+func (u *pdfUpdate) AddCompressedStream(entries string, data []byte) int {
+	var buf bytes.Buffer
+	writer := zlib.NewWriter(&buf)
+	_, _ = writer.Write(data)
+	_ = writer.Close()
+	return u.AddStream(entries+" /Filter /FlateDecode", buf.Bytes())
+}
+
+// Reserve allocates an object number whose body is set later
+func (u *pdfUpdate) Reserve() int {
+	return u.Add("null")
+}
+
+// Set writes the body of a new or replaced object
+func (u *pdfUpdate) Set(num int, body string) {
+	u.objects[num] = body
+}
+
+// SetEntries replaces or adds entries of an object's dictionary
+func (u *pdfUpdate) SetEntries(num int, entries map[string]string) error {
+	body, err := u.Object(num)
+	if err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(entries) {
+		body = setDictValue(body, key, entries[key])
+	}
+	u.objects[num] = body
+	return nil
+}
+
+// AppendToArray adds a value to a direct array entry of an object's
+// dictionary, creating the entry when it is absent
+func (u *pdfUpdate) AppendToArray(num int, key, value string) error {
+	body, err := u.Object(num)
+	if err != nil {
+		return err
+	}
+	items := strings.TrimSpace(dictValue(body, key))
+	if items != "" && !strings.HasPrefix(items, "[") {
+		return fmt.Errorf("entry %s of object %d is not a direct array", key, num)
+	}
+	items = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(items, "["), "]"))
+	if items != "" {
+		items += " "
+	}
+	u.objects[num] = setDictValue(body, key, "["+items+value+"]")
+	return nil
+}
+
+// Root returns the catalog object number
+func (u *pdfUpdate) Root() int {
+	return u.root
+}
+
+// Info returns the document information dictionary object number, or 0
+func (u *pdfUpdate) Info() int {
+	return trailerInt(u.trailer, "/Info")
+}
+
+// SetTrailer replaces or adds an entry of the trailer written with the update
+func (u *pdfUpdate) SetTrailer(key, value string) {
+	u.trailer = strings.TrimSuffix(strings.TrimPrefix(setDictValue("<<"+u.trailer+">>", key, value), "<<"), ">>")
+}
+
+// Stream returns the decoded data of a stream object
+func (u *pdfUpdate) Stream(num int) ([]byte, error) {
+	body, err := u.Object(num)
+	if err != nil {
+		return nil, err
+	}
+	dict, raw, err := splitStream(body)
+	if err != nil {
+		return nil, fmt.Errorf("PDF object %d: %w", num, err)
+	}
+	if dict == "" {
+		return nil, fmt.Errorf("PDF object %d is not a stream", num)
+	}
+
+	switch filter := dictValue(dict, "/Filter"); filter {
+	case "":
+		return raw, nil
+	case "/FlateDecode":
+		reader, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("PDF stream %d: %w", num, err)
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	default:
+		return nil, fmt.Errorf("PDF stream %d uses unsupported filter %s", num, filter)
+	}
+}
+
+// splitStream separates the dictionary and raw data of a stream object. The
+// dictionary is "" when the object is not a stream.
+func splitStream(body string) (string, []byte, error) {
+	start := strings.Index(body, "stream")
+	if start < 0 || !strings.HasPrefix(body, "<<") {
+		return "", nil, nil
+	}
+	dict := body[:start]
+	length, err := strconv.Atoi(dictValue(dict, "/Length"))
+	if err != nil {
+		return "", nil, fmt.Errorf("stream has no direct length")
+	}
+
+	data := strings.TrimLeft(body[start+len("stream"):], "\r")
+	data = strings.TrimPrefix(data, "\n")
+	if length < 0 || length > len(data) {
+		return "", nil, fmt.Errorf("stream is truncated")
+	}
+	return strings.TrimSpace(dict), []byte(data[:length]), nil
+}
+
+// Rewrite writes the document as a single revision holding the current
+// version of every object, passing each object body through transform
+func (u *pdfUpdate) Rewrite(transform func(num int, body string) (string, error)) ([]byte, error) {
+	// Keep the header and the binary comment that follows it
+	first := len(u.original)
+	for _, offset := range u.offsets {
+		first = min(first, offset)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(u.original[:first])
+	offsets := make([]int, u.size)
+	for num := 1; num < u.size; num++ {
+		body, err := u.Object(num)
+		if err != nil {
+			continue // Unused numbers stay free
+		}
+		if body, err = transform(num, body); err != nil {
+			return nil, err
+		}
+		offsets[num] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", num, body)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", u.size)
+	for num := 1; num < u.size; num++ {
+		if offsets[num] == 0 {
+			buf.WriteString("0000000000 65535 f \n")
+		} else {
+			fmt.Fprintf(&buf, "%010d 00000 n \n", offsets[num])
+		}
+	}
+
+	trailer := setDictValue("<<"+u.trailer+">>", "/Size", strconv.Itoa(u.size))
+	fmt.Fprintf(&buf, "trailer\n%s\nstartxref\n%d\n%%%%EOF\n", trailer, xref)
+	return buf.Bytes(), nil
+}
+
+// addExtension declares a developer extension to the PDF version in the catalog
+func addExtension(update *pdfUpdate, prefix, baseVersion string, level int) error {
+	catalog, err := update.Object(update.Root())
+	if err != nil {
+		return err
+	}
+	extensions := strings.TrimSpace(dictValue(catalog, "/Extensions"))
+	if extensions == "" {
+		extensions = "<<>>"
+	}
+	extensions = setDictValue(extensions, prefix, fmt.Sprintf("<</BaseVersion /%s /ExtensionLevel %d>>", baseVersion, level))
+	return update.SetEntries(update.Root(), map[string]string{"/Extensions": extensions})
+}
+
+// SetFileID sets the file identifier of the trailer, with both halves
+// starting out as the same value
+func (u *pdfUpdate) SetFileID(id []byte) {
+	u.SetTrailer("/ID", fmt.Sprintf("[<%x> <%x>]", id, id))
+}
+
+// Bytes returns the original document followed by the update
+func (u *pdfUpdate) Bytes() []byte {
+	if len(u.objects) == 0 {
+		return u.original
+	}
+
+	var buf bytes.Buffer
+	buf.Write(u.original)
+	if !bytes.HasSuffix(u.original, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+
+	nums := make([]int, 0, len(u.objects))
+	for num := range u.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	offsets := make(map[int]int, len(nums))
+	for _, num := range nums {
+		offsets[num] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", num, u.objects[num])
+	}
+
+	// One cross-reference subsection per run of consecutive object numbers
+	xref := buf.Len()
+	buf.WriteString("xref\n")
+	for i := 0; i < len(nums); {
+		j := i
+		for j+1 < len(nums) && nums[j+1] == nums[j]+1 {
+			j++
+		}
+		fmt.Fprintf(&buf, "%d %d\n", nums[i], j-i+1)
+		for _, num := range nums[i : j+1] {
+			fmt.Fprintf(&buf, "%010d 00000 n \n", offsets[num])
+		}
+		i = j + 1
+	}
+
+	trailer := setDictValue("<<"+u.trailer+">>", "/Size", strconv.Itoa(u.size))
+	trailer = setDictValue(trailer, "/Prev", strconv.Itoa(u.startxref))
+	fmt.Fprintf(&buf, "trailer\n%s\nstartxref\n%d\n%%%%EOF\n", trailer, xref)
+
+	return buf.Bytes()
+}
+
+// setPDFHeader writes the version into the file header of a PDF that has a
+// single cross-reference table, followed by the comment of high-bit bytes
+// that marks the file as binary. Offsets in the table are shifted to match.
+func setPDFHeader(data []byte, version string) ([]byte, error) {
+	end := bytes.IndexByte(data, '\n')
+	if end < 0 || !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, fmt.Errorf("PDF header not found")
+	}
+	header := []byte("%PDF-" + version + "\n%\xE2\xE3\xCF\xD3\n")
+	shift := len(header) - (end + 1)
+
+	match := trailerPattern.FindSubmatchIndex(data)
+	if match == nil {
+		return nil, fmt.Errorf("PDF trailer not found")
+	}
+	startxref, _ := strconv.Atoi(string(data[match[4]:match[5]]))
+	if startxref <= end || startxref >= match[0] {
+		return nil, fmt.Errorf("invalid startxref offset %d", startxref)
+	}
+
+	// Entries keep their fixed width, so only the offsets change
+	lines := strings.Split(string(data[startxref:match[0]]), "\n")
+	for i, line := range lines {
+		if entry := xrefEntryPattern.FindStringSubmatch(line); entry != nil && entry[3] == "n" {
+			offset, _ := strconv.Atoi(entry[1])
+			lines[i] = fmt.Sprintf("%010d", offset+shift) + line[10:]
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(header)
+	buf.Write(data[end+1 : startxref])
+	buf.WriteString(strings.Join(lines, "\n"))
+	buf.Write(data[match[0]:match[4]])
+	buf.WriteString(strconv.Itoa(startxref + shift))
+	buf.Write(data[match[5]:])
+	return buf.Bytes(), nil
+}
+
+// trailerInt reads an integer or the object number of a reference from a trailer
+func trailerInt(trailer, key string) int {
+	fields := strings.Fields(dictValue("<<"+trailer+">>", key))
+	if len(fields) == 0 {
+		return 0
+	}
+	n, _ := strconv.Atoi(fields[0])
+	return n
+}
+
+// dictValue returns the raw value of a top-level dictionary entry, or "" when absent
+func dictValue(dict, key string) string {
+	start, end := findDictEntry(dict, key)
+	if start < 0 {
+		return ""
+	}
+	return strings.TrimSpace(dict[start+len(key) : end])
+}
+
+// setDictValue replaces or appends a top-level dictionary entry
+func setDictValue(dict, key, value string) string {
+	if start, end := findDictEntry(dict, key); start >= 0 {
+		return dict[:start] + key + " " + value + dict[end:]
+	}
+
+	closing := strings.LastIndex(dict, ">>")
+	if closing < 0 {
+		return dict
+	}
+	return strings.TrimRight(dict[:closing], " \n") + "\n" + key + " " + value + "\n" + dict[closing:]
+}
+
+// deleteDictValue removes a top-level dictionary entry when present
+func deleteDictValue(dict, key string) string {
+	if start, end := findDictEntry(dict, key); start >= 0 {
+		return dict[:start] + dict[end:]
+	}
+	return dict
+}
+
+// findDictEntry locates a top-level entry of a dictionary, returning the
+// offset of its key and the end of its value, or -1 when absent
+func findDictEntry(dict, key string) (start, end int) {
+	i := strings.Index(dict, "<<")
+	if i < 0 {
+		return -1, -1
+	}
+	for i += 2; i < len(dict); {
+		for i < len(dict) && isPDFSpace(dict[i]) {
+			i++
+		}
+		if i >= len(dict) || dict[i] != '/' {
+			return -1, -1 // End of the dictionary
+		}
+
+		nameEnd := i + 1
+		for isNameChar(dict, nameEnd) {
+			nameEnd++
+		}
+		valueStop := valueEnd(dict, nameEnd)
+		if dict[i:nameEnd] == key {
+			return i, valueStop
+		}
+		i = valueStop
+	}
+	return -1, -1
+}
+
+// valueEnd returns the offset just past the value that starts after position i
+func valueEnd(dict string, i int) int {
+	for i < len(dict) && isPDFSpace(dict[i]) {
+		i++
+	}
+	if i >= len(dict) {
+		return i
+	}
+
+	switch {
+	case strings.HasPrefix(dict[i:], "<<"), dict[i] == '[':
+		depth := 0
+		for ; i < len(dict); i++ {
+			switch {
+			case strings.HasPrefix(dict[i:], "<<"):
+				depth++
+				i++
+			case strings.HasPrefix(dict[i:], ">>"):
+				depth--
+				i++
+			case dict[i] == '[':
+				depth++
+			case dict[i] == ']':
+				depth--
+			case dict[i] == '(':
+				i = skipPDFString(dict, i)
+			case dict[i] == '<':
+				i = skipHexString(dict, i)
+			}
+			if depth == 0 {
+				return i + 1
+			}
+		}
+		return len(dict)
+	case dict[i] == '(':
+		return min(skipPDFString(dict, i)+1, len(dict))
+	case dict[i] == '<':
+		return min(skipHexString(dict, i)+1, len(dict))
+	case dict[i] == '/':
+		i++
+		for isNameChar(dict, i) {
+			i++
+		}
+		return i
+	}
+
+	// A number, boolean or null, or an indirect reference such as "3 0 R"
+	end := i
+	for isNameChar(dict, end) {
+		end++
+	}
+	if ref := referencePattern.FindStringIndex(dict[i:]); ref != nil && ref[0] == 0 {
+		return i + ref[1]
+	}
+	return end
+}
+
+// isPDFSpace reports whether a byte is PDF white space
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t'
+}
+
+// skipPDFString returns the offset of the closing parenthesis of a literal string
+func skipPDFString(s string, i int) int {
+	depth := 0
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+// skipHexString returns the offset of the closing bracket of a hexadecimal string
+func skipHexString(s string, i int) int {
+	if end := strings.IndexByte(s[i:], '>'); end >= 0 {
+		return i + end
+	}
+	return len(s)
+}
+
+// isNameChar reports whether the byte at i continues a PDF name
+func isNameChar(s string, i int) bool {
+	if i >= len(s) {
+		return false
+	}
+	switch c := s[i]; c {
+	case ' ', '\n', '\r', '\t', '/', '<', '>', '[', ']', '(', ')':
+		return false
+	default:
+		return true
+	}
+}
+
+// sortedKeys returns map keys in a stable order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pdfString encodes text as a PDF literal string
+func pdfString(text string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`, "\r", `\r`).Replace(pdfTextString(text))
+	return "(" + escaped + ")"
+}
+
+// mapStrings replaces every string of an object body outside its stream data
+// with the hexadecimal string of fn applied to its bytes
+func mapStrings(body string, fn func([]byte) ([]byte, error)) (string, error) {
+	var buf strings.Builder
+	for i := 0; i < len(body); {
+		var raw []byte
+		end := i
+		switch {
+		case strings.HasPrefix(body[i:], "stream") && (i == 0 || isPDFSpace(body[i-1]) || body[i-1] == '>'):
+			buf.WriteString(body[i:]) // Stream data is not scanned
+			return buf.String(), nil
+		case body[i] == '/':
+			// Names may hold parentheses only as #28 and #29
+			for end = i + 1; isNameChar(body, end); end++ {
+			}
+			buf.WriteString(body[i:end])
+			i = end
+			continue
+		case body[i] == '(':
+			end = skipPDFString(body, i) + 1
+			raw = unescapePDFString(body[i+1 : max(end-1, i+1)])
+		case body[i] == '<' && !strings.HasPrefix(body[i:], "<<"):
+			end = strings.IndexByte(body[i:], '>')
+			if end < 0 {
+				end = len(body)
+			} else {
+				end += i + 1
+			}
+			raw = decodeHexString(body[i+1 : max(end-1, i+1)])
+		case strings.HasPrefix(body[i:], "<<"), strings.HasPrefix(body[i:], ">>"):
+			buf.WriteString(body[i : i+2])
+			i += 2
+			continue
+		default:
+			buf.WriteByte(body[i])
+			i++
+			continue
+		}
+
+		mapped, err := fn(raw)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&buf, "<%x>", mapped)
+		i = end
+	}
+	return buf.String(), nil
+}
+
+// unescapePDFString decodes the escape sequences of a literal string's content
+func unescapePDFString(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			out = append(out, s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case '\r':
+			// A backslash at the end of a line continues the string
+			if i+1 < len(s) && s[i+1] == '\n' {
+				i++
+			}
+		case '\n':
+		default:
+			if c >= '0' && c <= '7' {
+				value := 0
+				for j := 0; j < 3 && i < len(s) && s[i] >= '0' && s[i] <= '7'; j++ {
+					value = value*8 + int(s[i]-'0')
+					i++
+				}
+				i--
+				out = append(out, byte(value))
+			} else {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// decodeHexString decodes the content of a hexadecimal string, ignoring
+// white space and padding an odd final digit with zero
+func decodeHexString(s string) []byte {
+	var digits []byte
+	for i := 0; i < len(s); i++ {
+		if !isPDFSpace(s[i]) {
+			digits = append(digits, s[i])
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		value, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		out[i] = byte(value)
+	}
+	return out
+}
+
+// pdfName encodes text as a PDF name, escaping delimiters, white space and
+// bytes outside printable ASCII as #xx
+func pdfName(text string) string {
+	var buf strings.Builder
+	buf.WriteByte('/')
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c < '!' || c > '~' || strings.IndexByte("()<>[]{}/%#", c) >= 0 {
+			fmt.Fprintf(&buf, "#%02X", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
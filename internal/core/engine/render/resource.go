@@ -0,0 +1,441 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Register GIF decoding for embedded images
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/css"
+	"print-service/internal/core/engine/html"
+	"print-service/internal/core/engine/layout"
+	"print-service/internal/core/engine/svg"
+)
+
+// Limits on loading images
+const (
+	defaultImageTimeout = 10 * time.Second // Time allowed for all remote images when the request sets none
+	defaultMaxImageSize = 10 * 1024 * 1024 // Largest image loaded when the request sets no file size limit
+	maxImageRedirects   = 5                // Redirects followed for a remote image
+	defaultMaxPixels    = 50 * 1000 * 1000 // Largest width × height decoded when the service configures no limit
+	imageSourceLabelLen = 48               // Characters of a source quoted in warnings
+)
+
+// DecodeDataURI splits a data: URI into its media type and decoded payload
+func DecodeDataURI(uri string) (string, []byte, error) {
+	if !strings.HasPrefix(strings.ToLower(uri), "data:") {
+		return "", nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "not a data URI", domain.ErrInvalidURL)
+	}
+
+	header, payload, found := strings.Cut(uri[len("data:"):], ",")
+	if !found {
+		return "", nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "malformed data URI", domain.ErrInvalidURL)
+	}
+
+	params := strings.Split(header, ";")
+	mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+	if mediaType == "" {
+		mediaType = "text/plain"
+	}
+
+	isBase64 := false
+	for _, param := range params[1:] {
+		if strings.EqualFold(strings.TrimSpace(param), "base64") {
+			isBase64 = true
+		}
+	}
+
+	if isBase64 {
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(payload))
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to decode base64 data URI: %w", err)
+		}
+		return mediaType, data, nil
+	}
+
+	decoded, err := url.PathUnescape(payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode data URI: %w", err)
+	}
+	return mediaType, []byte(decoded), nil
+}
+
+// DecodeImageContent decodes raster image data and records its format and
+// intrinsic size. Decoding allocates every pixel, so images of more than
+// maxPixels pixels are refused from their header first; 0 applies a default.
+func DecodeImageContent(data []byte, maxPixels int64) (*ImageContent, image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "unsupported or corrupt image", domain.ErrImageNotFound).
+			WithDetail("error", err.Error())
+	}
+	if maxPixels <= 0 {
+		maxPixels = defaultMaxPixels
+	}
+	if int64(config.Width)*int64(config.Height) > maxPixels {
+		return nil, nil, domain.NewPrintError(domain.ErrCodeResourceLimit, "image has too many pixels", domain.ErrResourceTooLarge).
+			WithDetail("width", config.Width).
+			WithDetail("height", config.Height).
+			WithDetail("max_pixels", maxPixels)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "unsupported or corrupt image", domain.ErrImageNotFound).
+			WithDetail("error", err.Error())
+	}
+
+	bounds := img.Bounds()
+	return &ImageContent{
+		Data:   data,
+		Format: format,
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+	}, img, nil
+}
+
+// decodeSVGImage reads an SVG file into an image whose intrinsic size is
+// the size of its artwork in CSS pixels
+func decodeSVGImage(key string, data []byte) (*domain.Image, error) {
+	drawing, err := svg.Decode(data, layout.MatchingDeclarations)
+	if err != nil {
+		return nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "unsupported or corrupt image", domain.ErrImageNotFound).
+			WithDetail("error", err.Error())
+	}
+	return &domain.Image{
+		Key:     key,
+		Data:    data,
+		Format:  "svg",
+		Width:   max(1, int(math.Round(drawing.Width))),
+		Height:  max(1, int(math.Round(drawing.Height))),
+		Drawing: drawing,
+	}, nil
+}
+
+// ImageCache holds the images loaded for a document. Sources with the same
+// content share one image, so it is embedded only once.
+type ImageCache struct {
+	sources   map[string]*domain.Image // Loaded images by source
+	images    map[string]*domain.Image // Images by content hash
+	warnings  []string                 // Images that could not be loaded
+	maxPixels int64                    // Largest width × height decoded, 0 for the default
+}
+
+// NewImageCache creates an empty image cache decoding raster images of up
+// to maxPixels pixels, or a default limit when it is 0
+func NewImageCache(maxPixels int64) *ImageCache {
+	return &ImageCache{
+		sources:   make(map[string]*domain.Image),
+		images:    make(map[string]*domain.Image),
+		maxPixels: maxPixels,
+	}
+}
+
+// Image returns the image loaded from a source, or nil when it was not loaded
+func (c *ImageCache) Image(src string) *domain.Image {
+	if c == nil {
+		return nil
+	}
+	return c.sources[src]
+}
+
+// Add decodes the data loaded from a source, sharing the image of earlier
+// sources with the same content. SVG files are read into vector artwork.
+func (c *ImageCache) Add(src string, data []byte) (*domain.Image, error) {
+	sum := sha256.Sum256(data)
+	key := hex.EncodeToString(sum[:])
+	if img, ok := c.images[key]; ok {
+		c.sources[src] = img
+		return img, nil
+	}
+
+	content, decoded, err := DecodeImageContent(data, c.maxPixels)
+	if err != nil && !svg.IsSVG(data) {
+		return nil, err
+	}
+	var img *domain.Image
+	if err == nil {
+		img = &domain.Image{
+			Key:     key,
+			Data:    content.Data,
+			Format:  content.Format,
+			Width:   content.Width,
+			Height:  content.Height,
+			Decoded: decoded,
+		}
+	} else if img, err = decodeSVGImage(key, data); err != nil {
+		return nil, err
+	}
+	c.images[key] = img
+	c.sources[src] = img
+	return img, nil
+}
+
+// Warnings describes the images that could not be loaded
+func (c *ImageCache) Warnings() []string {
+	if c == nil {
+		return nil
+	}
+	return c.warnings
+}
+
+// LoadImages loads the images of a document: the sources of img elements
+// and the background images of its style sheet and style attributes. Data
+// URIs are decoded; http and https images are fetched only from hosts the
+// security options allow, and only when the request waits for images.
+// Images that cannot be loaded, or have more than maxPixels pixels, are left
+// out with a warning.
+func LoadImages(ctx context.Context, root *html.DOMNode, stylesheet *css.Stylesheet, options domain.PrintOptions, maxPixels int64) *ImageCache {
+	cache := NewImageCache(maxPixels)
+	loader := newImageLoader(options)
+
+	timeout := options.Layout.WaitTimeout
+	if timeout <= 0 {
+		timeout = defaultImageTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	failed := make(map[string]bool)
+	for _, src := range imageSources(root, stylesheet) {
+		if cache.Image(src) != nil || failed[src] {
+			continue
+		}
+		data, err := loader.load(ctx, src)
+		if err == nil {
+			_, err = cache.Add(src, data)
+		}
+		if err != nil {
+			failed[src] = true
+			cache.warnings = append(cache.warnings, fmt.Sprintf("image %s not loaded: %s", imageSourceLabel(src), loadFailure(err)))
+		}
+	}
+	return cache
+}
+
+// imageSources lists the image addresses a document refers to, in document
+// order after those of its style sheet
+func imageSources(root *html.DOMNode, stylesheet *css.Stylesheet) []string {
+	var sources []string
+	addBackgrounds := func(declarations []*css.Declaration) {
+		for _, decl := range declarations {
+			if strings.HasPrefix(strings.ToLower(decl.Property), "background") {
+				sources = append(sources, css.FindURLs(decl.Value)...)
+			}
+		}
+	}
+	if stylesheet != nil {
+		for _, rule := range stylesheet.Rules {
+			addBackgrounds(rule.Declarations)
+		}
+	}
+
+	parser := css.NewParser(false)
+	var walk func(node *html.DOMNode)
+	walk = func(node *html.DOMNode) {
+		if node.Type == html.ElementNode {
+			if src := strings.TrimSpace(node.Attributes["src"]); src != "" && strings.EqualFold(node.Data, "img") {
+				sources = append(sources, src)
+			}
+			if style := node.Attributes["style"]; style != "" {
+				if inline, err := parser.Parse("inline { " + style + " }"); err == nil && len(inline.Rules) > 0 {
+					addBackgrounds(inline.Rules[0].Declarations)
+				}
+			}
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	if root != nil {
+		walk(root)
+	}
+	return sources
+}
+
+// imageLoader reads image sources within the security options of a request
+type imageLoader struct {
+	security  domain.SecurityOptions
+	remote    bool // Remote images may be fetched
+	maxSize   int64
+	validator *html.URLValidator
+	client    *http.Client
+	address   func(ip net.IP) bool // Reports whether an address may be connected to
+}
+
+// newImageLoader creates a loader for the images of a request
+func newImageLoader(options domain.PrintOptions) *imageLoader {
+	l := &imageLoader{
+		security:  options.Security,
+		remote:    options.Layout.WaitForImages,
+		maxSize:   options.Security.MaxFileSize,
+		validator: html.NewURLValidator(),
+	}
+	if l.maxSize <= 0 {
+		l.maxSize = defaultMaxImageSize
+	}
+
+	l.address = isPublicAddress
+
+	// Every redirect must lead to an allowed host as well, and every
+	// connection to a public address, whatever the name resolved to before
+	dialer := &net.Dialer{
+		Timeout: defaultImageTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !l.address(ip) {
+				return domain.NewPrintError(domain.ErrCodeSecurity, "remote images cannot be loaded from private addresses", domain.ErrBlockedDomain).
+					WithDetail("address", host)
+			}
+			return nil
+		},
+	}
+	l.client = &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: defaultImageTimeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxImageRedirects {
+				return domain.NewPrintError(domain.ErrCodeSecurity, "too many redirects", domain.ErrInvalidURL)
+			}
+			return l.allow(req.Context(), req.URL)
+		},
+	}
+	return l
+}
+
+// load returns the encoded image data of a source
+func (l *imageLoader) load(ctx context.Context, src string) ([]byte, error) {
+	if strings.HasPrefix(strings.ToLower(src), "data:") {
+		mediaType, data, err := DecodeDataURI(src)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(mediaType, "image/") {
+			return nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "data URI is not an image", domain.ErrInvalidURL).
+				WithDetail("media_type", mediaType)
+		}
+		if int64(len(data)) > l.maxSize {
+			return nil, domain.NewPrintError(domain.ErrCodeResourceLimit, "image exceeds the maximum file size", domain.ErrResourceTooLarge).
+				WithDetail("max_file_size", l.maxSize)
+		}
+		return data, nil
+	}
+
+	parsed, err := url.Parse(src)
+	if err != nil || parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "only data URIs and http(s) URLs can be loaded", domain.ErrInvalidURL)
+	}
+	if !l.remote {
+		return nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "remote images are not loaded unless the request waits for images", domain.ErrResourceNotFound)
+	}
+	if err := l.allow(ctx, parsed); err != nil {
+		return nil, err
+	}
+	return l.fetch(ctx, parsed)
+}
+
+// allow checks a remote URL against the security options. Remote images are
+// only fetched from hosts listed in the allowed domains whose addresses are
+// all public.
+func (l *imageLoader) allow(ctx context.Context, u *url.URL) error {
+	host := u.Hostname()
+	if len(l.security.AllowedDomains) == 0 {
+		return domain.NewPrintError(domain.ErrCodeSecurity, "remote images need their host in the allowed domains", domain.ErrBlockedDomain).
+			WithDetail("host", host)
+	}
+	if err := l.validator.ValidateDomain(host, l.security); err != nil {
+		return domain.NewPrintError(domain.ErrCodeSecurity, err.Error(), domain.ErrBlockedDomain).
+			WithDetail("host", host)
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return domain.NewPrintError(domain.ErrCodeNotFound, "image host not found", domain.ErrResourceNotFound).
+			WithDetail("host", host)
+	}
+	for _, address := range addresses {
+		if !l.address(address.IP) {
+			return domain.NewPrintError(domain.ErrCodeSecurity, "remote images cannot be loaded from private addresses", domain.ErrBlockedDomain).
+				WithDetail("host", host)
+		}
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, private like those of RFC 1918
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicAddress reports whether an address is outside the loopback,
+// private, link-local and unspecified ranges a server must not be led to
+func isPublicAddress(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsUnspecified() && !sharedAddressSpace.Contains(ip)
+}
+
+// fetch downloads a remote image, refusing bodies larger than the size limit
+func (l *imageLoader) fetch(ctx context.Context, u *url.URL) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, domain.NewPrintError(domain.ErrCodeTimeout, "timed out loading image", domain.ErrResourceTimeout)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, domain.NewPrintError(domain.ErrCodeNotFound, fmt.Sprintf("server answered %s", resp.Status), domain.ErrResourceNotFound).
+			WithDetail("status", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, l.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > l.maxSize {
+		return nil, domain.NewPrintError(domain.ErrCodeResourceLimit, "image exceeds the maximum file size", domain.ErrResourceTooLarge).
+			WithDetail("max_file_size", l.maxSize)
+	}
+	return data, nil
+}
+
+// loadFailure describes why an image could not be loaded
+func loadFailure(err error) string {
+	var printErr *domain.PrintError
+	if errors.As(err, &printErr) {
+		return printErr.Message
+	}
+	return err.Error()
+}
+
+// imageSourceLabel shortens a source for messages, as data URIs can be long
+func imageSourceLabel(src string) string {
+	if len(src) <= imageSourceLabelLen {
+		return src
+	}
+	return src[:imageSourceLabelLen] + "..."
+}
@@ -0,0 +1,163 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+// testPNG encodes a blank grayscale image
+func testPNG(width, height int) []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)))
+	return buf.Bytes()
+}
+
+// claimedSizePNG returns a PNG whose header claims a size its data does not have
+func claimedSizePNG(width, height uint32) []byte {
+	data := testPNG(1, 1)
+	// The IHDR chunk follows the 8-byte signature: length, type, width, height, ...
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestDecodeImageContentPixelLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		maxPixels int64
+		wantErr   bool
+	}{
+		{"within limit", testPNG(100, 50), 5000, false},
+		{"over limit", testPNG(100, 51), 5000, true},
+		{"default limit", testPNG(100, 50), 0, false},
+		{"huge header", claimedSizePNG(100000, 100000), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, _, err := DecodeImageContent(tt.data, tt.maxPixels)
+			if tt.wantErr {
+				var printErr *domain.PrintError
+				if !errors.As(err, &printErr) || !errors.Is(err, domain.ErrResourceTooLarge) {
+					t.Errorf("DecodeImageContent() error = %v, want a resource limit error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeImageContent() error = %v", err)
+			}
+			if content.Width != 100 || content.Height != 50 || content.Format != "png" {
+				t.Errorf("DecodeImageContent() = %dx%d %s, want 100x50 png", content.Width, content.Height, content.Format)
+			}
+		})
+	}
+}
+
+func TestImageCacheAppliesPixelLimit(t *testing.T) {
+	cache := NewImageCache(100)
+	if _, err := cache.Add("small", testPNG(10, 10)); err != nil {
+		t.Errorf("Add() of a 10x10 image error = %v", err)
+	}
+	if _, err := cache.Add("large", testPNG(10, 11)); err == nil {
+		t.Error("Add() of a 10x11 image succeeded, want an error")
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := isPublicAddress(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("isPublicAddress(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageLoaderRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testPNG(1, 1))
+	}))
+	defer server.Close()
+
+	options := domain.PrintOptions{}
+	options.Layout.WaitForImages = true
+	options.Security.AllowedDomains = []string{"127.0.0.1"}
+	loader := newImageLoader(options)
+
+	// The host is allowed by name, but resolves to a loopback address
+	_, err := loader.load(context.Background(), server.URL+"/logo.png")
+	if !errors.Is(err, domain.ErrBlockedDomain) {
+		t.Errorf("load() error = %v, want a blocked domain error", err)
+	}
+
+	// A host that passes the check when resolved is still refused when connecting
+	checked := 0
+	loader.address = func(ip net.IP) bool {
+		checked++
+		return checked == 1
+	}
+	_, err = loader.load(context.Background(), server.URL+"/logo.png")
+	if !errors.Is(err, domain.ErrBlockedDomain) {
+		t.Errorf("load() error = %v, want the connection refused", err)
+	}
+}
+
+func TestImageLoaderChecksRedirects(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/logo.png":
+			w.Write(testPNG(1, 1))
+		case "/moved":
+			http.Redirect(w, r, server.URL+"/logo.png", http.StatusFound)
+		case "/elsewhere":
+			address, _ := url.Parse(server.URL)
+			http.Redirect(w, r, "http://localhost:"+address.Port()+"/logo.png", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	options := domain.PrintOptions{}
+	options.Layout.WaitForImages = true
+	options.Security.AllowedDomains = []string{"127.0.0.1"}
+	loader := newImageLoader(options)
+	loader.address = func(net.IP) bool { return true } // The test server listens on loopback
+
+	if _, err := loader.load(context.Background(), server.URL+"/moved"); err != nil {
+		t.Errorf("load() of a redirect to an allowed host error = %v", err)
+	}
+	if _, err := loader.load(context.Background(), server.URL+"/elsewhere"); !errors.Is(err, domain.ErrBlockedDomain) {
+		t.Errorf("load() of a redirect to another host error = %v, want a blocked domain error", err)
+	}
+}
@@ -0,0 +1,116 @@
+package render
+
+import (
+	"fmt"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/layout"
+)
+
+// standalone numbers the pages of a document that is not part of another
+var standalone layout.PageNumbering
+
+// layoutMargins lays out the headers and footers of every page once the
+// page count is known, with the page numbers numbering gives them
+func layoutMargins(running *layout.RunningContent, pages int, numbering layout.PageNumbering) ([][]layout.MarginBox, error) {
+	margins := make([][]layout.MarginBox, pages)
+	for i := range margins {
+		boxes, err := running.Layout(numbering.Page(i+1), numbering.Pages(pages))
+		if err != nil {
+			return nil, fmt.Errorf("failed to lay out headers and footers of page %d: %w", i+1, err)
+		}
+		margins[i] = boxes
+	}
+	return margins, nil
+}
+
+// marginRoots returns the root boxes of the headers and footers of every page
+func marginRoots(margins [][]layout.MarginBox) []*domain.LayoutNode {
+	var roots []*domain.LayoutNode
+	for _, boxes := range margins {
+		for _, box := range boxes {
+			roots = append(roots, box.Nodes[0])
+		}
+	}
+	return roots
+}
+
+// marginBand returns the top and height in mm of the page margin running
+// content is drawn in
+func marginBand(edge layout.MarginEdge, page PageGeometry) (top, height float64) {
+	if edge == layout.MarginBottom {
+		return page.Height - page.Margins.Bottom, page.Margins.Bottom
+	}
+	return 0, page.Margins.Top
+}
+
+// marginOrigin returns the top-left corner in mm running content is drawn
+// from: the left edge of the content area, centred vertically in its margin
+func marginOrigin(box layout.MarginBox, page PageGeometry) (x, y float64) {
+	top, height := marginBand(box.Edge, page)
+	return page.Margins.Left, top + max(height-PixelsToMM(box.Height)*page.Scale, 0)/2
+}
+
+// renderMargins draws the headers and footers of a page as pagination
+// artifacts, each clipped to its margin
+func (r *PDFRenderer) renderMargins(boxes []layout.MarginBox, page PageGeometry, ctx RenderContext) error {
+	pdf, tags := ctx.PDF, ctx.Tags
+	ctx.Tags = nil // Running content is not part of the document structure
+	for _, box := range boxes {
+		top, height := marginBand(box.Edge, page)
+		ctx.OriginX, ctx.OriginY = marginOrigin(box, page)
+
+		tags.BeginPagination(pdf, box.Edge)
+		pdf.ClipRect(0, top, page.Width, height, false)
+		for _, node := range box.Nodes {
+			if err := r.renderLayoutNode(node, ctx); err != nil {
+				return err
+			}
+		}
+		pdf.ClipEnd()
+		tags.End(pdf)
+	}
+	return nil
+}
+
+// renderMargins draws the headers and footers of a page, each clipped to its margin
+func (r *ImageRenderer) renderMargins(boxes []layout.MarginBox, page PageGeometry, ctx ImageRenderContext) error {
+	mmToDevice := ctx.DPI / mmPerInch
+	for _, box := range boxes {
+		top, height := marginBand(box.Edge, page)
+		x, y := marginOrigin(box, page)
+		ctx.OriginX, ctx.OriginY = x*mmToDevice, y*mmToDevice
+
+		ctx.Canvas.DrawRectangle(0, top*mmToDevice, float64(ctx.Width), height*mmToDevice)
+		ctx.Canvas.Clip()
+		for _, node := range box.Nodes {
+			if err := r.renderLayoutNode(node, ctx); err != nil {
+				return err
+			}
+		}
+		ctx.Canvas.ResetClip()
+	}
+	return nil
+}
+
+// renderMargins draws the headers and footers of a page, each clipped to its margin
+func (r *SVGRenderer) renderMargins(boxes []layout.MarginBox, page PageGeometry, ctx SVGRenderContext) error {
+	b := ctx.Builder
+	for i, box := range boxes {
+		top, height := marginBand(box.Edge, page)
+		x, y := marginOrigin(box, page)
+		ctx.OriginX, ctx.OriginY = MMToPixels(x), MMToPixels(y)
+
+		clipID := fmt.Sprintf("margin-%d-%d", ctx.PageNumber, i)
+		fmt.Fprintf(b, `<defs><clipPath id="%s"><rect x="0" y="%s" width="%s" height="%s"/></clipPath></defs>`+"\n",
+			clipID, ctx.Num(MMToPixels(top)), ctx.Num(ctx.Width), ctx.Num(MMToPixels(height)))
+		fmt.Fprintf(b, `<g clip-path="url(#%s)">`+"\n", clipID)
+		for _, node := range box.Nodes {
+			if err := r.renderLayoutNode(node, ctx); err != nil {
+				return err
+			}
+		}
+		b.WriteString("</g>\n")
+	}
+	return nil
+}
@@ -0,0 +1,610 @@
+package render
+
+import (
+	"slices"
+	"unicode"
+
+	"print-service/internal/core/engine/layout"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Text in the Arabic, Hebrew and Indic scripts is shaped with the GSUB and
+// GPOS tables of faces that have them: glyphs are substituted following the
+// joining forms of Arabic letters or the syllables of Indic scripts, then
+// kerned and marks are attached to their bases. Other text, and text drawn
+// with faces without those tables, is drawn character by character.
+
+// shapedGlyph is a glyph of a shaped run
+type shapedGlyph struct {
+	id   uint16
+	x, y int    // Origin from the start of the run on the baseline, in font units
+	text string // Characters the glyph stands for
+}
+
+// shapedRun is a run of text shaped with a face's layout tables, in drawing order
+type shapedRun struct {
+	glyphs     []shapedGlyph
+	advance    int    // Width of the run in font units
+	unitsPerEm int    // Font units per em of the face
+	text       string // Characters of the run in logical order
+}
+
+// Kinds of shaping
+const (
+	shapeDefault = iota
+	shapeArabic
+	shapeIndic
+)
+
+// otScript is a script shaped with the font's layout tables
+type otScript struct {
+	tags  []string     // OpenType script tags, the current shaping model first
+	kind  int          // Shaping applied to its text
+	indic *indicScript // Syllable structure of Indic scripts
+}
+
+// indicScript describes the syllables of an Indic script. Its letters sit
+// at the same offsets in each script's block.
+type indicScript struct {
+	block    rune   // First code point of the block
+	preBase  []rune // Offsets of the matras drawn before the consonants they follow
+	rephLast bool   // The reph goes to the end of the syllable rather than after the base
+}
+
+// Offsets of the letters in an Indic block
+const (
+	indicRa     = 0x30
+	indicNukta  = 0x3C
+	indicHalant = 0x4D
+)
+
+var (
+	arabicScript = &otScript{tags: []string{"arab"}, kind: shapeArabic}
+	hebrewScript = &otScript{tags: []string{"hebr"}}
+
+	// indicScripts lists the scripts of the blocks from U+0900 in order
+	indicScripts = []*otScript{
+		{tags: []string{"dev2", "deva"}, kind: shapeIndic, indic: &indicScript{block: 0x0900, preBase: []rune{0x3F, 0x4E}, rephLast: true}},
+		{tags: []string{"bng2", "beng"}, kind: shapeIndic, indic: &indicScript{block: 0x0980, preBase: []rune{0x3F, 0x47, 0x48}}},
+		{tags: []string{"gur2", "guru"}, kind: shapeIndic, indic: &indicScript{block: 0x0A00, preBase: []rune{0x3F}, rephLast: true}},
+		{tags: []string{"gjr2", "gujr"}, kind: shapeIndic, indic: &indicScript{block: 0x0A80, preBase: []rune{0x3F}, rephLast: true}},
+		{tags: []string{"ory2", "orya"}, kind: shapeIndic, indic: &indicScript{block: 0x0B00, preBase: []rune{0x47}}},
+		{tags: []string{"tml2", "taml"}, kind: shapeIndic, indic: &indicScript{block: 0x0B80, preBase: []rune{0x46, 0x47, 0x48}, rephLast: true}},
+		{tags: []string{"tel2", "telu"}, kind: shapeIndic, indic: &indicScript{block: 0x0C00, rephLast: true}},
+		{tags: []string{"knd2", "knda"}, kind: shapeIndic, indic: &indicScript{block: 0x0C80, rephLast: true}},
+		{tags: []string{"mlm2", "mlym"}, kind: shapeIndic, indic: &indicScript{block: 0x0D00, preBase: []rune{0x46, 0x47, 0x48}}},
+	}
+)
+
+// scriptOf returns the script a character is shaped as, nil for scripts
+// drawn without layout tables. ok is false for characters such as spaces
+// and punctuation that take the script of the text around them.
+func scriptOf(r rune) (script *otScript, ok bool) {
+	switch {
+	case r >= 0x0600 && r <= 0x06FF, r >= 0x0750 && r <= 0x077F, r >= 0x08A0 && r <= 0x08FF,
+		r >= 0xFB50 && r <= 0xFDFF, r >= 0xFE70 && r <= 0xFEFF:
+		return arabicScript, true
+	case r >= 0x0590 && r <= 0x05FF, r >= 0xFB1D && r <= 0xFB4F:
+		return hebrewScript, true
+	case r >= 0x0900 && r <= 0x0D7F:
+		return indicScripts[(r-0x0900)/0x80], true
+	case unicode.In(r, unicode.Common, unicode.Inherited):
+		return nil, false
+	}
+	return nil, true
+}
+
+// isJoiner reports whether a character is a zero width joiner or non-joiner
+func isJoiner(r rune) bool {
+	return r == 0x200C || r == 0x200D
+}
+
+// textPiece is a piece of a directional run drawn with one face
+type textPiece struct {
+	face   int       // Position of the face in the font chain
+	text   []rune    // Characters in logical order
+	script *otScript // Script shaped with the face's layout tables, nil when drawn by character
+}
+
+// splitPieces breaks a directional run into pieces drawn with the same face
+// and, for faces with layout tables, the same script. covers reports
+// whether a face has a glyph for a character, shapes whether it has layout
+// tables; characters no face covers are recorded in missing.
+func splitPieces(text []rune, faces int, covers func(face int, r rune) bool, shapes func(face int) bool, missing map[rune]bool) []textPiece {
+	// Characters without a script of their own take the one before them,
+	// or at the start of the run the one after
+	scripts := make([]*otScript, len(text))
+	decided := make([]bool, len(text))
+	for i, r := range text {
+		scripts[i], decided[i] = scriptOf(r)
+		if !decided[i] && i > 0 {
+			scripts[i], decided[i] = scripts[i-1], decided[i-1]
+		}
+	}
+	for i := len(text) - 2; i >= 0; i-- {
+		if !decided[i] {
+			scripts[i], decided[i] = scripts[i+1], decided[i+1]
+		}
+	}
+
+	var pieces []textPiece
+	current := -1
+	for i, r := range text {
+		// Stay in the current face while it covers the text so runs are not
+		// split needlessly; joiners only matter to the text around them
+		index := -1
+		if current >= 0 && (covers(current, r) || isJoiner(r)) {
+			index = current
+		} else {
+			for face := 0; face < faces; face++ {
+				if covers(face, r) {
+					index = face
+					break
+				}
+			}
+		}
+		if index < 0 {
+			missing[r] = true
+			index = max(current, 0)
+		}
+		current = index
+
+		var script *otScript
+		if shapes(index) {
+			script = scripts[i]
+		}
+		if n := len(pieces); n > 0 && pieces[n-1].face == index && pieces[n-1].script == script {
+			pieces[n-1].text = append(pieces[n-1].text, r)
+		} else {
+			pieces = append(pieces, textPiece{face: index, text: []rune{r}, script: script})
+		}
+	}
+	return pieces
+}
+
+// Feature masks. Every glyph has the global bit; the others select the
+// glyphs a positional feature applies to.
+const (
+	maskGlobal uint32 = 1 << iota
+	maskIsol
+	maskFina
+	maskMedi
+	maskInit
+	maskRphf
+	maskHalf
+	maskBlwf
+	maskPstf
+	maskPref
+	maskAbvf
+)
+
+// featureMasks lists the positional features by tag
+var featureMasks = map[string]uint32{
+	"isol": maskIsol, "fina": maskFina, "medi": maskMedi, "init": maskInit,
+	"rphf": maskRphf, "half": maskHalf, "blwf": maskBlwf, "pstf": maskPstf, "pref": maskPref, "abvf": maskAbvf,
+}
+
+// Substitution stages of each kind of shaping. Features of a stage are
+// applied together in lookup order; stages are applied one after the other.
+var (
+	defaultStages = [][]string{{"ccmp", "locl", "rlig", "calt", "clig", "liga", "rclt"}}
+	arabicStages  = [][]string{{"ccmp", "locl"}, {"isol"}, {"fina"}, {"medi"}, {"init"}, {"rlig"}, {"calt"}, {"liga", "clig", "mset"}}
+	indicStages   = [][]string{{"locl", "ccmp"}, {"nukt"}, {"akhn"}, {"rphf"}, {"rkrf"}, {"pref"}, {"blwf"}, {"abvf"},
+		{"half"}, {"pstf"}, {"vatu"}, {"cjct"}, {"pres", "abvs", "blws", "psts", "haln", "calt", "clig"}}
+	positioning = []string{"kern", "mark", "mkmk", "dist", "abvm", "blwm"}
+)
+
+// otPlan is the lookups a face applies to the text of a script
+type otPlan struct {
+	gsub, gpos otData
+	stages     [][]otLookup
+	positions  []otLookup
+}
+
+// plan returns the lookups applied to a script, building them on first use
+func (f *otFont) plan(script *otScript) *otPlan {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.plans[script]; ok {
+		return p
+	}
+
+	stages := defaultStages
+	switch script.kind {
+	case shapeArabic:
+		stages = arabicStages
+	case shapeIndic:
+		stages = indicStages
+	}
+	features := func(tags []string) []otFeature {
+		selected := make([]otFeature, len(tags))
+		for i, tag := range tags {
+			selected[i] = otFeature{tag: tag, mask: maskGlobal}
+			if mask, ok := featureMasks[tag]; ok {
+				selected[i].mask = mask
+			}
+		}
+		return selected
+	}
+
+	tags := append(slices.Clone(script.tags), "DFLT", "latn")
+	p := &otPlan{gsub: f.gsub, gpos: f.gpos}
+	gsubLang, gposLang := langSys(f.gsub, tags...), langSys(f.gpos, tags...)
+	for _, stage := range stages {
+		p.stages = append(p.stages, lookups(f.gsub, gsubLang, features(stage)))
+	}
+	p.positions = lookups(f.gpos, gposLang, features(positioning))
+	if f.plans == nil {
+		f.plans = make(map[*otScript]*otPlan)
+	}
+	f.plans[script] = p
+	return p
+}
+
+// substitute applies the substitution stages to glyphs
+func (p *otPlan) substitute(f *otFont, glyphs []otGlyph, rtl bool) []otGlyph {
+	for _, stage := range p.stages {
+		glyphs = newOTApplier(f, p.gsub, false, rtl, glyphs).apply(stage)
+	}
+	return glyphs
+}
+
+// wouldSubstitute reports whether a positional feature replaces a sequence of glyphs
+func (p *otPlan) wouldSubstitute(f *otFont, mask uint32, ids ...uint16) bool {
+	glyphs := make([]otGlyph, len(ids))
+	for i, id := range ids {
+		glyphs[i] = otGlyph{id: id, mask: mask}
+	}
+	for _, stage := range p.stages {
+		var selected []otLookup
+		for _, l := range stage {
+			if l.mask&mask != 0 {
+				selected = append(selected, l)
+			}
+		}
+		glyphs = newOTApplier(f, p.gsub, false, false, glyphs).apply(selected)
+	}
+	if len(glyphs) != len(ids) {
+		return true
+	}
+	for i := range glyphs {
+		if glyphs[i].id != ids[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// shape shapes a piece of text in logical order with the face's layout tables
+func (f *otFont) shape(text []rune, script *otScript, rtl bool) shapedRun {
+	p := f.plan(script)
+
+	var glyphs []otGlyph
+	switch script.kind {
+	case shapeIndic:
+		glyphs = f.shapeIndic(p, text, script.indic)
+	case shapeArabic:
+		forms := layout.JoiningForms(text)
+		glyphs = f.glyphs(text)
+		for i := range glyphs {
+			glyphs[i].mask |= [...]uint32{0, maskIsol, maskFina, maskInit, maskMedi}[forms[i]]
+		}
+		glyphs = p.substitute(f, glyphs, rtl)
+	default:
+		glyphs = p.substitute(f, f.glyphs(text), rtl)
+	}
+
+	// Joiners have done their work and are not drawn
+	glyphs = slices.DeleteFunc(glyphs, func(g otGlyph) bool {
+		r := text[g.cluster]
+		return isJoiner(r) && g.id == f.cmap[r]
+	})
+
+	for i := range glyphs {
+		glyphs[i].advance = f.advance(glyphs[i].id)
+	}
+	glyphs = newOTApplier(f, p.gpos, true, rtl, glyphs).apply(p.positions)
+
+	// Marks take no room unless positioned otherwise; Indic fonts space their marks themselves
+	if script.kind != shapeIndic {
+		for i := range glyphs {
+			if f.glyphClassOf(glyphs[i].id) == glyphClassMark && glyphs[i].advance == f.advance(glyphs[i].id) {
+				glyphs[i].advance = 0
+			}
+		}
+	}
+
+	return f.place(glyphs, text, rtl)
+}
+
+// glyphs maps characters to their nominal glyphs
+func (f *otFont) glyphs(text []rune) []otGlyph {
+	glyphs := make([]otGlyph, len(text))
+	for i, r := range text {
+		glyphs[i] = otGlyph{id: f.cmap[r], cluster: i, mask: maskGlobal}
+	}
+	return glyphs
+}
+
+// place lays out positioned glyphs from left to right, attaching marks to
+// their bases, and records the characters each glyph stands for
+func (f *otFont) place(glyphs []otGlyph, text []rune, rtl bool) shapedRun {
+	order := make([]int, len(glyphs))
+	for i := range order {
+		order[i] = i
+	}
+	if rtl {
+		slices.Reverse(order)
+	}
+
+	pen := make([]int, len(glyphs))
+	advance := 0
+	for _, i := range order {
+		pen[i] = advance
+		advance += glyphs[i].advance
+	}
+
+	// Attached marks sit relative to their base, which may itself be attached
+	var origin func(i, depth int) (int, int)
+	origin = func(i, depth int) (int, int) {
+		g := glyphs[i]
+		if g.attach == 0 || g.attach-1 >= len(glyphs) || depth > otMaxNesting {
+			return pen[i] + g.x, g.y
+		}
+		x, y := origin(g.attach-1, depth+1)
+		return x + g.x, y + g.y
+	}
+
+	// Each glyph stands for the characters from its cluster to the next one
+	starts := make([]int, 0, len(glyphs)+1)
+	for _, g := range glyphs {
+		starts = append(starts, g.cluster)
+	}
+	starts = append(starts, len(text))
+	slices.Sort(starts)
+	starts = slices.Compact(starts)
+
+	run := shapedRun{glyphs: make([]shapedGlyph, 0, len(glyphs)), advance: advance, unitsPerEm: f.unitsPerEm, text: string(text)}
+	for _, i := range order {
+		x, y := origin(i, 0)
+		cluster := glyphs[i].cluster
+		end, _ := slices.BinarySearch(starts, cluster+1)
+		run.glyphs = append(run.glyphs, shapedGlyph{id: glyphs[i].id, x: x, y: y, text: string(text[cluster:starts[end]])})
+	}
+	return run
+}
+
+// Roles of the characters of an Indic syllable
+const (
+	roleOther = iota
+	roleReph
+	rolePreBase
+	roleBase
+	rolePostBase
+	rolePreMatra
+)
+
+// indicClass classifies the characters of Indic syllables
+type indicClass int
+
+const (
+	indicOther indicClass = iota
+	indicConsonant
+	indicVowel
+	indicNuktaSign
+	indicHalantSign
+	indicMatra
+	indicModifier
+	indicJoiner
+)
+
+// classify returns the class of a character in an Indic syllable
+func (s *indicScript) classify(r rune) indicClass {
+	if isJoiner(r) {
+		return indicJoiner
+	}
+	offset := r - s.block
+	if offset < 0 || offset >= 0x80 {
+		return indicOther
+	}
+	switch {
+	case offset <= 0x03:
+		return indicModifier
+	case offset == indicNukta:
+		return indicNuktaSign
+	case offset == indicHalant:
+		return indicHalantSign
+	case offset >= 0x04 && offset <= 0x14, offset == 0x60, offset == 0x61:
+		return indicVowel
+	case unicode.In(r, unicode.Mn, unicode.Mc):
+		return indicMatra
+	case unicode.IsLetter(r) && offset != 0x3D && offset != 0x50:
+		return indicConsonant
+	}
+	return indicOther
+}
+
+// decompose splits two-part matras into their parts, which are drawn on
+// either side of the consonant, and returns the index of the original
+// character each comes from
+func (s *indicScript) decompose(text []rune) ([]rune, []int) {
+	runes := make([]rune, 0, len(text))
+	sources := make([]int, 0, len(text))
+	for i, r := range text {
+		parts := []rune(norm.NFD.String(string(r)))
+		if s.classify(r) != indicMatra || len(parts) < 2 {
+			parts = []rune{r}
+		}
+		for _, part := range parts {
+			runes = append(runes, part)
+			sources = append(sources, i)
+		}
+	}
+	return runes, sources
+}
+
+// syllableEnd returns the end of the syllable starting at i: consonants
+// joined by halants, an independent vowel, or any other single character,
+// followed by their matras and modifiers
+func (s *indicScript) syllableEnd(text []rune, i int) int {
+	class := func(j int) indicClass {
+		if j < len(text) {
+			return s.classify(text[j])
+		}
+		return indicOther
+	}
+
+	switch class(i) {
+	case indicConsonant:
+		i++
+		for class(i) == indicNuktaSign {
+			i++
+		}
+		for class(i) == indicHalantSign {
+			next := i + 1
+			if class(next) == indicJoiner {
+				next++
+			}
+			if class(next) != indicConsonant {
+				i = next
+				break
+			}
+			for i = next + 1; class(i) == indicNuktaSign; i++ {
+			}
+		}
+	case indicVowel:
+		for i++; class(i) == indicNuktaSign; i++ {
+		}
+	default:
+		return i + 1
+	}
+
+	for c := class(i); c == indicMatra || c == indicNuktaSign || c == indicHalantSign || c == indicJoiner; c = class(i) {
+		i++
+	}
+	for class(i) == indicModifier {
+		i++
+	}
+	return i
+}
+
+// shapeIndic shapes Indic text syllable by syllable: the base consonant of
+// each is found, pre-base matras are moved before the consonants, the
+// substitution stages are applied with the positional features of each
+// glyph, and the reph is moved after the base
+func (f *otFont) shapeIndic(p *otPlan, text []rune, s *indicScript) []otGlyph {
+	runes, sources := s.decompose(text)
+	var glyphs []otGlyph
+	for start := 0; start < len(runes); {
+		end := s.syllableEnd(runes, start)
+		syllable := make([]otGlyph, end-start)
+		for i := range syllable {
+			r := runes[start+i]
+			syllable[i] = otGlyph{id: f.cmap[r], cluster: sources[start], mask: maskGlobal}
+		}
+		if s.classify(runes[start]) == indicConsonant {
+			syllable = f.reorderSyllable(p, s, runes[start:end], syllable)
+		}
+		glyphs = append(glyphs, f.finishSyllable(s, p.substitute(f, syllable, false))...)
+		start = end
+	}
+	return glyphs
+}
+
+// reorderSyllable assigns the roles and positional features of a consonant
+// syllable and moves its pre-base matras before the consonants
+func (f *otFont) reorderSyllable(p *otPlan, s *indicScript, runes []rune, glyphs []otGlyph) []otGlyph {
+	var consonants []int
+	for i, r := range runes {
+		if s.classify(r) == indicConsonant {
+			consonants = append(consonants, i)
+		}
+	}
+	ra, halant := f.cmap[s.block+indicRa], f.cmap[s.block+indicHalant]
+
+	// A leading ra and halant before another consonant form a reph
+	reph := len(consonants) > 1 && len(runes) > 2 && runes[0] == s.block+indicRa && runes[1] == s.block+indicHalant &&
+		s.classify(runes[2]) != indicJoiner && p.wouldSubstitute(f, maskRphf, ra, halant)
+	first := 0
+	if reph {
+		first = 1
+	}
+
+	// The base is the last consonant without a below- or post-base form
+	base := len(consonants) - 1
+	for base > first {
+		c := consonants[base]
+		if runes[c-1] != s.block+indicHalant || !(p.wouldSubstitute(f, maskBlwf|maskPstf, halant, glyphs[c].id) ||
+			p.wouldSubstitute(f, maskBlwf|maskPstf, glyphs[c].id, halant)) {
+			break
+		}
+		base--
+	}
+	if base < first {
+		base = first
+	}
+	basePos := consonants[base]
+
+	for i := range glyphs {
+		switch {
+		case reph && i < 2:
+			glyphs[i].mask |= maskRphf
+			glyphs[i].role = roleReph
+		case i < basePos:
+			glyphs[i].mask |= maskHalf | maskBlwf
+			glyphs[i].role = rolePreBase
+		case i == basePos:
+			glyphs[i].role = roleBase
+		case slices.Contains(s.preBase, runes[i]-s.block) && s.classify(runes[i]) == indicMatra:
+			glyphs[i].role = rolePreMatra
+		default:
+			glyphs[i].mask |= maskBlwf | maskAbvf | maskPstf | maskPref
+			glyphs[i].role = rolePostBase
+		}
+	}
+
+	// Pre-base matras move before the consonants, after a reph
+	at := 0
+	if reph {
+		at = 2
+	}
+	for i := range glyphs {
+		if glyphs[i].role == rolePreMatra && i > at {
+			matra := glyphs[i]
+			copy(glyphs[at+1:i+1], glyphs[at:i])
+			glyphs[at] = matra
+			at++
+		}
+	}
+
+	// The syllable is a single cluster so its characters stay together
+	for i := range glyphs {
+		glyphs[i].cluster = glyphs[0].cluster
+	}
+	return glyphs
+}
+
+// finishSyllable moves a reph formed by substitution after the base, or to
+// the end of the syllable before its modifiers
+func (f *otFont) finishSyllable(s *indicScript, glyphs []otGlyph) []otGlyph {
+	if len(glyphs) < 2 || glyphs[0].role != roleReph || glyphs[1].role == roleReph {
+		return glyphs
+	}
+	reph := glyphs[0]
+	rest := slices.Clone(glyphs[1:])
+
+	at := len(rest)
+	if s.rephLast {
+		for at > 0 && rest[at-1].role == roleOther {
+			at--
+		}
+	} else {
+		for i, g := range rest {
+			if g.role == roleBase {
+				at = i + 1
+			}
+		}
+	}
+	return slices.Insert(rest, at, reph)
+}
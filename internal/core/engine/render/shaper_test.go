@@ -0,0 +1,442 @@
+package render
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+
+	"print-service/internal/core/domain"
+)
+
+// otNode is a table of a test font: 16-bit values, four-letter tags and
+// 16-bit offsets to other tables, which are written after it
+type otNode []any
+
+// bytes serializes a table followed by the tables it points to
+func (n otNode) bytes() []byte {
+	size := 0
+	for _, item := range n {
+		if tag, ok := item.(string); ok {
+			size += len(tag)
+		} else {
+			size += 2
+		}
+	}
+	header := make([]byte, 0, size)
+	var children []byte
+	for _, item := range n {
+		switch v := item.(type) {
+		case string:
+			header = append(header, v...)
+		case int:
+			header = binary.BigEndian.AppendUint16(header, uint16(v))
+		case otNode:
+			if v == nil {
+				header = binary.BigEndian.AppendUint16(header, 0)
+				continue
+			}
+			header = binary.BigEndian.AppendUint16(header, uint16(size+len(children)))
+			children = append(children, v.bytes()...)
+		}
+	}
+	return append(header, children...)
+}
+
+// testCoverage builds a coverage table of glyphs
+func testCoverage(glyphs ...int) otNode {
+	slices.Sort(glyphs)
+	node := otNode{1, len(glyphs)}
+	for _, g := range glyphs {
+		node = append(node, g)
+	}
+	return node
+}
+
+// testSingle builds a single substitution lookup from a map of glyphs
+func testSingle(substitutes map[int]int) otNode {
+	var from []int
+	for g := range substitutes {
+		from = append(from, g)
+	}
+	slices.Sort(from)
+	sub := otNode{2, testCoverage(from...), len(from)}
+	for _, g := range from {
+		sub = append(sub, substitutes[g])
+	}
+	return otNode{1, 0, 1, sub}
+}
+
+// testLigature builds a ligature substitution lookup forming ligature from
+// any of the first glyphs followed by the rest
+func testLigature(ligature int, first []int, rest ...int) otNode {
+	rule := otNode{ligature, len(rest) + 1}
+	for _, g := range rest {
+		rule = append(rule, g)
+	}
+	first = slices.Sorted(slices.Values(first))
+	sub := otNode{1, testCoverage(first...), len(first)}
+	for range first {
+		sub = append(sub, otNode{1, rule})
+	}
+	return otNode{4, 0, 1, sub}
+}
+
+// testLayoutTable builds a GSUB or GPOS table where scripts enable features
+// by tag, each feature applying one lookup
+func testLayoutTable(lookups []otNode, features []string, scripts map[string][]int) []byte {
+	var tags []string
+	for tag := range scripts {
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	scriptList := otNode{len(tags)}
+	for _, tag := range tags {
+		lang := otNode{0, 0xFFFF, len(scripts[tag])}
+		for _, feature := range scripts[tag] {
+			lang = append(lang, feature)
+		}
+		scriptList = append(scriptList, tag, otNode{lang, 0})
+	}
+	featureList := otNode{len(features)}
+	for i, tag := range features {
+		featureList = append(featureList, tag, otNode{0, 1, i})
+	}
+	lookupList := otNode{len(lookups)}
+	for _, lookup := range lookups {
+		lookupList = append(lookupList, lookup)
+	}
+	return otNode{1, 0, scriptList, featureList, lookupList}.bytes()
+}
+
+// testCmap builds a cmap table with a format 4 subtable, one segment per character
+func testCmap(mapping map[rune]uint16) []byte {
+	var chars []rune
+	for r := range mapping {
+		if r < 0xFFFF {
+			chars = append(chars, r)
+		}
+	}
+	slices.Sort(chars)
+	segments := len(chars) + 1
+
+	var ends, starts, deltas []int
+	for _, r := range chars {
+		ends = append(ends, int(r))
+		starts = append(starts, int(r))
+		deltas = append(deltas, int(mapping[r])-int(r))
+	}
+	ends, starts, deltas = append(ends, 0xFFFF), append(starts, 0xFFFF), append(deltas, 1)
+
+	sub := otNode{4, 16 + 8*segments, 0, 2 * segments, 0, 0, 0}
+	for _, v := range ends {
+		sub = append(sub, v)
+	}
+	sub = append(sub, 0)
+	for _, v := range starts {
+		sub = append(sub, v)
+	}
+	for _, v := range deltas {
+		sub = append(sub, v)
+	}
+	for range segments {
+		sub = append(sub, 0)
+	}
+	data := sub.bytes()
+	header := otNode{0, 1, 3, 1}.bytes()
+	header = binary.BigEndian.AppendUint32(header, 12)
+	return append(header, data...)
+}
+
+// Characters of the shaping test font and the Latin glyphs that stand in
+// for their forms
+const (
+	testBeh    = 'ب'
+	testLam    = 'ل'
+	testAlef   = 'ا'
+	testAlefHe = 'א'
+	testBet    = 'ב'
+	testQamats = 'ָ'
+	testKa     = 'क'
+	testRa     = 'र'
+	testHalant = '्'
+	testSignI  = 'ि'
+)
+
+// testShapingFont returns the Go regular face with Arabic, Hebrew and
+// Devanagari characters mapped to Latin glyphs, and layout tables that
+// substitute and position them as other Latin glyphs
+func testShapingFont(t *testing.T) []byte {
+	t.Helper()
+	tables := make(map[string][]byte)
+	for tag, data := range fontTables(goregular.TTF) {
+		tables[tag] = data
+	}
+	mapping := parseCmap(tables["cmap"])
+	g := func(r rune) int { return int(mapping[r]) }
+	for r, latin := range map[rune]rune{
+		testBeh: 'b', testLam: 'l', testAlef: 'a', testAlefHe: 'x', testBet: 'y', testQamats: '^',
+		testKa: 'k', testRa: 'r', testHalant: 'h', testSignI: 'i',
+	} {
+		mapping[r] = mapping[latin]
+	}
+	tables["cmap"] = testCmap(mapping)
+
+	tables["GSUB"] = testLayoutTable([]otNode{
+		testSingle(map[int]int{g('b'): g('B'), g('l'): g('L')}),                 // init
+		testSingle(map[int]int{g('b'): g('M'), g('l'): g('N')}),                 // medi
+		testSingle(map[int]int{g('b'): g('F'), g('l'): g('E'), g('a'): g('A')}), // fina
+		testLigature(g('&'), []int{g('L'), g('N')}, g('A')),                     // rlig
+		testLigature(g('R'), []int{g('r')}, g('h')),                             // rphf
+		testLigature(g('K'), []int{g('k')}, g('h')),                             // half
+	}, []string{"init", "medi", "fina", "rlig", "rphf", "half"}, map[string][]int{
+		"arab": {0, 1, 2, 3},
+		"dev2": {4, 5},
+	})
+
+	kern := otNode{1, testCoverage(g('x')), 4, 0, 1, otNode{1, g('y'), -100}}
+	mark := otNode{1, testCoverage(g('^')), testCoverage(g('x')), 1,
+		otNode{1, 0, otNode{1, 0, 0}},
+		otNode{1, otNode{1, 300, 500}}}
+	tables["GPOS"] = testLayoutTable([]otNode{{2, 0, 1, kern}, {4, 0, 1, mark}},
+		[]string{"kern", "mark"}, map[string][]int{"hebr": {0, 1}})
+
+	tables["GDEF"] = otNode{1, 0, otNode{2, 1, g('^'), g('^'), glyphClassMark}, 0, 0, 0}.bytes()
+	return assembleFont(tables)
+}
+
+// testShapingFonts returns a font manager with the shaping test font
+// registered as the family "Go"
+func testShapingFonts(t *testing.T) *FontManager {
+	t.Helper()
+	fm := NewFontManager()
+	if _, err := fm.Register("Shaping.ttf", testShapingFont(t)); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	return fm
+}
+
+// glyphIDs returns the glyphs of a shaped run
+func glyphIDs(run shapedRun) []uint16 {
+	ids := make([]uint16, len(run.glyphs))
+	for i, g := range run.glyphs {
+		ids[i] = g.id
+	}
+	return ids
+}
+
+func TestOTFontShapesArabic(t *testing.T) {
+	f := parseOTFont(testShapingFont(t))
+	g := func(r rune) uint16 { return f.cmap[r] }
+	tests := []struct {
+		name string
+		text string
+		want []uint16 // In drawing order, from the left
+	}{
+		{"isolated", "ب", []uint16{g('b')}},
+		{"joined", "ببب", []uint16{g('F'), g('M'), g('B')}},
+		{"lam alef", "بلا", []uint16{g('&'), g('B')}},
+		{"after non-joining", "اب", []uint16{g('b'), g('a')}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := f.shape([]rune(tt.text), arabicScript, true)
+			if got := glyphIDs(run); !slices.Equal(got, tt.want) {
+				t.Errorf("shape(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+
+	run := f.shape([]rune("بلا"), arabicScript, true)
+	if run.glyphs[0].text != "لا" || run.glyphs[1].text != "ب" {
+		t.Errorf("glyphs stand for %q and %q, want the ligature then the beh", run.glyphs[0].text, run.glyphs[1].text)
+	}
+	if want := f.advance(g('&')) + f.advance(g('B')); run.advance != want || run.glyphs[1].x != f.advance(g('&')) {
+		t.Errorf("run advance = %d with beh at %d, want %d after the ligature", run.advance, run.glyphs[1].x, want)
+	}
+}
+
+func TestOTFontPositionsHebrew(t *testing.T) {
+	f := parseOTFont(testShapingFont(t))
+	g := func(r rune) uint16 { return f.cmap[r] }
+
+	// The pair is kerned; right to left the first letter is drawn last
+	run := f.shape([]rune("אב"), hebrewScript, true)
+	if got, want := glyphIDs(run), []uint16{g('y'), g('x')}; !slices.Equal(got, want) {
+		t.Fatalf("shape() = %v, want %v", got, want)
+	}
+	if want := f.advance(g('x')) + f.advance(g('y')) - 100; run.advance != want {
+		t.Errorf("kerned advance = %d, want %d", run.advance, want)
+	}
+
+	// The mark takes no room and sits on the anchor of its base
+	run = f.shape([]rune("אָ"), hebrewScript, true)
+	if run.advance != f.advance(g('x')) {
+		t.Errorf("advance with mark = %d, want the base's %d", run.advance, f.advance(g('x')))
+	}
+	for _, glyph := range run.glyphs {
+		if glyph.id == g('^') && (glyph.x != 300 || glyph.y != 500) {
+			t.Errorf("mark at (%d, %d), want the base anchor (300, 500)", glyph.x, glyph.y)
+		}
+	}
+}
+
+func TestOTFontShapesDevanagari(t *testing.T) {
+	f := parseOTFont(testShapingFont(t))
+	g := func(r rune) uint16 { return f.cmap[r] }
+	tests := []struct {
+		name string
+		text string
+		want []uint16
+	}{
+		{"pre-base matra", "कि", []uint16{g('i'), g('k')}},
+		{"half form", "क्क", []uint16{g('K'), g('k')}},
+		{"reph", "र्क", []uint16{g('k'), g('R')}},
+		{"reph and matra", "र्कि", []uint16{g('i'), g('k'), g('R')}},
+		{"syllables", "किक", []uint16{g('i'), g('k'), g('k')}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := f.shape([]rune(tt.text), indicScripts[0], false)
+			if got := glyphIDs(run); !slices.Equal(got, tt.want) {
+				t.Errorf("shape(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOTFontWithoutLayoutTables(t *testing.T) {
+	// Faces without layout tables keep being drawn character by character
+	if f := parseOTFont(goregular.TTF); f != nil {
+		t.Error("parseOTFont() of a face without GSUB or GPOS is not nil")
+	}
+}
+
+func TestSplitPieces(t *testing.T) {
+	covers := func(face int, r rune) bool { return face == 1 || r < 0x80 }
+	shapes := func(face int) bool { return face == 1 }
+	missing := make(map[rune]bool)
+	pieces := splitPieces([]rune("ab بب، c"), 2, covers, shapes, missing)
+
+	var got []string
+	for _, p := range pieces {
+		script := "-"
+		if p.script != nil {
+			script = p.script.tags[0]
+		}
+		got = append(got, fmt.Sprintf("%d:%s:%s", p.face, script, string(p.text)))
+	}
+	want := []string{"0:-:ab ", "1:arab:بب، ", "1:-:c"}
+	if !slices.Equal(got, want) {
+		t.Errorf("splitPieces() = %q, want %q", got, want)
+	}
+	if len(missing) != 0 {
+		t.Errorf("missing = %v, want none", missing)
+	}
+}
+
+func TestPDFRendererShapesWithFontTables(t *testing.T) {
+	fm := testShapingFonts(t)
+	output := renderTestPDF(t, `<p style="font-family: Go">بلا ok</p>`, domain.DefaultPrintOptions(),
+		PDFRenderOptions{EmbedFonts: true, Fonts: fm})
+
+	info, _ := fm.Resolve("Go", 400, "normal")
+	f := fm.shaper(info)
+	file, pages := testPages(t, output.Data)
+	content := testPageContent(t, file, pages[0])
+
+	// The shaped glyphs are shown by ID with the glyph font, marked with their text
+	ligature, initial := f.cmap['&'], f.cmap['B']
+	if shown := fmt.Sprintf("<%04X%04X> Tj", ligature, initial); !strings.Contains(content, shown) {
+		t.Errorf("content does not show the shaped glyphs %s:\n%s", shown, content)
+	}
+	if !strings.Contains(content, "/GF1 ") || !strings.Contains(content, "/ActualText "+pdfString("بلا")) {
+		t.Errorf("shaped run is not drawn with its glyph font and text:\n%s", content)
+	}
+	// Registered faces show UTF-16 text
+	if got := strings.ReplaceAll(strings.Join(shownText(content), "|"), "\x00", ""); !strings.Contains(got, "ok") {
+		t.Errorf("Latin text %q is not drawn as text", got)
+	}
+
+	data := string(output.Data)
+	for _, want := range []string{"/Subtype /Type0", "/Encoding /Identity-H", "/CIDToGIDMap /Identity", "/FontFile2"} {
+		if !strings.Contains(data, want) {
+			t.Errorf("glyph font has no %s", want)
+		}
+	}
+
+	// Text extraction maps the ligature to both letters and the initial form to its letter
+	var toUnicode string
+	for num := 1; num < 200; num++ {
+		body, err := file.Object(num)
+		if err == nil && strings.Contains(body, "/Type0") {
+			ref, _ := referenceTo(dictValue(body, "/ToUnicode"))
+			toUnicode += testStream(t, file, ref)
+		}
+	}
+	for _, want := range []string{fmt.Sprintf("<%04X> <06440627>", ligature), fmt.Sprintf("<%04X> <0628>", initial)} {
+		if !strings.Contains(toUnicode, want) {
+			t.Errorf("ToUnicode has no %s:\n%s", want, toUnicode)
+		}
+	}
+}
+
+func TestSubsetFontKeepsUsedGlyphs(t *testing.T) {
+	f := parseOTFont(testShapingFont(t))
+	used := map[uint16]bool{0: true, f.cmap['a']: true}
+	subset, err := subsetFont(testShapingFont(t), used)
+	if err != nil {
+		t.Fatalf("subsetFont() error = %v", err)
+	}
+	if len(subset) >= len(goregular.TTF) {
+		t.Errorf("subset is %d bytes, want less than the %d of the face", len(subset), len(goregular.TTF))
+	}
+
+	parsed, err := truetype.Parse(subset)
+	if err != nil {
+		t.Fatalf("subset cannot be parsed: %v", err)
+	}
+	var buf truetype.GlyphBuf
+	scale := parsed.FUnitsPerEm()
+	for _, tt := range []struct {
+		glyph    uint16
+		outlined bool
+	}{{f.cmap['a'], true}, {f.cmap['b'], false}} {
+		if err := buf.Load(parsed, fixed.Int26_6(scale<<6), truetype.Index(tt.glyph), font.HintingNone); err != nil {
+			t.Fatalf("glyph %d cannot be loaded: %v", tt.glyph, err)
+		}
+		if (len(buf.Points) > 0) != tt.outlined {
+			t.Errorf("glyph %d has %d points, want outline %v", tt.glyph, len(buf.Points), tt.outlined)
+		}
+	}
+}
+
+func TestImageRendererDrawsShapedGlyphs(t *testing.T) {
+	fm := testShapingFonts(t)
+	renderer := NewImageRenderer(ImageRenderOptions{Antialias: true, ColorSpace: ColorSpaceRGB, Fonts: fm})
+	ink := func(c color.NRGBA) bool { return c.R < 128 }
+
+	// A shaped glyph covers about as many pixels as the same glyph drawn as text
+	draw := func(text string) int {
+		canvas := gg.NewContext(200, 100)
+		canvas.SetRGB(1, 1, 1)
+		canvas.Clear()
+		canvas.SetRGB(0, 0, 0)
+		ctx := ImageRenderContext{Canvas: canvas, DPI: 96, Scale: 1, Missing: make(map[rune]bool)}
+		runs := renderer.shapeLine(text, domain.DirectionLTR, renderer.faceChain(domain.FontStyle{Family: "Go", Weight: 400}, 48, ctx), ctx)
+		renderer.drawRuns(runs, 10, 80, ctx)
+		return countPixels(canvas.Image(), ink)
+	}
+	shaped, plain := draw("ب"), draw("b")
+	if plain == 0 || shaped < plain*8/10 || shaped > plain*12/10 {
+		t.Errorf("shaped glyph covers %d pixels, want about the %d of the same glyph drawn as text", shaped, plain)
+	}
+}
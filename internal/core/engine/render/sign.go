@@ -0,0 +1,492 @@
+package render
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/layout"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+// signatureFieldAttribute marks the element a visible signature is drawn in
+const signatureFieldAttribute = "data-signature-field"
+
+// signatureProfile is the signature level written by the renderer
+const signatureProfile = "PAdES-B-B"
+
+// Signature widget layout
+const (
+	signatureLineSpacing = 1.2 // Line height as a multiple of the font size
+	signaturePadding     = 1.0 // Inset of the text from the field edge, in mm
+	signatureWidgetFlags = 132 // Print and Locked
+)
+
+// byteRangePlaceholder reserves room for the signed byte ranges, which are
+// only known once the file is complete
+const byteRangePlaceholder = "/ByteRange [0 0000000000 0000000000 0000000000]"
+
+// Object identifiers of the CMS signature
+var (
+	oidData                 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidSHA256               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256      = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// Signer signs PDF output with an X.509 certificate and its private key
+type Signer struct {
+	key   crypto.Signer
+	chain []*x509.Certificate // Signing certificate first, then the other certificates supplied
+}
+
+// LoadSigner reads the signing certificate and private key from PEM files,
+// or from a PKCS#12 bundle when certFile is not PEM. keyFile may be empty
+// when certFile holds the key.
+func LoadSigner(certFile, keyFile, password string) (*Signer, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing certificate: %w", err)
+	}
+	var blocks []*pem.Block
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		blocks = decodePEMBlocks(data)
+	} else if blocks, err = pkcs12.ToPEM(data, password); err != nil {
+		var unsupported pkcs12.NotImplementedError
+		if errors.As(err, &unsupported) {
+			return nil, fmt.Errorf("unsupported PKCS#12 bundle, export it with the legacy algorithms or as PEM: %w", err)
+		}
+		return nil, fmt.Errorf("failed to read PKCS#12 bundle: %w", err)
+	}
+	if keyFile != "" {
+		keyData, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+		blocks = append(blocks, decodePEMBlocks(keyData)...)
+	}
+
+	signer := &Signer{}
+	for _, block := range blocks {
+		switch {
+		case block.Type == "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("invalid signing certificate: %w", err)
+			}
+			signer.chain = append(signer.chain, cert)
+		case strings.HasSuffix(block.Type, "PRIVATE KEY") && signer.key == nil:
+			if signer.key, err = parsePrivateKey(block.Bytes); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(signer.chain) == 0 {
+		return nil, fmt.Errorf("no signing certificate found")
+	}
+	if signer.key == nil {
+		return nil, fmt.Errorf("no signing key found")
+	}
+
+	// The signing certificate is the one holding the public half of the key
+	for i, cert := range signer.chain {
+		if public, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); ok && public.Equal(signer.key.Public()) {
+			signer.chain[0], signer.chain[i] = signer.chain[i], signer.chain[0]
+			return signer, nil
+		}
+	}
+	return nil, fmt.Errorf("no certificate matches the signing key")
+}
+
+// decodePEMBlocks returns every PEM block of a file
+func decodePEMBlocks(data []byte) []*pem.Block {
+	var blocks []*pem.Block
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			return blocks
+		}
+		blocks = append(blocks, block)
+	}
+}
+
+// parsePrivateKey reads an RSA or ECDSA key in PKCS#8, PKCS#1 or SEC 1 form
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	var key any
+	var err error
+	if key, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(der); err != nil {
+			if key, err = x509.ParseECPrivateKey(der); err != nil {
+				return nil, fmt.Errorf("unsupported signing key format")
+			}
+		}
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("signing key must be RSA or ECDSA, not %T", key)
+}
+
+// Name returns the common name of the signing certificate, or its full subject
+func (s *Signer) Name() string {
+	if name := s.chain[0].Subject.CommonName; name != "" {
+		return name
+	}
+	return s.chain[0].Subject.String()
+}
+
+// reserve returns the number of bytes set aside for the CMS signature
+func (s *Signer) reserve() int {
+	size := 2048 // Attributes, signature value and structure
+	for _, cert := range s.chain {
+		size += len(cert.Raw)
+	}
+	return size
+}
+
+// cmsAttribute is a signed attribute of a CMS signer
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// cmsIssuerAndSerial identifies the signing certificate
+type cmsIssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+// cmsSignerInfo carries the signature of one signer
+type cmsSignerInfo struct {
+	Version            int
+	SID                cmsIssuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+// cmsEncapsulatedContent names the type of the detached content
+type cmsEncapsulatedContent struct {
+	ContentType asn1.ObjectIdentifier
+}
+
+// cmsSignedData is the CMS SignedData structure of a detached signature
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo cmsEncapsulatedContent
+	Certificates     asn1.RawValue
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+// cmsContentInfo wraps the signed data
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+// essCertIDv2 identifies a certificate by its SHA-256 hash, the default algorithm
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+// signingCertificateV2 binds the signature to the signing certificate
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// signCMS returns a detached CAdES signature over content with the given
+// SHA-256 digest, with the signed attributes PAdES-B-B requires. The signing
+// time is recorded in the signature dictionary instead, as PAdES asks.
+func (s *Signer) signCMS(digest []byte) ([]byte, error) {
+	cert := s.chain[0]
+	certHash := sha256.Sum256(cert.Raw)
+
+	var attributes [][]byte
+	for _, attr := range []struct {
+		oid   asn1.ObjectIdentifier
+		value any
+	}{
+		{oidContentType, oidData},
+		{oidMessageDigest, digest},
+		{oidSigningCertificateV2, signingCertificateV2{Certs: []essCertIDv2{{CertHash: certHash[:]}}}},
+	} {
+		value, err := asn1.Marshal(attr.value)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := asn1.Marshal(cmsAttribute{
+			Type:   attr.oid,
+			Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: value},
+		})
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, encoded)
+	}
+	// DER orders the members of a SET OF by their encoding
+	sort.Slice(attributes, func(i, j int) bool { return bytes.Compare(attributes[i], attributes[j]) < 0 })
+	signedAttrs := bytes.Join(attributes, nil)
+
+	// The signature covers the attributes encoded as a SET
+	set, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: signedAttrs})
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(set)
+	signature, err := s.key.Sign(rand.Reader, hash[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	algorithm := pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+	if _, ok := s.key.(*ecdsa.PrivateKey); ok {
+		algorithm = pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	}
+
+	var certificates []byte
+	for _, c := range s.chain {
+		certificates = append(certificates, c.Raw...)
+	}
+	signedData, err := asn1.Marshal(cmsSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: cmsEncapsulatedContent{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificates},
+		SignerInfos: []cmsSignerInfo{{
+			Version:            1,
+			SID:                cmsIssuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, Serial: cert.SerialNumber},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedAttrs},
+			SignatureAlgorithm: algorithm,
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+}
+
+// pdfSignature adds a signature field to a rendered PDF and signs the
+// finished file
+type pdfSignature struct {
+	signer   *Signer
+	request  domain.Signature
+	signedAt time.Time
+	field    string             // Field name
+	node     *domain.LayoutNode // Element showing the signature, nil for an invisible signature
+	page     int                // 1-based page of the widget
+	rect     [4]float64         // Widget rectangle in points, set when the page is drawn
+}
+
+// newPDFSignature resolves the field a signature is shown in. Signatures are
+// invisible when requested so or when the document has no signature field.
+func newPDFSignature(signer *Signer, request domain.Signature, root *domain.LayoutNode, pageBreaks []*layout.PageBreak, pageBreaker *layout.PageBreaker, signedAt time.Time) (*pdfSignature, error) {
+	sig := &pdfSignature{signer: signer, request: request, signedAt: signedAt, field: request.Field, page: 1}
+	if !request.Invisible {
+		sig.node = findSignatureField(root, request.Field)
+		if sig.node == nil && request.Field != "" {
+			return nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "signature field not found", domain.ErrInvalidDocument).
+				WithDetail("field", request.Field)
+		}
+	}
+	if sig.node != nil {
+		sig.field = sig.node.Attributes[signatureFieldAttribute]
+		sig.page = pageBreaker.GetPageForY(pageBreaks, sig.node.Box.Y)
+	}
+	if sig.field == "" {
+		sig.field = "Signature1"
+	}
+	return sig, nil
+}
+
+// findSignatureField returns the first element marked as the named
+// signature field, or as any signature field when name is empty
+func findSignatureField(node *domain.LayoutNode, name string) *domain.LayoutNode {
+	if node == nil {
+		return nil
+	}
+	if field, ok := node.Attributes[signatureFieldAttribute]; ok && (name == "" || field == name) {
+		return node
+	}
+	for _, child := range node.Children {
+		if found := findSignatureField(child, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Lines returns the text shown in a visible signature
+func (s *pdfSignature) Lines() []string {
+	lines := []string{
+		"Digitally signed by " + s.signer.Name(),
+		"Date: " + s.signedAt.Format("2006-01-02 15:04:05 -07:00"),
+	}
+	if s.request.Reason != "" {
+		lines = append(lines, "Reason: "+s.request.Reason)
+	}
+	if s.request.Location != "" {
+		lines = append(lines, "Location: "+s.request.Location)
+	}
+	return lines
+}
+
+// renderSignature draws the signer and signing time inside the element of a
+// visible signature and records where its widget goes. The widget itself has
+// an empty appearance so the text uses the document fonts.
+func (r *PDFRenderer) renderSignature(sig *pdfSignature, ctx RenderContext) {
+	if sig == nil || sig.node == nil || sig.page != ctx.CurrentPage {
+		return
+	}
+	x, y, w, h := ctx.ToPage(sig.node.Box)
+	k := ctx.PDF.GetConversionRatio()
+	sig.rect = [4]float64{x * k, (ctx.PageHeight - y - h) * k, (x + w) * k, (ctx.PageHeight - y) * k}
+
+	// Shrink the text when the field is too short for every line
+	lines := sig.Lines()
+	style := sig.node.Style
+	size := PixelsToPoints(style.Font.Size) * ctx.Scale
+	if fit := (h - 2*signaturePadding) / float64(len(lines)) / signatureLineSpacing * pointsPerInch / mmPerInch; size <= 0 || size > fit {
+		size = math.Max(fit, 1)
+	}
+	lineHeight := size * signatureLineSpacing * mmPerInch / pointsPerInch
+
+	ctx.Tags.BeginArtifact(ctx.PDF)
+	defer ctx.Tags.End(ctx.PDF)
+	ctx.SetFill(style.Color)
+	chain := r.fontChain(style.Font, ctx)
+	for i, line := range lines {
+		runs := r.shapeLine(line, r.textEngine.DetectDirection(line), chain, ctx)
+		r.drawRuns(runs, x+signaturePadding, y+signaturePadding+lineHeight*(float64(i)+0.8), size, ctx)
+	}
+}
+
+// Write adds the signature field, its widget and the signature dictionary,
+// with room for the signature value
+func (s *pdfSignature) Write(update *pdfUpdate) error {
+	pages, err := update.Pages()
+	if err != nil {
+		return err
+	}
+	if s.page < 1 || s.page > len(pages) {
+		return fmt.Errorf("signature field page %d does not exist", s.page)
+	}
+	page := pages[s.page-1]
+
+	entries := fmt.Sprintf("/Type /Sig /Filter /Adobe.PPKLite /SubFilter /ETSI.CAdES.detached %s /Contents <%s> /M %s /Name %s",
+		byteRangePlaceholder, strings.Repeat("0", 2*s.signer.reserve()), pdfString(pdfDate(s.signedAt)), pdfString(s.signer.Name()))
+	if s.request.Reason != "" {
+		entries += " /Reason " + pdfString(s.request.Reason)
+	}
+	if s.request.Location != "" {
+		entries += " /Location " + pdfString(s.request.Location)
+	}
+	if s.request.ContactInfo != "" {
+		entries += " /ContactInfo " + pdfString(s.request.ContactInfo)
+	}
+	value := update.Add("<<" + entries + ">>")
+
+	// The field and its widget share one dictionary
+	width, height := s.rect[2]-s.rect[0], s.rect[3]-s.rect[1]
+	appearance := update.AddStream(fmt.Sprintf("/Type /XObject /Subtype /Form /BBox [0 0 %.2f %.2f]", width, height), nil)
+	widget := update.Add(fmt.Sprintf("<</Type /Annot /Subtype /Widget /FT /Sig /T %s /TU %s /V %d 0 R /F %d /Rect [%.2f %.2f %.2f %.2f] /P %d 0 R /AP <</N %d 0 R>>>>",
+		pdfString(s.field), pdfString("Digital signature"), value, signatureWidgetFlags,
+		s.rect[0], s.rect[1], s.rect[2], s.rect[3], page, appearance))
+	if err := update.AppendToArray(page, "/Annots", fmt.Sprintf("%d 0 R", widget)); err != nil {
+		return err
+	}
+
+	form, err := acroForm(update)
+	if err != nil {
+		return err
+	}
+	if err := update.AppendToArray(form, "/Fields", fmt.Sprintf("%d 0 R", widget)); err != nil {
+		return err
+	}
+	if err := update.SetEntries(form, map[string]string{"/SigFlags": "3"}); err != nil {
+		return err
+	}
+	// CAdES signatures are an extension of PDF 1.7
+	return addExtension(update, "/ESIC", "1.7", 2)
+}
+
+// Sign fills in the byte ranges and the signature value of a finished PDF
+func (s *pdfSignature) Sign(data []byte) ([]byte, error) {
+	start := bytes.LastIndex(data, []byte(byteRangePlaceholder))
+	if start < 0 {
+		return nil, fmt.Errorf("signature dictionary not found")
+	}
+	offset := bytes.Index(data[start:], []byte("/Contents <"))
+	if offset < 0 {
+		return nil, fmt.Errorf("signature contents not found")
+	}
+	open := start + offset + len("/Contents ")
+	end := bytes.IndexByte(data[open:], '>')
+	if end < 0 {
+		return nil, fmt.Errorf("signature contents not terminated")
+	}
+	end += open + 1
+
+	// Everything but the signature value itself is signed
+	out := append([]byte(nil), data...)
+	byteRange := fmt.Sprintf("/ByteRange [0 %d %d %d]", open, end, len(out)-end)
+	copy(out[start:], byteRange+strings.Repeat(" ", len(byteRangePlaceholder)-len(byteRange)))
+	h := sha256.New()
+	h.Write(out[:open])
+	h.Write(out[end:])
+
+	cms, err := s.signer.signCMS(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	value := hex.EncodeToString(cms)
+	if len(value) > end-open-2 {
+		return nil, fmt.Errorf("signature of %d bytes exceeds the reserved space", len(cms))
+	}
+	copy(out[open+1:], value)
+	return out, nil
+}
+
+// Info describes the signature for the render result
+func (s *pdfSignature) Info() *domain.SignatureInfo {
+	cert := s.signer.chain[0]
+	return &domain.SignatureInfo{
+		Signer:   cert.Subject.String(),
+		Issuer:   cert.Issuer.String(),
+		Serial:   cert.SerialNumber.Text(16),
+		SignedAt: s.signedAt,
+		Field:    s.field,
+		Visible:  s.node != nil,
+		Profile:  signatureProfile,
+	}
+}
@@ -0,0 +1,187 @@
+package render
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"print-service/internal/core/domain"
+)
+
+// writeTestCertificate writes a self-signed certificate for key and the key
+// itself as PEM files, returning their paths
+func writeTestCertificate(t *testing.T, key crypto.Signer, name string) (certFile, keyFile string) {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"Print Service"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestLoadSigner(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	certFile, keyFile := writeTestCertificate(t, key, "Signer")
+	_, otherKeyFile := writeTestCertificate(t, other, "Other")
+
+	signer, err := LoadSigner(certFile, keyFile, "")
+	if err != nil {
+		t.Fatalf("LoadSigner() error = %v", err)
+	}
+	if signer.Name() != "Signer" {
+		t.Errorf("Name() = %q, want %q", signer.Name(), "Signer")
+	}
+	if _, err := LoadSigner(certFile, otherKeyFile, ""); err == nil {
+		t.Error("LoadSigner() accepted a key that does not match the certificate")
+	}
+	if _, err := LoadSigner(certFile, "", ""); err == nil {
+		t.Error("LoadSigner() succeeded without a key")
+	}
+}
+
+// byteRangePattern matches the byte ranges of a signed file
+var byteRangePattern = regexp.MustCompile(`/ByteRange \[(\d+) (\d+) (\d+) (\d+)\]`)
+
+func TestPDFSignatureSign(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tests := []struct {
+		name      string
+		key       crypto.Signer
+		algorithm x509.SignatureAlgorithm
+	}{
+		{"RSA", rsaKey, x509.SHA256WithRSA},
+		{"ECDSA", ecKey, x509.ECDSAWithSHA256},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certFile, keyFile := writeTestCertificate(t, tt.key, "Signer")
+			signer, err := LoadSigner(certFile, keyFile, "")
+			if err != nil {
+				t.Fatalf("LoadSigner() error = %v", err)
+			}
+			update, err := newPDFUpdate(testPDF{objects: encryptedTestObjects}.classic(""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig := &pdfSignature{signer: signer, request: domain.Signature{Reason: "Approval"}, signedAt: time.Now(), field: "Signature1", page: 1}
+			if err := sig.Write(update); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			data := update.Bytes()
+			signed, err := sig.Sign(data)
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			if len(signed) != len(data) {
+				t.Errorf("Sign() changed the file size from %d to %d", len(data), len(signed))
+			}
+
+			// The ranges cover the whole file except the /Contents string
+			match := byteRangePattern.FindSubmatch(signed)
+			if match == nil {
+				t.Fatal("signed file has no /ByteRange")
+			}
+			var ranges [4]int
+			for i := range ranges {
+				ranges[i], _ = strconv.Atoi(string(match[i+1]))
+			}
+			if ranges[0] != 0 || ranges[2]+ranges[3] != len(signed) || ranges[1] >= ranges[2] {
+				t.Fatalf("/ByteRange = %v does not cover a file of %d bytes", ranges, len(signed))
+			}
+			contents := signed[ranges[1]:ranges[2]]
+			if contents[0] != '<' || contents[len(contents)-1] != '>' {
+				t.Fatalf("/ByteRange gap is %.20q..., want the /Contents string", contents)
+			}
+			if want := 2*signer.reserve() + 2; len(contents) != want {
+				t.Errorf("/Contents has %d bytes, want %d", len(contents), want)
+			}
+
+			// The signature is DER followed by zero padding
+			der, err := hex.DecodeString(string(contents[1 : len(contents)-1]))
+			if err != nil {
+				t.Fatalf("/Contents is not hexadecimal: %v", err)
+			}
+			var info cmsContentInfo
+			rest, err := asn1.Unmarshal(der, &info)
+			if err != nil {
+				t.Fatalf("/Contents is not a CMS structure: %v", err)
+			}
+			if len(bytes.Trim(rest, "\x00")) != 0 {
+				t.Error("/Contents has data after the CMS structure")
+			}
+			var signedData cmsSignedData
+			if _, err := asn1.Unmarshal(info.Content.Bytes, &signedData); err != nil {
+				t.Fatalf("invalid SignedData: %v", err)
+			}
+			if !info.ContentType.Equal(oidSignedData) || len(signedData.SignerInfos) != 1 {
+				t.Fatalf("CMS structure is not signed data with one signer")
+			}
+			certs, err := x509.ParseCertificates(signedData.Certificates.Bytes)
+			if err != nil || len(certs) != 1 || !certs[0].Equal(signer.chain[0]) {
+				t.Fatalf("certificates = %v, %v, want the signing certificate", certs, err)
+			}
+
+			// The message digest attribute is the hash of the signed ranges
+			signerInfo := signedData.SignerInfos[0]
+			h := sha256.New()
+			h.Write(signed[ranges[0] : ranges[0]+ranges[1]])
+			h.Write(signed[ranges[2] : ranges[2]+ranges[3]])
+			var digest []byte
+			for attrs := signerInfo.SignedAttrs.Bytes; len(attrs) > 0; {
+				var attr cmsAttribute
+				if attrs, err = asn1.Unmarshal(attrs, &attr); err != nil {
+					t.Fatalf("invalid signed attribute: %v", err)
+				}
+				if attr.Type.Equal(oidMessageDigest) {
+					asn1.Unmarshal(attr.Values.Bytes, &digest)
+				}
+			}
+			if !bytes.Equal(digest, h.Sum(nil)) {
+				t.Errorf("messageDigest = %x, want %x", digest, h.Sum(nil))
+			}
+
+			// The signature value covers the attributes encoded as a SET
+			set, _ := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: signerInfo.SignedAttrs.Bytes})
+			if err := certs[0].CheckSignature(tt.algorithm, set, signerInfo.Signature); err != nil {
+				t.Errorf("signature does not verify: %v", err)
+			}
+		})
+	}
+}
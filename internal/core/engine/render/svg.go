@@ -0,0 +1,400 @@
+package render
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/layout"
+)
+
+// SVGRenderer handles vector SVG generation
+type SVGRenderer struct {
+	textEngine  *layout.TextEngine
+	pageBreaker *layout.PageBreaker
+	options     SVGRenderOptions
+}
+
+// SVGRenderOptions configures SVG rendering
+type SVGRenderOptions struct {
+	Precision      int   // Decimal places written for coordinates
+	MaxImagePixels int64 // Largest width × height of a watermark image, 0 for the default
+}
+
+// SVGRenderContext provides context for SVG rendering
+type SVGRenderContext struct {
+	Builder    *strings.Builder // Markup of the page being written
+	PageNumber int              // Page being drawn
+	Width      float64          // Page width in user units (CSS pixels)
+	Height     float64          // Page height in user units (CSS pixels)
+	OriginX    float64          // Left edge of the content area in user units
+	OriginY    float64          // Top edge of the content area in user units
+	Scale      float64          // Scaling factor
+	Precision  int              // Decimal places written for coordinates
+}
+
+// ToSVG converts a layout box in CSS pixels to page user units
+func (ctx SVGRenderContext) ToSVG(box domain.Box) (x, y, w, h float64) {
+	return ctx.OriginX + ctx.Length(box.X),
+		ctx.OriginY + ctx.Length(box.Y),
+		ctx.Length(box.Width),
+		ctx.Length(box.Height)
+}
+
+// Length converts a length in CSS pixels to page user units
+func (ctx SVGRenderContext) Length(px float64) float64 {
+	return px * ctx.Scale
+}
+
+// Num formats a coordinate with the configured precision
+func (ctx SVGRenderContext) Num(v float64) string {
+	return strconv.FormatFloat(v, 'f', ctx.Precision, 64)
+}
+
+// NewSVGRenderer creates a new SVG renderer
+func NewSVGRenderer(opts SVGRenderOptions) *SVGRenderer {
+	if opts.Precision <= 0 {
+		opts.Precision = 2
+	}
+	return &SVGRenderer{
+		textEngine:  layout.NewTextEngine(),
+		pageBreaker: layout.NewPageBreaker(),
+		options:     opts,
+	}
+}
+
+// Render renders a layout tree to SVG.
+//
+// Each page becomes its own SVG document. A single page is returned as-is and
+// several pages are bundled into a ZIP archive unless Output.PageNumber selects
+// one of them.
+func (r *SVGRenderer) Render(layout *domain.LayoutNode, running *layout.RunningContent, options domain.PrintOptions) (*RenderOutput, error) {
+	archive := newPageArchive("svg")
+	if err := r.RenderPages(layout, running, options, archive.Add); err != nil {
+		return nil, err
+	}
+	return archive.Output()
+}
+
+// RenderPages paginates a layout and writes the pages selected by
+// Output.PageNumber as standalone SVG documents, handing each to emit in turn
+func (r *SVGRenderer) RenderPages(layout *domain.LayoutNode, running *layout.RunningContent, options domain.PrintOptions, emit func(page []byte) error) error {
+	page := ResolvePageGeometry(options.Page)
+
+	// Split the layout into pages of the printable height
+	pageBreaks, err := r.pageBreaker.CalculatePageBreaks(layout, page.ContentHeightPixels())
+	if err != nil {
+		return fmt.Errorf("failed to calculate page breaks: %w", err)
+	}
+	margins, err := layoutMargins(running, len(pageBreaks), standalone)
+	if err != nil {
+		return err
+	}
+
+	// Validate the watermark image once; pages reference it by its data URI
+	watermark := options.Output.Watermark
+	var watermarkImage *ImageContent
+	if watermark.Visible() && watermark.Image != "" {
+		if watermarkImage, _, err = loadWatermarkImage(watermark, r.options.MaxImagePixels); err != nil {
+			return err
+		}
+	}
+
+	selected, err := selectPages(len(pageBreaks), options.Output.PageNumber)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range selected {
+		pageBreak := pageBreaks[i]
+		var builder strings.Builder
+
+		// Create render context; user units are CSS pixels so layout boxes map directly
+		ctx := SVGRenderContext{
+			Builder:    &builder,
+			PageNumber: pageBreak.PageNumber,
+			Width:      MMToPixels(page.Width),
+			Height:     MMToPixels(page.Height),
+			OriginX:    MMToPixels(page.Margins.Left),
+			OriginY:    MMToPixels(page.Margins.Top) - pageBreak.StartY*page.Scale,
+			Scale:      page.Scale,
+			Precision:  r.options.Precision,
+		}
+
+		r.writeHeader(page, options, ctx)
+
+		for _, node := range pageBreak.Nodes {
+			if err := r.renderLayoutNode(node, ctx); err != nil {
+				return fmt.Errorf("failed to render page %d: %w", pageBreak.PageNumber, err)
+			}
+		}
+
+		builder.WriteString("</g>\n")
+
+		// Headers and footers are drawn in the margins around the content
+		if err := r.renderMargins(margins[i], page, ctx); err != nil {
+			return fmt.Errorf("failed to render headers and footers of page %d: %w", pageBreak.PageNumber, err)
+		}
+
+		// Watermarks are stamped over the content and may extend into the margins
+		if watermark.Visible() {
+			r.renderWatermark(watermark, watermarkImage, page, ctx)
+		}
+
+		builder.WriteString("</svg>\n")
+		if err := emit([]byte(builder.String())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeHeader opens the SVG document, paints the paper and clips to the printable area
+func (r *SVGRenderer) writeHeader(page PageGeometry, options domain.PrintOptions, ctx SVGRenderContext) {
+	b := ctx.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" version="1.1" width="%smm" height="%smm" viewBox="0 0 %s %s">`+"\n",
+		ctx.Num(page.Width), ctx.Num(page.Height), ctx.Num(ctx.Width), ctx.Num(ctx.Height))
+
+	clipID := fmt.Sprintf("content-%d", ctx.PageNumber)
+	fmt.Fprintf(b, `<defs><clipPath id="%s"><rect x="%s" y="%s" width="%s" height="%s"/></clipPath></defs>`+"\n",
+		clipID,
+		ctx.Num(MMToPixels(page.Margins.Left)), ctx.Num(MMToPixels(page.Margins.Top)),
+		ctx.Num(MMToPixels(page.ContentWidth())), ctx.Num(MMToPixels(page.ContentHeight())))
+
+	if options.Page.Background {
+		fmt.Fprintf(b, `<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n")
+	}
+
+	fmt.Fprintf(b, `<g clip-path="url(#%s)">`+"\n", clipID)
+}
+
+// renderLayoutNode renders a single layout node; its children are listed on the page separately
+func (r *SVGRenderer) renderLayoutNode(node *domain.LayoutNode, ctx SVGRenderContext) error {
+	if node == nil {
+		return nil
+	}
+
+	// Render based on node type
+	switch node.Type {
+	case "text":
+		if err := r.RenderText(node, ctx); err != nil {
+			return fmt.Errorf("failed to render text: %w", err)
+		}
+	case "element":
+		if err := r.RenderElement(node, ctx); err != nil {
+			return fmt.Errorf("failed to render element: %w", err)
+		}
+		if node.Image != nil && node.Image.Drawing == nil {
+			r.renderImage(node.Image, layout.ContentBox(node), ctx)
+		}
+		r.renderDrawing(node, ctx)
+		r.renderBarcode(node, ctx)
+	}
+
+	return nil
+}
+
+// RenderElement renders a layout element with background and border styling
+func (r *SVGRenderer) RenderElement(elem *domain.LayoutNode, ctx SVGRenderContext) error {
+	// Render background
+	if err := r.renderBackground(elem.Style.Background, elem.Box, ctx); err != nil {
+		return err
+	}
+
+	// Render border
+	if err := r.renderBorder(elem.Style.Border, elem.Box, ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RenderText renders a text node as one <text> element per laid out line
+func (r *SVGRenderer) RenderText(node *domain.LayoutNode, ctx SVGRenderContext) error {
+	if node.Content == "" {
+		return nil
+	}
+	style := node.Style
+
+	// Break the text exactly as the layout engine did so lines match the box height
+	lines := r.textEngine.SplitTextIntoLines(node.Content, style.Font, node.Box.Width)
+	lineHeight := r.textEngine.CalculateLineHeight(style.Font, style.Text.LineHeight)
+	boxX, boxY, boxWidth, _ := ctx.ToSVG(node.Box)
+
+	// Alignment is expressed with text-anchor so viewers use their own glyph
+	// metrics. Text stays in logical order and the viewer shapes and reorders
+	// it; in right-to-left text the anchor's start is the right edge.
+	rtl := style.Text.Direction == domain.DirectionRTL
+	x, anchor := boxX, "start"
+	switch r.textEngine.ResolveAlign(style.Text) {
+	case domain.TextAlignCenter:
+		x, anchor = boxX+boxWidth/2, "middle"
+	case domain.TextAlignRight:
+		x, anchor = boxX+boxWidth, "end"
+		if rtl {
+			anchor = "start"
+		}
+	default:
+		if rtl {
+			anchor = "end"
+		}
+	}
+
+	attrs := fmt.Sprintf(`font-family="%s" font-size="%s" font-weight="%d" font-style="%s" fill="%s"%s text-anchor="%s"`,
+		escapeSVG(style.Font.Family),
+		ctx.Num(ctx.Length(style.Font.Size)),
+		style.Font.Weight,
+		escapeSVG(style.Font.Style),
+		svgColor(style.Color),
+		svgOpacity("fill-opacity", style.Color),
+		anchor)
+	if rtl {
+		attrs += ` direction="rtl"`
+	}
+	if style.Text.Decoration != "" && style.Text.Decoration != "none" {
+		attrs += fmt.Sprintf(` text-decoration="%s"`, escapeSVG(style.Text.Decoration))
+	}
+
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+
+		// Place the baseline inside the line box
+		y := boxY + ctx.Length(float64(i)*lineHeight+baselineOffset(style.Font.Size, lineHeight))
+		fmt.Fprintf(ctx.Builder, `<text x="%s" y="%s" %s>%s</text>`+"\n",
+			ctx.Num(x), ctx.Num(y), attrs, escapeSVG(line))
+
+		if i == len(lines)-1 && node.Leader != nil {
+			lineEnd, width := x, ctx.Length(r.textEngine.EstimateTextWidth(line, style.Font))
+			switch {
+			case anchor == "middle":
+				lineEnd += width / 2
+			case (anchor == "start") != rtl:
+				lineEnd += width
+			}
+			r.renderLeader(node, lineEnd, boxX+boxWidth+ctx.Length(node.Leader.Width), y, ctx)
+		}
+	}
+
+	return nil
+}
+
+// renderImage embeds an image as a data URI scaled to fill a layout box
+func (r *SVGRenderer) renderImage(img *domain.Image, bounds domain.Box, ctx SVGRenderContext) {
+	x, y, w, h := ctx.ToSVG(bounds)
+	if w <= 0 || h <= 0 {
+		return
+	}
+	fmt.Fprintf(ctx.Builder, `<image x="%s" y="%s" width="%s" height="%s" preserveAspectRatio="none" xlink:href="data:image/%s;base64,%s"/>`+"\n",
+		ctx.Num(x), ctx.Num(y), ctx.Num(w), ctx.Num(h), img.Format, base64.StdEncoding.EncodeToString(img.Data))
+}
+
+// renderWatermark stamps a translucent, optionally rotated watermark on the page
+func (r *SVGRenderer) renderWatermark(wm *domain.Watermark, img *ImageContent, page PageGeometry, ctx SVGRenderContext) {
+	b := ctx.Builder
+	placement := resolveWatermark(wm, page)
+	x, y := MMToPixels(placement.X), MMToPixels(placement.Y)
+
+	// SVG rotates clockwise, so the counter-clockwise angle is negated
+	transform := ""
+	if placement.Angle != 0 {
+		transform = fmt.Sprintf(` transform="rotate(%s %s %s)"`, ctx.Num(-placement.Angle), ctx.Num(x), ctx.Num(y))
+	}
+	fmt.Fprintf(b, `<g opacity="%.3f"%s>`+"\n", placement.Opacity, transform)
+
+	if img != nil {
+		w, h := watermarkImageSize(img, placement)
+		w, h = MMToPixels(w), MMToPixels(h)
+		fmt.Fprintf(b, `<image x="%s" y="%s" width="%s" height="%s" xlink:href="%s"/>`+"\n",
+			ctx.Num(x-placement.AnchorX*w), ctx.Num(y-placement.AnchorY*h), ctx.Num(w), ctx.Num(h), escapeSVG(wm.Image))
+	}
+
+	if wm.Text != "" {
+		anchor := "middle"
+		switch placement.AnchorX {
+		case 0:
+			anchor = "start"
+		case 1:
+			anchor = "end"
+		}
+		size := placement.FontSize * pixelsPerInch / pointsPerInch
+		fmt.Fprintf(b, `<text x="%s" y="%s" font-family="%s" font-size="%s" font-weight="700" fill="%s" text-anchor="%s">%s</text>`+"\n",
+			ctx.Num(x), ctx.Num(watermarkBaseline(y, size, placement.AnchorY)),
+			watermarkSVGFontFamily, ctx.Num(size),
+			svgColor(domain.Color{R: watermarkTextColorLevel, G: watermarkTextColorLevel, B: watermarkTextColorLevel}),
+			anchor, escapeSVG(wm.Text))
+	}
+
+	b.WriteString("</g>\n")
+}
+
+// renderBackground renders element background as a filled rectangle
+func (r *SVGRenderer) renderBackground(bg domain.Background, bounds domain.Box, ctx SVGRenderContext) error {
+	if bg.Color.A == 0 {
+		return nil // Transparent background
+	}
+
+	x, y, w, h := ctx.ToSVG(bounds)
+	fmt.Fprintf(ctx.Builder, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"%s/>`+"\n",
+		ctx.Num(x), ctx.Num(y), ctx.Num(w), ctx.Num(h),
+		svgColor(bg.Color), svgOpacity("fill-opacity", bg.Color))
+
+	return nil
+}
+
+// renderBorder renders element border as a stroked rectangle with dash arrays
+func (r *SVGRenderer) renderBorder(border domain.BorderStyle, bounds domain.Box, ctx SVGRenderContext) error {
+	if border.Width <= 0 {
+		return nil
+	}
+
+	lineWidth := ctx.Length(border.Width)
+
+	// Draw border based on style
+	dash := ""
+	switch border.Style {
+	case domain.BorderSolid, domain.BorderDouble:
+	case domain.BorderDashed:
+		dash = fmt.Sprintf(` stroke-dasharray="%s %s"`, ctx.Num(3*lineWidth), ctx.Num(3*lineWidth))
+	case domain.BorderDotted:
+		dash = fmt.Sprintf(` stroke-dasharray="%s %s"`, ctx.Num(lineWidth), ctx.Num(lineWidth))
+	default:
+		return nil
+	}
+
+	// Stroke along the middle of the border edge so the outer edge matches the box
+	x, y, w, h := ctx.ToSVG(bounds)
+	x, y, w, h = x+lineWidth/2, y+lineWidth/2, w-lineWidth, h-lineWidth
+
+	fmt.Fprintf(ctx.Builder, `<rect x="%s" y="%s" width="%s" height="%s" fill="none" stroke="%s" stroke-width="%s"%s%s/>`+"\n",
+		ctx.Num(x), ctx.Num(y), ctx.Num(w), ctx.Num(h),
+		svgColor(border.Color), ctx.Num(lineWidth), svgOpacity("stroke-opacity", border.Color), dash)
+
+	return nil
+}
+
+// svgColor formats a color as an SVG hex color
+func svgColor(c domain.Color) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// svgOpacity returns an opacity attribute for translucent colors
+func svgOpacity(attr string, c domain.Color) string {
+	if c.A == 255 {
+		return ""
+	}
+	return fmt.Sprintf(` %s="%.3f"`, attr, float64(c.A)/255)
+}
+
+// escapeSVG escapes text for use in SVG content and attribute values
+func escapeSVG(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,113 @@
+package render
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+// renderTestSVG renders a document as SVG with the options of the print service
+func renderTestSVG(t *testing.T, content string, options domain.PrintOptions) *RenderOutput {
+	t.Helper()
+	output, err := NewSVGRenderer(SVGRenderOptions{}).Render(layoutTestHTML(t, content, options), nil, options)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	return output
+}
+
+// svgText parses an SVG document and returns the content of its text
+// elements, failing if it is not well-formed XML
+func svgText(t *testing.T, data []byte) []string {
+	t.Helper()
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var text []string
+	inText := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return text
+		}
+		if err != nil {
+			t.Fatalf("SVG is not well-formed: %v", err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			inText = token.Name.Local == "text"
+		case xml.EndElement:
+			inText = false
+		case xml.CharData:
+			if inText {
+				text = append(text, string(token))
+			}
+		}
+	}
+}
+
+func TestSVGRendererDrawsLayout(t *testing.T) {
+	options := domain.DefaultPrintOptions()
+	options.Output.Format = domain.FormatSVG
+	output := renderTestSVG(t, `<style>h1 { color: #ff0000 }</style>`+
+		`<h1>Terms &amp; conditions</h1><div style="width: 100px; height: 50px; background-color: #00ff00"></div>`, options)
+	if output.PageCount != 1 || output.Extension != "svg" {
+		t.Fatalf("Render() = %d pages of %s, want one SVG page", output.PageCount, output.Extension)
+	}
+
+	svg := string(output.Data)
+	if got := strings.Join(svgText(t, output.Data), "|"); got != "Terms & conditions" {
+		t.Errorf("SVG text = %q, want the heading", got)
+	}
+	if !strings.Contains(svg, `width="210.00mm" height="297.00mm"`) {
+		t.Error("SVG is not the size of an A4 page")
+	}
+	if !strings.Contains(svg, `fill="#ff0000" text-anchor="start">Terms &amp; conditions</text>`) {
+		t.Error("heading is not drawn in its color")
+	}
+	if !strings.Contains(svg, `width="100.00" height="50.00" fill="#00ff00"`) {
+		t.Error("box background is not drawn")
+	}
+}
+
+func TestSVGRendererPages(t *testing.T) {
+	options := domain.DefaultPrintOptions()
+	options.Output.Format = domain.FormatSVG
+	content := `<p style="break-after: page">One</p><p>Two</p>`
+	output := renderTestSVG(t, content, options)
+	if output.PageCount != 2 || output.Extension != "zip" {
+		t.Fatalf("Render() = %d pages of %s, want a ZIP of 2 pages", output.PageCount, output.Extension)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(output.Data), int64(len(output.Data)))
+	if err != nil {
+		t.Fatalf("output is not a ZIP archive: %v", err)
+	}
+	for i, want := range []struct{ name, text string }{{"page-001.svg", "One"}, {"page-002.svg", "Two"}} {
+		if i >= len(archive.File) || archive.File[i].Name != want.name {
+			t.Fatalf("archive entries = %v, want %s", archive.File, want.name)
+		}
+		entry, err := archive.File[i].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(entry)
+		entry.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(svgText(t, data), "|"); got != want.text {
+			t.Errorf("%s text = %q, want %q", want.name, got, want.text)
+		}
+	}
+
+	// A selected page is returned on its own
+	options.Output.PageNumber = 2
+	output = renderTestSVG(t, content, options)
+	if output.Extension != "svg" || strings.Join(svgText(t, output.Data), "|") != "Two" {
+		t.Errorf("page 2 alone = %s %q, want the SVG of page 2", output.Extension, svgText(t, output.Data))
+	}
+}
@@ -0,0 +1,433 @@
+package render
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/layout"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Standard structure types used when tagging a PDF
+const (
+	structDocument  = "Document"
+	structParagraph = "P"
+	structList      = "L"
+	structListItem  = "LI"
+	structListBody  = "LBody"
+	structFigure    = "Figure"
+	structLink      = "Link"
+	structForm      = "Form"
+)
+
+// structTypes maps HTML elements to standard PDF structure types. Elements
+// not listed are transparent: their content belongs to the closest tagged
+// ancestor.
+var structTypes = map[string]string{
+	"h1": "H1", "h2": "H2", "h3": "H3", "h4": "H4", "h5": "H5", "h6": "H6",
+	"p":          structParagraph,
+	"pre":        structParagraph,
+	"address":    structParagraph,
+	"blockquote": "BlockQuote",
+	"ul":         structList,
+	"ol":         structList,
+	"dl":         structList,
+	"li":         structListItem,
+	"dt":         structListItem,
+	"dd":         structListItem,
+	"table":      "Table",
+	"thead":      "THead",
+	"tbody":      "TBody",
+	"tfoot":      "TFoot",
+	"tr":         "TR",
+	"th":         "TH",
+	"td":         "TD",
+	"caption":    "Caption",
+	"img":        structFigure,
+	"barcode":    structFigure,
+	"svg":        structFigure,
+	"figure":     structFigure,
+	"figcaption": "Caption",
+	"section":    "Sect",
+	"article":    "Art",
+	"div":        "Div",
+	"main":       "Div",
+	"header":     "Div",
+	"footer":     "Div",
+	"nav":        "Div",
+	"aside":      "Div",
+	"code":       "Code",
+}
+
+// groupingTypes are structure types whose text content needs a paragraph of its own
+var groupingTypes = map[string]bool{
+	structDocument: true, "Div": true, "Sect": true, "Art": true,
+	structList: true, "Table": true, "THead": true, "TBody": true, "TFoot": true, "TR": true,
+}
+
+// structElement is an element of the PDF structure tree
+type structElement struct {
+	Type     string
+	Alt      string // Alternate description, for figures
+	implicit bool   // Paragraph added around text placed directly in a grouping element
+	kids     []*structKid
+	obj      int // Object number, assigned when the tree is written
+}
+
+// structKid is a child element, or a text node that becomes a marked-content
+// sequence once it is drawn
+type structKid struct {
+	elem  *structElement
+	node  *domain.LayoutNode
+	owner *structElement // Element holding the text
+	page  int            // 1-based page the text was drawn on, 0 until drawn
+	mcid  int            // Marked-content identifier on that page
+	annot int            // Annotation object number, for annotations of the element
+}
+
+// pdfTagger records the logical structure of a document while it is drawn so
+// the output can be written as a tagged PDF
+type pdfTagger struct {
+	root       *structElement
+	lang       string                                // Natural language from the html lang attribute
+	texts      map[*domain.LayoutNode]*structKid     // Content items by text node, image or barcode
+	pages      map[int][]*structElement              // Parent tree: owning element of each MCID, by page
+	links      map[*domain.LayoutNode]*structElement // Link elements by a element
+	linkNodes  []*domain.LayoutNode                  // a elements in reading order
+	forms      map[*domain.LayoutNode]*structElement // Form elements by form control
+	formNodes  []*domain.LayoutNode                  // Form controls in reading order
+	flatten    bool                                  // Form controls are drawn as text instead of fields
+	missingAlt int                                   // Images without alt text
+}
+
+// newPDFTagger maps the elements of a paginated layout tree to structure
+// elements, in reading order. Flattened form controls are tagged as text.
+func newPDFTagger(root *domain.LayoutNode, flattenForms bool) *pdfTagger {
+	t := &pdfTagger{
+		root:    &structElement{Type: structDocument},
+		texts:   make(map[*domain.LayoutNode]*structKid),
+		pages:   make(map[int][]*structElement),
+		links:   make(map[*domain.LayoutNode]*structElement),
+		forms:   make(map[*domain.LayoutNode]*structElement),
+		flatten: flattenForms,
+	}
+	if root != nil {
+		t.build(root, t.root)
+	}
+	return t
+}
+
+// build adds the structure for a layout node and its descendants below parent
+func (t *pdfTagger) build(node *domain.LayoutNode, parent *structElement) {
+	if node.Type == "text" {
+		if node.Content == "" {
+			return
+		}
+		target := inlineParent(parent)
+		kid := &structKid{node: node, owner: target}
+		target.kids = append(target.kids, kid)
+		t.texts[node] = kid
+		return
+	}
+
+	if node.Tag == "html" && t.lang == "" {
+		t.lang = node.Attributes["lang"]
+	}
+
+	// The content of a form control is its value, drawn by the field
+	if layout.IsFormControl(node) {
+		target := inlineParent(parent)
+		if !t.flatten {
+			// Fields become Form elements once their widgets are known
+			t.forms[node] = target.add(&structElement{Type: structForm})
+			t.formNodes = append(t.formNodes, node)
+			return
+		}
+		kid := &structKid{node: node, owner: target}
+		target.kids = append(target.kids, kid)
+		t.texts[node] = kid
+		return
+	}
+
+	elem := parent
+	if node.Tag == "a" {
+		// Links become Link elements once their annotations are known
+		if _, _, ok := linkTarget(node.Attributes["href"]); ok {
+			elem = inlineParent(parent).add(&structElement{Type: structLink})
+			t.links[node] = elem
+			t.linkNodes = append(t.linkNodes, node)
+		}
+	} else if structType, ok := structTypes[node.Tag]; ok {
+		switch {
+		case node.Tag == "img":
+			alt, hasAlt := node.Attributes["alt"]
+			if !hasAlt {
+				t.missingAlt++
+			} else if strings.TrimSpace(alt) == "" {
+				return // Decorative images are left out of the structure
+			}
+			elem = parent
+			if parent.Type == structFigure && parent.Alt == "" {
+				parent.Alt = alt // The figure describes its image
+			} else {
+				elem = parent.add(&structElement{Type: structType, Alt: alt})
+			}
+
+			// The image is the content of its figure
+			kid := &structKid{node: node, owner: elem}
+			elem.kids = append(elem.kids, kid)
+			t.texts[node] = kid
+			return
+		case node.Tag == "barcode":
+			// A barcode is described by its alt text, or else by its value.
+			// Its symbol and human-readable line are the figure's content.
+			alt := node.Attributes["alt"]
+			if alt == "" && node.Barcode != nil {
+				alt = node.Barcode.Value
+			}
+			elem = parent.add(&structElement{Type: structType, Alt: alt})
+			kid := &structKid{node: node, owner: elem}
+			elem.kids = append(elem.kids, kid)
+			t.texts[node] = kid
+		case node.Tag == "svg":
+			// Artwork is described by its aria-label, or else by its title.
+			// Hidden artwork is decoration.
+			if node.Attributes["aria-hidden"] == "true" {
+				return
+			}
+			alt := node.Attributes["aria-label"]
+			if alt == "" && node.Drawing != nil {
+				alt = node.Drawing.Title
+			}
+			if alt == "" {
+				t.missingAlt++
+			}
+			elem = parent.add(&structElement{Type: structType, Alt: alt})
+			kid := &structKid{node: node, owner: elem}
+			elem.kids = append(elem.kids, kid)
+			t.texts[node] = kid
+			return
+		case structType == structListItem:
+			// List items hold their content in a body
+			item := parent.add(&structElement{Type: structListItem})
+			elem = item.add(&structElement{Type: structListBody})
+		default:
+			elem = parent.add(&structElement{Type: structType, Alt: node.Attributes["alt"]})
+		}
+	}
+
+	for _, child := range node.Children {
+		t.build(child, elem)
+	}
+}
+
+// inlineParent returns the element inline content below parent belongs to.
+// Consecutive inline content in a grouping element shares one paragraph
+// until the next block.
+func inlineParent(parent *structElement) *structElement {
+	if !groupingTypes[parent.Type] {
+		return parent
+	}
+	last := len(parent.kids) - 1
+	if last >= 0 && parent.kids[last].elem != nil && parent.kids[last].elem.implicit {
+		return parent.kids[last].elem
+	}
+	return parent.add(&structElement{Type: structParagraph, implicit: true})
+}
+
+// add appends a child element
+func (e *structElement) add(child *structElement) *structElement {
+	e.kids = append(e.kids, &structKid{elem: child})
+	return child
+}
+
+// BeginText opens the marked-content sequence for a text node, image,
+// artwork or barcode on the current page. Content drawn again on a later page is marked
+// as an artifact so it is read only once.
+func (t *pdfTagger) BeginText(node *domain.LayoutNode, ctx RenderContext) {
+	if t == nil {
+		return
+	}
+
+	kid, ok := t.texts[node]
+	if !ok || kid.page != 0 {
+		t.BeginArtifact(ctx.PDF)
+		return
+	}
+
+	elem := kid.owner
+	kid.page = ctx.CurrentPage
+	kid.mcid = len(t.pages[ctx.CurrentPage])
+	t.pages[ctx.CurrentPage] = append(t.pages[ctx.CurrentPage], elem)
+	ctx.PDF.RawWriteStr(fmt.Sprintf("/%s <</MCID %d>> BDC", elem.Type, kid.mcid))
+}
+
+// BeginArtifact opens a sequence for decoration that is not part of the content
+func (t *pdfTagger) BeginArtifact(pdf *gofpdf.Fpdf) {
+	if t == nil {
+		return
+	}
+	pdf.RawWriteStr("/Artifact BMC")
+}
+
+// BeginPagination opens a sequence for the running header or footer of a page
+func (t *pdfTagger) BeginPagination(pdf *gofpdf.Fpdf, edge layout.MarginEdge) {
+	if t == nil {
+		return
+	}
+	subtype := "Header"
+	if edge == layout.MarginBottom {
+		subtype = "Footer"
+	}
+	pdf.RawWriteStr(fmt.Sprintf("/Artifact <</Type /Pagination /Subtype /%s>> BDC", subtype))
+}
+
+// End closes the sequence opened by BeginText or BeginArtifact
+func (t *pdfTagger) End(pdf *gofpdf.Fpdf) {
+	if t == nil {
+		return
+	}
+	pdf.RawWriteStr("EMC")
+}
+
+// AddLinks adds the annotations written for links to their Link elements
+func (t *pdfTagger) AddLinks(links *pdfLinks) {
+	for _, node := range t.linkNodes {
+		link, ok := links.anchors[node]
+		if !ok {
+			continue
+		}
+		elem := t.links[node]
+		for _, area := range link.areas {
+			if area.obj != 0 {
+				elem.kids = append(elem.kids, &structKid{owner: elem, page: area.page, annot: area.obj})
+			}
+		}
+	}
+}
+
+// AddForms adds the widgets written for form fields to their Form elements
+func (t *pdfTagger) AddForms(forms *pdfForms) {
+	for _, node := range t.formNodes {
+		if field := forms.Field(node); field != nil && field.obj != 0 {
+			elem := t.forms[node]
+			elem.kids = append(elem.kids, &structKid{owner: elem, page: field.page, annot: field.obj})
+		}
+	}
+}
+
+// Warnings describes accessibility problems found while tagging
+func (t *pdfTagger) Warnings() []string {
+	var warnings []string
+	if t.missingAlt > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d image(s) without alt text", t.missingAlt))
+	}
+	if t.lang == "" {
+		warnings = append(warnings, "document language not set: add a lang attribute to the html element")
+	}
+	return warnings
+}
+
+// Write adds the structure tree to a rendered PDF, marking the document as tagged
+func (t *pdfTagger) Write(update *pdfUpdate) error {
+	pages, err := update.Pages()
+	if err != nil {
+		return err
+	}
+
+	t.prune(t.root)
+
+	// Reserve numbers first since elements refer to their parents
+	treeRoot := update.Reserve()
+	var reserve func(elem *structElement)
+	reserve = func(elem *structElement) {
+		elem.obj = update.Reserve()
+		for _, kid := range elem.kids {
+			if kid.elem != nil {
+				reserve(kid.elem)
+			}
+		}
+	}
+	reserve(t.root)
+
+	// Annotations follow the pages in the parent tree
+	var annotations []string
+	structParents := make(map[int]int)
+
+	var write func(elem *structElement, parent int)
+	write = func(elem *structElement, parent int) {
+		var kids []string
+		for _, kid := range elem.kids {
+			if kid.elem != nil {
+				write(kid.elem, elem.obj)
+				kids = append(kids, fmt.Sprintf("%d 0 R", kid.elem.obj))
+			} else if kid.annot != 0 {
+				key := len(pages) + len(annotations)
+				structParents[kid.annot] = key
+				annotations = append(annotations, fmt.Sprintf("%d %d 0 R", key, elem.obj))
+				kids = append(kids, fmt.Sprintf("<</Type /OBJR /Pg %d 0 R /Obj %d 0 R>>", pages[kid.page-1], kid.annot))
+			} else {
+				kids = append(kids, fmt.Sprintf("<</Type /MCR /Pg %d 0 R /MCID %d>>", pages[kid.page-1], kid.mcid))
+			}
+		}
+
+		body := fmt.Sprintf("<</Type /StructElem /S /%s /P %d 0 R /K [%s]", elem.Type, parent, strings.Join(kids, " "))
+		if elem.Alt != "" {
+			body += " /Alt " + pdfString(elem.Alt)
+		}
+		update.Set(elem.obj, body+">>")
+	}
+	write(t.root, treeRoot)
+
+	// The parent tree maps each page's MCIDs back to their elements
+	var nums []string
+	for i, page := range pages {
+		owners := make([]string, len(t.pages[i+1]))
+		for mcid, elem := range t.pages[i+1] {
+			owners[mcid] = fmt.Sprintf("%d 0 R", elem.obj)
+		}
+		nums = append(nums, fmt.Sprintf("%d [%s]", i, strings.Join(owners, " ")))
+		if err := update.SetEntries(page, map[string]string{
+			"/StructParents": strconv.Itoa(i),
+			"/Tabs":          "/S",
+		}); err != nil {
+			return err
+		}
+	}
+	for annot, key := range structParents {
+		if err := update.SetEntries(annot, map[string]string{"/StructParent": strconv.Itoa(key)}); err != nil {
+			return err
+		}
+	}
+	nums = append(nums, annotations...)
+	parentTree := update.Add(fmt.Sprintf("<</Nums [%s]>>", strings.Join(nums, " ")))
+
+	update.Set(treeRoot, fmt.Sprintf("<</Type /StructTreeRoot /K [%d 0 R] /ParentTree %d 0 R /ParentTreeNextKey %d>>",
+		t.root.obj, parentTree, len(nums)))
+
+	catalog := map[string]string{
+		"/StructTreeRoot":    fmt.Sprintf("%d 0 R", treeRoot),
+		"/MarkInfo":          "<</Marked true>>",
+		"/ViewerPreferences": "<</DisplayDocTitle true>>",
+	}
+	if t.lang != "" {
+		catalog["/Lang"] = pdfString(t.lang)
+	}
+	return update.SetEntries(update.Root(), catalog)
+}
+
+// prune removes text that was never drawn and elements left without content.
+// Figures are kept for their alternate description.
+func (t *pdfTagger) prune(elem *structElement) bool {
+	kids := elem.kids[:0]
+	for _, kid := range elem.kids {
+		if kid.elem != nil && t.prune(kid.elem) || kid.elem == nil && kid.page != 0 {
+			kids = append(kids, kid)
+		}
+	}
+	elem.kids = kids
+	return len(kids) > 0 || elem.Type == structFigure && elem.Alt != ""
+}
@@ -0,0 +1,65 @@
+package render
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+// renderTaggedPDF renders a document as a tagged PDF
+func renderTaggedPDF(t *testing.T, content string) *RenderOutput {
+	t.Helper()
+	options := domain.DefaultPrintOptions()
+	options.Render.Accessibility = true
+	return renderTestPDF(t, content, options, PDFRenderOptions{})
+}
+
+func TestPDFRendererTagged(t *testing.T) {
+	logo := "data:image/png;base64," + base64.StdEncoding.EncodeToString(testPNG(20, 10))
+	output := renderTaggedPDF(t, `<html lang="en"><body><h1>Annual report</h1><p>Revenue grew.</p>`+
+		`<img src="`+logo+`" alt="Company logo"></body></html>`)
+	if len(output.Warnings) != 0 {
+		t.Errorf("warnings = %q, want none for an accessible document", output.Warnings)
+	}
+
+	pdf := string(output.Data)
+	for _, want := range []string{"/StructTreeRoot", "/MarkInfo <</Marked true>>", "/Lang (en)", "/StructParents 0"} {
+		if !strings.Contains(pdf, want) {
+			t.Errorf("PDF has no %s", want)
+		}
+	}
+	for _, want := range []string{"/S /Document", "/S /H1", "/S /P", "/S /Figure"} {
+		if !strings.Contains(pdf, want) {
+			t.Errorf("structure tree has no %s element", want)
+		}
+	}
+	if !strings.Contains(pdf, "/Alt (Company logo)") {
+		t.Error("figure has no alternate description")
+	}
+
+	// Content is marked in reading order and tied to its elements by MCID
+	file, pages := testPages(t, output.Data)
+	content := testPageContent(t, file, pages[0])
+	heading, paragraph, figure := strings.Index(content, "/H1 <</MCID 0>> BDC"),
+		strings.Index(content, "/P <</MCID 1>> BDC"), strings.Index(content, "/Figure <</MCID 2>> BDC")
+	if heading < 0 || paragraph < heading || figure < paragraph {
+		t.Errorf("content is not marked as H1, P and Figure in order:\n%s", content)
+	}
+}
+
+func TestPDFRendererTaggedWarnings(t *testing.T) {
+	logo := "data:image/png;base64," + base64.StdEncoding.EncodeToString(testPNG(20, 10))
+	output := renderTaggedPDF(t, `<p>Untitled</p><img src="`+logo+`"><img src="`+logo+`">`)
+	want := "2 image(s) without alt text|document language not set: add a lang attribute to the html element"
+	if got := strings.Join(output.Warnings, "|"); got != want {
+		t.Errorf("warnings = %q, want %q", got, want)
+	}
+
+	// Without accessibility the document is not tagged and nothing is reported
+	output = renderTestPDF(t, `<img src="`+logo+`">`, domain.DefaultPrintOptions(), PDFRenderOptions{})
+	if strings.Contains(string(output.Data), "/StructTreeRoot") || len(output.Warnings) != 0 {
+		t.Errorf("untagged output has a structure tree or warnings %q", output.Warnings)
+	}
+}
@@ -0,0 +1,109 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"print-service/internal/core/domain"
+)
+
+// Watermark defaults applied when the request leaves a field unset
+const (
+	defaultWatermarkOpacity  = 0.3
+	watermarkFontSize        = 72.0 // Points, for centred and diagonal text
+	watermarkCornerFontSize  = 24.0 // Points, for corner stamps
+	watermarkCornerInset     = 5.0  // mm between a corner stamp and the content edge
+	watermarkFontFamily      = "Arial"
+	watermarkSVGFontFamily   = "Helvetica, Arial, sans-serif"
+	watermarkTextColorLevel  = 128 // Grey level of watermark text
+	watermarkImageResourceID = "watermark"
+)
+
+// watermarkPlacement describes where a watermark is drawn on a page.
+//
+// The point (X, Y) in mm is where the anchor of the watermark sits; AnchorX and
+// AnchorY give that anchor as a fraction of the watermark's own width and
+// height. Angle is counter-clockwise in degrees around the anchor.
+type watermarkPlacement struct {
+	X        float64
+	Y        float64
+	AnchorX  float64
+	AnchorY  float64
+	Angle    float64
+	FontSize float64 // Text size in points
+	Scale    float64 // Image scale factor
+	Opacity  float64
+}
+
+// resolveWatermark computes the placement of a watermark on a page
+func resolveWatermark(wm *domain.Watermark, page PageGeometry) watermarkPlacement {
+	scale := wm.Scale
+	if scale <= 0 {
+		scale = 1.0
+	}
+
+	opacity := wm.Opacity
+	if opacity <= 0 {
+		opacity = defaultWatermarkOpacity
+	}
+	opacity = math.Min(opacity, 1.0)
+
+	placement := watermarkPlacement{
+		X:        page.Width / 2,
+		Y:        page.Height / 2,
+		AnchorX:  0.5,
+		AnchorY:  0.5,
+		FontSize: watermarkFontSize * scale,
+		Scale:    scale,
+		Opacity:  opacity,
+	}
+
+	left := page.Margins.Left + watermarkCornerInset
+	right := page.Width - page.Margins.Right - watermarkCornerInset
+	top := page.Margins.Top + watermarkCornerInset
+	bottom := page.Height - page.Margins.Bottom - watermarkCornerInset
+
+	switch strings.ToLower(wm.Position) {
+	case "center", "centre":
+		// Upright in the middle of the page
+	case "top-left":
+		placement.X, placement.Y, placement.AnchorX, placement.AnchorY = left, top, 0, 0
+	case "top-right":
+		placement.X, placement.Y, placement.AnchorX, placement.AnchorY = right, top, 1, 0
+	case "bottom-left":
+		placement.X, placement.Y, placement.AnchorX, placement.AnchorY = left, bottom, 0, 1
+	case "bottom-right":
+		placement.X, placement.Y, placement.AnchorX, placement.AnchorY = right, bottom, 1, 1
+	default:
+		// Diagonal from the bottom-left to the top-right corner of the page
+		placement.Angle = math.Atan2(page.Height, page.Width) * 180 / math.Pi
+	}
+
+	if placement.AnchorX != 0.5 || placement.AnchorY != 0.5 {
+		placement.FontSize = watermarkCornerFontSize * scale
+	}
+
+	return placement
+}
+
+// loadWatermarkImage decodes a watermark image given as a data URI, of up to maxPixels pixels
+func loadWatermarkImage(wm *domain.Watermark, maxPixels int64) (*ImageContent, image.Image, error) {
+	_, data, err := DecodeDataURI(wm.Image)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid watermark image: %w", err)
+	}
+	return DecodeImageContent(data, maxPixels)
+}
+
+// watermarkImageSize returns the drawn size of a watermark image in mm
+func watermarkImageSize(img *ImageContent, placement watermarkPlacement) (float64, float64) {
+	return PixelsToMM(float64(img.Width)) * placement.Scale, PixelsToMM(float64(img.Height)) * placement.Scale
+}
+
+// watermarkBaseline returns the baseline of watermark text whose em box is
+// height tall, given the anchor point y and the vertical anchor fraction
+func watermarkBaseline(y, height, anchorY float64) float64 {
+	return y + (0.8-anchorY)*height
+}
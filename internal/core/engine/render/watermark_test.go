@@ -0,0 +1,110 @@
+package render
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+func TestResolveWatermark(t *testing.T) {
+	page := ResolvePageGeometry(domain.PageOptions{
+		Size: domain.A4, Orientation: domain.OrientationPortrait,
+		Margins: domain.Margins{Top: 20, Right: 15, Bottom: 20, Left: 15},
+	})
+	diagonal := math.Atan2(297, 210) * 180 / math.Pi
+	tests := []struct {
+		name             string
+		watermark        domain.Watermark
+		x, y             float64
+		anchorX, anchorY float64
+		angle, fontSize  float64
+		opacity          float64
+	}{
+		{"diagonal by default", domain.Watermark{Text: "DRAFT"}, 105, 148.5, 0.5, 0.5, diagonal, 72, 0.3},
+		{"centre", domain.Watermark{Text: "DRAFT", Position: "center", Opacity: 0.5}, 105, 148.5, 0.5, 0.5, 0, 72, 0.5},
+		{"top-left", domain.Watermark{Text: "DRAFT", Position: "top-left"}, 20, 25, 0, 0, 0, 24, 0.3},
+		{"bottom-right scaled", domain.Watermark{Text: "DRAFT", Position: "Bottom-Right", Scale: 2}, 190, 272, 1, 1, 0, 48, 0.3},
+		{"opacity clamped", domain.Watermark{Text: "DRAFT", Position: "centre", Opacity: 4}, 105, 148.5, 0.5, 0.5, 0, 72, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolveWatermark(&tt.watermark, page)
+			if !near(got.X, tt.x) || !near(got.Y, tt.y) || got.AnchorX != tt.anchorX || got.AnchorY != tt.anchorY {
+				t.Errorf("anchor = %g,%g at (%g, %g), want %g,%g at (%g, %g)",
+					got.AnchorX, got.AnchorY, got.X, got.Y, tt.anchorX, tt.anchorY, tt.x, tt.y)
+			}
+			if !near(got.Angle, tt.angle) || got.FontSize != tt.fontSize || got.Opacity != tt.opacity {
+				t.Errorf("angle %g, %gpt, opacity %g; want angle %g, %gpt, opacity %g",
+					got.Angle, got.FontSize, got.Opacity, tt.angle, tt.fontSize, tt.opacity)
+			}
+		})
+	}
+}
+
+// near reports whether two lengths agree to within rounding
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 0.01
+}
+
+// watermarked returns print options that stamp DRAFT across every page
+func watermarked(format domain.OutputFormat) domain.PrintOptions {
+	options := domain.DefaultPrintOptions()
+	options.Output.Format = format
+	options.Output.Watermark = &domain.Watermark{Text: "DRAFT"}
+	return options
+}
+
+func TestPDFRendererWatermark(t *testing.T) {
+	output := renderTestPDF(t, `<p style="break-after: page">One</p><p>Two</p>`, watermarked(domain.FormatPDF), PDFRenderOptions{})
+	file, pages := testPages(t, output.Data)
+	if len(pages) != 2 {
+		t.Fatalf("Render() = %d pages, want 2", len(pages))
+	}
+	for i, page := range pages {
+		content := testPageContent(t, file, page)
+		text := shownText(content)
+		if len(text) == 0 || text[len(text)-1] != "DRAFT" {
+			t.Errorf("page %d text = %q, want DRAFT stamped over the content", i+1, text)
+			continue
+		}
+		stamp := content[max(0, strings.LastIndex(content, "(DRAFT)")-300):]
+		if !strings.Contains(stamp, " gs") || !strings.Contains(stamp, " cm") {
+			t.Errorf("page %d watermark is not translucent and rotated:\n%s", i+1, stamp)
+		}
+	}
+}
+
+func TestSVGRendererWatermark(t *testing.T) {
+	output := renderTestSVG(t, `<p>One</p>`, watermarked(domain.FormatSVG))
+	if got := svgText(t, output.Data); len(got) != 2 || got[1] != "DRAFT" {
+		t.Errorf("SVG text = %q, want DRAFT stamped over the content", got)
+	}
+	if !strings.Contains(string(output.Data), `<g opacity="0.300" transform="rotate(-`) {
+		t.Error("SVG watermark is not translucent and rotated")
+	}
+}
+
+func TestImageRendererWatermark(t *testing.T) {
+	grey := func(c color.NRGBA) bool { return c.R < 250 && c.R == c.G && c.G == c.B }
+	count := func(options domain.PrintOptions) int {
+		img, err := png.Decode(bytes.NewReader(renderTestImage(t, "", options).Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return countPixels(img, grey)
+	}
+
+	options := watermarked(domain.FormatPNG)
+	if n := count(options); n == 0 {
+		t.Error("watermark is not drawn on the image")
+	}
+	options.Output.Watermark = nil
+	if n := count(options); n != 0 {
+		t.Errorf("blank page has %d grey pixels, want none", n)
+	}
+}
@@ -0,0 +1,291 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"print-service/internal/core/domain"
+)
+
+// documentInfo holds the document properties written to both the Info
+// dictionary and the XMP packet, which archival readers require to agree
+type documentInfo struct {
+	Title    string
+	Author   string
+	Subject  string
+	Keywords []string
+	Creator  string // Application that created the source document
+	Producer string // Application that wrote the PDF
+	Created  time.Time
+	Custom   map[string]string // Custom Info keys, by name
+}
+
+// Default document properties for requests that do not set them
+const (
+	defaultTitle   = "Generated Document"
+	defaultAuthor  = "Print Service"
+	defaultCreator = "Pure Go Print Service"
+)
+
+// standardInfoKeys are the Info dictionary keys custom properties cannot replace
+var standardInfoKeys = map[string]bool{
+	"Title": true, "Author": true, "Subject": true, "Keywords": true, "Creator": true,
+	"Producer": true, "CreationDate": true, "ModDate": true, "Trapped": true,
+}
+
+// newDocumentInfo fills the document properties from request metadata,
+// using the defaults for properties it leaves empty
+func newDocumentInfo(metadata domain.DocumentMetadata, created time.Time) documentInfo {
+	info := documentInfo{
+		Title:    metadata.Title,
+		Author:   metadata.Author,
+		Subject:  metadata.Subject,
+		Keywords: metadata.Keywords,
+		Creator:  metadata.Creator,
+		Producer: metadata.Producer,
+		Created:  created,
+	}
+	if info.Title == "" {
+		info.Title = defaultTitle
+	}
+	if info.Author == "" {
+		info.Author = defaultAuthor
+	}
+	if info.Creator == "" {
+		info.Creator = defaultCreator
+	}
+	if info.Producer == "" {
+		info.Producer = pdfProducer
+	}
+
+	for key, value := range metadata.CustomProps {
+		if key == "" || standardInfoKeys[key] {
+			continue
+		}
+		if info.Custom == nil {
+			info.Custom = make(map[string]string)
+		}
+		info.Custom[key] = value
+	}
+	return info
+}
+
+// xmpMetadata holds the properties written to a document's XMP metadata packet
+type xmpMetadata struct {
+	documentInfo
+	Lang            string // Language of the title, x-default when empty
+	PDFUAPart       int    // PDF/UA part the document claims, 0 for none
+	PDFAPart        int    // PDF/A part the document claims, 0 for none
+	PDFAConformance string // PDF/A conformance level, such as "B"
+}
+
+// buildXMP serializes metadata as an XMP packet for the document catalog
+func buildXMP(meta xmpMetadata) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("<?xpacket begin=\"\xef\xbb\xbf\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	buf.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	buf.WriteString("<rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+
+	buf.WriteString("<rdf:Description rdf:about=\"\" xmlns:dc=\"http://purl.org/dc/elements/1.1/\">\n")
+	buf.WriteString("<dc:format>application/pdf</dc:format>\n")
+	if meta.Title != "" {
+		fmt.Fprintf(&buf, "<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li>", xmlText(meta.Title))
+		if meta.Lang != "" {
+			fmt.Fprintf(&buf, "<rdf:li xml:lang=\"%s\">%s</rdf:li>", xmlText(meta.Lang), xmlText(meta.Title))
+		}
+		buf.WriteString("</rdf:Alt></dc:title>\n")
+	}
+	if meta.Author != "" {
+		fmt.Fprintf(&buf, "<dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>\n", xmlText(meta.Author))
+	}
+	if meta.Subject != "" {
+		fmt.Fprintf(&buf, "<dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:description>\n", xmlText(meta.Subject))
+	}
+	if len(meta.Keywords) > 0 {
+		buf.WriteString("<dc:subject><rdf:Bag>")
+		for _, keyword := range meta.Keywords {
+			fmt.Fprintf(&buf, "<rdf:li>%s</rdf:li>", xmlText(keyword))
+		}
+		buf.WriteString("</rdf:Bag></dc:subject>\n")
+	}
+	buf.WriteString("</rdf:Description>\n")
+
+	buf.WriteString("<rdf:Description rdf:about=\"\" xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\">\n")
+	if meta.Creator != "" {
+		fmt.Fprintf(&buf, "<xmp:CreatorTool>%s</xmp:CreatorTool>\n", xmlText(meta.Creator))
+	}
+	if !meta.Created.IsZero() {
+		date := meta.Created.Format(time.RFC3339)
+		fmt.Fprintf(&buf, "<xmp:CreateDate>%s</xmp:CreateDate>\n", date)
+		fmt.Fprintf(&buf, "<xmp:ModifyDate>%s</xmp:ModifyDate>\n", date)
+		fmt.Fprintf(&buf, "<xmp:MetadataDate>%s</xmp:MetadataDate>\n", date)
+	}
+	buf.WriteString("</rdf:Description>\n")
+
+	buf.WriteString("<rdf:Description rdf:about=\"\" xmlns:pdf=\"http://ns.adobe.com/pdf/1.3/\">\n")
+	if meta.Producer != "" {
+		fmt.Fprintf(&buf, "<pdf:Producer>%s</pdf:Producer>\n", xmlText(meta.Producer))
+	}
+	if len(meta.Keywords) > 0 {
+		fmt.Fprintf(&buf, "<pdf:Keywords>%s</pdf:Keywords>\n", xmlText(infoKeywords(meta.Keywords)))
+	}
+	buf.WriteString("</rdf:Description>\n")
+
+	// Custom Info keys are mirrored in the namespace Acrobat uses for them
+	keys := customKeys(meta.Custom)
+	if len(keys) > 0 {
+		fmt.Fprintf(&buf, "<rdf:Description rdf:about=\"\" xmlns:pdfx=\"%s\">\n", pdfxNamespace)
+		for _, key := range keys {
+			name := xmpPropertyName(key)
+			fmt.Fprintf(&buf, "<pdfx:%s>%s</pdfx:%s>\n", name, xmlText(meta.Custom[key]), name)
+		}
+		buf.WriteString("</rdf:Description>\n")
+	}
+
+	if meta.PDFAPart > 0 {
+		buf.WriteString("<rdf:Description rdf:about=\"\" xmlns:pdfaid=\"http://www.aiim.org/pdfa/ns/id/\">\n")
+		fmt.Fprintf(&buf, "<pdfaid:part>%d</pdfaid:part>\n", meta.PDFAPart)
+		fmt.Fprintf(&buf, "<pdfaid:conformance>%s</pdfaid:conformance>\n", meta.PDFAConformance)
+		buf.WriteString("</rdf:Description>\n")
+
+		// PDF/A only accepts schemas it predefines or that the packet describes
+		var schemas []string
+		if meta.PDFUAPart > 0 {
+			schemas = append(schemas, pdfuaExtensionSchema)
+		}
+		if len(keys) > 0 {
+			schemas = append(schemas, pdfxExtensionSchema(keys))
+		}
+		if len(schemas) > 0 {
+			buf.WriteString("<rdf:Description rdf:about=\"\" xmlns:pdfaExtension=\"http://www.aiim.org/pdfa/ns/extension/\" " +
+				"xmlns:pdfaSchema=\"http://www.aiim.org/pdfa/ns/schema#\" xmlns:pdfaProperty=\"http://www.aiim.org/pdfa/ns/property#\">\n")
+			buf.WriteString("<pdfaExtension:schemas><rdf:Bag>\n")
+			for _, schema := range schemas {
+				buf.WriteString(schema)
+			}
+			buf.WriteString("</rdf:Bag></pdfaExtension:schemas>\n")
+			buf.WriteString("</rdf:Description>\n")
+		}
+	}
+
+	if meta.PDFUAPart > 0 {
+		buf.WriteString("<rdf:Description rdf:about=\"\" xmlns:pdfuaid=\"http://www.aiim.org/pdfua/ns/id/\">\n")
+		fmt.Fprintf(&buf, "<pdfuaid:part>%d</pdfuaid:part>\n", meta.PDFUAPart)
+		buf.WriteString("</rdf:Description>\n")
+	}
+
+	buf.WriteString("</rdf:RDF>\n")
+	buf.WriteString("</x:xmpmeta>\n")
+	buf.WriteString("<?xpacket end=\"w\"?>")
+	return buf.Bytes()
+}
+
+// pdfxNamespace is the XMP namespace of custom document information keys
+const pdfxNamespace = "http://ns.adobe.com/pdfx/1.3/"
+
+// pdfuaExtensionSchema describes the PDF/UA identification schema for PDF/A readers
+const pdfuaExtensionSchema = `<rdf:li rdf:parseType="Resource">
+<pdfaSchema:schema>PDF/UA Universal Accessibility Schema</pdfaSchema:schema>
+<pdfaSchema:namespaceURI>http://www.aiim.org/pdfua/ns/id/</pdfaSchema:namespaceURI>
+<pdfaSchema:prefix>pdfuaid</pdfaSchema:prefix>
+<pdfaSchema:property><rdf:Seq><rdf:li rdf:parseType="Resource">
+<pdfaProperty:name>part</pdfaProperty:name>
+<pdfaProperty:valueType>Integer</pdfaProperty:valueType>
+<pdfaProperty:category>internal</pdfaProperty:category>
+<pdfaProperty:description>Indicates, which part of ISO 14289 standard is followed</pdfaProperty:description>
+</rdf:li></rdf:Seq></pdfaSchema:property>
+</rdf:li>
+`
+
+// pdfxExtensionSchema describes the custom document information keys for PDF/A readers
+func pdfxExtensionSchema(keys []string) string {
+	var buf strings.Builder
+	buf.WriteString("<rdf:li rdf:parseType=\"Resource\">\n")
+	buf.WriteString("<pdfaSchema:schema>PDF Document Information</pdfaSchema:schema>\n")
+	fmt.Fprintf(&buf, "<pdfaSchema:namespaceURI>%s</pdfaSchema:namespaceURI>\n", pdfxNamespace)
+	buf.WriteString("<pdfaSchema:prefix>pdfx</pdfaSchema:prefix>\n")
+	buf.WriteString("<pdfaSchema:property><rdf:Seq>")
+	for _, key := range keys {
+		fmt.Fprintf(&buf, "<rdf:li rdf:parseType=\"Resource\"><pdfaProperty:name>%s</pdfaProperty:name>", xmpPropertyName(key))
+		buf.WriteString("<pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category>")
+		fmt.Fprintf(&buf, "<pdfaProperty:description>%s</pdfaProperty:description></rdf:li>", xmlText(key))
+	}
+	buf.WriteString("</rdf:Seq></pdfaSchema:property>\n")
+	buf.WriteString("</rdf:li>\n")
+	return buf.String()
+}
+
+// customKeys returns the custom Info keys in a stable order
+func customKeys(custom map[string]string) []string {
+	keys := make([]string, 0, len(custom))
+	for key := range custom {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// xmpPropertyName encodes a custom key as an XML name, escaping characters
+// that names cannot hold as _xHHHH_ like Acrobat does
+func xmpPropertyName(key string) string {
+	var buf strings.Builder
+	for i, r := range key {
+		name := r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+			i > 0 && (r == '-' || r == '.' || r >= '0' && r <= '9')
+		if name && !(r == '_' && strings.HasPrefix(key[i:], "_x")) {
+			buf.WriteRune(r)
+		} else {
+			fmt.Fprintf(&buf, "_x%04X_", r)
+		}
+	}
+	return buf.String()
+}
+
+// infoKeywords joins keywords as the Keywords entry of the Info dictionary
+func infoKeywords(keywords []string) string {
+	return strings.Join(keywords, ", ")
+}
+
+// xmlText escapes text for XML character data and attribute values
+func xmlText(text string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(text))
+	return buf.String()
+}
+
+// pdfDate formats a time as a PDF date string with an explicit UTC offset
+func pdfDate(t time.Time) string {
+	_, offset := t.Zone()
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	return fmt.Sprintf("D:%s%c%02d'%02d'", t.Format("20060102150405"), sign, offset/3600, offset%3600/60)
+}
+
+// attachXMP adds an XMP packet as the document's metadata stream and writes
+// the Info entries gofpdf cannot: dates in the same form as the packet and
+// custom keys. Metadata streams stay uncompressed so tools that do not parse
+// PDF can find them.
+func attachXMP(update *pdfUpdate, meta xmpMetadata) error {
+	if info := update.Info(); info > 0 {
+		entries := make(map[string]string)
+		if !meta.Created.IsZero() {
+			date := pdfString(pdfDate(meta.Created))
+			entries["/CreationDate"], entries["/ModDate"] = date, date
+		}
+		for key, value := range meta.Custom {
+			entries[pdfName(key)] = pdfString(value)
+		}
+		if err := update.SetEntries(info, entries); err != nil {
+			return err
+		}
+	}
+
+	stream := update.AddStream("/Type /Metadata /Subtype /XML", buildXMP(meta))
+	return update.SetEntries(update.Root(), map[string]string{"/Metadata": fmt.Sprintf("%d 0 R", stream)})
+}
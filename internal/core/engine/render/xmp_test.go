@@ -0,0 +1,164 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"print-service/internal/core/domain"
+)
+
+func TestNewDocumentInfo(t *testing.T) {
+	info := newDocumentInfo(domain.DocumentMetadata{}, time.Time{})
+	if info.Title != defaultTitle || info.Author != defaultAuthor || info.Creator != defaultCreator || info.Producer != pdfProducer {
+		t.Errorf("newDocumentInfo() of empty metadata = %+v, want the defaults", info)
+	}
+
+	info = newDocumentInfo(domain.DocumentMetadata{
+		Title:       "Q3 Report",
+		CustomProps: map[string]string{"Department": "Finance", "Title": "Spoofed", "": "empty"},
+	}, time.Time{})
+	if info.Title != "Q3 Report" {
+		t.Errorf("Title = %q, want Q3 Report", info.Title)
+	}
+	if len(info.Custom) != 1 || info.Custom["Department"] != "Finance" {
+		t.Errorf("Custom = %v, want only Department; standard and empty keys are dropped", info.Custom)
+	}
+}
+
+func TestXMPPropertyName(t *testing.T) {
+	tests := []struct {
+		key, want string
+	}{
+		{"Department", "Department"},
+		{"cost-centre.v2", "cost-centre.v2"},
+		{"Cost Centre", "Cost_x0020_Centre"},
+		{"2024", "_x0032_024"},
+		{"_x", "_x005F_x"},
+	}
+	for _, tt := range tests {
+		if got := xmpPropertyName(tt.key); got != tt.want {
+			t.Errorf("xmpPropertyName(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestPDFDate(t *testing.T) {
+	tests := []struct {
+		time time.Time
+		want string
+	}{
+		{time.Date(2024, 3, 9, 14, 5, 0, 0, time.UTC), "D:20240309140500+00'00'"},
+		{time.Date(2024, 3, 9, 14, 5, 0, 0, time.FixedZone("", 5*3600+30*60)), "D:20240309140500+05'30'"},
+		{time.Date(2024, 3, 9, 14, 5, 0, 0, time.FixedZone("", -4*3600)), "D:20240309140500-04'00'"},
+	}
+	for _, tt := range tests {
+		if got := pdfDate(tt.time); got != tt.want {
+			t.Errorf("pdfDate(%v) = %q, want %q", tt.time, got, tt.want)
+		}
+	}
+}
+
+func TestBuildXMP(t *testing.T) {
+	created := time.Date(2024, 3, 9, 14, 5, 0, 0, time.UTC)
+	meta := xmpMetadata{
+		documentInfo: newDocumentInfo(domain.DocumentMetadata{
+			Title:       "Profit & Loss",
+			Keywords:    []string{"finance", "2024"},
+			CustomProps: map[string]string{"Cost Centre": "<42>"},
+		}, created),
+		Lang:     "en",
+		PDFAPart: 2, PDFAConformance: "B",
+	}
+	packet := buildXMP(meta)
+
+	// The packet between the processing instructions is well-formed XML
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("XMP packet is not well-formed: %v\n%s", err, packet)
+		}
+	}
+	for _, want := range []string{
+		`<rdf:li xml:lang="x-default">Profit &amp; Loss</rdf:li><rdf:li xml:lang="en">Profit &amp; Loss</rdf:li>`,
+		"<rdf:Bag><rdf:li>finance</rdf:li><rdf:li>2024</rdf:li></rdf:Bag>",
+		"<pdf:Keywords>finance, 2024</pdf:Keywords>",
+		"<xmp:CreateDate>2024-03-09T14:05:00Z</xmp:CreateDate>",
+		"<pdfx:Cost_x0020_Centre>&lt;42&gt;</pdfx:Cost_x0020_Centre>",
+		"<pdfaid:part>2</pdfaid:part>",
+		"<pdfaProperty:name>Cost_x0020_Centre</pdfaProperty:name>",
+	} {
+		if !bytes.Contains(packet, []byte(want)) {
+			t.Errorf("XMP packet has no %s", want)
+		}
+	}
+}
+
+// infoText decodes a literal text string of an Info dictionary, which gofpdf
+// writes as UTF-16BE with a byte order mark
+func infoText(value string) string {
+	if !strings.HasPrefix(value, "(") || !strings.HasSuffix(value, ")") {
+		return value
+	}
+	raw := unescapePDFString(value[1 : len(value)-1])
+	if len(raw) < 2 || raw[0] != 0xFE || raw[1] != 0xFF {
+		return string(raw)
+	}
+	units := make([]uint16, 0, len(raw)/2)
+	for i := 2; i+1 < len(raw); i += 2 {
+		units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+func TestPDFRendererMetadata(t *testing.T) {
+	output, err := NewPDFRenderer(PDFRenderOptions{ColorProfile: ColorProfileRGB}).Render(
+		layoutTestHTML(t, "<p>Report</p>", domain.DefaultPrintOptions()), nil, domain.DefaultPrintOptions(),
+		domain.DocumentMetadata{
+			Title:       "Q3 Report",
+			Author:      "Finance Team",
+			Keywords:    []string{"finance", "quarterly"},
+			CustomProps: map[string]string{"Department": "Accounts"},
+		})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	file, err := readPDF(output.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	num, ok := referenceTo(dictValue(file.trailer, "/Info"))
+	if !ok {
+		t.Fatal("PDF has no Info dictionary")
+	}
+	info, err := file.Object(num)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"/Title": "Q3 Report", "/Author": "Finance Team", "/Keywords": "finance, quarterly",
+		"/Producer": pdfProducer, "/Department": "Accounts",
+	} {
+		if got := infoText(dictValue(info, key)); got != want {
+			t.Errorf("Info %s = %s, want %s", key, got, want)
+		}
+	}
+	if created := dictValue(info, "/CreationDate"); created == "" || created != dictValue(info, "/ModDate") {
+		t.Errorf("Info dates = %s and %s, want the same creation and modification date", created, dictValue(info, "/ModDate"))
+	}
+
+	// The XMP packet is stored uncompressed and agrees with the Info dictionary
+	pdf := string(output.Data)
+	for _, want := range []string{"/Type /Metadata /Subtype /XML", "<dc:creator><rdf:Seq><rdf:li>Finance Team</rdf:li>", "<pdfx:Department>Accounts</pdfx:Department>"} {
+		if !strings.Contains(pdf, want) {
+			t.Errorf("PDF has no %s", want)
+		}
+	}
+}
@@ -0,0 +1,524 @@
+package svg
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/css"
+	"print-service/internal/core/engine/html"
+)
+
+// builder collects the shapes of artwork while walking its elements
+type builder struct {
+	ctx      Context
+	ids      map[string]*html.DOMNode // Elements by id, for use references and gradients
+	using    map[*html.DOMNode]bool   // Elements being drawn through use, to stop cycles
+	viewport domain.Box               // View box percentages are resolved against
+	shapes   []domain.Shape
+}
+
+// state holds the properties an element inherits, and the transformation
+// to the user space of the drawing
+type state struct {
+	fill          string // Fill paint as specified
+	stroke        string // Stroke paint as specified
+	fillOpacity   float64
+	strokeOpacity float64
+	opacity       float64 // Product of the opacity of the element and its groups
+	fillRule      string
+	strokeWidth   float64
+	lineCap       string
+	lineJoin      string
+	miterLimit    float64
+	dash          []float64
+	dashOffset    float64
+	font          domain.FontStyle // Font with its size in user units
+	anchor        string
+	color         domain.Color // Color currentColor refers to
+	visible       bool
+	transform     domain.Matrix // Element user space to drawing user space
+}
+
+// initialState returns the properties of the svg element before it is styled
+func initialState(ctx Context) state {
+	font := ctx.Font
+	if font.Size <= 0 {
+		font.Size = 16
+	}
+	return state{
+		fill:          "black",
+		stroke:        "none",
+		fillOpacity:   1,
+		strokeOpacity: 1,
+		opacity:       1,
+		fillRule:      "nonzero",
+		strokeWidth:   1,
+		lineCap:       "butt",
+		lineJoin:      "miter",
+		miterLimit:    4,
+		font:          font,
+		anchor:        "start",
+		color:         ctx.Color,
+		visible:       true,
+		transform:     domain.Identity,
+	}
+}
+
+// presentationAttributes are the attributes that set a property of the same name
+var presentationAttributes = []string{
+	"fill", "stroke", "fill-opacity", "stroke-opacity", "opacity", "fill-rule",
+	"stroke-width", "stroke-linecap", "stroke-linejoin", "stroke-miterlimit",
+	"stroke-dasharray", "stroke-dashoffset", "font-family", "font-size",
+	"font-weight", "font-style", "text-anchor", "color", "display", "visibility",
+	"stop-color", "stop-opacity",
+}
+
+// index records the elements of the artwork by id
+func (b *builder) index(node *html.DOMNode, depth int) {
+	if depth > maxDepth || node.Type != html.ElementNode {
+		return
+	}
+	if id := strings.TrimSpace(node.Attributes["id"]); id != "" {
+		if _, ok := b.ids[id]; !ok {
+			b.ids[id] = node
+		}
+	}
+	for _, child := range node.Children {
+		b.index(child, depth+1)
+	}
+}
+
+// properties returns the properties set on an element: its presentation
+// attributes, overridden by style sheet rules, overridden by its style attribute
+func (b *builder) properties(node *html.DOMNode) map[string]string {
+	attrs := attributes(node)
+	props := make(map[string]string)
+	for _, name := range presentationAttributes {
+		if value, ok := attrs[name]; ok {
+			props[name] = strings.TrimSpace(value)
+		}
+	}
+
+	var declarations []*css.Declaration
+	if b.ctx.Stylesheet != nil && b.ctx.Match != nil {
+		declarations = b.ctx.Match(b.ctx.Stylesheet, node)
+	}
+	if style := attrs["style"]; style != "" {
+		if sheet, err := css.NewParser(false).Parse("svg { " + style + " }"); err == nil && len(sheet.Rules) > 0 {
+			declarations = append(declarations, sheet.Rules[0].Declarations...)
+		}
+	}
+	for _, decl := range declarations {
+		props[strings.ToLower(decl.Property)] = strings.TrimSpace(decl.Value)
+	}
+	return props
+}
+
+// applyProperties styles an element, updating the inherited state. It
+// returns false when the element is not displayed.
+func (b *builder) applyProperties(node *html.DOMNode, s *state) bool {
+	props := b.properties(node)
+
+	// The color property comes first, as currentColor in the others refers to it
+	if value, ok := props["color"]; ok && value != "inherit" {
+		if c := parseColor(value, s.color); c != nil {
+			s.color = *c
+		}
+	}
+
+	for name, value := range props {
+		if value == "inherit" || value == "" {
+			continue
+		}
+		switch name {
+		case "display":
+			if value == "none" {
+				return false
+			}
+		case "visibility":
+			s.visible = value == "visible"
+		case "fill":
+			s.fill = value
+		case "stroke":
+			s.stroke = value
+		case "fill-opacity":
+			s.fillOpacity = parseOpacity(value, s.fillOpacity)
+		case "stroke-opacity":
+			s.strokeOpacity = parseOpacity(value, s.strokeOpacity)
+		case "opacity":
+			s.opacity *= parseOpacity(value, 1)
+		case "fill-rule":
+			if value == "evenodd" || value == "nonzero" {
+				s.fillRule = value
+			}
+		case "stroke-width":
+			if width, ok := parseLength(value, b.diagonal(), s.font.Size); ok && width >= 0 {
+				s.strokeWidth = width
+			}
+		case "stroke-linecap":
+			if value == "butt" || value == "round" || value == "square" {
+				s.lineCap = value
+			}
+		case "stroke-linejoin":
+			if value == "miter" || value == "round" || value == "bevel" {
+				s.lineJoin = value
+			}
+		case "stroke-miterlimit":
+			if limit, ok := parseNumber(value); ok && limit >= 1 {
+				s.miterLimit = limit
+			}
+		case "stroke-dasharray":
+			s.dash = b.parseDash(value, s.font.Size)
+		case "stroke-dashoffset":
+			if offset, ok := parseLength(value, b.diagonal(), s.font.Size); ok {
+				s.dashOffset = offset
+			}
+		case "font-family":
+			s.font.Family = value
+		case "font-size":
+			if size, ok := parseLength(value, s.font.Size, s.font.Size); ok && size > 0 {
+				s.font.Size = size
+			}
+		case "font-weight":
+			s.font.Weight = parseFontWeight(value, s.font.Weight)
+		case "font-style":
+			s.font.Style = strings.ToLower(value)
+		case "text-anchor":
+			if value == "start" || value == "middle" || value == "end" {
+				s.anchor = value
+			}
+		}
+	}
+	return true
+}
+
+// parseDash reads a stroke-dasharray. A list of zeros, or one with a
+// negative length, draws a solid stroke.
+func (b *builder) parseDash(value string, fontSize float64) []float64 {
+	if value == "none" {
+		return nil
+	}
+	var dash []float64
+	total := 0.0
+	for _, part := range strings.Fields(strings.ReplaceAll(value, ",", " ")) {
+		length, ok := parseLength(part, b.diagonal(), fontSize)
+		if !ok || length < 0 {
+			return nil
+		}
+		dash = append(dash, length)
+		total += length
+	}
+	if total == 0 {
+		return nil
+	}
+	if len(dash)%2 == 1 {
+		dash = append(dash, dash...)
+	}
+	return dash
+}
+
+// children draws the content of a container element
+func (b *builder) children(node *html.DOMNode, s state, depth int) {
+	for _, child := range node.Children {
+		if child.Type == html.ElementNode {
+			b.element(child, s, depth+1)
+		}
+	}
+}
+
+// element draws an element and its content
+func (b *builder) element(node *html.DOMNode, parent state, depth int) {
+	if depth > maxDepth {
+		return
+	}
+
+	s := parent
+	if !b.applyProperties(node, &s) {
+		return
+	}
+	attrs := attributes(node)
+	if transform, ok := parseTransform(attrs["transform"]); ok {
+		s.transform = s.transform.Multiply(transform)
+	}
+
+	switch tagName(node) {
+	case "g", "a":
+		b.children(node, s, depth)
+	case "svg":
+		b.nestedViewport(node, attrs, s, depth)
+	case "use":
+		b.use(node, attrs, s, depth)
+	case "text":
+		b.text(node, attrs, s)
+	case "path":
+		b.shape(parsePath(attrs["d"]), s)
+	case "rect":
+		b.shape(b.rect(attrs, s.font.Size), s)
+	case "circle":
+		r, _ := parseLength(attrs["r"], b.diagonal(), s.font.Size)
+		b.shape(ellipsePath(b.x(attrs["cx"], s), b.y(attrs["cy"], s), r, r), s)
+	case "ellipse":
+		rx, _ := parseLength(attrs["rx"], b.viewport.Width, s.font.Size)
+		ry, _ := parseLength(attrs["ry"], b.viewport.Height, s.font.Size)
+		b.shape(ellipsePath(b.x(attrs["cx"], s), b.y(attrs["cy"], s), rx, ry), s)
+	case "line":
+		b.shape([]domain.PathSegment{
+			{Op: 'M', Points: [3]domain.Point{{X: b.x(attrs["x1"], s), Y: b.y(attrs["y1"], s)}}},
+			{Op: 'L', Points: [3]domain.Point{{X: b.x(attrs["x2"], s), Y: b.y(attrs["y2"], s)}}},
+		}, s)
+	case "polyline":
+		b.shape(polyPath(attrs["points"], false), s)
+	case "polygon":
+		b.shape(polyPath(attrs["points"], true), s)
+	}
+
+	// defs, symbol, gradients, clipPath, mask, pattern, marker, filter,
+	// image, foreignObject, style and the descriptive elements draw nothing
+	// where they stand
+}
+
+// nestedViewport draws an svg element inside the artwork, its view box
+// fitted into the viewport its position and size establish
+func (b *builder) nestedViewport(node *html.DOMNode, attrs map[string]string, s state, depth int) {
+	viewport := domain.Box{X: b.x(attrs["x"], s), Y: b.y(attrs["y"], s), Width: b.viewport.Width, Height: b.viewport.Height}
+	if width, ok := parseLength(attrs["width"], b.viewport.Width, s.font.Size); ok {
+		viewport.Width = width
+	}
+	if height, ok := parseLength(attrs["height"], b.viewport.Height, s.font.Size); ok {
+		viewport.Height = height
+	}
+	b.drawViewport(node, parseViewBox(attrs["viewbox"]), attrs["preserveaspectratio"], viewport, s, depth)
+}
+
+// drawViewport draws the content of an svg or symbol element in a viewport
+func (b *builder) drawViewport(node *html.DOMNode, viewBox *domain.Box, aspectRatio string, viewport domain.Box, s state, depth int) {
+	outer := b.viewport
+	if viewBox != nil {
+		align, slice := parseAspectRatio(aspectRatio)
+		s.transform = s.transform.Multiply(fitViewBox(*viewBox, align, slice, viewport))
+		b.viewport = *viewBox
+	} else {
+		s.transform = s.transform.Multiply(domain.Matrix{1, 0, 0, 1, viewport.X, viewport.Y})
+		b.viewport = domain.Box{Width: viewport.Width, Height: viewport.Height}
+	}
+	b.children(node, s, depth)
+	b.viewport = outer
+}
+
+// use draws the element a use element references, offset by its position.
+// Only elements of the same artwork can be referenced.
+func (b *builder) use(node *html.DOMNode, attrs map[string]string, s state, depth int) {
+	id, ok := strings.CutPrefix(strings.TrimSpace(attrs["href"]), "#")
+	target := b.ids[id]
+	if !ok || target == nil || b.using[target] {
+		return
+	}
+	b.using[target] = true
+	defer delete(b.using, target)
+
+	x, y := b.x(attrs["x"], s), b.y(attrs["y"], s)
+	if tagName(target) != "symbol" {
+		s.transform = s.transform.Multiply(domain.Matrix{1, 0, 0, 1, x, y})
+		b.element(target, s, depth)
+		return
+	}
+
+	// A symbol is drawn like an svg element sized by the use element
+	symbol := s
+	if !b.applyProperties(target, &symbol) {
+		return
+	}
+	targetAttrs := attributes(target)
+	viewport := domain.Box{X: x, Y: y, Width: b.viewport.Width, Height: b.viewport.Height}
+	if width, ok := parseLength(attrs["width"], b.viewport.Width, s.font.Size); ok {
+		viewport.Width = width
+	}
+	if height, ok := parseLength(attrs["height"], b.viewport.Height, s.font.Size); ok {
+		viewport.Height = height
+	}
+	b.drawViewport(target, parseViewBox(targetAttrs["viewbox"]), targetAttrs["preserveaspectratio"], viewport, symbol, depth)
+}
+
+// shape adds a path painted with the current fill and stroke
+func (b *builder) shape(path []domain.PathSegment, s state) {
+	if len(path) == 0 || !s.visible {
+		return
+	}
+
+	bounds := pathBounds(path)
+	shape := domain.Shape{
+		Path:          path,
+		Transform:     s.transform,
+		FillRule:      s.fillRule,
+		StrokeWidth:   s.strokeWidth,
+		LineCap:       s.lineCap,
+		LineJoin:      s.lineJoin,
+		MiterLimit:    s.miterLimit,
+		Dash:          s.dash,
+		DashOffset:    s.dashOffset,
+		FillOpacity:   s.fillOpacity * s.opacity,
+		StrokeOpacity: s.strokeOpacity * s.opacity,
+	}
+	shape.Fill = b.paint(s.fill, s.color, bounds)
+	if s.strokeWidth > 0 {
+		shape.Stroke = b.paint(s.stroke, s.color, bounds)
+	}
+	if shape.Fill.IsNone() && shape.Stroke.IsNone() {
+		return
+	}
+	b.shapes = append(b.shapes, shape)
+}
+
+// text adds the lines of a text element. Each tspan positioned with x or y
+// starts a new line at its position; other text continues the line before
+// it, in that line's style.
+func (b *builder) text(node *html.DOMNode, attrs map[string]string, s state) {
+	x, y := b.firstX(attrs["x"], s), b.firstY(attrs["y"], s)
+	x += b.firstLength(attrs["dx"], b.viewport.Width, s)
+	y += b.firstLength(attrs["dy"], b.viewport.Height, s)
+	chunks := []textChunk{{x: x, y: y, state: s}}
+	b.textContent(node, s, &chunks, 0)
+
+	for _, chunk := range chunks {
+		content := strings.Join(strings.Fields(chunk.text), " ")
+		if content == "" || !chunk.state.visible {
+			continue
+		}
+		fill := b.paint(chunk.state.fill, chunk.state.color, textBounds(chunk, content))
+		if fill.IsNone() {
+			continue
+		}
+		b.shapes = append(b.shapes, domain.Shape{
+			Text: &domain.DrawingText{
+				X:       chunk.x,
+				Y:       chunk.y,
+				Content: content,
+				Font:    chunk.state.font,
+				Anchor:  chunk.state.anchor,
+			},
+			Transform:   chunk.state.transform,
+			Fill:        fill,
+			FillOpacity: chunk.state.fillOpacity * chunk.state.opacity,
+		})
+	}
+}
+
+// textBounds estimates the box of a line of text for gradients sized to it,
+// taking glyphs as half as wide as the font size
+func textBounds(chunk textChunk, content string) domain.Box {
+	size := chunk.state.font.Size
+	width := float64(utf8.RuneCountInString(content)) * size / 2
+	x := chunk.x
+	switch chunk.state.anchor {
+	case "middle":
+		x -= width / 2
+	case "end":
+		x -= width
+	}
+	return domain.Box{X: x, Y: chunk.y - size*0.8, Width: width, Height: size}
+}
+
+// textChunk is a line of text being collected
+type textChunk struct {
+	x, y  float64
+	state state
+	text  string
+}
+
+// textContent collects the text of a text or tspan element into lines
+func (b *builder) textContent(node *html.DOMNode, s state, chunks *[]textChunk, depth int) {
+	if depth > maxDepth {
+		return
+	}
+	for _, child := range node.Children {
+		switch {
+		case child.Type == html.TextNode:
+			current := &(*chunks)[len(*chunks)-1]
+			current.text += " " + child.Data
+		case child.Type == html.ElementNode && tagName(child) == "tspan":
+			span := s
+			if !b.applyProperties(child, &span) {
+				continue
+			}
+			attrs := attributes(child)
+			_, hasX := attrs["x"]
+			_, hasY := attrs["y"]
+			if hasX || hasY {
+				last := &(*chunks)[len(*chunks)-1]
+				x, y := last.x, last.y
+				if hasX {
+					x = b.firstX(attrs["x"], span)
+				}
+				if hasY {
+					y = b.firstY(attrs["y"], span)
+				}
+				x += b.firstLength(attrs["dx"], b.viewport.Width, span)
+				y += b.firstLength(attrs["dy"], b.viewport.Height, span)
+				*chunks = append(*chunks, textChunk{x: x, y: y, state: span})
+			}
+			b.textContent(child, span, chunks, depth+1)
+		}
+	}
+}
+
+// rect returns the outline of a rect element, with rounded corners when it
+// sets rx or ry
+func (b *builder) rect(attrs map[string]string, fontSize float64) []domain.PathSegment {
+	x, _ := parseLength(attrs["x"], b.viewport.Width, fontSize)
+	y, _ := parseLength(attrs["y"], b.viewport.Height, fontSize)
+	w, _ := parseLength(attrs["width"], b.viewport.Width, fontSize)
+	h, _ := parseLength(attrs["height"], b.viewport.Height, fontSize)
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+
+	rx, hasRX := parseLength(attrs["rx"], b.viewport.Width, fontSize)
+	ry, hasRY := parseLength(attrs["ry"], b.viewport.Height, fontSize)
+	switch {
+	case !hasRX && hasRY:
+		rx = ry
+	case hasRX && !hasRY:
+		ry = rx
+	}
+	return rectPath(x, y, w, h, math.Min(math.Max(rx, 0), w/2), math.Min(math.Max(ry, 0), h/2))
+}
+
+// x resolves a horizontal coordinate
+func (b *builder) x(value string, s state) float64 {
+	x, _ := parseLength(value, b.viewport.Width, s.font.Size)
+	return x
+}
+
+// y resolves a vertical coordinate
+func (b *builder) y(value string, s state) float64 {
+	y, _ := parseLength(value, b.viewport.Height, s.font.Size)
+	return y
+}
+
+// firstX resolves the first of a list of horizontal text positions
+func (b *builder) firstX(value string, s state) float64 {
+	return b.firstLength(value, b.viewport.Width, s)
+}
+
+// firstY resolves the first of a list of vertical text positions
+func (b *builder) firstY(value string, s state) float64 {
+	return b.firstLength(value, b.viewport.Height, s)
+}
+
+// firstLength resolves the first of a list of lengths; text is placed as
+// one line, so the positions of further characters are not used
+func (b *builder) firstLength(value string, reference float64, s state) float64 {
+	fields := strings.Fields(strings.ReplaceAll(value, ",", " "))
+	if len(fields) == 0 {
+		return 0
+	}
+	length, _ := parseLength(fields[0], reference, s.font.Size)
+	return length
+}
+
+// diagonal is the reference of percentages that are neither horizontal nor vertical
+func (b *builder) diagonal() float64 {
+	return math.Hypot(b.viewport.Width, b.viewport.Height) / math.Sqrt2
+}
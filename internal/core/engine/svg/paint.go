@@ -0,0 +1,236 @@
+package svg
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/css"
+	"print-service/internal/core/engine/html"
+)
+
+// maxGradientReferences limits the chain of gradients one inherits from through href
+const maxGradientReferences = 16
+
+// paint resolves a fill or stroke value for a shape with the given bounds
+// in its user space. A gradient that cannot be used falls back to the color
+// given after its reference, or to none.
+func (b *builder) paint(value string, current domain.Color, bounds domain.Box) domain.Paint {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "none" {
+		return domain.Paint{}
+	}
+
+	if reference, ok := css.ParseURL(strings.Fields(value)[0]); ok || strings.HasPrefix(strings.ToLower(value), "url(") {
+		if ok {
+			if id, local := strings.CutPrefix(reference, "#"); local {
+				if paint, found := b.gradient(b.ids[id], bounds); found {
+					return paint
+				}
+			}
+		}
+		fallback := ""
+		if end := strings.Index(value, ")"); end >= 0 {
+			fallback = strings.TrimSpace(value[end+1:])
+		}
+		if fallback == "" {
+			return domain.Paint{}
+		}
+		value = fallback
+	}
+
+	if c := parseColor(value, current); c != nil && c.A > 0 {
+		return domain.Paint{Color: c}
+	}
+	return domain.Paint{}
+}
+
+// gradient resolves a linear or radial gradient element for a shape. found
+// is false when node is not a gradient; a gradient without stops paints nothing.
+func (b *builder) gradient(node *html.DOMNode, bounds domain.Box) (paint domain.Paint, found bool) {
+	if node == nil {
+		return paint, false
+	}
+	kind := tagName(node)
+	if kind != "lineargradient" && kind != "radialgradient" {
+		return paint, false
+	}
+
+	// Attributes and stops not set on a gradient come from the one it references
+	attrs := make(map[string]string)
+	var stops []*html.DOMNode
+	seen := make(map[*html.DOMNode]bool)
+	for current := node; current != nil && !seen[current] && len(seen) < maxGradientReferences; {
+		seen[current] = true
+		name := tagName(current)
+		if name != "lineargradient" && name != "radialgradient" {
+			break
+		}
+		for key, value := range attributes(current) {
+			if _, ok := attrs[key]; !ok && (name == kind || key == "gradientunits" || key == "gradienttransform") {
+				attrs[key] = value
+			}
+		}
+		if stops == nil {
+			for _, child := range current.Children {
+				if child.Type == html.ElementNode && tagName(child) == "stop" {
+					stops = append(stops, child)
+				}
+			}
+		}
+		id, _ := strings.CutPrefix(strings.TrimSpace(attributes(current)["href"]), "#")
+		current = b.ids[id]
+	}
+
+	gradient := &domain.Gradient{Radial: kind == "radialgradient", Stops: b.stops(stops)}
+	switch len(gradient.Stops) {
+	case 0:
+		return domain.Paint{}, true
+	case 1:
+		stop := gradient.Stops[0]
+		c := stop.Color
+		c.A = uint8(math.Round(float64(c.A) * stop.Opacity))
+		return domain.Paint{Color: &c}, true
+	}
+
+	// Bounding box units are fractions of the shape's bounds
+	transform := domain.Identity
+	width, height := b.viewport.Width, b.viewport.Height
+	if strings.TrimSpace(attrs["gradientunits"]) != "userSpaceOnUse" {
+		if bounds.Width <= 0 || bounds.Height <= 0 {
+			return domain.Paint{}, true
+		}
+		transform = domain.Matrix{bounds.Width, 0, 0, bounds.Height, bounds.X, bounds.Y}
+		width, height = 1, 1
+	}
+	if t, ok := parseTransform(attrs["gradienttransform"]); ok {
+		transform = transform.Multiply(t)
+	}
+	gradient.Transform = transform
+
+	coordinate := func(key string, reference float64, fallback string) float64 {
+		value, ok := attrs[key]
+		if !ok {
+			value = fallback
+		}
+		length, _ := parseLength(value, reference, 16)
+		return length
+	}
+	diagonal := math.Hypot(width, height) / math.Sqrt2
+	if gradient.Radial {
+		gradient.CX = coordinate("cx", width, "50%")
+		gradient.CY = coordinate("cy", height, "50%")
+		gradient.R = coordinate("r", diagonal, "50%")
+		gradient.FX = gradient.CX
+		if _, ok := attrs["fx"]; ok {
+			gradient.FX = coordinate("fx", width, "50%")
+		}
+		gradient.FY = gradient.CY
+		if _, ok := attrs["fy"]; ok {
+			gradient.FY = coordinate("fy", height, "50%")
+		}
+		if gradient.R <= 0 {
+			return lastStop(gradient), true
+		}
+	} else {
+		gradient.X1 = coordinate("x1", width, "0%")
+		gradient.Y1 = coordinate("y1", height, "0%")
+		gradient.X2 = coordinate("x2", width, "100%")
+		gradient.Y2 = coordinate("y2", height, "0%")
+		if gradient.X1 == gradient.X2 && gradient.Y1 == gradient.Y2 {
+			return lastStop(gradient), true
+		}
+	}
+	return domain.Paint{Gradient: gradient}, true
+}
+
+// lastStop paints a gradient whose axis or radius is empty in its last color
+func lastStop(gradient *domain.Gradient) domain.Paint {
+	stop := gradient.Stops[len(gradient.Stops)-1]
+	c := stop.Color
+	c.A = uint8(math.Round(float64(c.A) * stop.Opacity))
+	return domain.Paint{Color: &c}
+}
+
+// stops reads the stops of a gradient. Offsets are clamped to 0 to 1 and
+// never decrease.
+func (b *builder) stops(nodes []*html.DOMNode) []domain.GradientStop {
+	var stops []domain.GradientStop
+	previous := 0.0
+	for _, node := range nodes {
+		props := b.properties(node)
+		offset := 0.0
+		if value := strings.TrimSpace(attributes(node)["offset"]); value != "" {
+			if percent, ok := strings.CutSuffix(value, "%"); ok {
+				offset, _ = strconv.ParseFloat(percent, 64)
+				offset /= 100
+			} else {
+				offset, _ = strconv.ParseFloat(value, 64)
+			}
+		}
+		offset = math.Max(previous, math.Min(1, math.Max(0, offset)))
+		previous = offset
+
+		stop := domain.GradientStop{Offset: offset, Color: domain.Color{A: 255}, Opacity: 1}
+		if value, ok := props["stop-color"]; ok {
+			if c := parseColor(value, b.ctx.Color); c != nil {
+				stop.Color = *c
+			}
+		}
+		if value, ok := props["stop-opacity"]; ok {
+			stop.Opacity = parseOpacity(value, 1)
+		}
+		stops = append(stops, stop)
+	}
+	sort.SliceStable(stops, func(i, j int) bool { return stops[i].Offset < stops[j].Offset })
+	return stops
+}
+
+// parseColor reads a color, resolving currentColor; it returns nil for
+// values that are not colors
+func parseColor(value string, current domain.Color) *domain.Color {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "currentcolor":
+		return &current
+	case "transparent":
+		return &domain.Color{}
+	}
+	if c, ok := css.ParseValue(value).(*domain.Color); ok {
+		return c
+	}
+	return nil
+}
+
+// parseOpacity reads an opacity as a number or percentage, clamped to 0 to 1
+func parseOpacity(value string, fallback float64) float64 {
+	value = strings.TrimSpace(value)
+	scale := 1.0
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		value, scale = percent, 0.01
+	}
+	opacity, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fallback
+	}
+	return math.Max(0, math.Min(1, opacity*scale))
+}
+
+// parseFontWeight reads a font weight keyword or number
+func parseFontWeight(value string, inherited int) int {
+	switch strings.ToLower(value) {
+	case "normal":
+		return 400
+	case "bold":
+		return 700
+	case "bolder":
+		return min(inherited+300, 900)
+	case "lighter":
+		return max(inherited-300, 100)
+	}
+	if weight, err := strconv.Atoi(value); err == nil && weight >= 1 && weight <= 1000 {
+		return weight
+	}
+	return inherited
+}
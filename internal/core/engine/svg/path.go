@@ -0,0 +1,510 @@
+package svg
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"print-service/internal/core/domain"
+)
+
+// kappa places the control points of a cubic curve approximating a quarter circle
+const kappa = 0.5522847498
+
+// Units converted to user units, which are CSS pixels
+var lengthUnits = []struct {
+	suffix string
+	factor float64
+}{
+	{"px", 1},
+	{"pt", 96.0 / 72.0},
+	{"pc", 16},
+	{"in", 96},
+	{"cm", 96 / 2.54},
+	{"mm", 96 / 25.4},
+}
+
+// parseLength resolves a length or percentage in user units. Percentages
+// are of reference and em of fontSize; ok is false when value is not a length.
+func parseLength(value string, reference, fontSize float64) (float64, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return 0, false
+	}
+	if number, ok := strings.CutSuffix(value, "%"); ok {
+		percent, err := strconv.ParseFloat(number, 64)
+		return percent / 100 * reference, err == nil
+	}
+	if number, ok := strings.CutSuffix(value, "rem"); ok {
+		length, err := strconv.ParseFloat(number, 64)
+		return length * 16, err == nil
+	}
+	if number, ok := strings.CutSuffix(value, "em"); ok {
+		length, err := strconv.ParseFloat(number, 64)
+		return length * fontSize, err == nil
+	}
+	for _, unit := range lengthUnits {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			length, err := strconv.ParseFloat(number, 64)
+			return length * unit.factor, err == nil
+		}
+	}
+	length, err := strconv.ParseFloat(value, 64)
+	return length, err == nil
+}
+
+// absoluteLength resolves a width or height attribute of artwork in CSS
+// pixels, returning 0 for percentages and values that are not lengths
+func absoluteLength(value string) float64 {
+	if strings.HasSuffix(strings.TrimSpace(value), "%") {
+		return 0
+	}
+	length, ok := parseLength(value, 0, 16)
+	if !ok || length < 0 {
+		return 0
+	}
+	return length
+}
+
+// parseNumber reads a plain number
+func parseNumber(value string) (float64, bool) {
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return number, err == nil
+}
+
+// parseNumbers reads a list of numbers separated by white space or commas
+func parseNumbers(value string) []float64 {
+	s := &pathScanner{data: value}
+	var numbers []float64
+	for {
+		number, ok := s.number()
+		if !ok {
+			return numbers
+		}
+		numbers = append(numbers, number)
+	}
+}
+
+// parseTransform reads a transform attribute; ok is false when it is
+// missing or invalid, which leaves the element untransformed
+func parseTransform(value string) (domain.Matrix, bool) {
+	transform := domain.Identity
+	rest := strings.TrimSpace(value)
+	if rest == "" {
+		return transform, false
+	}
+
+	for rest != "" {
+		open := strings.Index(rest, "(")
+		end := strings.Index(rest, ")")
+		if open < 0 || end < open {
+			return domain.Identity, false
+		}
+		name := strings.TrimSpace(rest[:open])
+		args := parseNumbers(rest[open+1 : end])
+		rest = strings.TrimLeft(rest[end+1:], " \t\r\n,")
+
+		var m domain.Matrix
+		switch {
+		case name == "matrix" && len(args) == 6:
+			m = domain.Matrix{args[0], args[1], args[2], args[3], args[4], args[5]}
+		case name == "translate" && len(args) == 1:
+			m = domain.Matrix{1, 0, 0, 1, args[0], 0}
+		case name == "translate" && len(args) == 2:
+			m = domain.Matrix{1, 0, 0, 1, args[0], args[1]}
+		case name == "scale" && len(args) == 1:
+			m = domain.Matrix{args[0], 0, 0, args[0], 0, 0}
+		case name == "scale" && len(args) == 2:
+			m = domain.Matrix{args[0], 0, 0, args[1], 0, 0}
+		case name == "rotate" && (len(args) == 1 || len(args) == 3):
+			sin, cos := math.Sincos(args[0] * math.Pi / 180)
+			m = domain.Matrix{cos, sin, -sin, cos, 0, 0}
+			if len(args) == 3 {
+				cx, cy := args[1], args[2]
+				m = domain.Matrix{1, 0, 0, 1, cx, cy}.Multiply(m).Multiply(domain.Matrix{1, 0, 0, 1, -cx, -cy})
+			}
+		case name == "skewX" && len(args) == 1:
+			m = domain.Matrix{1, 0, math.Tan(args[0] * math.Pi / 180), 1, 0, 0}
+		case name == "skewY" && len(args) == 1:
+			m = domain.Matrix{1, math.Tan(args[0] * math.Pi / 180), 0, 1, 0, 0}
+		default:
+			return domain.Identity, false
+		}
+		transform = transform.Multiply(m)
+	}
+	return transform, true
+}
+
+// pathScanner reads the numbers and commands of path data
+type pathScanner struct {
+	data string
+	pos  int
+}
+
+// skip passes white space and a comma
+func (s *pathScanner) skip() {
+	for s.pos < len(s.data) && strings.IndexByte(" \t\r\n", s.data[s.pos]) >= 0 {
+		s.pos++
+	}
+	if s.pos < len(s.data) && s.data[s.pos] == ',' {
+		s.pos++
+		for s.pos < len(s.data) && strings.IndexByte(" \t\r\n", s.data[s.pos]) >= 0 {
+			s.pos++
+		}
+	}
+}
+
+// number reads the next number, which may follow the previous one without
+// a separator as in "1.5.5" or "1-2"
+func (s *pathScanner) number() (float64, bool) {
+	s.skip()
+	start := s.pos
+	i := s.pos
+	if i < len(s.data) && (s.data[i] == '+' || s.data[i] == '-') {
+		i++
+	}
+	digits, dot := false, false
+	for ; i < len(s.data); i++ {
+		c := s.data[i]
+		if c >= '0' && c <= '9' {
+			digits = true
+		} else if c == '.' && !dot {
+			dot = true
+		} else {
+			break
+		}
+	}
+	if !digits {
+		return 0, false
+	}
+	if i < len(s.data) && (s.data[i] == 'e' || s.data[i] == 'E') {
+		j := i + 1
+		if j < len(s.data) && (s.data[j] == '+' || s.data[j] == '-') {
+			j++
+		}
+		if j < len(s.data) && s.data[j] >= '0' && s.data[j] <= '9' {
+			for j < len(s.data) && s.data[j] >= '0' && s.data[j] <= '9' {
+				j++
+			}
+			i = j
+		}
+	}
+	number, err := strconv.ParseFloat(s.data[start:i], 64)
+	if err != nil {
+		return 0, false
+	}
+	s.pos = i
+	return number, true
+}
+
+// flag reads an arc flag, which may be written without a separator
+func (s *pathScanner) flag() (bool, bool) {
+	s.skip()
+	if s.pos < len(s.data) && (s.data[s.pos] == '0' || s.data[s.pos] == '1') {
+		s.pos++
+		return s.data[s.pos-1] == '1', true
+	}
+	return false, false
+}
+
+// command reads the next command letter, if one comes next
+func (s *pathScanner) command() (byte, bool) {
+	s.skip()
+	if s.pos < len(s.data) && strings.IndexByte("MmZzLlHhVvCcSsQqTtAa", s.data[s.pos]) >= 0 {
+		s.pos++
+		return s.data[s.pos-1], true
+	}
+	return 0, false
+}
+
+// parsePath converts path data to absolute moves, lines and cubic curves.
+// Data after an error is ignored, drawing the path up to it.
+func parsePath(data string) []domain.PathSegment {
+	s := &pathScanner{data: data}
+	var path []domain.PathSegment
+	var current, start, control domain.Point
+	var previous byte
+
+	command, ok := s.command()
+	if !ok || (command != 'M' && command != 'm') {
+		return nil
+	}
+	for {
+		relative := command >= 'a'
+		upper := command &^ 0x20
+		offset := domain.Point{}
+		if relative {
+			offset = current
+		}
+		point := func() (domain.Point, bool) {
+			x, ok := s.number()
+			if !ok {
+				return domain.Point{}, false
+			}
+			y, ok := s.number()
+			return domain.Point{X: x + offset.X, Y: y + offset.Y}, ok
+		}
+
+		switch upper {
+		case 'Z':
+			path = append(path, domain.PathSegment{Op: 'Z'})
+			current = start
+		case 'M':
+			p, ok := point()
+			if !ok {
+				return path
+			}
+			path = append(path, domain.PathSegment{Op: 'M', Points: [3]domain.Point{p}})
+			current, start = p, p
+			// Further pairs after a move are lines
+			command = 'L' | (command & 0x20)
+			previous = upper
+			if next, ok := s.command(); ok {
+				command = next
+			} else if s.pos >= len(s.data) {
+				return path
+			}
+			continue
+		case 'L':
+			p, ok := point()
+			if !ok {
+				return path
+			}
+			path = append(path, domain.PathSegment{Op: 'L', Points: [3]domain.Point{p}})
+			current = p
+		case 'H':
+			x, ok := s.number()
+			if !ok {
+				return path
+			}
+			current = domain.Point{X: x + offset.X, Y: current.Y}
+			path = append(path, domain.PathSegment{Op: 'L', Points: [3]domain.Point{current}})
+		case 'V':
+			y, ok := s.number()
+			if !ok {
+				return path
+			}
+			current = domain.Point{X: current.X, Y: y + offset.Y}
+			path = append(path, domain.PathSegment{Op: 'L', Points: [3]domain.Point{current}})
+		case 'C', 'S':
+			var c1 domain.Point
+			if upper == 'C' {
+				if c1, ok = point(); !ok {
+					return path
+				}
+			} else {
+				c1 = current
+				if previous == 'C' || previous == 'S' {
+					c1 = domain.Point{X: 2*current.X - control.X, Y: 2*current.Y - control.Y}
+				}
+			}
+			c2, ok := point()
+			if !ok {
+				return path
+			}
+			p, ok := point()
+			if !ok {
+				return path
+			}
+			path = append(path, domain.PathSegment{Op: 'C', Points: [3]domain.Point{c1, c2, p}})
+			current, control = p, c2
+		case 'Q', 'T':
+			var q domain.Point
+			if upper == 'Q' {
+				if q, ok = point(); !ok {
+					return path
+				}
+			} else {
+				q = current
+				if previous == 'Q' || previous == 'T' {
+					q = domain.Point{X: 2*current.X - control.X, Y: 2*current.Y - control.Y}
+				}
+			}
+			p, ok := point()
+			if !ok {
+				return path
+			}
+			path = append(path, quadratic(current, q, p))
+			current, control = p, q
+		case 'A':
+			rx, ok1 := s.number()
+			ry, ok2 := s.number()
+			rotation, ok3 := s.number()
+			large, ok4 := s.flag()
+			sweep, ok5 := s.flag()
+			p, ok6 := point()
+			if !(ok1 && ok2 && ok3 && ok4 && ok5 && ok6) {
+				return path
+			}
+			path = append(path, arc(current, p, rx, ry, rotation, large, sweep)...)
+			current = p
+		}
+		previous = upper
+
+		// A command repeats while numbers follow it
+		if next, ok := s.command(); ok {
+			command = next
+		} else if s.pos >= len(s.data) || upper == 'Z' {
+			return path
+		}
+	}
+}
+
+// quadratic converts a quadratic curve to a cubic curve
+func quadratic(from, control, to domain.Point) domain.PathSegment {
+	return domain.PathSegment{Op: 'C', Points: [3]domain.Point{
+		{X: from.X + 2.0/3*(control.X-from.X), Y: from.Y + 2.0/3*(control.Y-from.Y)},
+		{X: to.X + 2.0/3*(control.X-to.X), Y: to.Y + 2.0/3*(control.Y-to.Y)},
+		to,
+	}}
+}
+
+// arc converts an elliptical arc to cubic curves of at most a quarter turn
+// each, following the endpoint parameterization of SVG
+func arc(from, to domain.Point, rx, ry, rotation float64, large, sweep bool) []domain.PathSegment {
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 {
+		return []domain.PathSegment{{Op: 'L', Points: [3]domain.Point{to}}}
+	}
+	if from == to {
+		return nil
+	}
+
+	sin, cos := math.Sincos(rotation * math.Pi / 180)
+	dx, dy := (from.X-to.X)/2, (from.Y-to.Y)/2
+	x1 := cos*dx + sin*dy
+	y1 := -sin*dx + cos*dy
+
+	// Radii too small to reach the end point are scaled up
+	if lambda := x1*x1/(rx*rx) + y1*y1/(ry*ry); lambda > 1 {
+		scale := math.Sqrt(lambda)
+		rx, ry = rx*scale, ry*scale
+	}
+
+	numerator := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	denominator := rx*rx*y1*y1 + ry*ry*x1*x1
+	coefficient := math.Sqrt(math.Max(0, numerator/denominator))
+	if large == sweep {
+		coefficient = -coefficient
+	}
+	cx1 := coefficient * rx * y1 / ry
+	cy1 := -coefficient * ry * x1 / rx
+	cx := cos*cx1 - sin*cy1 + (from.X+to.X)/2
+	cy := sin*cx1 + cos*cy1 + (from.Y+to.Y)/2
+
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	start := angle(1, 0, (x1-cx1)/rx, (y1-cy1)/ry)
+	delta := angle((x1-cx1)/rx, (y1-cy1)/ry, (-x1-cx1)/rx, (-y1-cy1)/ry)
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	pointAt := func(theta float64) domain.Point {
+		s, c := math.Sincos(theta)
+		return domain.Point{X: cx + rx*c*cos - ry*s*sin, Y: cy + rx*c*sin + ry*s*cos}
+	}
+	derivative := func(theta float64) domain.Point {
+		s, c := math.Sincos(theta)
+		return domain.Point{X: -rx*s*cos - ry*c*sin, Y: -rx*s*sin + ry*c*cos}
+	}
+
+	segments := int(math.Ceil(math.Abs(delta) / (math.Pi / 2)))
+	step := delta / float64(segments)
+	alpha := 4.0 / 3 * math.Tan(step/4)
+	path := make([]domain.PathSegment, 0, segments)
+	for i := 0; i < segments; i++ {
+		a, b := start+float64(i)*step, start+float64(i+1)*step
+		p0, p1 := pointAt(a), pointAt(b)
+		d0, d1 := derivative(a), derivative(b)
+		if i == segments-1 {
+			p1 = to
+		}
+		path = append(path, domain.PathSegment{Op: 'C', Points: [3]domain.Point{
+			{X: p0.X + alpha*d0.X, Y: p0.Y + alpha*d0.Y},
+			{X: p1.X - alpha*d1.X, Y: p1.Y - alpha*d1.Y},
+			p1,
+		}})
+	}
+	return path
+}
+
+// ellipsePath returns the outline of an ellipse
+func ellipsePath(cx, cy, rx, ry float64) []domain.PathSegment {
+	if rx <= 0 || ry <= 0 {
+		return nil
+	}
+	kx, ky := rx*kappa, ry*kappa
+	return []domain.PathSegment{
+		{Op: 'M', Points: [3]domain.Point{{X: cx + rx, Y: cy}}},
+		{Op: 'C', Points: [3]domain.Point{{X: cx + rx, Y: cy + ky}, {X: cx + kx, Y: cy + ry}, {X: cx, Y: cy + ry}}},
+		{Op: 'C', Points: [3]domain.Point{{X: cx - kx, Y: cy + ry}, {X: cx - rx, Y: cy + ky}, {X: cx - rx, Y: cy}}},
+		{Op: 'C', Points: [3]domain.Point{{X: cx - rx, Y: cy - ky}, {X: cx - kx, Y: cy - ry}, {X: cx, Y: cy - ry}}},
+		{Op: 'C', Points: [3]domain.Point{{X: cx + kx, Y: cy - ry}, {X: cx + rx, Y: cy - ky}, {X: cx + rx, Y: cy}}},
+		{Op: 'Z'},
+	}
+}
+
+// rectPath returns the outline of a rectangle with corners rounded by rx and ry
+func rectPath(x, y, w, h, rx, ry float64) []domain.PathSegment {
+	if rx <= 0 || ry <= 0 {
+		return []domain.PathSegment{
+			{Op: 'M', Points: [3]domain.Point{{X: x, Y: y}}},
+			{Op: 'L', Points: [3]domain.Point{{X: x + w, Y: y}}},
+			{Op: 'L', Points: [3]domain.Point{{X: x + w, Y: y + h}}},
+			{Op: 'L', Points: [3]domain.Point{{X: x, Y: y + h}}},
+			{Op: 'Z'},
+		}
+	}
+	kx, ky := rx*(1-kappa), ry*(1-kappa)
+	return []domain.PathSegment{
+		{Op: 'M', Points: [3]domain.Point{{X: x + rx, Y: y}}},
+		{Op: 'L', Points: [3]domain.Point{{X: x + w - rx, Y: y}}},
+		{Op: 'C', Points: [3]domain.Point{{X: x + w - kx, Y: y}, {X: x + w, Y: y + ky}, {X: x + w, Y: y + ry}}},
+		{Op: 'L', Points: [3]domain.Point{{X: x + w, Y: y + h - ry}}},
+		{Op: 'C', Points: [3]domain.Point{{X: x + w, Y: y + h - ky}, {X: x + w - kx, Y: y + h}, {X: x + w - rx, Y: y + h}}},
+		{Op: 'L', Points: [3]domain.Point{{X: x + rx, Y: y + h}}},
+		{Op: 'C', Points: [3]domain.Point{{X: x + kx, Y: y + h}, {X: x, Y: y + h - ky}, {X: x, Y: y + h - ry}}},
+		{Op: 'L', Points: [3]domain.Point{{X: x, Y: y + ry}}},
+		{Op: 'C', Points: [3]domain.Point{{X: x, Y: y + ky}, {X: x + kx, Y: y}, {X: x + rx, Y: y}}},
+		{Op: 'Z'},
+	}
+}
+
+// polyPath returns the outline through the points of a polyline or polygon
+func polyPath(points string, closed bool) []domain.PathSegment {
+	numbers := parseNumbers(points)
+	var path []domain.PathSegment
+	for i := 0; i+1 < len(numbers); i += 2 {
+		op := byte('L')
+		if i == 0 {
+			op = 'M'
+		}
+		path = append(path, domain.PathSegment{Op: op, Points: [3]domain.Point{{X: numbers[i], Y: numbers[i+1]}}})
+	}
+	if closed && len(path) > 0 {
+		path = append(path, domain.PathSegment{Op: 'Z'})
+	}
+	return path
+}
+
+// pathBounds returns the box around the points of a path, including the
+// control points of its curves
+func pathBounds(path []domain.PathSegment) domain.Box {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, segment := range path {
+		count := map[byte]int{'M': 1, 'L': 1, 'C': 3}[segment.Op]
+		for _, p := range segment.Points[:count] {
+			minX, maxX = math.Min(minX, p.X), math.Max(maxX, p.X)
+			minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+		}
+	}
+	if minX > maxX {
+		return domain.Box{}
+	}
+	return domain.Box{X: minX, Y: minY, Width: maxX - minX, Height: maxY - minY}
+}
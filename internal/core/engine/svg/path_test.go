@@ -0,0 +1,116 @@
+package svg
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+// near reports whether two values agree to within rounding
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 0.001
+}
+
+// formatPath writes path segments compactly, one command per segment
+func formatPath(path []domain.PathSegment) string {
+	var parts []string
+	for _, seg := range path {
+		points := map[byte]int{'M': 1, 'L': 1, 'C': 3, 'Z': 0}[seg.Op]
+		part := string(seg.Op)
+		for _, p := range seg.Points[:points] {
+			part += fmt.Sprintf(" %g,%g", math.Round(p.X*100)/100, math.Round(p.Y*100)/100)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " | ")
+}
+
+func TestParseLength(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   float64
+		wantOK bool
+	}{
+		{"12", 12, true},
+		{" 12px ", 12, true},
+		{"1in", 96, true},
+		{"25.4mm", 96, true},
+		{"72pt", 96, true},
+		{"2em", 20, true},
+		{"2rem", 32, true},
+		{"50%", 100, true},
+		{"1e1", 10, true},
+		{"", 0, false},
+		{"auto", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseLength(tt.value, 200, 10)
+		if !near(got, tt.want) || ok != tt.wantOK {
+			t.Errorf("parseLength(%q) = %g, %v; want %g, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestParseTransform(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   domain.Matrix
+		wantOK bool
+	}{
+		{"translate(10 20)", domain.Matrix{1, 0, 0, 1, 10, 20}, true},
+		{"translate(10)", domain.Matrix{1, 0, 0, 1, 10, 0}, true},
+		{"scale(2)", domain.Matrix{2, 0, 0, 2, 0, 0}, true},
+		{"rotate(90)", domain.Matrix{0, 1, -1, 0, 0, 0}, true},
+		{"translate(10,0) scale(2, 3)", domain.Matrix{2, 0, 0, 3, 10, 0}, true},
+		{"matrix(1 2 3 4 5 6)", domain.Matrix{1, 2, 3, 4, 5, 6}, true},
+		{"", domain.Identity, false},
+		{"spin(45)", domain.Identity, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseTransform(tt.value)
+		same := ok == tt.wantOK
+		for i := range got {
+			same = same && near(got[i], tt.want[i])
+		}
+		if !same {
+			t.Errorf("parseTransform(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"absolute lines", "M 10 10 L 20 10 L 20 20 Z", "M 10,10 | L 20,10 | L 20,20 | Z"},
+		{"relative and implicit commands", "m10,10 10,0 0,10 h-10 v-10z", "M 10,10 | L 20,10 | L 20,20 | L 10,20 | L 10,10 | Z"},
+		{"compact numbers", "M1.5.5L-2-3", "M 1.5,0.5 | L -2,-3"},
+		{"cubic curves", "M0 0C10 0 20 10 20 20S30 40 40 40", "M 0,0 | C 10,0 20,10 20,20 | C 20,30 30,40 40,40"},
+		{"quadratic curves become cubic", "M0 0Q30 0 30 30", "M 0,0 | C 20,0 30,10 30,30"},
+		{"error keeps the path so far", "M0 0L10 10L20 x", "M 0,0 | L 10,10"},
+		{"must start with a move", "L10 10", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatPath(parsePath(tt.data)); got != tt.want {
+				t.Errorf("parsePath(%q) = %s, want %s", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePathArc(t *testing.T) {
+	// A half circle of radius 10 ends where it should and stays on the circle
+	path := parsePath("M0 10A10 10 0 0 1 20 10")
+	last := path[len(path)-1]
+	if last.Op != 'C' || !near(last.Points[2].X, 20) || !near(last.Points[2].Y, 10) {
+		t.Fatalf("arc = %s, want curves ending at 20,10", formatPath(path))
+	}
+	bounds := pathBounds(path)
+	if !near(bounds.X, 0) || !near(bounds.Width, 20) || bounds.Y > 0.5 || !near(bounds.Y+bounds.Height, 10) {
+		t.Errorf("arc bounds = %+v, want the upper half of the circle around 10,10", bounds)
+	}
+}
@@ -0,0 +1,258 @@
+package svg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/css"
+	"print-service/internal/core/engine/html"
+)
+
+// Limits on the artwork converted
+const (
+	maxDepth      = 256   // Nesting of elements and use references followed
+	maxElements   = 50000 // Elements read from an SVG file
+	defaultWidth  = 300   // Width of artwork that sets neither a size nor a view box
+	defaultHeight = 150   // Height of artwork that sets neither a size nor a view box
+)
+
+// Matcher returns the declarations of the rules of a style sheet that apply
+// to an element, in style sheet order
+type Matcher func(stylesheet *css.Stylesheet, node *html.DOMNode) []*css.Declaration
+
+// Context is what artwork inherits from the document it is drawn in
+type Context struct {
+	Stylesheet *css.Stylesheet  // Rules that may style the elements of the artwork, nil for none
+	Match      Matcher          // Finds the rules of the style sheet that apply to an element
+	Color      domain.Color     // Color currentColor refers to
+	Font       domain.FontStyle // Font text is drawn in unless the artwork sets another
+}
+
+// Build converts an svg element and its content into a drawing
+func Build(root *html.DOMNode, ctx Context) *domain.Drawing {
+	b := &builder{ctx: ctx, ids: make(map[string]*html.DOMNode), using: make(map[*html.DOMNode]bool)}
+	b.index(root, 0)
+
+	attrs := attributes(root)
+	drawing := &domain.Drawing{}
+	drawing.ViewBox = parseViewBox(attrs["viewbox"])
+	drawing.Align, drawing.Slice = parseAspectRatio(attrs["preserveaspectratio"])
+	drawing.Width, drawing.Height = intrinsicSize(attrs, drawing.ViewBox)
+	for _, child := range root.Children {
+		if child.Type == html.ElementNode && tagName(child) == "title" {
+			drawing.Title = strings.Join(strings.Fields(child.TextContent()), " ")
+			break
+		}
+	}
+
+	b.viewport = domain.Box{Width: drawing.Width, Height: drawing.Height}
+	if drawing.ViewBox != nil {
+		b.viewport = *drawing.ViewBox
+	}
+
+	state := initialState(ctx)
+	b.applyProperties(root, &state)
+	b.children(root, state, 0)
+	drawing.Shapes = b.shapes
+	return drawing
+}
+
+// Decode reads an SVG file into a drawing. Its style elements style it;
+// references to other files are not followed.
+func Decode(data []byte, match Matcher) (*domain.Drawing, error) {
+	root, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var styles strings.Builder
+	for _, style := range root.GetElementsByTagName("style") {
+		styles.WriteString(style.TextContent())
+		styles.WriteString("\n")
+	}
+	stylesheet, err := css.NewParser(false).Parse(styles.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid SVG style sheet: %w", err)
+	}
+
+	return Build(root, Context{
+		Stylesheet: stylesheet,
+		Match:      match,
+		Color:      domain.Color{A: 255},
+		Font:       domain.FontStyle{Family: "serif", Size: 16, Weight: 400, Style: "normal"},
+	}), nil
+}
+
+// IsSVG reports whether data looks like an SVG file: markup with an svg
+// element near its start
+func IsSVG(data []byte) bool {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	head := bytes.TrimSpace(data[:min(len(data), 4096)])
+	return bytes.HasPrefix(head, []byte("<")) && bytes.Contains(bytes.ToLower(head), []byte("<svg"))
+}
+
+// parseDocument reads the XML of an SVG file into a DOM tree whose root is
+// the svg element
+func parseDocument(data []byte) (*html.DOMNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	var root, current *html.DOMNode
+	elements := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SVG: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if elements++; elements > maxElements {
+				return nil, fmt.Errorf("SVG has more than %d elements", maxElements)
+			}
+			node := &html.DOMNode{Type: html.ElementNode, Data: t.Name.Local, Namespace: "svg", Attributes: make(map[string]string), Parent: current}
+			for _, attr := range t.Attr {
+				node.Attributes[attr.Name.Local] = attr.Value
+			}
+			switch {
+			case current != nil:
+				current.Children = append(current.Children, node)
+			case root == nil:
+				if !strings.EqualFold(t.Name.Local, "svg") {
+					return nil, fmt.Errorf("document element is %s, not svg", t.Name.Local)
+				}
+				root = node
+			default:
+				return nil, fmt.Errorf("SVG has content after its document element")
+			}
+			current = node
+		case xml.EndElement:
+			if current != nil {
+				current = current.Parent
+			}
+		case xml.CharData:
+			if current != nil {
+				current.Children = append(current.Children, &html.DOMNode{Type: html.TextNode, Data: string(t), Parent: current})
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("SVG has no svg element")
+	}
+	return root, nil
+}
+
+// Fit returns the transformation that draws the user space of a drawing in
+// a box, as its view box and preserveAspectRatio place it. Without a view
+// box, user units stay CSS pixels from the top-left corner of the box.
+func Fit(drawing *domain.Drawing, box domain.Box) domain.Matrix {
+	if drawing.ViewBox == nil {
+		return domain.Matrix{1, 0, 0, 1, box.X, box.Y}
+	}
+	return fitViewBox(*drawing.ViewBox, drawing.Align, drawing.Slice, box)
+}
+
+// fitViewBox maps a view box into a viewport
+func fitViewBox(view domain.Box, align string, slice bool, viewport domain.Box) domain.Matrix {
+	if view.Width <= 0 || view.Height <= 0 {
+		return domain.Matrix{0, 0, 0, 0, viewport.X, viewport.Y}
+	}
+	sx, sy := viewport.Width/view.Width, viewport.Height/view.Height
+	if align == "none" {
+		return domain.Matrix{sx, 0, 0, sy, viewport.X - view.X*sx, viewport.Y - view.Y*sy}
+	}
+
+	scale := math.Min(sx, sy)
+	if slice {
+		scale = math.Max(sx, sy)
+	}
+	x := viewport.X - view.X*scale
+	y := viewport.Y - view.Y*scale
+	switch {
+	case strings.HasPrefix(align, "xMid"):
+		x += (viewport.Width - view.Width*scale) / 2
+	case strings.HasPrefix(align, "xMax"):
+		x += viewport.Width - view.Width*scale
+	}
+	switch {
+	case strings.HasSuffix(align, "YMid"):
+		y += (viewport.Height - view.Height*scale) / 2
+	case strings.HasSuffix(align, "YMax"):
+		y += viewport.Height - view.Height*scale
+	}
+	return domain.Matrix{scale, 0, 0, scale, x, y}
+}
+
+// intrinsicSize returns the size of artwork in CSS pixels from its width and
+// height attributes, completing a missing one from the view box
+func intrinsicSize(attrs map[string]string, viewBox *domain.Box) (float64, float64) {
+	width := absoluteLength(attrs["width"])
+	height := absoluteLength(attrs["height"])
+	if viewBox == nil || viewBox.Width <= 0 || viewBox.Height <= 0 {
+		if width <= 0 {
+			width = defaultWidth
+		}
+		if height <= 0 {
+			height = defaultHeight
+		}
+		return width, height
+	}
+
+	switch {
+	case width > 0 && height > 0:
+	case width > 0:
+		height = width * viewBox.Height / viewBox.Width
+	case height > 0:
+		width = height * viewBox.Width / viewBox.Height
+	default:
+		width, height = viewBox.Width, viewBox.Height
+	}
+	return width, height
+}
+
+// parseViewBox reads a viewBox attribute, returning nil when it is missing or invalid
+func parseViewBox(value string) *domain.Box {
+	numbers := parseNumbers(value)
+	if len(numbers) != 4 || numbers[2] <= 0 || numbers[3] <= 0 {
+		return nil
+	}
+	return &domain.Box{X: numbers[0], Y: numbers[1], Width: numbers[2], Height: numbers[3]}
+}
+
+// parseAspectRatio reads a preserveAspectRatio attribute
+func parseAspectRatio(value string) (align string, slice bool) {
+	fields := strings.Fields(value)
+	align = "xMidYMid"
+	if len(fields) > 0 {
+		switch fields[0] {
+		case "none", "xMinYMin", "xMidYMin", "xMaxYMin", "xMinYMid", "xMidYMid", "xMaxYMid", "xMinYMax", "xMidYMax", "xMaxYMax":
+			align = fields[0]
+		}
+	}
+	return align, len(fields) > 1 && fields[1] == "slice"
+}
+
+// attributes returns the attributes of an element with lower-cased names.
+// The HTML parser keeps the SVG spelling of names such as viewBox.
+func attributes(node *html.DOMNode) map[string]string {
+	attrs := make(map[string]string, len(node.Attributes))
+	for key, value := range node.Attributes {
+		attrs[strings.ToLower(key)] = value
+	}
+	return attrs
+}
+
+// tagName returns the lower-cased name of an element
+func tagName(node *html.DOMNode) string {
+	return strings.ToLower(node.Data)
+}
@@ -0,0 +1,157 @@
+package svg
+
+import (
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+// decode reads an SVG file, failing the test when it cannot be read
+func decode(t *testing.T, data string) *domain.Drawing {
+	t.Helper()
+	drawing, err := Decode([]byte(data), nil)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	return drawing
+}
+
+func TestDecode(t *testing.T) {
+	drawing := decode(t, `<?xml version="1.0"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="2in" viewBox="0 0 100 50">
+  <title>Sales  chart</title>
+  <g fill="red" stroke="#00f" stroke-width="2" opacity="0.5">
+    <rect x="10" y="10" width="30" height="20"/>
+    <circle cx="70" cy="25" r="10" fill="none" style="stroke-dasharray: 4 2"/>
+    <line x1="0" y1="0" x2="100" y2="50" display="none"/>
+  </g>
+  <text x="50" y="45" text-anchor="middle" font-size="8">Q1 &amp; Q2</text>
+</svg>`)
+
+	if drawing.Width != 192 || drawing.Height != 96 {
+		t.Errorf("size = %gx%g, want 192x96 from the width and the view box", drawing.Width, drawing.Height)
+	}
+	if drawing.ViewBox == nil || *drawing.ViewBox != (domain.Box{Width: 100, Height: 50}) || drawing.Align != "xMidYMid" {
+		t.Errorf("view box = %v %s, want 0 0 100 50 xMidYMid", drawing.ViewBox, drawing.Align)
+	}
+	if drawing.Title != "Sales chart" {
+		t.Errorf("Title = %q, want Sales chart", drawing.Title)
+	}
+	if len(drawing.Shapes) != 3 {
+		t.Fatalf("%d shapes, want the rectangle, circle and text", len(drawing.Shapes))
+	}
+
+	rect, circle, text := drawing.Shapes[0], drawing.Shapes[1], drawing.Shapes[2]
+	if rect.Fill.Color == nil || *rect.Fill.Color != (domain.Color{R: 255, A: 255}) || rect.FillOpacity != 0.5 {
+		t.Errorf("rectangle fill = %v at %g, want red inherited from the group at 0.5", rect.Fill.Color, rect.FillOpacity)
+	}
+	if rect.Stroke.Color == nil || *rect.Stroke.Color != (domain.Color{B: 255, A: 255}) || rect.StrokeWidth != 2 {
+		t.Errorf("rectangle stroke = %v %g, want blue 2", rect.Stroke.Color, rect.StrokeWidth)
+	}
+	if got := formatPath(rect.Path); got != "M 10,10 | L 40,10 | L 40,30 | L 10,30 | Z" {
+		t.Errorf("rectangle path = %s", got)
+	}
+	if !circle.Fill.IsNone() || len(circle.Dash) != 2 || circle.Dash[0] != 4 {
+		t.Errorf("circle fill %v dash %v, want no fill and the dash from its style", circle.Fill, circle.Dash)
+	}
+	if bounds := pathBounds(circle.Path); !near(bounds.X, 60) || !near(bounds.Width, 20) {
+		t.Errorf("circle bounds = %+v, want 20 wide from x=60", bounds)
+	}
+	if text.Text == nil || text.Text.Content != "Q1 & Q2" || text.Text.Anchor != "middle" || text.Text.Font.Size != 8 {
+		t.Errorf("text = %+v, want Q1 & Q2 centred in 8px", text.Text)
+	}
+}
+
+func TestDecodeGradientAndUse(t *testing.T) {
+	drawing := decode(t, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="100" height="100">
+  <defs>
+    <linearGradient id="fade"><stop offset="0" stop-color="white"/><stop offset="1" stop-color="black" stop-opacity="0.5"/></linearGradient>
+    <linearGradient id="solid"><stop offset="0.5" stop-color="green"/></linearGradient>
+    <rect id="tile" width="10" height="10"/>
+  </defs>
+  <rect x="20" y="0" width="50" height="10" fill="url(#fade)"/>
+  <rect width="10" height="10" fill="url(#solid)"/>
+  <rect width="10" height="10" fill="url(#missing) #ffa500"/>
+  <use xlink:href="#tile" x="30" y="40" fill="#800080"/>
+</svg>`)
+	if len(drawing.Shapes) != 4 {
+		t.Fatalf("%d shapes, want 4", len(drawing.Shapes))
+	}
+
+	fade := drawing.Shapes[0].Fill.Gradient
+	if fade == nil || len(fade.Stops) != 2 || fade.Stops[1].Opacity != 0.5 {
+		t.Fatalf("gradient fill = %+v, want two stops", fade)
+	}
+	// Bounding box units stretch the gradient over the shape
+	if fade.X1 != 0 || fade.X2 != 1 || fade.Transform != (domain.Matrix{50, 0, 0, 10, 20, 0}) {
+		t.Errorf("gradient axis %g-%g in %v, want 0-1 over the shape's bounds", fade.X1, fade.X2, fade.Transform)
+	}
+	if c := drawing.Shapes[1].Fill.Color; c == nil || *c != (domain.Color{G: 128, A: 255}) {
+		t.Errorf("single stop gradient fill = %v, want solid green", c)
+	}
+	if c := drawing.Shapes[2].Fill.Color; c == nil || *c != (domain.Color{R: 255, G: 165, A: 255}) {
+		t.Errorf("missing gradient fill = %v, want the fallback color", c)
+	}
+	use := drawing.Shapes[3]
+	if c := use.Fill.Color; c == nil || *c != (domain.Color{R: 128, B: 128, A: 255}) || use.Transform != (domain.Matrix{1, 0, 0, 1, 30, 40}) {
+		t.Errorf("used rectangle fill %v at %v, want the use element's fill, moved to 30,40", c, use.Transform)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"not XML", "<svg><g></svg", "invalid SVG"},
+		{"no svg element", "<html></html>", "not svg"},
+		{"empty", "", "no svg element"},
+		{"too many elements", "<svg>" + strings.Repeat("<g/>", maxElements) + "</svg>", "more than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode([]byte(tt.data), nil); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Decode() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSVG(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{`<svg xmlns="http://www.w3.org/2000/svg"/>`, true},
+		{"\xef\xbb\xbf<?xml version=\"1.0\"?>\n<!-- logo -->\n<SVG></SVG>", true},
+		{"\x89PNG\r\n\x1a\n", false},
+		{"<html><body></body></html>", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsSVG([]byte(tt.data)); got != tt.want {
+			t.Errorf("IsSVG(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	box := domain.Box{X: 10, Y: 20, Width: 200, Height: 100}
+	view := &domain.Box{Width: 50, Height: 50}
+	tests := []struct {
+		name    string
+		drawing domain.Drawing
+		want    domain.Matrix
+	}{
+		{"no view box", domain.Drawing{}, domain.Matrix{1, 0, 0, 1, 10, 20}},
+		{"meet, centred", domain.Drawing{ViewBox: view, Align: "xMidYMid"}, domain.Matrix{2, 0, 0, 2, 60, 20}},
+		{"meet, at the end", domain.Drawing{ViewBox: view, Align: "xMaxYMax"}, domain.Matrix{2, 0, 0, 2, 110, 20}},
+		{"slice", domain.Drawing{ViewBox: view, Align: "xMinYMin", Slice: true}, domain.Matrix{4, 0, 0, 4, 10, 20}},
+		{"stretch", domain.Drawing{ViewBox: view, Align: "none"}, domain.Matrix{4, 0, 0, 2, 10, 20}},
+	}
+	for _, tt := range tests {
+		if got := Fit(&tt.drawing, box); got != tt.want {
+			t.Errorf("Fit(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
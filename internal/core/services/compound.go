@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/css"
+	"print-service/internal/core/engine/html"
+	"print-service/internal/core/engine/layout"
+	"print-service/internal/core/engine/render"
+)
+
+// compoundPart is a part of a compound job prepared for rendering
+type compoundPart struct {
+	options    domain.PrintOptions     // Job options with the part's page options
+	dom        *html.DOMNode           // Content of an HTML or image part, nil for a PDF part
+	stylesheet *css.Stylesheet         // Style sheet of an HTML part
+	images     *render.ImageCache      // Images loaded for the content
+	running    *layout.RunningContent  // Headers and footers of the part
+	metadata   domain.DocumentMetadata // Job metadata completed from the part's head
+	file       []byte                  // Uploaded file of a PDF part
+	offset     int                     // Pages of the parts before this one
+	pages      int                     // Pages of the part
+}
+
+// validateParts checks the parts of a compound job, which can only be
+// rendered as a plain PDF: the structure trees of tagged and archival output
+// and signatures cover a single rendered document.
+func validateParts(doc *domain.Document) error {
+	if doc.Content != "" {
+		return domain.NewPrintError(domain.ErrCodeInvalidInput, "a document has either content or parts", domain.ErrInvalidDocument)
+	}
+
+	options := doc.Options
+	unsupported := ""
+	switch {
+	case options.Output.Format != domain.FormatPDF && options.Output.Format != "":
+		unsupported = string(options.Output.Format) + " output"
+	case options.Render.Accessibility:
+		unsupported = "accessibility"
+	case options.Render.PDFA != "":
+		unsupported = "PDF/A"
+	case options.Output.Signature != nil:
+		unsupported = "signatures"
+	}
+	if unsupported != "" {
+		return domain.NewPrintError(domain.ErrCodeInvalidInput, "document parts cannot be combined with "+unsupported, domain.ErrUnsupportedFormat)
+	}
+
+	for i, part := range doc.Parts {
+		if part.Content == "" {
+			return domain.NewPrintError(domain.ErrCodeInvalidInput, "document part is empty", domain.ErrInvalidDocument).
+				WithDetail("part", i+1)
+		}
+		switch part.ContentType {
+		case "", domain.ContentTypeHTML, domain.ContentTypeMarkdown, domain.ContentTypeText, domain.ContentTypePDF, domain.ContentTypeImage:
+		default:
+			return domain.NewPrintError(domain.ErrCodeInvalidInput, "unsupported document part content type", domain.ErrUnsupportedFormat).
+				WithDetail("part", i+1).
+				WithDetail("content_type", part.ContentType)
+		}
+	}
+	return nil
+}
+
+// renderParts renders the parts of a compound job and merges them into one
+// PDF. Pages are numbered across the parts, so headers, footers and page
+// references of each part count the pages of the whole job.
+func (ps *PrintService) renderParts(ctx context.Context, doc *domain.Document) (*render.RenderOutput, error) {
+	// Every part is laid out before any is rendered, as page numbers depend
+	// on the page counts of the parts before
+	parts := make([]*compoundPart, len(doc.Parts))
+	total := 0
+	for i, part := range doc.Parts {
+		prepared, err := ps.preparePart(ctx, doc, part)
+		if err != nil {
+			return nil, fmt.Errorf("document part %d: %w", i+1, err)
+		}
+		prepared.offset = total
+		total += prepared.pages
+		parts[i] = prepared
+	}
+
+	// Properties the request leaves empty are taken from the heads of the
+	// HTML parts, earlier parts first
+	metadata := doc.Metadata
+	files := make([]render.MergePart, len(parts))
+	var warnings []string
+	for i, part := range parts {
+		files[i] = render.MergePart{Data: part.file, Title: doc.Parts[i].Title}
+		if part.dom == nil {
+			if doc.Options.Output.Watermark.Visible() {
+				warnings = append(warnings, fmt.Sprintf("document part %d: watermarks are not drawn on PDF parts", i+1))
+			}
+			continue
+		}
+		metadata = metadata.WithDefaults(part.metadata)
+
+		output, err := ps.renderPart(part, layout.PageNumbering{Offset: part.offset, Total: total})
+		if err != nil {
+			return nil, fmt.Errorf("document part %d: %w", i+1, err)
+		}
+		files[i].Data = output.Data
+		for _, warning := range append(part.images.Warnings(), output.Warnings...) {
+			warnings = append(warnings, fmt.Sprintf("document part %d: %s", i+1, warning))
+		}
+	}
+	for _, warning := range warnings {
+		ps.logger.Warn("Document part warning", "document_id", doc.ID, "warning", warning)
+	}
+
+	output, err := render.MergePDFs(files, metadata, doc.Options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge document parts: %w", err)
+	}
+	output.Warnings = append(warnings, output.Warnings...)
+	return output, nil
+}
+
+// preparePart reads a part and counts its pages. HTML and image parts are
+// laid out to be paginated; they are laid out again when rendered, as
+// pagination changes the layout tree.
+func (ps *PrintService) preparePart(ctx context.Context, doc *domain.Document, part domain.DocumentPart) (*compoundPart, error) {
+	options := doc.Options
+	if part.Page != nil {
+		options.Page = *part.Page
+	}
+	options.Output.Encryption = nil // The merged document is encrypted as a whole
+	prepared := &compoundPart{options: options}
+
+	switch part.ContentType {
+	case domain.ContentTypePDF:
+		file, err := decodePartFile(part.Content, "application/pdf")
+		if err != nil {
+			return nil, err
+		}
+		pages, err := render.CountPDFPages(file)
+		if err != nil {
+			return nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "unreadable PDF part", domain.ErrInvalidDocument).
+				WithDetail("error", err.Error())
+		}
+		prepared.file, prepared.pages = file, pages
+		return prepared, nil
+	case domain.ContentTypeImage:
+		dom, err := ps.imagePartContent(part.Content, options)
+		if err != nil {
+			return nil, err
+		}
+		prepared.dom, prepared.stylesheet = dom, &css.Stylesheet{}
+	default:
+		dom, err := ps.parseHTML(part.Content, options.Security)
+		if err != nil {
+			return nil, fmt.Errorf("HTML parsing failed: %w", err)
+		}
+		layout.InsertTableOfContents(dom, options.Layout.TableOfContents)
+		if prepared.stylesheet, err = ps.parseCSS(part.Content, options.Security); err != nil {
+			return nil, fmt.Errorf("CSS parsing failed: %w", err)
+		}
+		prepared.dom = dom
+	}
+
+	prepared.images = render.LoadImages(ctx, prepared.dom, prepared.stylesheet, options, ps.config.MaxImagePixels)
+	prepared.metadata = doc.Metadata.WithDefaults(html.ExtractMetadata(prepared.dom))
+	running, err := ps.runningContent(ctx, prepared.stylesheet, options, prepared.metadata.Title)
+	if err != nil {
+		return nil, fmt.Errorf("header and footer parsing failed: %w", err)
+	}
+	prepared.running = running
+
+	layoutTree, _, err := ps.layoutEngine.CalculateLayout(prepared.dom, prepared.stylesheet, ps.layoutOptions(options), prepared.images)
+	if err != nil {
+		return nil, fmt.Errorf("layout calculation failed: %w", err)
+	}
+	page := render.ResolvePageGeometry(options.Page)
+	pageBreaks, err := layout.NewPageBreaker().CalculatePageBreaks(layoutTree, page.ContentHeightPixels())
+	if err != nil {
+		return nil, fmt.Errorf("layout calculation failed: %w", err)
+	}
+	prepared.pages = len(pageBreaks)
+	return prepared, nil
+}
+
+// renderPart renders an HTML or image part as a PDF with its pages numbered
+func (ps *PrintService) renderPart(part *compoundPart, numbering layout.PageNumbering) (*render.RenderOutput, error) {
+	layoutTree, warnings, err := ps.layoutEngine.CalculateLayout(part.dom, part.stylesheet, ps.layoutOptions(part.options), part.images)
+	if err != nil {
+		return nil, fmt.Errorf("layout calculation failed: %w", err)
+	}
+	output, err := ps.pdfRenderer.RenderPart(layoutTree, part.running, part.options, part.metadata, numbering)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate PDF content: %w", err)
+	}
+	if output.PageCount != part.pages {
+		return nil, domain.NewPrintError(domain.ErrCodeInternal, "document part changed its page count", domain.ErrRenderFailed).
+			WithDetail("pages", output.PageCount).
+			WithDetail("expected_pages", part.pages)
+	}
+	output.Warnings = append(append(warnings, part.running.Warnings()...), output.Warnings...)
+	return output, nil
+}
+
+// imagePartTemplate shows an image on a page of its own, centred in the content area
+const imagePartTemplate = `<html><body style="margin: 0"><img src="%s" alt="" style="display: block; margin: 0 0 0 %.2fpx; width: %.2fpx; height: %.2fpx"></body></html>`
+
+// attributeEscaper escapes text for a double-quoted HTML attribute
+var attributeEscaper = strings.NewReplacer(`&`, "&amp;", `"`, "&quot;", `<`, "&lt;")
+
+// imagePartContent creates the content of an image part: the image scaled
+// to fit the content area of its page
+func (ps *PrintService) imagePartContent(uri string, options domain.PrintOptions) (*html.DOMNode, error) {
+	file, err := decodePartFile(uri, "image/")
+	if err != nil {
+		return nil, err
+	}
+	img, err := render.NewImageCache(ps.config.MaxImagePixels).Add("part", file)
+	if err != nil {
+		return nil, err
+	}
+
+	page := render.ResolvePageGeometry(options.Page)
+	width, height := page.ContentWidthPixels(), page.ContentHeightPixels()
+	scale := math.Min(width/float64(img.Width), height/float64(img.Height))
+	// Sizes are rounded down so the image cannot spill onto a second page
+	imageWidth := math.Floor(float64(img.Width) * scale)
+	imageHeight := math.Floor(float64(img.Height) * scale)
+
+	content := fmt.Sprintf(imagePartTemplate, attributeEscaper.Replace(uri), (width-imageWidth)/2, imageWidth, imageHeight)
+	dom, err := ps.parseHTML(content, options.Security)
+	if err != nil {
+		return nil, fmt.Errorf("HTML parsing failed: %w", err)
+	}
+	return dom, nil
+}
+
+// decodePartFile decodes the data URI of a PDF or image part, checking its
+// media type starts with the expected one
+func decodePartFile(uri, mediaType string) ([]byte, error) {
+	actual, data, err := render.DecodeDataURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(actual, mediaType) {
+		return nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "document part has the wrong media type", domain.ErrUnsupportedFormat).
+			WithDetail("media_type", actual).
+			WithDetail("expected", mediaType)
+	}
+	return data, nil
+}
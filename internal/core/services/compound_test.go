@@ -0,0 +1,179 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+	"print-service/internal/core/engine/render"
+	"print-service/internal/infrastructure/logger"
+	"print-service/internal/pkg/config"
+)
+
+// newTestService creates a print service writing its output to a temporary directory
+func newTestService(t *testing.T) *PrintService {
+	t.Helper()
+	lg := logger.NewStructuredLogger(&config.LoggerConfig{Level: "error", Format: "text", Output: "stdout"})
+	ps, err := NewPrintService(config.PrintConfig{MaxFileSize: 1 << 24, OutputDirectory: t.TempDir()}, lg)
+	if err != nil {
+		t.Fatalf("NewPrintService() error = %v", err)
+	}
+	return ps
+}
+
+// onePagePDF returns the data URI of a minimal one-page PDF
+func onePagePDF() string {
+	objects := []string{
+		"<</Type /Catalog /Pages 2 0 R>>",
+		"<</Type /Pages /Kids [3 0 R] /Count 1>>",
+		"<</Type /Page /Parent 2 0 R /MediaBox [0 0 595 842]>>",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, body := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<</Size %d /Root 1 0 R>>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return "data:application/pdf;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// pngDataURI returns the data URI of a blank PNG image
+func pngDataURI(width, height int) string {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)))
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// streamPattern matches the data of PDF streams
+var streamPattern = regexp.MustCompile(`(?s)stream\r?\n(.*?)\r?\nendstream`)
+
+// pdfContentText returns the inflated data of every compressed stream of a file
+func pdfContentText(data []byte) string {
+	var text strings.Builder
+	for _, match := range streamPattern.FindAllSubmatch(data, -1) {
+		reader, err := zlib.NewReader(bytes.NewReader(match[1]))
+		if err != nil {
+			continue
+		}
+		inflated, _ := io.ReadAll(reader)
+		text.Write(inflated)
+	}
+	return text.String()
+}
+
+func TestValidateParts(t *testing.T) {
+	part := []domain.DocumentPart{{Content: "<p>Part</p>"}}
+	tests := []struct {
+		name    string
+		doc     domain.Document
+		wantErr bool
+	}{
+		{"HTML parts", domain.Document{Parts: part}, false},
+		{"all content types", domain.Document{Parts: []domain.DocumentPart{
+			{Content: "<p>Part</p>", ContentType: domain.ContentTypeHTML},
+			{Content: "# Part", ContentType: domain.ContentTypeMarkdown},
+			{Content: "Part", ContentType: domain.ContentTypeText},
+			{Content: onePagePDF(), ContentType: domain.ContentTypePDF},
+			{Content: pngDataURI(2, 2), ContentType: domain.ContentTypeImage},
+		}}, false},
+		{"content and parts", domain.Document{Content: "<p>Content</p>", Parts: part}, true},
+		{"empty part", domain.Document{Parts: []domain.DocumentPart{{}}}, true},
+		{"unknown content type", domain.Document{Parts: []domain.DocumentPart{{Content: "x", ContentType: "docx"}}}, true},
+		{"image output", domain.Document{Parts: part, Options: domain.PrintOptions{Output: domain.OutputOptions{Format: domain.FormatPNG}}}, true},
+		{"accessibility", domain.Document{Parts: part, Options: domain.PrintOptions{Render: domain.RenderOptions{Accessibility: true}}}, true},
+		{"PDF/A", domain.Document{Parts: part, Options: domain.PrintOptions{Render: domain.RenderOptions{PDFA: domain.PDFA2B}}}, true},
+		{"signature", domain.Document{Parts: part, Options: domain.PrintOptions{Output: domain.OutputOptions{Signature: &domain.Signature{}}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateParts(&tt.doc)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateParts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProcessDocumentParts(t *testing.T) {
+	ps := newTestService(t)
+	footer := `<style>@page { @bottom-center { content: "Page " counter(page) " of " counter(pages) } }</style>`
+	doc := &domain.Document{
+		ID: "compound",
+		Parts: []domain.DocumentPart{
+			{Content: onePagePDF(), ContentType: domain.ContentTypePDF, Title: "Cover"},
+			{Content: footer + "<p>Statement</p>", Title: "Statement"},
+			{Content: pngDataURI(400, 200), ContentType: domain.ContentTypeImage},
+			{Content: footer + "<p>Terms</p>"},
+		},
+		Options: domain.DefaultPrintOptions(),
+	}
+	doc.Options.Performance.EnableCache = false
+	doc.Options.Output.Watermark = &domain.Watermark{Text: "DRAFT"}
+
+	result, err := ps.ProcessDocument(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("ProcessDocument() error = %v", err)
+	}
+	if result.PageCount != 4 {
+		t.Errorf("PageCount = %d, want 4", result.PageCount)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "document part 1") {
+		t.Errorf("Warnings = %q, want one about the watermark of part 1", result.Warnings)
+	}
+
+	data, err := os.ReadFile(result.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages, err := render.CountPDFPages(data); err != nil || pages != 4 {
+		t.Errorf("CountPDFPages() = %d, %v, want 4", pages, err)
+	}
+	// Footers count the pages of the whole job
+	text := pdfContentText(data)
+	for _, footer := range []string{"Page 2 of 4", "Page 4 of 4"} {
+		if !strings.Contains(text, footer) {
+			t.Errorf("merged PDF does not contain footer %q", footer)
+		}
+	}
+}
+
+func TestProcessDocumentRejectsParts(t *testing.T) {
+	ps := newTestService(t)
+	tests := []struct {
+		name string
+		part domain.DocumentPart
+	}{
+		{"image as PDF", domain.DocumentPart{Content: pngDataURI(2, 2), ContentType: domain.ContentTypePDF}},
+		{"PDF as image", domain.DocumentPart{Content: onePagePDF(), ContentType: domain.ContentTypeImage}},
+		{"unreadable PDF", domain.DocumentPart{Content: "data:application/pdf;base64," + base64.StdEncoding.EncodeToString([]byte("%PDF-1.4\n")), ContentType: domain.ContentTypePDF}},
+		{"not a data URI", domain.DocumentPart{Content: "https://example.com/file.pdf", ContentType: domain.ContentTypePDF}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &domain.Document{ID: "compound", Parts: []domain.DocumentPart{tt.part}, Options: domain.DefaultPrintOptions()}
+			_, err := ps.ProcessDocument(context.Background(), doc)
+			var printErr *domain.PrintError
+			if !errors.As(err, &printErr) {
+				t.Errorf("ProcessDocument() error = %v, want a PrintError", err)
+			}
+		})
+	}
+}
@@ -2,7 +2,11 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -21,6 +25,8 @@ type PrintService struct {
 	cssParser      *css.Parser
 	layoutEngine   *layout.Engine
 	pdfRenderer    *render.PDFRenderer
+	imageRenderer  *render.ImageRenderer
+	svgRenderer    *render.SVGRenderer
 	cacheService   *CacheService
 	storageService *StorageService
 	logger         logger.Logger
@@ -40,16 +46,63 @@ func NewPrintService(cfg config.PrintConfig, logger logger.Logger) (*PrintServic
 	// Initialize layout engine
 	layoutEngine := layout.NewEngine()
 
+	// Register configured fonts; unreadable files are skipped so one bad file does not block startup
+	fontManager := render.NewFontManager()
+	if cfg.FontsDirectory != "" {
+		if err := fontManager.LoadDirectory(cfg.FontsDirectory); err != nil {
+			logger.Warn("Some fonts could not be registered", "directory", cfg.FontsDirectory, "error", err)
+		}
+	}
+	fontManager.SetFallbacks(cfg.FallbackFonts)
+
+	// Archival output embeds the configured ICC profile, or sRGB without one
+	var outputIntent render.OutputIntent
+	if cfg.OutputIntent != "" {
+		profile, err := os.ReadFile(cfg.OutputIntent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read output intent profile: %w", err)
+		}
+		if outputIntent, err = render.NewOutputIntent(profile); err != nil {
+			return nil, fmt.Errorf("invalid output intent profile %s: %w", cfg.OutputIntent, err)
+		}
+	}
+
+	// Signed output uses the configured certificate and key
+	var signer *render.Signer
+	if cfg.Signing.CertFile != "" {
+		var err error
+		if signer, err = render.LoadSigner(cfg.Signing.CertFile, cfg.Signing.KeyFile, cfg.Signing.Password); err != nil {
+			return nil, fmt.Errorf("failed to load signing certificate: %w", err)
+		}
+	}
+
 	// Initialize PDF renderer with default options
 	renderOpts := render.PDFRenderOptions{
 		Compression:    true,
 		EmbedFonts:     true,
 		OptimizeImages: true,
 		ColorProfile:   render.ColorProfileRGB,
+		OutputIntent:   outputIntent,
 		PDFVersion:     "1.7",
+		Fonts:          fontManager,
+		Signer:         signer,
+		MaxImagePixels: cfg.MaxImagePixels,
 	}
 	pdfRenderer := render.NewPDFRenderer(renderOpts)
 
+	// Initialize image renderer for raster output
+	imageRenderer := render.NewImageRenderer(render.ImageRenderOptions{
+		Antialias:      true,
+		Interpolation:  render.InterpolationBilinear,
+		ColorSpace:     render.ColorSpaceRGB,
+		Quality:        render.JPEGQuality(domain.QualityNormal),
+		Fonts:          fontManager,
+		MaxImagePixels: cfg.MaxImagePixels,
+	})
+
+	// Initialize SVG renderer for vector output
+	svgRenderer := render.NewSVGRenderer(render.SVGRenderOptions{Precision: 2, MaxImagePixels: cfg.MaxImagePixels})
+
 	// Initialize cache and storage services (simplified for now)
 	cacheService := NewCacheService()
 	storageService := NewStorageService(cfg.OutputDirectory)
@@ -59,6 +112,8 @@ func NewPrintService(cfg config.PrintConfig, logger logger.Logger) (*PrintServic
 		cssParser:      cssParser,
 		layoutEngine:   layoutEngine,
 		pdfRenderer:    pdfRenderer,
+		imageRenderer:  imageRenderer,
+		svgRenderer:    svgRenderer,
 		cacheService:   cacheService,
 		storageService: storageService,
 		logger:         logger.With("service", "print"),
@@ -79,60 +134,105 @@ func (ps *PrintService) ProcessDocument(ctx context.Context, doc *domain.Documen
 
 	// Check cache first
 	cacheKey := ps.generateCacheKey(doc)
-	if cached, err := ps.cacheService.Get(cacheKey); err == nil && cached != nil {
-		ps.logger.Info("Document found in cache", "document_id", doc.ID)
-		if result, ok := cached.(*domain.RenderResult); ok {
-			result.CacheHit = true
-			return result, nil
+	if cacheKey != "" {
+		if cached, err := ps.cacheService.Get(cacheKey); err == nil && cached != nil {
+			ps.logger.Info("Document found in cache", "document_id", doc.ID)
+			if result, ok := cached.(*domain.RenderResult); ok {
+				result.CacheHit = true
+				return result, nil
+			}
 		}
 	}
 
+	// Render the content, or each part of a compound job merged into one PDF
+	var output *render.RenderOutput
+	var err error
+	if len(doc.Parts) > 0 {
+		output, err = ps.renderParts(ctx, doc)
+	} else {
+		output, err = ps.renderContent(ctx, doc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate output
+	result, err := ps.generateOutput(output, doc.Options)
+	if err != nil {
+		return nil, fmt.Errorf("output generation failed: %w", err)
+	}
+
+	// Complete result
+	result.RenderTime = time.Since(startTime)
+	result.CacheHit = false
+
+	// Cache the result
+	if doc.Options.Performance.EnableCache && cacheKey != "" {
+		_ = ps.cacheService.Set(cacheKey, result, doc.Options.Performance.CacheTTL)
+	}
+
+	ps.logger.Info("Document processed successfully",
+		"document_id", doc.ID,
+		"output_path", result.OutputPath,
+		"render_time", result.RenderTime,
+		"page_count", result.PageCount)
+
+	return result, nil
+}
+
+// renderContent renders the HTML content of a document
+func (ps *PrintService) renderContent(ctx context.Context, doc *domain.Document) (*render.RenderOutput, error) {
 	// Parse HTML content
 	domTree, err := ps.parseHTML(doc.Content, doc.Options.Security)
 	if err != nil {
 		return nil, fmt.Errorf("HTML parsing failed: %w", err)
 	}
 
+	// Generate the table of contents from the headings; its page numbers are
+	// filled in once the layout is paginated
+	layout.InsertTableOfContents(domTree, doc.Options.Layout.TableOfContents)
+
 	// Parse CSS (if any)
 	stylesheet, err := ps.parseCSS(doc.Content, doc.Options.Security)
 	if err != nil {
 		return nil, fmt.Errorf("CSS parsing failed: %w", err)
 	}
 
-	// Calculate layout
-	layoutTree, err := ps.layoutEngine.CalculateLayout(domTree, stylesheet, doc.Options.Layout)
+	// Load images so the layout can size them
+	images := render.LoadImages(ctx, domTree, stylesheet, doc.Options, ps.config.MaxImagePixels)
+
+	// Calculate layout against the printable area of the page
+	layoutTree, warnings, err := ps.layoutEngine.CalculateLayout(domTree, stylesheet, ps.layoutOptions(doc.Options), images)
 	if err != nil {
 		return nil, fmt.Errorf("layout calculation failed: %w", err)
 	}
 
-	// Generate output
-	outputPath, err := ps.generateOutput(ctx, layoutTree, doc.Options)
+	// Properties the request leaves empty are taken from the document head
+	metadata := doc.Metadata.WithDefaults(html.ExtractMetadata(domTree))
+
+	// Headers and footers are laid out for each page while rendering
+	running, err := ps.runningContent(ctx, stylesheet, doc.Options, metadata.Title)
 	if err != nil {
-		return nil, fmt.Errorf("output generation failed: %w", err)
+		return nil, fmt.Errorf("header and footer parsing failed: %w", err)
 	}
 
-	// Create result
-	result := &domain.RenderResult{
-		OutputPath: outputPath,
-		OutputSize: ps.getFileSize(outputPath),
-		PageCount:  ps.calculatePageCount(layoutTree, doc.Options.Page),
-		RenderTime: time.Since(startTime),
-		CacheHit:   false,
-		Warnings:   make([]string, 0),
+	// Render the layout tree in the requested format
+	output, err := ps.renderOutput(layoutTree, running, doc.Options, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("output generation failed: %w", err)
 	}
 
-	// Cache the result
-	if doc.Options.Performance.EnableCache {
-		_ = ps.cacheService.Set(cacheKey, result, doc.Options.Performance.CacheTTL)
+	// Images that could not be loaded and barcodes that could not be
+	// encoded are missing from the output
+	for _, warning := range images.Warnings() {
+		ps.logger.Warn("Image not loaded", "document_id", doc.ID, "warning", warning)
 	}
-
-	ps.logger.Info("Document processed successfully",
-		"document_id", doc.ID,
-		"output_path", outputPath,
-		"render_time", result.RenderTime,
-		"page_count", result.PageCount)
-
-	return result, nil
+	warnings = append(warnings, running.Warnings()...)
+	for _, warning := range warnings {
+		ps.logger.Warn("Content not drawn", "document_id", doc.ID, "warning", warning)
+	}
+	output.Warnings = append(append(images.Warnings(), warnings...), output.Warnings...)
+	return output, nil
 }
 
 // ProcessJob processes a print job
@@ -160,6 +260,7 @@ func (ps *PrintService) ProcessJob(ctx context.Context, job interface{}) error {
 	// Update job with results
 	printJob.Status = domain.JobStatusCompleted
 	printJob.OutputPath = result.OutputPath
+	printJob.Signature = result.Signature
 	completed := time.Now()
 	printJob.CompletedAt = &completed
 
@@ -172,16 +273,29 @@ func (ps *PrintService) validateDocument(doc *domain.Document) error {
 		return domain.ErrInvalidDocument
 	}
 
-	if doc.Content == "" {
+	if doc.Content == "" && len(doc.Parts) == 0 {
 		return domain.NewPrintError(domain.ErrCodeInvalidInput, "document content is empty", domain.ErrInvalidDocument)
 	}
 
-	if len(doc.Content) > int(ps.config.MaxFileSize) {
+	if size := documentSize(doc); size > int(ps.config.MaxFileSize) {
 		return domain.NewPrintError(domain.ErrCodeResourceLimit, "document too large", domain.ErrDocumentTooLarge).
-			WithDetail("size", len(doc.Content)).
+			WithDetail("size", size).
 			WithDetail("max_size", ps.config.MaxFileSize)
 	}
 
+	format := doc.Options.Output.Format
+	if doc.Options.Output.Encryption != nil && format != domain.FormatPDF && format != "" {
+		return domain.NewPrintError(domain.ErrCodeInvalidInput, "encryption is only available for PDF output", domain.ErrUnsupportedFormat).
+			WithDetail("format", format)
+	}
+	if doc.Options.Output.Signature != nil && format != domain.FormatPDF && format != "" {
+		return domain.NewPrintError(domain.ErrCodeInvalidInput, "signatures are only available for PDF output", domain.ErrUnsupportedFormat).
+			WithDetail("format", format)
+	}
+
+	if len(doc.Parts) > 0 {
+		return validateParts(doc)
+	}
 	return nil
 }
 
@@ -197,211 +311,163 @@ func (ps *PrintService) parseCSS(content string, _ domain.SecurityOptions) (*css
 	return ps.cssParser.Parse(cssContent)
 }
 
-// extractCSS extracts CSS from HTML content
-func (ps *PrintService) extractCSS(_ string) string {
-	// Simplified CSS extraction - in a real implementation this would
-	// properly extract CSS from <style> tags and external stylesheets
-	return ""
-}
+// styleBlockPattern matches embedded <style> elements
+var styleBlockPattern = regexp.MustCompile(`(?is)<style[^>]*>(.*?)</style>`)
 
-// generateOutput generates the final output file
-func (ps *PrintService) generateOutput(ctx context.Context, layoutTree *domain.LayoutNode, options domain.PrintOptions) (string, error) {
-	// Generate unique filename
-	filename := fmt.Sprintf("output_%d.%s", time.Now().UnixNano(), options.Output.Format)
-	outputPath := ps.storageService.GetPath(filename)
-
-	// Generate real PDF content based on layout tree
-	pdfContent, err := ps.generatePDFContent(layoutTree, options)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate PDF content: %w", err)
+// extractCSS extracts CSS from the <style> elements of HTML content
+func (ps *PrintService) extractCSS(content string) string {
+	var builder strings.Builder
+	for _, match := range styleBlockPattern.FindAllStringSubmatch(content, -1) {
+		builder.WriteString(match[1])
+		builder.WriteString("\n")
 	}
+	return builder.String()
+}
 
-	// Write PDF content to file
-	if err := ps.storageService.WriteFile(outputPath, pdfContent); err != nil {
-		return "", fmt.Errorf("failed to write PDF file: %w", err)
+// layoutOptions sizes the layout viewport to the printable width of the page
+func (ps *PrintService) layoutOptions(options domain.PrintOptions) domain.LayoutOptions {
+	layoutOpts := options.Layout
+	page := render.ResolvePageGeometry(options.Page)
+	if width := page.ContentWidthPixels(); width > 0 {
+		layoutOpts.ViewportWidth = int(width)
 	}
-
-	ps.logger.Info("Generated PDF", "output_path", outputPath, "size_bytes", len(pdfContent))
-	return outputPath, nil
+	if layoutOpts.ViewportHeight <= 0 {
+		layoutOpts.ViewportHeight = int(page.ContentHeightPixels())
+	}
+	return layoutOpts
 }
 
-// generatePDFContent generates actual PDF content from layout tree
-func (ps *PrintService) generatePDFContent(layoutTree *domain.LayoutNode, options domain.PrintOptions) ([]byte, error) {
-	// Create a basic PDF structure with realistic content
-	// This is a simplified PDF generation - in production you'd use a proper PDF library
-
-	// Extract text content from layout tree
-	textContent := ps.extractTextFromLayout(layoutTree)
-	if textContent == "" {
-		textContent = "Generated PDF Document"
+// runningContent prepares the headers and footers of a document from the
+// @page margin boxes of its style sheet. Templates in the request replace
+// the margin boxes of their margin.
+func (ps *PrintService) runningContent(ctx context.Context, stylesheet *css.Stylesheet, options domain.PrintOptions, title string) (*layout.RunningContent, error) {
+	requested := map[layout.MarginEdge]string{
+		layout.MarginTop:    options.Page.Header,
+		layout.MarginBottom: options.Page.Footer,
 	}
 
-	// Generate a basic but realistic PDF with proper structure
-	pdfContent := ps.createBasicPDF(textContent, options)
+	var templates []layout.RunningTemplate
+	for _, template := range layout.MarginBoxTemplates(stylesheet) {
+		if requested[template.Edge] == "" {
+			templates = append(templates, template)
+		}
+	}
+	for _, edge := range []layout.MarginEdge{layout.MarginTop, layout.MarginBottom} {
+		content := requested[edge]
+		if content == "" {
+			continue
+		}
+		domTree, err := ps.parseHTML(content, options.Security)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s template: %w", edge, err)
+		}
+		if err := layout.ExpandTemplateFunctions(domTree); err != nil {
+			return nil, fmt.Errorf("invalid %s template: %w", edge, err)
+		}
+		sheet, err := ps.parseCSS(content, options.Security)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s template style: %w", edge, err)
+		}
+		templates = append(templates, layout.RunningTemplate{
+			Edge:       edge,
+			Content:    domTree,
+			Stylesheet: sheet,
+			Images:     render.LoadImages(ctx, domTree, sheet, options, ps.config.MaxImagePixels),
+		})
+	}
 
-	return pdfContent, nil
+	return ps.layoutEngine.NewRunningContent(templates, ps.layoutOptions(options), title, time.Now().Format("2006-01-02")), nil
 }
 
-// extractTextFromLayout extracts text content from layout tree
-func (ps *PrintService) extractTextFromLayout(node *domain.LayoutNode) string {
-	if node == nil {
-		return ""
-	}
+// generateOutput writes rendered output to its file
+func (ps *PrintService) generateOutput(output *render.RenderOutput, options domain.PrintOptions) (*domain.RenderResult, error) {
+	// Generate unique filename
+	filename := fmt.Sprintf("output_%d.%s", time.Now().UnixNano(), output.Extension)
+	outputPath := ps.storageService.GetPath(filename)
 
-	// For now, return a realistic document based on common patterns
-	// In production, this would traverse the actual layout tree
-	return `Invoice #12345
-Date: 2025-08-12
-Customer: Acme Corporation
+	// Write rendered content to file
+	if err := ps.storageService.WriteFile(outputPath, output.Data); err != nil {
+		return nil, fmt.Errorf("failed to write output file: %w", err)
+	}
 
-Description                 Quantity    Price      Total
-Web Development Services         1    $2,500.00  $2,500.00
-Consulting Hours                10      $150.00  $1,500.00
-                                              ___________
-                                    Subtotal:  $4,000.00
-                                         Tax:    $320.00
-                                       Total:  $4,320.00
+	warnings := make([]string, 0, len(output.Warnings))
+	for _, warning := range output.Warnings {
+		ps.logger.Warn("Render warning", "warning", warning)
+		warnings = append(warnings, warning)
+	}
 
-Thank you for your business!`
-}
+	ps.logger.Info("Generated output",
+		"output_path", outputPath,
+		"format", options.Output.Format,
+		"size_bytes", len(output.Data),
+		"page_count", output.PageCount)
 
-// createBasicPDF creates a basic PDF with proper structure and realistic size
-func (ps *PrintService) createBasicPDF(content string, options domain.PrintOptions) []byte {
-	// Create a basic PDF structure (simplified but realistic)
-	// This generates a PDF-like binary with proper headers and content
-
-	// PDF header
-	pdfHeader := "%PDF-1.7\n"
-
-	// Format content for PDF
-	formattedContent := ps.formatPDFText(content)
-	contentLength := len(formattedContent) + 100
-
-	// PDF objects (build as complete string)
-	pdfObjects := fmt.Sprintf(`1 0 obj
-<<
-/Type /Catalog
-/Pages 2 0 R
->>
-endobj
-
-2 0 obj
-<<
-/Type /Pages
-/Kids [3 0 R]
-/Count 1
->>
-endobj
-
-3 0 obj
-<<
-/Type /Page
-/Parent 2 0 R
-/MediaBox [0 0 612 792]
-/Resources <<
-/Font <<
-/F1 4 0 R
->>
->>
-/Contents 5 0 R
->>
-endobj
-
-4 0 obj
-<<
-/Type /Font
-/Subtype /Type1
-/BaseFont /Helvetica
->>
-endobj
-
-5 0 obj
-<<
-/Length %d
->>
-stream
-BT
-/F1 12 Tf
-50 750 Td
-%s
-ET
-endstream
-endobj
-
-xref
-0 6
-0000000000 65535 f 
-0000000009 00000 n 
-0000000058 00000 n 
-0000000115 00000 n 
-0000000265 00000 n 
-0000000337 00000 n 
-trailer
-<<
-/Size 6
-/Root 1 0 R
->>
-startxref
-%d
-%%%%EOF`, contentLength, formattedContent, len(pdfHeader))
-
-	// Combine all parts
-	fullPDF := pdfHeader + pdfObjects
-
-	// Add some padding to make it more realistic (typical PDF size)
-	padding := make([]byte, 1024) // Add 1KB of padding for realistic size
-	for i := range padding {
-		padding[i] = byte(i % 256)
-	}
-
-	return append([]byte(fullPDF), padding...)
+	return &domain.RenderResult{
+		OutputPath: outputPath,
+		OutputSize: int64(len(output.Data)),
+		PageCount:  output.PageCount,
+		Warnings:   warnings,
+		Signature:  output.Signature,
+	}, nil
 }
 
-// formatPDFText formats text content for PDF stream
-func (ps *PrintService) formatPDFText(content string) string {
-	// Simple text formatting for PDF
-	lines := []string{}
-	for i, line := range strings.Split(content, "\n") {
-		if line != "" {
-			lines = append(lines, fmt.Sprintf("(%s) Tj\n0 -15 Td", line))
+// renderOutput dispatches the layout tree to the renderer for the output format
+func (ps *PrintService) renderOutput(layoutTree *domain.LayoutNode, running *layout.RunningContent, options domain.PrintOptions, metadata domain.DocumentMetadata) (*render.RenderOutput, error) {
+	switch options.Output.Format {
+	case domain.FormatPDF, "":
+		output, err := ps.pdfRenderer.Render(layoutTree, running, options, metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate PDF content: %w", err)
 		}
-		if i > 20 { // Limit to reasonable number of lines
-			break
+		return output, nil
+	case domain.FormatPNG, domain.FormatJPEG:
+		output, err := ps.imageRenderer.Render(layoutTree, running, options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate %s content: %w", options.Output.Format, err)
 		}
+		return output, nil
+	case domain.FormatSVG:
+		output, err := ps.svgRenderer.Render(layoutTree, running, options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate SVG content: %w", err)
+		}
+		return output, nil
+	default:
+		return nil, domain.NewPrintError(domain.ErrCodeInvalidInput, "unsupported output format", domain.ErrUnsupportedFormat).
+			WithDetail("format", options.Output.Format)
 	}
-	return strings.Join(lines, "\n")
 }
 
-// generateCacheKey generates a cache key for a document
+// generateCacheKey derives a cache key from everything that affects the
+// output: the content or parts, the metadata and the print options. It
+// returns "", which is never looked up or stored, when the document cannot
+// be hashed or its output is encrypted or signed: the passwords are left out
+// of the options' JSON, and such output is never the same twice.
 func (ps *PrintService) generateCacheKey(doc *domain.Document) string {
-	// Simple cache key generation - in production would use proper hashing
-	return fmt.Sprintf("doc_%s_%d", doc.ID, len(doc.Content))
-}
-
-// getFileSize gets the size of a file
-func (ps *PrintService) getFileSize(_ string) int64 {
-	// Simplified - would use actual file stat
-	return 1024 // placeholder
-}
-
-// calculatePageCount calculates the number of pages
-func (ps *PrintService) calculatePageCount(layoutTree *domain.LayoutNode, pageOptions domain.PageOptions) int {
-	// Simplified page count calculation
-	if layoutTree == nil {
-		return 1
+	if doc.Options.Output.Encryption != nil || doc.Options.Output.Signature != nil {
+		return ""
 	}
 
-	pageHeight := pageOptions.Size.Height
-	if pageHeight <= 0 {
-		return 1
+	h := sha256.New()
+	err := json.NewEncoder(h).Encode(struct {
+		Content     string
+		ContentType domain.ContentType
+		Parts       []domain.DocumentPart
+		Metadata    domain.DocumentMetadata
+		Options     domain.PrintOptions
+	}{doc.Content, doc.ContentType, doc.Parts, doc.Metadata, doc.Options})
+	if err != nil {
+		ps.logger.Warn("Document cannot be cached", "document_id", doc.ID, "error", err)
+		return ""
 	}
+	return fmt.Sprintf("doc_%s_%x", doc.ID, h.Sum(nil))
+}
 
-	totalHeight := layoutTree.Box.Height
-	pages := int(totalHeight/pageHeight) + 1
-
-	if pages < 1 {
-		pages = 1
+// documentSize returns the size of the content of a document and its parts
+func documentSize(doc *domain.Document) int {
+	size := len(doc.Content)
+	for _, part := range doc.Parts {
+		size += len(part.Content)
 	}
-
-	return pages
+	return size
 }
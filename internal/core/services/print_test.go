@@ -0,0 +1,197 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"print-service/internal/core/domain"
+)
+
+// threePages is a document of three pages
+const threePages = `<div style="break-after: page">One</div><div style="break-after: page">Two</div><div>Three</div>`
+
+func TestProcessDocumentImagePages(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     domain.OutputFormat
+		pageNumber int
+		wantExt    string
+		wantPages  int
+	}{
+		{"PNG pages", domain.FormatPNG, 0, ".zip", 3},
+		{"selected PNG page", domain.FormatPNG, 2, ".png", 1},
+		{"SVG pages", domain.FormatSVG, 0, ".zip", 3},
+		{"selected SVG page", domain.FormatSVG, 3, ".svg", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := newTestService(t)
+			doc := &domain.Document{ID: "pages", Content: threePages, Options: domain.DefaultPrintOptions()}
+			doc.Options.Performance.EnableCache = false
+			doc.Options.Output.Format = tt.format
+			doc.Options.Output.PageNumber = tt.pageNumber
+
+			result, err := ps.ProcessDocument(context.Background(), doc)
+			if err != nil {
+				t.Fatalf("ProcessDocument() error = %v", err)
+			}
+			if result.PageCount != tt.wantPages || filepath.Ext(result.OutputPath) != tt.wantExt {
+				t.Fatalf("ProcessDocument() = %d pages in %s, want %d in a %s file", result.PageCount, result.OutputPath, tt.wantPages, tt.wantExt)
+			}
+			if tt.wantExt != ".zip" {
+				return
+			}
+			data, err := os.ReadFile(result.OutputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("invalid archive: %v", err)
+			}
+			if len(archive.File) != tt.wantPages {
+				t.Errorf("archive has %d entries, want %d", len(archive.File), tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestProcessDocumentRejectsMissingPage(t *testing.T) {
+	ps := newTestService(t)
+	doc := &domain.Document{ID: "pages", Content: threePages, Options: domain.DefaultPrintOptions()}
+	doc.Options.Output.Format = domain.FormatPNG
+	doc.Options.Output.PageNumber = 4
+	if _, err := ps.ProcessDocument(context.Background(), doc); err == nil {
+		t.Error("ProcessDocument() of page 4 of 3 succeeded, want an error")
+	}
+}
+
+func TestProcessDocumentWarnsOfInvalidBarcode(t *testing.T) {
+	ps := newTestService(t)
+	doc := &domain.Document{ID: "barcode", Content: `<p>Order</p><barcode type="ean13" value="12345ABC" text=""></barcode>`, Options: domain.DefaultPrintOptions()}
+	doc.Options.Page.Footer = `<barcode type="qr" value=""></barcode>`
+	result, err := ps.ProcessDocument(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("ProcessDocument() error = %v", err)
+	}
+	var body, footer int
+	for _, warning := range result.Warnings {
+		switch {
+		case strings.Contains(warning, "bottom margin") && strings.Contains(warning, "barcode"):
+			footer++
+		case strings.Contains(warning, "12345ABC"):
+			body++
+		}
+	}
+	if body != 1 || footer != 1 {
+		t.Errorf("Warnings = %q, want one for the barcode and one for the footer barcode", result.Warnings)
+	}
+}
+
+func TestProcessDocumentRejectsUnknownFooterFunction(t *testing.T) {
+	ps := newTestService(t)
+	doc := &domain.Document{ID: "footer", Content: threePages, Options: domain.DefaultPrintOptions()}
+	doc.Options.Page.Footer = "Chapter counter(chapter)"
+	if _, err := ps.ProcessDocument(context.Background(), doc); err == nil {
+		t.Error("ProcessDocument() with counter(chapter) in the footer succeeded, want an error")
+	}
+}
+
+func TestGenerateCacheKey(t *testing.T) {
+	ps := newTestService(t)
+	base := func() *domain.Document {
+		return &domain.Document{ID: "doc", Content: "<p>Hello</p>", Options: domain.DefaultPrintOptions()}
+	}
+	key := ps.generateCacheKey(base())
+	if again := ps.generateCacheKey(base()); again != key {
+		t.Errorf("generateCacheKey() = %q then %q for the same document", key, again)
+	}
+
+	tests := []struct {
+		name   string
+		change func(doc *domain.Document)
+	}{
+		{"content of the same size", func(doc *domain.Document) { doc.Content = "<p>World</p>" }},
+		{"output format", func(doc *domain.Document) { doc.Options.Output.Format = domain.FormatPNG }},
+		{"page number", func(doc *domain.Document) { doc.Options.Output.PageNumber = 2 }},
+		{"watermark", func(doc *domain.Document) { doc.Options.Output.Watermark = &domain.Watermark{Text: "DRAFT"} }},
+		{"metadata", func(doc *domain.Document) { doc.Metadata.Title = "Report" }},
+		{"parts", func(doc *domain.Document) {
+			doc.Content = ""
+			doc.Parts = []domain.DocumentPart{{Content: "<p>Hello</p>"}}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := base()
+			tt.change(doc)
+			if got := ps.generateCacheKey(doc); got == key {
+				t.Errorf("generateCacheKey() = %q, want a key other than the unchanged document's", got)
+			}
+		})
+	}
+}
+
+func TestGenerateCacheKeyProtectedOutput(t *testing.T) {
+	ps := newTestService(t)
+	for name, protect := range map[string]func(doc *domain.Document){
+		"encrypted": func(doc *domain.Document) {
+			doc.Options.Output.Encryption = &domain.Encryption{UserPassword: "alice"}
+		},
+		"signed": func(doc *domain.Document) { doc.Options.Output.Signature = &domain.Signature{} },
+	} {
+		doc := &domain.Document{ID: "doc", Content: "<p>Hello</p>", Options: domain.DefaultPrintOptions()}
+		protect(doc)
+		if key := ps.generateCacheKey(doc); key != "" {
+			t.Errorf("generateCacheKey() of %s output = %q, want none", name, key)
+		}
+	}
+}
+
+func TestProcessDocumentDoesNotCacheEncryptedOutput(t *testing.T) {
+	ps := newTestService(t)
+	for _, password := range []string{"alice", "bob"} {
+		doc := &domain.Document{ID: "secret", Content: "<p>Hello</p>", Options: domain.DefaultPrintOptions()}
+		doc.Options.Performance.EnableCache = true
+		doc.Options.Output.Encryption = &domain.Encryption{UserPassword: password}
+		result, err := ps.ProcessDocument(context.Background(), doc)
+		if err != nil {
+			t.Fatalf("ProcessDocument() error = %v", err)
+		}
+		if result.CacheHit {
+			t.Errorf("ProcessDocument() with the password %q was served from the cache", password)
+		}
+	}
+}
+
+func TestProcessDocumentCachesByOptions(t *testing.T) {
+	ps := newTestService(t)
+	doc := &domain.Document{ID: "cached", Content: "<p>Hello</p>", Options: domain.DefaultPrintOptions()}
+	doc.Options.Performance.EnableCache = true
+	if _, err := ps.ProcessDocument(context.Background(), doc); err != nil {
+		t.Fatalf("ProcessDocument() error = %v", err)
+	}
+
+	// The same document as an image is rendered again rather than served the PDF
+	doc.Options.Output.Format = domain.FormatPNG
+	result, err := ps.ProcessDocument(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("ProcessDocument() error = %v", err)
+	}
+	if result.CacheHit || filepath.Ext(result.OutputPath) != ".png" {
+		t.Errorf("ProcessDocument() = %s, cache hit %v, want a new PNG", result.OutputPath, result.CacheHit)
+	}
+
+	result, err = ps.ProcessDocument(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("ProcessDocument() error = %v", err)
+	}
+	if !result.CacheHit {
+		t.Error("ProcessDocument() of an unchanged document missed the cache")
+	}
+}
@@ -57,6 +57,7 @@ func getDefaultConfig() *Config {
 		},
 		Print: PrintConfig{
 			MaxFileSize:     10 * 1024 * 1024,
+			MaxImagePixels:  50 * 1000 * 1000,
 			OutputDirectory: "./output",
 			TempDirectory:   "./temp",
 			Timeout:         2 * time.Minute,
@@ -153,12 +154,35 @@ func loadFromEnv(cfg *Config) {
 			cfg.Print.MaxFileSize = s
 		}
 	}
+	if maxImagePixels := os.Getenv("PRINT_MAX_IMAGE_PIXELS"); maxImagePixels != "" {
+		if p := parseInt64(maxImagePixels); p > 0 {
+			cfg.Print.MaxImagePixels = p
+		}
+	}
 	if outputDir := os.Getenv("PRINT_OUTPUT_DIRECTORY"); outputDir != "" {
 		cfg.Print.OutputDirectory = outputDir
 	}
 	if tempDir := os.Getenv("PRINT_TEMP_DIRECTORY"); tempDir != "" {
 		cfg.Print.TempDirectory = tempDir
 	}
+	if fontsDir := os.Getenv("PRINT_FONTS_DIRECTORY"); fontsDir != "" {
+		cfg.Print.FontsDirectory = fontsDir
+	}
+	if fallbackFonts := os.Getenv("PRINT_FALLBACK_FONTS"); fallbackFonts != "" {
+		cfg.Print.FallbackFonts = strings.Split(fallbackFonts, ",")
+	}
+	if outputIntent := os.Getenv("PRINT_OUTPUT_INTENT"); outputIntent != "" {
+		cfg.Print.OutputIntent = outputIntent
+	}
+	if certFile := os.Getenv("PRINT_SIGNING_CERT_FILE"); certFile != "" {
+		cfg.Print.Signing.CertFile = certFile
+	}
+	if keyFile := os.Getenv("PRINT_SIGNING_KEY_FILE"); keyFile != "" {
+		cfg.Print.Signing.KeyFile = keyFile
+	}
+	if password := os.Getenv("PRINT_SIGNING_PASSWORD"); password != "" {
+		cfg.Print.Signing.Password = password
+	}
 
 	// Queue configuration
 	if queueType := os.Getenv("QUEUE_TYPE"); queueType != "" {
@@ -43,10 +43,22 @@ type WorkerConfig struct {
 // PrintConfig represents print service configuration
 type PrintConfig struct {
 	MaxFileSize     int64         `yaml:"max_file_size" json:"max_file_size"`
+	MaxImagePixels  int64         `yaml:"max_image_pixels" json:"max_image_pixels"` // Largest width × height an image may decode to
 	OutputDirectory string        `yaml:"output_directory" json:"output_directory"`
 	TempDirectory   string        `yaml:"temp_directory" json:"temp_directory"`
 	Timeout         time.Duration `yaml:"timeout" json:"timeout"`
 	MaxConcurrent   int           `yaml:"max_concurrent" json:"max_concurrent"`
+	FontsDirectory  string        `yaml:"fonts_directory" json:"fonts_directory"` // TTF/OTF files to register
+	FallbackFonts   []string      `yaml:"fallback_fonts" json:"fallback_fonts"`   // Families tried when a requested family is missing
+	OutputIntent    string        `yaml:"output_intent" json:"output_intent"`     // ICC profile for PDF/A output intents and CMYK conversion; sRGB when empty
+	Signing         SigningConfig `yaml:"signing" json:"signing"`
+}
+
+// SigningConfig locates the certificate and private key used to sign PDF output
+type SigningConfig struct {
+	CertFile string `yaml:"cert_file" json:"cert_file"` // PEM certificate chain, signer first, or a PKCS#12 bundle holding the key as well
+	KeyFile  string `yaml:"key_file" json:"key_file"`   // PEM private key; empty when CertFile holds the key
+	Password string `yaml:"password" json:"-"`          // PKCS#12 password
 }
 
 // QueueConfig represents queue configuration
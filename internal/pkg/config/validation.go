@@ -154,6 +154,13 @@ func (c *Config) validatePrint() error {
 		})
 	}
 
+	if c.Print.MaxImagePixels < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "print.max_image_pixels",
+			Message: "max image pixels cannot be negative",
+		})
+	}
+
 	if c.Print.Timeout <= 0 {
 		errors = append(errors, ValidationError{
 			Field:   "print.timeout",
@@ -161,6 +168,60 @@ func (c *Config) validatePrint() error {
 		})
 	}
 
+	if c.Print.FontsDirectory != "" {
+		if info, err := os.Stat(c.Print.FontsDirectory); err != nil {
+			errors = append(errors, ValidationError{
+				Field:   "print.fonts_directory",
+				Message: fmt.Sprintf("cannot access fonts directory: %v", err),
+			})
+		} else if !info.IsDir() {
+			errors = append(errors, ValidationError{
+				Field:   "print.fonts_directory",
+				Message: "fonts directory path is not a directory",
+			})
+		}
+	}
+
+	if c.Print.OutputIntent != "" {
+		if info, err := os.Stat(c.Print.OutputIntent); err != nil {
+			errors = append(errors, ValidationError{
+				Field:   "print.output_intent",
+				Message: fmt.Sprintf("cannot access output intent profile: %v", err),
+			})
+		} else if info.IsDir() {
+			errors = append(errors, ValidationError{
+				Field:   "print.output_intent",
+				Message: "output intent profile path is a directory",
+			})
+		}
+	}
+
+	for _, file := range []struct{ field, path string }{
+		{"print.signing.cert_file", c.Print.Signing.CertFile},
+		{"print.signing.key_file", c.Print.Signing.KeyFile},
+	} {
+		if file.path == "" {
+			continue
+		}
+		if info, err := os.Stat(file.path); err != nil {
+			errors = append(errors, ValidationError{
+				Field:   file.field,
+				Message: fmt.Sprintf("cannot access signing file: %v", err),
+			})
+		} else if info.IsDir() {
+			errors = append(errors, ValidationError{
+				Field:   file.field,
+				Message: "signing file path is a directory",
+			})
+		}
+	}
+	if c.Print.Signing.KeyFile != "" && c.Print.Signing.CertFile == "" {
+		errors = append(errors, ValidationError{
+			Field:   "print.signing.cert_file",
+			Message: "a signing key needs a certificate",
+		})
+	}
+
 	if len(errors) > 0 {
 		return errors
 	}
@@ -259,6 +320,9 @@ func (c *Config) SetDefaults() {
 	if c.Print.MaxFileSize == 0 {
 		c.Print.MaxFileSize = 50 * 1024 * 1024 // 50MB
 	}
+	if c.Print.MaxImagePixels == 0 {
+		c.Print.MaxImagePixels = 50 * 1000 * 1000 // 50 megapixels
+	}
 	if c.Print.Timeout == 0 {
 		c.Print.Timeout = 5 * time.Minute
 	}